@@ -1,19 +1,28 @@
 package commands
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
+	"text/tabwriter"
+	"time"
 
 	"github.com/dotmesh-io/dotmesh/pkg/client"
+	"github.com/dotmesh-io/dotmesh/pkg/types"
 	"github.com/spf13/cobra"
 )
 
+var branchVerbose bool
+
 func NewCmdBranch(out io.Writer) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "branch",
 		Short: "List branches",
-		Long:  "Online help: https://docs.dotmesh.com/references/cli/#list-the-branches-dm-branch",
+		Long: `Lists the branches of the current dot, marking the current branch with a *.
+With -v, each branch's latest commit and how many commits it has are shown too.
+
+Online help: https://docs.dotmesh.com/references/cli/#list-the-branches-dm-branch`,
 		Run: func(cmd *cobra.Command, args []string) {
 			err := func() error {
 				dm, err := client.NewDotmeshAPI(configPath, verboseOutput)
@@ -28,6 +37,9 @@ func NewCmdBranch(out io.Writer) *cobra.Command {
 				if err != nil {
 					return err
 				}
+				if branchVerbose {
+					return listBranchesWithInfo(dm, v, b, out)
+				}
 				bs, err := dm.AllBranches(v)
 				if err != nil {
 					return err
@@ -48,5 +60,33 @@ func NewCmdBranch(out io.Writer) *cobra.Command {
 			}
 		},
 	}
+	cmd.Flags().BoolVarP(&branchVerbose, "verbose", "v", false, "show each branch's latest commit")
 	return cmd
 }
+
+func listBranchesWithInfo(dm *client.DotmeshAPI, volumeName, currentBranch string, out io.Writer) error {
+	namespace, name, err := client.ParseNamespacedVolume(volumeName)
+	if err != nil {
+		return err
+	}
+	branches, err := dm.ListBranchesWithInfo(context.Background(), types.VolumeName{Namespace: namespace, Name: name})
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 3, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "  BRANCH\tCOMMITS\tHEAD\tCOMMITTED\tMESSAGE")
+	for _, branch := range branches {
+		marker := "  "
+		if branch.Name == currentBranch {
+			marker = "* "
+		}
+		committed := ""
+		if !branch.HeadCommitAt.IsZero() {
+			committed = branch.HeadCommitAt.Local().Format(time.RFC1123)
+		}
+		fmt.Fprintf(w, "%s%s\t%d\t%s\t%s\t%s\n",
+			marker, branch.Name, branch.CommitCount, branch.HeadCommitID, committed, branch.HeadCommitMessage)
+	}
+	return w.Flush()
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var checkoutFromCommit string
+
 func NewCmdCheckout(out io.Writer) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "checkout",
@@ -33,7 +35,10 @@ func NewCmdCheckout(out io.Writer) *cobra.Command {
 				if err != nil {
 					return err
 				}
-				if err := dm.CheckoutBranch(v, b, branch, makeBranch); err != nil {
+				if checkoutFromCommit != "" && !makeBranch {
+					return fmt.Errorf("--from can only be used with -b, when making a branch")
+				}
+				if err := dm.CheckoutBranch(v, b, branch, makeBranch, checkoutFromCommit); err != nil {
 					return err
 				}
 				return nil
@@ -45,5 +50,7 @@ func NewCmdCheckout(out io.Writer) *cobra.Command {
 		},
 	}
 	cmd.Flags().BoolVarP(&makeBranch, "branch", "b", false, "Make branch")
+	cmd.Flags().StringVarP(&checkoutFromCommit, "from", "", "",
+		"make the branch from this commit (an id, tag or HEAD^-style reference) rather than the latest")
 	return cmd
 }
@@ -1,7 +1,10 @@
 package commands
 
 import (
+	"context"
+	"fmt"
 	"io"
+	"strings"
 
 	"github.com/dotmesh-io/dotmesh/pkg/client"
 	"github.com/spf13/cobra"
@@ -9,10 +12,12 @@ import (
 
 var cloneLocalVolume string
 var stash bool
+var estimateTransfer bool
+var transferCompression string
 
 func NewCmdClone(out io.Writer) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "clone <remote> [<dot> [<branch>]] [--local-name=<dot>] [--stash-on-divergence]",
+		Use:   "clone <remote> [<dot> [<branch>]] [--local-name=<dot>] [--stash-on-divergence] | clone <remote>:<dot> [<local dot>]",
 		Short: `Make a complete copy of a remote dot`,
 		// XXX should this specify a branch?
 		Long: `Make a complete copy on the current active cluster of the given
@@ -25,6 +30,12 @@ copy of 'app_billing_postgres' at all yet:
 
     dm clone devdata billing_postgres repro_bug_1131
 
+Or, as with git clone, give the remote and dot together, and optionally the
+local name, to copy the master branch and make the remote dot the default
+for later pushes and pulls:
+
+    dm clone devdata:alice/billing_postgres billing
+
 Online help: https://docs.dotmesh.com/references/cli/#clone-dm-clone-local-name-local-dot-remote-dot-branch
 `,
 		Run: func(cmd *cobra.Command, args []string) {
@@ -33,12 +44,34 @@ Online help: https://docs.dotmesh.com/references/cli/#clone-dm-clone-local-name-
 				if err != nil {
 					return err
 				}
+				dm.Out = out
+				if len(args) > 0 && strings.Contains(args[0], ":") {
+					if len(args) > 2 {
+						return fmt.Errorf("Please specify just <remote>:<dot> and, optionally, the local dot name.")
+					}
+					localVolume := cloneLocalVolume
+					if len(args) == 2 {
+						localVolume = args[1]
+					}
+					peerAndVolume := strings.SplitN(args[0], ":", 2)
+					if estimateTransfer {
+						dm.TransferEstimateOut = out
+					}
+					dm.TransferCompression = transferCompression
+					dm.ShowTransferProgress = true
+					return dm.CloneFromRemote(context.Background(), peerAndVolume[0], peerAndVolume[1], localVolume)
+				}
+
 				// TODO check that filesystem does _not_ exist on toRemote
 
 				peer, filesystemName, branchName, err := resolveTransferArgs(args)
 				if err != nil {
 					return err
 				}
+				if estimateTransfer {
+					dm.TransferEstimateOut = out
+				}
+				dm.TransferCompression = transferCompression
 				transferId, err := dm.RequestTransfer(
 					"pull", peer,
 					cloneLocalVolume, branchName,
@@ -63,5 +96,9 @@ Online help: https://docs.dotmesh.com/references/cli/#clone-dm-clone-local-name-
 	cmd.PersistentFlags().StringVarP(&cloneLocalVolume, "local-name", "", "",
 		"Local dot name to create")
 	cmd.PersistentFlags().BoolVarP(&stash, "stash-on-divergence", "", false, "stash any divergence on a branch and continue")
+	cmd.PersistentFlags().BoolVarP(&estimateTransfer, "estimate", "", false,
+		"show how many commits and bytes the transfer should move before starting it")
+	cmd.PersistentFlags().StringVarP(&transferCompression, "compression", "", "",
+		"compress the data sent over the network, with gzip or lz4, if the remote can decompress it")
 	return cmd
 }
@@ -204,12 +204,11 @@ func NewCmdClusterBackupEtcd(out io.Writer) *cobra.Command {
 				fmt.Fprintln(os.Stderr, err.Error())
 				os.Exit(1)
 			}
-			dump, err := dm.BackupEtcd()
+			err = dm.BackupEtcd(out, os.Stderr)
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err.Error())
 				os.Exit(1)
 			}
-			out.Write([]byte(dump))
 
 		},
 	}
@@ -223,18 +222,12 @@ func NewCmdClusterRestoreEtcd(out io.Writer, in io.Reader) *cobra.Command {
 		Long:  "Online help: FIXME",
 		Run: func(cmd *cobra.Command, args []string) {
 
-			bs, err := ioutil.ReadAll(in)
-			if err != nil {
-				fmt.Fprintln(os.Stderr, err.Error())
-				os.Exit(1)
-			}
-
 			dm, err := client.NewDotmeshAPI(configPath, verboseOutput)
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err.Error())
 				os.Exit(1)
 			}
-			err = dm.RestoreEtcd(string(bs))
+			err = dm.RestoreEtcd(in, os.Stderr)
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err.Error())
 				os.Exit(1)
@@ -0,0 +1,128 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dotmesh-io/dotmesh/pkg/client"
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+func NewCmdGraph(out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "graph [<dot>]",
+		Short: "Show the dots a dot was forked from and has been forked into",
+		Long: `Draws the fork lineage of a dot (the current dot, if none is given) as a tree,
+from the original dot it was ultimately forked from down through every fork
+of it, marking the dot itself with a *.`,
+
+		Run: func(cmd *cobra.Command, args []string) {
+			err := graphDot(cmd, args, out)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+		},
+	}
+	return cmd
+}
+
+func graphDot(cmd *cobra.Command, args []string, out io.Writer) error {
+	dm, err := client.NewDotmeshAPI(configPath, verboseOutput)
+	if err != nil {
+		return err
+	}
+
+	var dot string
+	switch len(args) {
+	case 0:
+		dot, err = dm.CurrentVolume()
+		if err != nil {
+			return err
+		}
+		if dot == "" {
+			return fmt.Errorf("No current dot is selected. Specify one, or select one with 'dm switch'.")
+		}
+	case 1:
+		dot = args[0]
+	default:
+		return fmt.Errorf("Please specify at most one dot.")
+	}
+	namespace, name, err := client.ParseNamespacedVolume(dot)
+	if err != nil {
+		return err
+	}
+	vol := types.VolumeName{Namespace: namespace, Name: name}
+
+	ctx := context.Background()
+	lineages := map[types.VolumeName]*types.ForkLineage{}
+	lineageOf := func(vol types.VolumeName) (*types.ForkLineage, error) {
+		if lineage, ok := lineages[vol]; ok {
+			return lineage, nil
+		}
+		lineage, err := dm.GetForkLineage(ctx, vol)
+		if err != nil {
+			return nil, err
+		}
+		lineages[vol] = lineage
+		return lineage, nil
+	}
+
+	// Find the original the dot was forked from
+	root := vol
+	for {
+		lineage, err := lineageOf(root)
+		if err != nil {
+			return err
+		}
+		if lineage.Parent == nil || lineages[*lineage.Parent] != nil {
+			break
+		}
+		root = *lineage.Parent
+	}
+
+	rootLineage := lineages[root]
+	if rootLineage.ForkDepth > 0 {
+		fmt.Fprintf(out, "(forked at commit %s of a dot that's been deleted or that you can't see)\n", rootLineage.ForkCommitID)
+	}
+	return drawLineage(out, root, vol, "", "", lineageOf, map[types.VolumeName]bool{})
+}
+
+// drawLineage draws vol and its forks, below it and indented, as a tree.
+func drawLineage(
+	out io.Writer, vol, target types.VolumeName, branchPrefix, childPrefix string,
+	lineageOf func(types.VolumeName) (*types.ForkLineage, error),
+	drawn map[types.VolumeName]bool,
+) error {
+	lineage, err := lineageOf(vol)
+	if err != nil {
+		return err
+	}
+	line := branchPrefix + vol.StringWithoutAdmin()
+	if lineage.Parent != nil {
+		line += fmt.Sprintf(" (forked at %s)", lineage.ForkCommitID)
+	}
+	if vol == target {
+		line += " *"
+	}
+	fmt.Fprintln(out, line)
+
+	drawn[vol] = true
+	for i, child := range lineage.Children {
+		if drawn[child] {
+			continue
+		}
+		branch, indent := "├── ", "│   "
+		if i == len(lineage.Children)-1 {
+			branch, indent = "└── ", "    "
+		}
+		err := drawLineage(out, child, target, childPrefix+branch, childPrefix+indent, lineageOf, drawn)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/dotmesh-io/dotmesh/pkg/client"
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+var healthCheckTimeout time.Duration
+
+func NewCmdHealth(out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "health [<dot>]",
+		Short: "Check the health of the storage behind a dot",
+		Long: `Check the ZFS dataset behind a dot, and the pool it's in, on the node
+that's currently the master for the dot. Defaults to the current dot.
+
+Exits with a non-zero status if the dot isn't healthy.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			runHandlingError(func() error {
+				return health(args, out)
+			})
+		},
+	}
+	cmd.Flags().DurationVarP(
+		&healthCheckTimeout, "timeout", "t", client.DefaultHealthCheckTimeout,
+		"How long to wait for the health check to finish",
+	)
+	return cmd
+}
+
+func health(args []string, out io.Writer) error {
+	dm, err := client.NewDotmeshAPI(configPath, verboseOutput)
+	if err != nil {
+		return err
+	}
+	dm.SetHealthCheckTimeout(healthCheckTimeout)
+
+	var qualifiedDotName string
+	if len(args) == 1 {
+		qualifiedDotName = args[0]
+	} else {
+		qualifiedDotName, err = dm.StrictCurrentVolume()
+		if err != nil {
+			return err
+		}
+		if qualifiedDotName == "" {
+			return fmt.Errorf(
+				"No current dot. Try 'dm list' and " +
+					"'dm switch' to switch to a dot.",
+			)
+		}
+	}
+
+	namespace, dot, err := client.ParseNamespacedVolume(qualifiedDotName)
+	if err != nil {
+		return err
+	}
+
+	h, err := dm.CheckVolumeHealth(context.Background(), types.VolumeName{Namespace: namespace, Name: dot})
+	if err != nil {
+		return err
+	}
+
+	if scriptingMode {
+		fmt.Fprintf(out, "status\t%s\n", h.Status)
+		fmt.Fprintf(out, "poolStatus\t%s\n", h.PoolStatus)
+		fmt.Fprintf(out, "checkedAt\t%s\n", h.CheckedAt.Format(time.RFC3339))
+		for _, e := range h.Errors {
+			fmt.Fprintf(out, "error\t%s\n", e)
+		}
+	} else {
+		fmt.Fprintf(out, "Dot %s/%s is %s\n", namespace, dot, h.Status)
+		fmt.Fprintf(out, "Pool status: %s\n", h.PoolStatus)
+		fmt.Fprintf(out, "Checked at: %s\n", h.CheckedAt.Format(time.RFC1123))
+		for _, e := range h.Errors {
+			fmt.Fprintf(out, "  %s\n", e)
+		}
+	}
+
+	if h.Status != types.VolumeHealthy {
+		return fmt.Errorf("Dot %s/%s is %s", namespace, dot, h.Status)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -12,6 +13,9 @@ import (
 	"text/tabwriter"
 )
 
+var listOutputFormat string
+var listStats bool
+
 func NewCmdList(out io.Writer) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "list",
@@ -28,6 +32,19 @@ func NewCmdList(out io.Writer) *cobra.Command {
 					return fmt.Errorf("Please specify no arguments.")
 				}
 
+				if listOutputFormat != "" {
+					vcs, err := dm.AllVolumesWithContainers()
+					if err != nil {
+						return err
+					}
+					formatted, err := client.FormatVolumesWithContainers(vcs, listOutputFormat)
+					if err != nil {
+						return err
+					}
+					_, err = out.Write(formatted)
+					return err
+				}
+
 				if !scriptingMode {
 					fmt.Fprintf(
 						out,
@@ -37,6 +54,11 @@ func NewCmdList(out io.Writer) *cobra.Command {
 				}
 
 				columnNames := []string{"  DOT", "BRANCH", "SERVER", "CONTAINERS", "SIZE", "COMMITS", "DIRTY"}
+				if listStats {
+					// the stats come from a different RPC that doesn't
+					// list containers
+					columnNames = []string{"  DOT", "BRANCH", "SERVER", "SIZE", "LOGICAL", "COMPRESSED", "COMMITS", "DIRTY"}
+				}
 
 				var target io.Writer
 				if scriptingMode {
@@ -49,14 +71,33 @@ func NewCmdList(out io.Writer) *cobra.Command {
 					)
 				}
 
-				vcs, err := dm.AllVolumesWithContainers()
+				rows := []listRow{}
+				if listStats {
+					vss, err := dm.AllVolumesWithStats(context.Background())
+					if err != nil {
+						return err
+					}
+					for i := range vss {
+						rows = append(rows, listRow{volume: vss[i].DotmeshVolume, stats: &vss[i]})
+					}
+				} else {
+					vcs, err := dm.AllVolumesWithContainers()
+					if err != nil {
+						return err
+					}
+					for _, vc := range vcs {
+						rows = append(rows, listRow{volume: vc.Volume, containers: vc.Containers})
+					}
+				}
+
+				defaultBranches, err := dm.DefaultBranches(context.Background())
 				if err != nil {
 					return err
 				}
 
-				for _, vc := range vcs {
-					v := vc.Volume
-					containerInfo := vc.Containers
+				for _, row := range rows {
+					v := row.volume
+					containerInfo := row.containers
 					activeQualified, err := dm.CurrentVolume()
 					if err != nil {
 						return err
@@ -78,7 +119,7 @@ func NewCmdList(out io.Writer) *cobra.Command {
 					}
 
 					// TODO maybe show all branches
-					b, err := dm.CurrentBranch(v.Name.String())
+					b, err := dm.CurrentBranchFrom(v.Name.String(), defaultBranches)
 					if err != nil {
 						return err
 					}
@@ -87,18 +128,23 @@ func NewCmdList(out io.Writer) *cobra.Command {
 						containerNames = append(containerNames, container.Name)
 					}
 
-					var dirtyString, sizeString string
-					if scriptingMode {
-						dirtyString = fmt.Sprintf("%d", v.DirtyBytes)
-						sizeString = fmt.Sprintf("%d", v.SizeBytes)
-					} else {
-						dirtyString = prettyPrintSize(v.DirtyBytes)
-						sizeString = prettyPrintSize(v.SizeBytes)
+					size := func(bytes int64) string {
+						if scriptingMode {
+							return fmt.Sprintf("%d", bytes)
+						}
+						return prettyPrintSize(bytes)
 					}
 
 					cells := []string{
 						v.Name.StringWithoutAdmin(), b, v.Master, strings.Join(containerNames, ","),
-						sizeString, fmt.Sprintf("%d", v.CommitCount), dirtyString,
+						size(v.SizeBytes), fmt.Sprintf("%d", v.CommitCount), size(v.DirtyBytes),
+					}
+					if row.stats != nil {
+						cells = []string{
+							v.Name.StringWithoutAdmin(), b, v.Master, size(v.SizeBytes),
+							size(row.stats.LogicalBytes), size(row.stats.CompressedBytes),
+							fmt.Sprintf("%d", row.stats.CommitCount), size(v.DirtyBytes),
+						}
 					}
 					fmt.Fprintf(target, start)
 					for _, cell := range cells {
@@ -124,5 +170,21 @@ func NewCmdList(out io.Writer) *cobra.Command {
 		"scripting mode. Do not print headers, separate fields by "+
 			"a single tab instead of arbitrary whitespace.",
 	)
+	cmd.Flags().BoolVarP(
+		&listStats, "stats", "s", false,
+		"show the space each dot uses before and after compression, "+
+			"instead of its containers.",
+	)
+	cmd.Flags().StringVarP(
+		&listOutputFormat, "output", "o", "",
+		"output format, one of json, yaml or table. Overrides --scripting.",
+	)
 	return cmd
 }
+
+// listRow - a dot in dm list, with either its containers or its stats
+type listRow struct {
+	volume     types.DotmeshVolume
+	containers []client.Container
+	stats      *types.DotmeshVolumeWithStats
+}
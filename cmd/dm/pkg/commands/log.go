@@ -5,6 +5,7 @@ import (
 	"io"
 	"os"
 	"sort"
+	"strings"
 
 	"github.com/dotmesh-io/dotmesh/pkg/client"
 	"github.com/spf13/cobra"
@@ -45,6 +46,9 @@ func NewCmdLog(out io.Writer) *cobra.Command {
 					fmt.Fprintf(out, "commit %s\n", commit.Id)
 					fmt.Fprintf(out, "author: %s\n", commit.Metadata["author"])
 					fmt.Fprintf(out, "date: %s\n", commit.Metadata["timestamp"])
+					if len(commit.Tags) > 0 {
+						fmt.Fprintf(out, "tags: %s\n", strings.Join(commit.Tags, ", "))
+					}
 
 					sortedNames := []string{}
 					for name, _ := range commit.Metadata {
@@ -40,6 +40,7 @@ add'. Create a dotmesh cluster with 'dm cluster init'.`,
 				)
 			}
 		}
+		warnIfIncompatible(cmd)
 		return nil
 	},
 }
@@ -49,11 +50,15 @@ func Initialise() {
 	MainCmd.AddCommand(NewCmdCluster(os.Stdout))
 	MainCmd.AddCommand(NewCmdRemote(os.Stdout))
 	MainCmd.AddCommand(NewCmdS3(os.Stdout))
+	MainCmd.AddCommand(NewCmdSFTP(os.Stdout))
 	MainCmd.AddCommand(NewCmdList(os.Stdout))
+	MainCmd.AddCommand(NewCmdHealth(os.Stdout))
 	MainCmd.AddCommand(NewCmdInit(os.Stdout))
 	MainCmd.AddCommand(NewCmdSwitch(os.Stdout))
 	MainCmd.AddCommand(NewCmdCommit(os.Stdout))
 	MainCmd.AddCommand(NewCmdLog(os.Stdout))
+	MainCmd.AddCommand(NewCmdGraph(os.Stdout))
+	MainCmd.AddCommand(NewCmdStash(os.Stdout))
 	MainCmd.AddCommand(NewCmdBranch(os.Stdout))
 	MainCmd.AddCommand(NewCmdCheckout(os.Stdout))
 	MainCmd.AddCommand(NewCmdReset(os.Stdout))
@@ -64,6 +69,7 @@ func Initialise() {
 	MainCmd.AddCommand(NewCmdDot(os.Stdout))
 	MainCmd.AddCommand(NewCmdVersion(os.Stdout))
 	MainCmd.AddCommand(NewCmdMount(os.Stdout))
+	MainCmd.AddCommand(NewCmdWatch(os.Stdout))
 
 	MainCmd.PersistentFlags().StringVarP(
 		&configPath, "config", "c",
@@ -38,12 +38,17 @@ Online help: https://docs.dotmesh.com/references/cli/#pull-dm-pull-remote-dot-br
 				if err != nil {
 					return err
 				}
+				dm.Out = out
 				// TODO check that filesystem exists on toRemote
 
 				peer, filesystemName, branchName, err := resolveTransferArgs(args)
 				if err != nil {
 					return err
 				}
+				if estimateTransfer {
+					dm.TransferEstimateOut = out
+				}
+				dm.TransferCompression = transferCompression
 				transferId, err := dm.RequestTransfer(
 					"pull", peer,
 					filesystemName, branchName,
@@ -70,5 +75,9 @@ Online help: https://docs.dotmesh.com/references/cli/#pull-dm-pull-remote-dot-br
 	cmd.PersistentFlags().StringVarP(&pullRemoteVolume, "remote-name", "", "",
 		"Remote dot name to pull from")
 	cmd.PersistentFlags().BoolVarP(&stash, "stash-on-divergence", "", false, "stash any divergence on a branch and continue")
+	cmd.PersistentFlags().BoolVarP(&estimateTransfer, "estimate", "", false,
+		"show how many commits and bytes the transfer should move before starting it")
+	cmd.PersistentFlags().StringVarP(&transferCompression, "compression", "", "",
+		"compress the data sent over the network, with gzip or lz4, if the remote can decompress it")
 	return cmd
 }
@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -10,6 +11,9 @@ import (
 )
 
 var pushRemoteVolume string
+var pushMigrate bool
+var pushForce bool
+var pushToSnapshot string
 
 func NewCmdPush(out io.Writer) *cobra.Command {
 	cmd := &cobra.Command{
@@ -25,6 +29,19 @@ cloned from on the specified <remote>, but any remote dot can be named with
 
 If the remote dot does not exist, it will be created on-demand.
 
+With '--force', a remote branch that has diverged from <branch> (say, after a
+'dm reset' here) has its commits since the latest one they share deleted, and
+is then brought up to date, rather than the push failing. Those commits are
+listed before they're lost.
+
+With '--to-snapshot', only the commits up to and including the given one are
+pushed, e.g. to give a test environment the first few commits of a dot
+without sharing the rest of its history.
+
+With '--migrate', the dot is moved rather than copied: once every commit of
+every branch of <dot> is confirmed to be on <remote>, <dot> is deleted here.
+Push any other branches first.
+
 Example: to make a new backup and push new commits from the master branch of
 dot 'postgres' to cluster 'backups':
 
@@ -39,10 +56,39 @@ Online help: https://docs.dotmesh.com/references/cli/#push-dm-push-remote-remote
 				if err != nil {
 					return err
 				}
+				dm.Out = out
 				peer, filesystemName, branchName, err := resolveTransferArgs(args)
 				if err != nil {
 					return err
 				}
+				if pushForce {
+					if stash {
+						return fmt.Errorf("--force can't be combined with --stash-on-divergence")
+					}
+					dm.ForcePush = true
+					dm.ForcePushWarningOut = os.Stderr
+				}
+				dm.PushTargetCommit = pushToSnapshot
+				dm.TransferCompression = transferCompression
+				if pushMigrate {
+					if stash {
+						return fmt.Errorf("--migrate can't be combined with --stash-on-divergence")
+					}
+					if pushToSnapshot != "" {
+						return fmt.Errorf("--migrate can't be combined with --to-snapshot, every commit has to be pushed")
+					}
+					ctx, cancel := context.WithCancel(context.Background())
+					defer cancel()
+					err = dm.MigrateVolume(ctx, "push", peer, filesystemName, branchName, pushRemoteVolume, "")
+					if err != nil {
+						return err
+					}
+					fmt.Fprintf(out, "Migrated to %s, and deleted the local copy\n", peer)
+					return nil
+				}
+				if estimateTransfer {
+					dm.TransferEstimateOut = out
+				}
 				transferId, err := dm.RequestTransfer(
 					"push", peer, filesystemName, branchName, pushRemoteVolume, "", nil, stash,
 				)
@@ -64,5 +110,15 @@ Online help: https://docs.dotmesh.com/references/cli/#push-dm-push-remote-remote
 	cmd.PersistentFlags().StringVarP(&pushRemoteVolume, "remote-name", "", "",
 		"Remote dot name to push to, including remote namespace e.g. alice/apples")
 	cmd.PersistentFlags().BoolVarP(&stash, "stash-on-divergence", "", false, "stash any divergence on a branch and continue")
+	cmd.PersistentFlags().BoolVarP(&estimateTransfer, "estimate", "", false,
+		"show how many commits and bytes the transfer should move before starting it")
+	cmd.PersistentFlags().StringVarP(&transferCompression, "compression", "", "",
+		"compress the data sent over the network, with gzip or lz4, if the remote can decompress it")
+	cmd.PersistentFlags().BoolVarP(&pushForce, "force", "", false,
+		"if the remote branch has diverged, delete its commits since the latest common one and push anyway")
+	cmd.PersistentFlags().StringVarP(&pushToSnapshot, "to-snapshot", "", "",
+		"push commits only up to this one (an id, tag or HEAD^-style reference), rather than the latest")
+	cmd.PersistentFlags().BoolVarP(&pushMigrate, "migrate", "", false,
+		"move the dot to the remote, deleting it here once the push is verified")
 	return cmd
 }
@@ -30,6 +30,7 @@ func NewCmdRemote(out io.Writer) *cobra.Command {
 				}
 				remotes := dm.Configuration.GetRemotes()
 				s3Remotes := dm.Configuration.GetS3Remotes()
+				sftpRemotes := dm.Configuration.GetSFTPRemotes()
 				keys := []string{}
 				// sort the keys so we can iterate over in human friendly order
 				for k, _ := range remotes {
@@ -38,6 +39,9 @@ func NewCmdRemote(out io.Writer) *cobra.Command {
 				for k, _ := range s3Remotes {
 					keys = append(keys, k)
 				}
+				for k, _ := range sftpRemotes {
+					keys = append(keys, k)
+				}
 				sort.Strings(keys)
 				if verbose {
 					currentRemote := dm.Configuration.GetCurrentRemote()
@@ -49,11 +53,17 @@ func NewCmdRemote(out io.Writer) *cobra.Command {
 							current = "  "
 						}
 						remote, ok := remotes[k]
+						sftpRemote, sftpOk := sftpRemotes[k]
 						if ok {
 							fmt.Fprintf(
 								out, "%s%s\t%s@%s\n",
 								current, k, remote.User, remote.Hostname,
 							)
+						} else if sftpOk {
+							fmt.Fprintf(
+								out, "%s\tsftp://%s@%s%s\n",
+								k, sftpRemote.Username, sftpRemote.Hostname, sftpRemote.RemotePath,
+							)
 						} else {
 							fmt.Fprintf(
 								out, "%s\t%s\n",
@@ -70,10 +80,17 @@ func NewCmdRemote(out io.Writer) *cobra.Command {
 			})
 		},
 	}
-	cmd.AddCommand(&cobra.Command{
+	var insecureTLS bool
+	addCmd := &cobra.Command{
 		Use:   "add <remote-name> <user@cluster-hostname>[:<port-number>]",
 		Short: "Add a remote",
-		Long:  "Online help: https://docs.dotmesh.com/references/cli/#add-a-new-remote-dm-remote-add-name-user-hostname",
+		Long: `Adds a dotmesh cluster as a remote, asking for the API key to use with it
+(or taking it from $DOTMESH_PASSWORD).
+
+With --insecure-tls, the cluster's TLS certificate isn't verified, for
+clusters with self-signed certificates. Only use it on networks you trust.
+
+Online help: https://docs.dotmesh.com/references/cli/#add-a-new-remote-dm-remote-add-name-user-hostname`,
 
 		Run: func(cmd *cobra.Command, args []string) {
 			runHandlingError(func() error {
@@ -124,10 +141,11 @@ func NewCmdRemote(out io.Writer) *cobra.Command {
 					apiKey = string(enteredApiKey)
 				}
 				client := &client.JsonRpcClient{
-					User:     user,
-					Hostname: hostname,
-					Port:     port,
-					ApiKey:   apiKey,
+					User:        user,
+					Hostname:    hostname,
+					Port:        port,
+					ApiKey:      apiKey,
+					InsecureTLS: insecureTLS,
 				}
 				_, err = client.Ping()
 
@@ -139,6 +157,12 @@ func NewCmdRemote(out io.Writer) *cobra.Command {
 				if err != nil {
 					return err
 				}
+				if insecureTLS {
+					err = dm.Configuration.SetInsecureTLSForRemote(remote, true)
+					if err != nil {
+						return err
+					}
+				}
 				fmt.Fprintln(out, "Remote added.")
 				currentRemote := dm.Configuration.GetCurrentRemote()
 				if currentRemote == "" {
@@ -151,7 +175,9 @@ func NewCmdRemote(out io.Writer) *cobra.Command {
 				return nil
 			})
 		},
-	})
+	}
+	addCmd.Flags().BoolVar(&insecureTLS, "insecure-tls", false, "don't verify the cluster's TLS certificate")
+	cmd.AddCommand(addCmd)
 	cmd.AddCommand(&cobra.Command{
 		Use:   "rm <remote>",
 		Short: "Remove a remote",
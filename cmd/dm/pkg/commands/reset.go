@@ -1,6 +1,8 @@
 package commands
 
 import (
+	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -9,9 +11,11 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var resetDryRun bool
+
 func NewCmdReset(out io.Writer) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "reset [--hard] <ref>",
+		Use:   "reset [--hard] [--dry-run] [-f] <ref>",
 		Short: "Reset current HEAD to the specified state",
 		Long:  "Online help: https://docs.dotmesh.com/references/cli/#roll-back-commits-dm-reset-hard-commit",
 		Run: func(cmd *cobra.Command, args []string) {
@@ -24,6 +28,32 @@ func NewCmdReset(out io.Writer) *cobra.Command {
 					return fmt.Errorf("Please specify one ref only.")
 				}
 				commit := args[0]
+
+				lost, err := dm.DryRunRollback(context.Background(), commit)
+				if err != nil {
+					return err
+				}
+				if len(lost) > 0 {
+					fmt.Fprintf(out, "Resetting to %s will destroy these commits:\n", commit)
+					for _, c := range lost {
+						fmt.Fprintf(out, "  %s %s\n", c.Id, c.Metadata["message"])
+					}
+				} else if resetDryRun {
+					fmt.Fprintf(out, "Resetting to %s won't destroy any commits.\n", commit)
+				}
+				if resetDryRun {
+					return nil
+				}
+				if len(lost) > 0 && !forceMode {
+					fmt.Fprintf(out, "Please confirm that you really want to destroy them (enter Y to continue): ")
+					reader := bufio.NewReader(os.Stdin)
+					text, _ := reader.ReadString('\n')
+					if text != "Y\n" {
+						fmt.Fprintf(out, "Aborted.\n")
+						return nil
+					}
+				}
+
 				if err := dm.ResetCurrentVolume(commit); err != nil {
 					return err
 				}
@@ -40,5 +70,13 @@ func NewCmdReset(out io.Writer) *cobra.Command {
 		"Any changes to tracked files in the current "+
 			"dot since <ref> are discarded.",
 	)
+	cmd.Flags().BoolVarP(
+		&resetDryRun, "dry-run", "", false,
+		"List the commits that would be destroyed, without resetting.",
+	)
+	cmd.Flags().BoolVarP(
+		&forceMode, "force", "f", false,
+		"perform dangerous operations without requiring confirmation.",
+	)
 	return cmd
 }
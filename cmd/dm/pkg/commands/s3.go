@@ -84,6 +84,7 @@ func NewCmdS3(out io.Writer) *cobra.Command {
 				if err != nil {
 					return err
 				}
+				dm.Out = out
 				peer, filesystemName, branchName, err := resolveTransferArgs(args[:len(args)-1])
 				if err != nil {
 					return err
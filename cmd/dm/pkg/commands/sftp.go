@@ -0,0 +1,57 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/dotmesh-io/dotmesh/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+var sftpIdentityFile string
+var sftpHostKey string
+
+func NewCmdSFTP(out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sftp",
+		Short: "Commands that handle SFTP connections",
+	}
+	subCommand := &cobra.Command{
+		Use:   "remote add <remote-name> sftp://<user>@<host>[:<port>]/<path> --identity-file=<private-key> --host-key=<public-key>",
+		Short: "Add an SFTP remote",
+		Long: "Add an SFTP remote. Transfers only go ahead if the server presents the host key given, " +
+			"which is the key part of a line of 'ssh-keyscan <host>' output, e.g. 'ssh-ed25519 AAAA...'.",
+
+		Run: func(cmd *cobra.Command, args []string) {
+			runHandlingError(func() error {
+				if len(args) != 3 {
+					return fmt.Errorf(
+						"Please specify <remote-name> sftp://<user>@<host>[:<port>]/<path>",
+					)
+				}
+				if sftpIdentityFile == "" {
+					return fmt.Errorf("Please specify the private key to log in with using --identity-file")
+				}
+				if sftpHostKey == "" {
+					return fmt.Errorf("Please specify the server's public key using --host-key")
+				}
+				dm, err := client.NewDotmeshAPI(configPath, verboseOutput)
+				if err != nil {
+					return err
+				}
+				err = dm.Configuration.ParseSFTPRemoteURL(args[1], args[2], sftpIdentityFile, sftpHostKey)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(out, "sftp remote added.")
+				return nil
+			})
+		},
+	}
+	subCommand.PersistentFlags().StringVarP(&sftpIdentityFile, "identity-file", "i", "",
+		"Private key to authenticate to the SFTP server with")
+	subCommand.PersistentFlags().StringVar(&sftpHostKey, "host-key", "",
+		"Public key the SFTP server must present, in authorized_keys format")
+	cmd.AddCommand(subCommand)
+	return cmd
+}
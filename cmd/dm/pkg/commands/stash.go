@@ -0,0 +1,78 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dotmesh-io/dotmesh/pkg/client"
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+func NewCmdStash(out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "stash",
+		Short: "Manage the branches diverged commits are stashed on",
+		Long: `When 'dm pull' or 'dm push' is given --stash-on-divergence and finds that
+the branch it's updating has commits the other end doesn't, it moves them to a
+new branch called stash-<time>, and then brings the original branch up to
+date. Those branches can be checked out like any other.`,
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list [<dot>]",
+		Short: "List a dot's stash branches (the current dot, if none is given)",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := listStashes(args, out)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+		},
+	})
+	return cmd
+}
+
+func listStashes(args []string, out io.Writer) error {
+	dm, err := client.NewDotmeshAPI(configPath, verboseOutput)
+	if err != nil {
+		return err
+	}
+
+	var dot string
+	switch len(args) {
+	case 0:
+		dot, err = dm.StrictCurrentVolume()
+		if err != nil {
+			return err
+		}
+	case 1:
+		dot = args[0]
+	default:
+		return fmt.Errorf("Please specify at most one dot.")
+	}
+	namespace, name, err := client.ParseNamespacedVolume(dot)
+	if err != nil {
+		return err
+	}
+
+	stashes, err := dm.ListStashes(context.Background(), types.VolumeName{Namespace: namespace, Name: name})
+	if err != nil {
+		return err
+	}
+	if len(stashes) == 0 {
+		fmt.Fprintf(out, "%s has no stashed commits.\n", dot)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 3, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "BRANCH\tFROM\tSTASHED\tCOMMITS")
+	for _, stash := range stashes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\n",
+			stash.BranchName, stash.OriginalBranch, stash.StashedAt.Local().Format(time.RFC1123), stash.CommitCount)
+	}
+	return w.Flush()
+}
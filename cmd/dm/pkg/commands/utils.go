@@ -11,17 +11,7 @@ import (
 
 // pretty-print MiB or KiB or GiB
 func prettyPrintSize(size int64) string {
-	s := "-"
-	if size > 0 {
-		if size < 1024*1024 {
-			s = fmt.Sprintf("%.2f kiB", float64(size)/1024)
-		} else if size < 1024*1024*1024 {
-			s = fmt.Sprintf("%.2f MiB", float64(size)/(1024*1024))
-		} else {
-			s = fmt.Sprintf("%.2f GiB", float64(size)/(1024*1024*1024))
-		}
-	}
-	return s
+	return client.PrettyPrintSize(size)
 }
 
 func resolveTransferArgs(args []string) (returnPeer string, returnFilesystemName string, returnBranchName string, returnError error) {
@@ -1,11 +1,13 @@
 package commands
 
 import (
+	"context"
 	"fmt"
 	"github.com/dotmesh-io/dotmesh/pkg/client"
 	"github.com/spf13/cobra"
 	"io"
 	"os"
+	"time"
 )
 
 var clientVersion string
@@ -14,6 +16,45 @@ var dockerTag string
 func SetVersion(v, t string) {
 	clientVersion = v
 	dockerTag = t
+	client.ClientVersion = v
+}
+
+// Commands that don't talk to a dotmesh server, or that may set one up or
+// replace one, don't check it's compatible first
+var noCompatibilityCheck = map[string]bool{
+	"cluster": true,
+	"remote":  true,
+	"version": true,
+	"help":    true,
+}
+
+const compatibilityCheckTimeout = 2 * time.Second
+
+// warnIfIncompatible prints a warning to stderr if the current remote's
+// server version may not work with this client. The server is asked at most
+// once a day per remote, the answer being cached in the config. It never
+// fails the command, so that scripts carry on working across upgrades: if
+// the server can't be asked, or the user isn't allowed to ask, it stays
+// quiet.
+func warnIfIncompatible(cmd *cobra.Command) {
+	for c := cmd; c.HasParent(); c = c.Parent() {
+		if noCompatibilityCheck[c.Name()] {
+			return
+		}
+	}
+	dm, err := client.NewDotmeshAPI(configPath, verboseOutput)
+	if err != nil || dm.Configuration.CurrentRemote == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), compatibilityCheckTimeout)
+	defer cancel()
+	result, err := dm.CachedCompatibility(ctx)
+	if err != nil {
+		return
+	}
+	if !result.Compatible {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", result.Warning)
+	}
 }
 
 func NewCmdVersion(out io.Writer) *cobra.Command {
@@ -0,0 +1,93 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/dotmesh-io/dotmesh/pkg/client"
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+var watchVolumes bool
+var watchInterval time.Duration
+
+func NewCmdWatch(out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Watch what happens to the dots on the current remote",
+		Long: `Print what happens to the dots on the current remote as it happens,
+one line per event: dots created and deleted, commits added, and transfers
+started, finished and failed. Runs until interrupted.
+
+With --volumes, print the list of dots instead, and again every time a dot's
+been created or deleted or committed to.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			runHandlingError(func() error {
+				if len(args) > 0 {
+					return fmt.Errorf("Please specify no arguments.")
+				}
+				dm, err := client.NewDotmeshAPI(configPath, verboseOutput)
+				if err != nil {
+					return err
+				}
+				if watchVolumes {
+					return watchAllVolumes(dm, out)
+				}
+				return watchClusterEvents(dm, out)
+			})
+		},
+	}
+	cmd.Flags().BoolVar(
+		&watchVolumes, "volumes", false,
+		"Watch the list of dots, rather than the cluster's events",
+	)
+	cmd.Flags().DurationVar(
+		&watchInterval, "interval", 5*time.Second,
+		"How often to look at the list of dots, with --volumes",
+	)
+	return cmd
+}
+
+func watchClusterEvents(dm *client.DotmeshAPI, out io.Writer) error {
+	events, errs := dm.WatchClusterEvents(context.Background())
+	for event := range events {
+		fmt.Fprintln(out, formatClusterEvent(event))
+	}
+	return <-errs
+}
+
+func formatClusterEvent(event types.ClusterEvent) string {
+	dot := event.Volume.StringWithoutAdmin()
+	if event.Branch != "" {
+		dot = fmt.Sprintf("%s@%s", dot, event.Branch)
+	}
+	line := fmt.Sprintf("%s %s %s", event.Time.Local().Format(time.RFC3339), event.Type, dot)
+	switch {
+	case event.CommitID != "":
+		line += " " + event.CommitID
+	case event.TransferID != "":
+		line += " " + event.TransferID
+	}
+	if event.Message != "" {
+		line += ": " + event.Message
+	}
+	return line
+}
+
+func watchAllVolumes(dm *client.DotmeshAPI, out io.Writer) error {
+	lists, errs := dm.WatchAllVolumes(context.Background(), watchInterval)
+	for volumes := range lists {
+		fmt.Fprintf(out, "%s:\n", time.Now().Format(time.RFC3339))
+		for _, volume := range volumes {
+			dot := volume.Name.StringWithoutAdmin()
+			if volume.Branch != "" {
+				dot = fmt.Sprintf("%s@%s", dot, volume.Branch)
+			}
+			fmt.Fprintf(out, "  %s (%d commits)\n", dot, volume.CommitCount)
+		}
+	}
+	return <-errs
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dotmesh-io/dotmesh/pkg/auth"
+	"github.com/dotmesh-io/dotmesh/pkg/registry"
+	"github.com/dotmesh-io/dotmesh/pkg/store"
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+	"github.com/dotmesh-io/dotmesh/pkg/user"
+)
+
+func TestReadOnlyShareRefusesWrites(t *testing.T) {
+	client, err := store.NewKVDBClient(&store.KVDBConfig{
+		Type: store.KVTypeMem,
+	})
+	if err != nil {
+		t.Fatalf("failed to init kv store: %s", err)
+	}
+	um := user.NewInternal(store.NewKVDBStoreWithIndex(client, "users"))
+	owner, err := um.New("alice", "alice@example.com", "verysecret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := um.New("bob", "bob@example.com", "verysecret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv := store.NewKVDBFilesystemStore(client)
+	reg := registry.NewRegistry(um, kv)
+	err = reg.UpdateFilesystemFromEtcd(types.VolumeName{Namespace: "alice", Name: "vol"}, types.RegistryFilesystem{
+		Id:      "master",
+		OwnerId: owner.Id,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = kv.SetACL(&types.FilesystemACL{
+		FilesystemID: "master",
+		Entries:      []types.ACLEntry{{User: reader.Name, Permission: string(types.PermRead)}},
+	}, &store.SetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := &InMemoryState{
+		opts:            Opts{UserManager: um},
+		registry:        reg,
+		userManager:     um,
+		filesystemStore: kv,
+		registryStore:   kv,
+	}
+	d := NewDotmeshRPC(state, um)
+	asReader := func() *http.Request {
+		return auth.SetAuthenticationDetails(httptest.NewRequest("POST", "/rpc", nil), reader, user.AuthenticationTypePassword)
+	}
+
+	err = d.ensureVolumeAccess(asReader(), "master", types.PermRead)
+	if err != nil {
+		t.Errorf("expected the share to let bob read the volume, got %s", err)
+	}
+
+	var newBranch string
+	err = d.StashAfter(asReader(), &types.StashRequest{FilesystemId: "master", SnapshotId: "snap"}, &newBranch)
+	if err == nil || !strings.Contains(err.Error(), "do not have write access") {
+		t.Errorf("expected StashAfter to be refused on a read only share, got %v", err)
+	}
+
+	var registered bool
+	err = d.RegisterTransfer(asReader(), &TransferPollResult{
+		TransferRequestId: "transfer",
+		Direction:         "push",
+		FilesystemId:      "master",
+		RemoteNamespace:   "alice",
+		RemoteName:        "vol",
+	}, &registered)
+	if err == nil || !strings.Contains(err.Error(), "do not have write access") {
+		t.Errorf("expected pushing to a read only share to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/dotmesh-io/dotmesh/pkg/archiver"
+	dmclient "github.com/dotmesh-io/dotmesh/pkg/client"
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+	"github.com/dotmesh-io/dotmesh/pkg/user"
+	"github.com/dotmesh-io/dotmesh/pkg/uuid"
+	"github.com/dotmesh-io/dotmesh/pkg/validator"
+
+	"github.com/gorilla/mux"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ExportHandler streams a commit of a branch, and all the commits before it,
+// as a volume archive (see archiver.WriteVolumeArchive), for moving volumes
+// to clusters that can't be reached with dm push.
+type ExportHandler struct {
+	state *InMemoryState
+}
+
+func NewExportHandler(state *InMemoryState) http.Handler {
+	return &ExportHandler{
+		state: state,
+	}
+}
+
+// ImportHandler creates a new volume from a volume archive written by
+// ExportHandler, and responds with its filesystem id.
+type ImportHandler struct {
+	state *InMemoryState
+}
+
+func NewImportHandler(state *InMemoryState) http.Handler {
+	return &ImportHandler{
+		state: state,
+	}
+}
+
+func compressArchive(req *http.Request) bool {
+	return req.URL.Query().Get("compress") == "true"
+}
+
+func (s *ExportHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	if !validator.EnsureValidOrRespond(vars["namespace"], validator.IsValidVolumeNamespace, resp) {
+		return
+	}
+	if !validator.EnsureValidOrRespond(vars["name"], validator.IsValidVolumeName, resp) {
+		return
+	}
+	branch := vars["branch"]
+	if branch == "master" {
+		branch = ""
+	}
+	if branch != "" && !validator.EnsureValidOrRespond(branch, validator.IsValidBranchName, resp) {
+		return
+	}
+	commitID := vars["commitID"]
+	if !validator.EnsureValidOrRespond(commitID, validator.IsValidSnapshotName, resp) {
+		return
+	}
+
+	volName := VolumeName{
+		Name:      vars["name"],
+		Namespace: vars["namespace"],
+	}
+
+	tlf, err := s.state.registry.LookupFilesystem(volName)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusNotFound)
+		return
+	}
+	authorized, err := s.state.authorizeVolumeAccess(req.Context(), &tlf, types.PermRead)
+	if err != nil {
+		log.Warnf("[ExportHandler.ServeHTTP] authorization failed: %s", err)
+		http.Error(resp, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !authorized {
+		http.Error(resp, fmt.Sprintf("You do not have read access to volume %s", volName), http.StatusUnauthorized)
+		return
+	}
+
+	filesystemID, err := s.state.registry.MaybeCloneFilesystemId(volName, branch)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusNotFound)
+		return
+	}
+	masterNodeID, err := s.state.registry.CurrentMasterNode(filesystemID)
+	if err != nil {
+		http.Error(resp, fmt.Sprintf("master node for filesystem %s not found", filesystemID), http.StatusInternalServerError)
+		return
+	}
+	if masterNodeID != s.state.NodeID() {
+		// zfs send has to happen where the data is
+		s.state.proxyToNode(resp, req, masterNodeID)
+		return
+	}
+
+	snaps, err := s.state.SnapshotsFor(masterNodeID, filesystemID)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	found := false
+	for _, snap := range snaps {
+		if snap.Id == commitID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		http.Error(resp, fmt.Sprintf("Commit %s not found on %s", commitID, volName), http.StatusNotFound)
+		return
+	}
+
+	manifest := archiver.VolumeManifest{
+		Namespace:    volName.Namespace,
+		Name:         volName.Name,
+		Branch:       vars["branch"],
+		FilesystemId: filesystemID,
+		CommitId:     commitID,
+		ExportedAt:   time.Now(),
+	}
+	filename := fmt.Sprintf("%s-%s-%s.tar", volName.Namespace, volName.Name, commitID)
+
+	var out io.Writer = resp
+	if compressArchive(req) {
+		resp.Header().Set("Content-Type", "application/gzip")
+		filename += ".gz"
+		gz := gzip.NewWriter(resp)
+		defer gz.Close()
+		out = gz
+	} else {
+		resp.Header().Set("Content-Type", "application/x-tar")
+	}
+	resp.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	log.WithFields(log.Fields{
+		"filesystem_id": filesystemID,
+		"commit_id":     commitID,
+	}).Info("[ExportHandler] exporting volume")
+
+	// a full replication stream, which brings the commits before commitID
+	// with it
+	pipeReader, sendErrs := s.state.zfs.Send("", "", filesystemID, commitID, nil)
+	stream := &sendStream{PipeReader: pipeReader, errs: sendErrs}
+	err = archiver.WriteVolumeArchive(out, manifest, stream)
+	stream.close()
+	if err != nil {
+		// too late for an error response, the archive is left incomplete
+		log.WithFields(log.Fields{
+			"filesystem_id": filesystemID,
+			"commit_id":     commitID,
+			"error":         err,
+		}).Error("[ExportHandler] export failed, check zfs-send-errors.log")
+	}
+}
+
+// sendStream is the output of zfs send, where zfs send failing is an error
+// reading it rather than the stream just stopping (which would make an
+// archive that looks complete).
+type sendStream struct {
+	*io.PipeReader
+	errs chan error
+	done bool
+}
+
+func (s *sendStream) Read(p []byte) (int, error) {
+	n, err := s.PipeReader.Read(p)
+	if err == io.EOF && !s.done {
+		s.done = true
+		if sendErr := <-s.errs; sendErr != nil {
+			return n, fmt.Errorf("zfs send failed: %s", sendErr)
+		}
+	}
+	return n, err
+}
+
+// close stops zfs send if the stream wasn't read to the end.
+func (s *sendStream) close() {
+	s.PipeReader.CloseWithError(fmt.Errorf("export stopped"))
+	if !s.done {
+		s.done = true
+		<-s.errs
+	}
+}
+
+func (s *ImportHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	if !validator.EnsureValidOrRespond(vars["namespace"], validator.IsValidVolumeNamespace, resp) {
+		return
+	}
+	if !validator.EnsureValidOrRespond(vars["name"], validator.IsValidVolumeName, resp) {
+		return
+	}
+	if vars["branch"] != "master" {
+		// a branch is a ZFS clone of a commit on master, which an archive
+		// can't recreate
+		http.Error(resp, "Volumes can only be imported as the master branch of a new volume", http.StatusBadRequest)
+		return
+	}
+
+	volName := VolumeName{
+		Name:      vars["name"],
+		Namespace: vars["namespace"],
+	}
+
+	isAdmin, err := AuthenticatedUserIsNamespaceAdministrator(req.Context(), volName.Namespace, s.state.userManager)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !isAdmin {
+		http.Error(resp, fmt.Sprintf("User is not an administrator for namespace %s, so cannot create volumes", volName.Namespace), http.StatusUnauthorized)
+		return
+	}
+	if s.state.registry.Exists(volName, "") != "" {
+		http.Error(resp, fmt.Sprintf("Volume %s already exists", volName), http.StatusConflict)
+		return
+	}
+
+	var body io.Reader = req.Body
+	if compressArchive(req) {
+		gz, err := gzip.NewReader(req.Body)
+		if err != nil {
+			http.Error(resp, fmt.Sprintf("Error decompressing volume archive: %s", err), http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+	manifest, stream, err := archiver.ReadVolumeArchive(body)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filesystemID := uuid.New().String()
+	logger := log.WithFields(log.Fields{
+		"filesystem_id":        filesystemID,
+		"source_filesystem_id": manifest.FilesystemId,
+		"commit_id":            manifest.CommitId,
+	})
+	logger.Info("[ImportHandler] importing volume")
+
+	pipeReader, pipeWriter := io.Pipe()
+	copied := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(pipeWriter, stream)
+		// an error here makes zfs recv fail rather than see a short stream
+		pipeWriter.CloseWithError(err)
+		copied <- err
+	}()
+	errBuffer := bytes.Buffer{}
+	err = s.state.zfs.Recv(pipeReader, filesystemID, &errBuffer)
+	pipeReader.Close()
+	copyErr := <-copied
+	if err == nil && copyErr != nil {
+		err = copyErr
+	}
+	if err != nil {
+		logger.WithError(err).Errorf("[ImportHandler] zfs recv failed: %s", errBuffer.String())
+		if deleteErr := s.state.zfs.DeleteFilesystemInZFS(filesystemID); deleteErr != nil {
+			logger.WithError(deleteErr).Warn("[ImportHandler] couldn't clean up after failed import")
+		}
+		http.Error(resp, fmt.Sprintf("Unable to import %s: %s %s", volName, err, errBuffer.String()), http.StatusBadRequest)
+		return
+	}
+
+	err = NewDotmeshRPC(s.state, s.state.userManager).registerFilesystemBecomeMaster(
+		req.Context(),
+		volName.Namespace,
+		volName.Name,
+		"",
+		filesystemID,
+		PathToTopLevelFilesystem{
+			TopLevelFilesystemId:   filesystemID,
+			TopLevelFilesystemName: volName,
+			Clones:                 ClonesList{},
+		},
+	)
+	if err != nil {
+		logger.WithError(err).Error("[ImportHandler] failed to register imported volume")
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(resp).Encode(filesystemID)
+}
+
+// proxyToNode replays req on another node of the cluster, as the admin user,
+// for requests that have to be served by a filesystem's master. The caller
+// has already checked the user may make it.
+func (s *InMemoryState) proxyToNode(resp http.ResponseWriter, req *http.Request, nodeID string) {
+	admin, err := s.userManager.Get(&user.Query{Ref: "admin"})
+	if err != nil {
+		http.Error(resp, fmt.Sprintf("Can't establish API key to proxy request: %s", err), http.StatusInternalServerError)
+		return
+	}
+	baseURL, err := dmclient.DeduceUrl(req.Context(), s.AddressesForServer(nodeID), "internal", "admin", admin.ApiKey)
+	if err != nil {
+		http.Error(resp, fmt.Sprintf("Can't establish URL to proxy request: %s", err), http.StatusInternalServerError)
+		return
+	}
+	proxyReq, err := http.NewRequest(req.Method, baseURL+req.URL.RequestURI(), req.Body)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	proxyReq = proxyReq.WithContext(req.Context())
+	proxyReq.SetBasicAuth("admin", admin.ApiKey)
+
+	log.Infof("[proxyToNode] proxying %s %s to %s", req.Method, req.URL.Path, nodeID)
+	proxyResp, err := http.DefaultClient.Do(proxyReq)
+	if err != nil {
+		http.Error(resp, fmt.Sprintf("Can't proxy request to %s: %s", baseURL, err), http.StatusBadGateway)
+		return
+	}
+	defer proxyResp.Body.Close()
+	for _, header := range []string{"Content-Type", "Content-Disposition"} {
+		if v := proxyResp.Header.Get(header); v != "" {
+			resp.Header().Set(header, v)
+		}
+	}
+	resp.WriteHeader(proxyResp.StatusCode)
+	_, err = io.Copy(resp, proxyResp.Body)
+	if err != nil {
+		log.WithError(err).Warnf("[proxyToNode] error copying response from %s", nodeID)
+	}
+}
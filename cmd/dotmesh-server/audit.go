@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/dotmesh-io/dotmesh/pkg/auth"
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// auditedRPCMethods are the RPCs that change something, and so are written to
+// the audit log. Reads aren't, they'd quickly push everything else out of it.
+var auditedRPCMethods = map[string]bool{
+	"DotmeshRPC.Procure":                 true,
+	"DotmeshRPC.ResetApiKey":             true,
+	"DotmeshRPC.RotateAPIKey":            true,
+	"DotmeshRPC.RotateAPIKeyForUser":     true,
+	"DotmeshRPC.UpdatePassword":          true,
+	"DotmeshRPC.RegisterNewUser":         true,
+	"DotmeshRPC.UpdateUserPassword":      true,
+	"DotmeshRPC.SetUserMetadataField":    true,
+	"DotmeshRPC.SetUserEmail":            true,
+	"DotmeshRPC.DeleteUserMetadataField": true,
+	"DotmeshRPC.Create":                  true,
+	"DotmeshRPC.SwitchContainers":        true,
+	"DotmeshRPC.StashAfter":              true,
+	"DotmeshRPC.Commit":                  true,
+	"DotmeshRPC.MountCommit":             true,
+	"DotmeshRPC.Rollback":                true,
+	"DotmeshRPC.TagCommit":               true,
+	"DotmeshRPC.UntagCommit":             true,
+	"DotmeshRPC.Branch":                  true,
+	"DotmeshRPC.SetDefaultBranch":        true,
+	"DotmeshRPC.RenameBranch":            true,
+	"DotmeshRPC.RegisterFilesystem":      true,
+	"DotmeshRPC.S3Transfer":              true,
+	"DotmeshRPC.SFTPTransfer":            true,
+	"DotmeshRPC.RegisterTransfer":        true,
+	"DotmeshRPC.Transfer":                true,
+	"DotmeshRPC.CancelTransfer":          true,
+	"DotmeshRPC.PauseTransfer":           true,
+	"DotmeshRPC.ResumeTransfer":          true,
+	"DotmeshRPC.Fork":                    true,
+	"DotmeshRPC.Clone":                   true,
+	"DotmeshRPC.CrossNamespaceCopy":      true,
+	"DotmeshRPC.AddCollaborator":         true,
+	"DotmeshRPC.RemoveCollaborator":      true,
+	"DotmeshRPC.Delete":                  true,
+	"DotmeshRPC.SoftDelete":              true,
+	"DotmeshRPC.Restore":                 true,
+	"DotmeshRPC.ShareVolume":             true,
+	"DotmeshRPC.RevokeVolumeShare":       true,
+	"DotmeshRPC.CreateNamespace":         true,
+	"DotmeshRPC.DeleteNamespace":         true,
+	"DotmeshRPC.SetNamespaceQuota":       true,
+	"DotmeshRPC.SetVolumeQuota":          true,
+	"DotmeshRPC.SetSnapshotSchedule":     true,
+	"DotmeshRPC.DeleteSnapshotSchedule":  true,
+	"DotmeshRPC.SetDebugFlag":            true,
+	"DotmeshRPC.ForceBranchMasterById":   true,
+	"DotmeshRPC.RestoreEtcd":             true,
+}
+
+const ctxKeyAuditOutcome ctxKey = "auditOutcome"
+
+// auditOutcome is filled in by rpcAfterFunc, once the RPC method has run.
+type auditOutcome struct {
+	called bool
+	err    error
+}
+
+func ctxGetAuditOutcome(ctx context.Context) (*auditOutcome, bool) {
+	outcome, ok := ctx.Value(ctxKeyAuditOutcome).(*auditOutcome)
+	return outcome, ok
+}
+
+// AuditHandler wraps the RPC server and writes an AuditEvent for each call to
+// one of auditedRPCMethods. It has to see the request body before the RPC
+// server consumes it, to find out which volume the call is about.
+type AuditHandler struct {
+	subHandler http.Handler
+	state      *InMemoryState
+}
+
+func NewAuditHandler(handler http.Handler, state *InMemoryState) http.Handler {
+	return &AuditHandler{
+		subHandler: handler,
+		state:      state,
+	}
+}
+
+func (a *AuditHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if a.state.auditStore == nil || r.Body == nil {
+		a.subHandler.ServeHTTP(w, r)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	var rpcRequest struct {
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if json.Unmarshal(body, &rpcRequest) != nil || !auditedRPCMethods[rpcRequest.Method] {
+		a.subHandler.ServeHTTP(w, r)
+		return
+	}
+
+	outcome := &auditOutcome{}
+	a.subHandler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKeyAuditOutcome, outcome)))
+
+	event := types.AuditEvent{
+		Timestamp:  time.Now().UTC(),
+		Operation:  rpcRequest.Method,
+		RemoteAddr: r.RemoteAddr,
+		Success:    outcome.called && outcome.err == nil,
+		Details:    map[string]string{},
+	}
+	if u := auth.GetUser(r); u != nil {
+		event.User = u.Name
+	}
+	if len(rpcRequest.Params) > 0 {
+		auditTarget(&event, rpcRequest.Params[0])
+	}
+	if outcome.err != nil {
+		event.Details["error"] = outcome.err.Error()
+	} else if !outcome.called {
+		event.Details["error"] = "invalid request"
+	}
+
+	// don't hold up the response on etcd
+	go func() {
+		err := a.state.auditStore.AppendAuditEvent(&event)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":     err,
+				"operation": event.Operation,
+				"user":      event.User,
+			}).Error("[AuditHandler] failed to write audit event")
+		}
+	}()
+}
+
+// auditTarget fills in the volume an RPC is about, and its branch, from the
+// RPC's arguments. Only these fields are picked out, so passwords and keys in
+// the arguments never end up in the log.
+func auditTarget(event *types.AuditEvent, params json.RawMessage) {
+	var namespace string
+	if json.Unmarshal(params, &namespace) == nil {
+		// e.g. CreateNamespace takes just the namespace
+		if strings.Contains(event.Operation, "Namespace") {
+			event.Namespace = namespace
+		}
+		return
+	}
+
+	var args map[string]json.RawMessage
+	if json.Unmarshal(params, &args) != nil {
+		return
+	}
+	str := func(key string) string {
+		var s string
+		if raw, ok := args[key]; ok {
+			json.Unmarshal(raw, &s)
+		}
+		return s
+	}
+
+	event.Namespace = str("Namespace")
+	event.VolumeName = str("Name")
+	if event.VolumeName == "" {
+		// e.g. ShareVolumeRequest, whose Name is a VolumeName
+		var name types.VolumeName
+		if raw, ok := args["Name"]; ok && json.Unmarshal(raw, &name) == nil {
+			event.Namespace = name.Namespace
+			event.VolumeName = name.Name
+		}
+	}
+	if event.VolumeName == "" && str("LocalName") != "" {
+		// transfers
+		event.Namespace = str("LocalNamespace")
+		event.VolumeName = str("LocalName")
+	}
+
+	for _, key := range []string{"Branch", "BranchName", "LocalBranchName"} {
+		if branch := str(key); branch != "" {
+			event.Details["branch"] = branch
+			break
+		}
+	}
+}
@@ -1,9 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/dotmesh-io/dotmesh/pkg/auth"
+	"github.com/dotmesh-io/dotmesh/pkg/crypto"
+	"github.com/dotmesh-io/dotmesh/pkg/oidc"
 	"github.com/dotmesh-io/dotmesh/pkg/user"
 
 	log "github.com/sirupsen/logrus"
@@ -17,14 +27,50 @@ func NewAuthHandler(handler http.Handler, um user.UserManager) http.Handler {
 	}
 }
 
+// NewRPCAuthHandler - like NewAuthHandler, for JSON-RPC requests. It also
+// accepts ID tokens checked by verifier, as "Authorization: Bearer <token>",
+// verifier may be nil. If requireSignature is set, requests authenticated
+// with a username and API key are rejected unless they're signed; ID tokens
+// are signed by their issuer already.
+func NewRPCAuthHandler(handler http.Handler, um user.UserManager, verifier *oidc.Verifier, requireSignature bool) http.Handler {
+	return &AuthHandler{
+		subHandler:       handler,
+		userManager:      um,
+		oidcVerifier:     verifier,
+		requireSignature: requireSignature,
+	}
+}
+
+// NewStreamAuthHandler - like NewAuthHandler, also accepting ID tokens
+// checked by verifier, for the streams, diffs and archives that clients
+// request alongside their RPCs. verifier may be nil.
+func NewStreamAuthHandler(handler http.Handler, um user.UserManager, verifier *oidc.Verifier) http.Handler {
+	return &AuthHandler{
+		subHandler:   handler,
+		userManager:  um,
+		oidcVerifier: verifier,
+	}
+}
+
 // AuthHandler - acts as a middleware that authenticates any incoming request
 // and if it's authenticated, adds additional context
 type AuthHandler struct {
-	subHandler  http.Handler
-	userManager user.UserManager
+	subHandler   http.Handler
+	userManager  user.UserManager
+	oidcVerifier *oidc.Verifier
+
+	requireSignature bool
+	signatures       seenSignatures
 }
 
+var errUnsignedRequest = errors.New("request isn't signed")
+
 func (a *AuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if authorization := r.Header.Get("Authorization"); a.oidcVerifier != nil && strings.HasPrefix(authorization, "Bearer ") {
+		a.serveOIDC(w, r, strings.TrimPrefix(authorization, "Bearer "))
+		return
+	}
+
 	username, password, ok := r.BasicAuth()
 	if !ok {
 		http.Error(w, "Unauthorized.", http.StatusUnauthorized)
@@ -43,7 +89,141 @@ func (a *AuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = a.checkSignature(r, u.ApiKey, time.Now())
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":    err,
+			"path":     r.URL.Path,
+			"username": username,
+		}).Warn("auth handler: request signature check failed")
+
+		if err == errUnsignedRequest {
+			http.Error(w, "Unauthorized, this server only accepts signed requests.", http.StatusUnauthorized)
+		} else {
+			http.Error(w, "Unauthorized, bad request signature.", http.StatusUnauthorized)
+		}
+		return
+	}
+
 	r = auth.SetAuthenticationDetails(r, u, authenticationType)
 
 	a.subHandler.ServeHTTP(w, r)
 }
+
+// checkSignature checks r's signature if it has one, or returns
+// errUnsignedRequest if it hasn't and one is required. A signature can only be
+// used once.
+func (a *AuthHandler) checkSignature(r *http.Request, apiKey string, now time.Time) error {
+	signature := r.Header.Get(crypto.SignatureHeader)
+	if signature == "" {
+		if a.requireSignature {
+			return errUnsignedRequest
+		}
+		return nil
+	}
+	err := verifyRequestSignature(r, apiKey, signature)
+	if err != nil {
+		return err
+	}
+	if !a.signatures.add(signature, now) {
+		return fmt.Errorf("request signature has been used already")
+	}
+	return nil
+}
+
+// seenSignatures remembers the signatures of the requests it's been given
+// for as long as their timestamps would be accepted, so a request copied off
+// the wire can't be replayed to this node. They aren't shared between nodes.
+type seenSignatures struct {
+	sync.Mutex
+	seen       map[string]time.Time
+	lastPruned time.Time
+}
+
+// add returns false if signature has been seen already, otherwise
+// remembers it.
+func (s *seenSignatures) add(signature string, now time.Time) bool {
+	s.Lock()
+	defer s.Unlock()
+	if s.seen == nil {
+		s.seen = map[string]time.Time{}
+	}
+	if now.Sub(s.lastPruned) > time.Minute {
+		for seenSignature, expires := range s.seen {
+			if now.After(expires) {
+				delete(s.seen, seenSignature)
+			}
+		}
+		s.lastPruned = now
+	}
+	if expires, ok := s.seen[signature]; ok && !now.After(expires) {
+		return false
+	}
+	// the timestamp can be up to SignatureMaxAge ahead of now, and is good
+	// until SignatureMaxAge after that
+	s.seen[signature] = now.Add(2 * crypto.SignatureMaxAge)
+	return true
+}
+
+// verifyRequestSignature checks a signed JSON-RPC request's signature,
+// leaving its body to be read again.
+func verifyRequestSignature(r *http.Request, apiKey, signature string) error {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	var rpcRequest struct {
+		Method string `json:"method"`
+	}
+	err = json.Unmarshal(body, &rpcRequest)
+	if err != nil {
+		return fmt.Errorf("signed request isn't JSON-RPC: %s", err)
+	}
+	return crypto.VerifySignature(
+		apiKey, rpcRequest.Method, body,
+		r.Header.Get(crypto.SignatureTimestampHeader), signature, time.Now(),
+	)
+}
+
+// serveOIDC authenticates the user whose verified email address is in the ID
+// token, they need to have signed up with the same address.
+func (a *AuthHandler) serveOIDC(w http.ResponseWriter, r *http.Request, idToken string) {
+	claims, err := a.oidcVerifier.Verify(r.Context(), idToken)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"path":  r.URL.Path,
+		}).Warn("auth handler: OIDC authentication failed")
+
+		http.Error(w, "Unauthorized.", http.StatusUnauthorized)
+		return
+	}
+	if claims.Email == "" || !claims.EmailVerified {
+		log.WithFields(log.Fields{
+			"path":    r.URL.Path,
+			"subject": claims.Subject,
+		}).Warn("auth handler: OIDC token has no verified email")
+
+		http.Error(w, "Unauthorized, the ID token needs a verified email address.", http.StatusUnauthorized)
+		return
+	}
+
+	u, err := a.userManager.Get(&user.Query{Ref: claims.Email})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"path":  r.URL.Path,
+			"email": claims.Email,
+		}).Warn("auth handler: no user for OIDC email")
+
+		http.Error(w, "Unauthorized.", http.StatusUnauthorized)
+		return
+	}
+
+	r = auth.SetAuthenticationDetails(r, u, user.AuthenticationTypeOIDC)
+
+	a.subHandler.ServeHTTP(w, r)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dotmesh-io/dotmesh/pkg/crypto"
+)
+
+func TestVerifyRequestSignature(t *testing.T) {
+	body := []byte(`{"method":"DotmeshRPC.List","params":[null],"id":1}`)
+	signedRequest := func(apiKey string, at time.Time) *http.Request {
+		r, err := http.NewRequest("POST", "http://localhost:32607/rpc", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		timestamp := crypto.SignatureTimestamp(at)
+		r.Header.Set(crypto.SignatureTimestampHeader, timestamp)
+		r.Header.Set(crypto.SignatureHeader, crypto.Signature(apiKey, "DotmeshRPC.List", body, timestamp))
+		return r
+	}
+
+	r := signedRequest("apikey", time.Now())
+	if err := verifyRequestSignature(r, "apikey", r.Header.Get(crypto.SignatureHeader)); err != nil {
+		t.Fatalf("expected a good signature to verify, got %s", err)
+	}
+	// The RPC handler still gets the whole body
+	rest, _ := ioutil.ReadAll(r.Body)
+	if !bytes.Equal(rest, body) {
+		t.Errorf("expected the body to be left readable, got %q", rest)
+	}
+
+	r = signedRequest("other", time.Now())
+	if err := verifyRequestSignature(r, "apikey", r.Header.Get(crypto.SignatureHeader)); err == nil {
+		t.Error("expected a signature with the wrong key to fail")
+	}
+	r = signedRequest("apikey", time.Now().Add(-10*time.Minute))
+	if err := verifyRequestSignature(r, "apikey", r.Header.Get(crypto.SignatureHeader)); err == nil {
+		t.Error("expected a replayed request to fail")
+	}
+}
+
+func TestCheckSignature(t *testing.T) {
+	body := []byte(`{"method":"DotmeshRPC.List","params":[null],"id":1}`)
+	newRequest := func(signed bool) *http.Request {
+		r, err := http.NewRequest("POST", "http://localhost:32607/rpc", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if signed {
+			timestamp := crypto.SignatureTimestamp(time.Now())
+			r.Header.Set(crypto.SignatureTimestampHeader, timestamp)
+			r.Header.Set(crypto.SignatureHeader, crypto.Signature("apikey", "DotmeshRPC.List", body, timestamp))
+		}
+		return r
+	}
+
+	now := time.Now()
+	optional := &AuthHandler{}
+	if err := optional.checkSignature(newRequest(false), "apikey", now); err != nil {
+		t.Errorf("expected an unsigned request to be let through, got %s", err)
+	}
+
+	required := &AuthHandler{requireSignature: true}
+	if err := required.checkSignature(newRequest(false), "apikey", now); err != errUnsignedRequest {
+		t.Errorf("expected an unsigned request to be rejected, got %v", err)
+	}
+	r := newRequest(true)
+	if err := required.checkSignature(r, "apikey", now); err != nil {
+		t.Fatalf("expected a signed request to be let through, got %s", err)
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err := required.checkSignature(r, "apikey", now.Add(time.Second)); err == nil {
+		t.Error("expected the same signed request to be rejected the second time")
+	}
+}
+
+func TestSeenSignatures(t *testing.T) {
+	var seen seenSignatures
+	now := time.Now()
+	if !seen.add("a", now) {
+		t.Fatal("expected a new signature to be added")
+	}
+	if seen.add("a", now.Add(crypto.SignatureMaxAge)) {
+		t.Error("expected a seen signature to be refused")
+	}
+	if !seen.add("b", now) {
+		t.Error("expected a different signature to be added")
+	}
+	// once the timestamp can't be accepted anyway, it's forgotten
+	later := now.Add(2*crypto.SignatureMaxAge + time.Minute)
+	if !seen.add("c", later) {
+		t.Fatal("expected a new signature to be added")
+	}
+	if _, ok := seen.seen["a"]; ok {
+		t.Error("expected an expired signature to be pruned")
+	}
+}
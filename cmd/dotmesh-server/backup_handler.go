@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// how many records BackupHandler writes between flushes
+const backupFlushInterval = 100
+
+// BackupHandler streams a backup of the users and registry, as DumpEtcd
+// returns it, one newline-delimited JSON types.BackupRecord at a time, which
+// is the format of the backup file. The number of records is in the
+// X-Dotmesh-Backup-Records header, so that clients can show progress. Only
+// the admin user can take backups.
+type BackupHandler struct {
+	state *InMemoryState
+}
+
+func NewBackupHandler(state *InMemoryState) http.Handler {
+	return &BackupHandler{
+		state: state,
+	}
+}
+
+func (s *BackupHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	err := ensureAdminUser(req)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusForbidden)
+		return
+	}
+	flusher, ok := resp.(http.Flusher)
+	if !ok {
+		http.Error(resp, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	backup := s.state.dumpEtcd()
+	resp.Header().Set("Content-Type", "application/x-ndjson")
+	resp.Header().Set("X-Dotmesh-Backup-Records", strconv.Itoa(backup.RecordCount()))
+	resp.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(resp)
+	written := 0
+	err = backup.EachRecord(func(record types.BackupRecord) error {
+		err := encoder.Encode(record)
+		if err != nil {
+			return err
+		}
+		written++
+		if written%backupFlushInterval == 0 {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		// too late for an error response, the client sees the backup end early
+		log.WithError(err).Error("[BackupHandler] failed writing backup")
+		return
+	}
+	flusher.Flush()
+}
+
+// dumpEtcd collects the users and registry for a backup. Anything that can't
+// be listed is logged and left out.
+func (s *InMemoryState) dumpEtcd() *types.BackupV1 {
+	var backup types.BackupV1
+
+	backup.Version = types.BackupVersion
+	backup.Created = time.Now()
+
+	users, err := s.userManager.List("")
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("failed to list users")
+	} else {
+		backup.Users = users
+	}
+
+	filesystemMasters, err := s.filesystemStore.ListMaster()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("failed to list filesystem masters")
+	} else {
+		backup.FilesystemMasters = filesystemMasters
+	}
+
+	registryFilesystems, err := s.registryStore.ListFilesystems()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("failed to list registry filesystems")
+	} else {
+		backup.RegistryFilesystems = registryFilesystems
+	}
+
+	registryClones, err := s.registryStore.ListClones()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("failed to list registry clones")
+	} else {
+		backup.RegistryClones = registryClones
+	}
+	return &backup
+}
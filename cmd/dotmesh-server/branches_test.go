@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBranchInfo(t *testing.T) {
+	empty := branchInfo("new", nil, false)
+	if empty.CommitCount != 0 || empty.HeadCommitID != "" || !empty.HeadCommitAt.IsZero() {
+		t.Errorf("expected a branch without commits to have no head, got %+v", empty)
+	}
+
+	committedAt := time.Unix(1600000000, 0)
+	snapshots := []Snapshot{
+		{Id: "c1", Metadata: map[string]string{"message": "first", "timestamp": "1500000000000000000"}},
+		{Id: "c2", Metadata: map[string]string{"message": "second", "timestamp": "1600000000000000000"}},
+	}
+	info := branchInfo("master", snapshots, true)
+	if info.Name != "master" || !info.IsDefault || info.CommitCount != 2 {
+		t.Errorf("unexpected branch info %+v", info)
+	}
+	if info.HeadCommitID != "c2" || info.HeadCommitMessage != "second" || !info.HeadCommitAt.Equal(committedAt) {
+		t.Errorf("expected head c2 \"second\" at %s, got %+v", committedAt, info)
+	}
+}
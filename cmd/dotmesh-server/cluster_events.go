@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// how often the cluster is looked at for changes, while any events stream
+// is open
+const clusterEventsPollInterval = 5 * time.Second
+
+// how many polls' events a stream can fall behind by before it's hung up on
+const clusterEventsBacklog = 16
+
+// ClusterEventsHandler streams what happens to the volumes the user can
+// read, anywhere on the cluster, as Server-Sent Events, one JSON-encoded
+// ClusterEvent per event. Like WatchModifiedHandler, it polls, but once for
+// all the streams: see clusterEventsPoller.
+type ClusterEventsHandler struct {
+	state  *InMemoryState
+	poller *clusterEventsPoller
+}
+
+func NewClusterEventsHandler(state *InMemoryState) http.Handler {
+	return &ClusterEventsHandler{
+		state: state,
+		poller: newClusterEventsPoller(func(ctx context.Context) (*clusterState, error) {
+			return state.clusterState(state.getAdminCtx(ctx))
+		}, clusterEventsPollInterval),
+	}
+}
+
+// clusterState is what can be seen of the cluster at a moment, for working
+// out what's happened since.
+type clusterState struct {
+	// by filesystem id, branches included
+	volumes map[string]DotmeshVolume
+	// commit ids of each volume, oldest first
+	commits map[string][]string
+	// transfers of the volumes, by id
+	transfers map[string]TransferPollResult
+	// the top-level filesystem each volume belongs to, for deciding who can
+	// see what's happened to it
+	tlfs map[string]types.TopLevelFilesystem
+}
+
+// volumeEvent is a ClusterEvent, with the top-level filesystem of the volume
+// it happened to.
+type volumeEvent struct {
+	types.ClusterEvent
+	tlf types.TopLevelFilesystem
+}
+
+// clusterEventsPoller works out what's happened on the whole cluster every
+// interval, while at least one events stream is subscribed, and sends it to
+// all of them. Each stream then picks out the events its user can see.
+type clusterEventsPoller struct {
+	latest   func(ctx context.Context) (*clusterState, error)
+	interval time.Duration
+
+	lock        sync.Mutex
+	subscribers map[chan []volumeEvent]struct{}
+	// stops the polling, nil when there's none
+	stop context.CancelFunc
+}
+
+func newClusterEventsPoller(latest func(ctx context.Context) (*clusterState, error), interval time.Duration) *clusterEventsPoller {
+	return &clusterEventsPoller{
+		latest:      latest,
+		interval:    interval,
+		subscribers: map[chan []volumeEvent]struct{}{},
+	}
+}
+
+// subscribe returns a channel of the events each poll finds from now on,
+// starting the polling if nothing else is subscribed, and a function to
+// unsubscribe. The channel is closed if the subscriber falls more than
+// clusterEventsBacklog polls behind.
+func (p *clusterEventsPoller) subscribe() (<-chan []volumeEvent, func()) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	events := make(chan []volumeEvent, clusterEventsBacklog)
+	p.subscribers[events] = struct{}{}
+	if p.stop == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		p.stop = cancel
+		go p.poll(ctx)
+	}
+	return events, func() {
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		delete(p.subscribers, events)
+		p.stopIfUnsubscribed()
+	}
+}
+
+// stopIfUnsubscribed stops the polling once nothing is subscribed. p.lock
+// must be held.
+func (p *clusterEventsPoller) stopIfUnsubscribed() {
+	if len(p.subscribers) == 0 && p.stop != nil {
+		p.stop()
+		p.stop = nil
+	}
+}
+
+func (p *clusterEventsPoller) poll(ctx context.Context) {
+	// the first state is only compared with, as for WatchModifiedHandler
+	previous, err := p.latest(ctx)
+	if err != nil {
+		log.Warnf("[clusterEventsPoller.poll] failed to get the state of the cluster: %s", err)
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		var now time.Time
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-ticker.C:
+		}
+		latest, err := p.latest(ctx)
+		if err != nil {
+			log.Warnf("[clusterEventsPoller.poll] failed to get the state of the cluster: %s", err)
+			continue
+		}
+		if previous == nil {
+			previous = latest
+			continue
+		}
+		events := clusterEvents(previous, latest, now)
+		previous = latest
+		if len(events) > 0 {
+			p.publish(ctx, events)
+		}
+	}
+}
+
+// publish sends events to every subscriber, hanging up on the ones too far
+// behind to take them; their clients can reconnect.
+func (p *clusterEventsPoller) publish(ctx context.Context, events []volumeEvent) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if ctx.Err() != nil {
+		// stopped, and the subscribers may be another poll's now
+		return
+	}
+	for subscriber := range p.subscribers {
+		select {
+		case subscriber <- events:
+		default:
+			log.Warnf("[clusterEventsPoller.publish] an events stream is %d polls behind, closing it", clusterEventsBacklog)
+			delete(p.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+	p.stopIfUnsubscribed()
+}
+
+func (s *ClusterEventsHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	flusher, ok := resp.(http.Flusher)
+	if !ok {
+		http.Error(resp, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe := s.poller.subscribe()
+	defer unsubscribe()
+
+	resp.Header().Set("Content-Type", "text/event-stream")
+	resp.Header().Set("Cache-Control", "no-cache")
+	resp.Header().Set("Connection", "keep-alive")
+	resp.WriteHeader(200)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(watchKeepaliveInterval)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-keepalive.C:
+			_, err := fmt.Fprint(resp, ": keepalive\n\n")
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		case batch, ok := <-events:
+			if !ok {
+				return
+			}
+			// whether the user can read each top-level filesystem, by id
+			readable := map[string]bool{}
+			for _, event := range batch {
+				id := event.tlf.MasterBranch.Id
+				if id == "" {
+					continue
+				}
+				canRead, checked := readable[id]
+				if !checked {
+					tlf := event.tlf
+					authorized, err := s.state.authorizeVolumeAccess(req.Context(), &tlf, types.PermRead)
+					if err != nil {
+						log.Warnf("[ClusterEventsHandler.ServeHTTP] failed to check access to %s: %s", id, err)
+					}
+					canRead = err == nil && authorized
+					readable[id] = canRead
+				}
+				if !canRead {
+					continue
+				}
+				b, err := json.Marshal(event.ClusterEvent)
+				if err != nil {
+					log.Warnf("[ClusterEventsHandler.ServeHTTP] failed to encode event %+v: %s", event.ClusterEvent, err)
+					return
+				}
+				_, err = fmt.Fprintf(resp, "data: %s\n\n", b)
+				if err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// clusterState is the state of the volumes the user in ctx can read.
+func (s *InMemoryState) clusterState(ctx context.Context) (*clusterState, error) {
+	volumes, err := s.GetListOfVolumes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	softDeleted, err := s.softDeletedFilesystemIds()
+	if err != nil {
+		return nil, err
+	}
+
+	state := &clusterState{
+		volumes:   map[string]DotmeshVolume{},
+		commits:   map[string][]string{},
+		transfers: map[string]TransferPollResult{},
+		tlfs:      map[string]types.TopLevelFilesystem{},
+	}
+	for _, volume := range volumes {
+		if _, ok := softDeleted[volume.Id]; ok {
+			continue
+		}
+		state.volumes[volume.Id] = volume
+		if tlf, _, err := s.registry.LookupFilesystemById(volume.Id); err == nil {
+			state.tlfs[volume.Id] = tlf
+		}
+		snapshots, err := s.SnapshotsForCurrentMaster(volume.Id)
+		if err != nil {
+			continue
+		}
+		ids := make([]string, len(snapshots))
+		for i, snapshot := range snapshots {
+			ids[i] = snapshot.Id
+		}
+		state.commits[volume.Id] = ids
+	}
+
+	s.interclusterTransfersLock.Lock()
+	defer s.interclusterTransfersLock.Unlock()
+	for id, transfer := range s.interclusterTransfers {
+		if _, ok := state.volumes[transfer.FilesystemId]; ok {
+			state.transfers[id] = transfer
+		}
+	}
+	return state, nil
+}
+
+// clusterEvents is what's happened between before and after, as events at
+// now: volumes created and deleted, commits added to volumes that were
+// there before, and transfers started, finished and failed.
+func clusterEvents(before, after *clusterState, now time.Time) []volumeEvent {
+	events := []volumeEvent{}
+	newVolumeEvent := func(eventType string, volume DotmeshVolume, tlf types.TopLevelFilesystem) volumeEvent {
+		return volumeEvent{
+			ClusterEvent: types.ClusterEvent{Type: eventType, Time: now, Volume: volume.Name, Branch: volume.Branch},
+			tlf:          tlf,
+		}
+	}
+
+	for _, id := range sortedVolumeIds(after.volumes) {
+		volume := after.volumes[id]
+		if _, ok := before.volumes[id]; !ok {
+			events = append(events, newVolumeEvent(types.ClusterEventVolumeCreated, volume, after.tlfs[id]))
+			continue
+		}
+		seen := map[string]bool{}
+		for _, commit := range before.commits[id] {
+			seen[commit] = true
+		}
+		for _, commit := range after.commits[id] {
+			if !seen[commit] {
+				event := newVolumeEvent(types.ClusterEventCommitAdded, volume, after.tlfs[id])
+				event.CommitID = commit
+				events = append(events, event)
+			}
+		}
+	}
+	for _, id := range sortedVolumeIds(before.volumes) {
+		if _, ok := after.volumes[id]; !ok {
+			events = append(events, newVolumeEvent(types.ClusterEventVolumeDeleted, before.volumes[id], before.tlfs[id]))
+		}
+	}
+
+	transferIds := []string{}
+	for id := range after.transfers {
+		transferIds = append(transferIds, id)
+	}
+	sort.Strings(transferIds)
+	for _, id := range transferIds {
+		transfer := after.transfers[id]
+		previous, existed := before.transfers[id]
+		transferEvent := func(eventType string) volumeEvent {
+			return volumeEvent{
+				ClusterEvent: types.ClusterEvent{
+					Type:       eventType,
+					Time:       now,
+					Volume:     VolumeName{Namespace: transfer.LocalNamespace, Name: transfer.LocalName},
+					Branch:     transfer.LocalBranchName,
+					TransferID: id,
+				},
+				tlf: after.tlfs[transfer.FilesystemId],
+			}
+		}
+		if transferStarted(transfer) && !(existed && transferStarted(previous)) {
+			events = append(events, transferEvent(types.ClusterEventTransferStarted))
+		}
+		if transfer.Status == "finished" && !(existed && previous.Status == "finished") {
+			events = append(events, transferEvent(types.ClusterEventTransferFinished))
+		}
+		if transfer.Status == "error" && !(existed && previous.Status == "error") {
+			event := transferEvent(types.ClusterEventTransferFailed)
+			event.Message = transfer.Message
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// transferStarted is whether a transfer has got past waiting in the queue.
+func transferStarted(transfer TransferPollResult) bool {
+	return transfer.Status != "queued" && transfer.Status != "paused"
+}
+
+func sortedVolumeIds(volumes map[string]DotmeshVolume) []string {
+	ids := make([]string, 0, len(volumes))
+	for id := range volumes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+)
+
+func Test_clusterEvents(t *testing.T) {
+	apples := DotmeshVolume{Id: "fs-apples", Name: VolumeName{Namespace: "admin", Name: "apples"}}
+	branch := DotmeshVolume{Id: "fs-branch", Name: apples.Name, Branch: "fix"}
+	pears := DotmeshVolume{Id: "fs-pears", Name: VolumeName{Namespace: "admin", Name: "pears"}}
+	transfer := func(status string) TransferPollResult {
+		return TransferPollResult{FilesystemId: "fs-apples", LocalNamespace: "admin", LocalName: "apples", Status: status, Message: "oops"}
+	}
+
+	applesTLF := types.TopLevelFilesystem{MasterBranch: types.DotmeshVolume{Id: apples.Id}}
+	pearsTLF := types.TopLevelFilesystem{MasterBranch: types.DotmeshVolume{Id: pears.Id}}
+
+	before := &clusterState{
+		volumes:   map[string]DotmeshVolume{apples.Id: apples, pears.Id: pears},
+		commits:   map[string][]string{apples.Id: {"c1"}, pears.Id: {"p1"}},
+		transfers: map[string]TransferPollResult{"t1": transfer("queued"), "t2": transfer("running"), "t3": transfer("finished")},
+		tlfs:      map[string]types.TopLevelFilesystem{pears.Id: pearsTLF},
+	}
+	after := &clusterState{
+		volumes:   map[string]DotmeshVolume{apples.Id: apples, branch.Id: branch},
+		commits:   map[string][]string{apples.Id: {"c1", "c2", "c3"}, branch.Id: {"c1"}},
+		transfers: map[string]TransferPollResult{"t1": transfer("running"), "t2": transfer("error"), "t3": transfer("finished"), "t4": transfer("finished")},
+		tlfs:      map[string]types.TopLevelFilesystem{apples.Id: applesTLF, branch.Id: applesTLF},
+	}
+	now := time.Unix(100, 0)
+	events := clusterEvents(before, after, now)
+
+	expected := []types.ClusterEvent{
+		{Type: types.ClusterEventCommitAdded, Volume: apples.Name, CommitID: "c2"},
+		{Type: types.ClusterEventCommitAdded, Volume: apples.Name, CommitID: "c3"},
+		{Type: types.ClusterEventVolumeCreated, Volume: apples.Name, Branch: "fix"},
+		{Type: types.ClusterEventVolumeDeleted, Volume: pears.Name},
+		{Type: types.ClusterEventTransferStarted, Volume: apples.Name, TransferID: "t1"},
+		{Type: types.ClusterEventTransferFailed, Volume: apples.Name, TransferID: "t2", Message: "oops"},
+		{Type: types.ClusterEventTransferStarted, Volume: apples.Name, TransferID: "t4"},
+		{Type: types.ClusterEventTransferFinished, Volume: apples.Name, TransferID: "t4"},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %d: %+v", len(expected), len(events), events)
+	}
+	for i, event := range events {
+		expected[i].Time = now
+		if event.ClusterEvent != expected[i] {
+			t.Errorf("event %d: expected %+v, got %+v", i, expected[i], event.ClusterEvent)
+		}
+		// deleted volumes are looked up in the state from before
+		expectedTLF := apples.Id
+		if event.Type == types.ClusterEventVolumeDeleted {
+			expectedTLF = pears.Id
+		}
+		if event.tlf.MasterBranch.Id != expectedTLF {
+			t.Errorf("event %d: expected the top-level filesystem %s, got %q", i, expectedTLF, event.tlf.MasterBranch.Id)
+		}
+	}
+
+	if events := clusterEvents(after, after, now); len(events) != 0 {
+		t.Errorf("expected no events when nothing's changed, got %+v", events)
+	}
+}
+
+func TestClusterEventsPoller(t *testing.T) {
+	// a volume is created on every poll
+	var lock sync.Mutex
+	polls := 0
+	poller := newClusterEventsPoller(func(ctx context.Context) (*clusterState, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		polls++
+		state := &clusterState{volumes: map[string]DotmeshVolume{}}
+		for i := 0; i < polls; i++ {
+			id := fmt.Sprintf("fs-%d", i)
+			state.volumes[id] = DotmeshVolume{Id: id}
+		}
+		return state, nil
+	}, time.Millisecond)
+	pollCount := func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		return polls
+	}
+
+	first, unsubscribeFirst := poller.subscribe()
+	second, unsubscribeSecond := poller.subscribe()
+	for name, events := range map[string]<-chan []volumeEvent{"first": first, "second": second} {
+		select {
+		case batch := <-events:
+			if len(batch) != 1 || batch[0].Type != types.ClusterEventVolumeCreated {
+				t.Errorf("%s: expected a volume to be created, got %+v", name, batch)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: timed out waiting for events", name)
+		}
+	}
+
+	// the second subscriber isn't reading, and falls behind
+	for i := 0; i <= clusterEventsBacklog; i++ {
+		select {
+		case <-first:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for events")
+		}
+	}
+	for range second {
+	}
+	unsubscribeSecond()
+
+	// polling stops once nothing is subscribed
+	unsubscribeFirst()
+	time.Sleep(10 * time.Millisecond)
+	stopped := pollCount()
+	time.Sleep(10 * time.Millisecond)
+	if polls := pollCount(); polls != stopped {
+		t.Errorf("expected polling to stop with no subscribers, got %d more polls", polls-stopped)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 
 	"github.com/dotmesh-io/dotmesh/pkg/auth"
@@ -10,6 +11,7 @@ import (
 
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -22,6 +24,7 @@ import (
 	"github.com/dotmesh-io/dotmesh/pkg/messaging"
 	"github.com/dotmesh-io/dotmesh/pkg/notification"
 	"github.com/dotmesh-io/dotmesh/pkg/observer"
+	"github.com/dotmesh-io/dotmesh/pkg/oidc"
 	"github.com/dotmesh-io/dotmesh/pkg/registry"
 	"github.com/dotmesh-io/dotmesh/pkg/store"
 	"github.com/dotmesh-io/dotmesh/pkg/types"
@@ -51,6 +54,11 @@ type InMemoryState struct {
 	registryStore   store.RegistryStore
 	filesystemStore store.FilesystemStore
 	serverStore     store.ServerStore
+	auditStore      store.AuditStore
+	// transferHistoryStore is nil if the transfer history isn't kept
+	transferHistoryStore store.TransferHistoryStore
+	// oidcVerifier is nil unless an OIDC provider is configured
+	oidcVerifier *oidc.Verifier
 
 	etcdWaitTimestamp          int64
 	etcdWaitState              string
@@ -64,10 +72,15 @@ type InMemoryState struct {
 	fetchRelatedContainersChan chan bool
 	interclusterTransfers      map[string]TransferPollResult
 	interclusterTransfersLock  *sync.RWMutex
-	globalDirtyCacheLock       *sync.RWMutex
-	globalDirtyCache           map[string]dirtyInfo
-	userManager                user.UserManager
-	publisher                  notification.Publisher
+	// when each transfer this node initiated was first seen, for its
+	// history record, guarded by interclusterTransfersLock
+	transferStarts       map[string]time.Time
+	transferQueue        *transferQueue
+	transferWebhooks     *transferWebhooks
+	globalDirtyCacheLock *sync.RWMutex
+	globalDirtyCache     map[string]dirtyInfo
+	userManager          user.UserManager
+	publisher            notification.Publisher
 
 	debugPartialFailCreateFilesystem bool
 	debugPartialFailDelete           bool
@@ -110,6 +123,9 @@ func NewInMemoryState(config Opts) *InMemoryState {
 		filesystemStore: config.FilesystemStore,
 		registryStore:   config.RegistryStore,
 		serverStore:     config.ServerStore,
+		auditStore:      config.AuditStore,
+
+		transferHistoryStore: config.TransferHistoryStore,
 
 		etcdWaitTimestamp:     0,
 		etcdWaitState:         "",
@@ -129,6 +145,7 @@ func NewInMemoryState(config Opts) *InMemoryState {
 		// inter-cluster transfers are recorded here
 		interclusterTransfers:     make(map[string]TransferPollResult),
 		interclusterTransfersLock: &sync.RWMutex{},
+		transferStarts:            make(map[string]time.Time),
 		globalDirtyCacheLock:      &sync.RWMutex{},
 		globalDirtyCache:          make(map[string]dirtyInfo),
 		userManager:               config.UserManager,
@@ -146,10 +163,19 @@ func NewInMemoryState(config Opts) *InMemoryState {
 		os.Exit(1)
 	}
 	s.publisher = publisher
+	s.transferQueue = newTransferQueue(config.Config.Transfers.MaxConcurrent.Value(), s.updateWaitingTransfer)
+	s.transferWebhooks = newTransferWebhooks()
 	// a registry of names of filesystems and branches (clones) mapping to
 	// their ids
 	s.registry = registry.NewRegistry(config.UserManager, config.RegistryStore)
 
+	if config.OIDCIssuerURL != "" {
+		if config.OIDCClientID == "" {
+			log.Fatal("inMemoryState: OIDC_ISSUER_URL is set, but not OIDC_CLIENT_ID")
+		}
+		s.oidcVerifier = oidc.NewVerifier(config.OIDCIssuerURL, config.OIDCClientID)
+	}
+
 	err = s.initializeMessaging()
 	if err != nil {
 		log.WithFields(log.Fields{
@@ -204,6 +230,37 @@ func (s *InMemoryState) resetRegistry() {
 	s.registry = registry.NewRegistry(s.userManager, s.opts.RegistryStore)
 }
 
+// authorizeVolumeAccess allows the owner and collaborators of tlf, as well as
+// anyone the volume has been shared with at perm or above.
+func (s *InMemoryState) authorizeVolumeAccess(ctx context.Context, tlf *types.TopLevelFilesystem, perm types.Permission) (bool, error) {
+	u := auth.GetUserFromCtx(ctx)
+	if u == nil {
+		return false, fmt.Errorf("no user found in request ctx")
+	}
+	authorized, err := s.opts.UserManager.Authorize(u, true, tlf)
+	if err != nil || authorized {
+		return authorized, err
+	}
+
+	acl, err := s.filesystemStore.GetACL(tlf.MasterBranch.Id)
+	if err != nil {
+		if store.IsKeyNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	for _, entry := range acl.Entries {
+		if entry.User != u.Name {
+			continue
+		}
+		// write implies read
+		if types.Permission(entry.Permission) == types.PermWrite || perm == types.PermRead {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func (s *InMemoryState) getOne(ctx context.Context, fs string) (DotmeshVolume, error) {
 	// TODO simplify this by refactoring it into multiple functions,
 	// simplifying locking in the process.
@@ -213,7 +270,7 @@ func (s *InMemoryState) getOne(ctx context.Context, fs string) (DotmeshVolume, e
 	}
 
 	if tlf, clone, err := s.registry.LookupFilesystemById(fs); err == nil {
-		authorized, err := s.opts.UserManager.Authorize(auth.GetUserFromCtx(ctx), true, &tlf)
+		authorized, err := s.authorizeVolumeAccess(ctx, &tlf, types.PermRead)
 
 		if err != nil {
 			return DotmeshVolume{}, err
@@ -550,7 +607,7 @@ func (state *InMemoryState) reallyProcureFilesystem(ctx context.Context, name Vo
 				// TODO implement some kind of liveness check to avoid
 				// timing out too early on slow transfers.
 				return "", fmt.Errorf(
-					"timed out trying to procure %s, please try again", filesystemId,
+					"%stimed out trying to procure %s, please try again", types.ProcureNotReadyPrefix, filesystemId,
 				)
 			case e = <-responseChan:
 				// tally ho!
@@ -606,6 +663,22 @@ func (state *InMemoryState) reallyProcureFilesystem(ctx context.Context, name Vo
 }
 
 func (state *InMemoryState) procureFilesystem(ctx context.Context, name VolumeName) (string, error) {
+	// refuse volumes in the recycle bin up front, rather than retrying
+	volume, branch := name, ""
+	if strings.Contains(volume.Name, "@") {
+		shrapnel := strings.Split(volume.Name, "@")
+		volume.Name, branch = shrapnel[0], shrapnel[1]
+		if branch == DEFAULT_BRANCH {
+			branch = ""
+		}
+	}
+	if filesystemId, err := state.registry.MaybeCloneFilesystemId(volume, branch); err == nil {
+		err = state.ensureNotSoftDeleted(filesystemId)
+		if err != nil {
+			return "", err
+		}
+	}
+
 	var s string
 	err := tryUntilSucceeds(func() error {
 		ss, err := state.reallyProcureFilesystem(ctx, name)
@@ -615,7 +688,198 @@ func (state *InMemoryState) procureFilesystem(ctx context.Context, name VolumeNa
 	return s, err
 }
 
+// namespaceUsage adds up the size of every volume and branch in namespace.
+func (s *InMemoryState) namespaceUsage(namespace string) int64 {
+	filesystemIds := []string{}
+	for _, fsId := range s.registry.FilesystemIdsIncludingClones() {
+		tlf, _, err := s.registry.LookupFilesystemById(fsId)
+		if err == nil && tlf.MasterBranch.Name.Namespace == namespace {
+			filesystemIds = append(filesystemIds, fsId)
+		}
+	}
+
+	s.globalDirtyCacheLock.RLock()
+	defer s.globalDirtyCacheLock.RUnlock()
+	var total int64
+	for _, fsId := range filesystemIds {
+		// if not exists, 0 is fine
+		total += s.globalDirtyCache[fsId].SizeBytes
+	}
+	return total
+}
+
+// checkNamespaceQuota returns an error if namespace has a quota and its
+// volumes have already used it up.
+func (s *InMemoryState) checkNamespaceQuota(namespace string) error {
+	ns, err := s.registryStore.GetNamespace(namespace)
+	if err != nil {
+		if store.IsKeyNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if ns.MaxBytes <= 0 {
+		return nil
+	}
+	used := s.namespaceUsage(namespace)
+	if used >= ns.MaxBytes {
+		return fmt.Errorf(
+			"Namespace %s is using %d bytes, which exceeds its quota of %d bytes",
+			namespace, used, ns.MaxBytes,
+		)
+	}
+	return nil
+}
+
+// datasetQuotaUsage asks the master node for filesystemId what ZFS says of
+// its dataset's quota, and the space it uses and has left.
+func (s *InMemoryState) datasetQuotaUsage(filesystemId string) (*types.QuotaUsage, error) {
+	responseChan, err := s.globalFsRequest(
+		filesystemId,
+		&Event{Name: "get-quota-usage", Args: &EventArgs{}},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	e := <-responseChan
+	if e.Name != "quota-usage" {
+		return nil, maybeError(e, "quota-usage")
+	}
+
+	encoded, ok := (*e.Args)["usage"].(string)
+	if !ok {
+		return nil, fmt.Errorf("interface conversion failed to usage: %v", (*e.Args)["usage"])
+	}
+	usage := &types.QuotaUsage{}
+	err = json.Unmarshal([]byte(encoded), usage)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// volumeQuota returns the quota recorded for the volume whose master branch
+// is tlfId, or 0 if it has none.
+func (s *InMemoryState) volumeQuota(tlfId string) (int64, error) {
+	quota, err := s.filesystemStore.GetQuota(tlfId)
+	if err != nil {
+		if store.IsKeyNotFound(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return quota.MaxBytes, nil
+}
+
+// quotaUsage adds up the space used by all of tlf's branches, which are
+// separate datasets (each clone's counting only what it doesn't share with its
+// origin), and compares it with the volume's quota. With no quota, what's
+// available is what's left for the master branch.
+func (s *InMemoryState) quotaUsage(tlf TopLevelFilesystem) (*types.QuotaUsage, error) {
+	quota, err := s.volumeQuota(tlf.MasterBranch.Id)
+	if err != nil {
+		return nil, err
+	}
+	masterUsage, err := s.datasetQuotaUsage(tlf.MasterBranch.Id)
+	if err != nil {
+		return nil, err
+	}
+	usage := &types.QuotaUsage{
+		QuotaBytes:     quota,
+		UsedBytes:      masterUsage.UsedBytes,
+		AvailableBytes: masterUsage.AvailableBytes,
+	}
+	for _, clone := range s.registry.ClonesFor(tlf.MasterBranch.Id) {
+		cloneUsage, err := s.datasetQuotaUsage(clone.FilesystemId)
+		if err != nil {
+			return nil, err
+		}
+		usage.UsedBytes += cloneUsage.UsedBytes
+	}
+	if quota > 0 {
+		usage.AvailableBytes = quota - usage.UsedBytes
+		if usage.AvailableBytes < 0 {
+			usage.AvailableBytes = 0
+		}
+	}
+	return usage, nil
+}
+
+// checkVolumeQuota returns an error if the volume filesystemId is a branch of
+// has a quota, and its branches have already used it up. The quota is that of
+// the volume's master branch, whichever branch is being committed to, and
+// both it and the space each branch uses are as the dirty poller last saw
+// them on the branches' master nodes, as for checkNamespaceQuota, so nothing
+// needs asking of other nodes.
+func (s *InMemoryState) checkVolumeQuota(filesystemId string) error {
+	tlf, _, err := s.registry.LookupFilesystemById(filesystemId)
+	if err != nil {
+		return err
+	}
+	filesystemIds := []string{tlf.MasterBranch.Id}
+	for _, clone := range s.registry.ClonesFor(tlf.MasterBranch.Id) {
+		filesystemIds = append(filesystemIds, clone.FilesystemId)
+	}
+
+	s.globalDirtyCacheLock.RLock()
+	defer s.globalDirtyCacheLock.RUnlock()
+	quota := s.globalDirtyCache[tlf.MasterBranch.Id].QuotaBytes
+	if quota <= 0 {
+		return nil
+	}
+	var used int64
+	for _, fsId := range filesystemIds {
+		// if not exists, 0 is fine
+		used += s.globalDirtyCache[fsId].CompressedBytes
+	}
+	if used >= quota {
+		return fmt.Errorf(
+			"Volume is using %d bytes, which exceeds its quota of %d bytes",
+			used, quota,
+		)
+	}
+	return nil
+}
+
+// applyVolumeQuota sets the ZFS quota of filesystemId's dataset on this node
+// to its volume's quota, for when this node becomes its master. ZFS can't
+// limit sibling datasets together, so this only stops any one branch
+// outgrowing the whole volume; checkVolumeQuota takes care of them all.
+// Failing to is only logged.
+func (s *InMemoryState) applyVolumeQuota(filesystemId string) {
+	tlf, _, err := s.registry.LookupFilesystemById(filesystemId)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":         err,
+			"filesystem_id": filesystemId,
+		}).Debug("[applyVolumeQuota] can't find volume, not setting quota")
+		return
+	}
+	quota, err := s.filesystemStore.GetQuota(tlf.MasterBranch.Id)
+	if err != nil {
+		if !store.IsKeyNotFound(err) {
+			log.WithFields(log.Fields{
+				"error":         err,
+				"filesystem_id": filesystemId,
+			}).Error("[applyVolumeQuota] failed to get volume quota")
+		}
+		return
+	}
+	err = s.zfs.SetQuota(filesystemId, quota.MaxBytes)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":         err,
+			"filesystem_id": filesystemId,
+		}).Error("[applyVolumeQuota] failed to set quota")
+	}
+}
+
 func (s *InMemoryState) CreateFilesystem(ctx context.Context, filesystemName *VolumeName) (fsm.FSM, chan *Event, error) {
+	err := s.checkNamespaceQuota(filesystemName.Namespace)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	// Check to see if it already partially exists, eg. in the registry but without a master
 	var filesystemId string
@@ -649,7 +913,7 @@ func (s *InMemoryState) CreateFilesystem(ctx context.Context, filesystemName *Vo
 			// Key not found, proceed to set up new master mapping
 		} else {
 			// Existing master mapping, we're trying to create an already-existing volume! Abort!
-			return nil, nil, fmt.Errorf("A volume called %s already exists with id %s", filesystemName, filesystemId)
+			return nil, nil, types.NewAPIError(types.ErrCodeConflict, "A volume called %s already exists with id %s", filesystemName, filesystemId)
 		}
 	}
 
@@ -730,6 +994,87 @@ func (s *InMemoryState) GetReplicationLatency(fs string) map[string][]string {
 	return result
 }
 
+// A replica that's missing a commit made longer ago than this is reported
+// as unhealthy.
+const replicationHealthyLag = time.Minute
+
+// GetReplicationStatus summarises, for each node other than fs's master, how
+// far its copy of fs is behind the master's. predict estimates the size of a
+// ZFS stream from one of the master's commits (or from nothing, if it's "")
+// to another.
+func (s *InMemoryState) GetReplicationStatus(fs string, predict func(fromSnapshotId, toSnapshotId string) (int64, error)) (*types.ReplicationStatus, error) {
+	master, err := s.registry.CurrentMasterNode(fs)
+	if err != nil {
+		return nil, err
+	}
+	fsm, err := s.GetFilesystemMachine(fs)
+	if err != nil {
+		return nil, err
+	}
+	return replicationStatus(master, fsm.ListSnapshots(), time.Now(), predict)
+}
+
+func replicationStatus(master string, serversAndSnapshots map[string][]*types.Snapshot, now time.Time, predict func(fromSnapshotId, toSnapshotId string) (int64, error)) (*types.ReplicationStatus, error) {
+	result := &types.ReplicationStatus{
+		MasterNode: master,
+		Replicas:   []types.ReplicaStatus{},
+	}
+	masterSnapshots := serversAndSnapshots[master]
+
+	servers := []string{}
+	for server := range serversAndSnapshots {
+		if server != master {
+			servers = append(servers, server)
+		}
+	}
+	sort.Strings(servers)
+
+	for _, server := range servers {
+		onServer := map[string]bool{}
+		for _, snapshot := range serversAndSnapshots[server] {
+			onServer[snapshot.Id] = true
+		}
+
+		replica := types.ReplicaStatus{Node: server, Healthy: true}
+		// the master's snapshots are oldest first
+		var lastCommon *types.Snapshot
+		for _, snapshot := range masterSnapshots {
+			if onServer[snapshot.Id] {
+				lastCommon = snapshot
+				continue
+			}
+			if replica.CommitsBehind == 0 && now.Sub(snapshotTime(snapshot)) > replicationHealthyLag {
+				replica.Healthy = false
+			}
+			replica.CommitsBehind++
+		}
+
+		commonId := ""
+		if lastCommon != nil {
+			commonId = lastCommon.Id
+			replica.LastSyncAt = snapshotTime(lastCommon)
+		}
+		if replica.CommitsBehind > 0 {
+			bytes, err := predict(commonId, masterSnapshots[len(masterSnapshots)-1].Id)
+			if err != nil {
+				return nil, fmt.Errorf("Can't estimate how far %s is behind: %s", server, err)
+			}
+			replica.BytesBehind = bytes
+		}
+		result.Replicas = append(result.Replicas, replica)
+	}
+	return result, nil
+}
+
+// snapshotTime - when a snapshot was taken, according to its metadata
+func snapshotTime(snapshot *types.Snapshot) time.Time {
+	nanos, err := strconv.ParseInt(snapshot.Metadata["timestamp"], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
 // Volumes might be dots or branches, we get 'em all in one big list
 func (s *InMemoryState) GetListOfVolumes(ctx context.Context) ([]DotmeshVolume, error) {
 	result := []DotmeshVolume{}
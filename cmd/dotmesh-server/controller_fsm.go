@@ -201,6 +201,9 @@ func (s *InMemoryState) AlignMountStateWithMasters(filesystemId string) error {
 			return fmt.Errorf("failed to get master node for filesystem: %s", filesystemId)
 		}
 
+		if masterNode == s.NodeID() {
+			s.applyVolumeQuota(filesystemId)
+		}
 		// not mounted but should be (we are the master)
 		if masterNode == s.NodeID() && !mounted {
 			responseEvent := fs.Mount()
@@ -289,6 +292,9 @@ func (s *InMemoryState) AddressesForServer(server string) []string {
 	return addresses
 }
 
+// RegisterNewFork registers a volume forked from originFilesystemId, with
+// this node as its master. With an empty origin the new volume is registered
+// as not being a fork of anything, which is how clones are registered.
 func (s *InMemoryState) RegisterNewFork(originFilesystemId, originSnapshotId, forkNamespace, forkName, forkFilesystemId string) error {
 	_, err := s.registryStore.GetFilesystem(forkNamespace, forkName)
 	switch {
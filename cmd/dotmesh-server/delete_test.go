@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/dotmesh-io/dotmesh/pkg/auth"
+	"github.com/dotmesh-io/dotmesh/pkg/container"
+	"github.com/dotmesh-io/dotmesh/pkg/registry"
+	"github.com/dotmesh-io/dotmesh/pkg/store"
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+	"github.com/dotmesh-io/dotmesh/pkg/user"
+)
+
+func TestDeleteRefusedWhileBranchInUse(t *testing.T) {
+	client, err := store.NewKVDBClient(&store.KVDBConfig{
+		Type: store.KVTypeMem,
+	})
+	if err != nil {
+		t.Fatalf("failed to init kv store: %s", err)
+	}
+	um := user.NewInternal(store.NewKVDBStoreWithIndex(client, "users"))
+	owner, err := um.New("alice", "alice@example.com", "verysecret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv := store.NewKVDBFilesystemStore(client)
+	reg := registry.NewRegistry(um, kv)
+	name := types.VolumeName{Namespace: "alice", Name: "vol"}
+	err = reg.UpdateFilesystemFromEtcd(name, types.RegistryFilesystem{
+		Id:      "master",
+		OwnerId: owner.Id,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.UpdateCloneFromEtcd("branch", "master", types.Clone{
+		FilesystemId: "branch",
+		Origin:       types.Origin{FilesystemId: "master"},
+	})
+
+	state := &InMemoryState{
+		registry:        reg,
+		userManager:     um,
+		filesystemStore: kv,
+		registryStore:   kv,
+		// a container is using the branch, not the master
+		globalContainerCache: map[string]containerInfo{
+			"branch": {Containers: []container.DockerContainer{{Name: "app", Id: "app"}}},
+		},
+		globalContainerCacheLock: &sync.RWMutex{},
+	}
+	d := NewDotmeshRPC(state, um)
+
+	var result bool
+	r := auth.SetAuthenticationDetails(httptest.NewRequest("POST", "/rpc", nil), owner, user.AuthenticationTypePassword)
+	err = d.Delete(r, &name, &result)
+	if apiErr, ok := err.(*types.APIError); !ok || apiErr.Code != types.ErrCodeVolumeInUse {
+		t.Fatalf("expected a volume in use error, got %#v", err)
+	}
+	if result {
+		t.Errorf("expected the result to be false")
+	}
+	for _, fsId := range []string{"master", "branch"} {
+		deleted, err := state.isFilesystemDeletedInEtcd(fsId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deleted {
+			t.Errorf("expected %s not to have been marked as deleted", fsId)
+		}
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/coreos/etcd/client"
 	"github.com/portworx/kvdb"
 	"github.com/portworx/kvdb/bolt"
+	"github.com/robfig/cron/v3"
 	"golang.org/x/net/context"
 
 	"github.com/dotmesh-io/dotmesh/pkg/store"
@@ -66,9 +67,9 @@ func getKVDBCfg() *store.KVDBConfig {
 			pkiPath = "/pki"
 		}
 
-		options[kvdb.CAFileKey] = fmt.Sprintf("%s/ca.pem", pkiPath)
-		options[kvdb.CertKeyFileKey] = fmt.Sprintf("%s/apiserver-key.pem", pkiPath)
-		options[kvdb.CertFileKey] = fmt.Sprintf("%s/apiserver.pem", pkiPath)
+		options[kvdb.CAFileKey] = envOr(types.EnvEtcdTLSCAFile, fmt.Sprintf("%s/ca.pem", pkiPath))
+		options[kvdb.CertKeyFileKey] = envOr(types.EnvEtcdTLSKeyFile, fmt.Sprintf("%s/apiserver-key.pem", pkiPath))
+		options[kvdb.CertFileKey] = envOr(types.EnvEtcdTLSCertFile, fmt.Sprintf("%s/apiserver.pem", pkiPath))
 	}
 	// server currently has 1073741824, we set a bit lower number
 	options[kvdb.MaxCallSendMsgSize] = "1073701824"
@@ -83,7 +84,15 @@ func getKVDBCfg() *store.KVDBConfig {
 	return cfg
 }
 
-func getKVDBStores() (store.FilesystemStore, store.RegistryStore, store.ServerStore, store.KVStoreWithIndex) {
+// envOr returns the environment variable name, or deflt if it's not set.
+func envOr(name, deflt string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return deflt
+}
+
+func getKVDBStores(transferHistorySize int) (store.FilesystemStore, store.RegistryStore, store.ServerStore, store.AuditStore, store.TransferHistoryStore, store.KVStoreWithIndex) {
 
 	cfg := getKVDBCfg()
 	client, err := store.NewKVDBClient(cfg)
@@ -98,8 +107,10 @@ func getKVDBStores() (store.FilesystemStore, store.RegistryStore, store.ServerSt
 	kvdbStore := store.NewKVDBFilesystemStore(client)
 	kvdbIndexStore := store.NewKVDBStoreWithIndex(client, user.UsersPrefix)
 	serverStore := store.NewKVServerStore(client)
+	auditStore := store.NewKVAuditStore(client, store.DefaultAuditLogCapacity)
+	transferHistoryStore := store.NewKVTransferHistoryStore(client, uint64(transferHistorySize))
 
-	return kvdbStore, kvdbStore, serverStore, kvdbIndexStore
+	return kvdbStore, kvdbStore, serverStore, auditStore, transferHistoryStore, kvdbIndexStore
 }
 
 var onceAgain Once
@@ -256,6 +267,55 @@ func (s *InMemoryState) cleanupDeletedFilesystems() error {
 				"filesystem_id": fsId,
 			}).Error("[cleanupDeletedFilesystems] failed to delete filesystem containers during cleanup")
 		}
+		err = s.filesystemStore.DeleteSnapshotSchedule(fsId)
+		if err != nil && !store.IsKeyNotFound(err) {
+			log.WithFields(log.Fields{
+				"error":         err,
+				"filesystem_id": fsId,
+			}).Error("[cleanupDeletedFilesystems] failed to delete filesystem snapshot schedule during cleanup")
+		}
+		err = s.filesystemStore.DeleteRetentionPolicy(fsId)
+		if err != nil && !store.IsKeyNotFound(err) {
+			log.WithFields(log.Fields{
+				"error":         err,
+				"filesystem_id": fsId,
+			}).Error("[cleanupDeletedFilesystems] failed to delete filesystem retention policy during cleanup")
+		}
+		err = s.filesystemStore.DeleteACL(fsId)
+		if err != nil && !store.IsKeyNotFound(err) {
+			log.WithFields(log.Fields{
+				"error":         err,
+				"filesystem_id": fsId,
+			}).Error("[cleanupDeletedFilesystems] failed to delete filesystem acl during cleanup")
+		}
+		err = s.filesystemStore.DeleteTags(fsId)
+		if err != nil && !store.IsKeyNotFound(err) {
+			log.WithFields(log.Fields{
+				"error":         err,
+				"filesystem_id": fsId,
+			}).Error("[cleanupDeletedFilesystems] failed to delete filesystem tags during cleanup")
+		}
+		err = s.filesystemStore.DeleteCommitMetadata(fsId)
+		if err != nil && !store.IsKeyNotFound(err) {
+			log.WithFields(log.Fields{
+				"error":         err,
+				"filesystem_id": fsId,
+			}).Error("[cleanupDeletedFilesystems] failed to delete filesystem commit metadata during cleanup")
+		}
+		err = s.filesystemStore.DeleteDefaultBranch(fsId)
+		if err != nil && !store.IsKeyNotFound(err) {
+			log.WithFields(log.Fields{
+				"error":         err,
+				"filesystem_id": fsId,
+			}).Error("[cleanupDeletedFilesystems] failed to delete filesystem default branch during cleanup")
+		}
+		err = s.filesystemStore.DeleteQuota(fsId)
+		if err != nil && !store.IsKeyNotFound(err) {
+			log.WithFields(log.Fields{
+				"error":         err,
+				"filesystem_id": fsId,
+			}).Error("[cleanupDeletedFilesystems] failed to delete filesystem quota during cleanup")
+		}
 		err = s.filesystemStore.DeleteMaster(fsId)
 		if err != nil && !store.IsKeyNotFound(err) {
 			log.WithFields(log.Fields{
@@ -370,6 +430,213 @@ func (s *InMemoryState) listFilesystemsPendingCleanup() (map[string]*types.Files
 	return result, nil
 }
 
+// The result is the set of top-level filesystem IDs currently sitting in the
+// recycle bin.
+func (s *InMemoryState) softDeletedFilesystemIds() (map[string]struct{}, error) {
+	result := make(map[string]struct{})
+	softDeleted, err := s.filesystemStore.ListSoftDeleted()
+	if err != nil {
+		if store.IsKeyNotFound(err) {
+			return result, nil
+		}
+		return result, err
+	}
+	for _, sd := range softDeleted {
+		result[sd.FilesystemID] = struct{}{}
+	}
+	return result, nil
+}
+
+// isFilesystemSoftDeleted says whether the volume that filesystemId (a master
+// branch or a clone) belongs to is in the recycle bin. Filesystems the
+// registry doesn't know about aren't.
+func (s *InMemoryState) isFilesystemSoftDeleted(filesystemId string) (bool, error) {
+	tlf, _, err := s.registry.LookupFilesystemById(filesystemId)
+	if err != nil {
+		return false, nil
+	}
+	_, err = s.filesystemStore.GetSoftDeleted(tlf.MasterBranch.Id)
+	if err != nil {
+		if store.IsKeyNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// ensureNotSoftDeleted returns a not found error if the volume that
+// filesystemId belongs to is in the recycle bin, so that it can't be used
+// until it's restored.
+func (s *InMemoryState) ensureNotSoftDeleted(filesystemId string) error {
+	softDeleted, err := s.isFilesystemSoftDeleted(filesystemId)
+	if err != nil {
+		return err
+	}
+	if softDeleted {
+		tlf, _, _ := s.registry.LookupFilesystemById(filesystemId)
+		return types.NewAPIError(
+			types.ErrCodeVolumeNotFound,
+			"Volume %s/%s is in the recycle bin, restore it to use it",
+			tlf.MasterBranch.Name.Namespace, tlf.MasterBranch.Name.Name,
+		)
+	}
+	return nil
+}
+
+// Permanently delete any soft deleted volumes whose retention period has run
+// out. Every node runs this, so the soft deletion record is removed first to
+// claim the volume; if the purge then fails, the record is put back so that
+// we try again later.
+func (s *InMemoryState) purgeExpiredSoftDeletedVolumes() error {
+	softDeleted, err := s.filesystemStore.ListSoftDeleted()
+	if err != nil {
+		if store.IsKeyNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	now := time.Now()
+	for _, sd := range softDeleted {
+		if now.Before(sd.ExpiresAt) {
+			continue
+		}
+
+		err = s.filesystemStore.DeleteSoftDeleted(sd.FilesystemID)
+		if err != nil {
+			if !store.IsKeyNotFound(err) {
+				log.WithFields(log.Fields{
+					"error":         err,
+					"filesystem_id": sd.FilesystemID,
+				}).Error("[purgeExpiredSoftDeletedVolumes] failed to claim soft deleted volume")
+			}
+			// somebody else got there first
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"filesystem_id": sd.FilesystemID,
+			"namespace":     sd.Name.Namespace,
+			"name":          sd.Name.Name,
+			"expired_at":    sd.ExpiresAt,
+		}).Info("[purgeExpiredSoftDeletedVolumes] purging volume")
+
+		filesystem, err := s.registry.LookupFilesystem(sd.Name)
+		if err != nil || filesystem.MasterBranch.Id != sd.FilesystemID {
+			// Already gone (or the name now belongs to something else),
+			// nothing left to purge.
+			continue
+		}
+
+		err = s.deleteFilesystemAndClones(sd.Username, sd.Name, filesystem)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":         err,
+				"filesystem_id": sd.FilesystemID,
+			}).Error("[purgeExpiredSoftDeletedVolumes] failed to purge volume, will retry")
+			putBackErr := s.filesystemStore.SetSoftDeleted(sd, &store.SetOptions{Force: true})
+			if putBackErr != nil {
+				log.WithFields(log.Fields{
+					"error":         putBackErr,
+					"filesystem_id": sd.FilesystemID,
+				}).Error("[purgeExpiredSoftDeletedVolumes] failed to restore soft deletion record")
+			}
+		}
+	}
+	return nil
+}
+
+// Commit to any branches whose snapshot schedule is due, then prune their
+// oldest commits if they have a RetainCount. Every node runs this, but only
+// acts on the branches it's the master for.
+func (s *InMemoryState) runSnapshotSchedules() error {
+	schedules, err := s.filesystemStore.ListSnapshotSchedules()
+	if err != nil {
+		if store.IsKeyNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	now := time.Now()
+	for _, ss := range schedules {
+		master, err := s.registry.CurrentMasterNode(ss.FilesystemID)
+		if err != nil || master != s.NodeID() {
+			continue
+		}
+
+		schedule, err := cron.ParseStandard(ss.CronExpr)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":         err,
+				"filesystem_id": ss.FilesystemID,
+				"cron_expr":     ss.CronExpr,
+			}).Error("[runSnapshotSchedules] invalid cron expression")
+			continue
+		}
+		if schedule.Next(ss.LastRun).After(now) {
+			continue
+		}
+
+		err = s.runSnapshotSchedule(ss)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":         err,
+				"filesystem_id": ss.FilesystemID,
+			}).Error("[runSnapshotSchedules] scheduled commit failed")
+		}
+
+		// don't retry a failed commit every minute, wait for the next one
+		ss.LastRun = now
+		err = s.filesystemStore.SetSnapshotSchedule(ss, &store.SetOptions{Force: true})
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":         err,
+				"filesystem_id": ss.FilesystemID,
+			}).Error("[runSnapshotSchedules] failed to record last run")
+		}
+	}
+	return nil
+}
+
+func (s *InMemoryState) runSnapshotSchedule(ss *types.SnapshotSchedule) error {
+	responseChan, err := s.globalFsRequest(ss.FilesystemID, &Event{
+		Name: "snapshot",
+		Args: &EventArgs{"metadata": map[string]string{
+			"message": fmt.Sprintf("Scheduled commit (%s)", ss.CronExpr),
+			"author":  ss.Username,
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	e := <-responseChan
+	if e.Name != "snapshotted" {
+		return maybeError(e, "snapshotted")
+	}
+	log.WithFields(log.Fields{
+		"filesystem_id": ss.FilesystemID,
+		"snapshot_id":   (*e.Args)["SnapshotId"],
+	}).Info("[runSnapshotSchedule] committed")
+
+	if ss.RetainCount <= 0 {
+		return nil
+	}
+	responseChan, err = s.globalFsRequest(ss.FilesystemID, &Event{
+		Name: "prune-snapshots",
+		Args: &EventArgs{"retainCount": ss.RetainCount},
+	})
+	if err != nil {
+		return err
+	}
+	e = <-responseChan
+	if e.Name != "pruned" {
+		return maybeError(e, "pruned")
+	}
+	return nil
+}
+
 func (s *InMemoryState) MarkFilesystemAsLiveInEtcd(topLevelFilesystemId string) error {
 	return s.filesystemStore.SetLive(&types.FilesystemLive{
 		FilesystemID: topLevelFilesystemId,
@@ -420,9 +687,17 @@ func (s *InMemoryState) handleFilesystemDeletion(fda *types.FilesystemDeletionAu
 
 // make a global request, returning its id
 func (s *InMemoryState) globalFsRequestId(fs string, event *types.Event) (chan *types.Event, string, error) {
-
 	requestID := uuid.New().String()
+	responseChan, err := s.globalFsRequestWithId(fs, requestID, event)
+	if err != nil {
+		return nil, "", err
+	}
+	return responseChan, requestID, nil
+}
 
+// globalFsRequestWithId is globalFsRequestId for a request id chosen by the
+// caller, for when it has to be known before the request is made
+func (s *InMemoryState) globalFsRequestWithId(fs, requestID string, event *types.Event) (chan *types.Event, error) {
 	event.ID = requestID
 	event.FilesystemID = fs
 
@@ -462,10 +737,10 @@ func (s *InMemoryState) globalFsRequestId(fs string, event *types.Event) (chan *
 			"filesystem_id": fs,
 			"request_id":    requestID,
 		}).Errorf("[globalFsRequest] error dispatching event %s: %s", event, err)
-		return nil, "", err
+		return nil, err
 	}
 
-	return responseChan, requestID, nil
+	return responseChan, nil
 }
 
 // attempt to register an event in etcd upon which the current master for that
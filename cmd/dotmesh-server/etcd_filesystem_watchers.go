@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/dotmesh-io/dotmesh/pkg/store"
 	"github.com/dotmesh-io/dotmesh/pkg/types"
@@ -98,6 +99,8 @@ func (s *InMemoryState) handleFilesystemMaster(fm *types.FilesystemMaster) error
 		var responseChan chan *types.Event
 		if fm.NodeID == s.NodeID() {
 			log.Debugf("MOUNTING: %s=%s", fm.FilesystemID, fm.NodeID)
+			// the quota's not sent with the data, so this node's copy may not have it
+			s.applyVolumeQuota(fm.FilesystemID)
 			responseChan, err = s.dispatchEvent(fm.FilesystemID, &types.Event{Name: "mount"}, fm.FilesystemID)
 			if err != nil {
 				return err
@@ -146,9 +149,12 @@ func (s *InMemoryState) processDirtyFilesystems(fd *types.FilesystemDirty) error
 		delete(s.globalDirtyCache, fd.FilesystemID)
 	case types.KVGet, types.KVCreate, types.KVSet:
 		s.globalDirtyCache[fd.FilesystemID] = dirtyInfo{
-			Server:     fd.NodeID,
-			DirtyBytes: fd.DirtyBytes,
-			SizeBytes:  fd.SizeBytes,
+			Server:          fd.NodeID,
+			DirtyBytes:      fd.DirtyBytes,
+			SizeBytes:       fd.SizeBytes,
+			LogicalBytes:    fd.LogicalBytes,
+			CompressedBytes: fd.CompressedBytes,
+			QuotaBytes:      fd.QuotaBytes,
 		}
 	}
 	return nil
@@ -213,15 +219,66 @@ func (s *InMemoryState) watchTransfers() error {
 
 func (s *InMemoryState) processTransferPollResults(t *types.TransferPollResult) {
 	s.interclusterTransfersLock.Lock()
-	defer s.interclusterTransfersLock.Unlock()
-
+	var record *types.TransferRecord
 	switch t.Meta.Action {
 	case types.KVDelete:
 		delete(s.interclusterTransfers, t.TransferRequestId)
+		delete(s.transferStarts, t.TransferRequestId)
 	case types.KVGet, types.KVCreate, types.KVSet:
+		previous, seen := s.interclusterTransfers[t.TransferRequestId]
 		s.interclusterTransfers[t.TransferRequestId] = *t
+		s.transferWebhooks.notify(*t)
+		record = s.transferRecord(t, previous, seen)
+	}
+	s.interclusterTransfersLock.Unlock()
+
+	if record != nil {
+		err := s.transferHistoryStore.AppendTransferRecord(record)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":       err,
+				"transfer_id": record.TransferID,
+			}).Error("[processTransferPollResults] failed to record transfer in the history")
+		}
+	}
+}
+
+// transferRecord returns the history record for t if it's just finished or
+// failed, or nil. Only the node that initiated a transfer records it, and
+// only when it sees it end, so that results which were already over when
+// the server started aren't recorded again. It must be called with
+// interclusterTransfersLock held.
+func (s *InMemoryState) transferRecord(t *types.TransferPollResult, previous types.TransferPollResult, seen bool) *types.TransferRecord {
+	if s.transferHistoryStore == nil || t.InitiatorNodeId != s.NodeID() {
+		return nil
+	}
+	now := time.Now()
+	if t.Status != "finished" && t.Status != "error" {
+		if _, ok := s.transferStarts[t.TransferRequestId]; !ok {
+			s.transferStarts[t.TransferRequestId] = now
+		}
+		return nil
+	}
+	if t.Meta.Action == types.KVGet || (seen && previous.Status == t.Status) {
+		return nil
+	}
+
+	startedAt, ok := s.transferStarts[t.TransferRequestId]
+	if !ok {
+		// it ended as soon as it started, e.g. with nothing to do
+		startedAt = now
+	}
+	delete(s.transferStarts, t.TransferRequestId)
+	record := &types.TransferRecord{
+		TransferPollResult: *t,
+		TransferID:         t.TransferRequestId,
+		StartedAt:          startedAt,
+		CompletedAt:        &now,
 	}
-	return
+	// The other cluster's API key mustn't be kept anywhere else
+	record.ApiKey = ""
+	record.Meta = nil
+	return record
 }
 
 func (s *InMemoryState) watchFilesystemDeleted() error {
@@ -73,9 +73,14 @@ func (s *InMemoryState) watchRegistryClones() error {
 func (s *InMemoryState) processRegistryClone(c *types.Clone) error {
 	switch c.Meta.Action {
 	case types.KVDelete:
+		// only the key is known, which has the top level filesystem's id
 		s.registry.DeleteCloneFromEtcd(c.Name, c.FilesystemId)
 	case types.KVGet, types.KVCreate, types.KVSet:
-		s.registry.UpdateCloneFromEtcd(c.Name, c.FilesystemId, *c)
+		topLevelFilesystemId := c.TopLevelFilesystemId
+		if topLevelFilesystemId == "" {
+			topLevelFilesystemId = c.FilesystemId
+		}
+		s.registry.UpdateCloneFromEtcd(c.Name, topLevelFilesystemId, *c)
 	}
 	return nil
 }
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+)
+
+func Test_forkLineage(t *testing.T) {
+	tlf := func(id, name, forkParentId, forkCommit string) *types.TopLevelFilesystem {
+		return &types.TopLevelFilesystem{
+			MasterBranch:         types.DotmeshVolume{Id: id, Name: types.VolumeName{Namespace: "admin", Name: name}},
+			ForkParentId:         forkParentId,
+			ForkParentSnapshotId: forkCommit,
+		}
+	}
+	original := tlf("original", "original", "", "")
+	fork := tlf("fork", "fork", "original", "c1")
+	// forked from a branch of fork, rather than its master
+	branchFork := tlf("branchfork", "branchfork", "fork-branch", "c2")
+	secret := tlf("secret", "secret", "fork", "c3")
+	grandchild := tlf("grandchild", "grandchild", "branchfork", "c4")
+	tlfs := []*types.TopLevelFilesystem{original, fork, branchFork, secret, grandchild}
+
+	lookup := func(filesystemId string) (types.TopLevelFilesystem, error) {
+		if filesystemId == "fork-branch" {
+			return *fork, nil
+		}
+		for _, tlf := range tlfs {
+			if tlf.MasterBranch.Id == filesystemId {
+				return *tlf, nil
+			}
+		}
+		return types.TopLevelFilesystem{}, fmt.Errorf("no filesystem %s", filesystemId)
+	}
+	visible := func(tlf *types.TopLevelFilesystem) bool {
+		return tlf.MasterBranch.Id != "secret"
+	}
+
+	lineage := forkLineage(*fork, tlfs, lookup, visible)
+	if lineage.Parent == nil || lineage.Parent.Name != "original" {
+		t.Errorf("expected original as the parent, got %v", lineage.Parent)
+	}
+	if lineage.ForkCommitID != "c1" || lineage.ForkDepth != 1 {
+		t.Errorf("unexpected fork commit %s and depth %d", lineage.ForkCommitID, lineage.ForkDepth)
+	}
+	if len(lineage.Children) != 1 || lineage.Children[0].Name != "branchfork" {
+		t.Errorf("expected just branchfork as a child, got %v", lineage.Children)
+	}
+
+	lineage = forkLineage(*grandchild, tlfs, lookup, visible)
+	if lineage.ForkDepth != 3 || len(lineage.Children) != 0 {
+		t.Errorf("expected depth 3 and no children, got %+v", lineage)
+	}
+
+	lineage = forkLineage(*original, tlfs, lookup, visible)
+	if lineage.Parent != nil || lineage.ForkDepth != 0 || len(lineage.Children) != 1 {
+		t.Errorf("unexpected lineage for an original volume: %+v", lineage)
+	}
+
+	// a parent that's since been deleted
+	orphan := tlf("orphan", "orphan", "deleted", "c5")
+	lineage = forkLineage(*orphan, tlfs, lookup, visible)
+	if lineage.Parent != nil || lineage.ForkCommitID != "c5" || lineage.ForkDepth != 1 {
+		t.Errorf("unexpected lineage for an orphaned fork: %+v", lineage)
+	}
+}
@@ -14,7 +14,6 @@ import (
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	rpc "github.com/gorilla/rpc/v2"
-	rpcjson "github.com/gorilla/rpc/v2/json2"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	log "github.com/sirupsen/logrus"
@@ -51,8 +50,8 @@ func (state *InMemoryState) runServer() {
 	}()
 
 	r := rpc.NewServer()
-	r.RegisterCodec(rpcjson.NewCodec(), "application/json")
-	r.RegisterCodec(rpcjson.NewCodec(), "application/json;charset=UTF-8")
+	r.RegisterCodec(newAPIErrorCodec(), "application/json")
+	r.RegisterCodec(newAPIErrorCodec(), "application/json;charset=UTF-8")
 	r.RegisterInterceptFunc(rpcInterceptFunc)
 	r.RegisterAfterFunc(rpcAfterFunc)
 	d := NewDotmeshRPC(state, state.userManager)
@@ -63,7 +62,12 @@ func (state *InMemoryState) runServer() {
 
 	router := mux.NewRouter()
 
-	router.Handle("/rpc", Instrument(state)(NewAuthHandler(r, state.userManager)))
+	rateLimit := state.serverConfig.RPC.RateLimit
+	router.Handle("/rpc", Instrument(state)(NewRateLimitHandler(
+		NewRPCAuthHandler(NewAuditHandler(r, state), state.userManager, state.oidcVerifier,
+			bool(state.serverConfig.RPC.RequireSignedRequests)),
+		rateLimit.RequestsPerSecond.Value(), rateLimit.Burst.Value(),
+	)))
 
 	router.Handle(
 		"/filesystems/{filesystem}/{fromSnap}/{toSnap}",
@@ -76,8 +80,24 @@ func (state *InMemoryState) runServer() {
 	).Methods("POST")
 
 	// display diff since the last commit
-	router.Handle("/diff/{namespace}:{name}", Instrument(state)(NewAuthHandler(NewDiffHandler(state), state.userManager))).Methods("GET")
-	router.Handle("/diff/{namespace}:{name}/{snapshotID}", Instrument(state)(NewAuthHandler(NewDiffHandler(state), state.userManager))).Methods("GET")
+	router.Handle("/diff/{namespace}:{name}", Instrument(state)(NewStreamAuthHandler(NewDiffHandler(state), state.userManager, state.oidcVerifier))).Methods("GET")
+	router.Handle("/diff/{namespace}:{name}/{snapshotID}", Instrument(state)(NewStreamAuthHandler(NewDiffHandler(state), state.userManager, state.oidcVerifier))).Methods("GET")
+
+	// stream new commits on a branch as Server-Sent Events
+	router.Handle("/volumes/{namespace}/{name}/branches/{branch}/watch", Instrument(state)(NewStreamAuthHandler(NewWatchHandler(state), state.userManager, state.oidcVerifier))).Methods("GET")
+	// and changes to a volume's last modified time
+	router.Handle("/volumes/{namespace}/{name}/watch-modified", Instrument(state)(NewStreamAuthHandler(NewWatchModifiedHandler(state), state.userManager, state.oidcVerifier))).Methods("GET")
+	// and what happens to every volume on the cluster
+	router.Handle("/events", Instrument(state)(NewStreamAuthHandler(NewClusterEventsHandler(state), state.userManager, state.oidcVerifier))).Methods("GET")
+
+	// streams a backup of the users and registry, see BackupHandler
+	router.Handle("/backup", Instrument(state)(NewStreamAuthHandler(NewBackupHandler(state), state.userManager, state.oidcVerifier))).Methods("GET")
+	// and restores one streamed back, see RestoreHandler
+	router.Handle("/restore", Instrument(state)(NewStreamAuthHandler(NewRestoreHandler(state), state.userManager, state.oidcVerifier))).Methods("POST")
+
+	// move volumes between clusters that can't see each other as tar archives
+	router.Handle("/export/{namespace}/{name}/{branch}/{commitID}", Instrument(state)(NewStreamAuthHandler(NewExportHandler(state), state.userManager, state.oidcVerifier))).Methods("POST")
+	router.Handle("/import/{namespace}/{name}/{branch}", Instrument(state)(NewStreamAuthHandler(NewImportHandler(state), state.userManager, state.oidcVerifier))).Methods("POST")
 
 	// list files in the latest snapshot
 	router.Handle("/s3/{namespace}:{name}", Instrument(state)(NewAuthHandler(NewS3Handler(state), state.userManager))).Methods("GET")
@@ -124,8 +144,8 @@ func (state *InMemoryState) runUnixDomainServer() {
 		return
 	}
 	r := rpc.NewServer()
-	r.RegisterCodec(rpcjson.NewCodec(), "application/json")
-	r.RegisterCodec(rpcjson.NewCodec(), "application/json;charset=UTF-8")
+	r.RegisterCodec(newAPIErrorCodec(), "application/json")
+	r.RegisterCodec(newAPIErrorCodec(), "application/json;charset=UTF-8")
 	d := NewDotmeshRPC(state, state.userManager)
 	err := r.RegisterService(d, "") // deduces name from type name
 	if err != nil {
@@ -194,6 +214,14 @@ func (irw *instrResponseWriter) WriteHeader(code int) {
 	irw.ResponseWriter.WriteHeader(code)
 }
 
+// Flush passes through to the wrapped ResponseWriter, so that streaming
+// handlers still work when instrumented.
+func (irw *instrResponseWriter) Flush() {
+	if f, ok := irw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 func Instrument(state *InMemoryState) MetricsMiddleware {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -217,6 +245,11 @@ func sanitizeURL(r *http.Request) string {
 		// removing whole path
 		return "/s3/*"
 	}
+	for _, prefix := range []string{"/export/", "/import/"} {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return prefix + "*"
+		}
+	}
 
 	path := r.URL.Path
 
@@ -227,6 +260,10 @@ func sanitizeURL(r *http.Request) string {
 }
 
 func rpcAfterFunc(reqInfo *rpc.RequestInfo) {
+	if outcome, ok := ctxGetAuditOutcome(reqInfo.Request.Context()); ok {
+		outcome.called = true
+		outcome.err = reqInfo.Error
+	}
 	reqId, ok := reqInfo.Request.Header[REQUEST_ID]
 	if ok && len(reqId) != 0 {
 		reqUUID, err := uuid.FromString(reqId[0])
@@ -43,6 +43,11 @@ func Test_sanitizeURL(t *testing.T) {
 			args: args{MustNewRequest("GET", "/s3/lukengctest:project-d9ec0bc1-default-workspace")},
 			want: "/s3/*",
 		},
+		{
+			name: "trim volume exports",
+			args: args{MustNewRequest("POST", "/export/admin/apples/master/b45da2d6-10f5-4716-b2f3-8abc9a9dad68?compress=true")},
+			want: "/export/*",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"sort"
 
 	"github.com/gorilla/mux"
 
@@ -50,8 +52,49 @@ func (s *InMemoryState) runLivenessServer() {
 	},
 	)
 
+	/*
+		Report the filesystems this node is acting as the master for, which
+		the operator compares across nodes to spot two of them thinking they
+		are the master for the same one. It's what the local state machines
+		think, rather than what's in etcd, as it's when they disagree with
+		each other that trouble starts.
+	*/
+
+	router.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(nodeStatus{
+			NodeID:            s.NodeID(),
+			MasterFilesystems: s.activeFilesystemIds(),
+		})
+		if err != nil {
+			log.Printf("Error writing node status: %+v", err)
+		}
+	},
+	)
+
 	err := http.ListenAndServe(fmt.Sprintf(":%s", client.LIVENESS_PORT), router)
 	if err != nil {
 		log.Fatalf("Unable to listen for liveness probes: %+v", err)
 	}
 }
+
+// nodeStatus is what the liveness server's /status reports.
+type nodeStatus struct {
+	NodeID string
+	// MasterFilesystems - ids of the filesystems whose state machines on
+	// this node are active, i.e. that it's the master for, sorted
+	MasterFilesystems []string
+}
+
+func (s *InMemoryState) activeFilesystemIds() []string {
+	s.filesystemsLock.RLock()
+	defer s.filesystemsLock.RUnlock()
+	ids := []string{}
+	for id, fs := range s.filesystems {
+		if fs.GetCurrentState() == "active" {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -156,16 +156,20 @@ func main() {
 	ips, _ := guessIPv4Addresses()
 	log.Printf("Detected my node IPs as %s", ips)
 
-	fsStore, regStore, serverStore, usersIdxStore := getKVDBStores()
+	fsStore, regStore, serverStore, auditStore, transferHistoryStore, usersIdxStore := getKVDBStores(serverConfig.Transfers.HistorySize.Value())
 	inMemoryStateOpts.FilesystemStore = fsStore
 	inMemoryStateOpts.RegistryStore = regStore
 	inMemoryStateOpts.ServerStore = serverStore
+	inMemoryStateOpts.AuditStore = auditStore
+	inMemoryStateOpts.TransferHistoryStore = transferHistoryStore
 
 	inMemoryStateOpts.ZFSExecPath = ZFS
 	inMemoryStateOpts.ZPoolPath = ZPOOL
 	inMemoryStateOpts.PoolName = POOL
 
 	inMemoryStateOpts.ExternalUserManagerURL = os.Getenv("EXTERNAL_USER_MANAGER_URL")
+	inMemoryStateOpts.OIDCIssuerURL = os.Getenv("OIDC_ISSUER_URL")
+	inMemoryStateOpts.OIDCClientID = os.Getenv("OIDC_CLIENT_ID")
 
 	if os.Getenv("DOTMESH_SERVER_PORT") != "" {
 		inMemoryStateOpts.APIServerPort = os.Getenv("DOTMESH_SERVER_PORT")
@@ -209,6 +213,19 @@ func main() {
 	go runForever(s.cleanupDeletedFilesystems, "cleanupDeletedFilesystems",
 		1*time.Second, 1*time.Second,
 	)
+	// kick off purging of soft deleted volumes past their retention period
+	go runForever(s.purgeExpiredSoftDeletedVolumes, "purgeExpiredSoftDeletedVolumes",
+		1*time.Minute, 1*time.Minute,
+	)
+	// kick off scheduled commits
+	go runForever(s.runSnapshotSchedules, "runSnapshotSchedules",
+		1*time.Minute, 1*time.Minute,
+	)
+	// kick off enforcing retention policies
+	retentionInterval := serverConfig.RetentionPolicies.Interval.Duration()
+	go runForever(s.enforceRetentionPolicies, "enforceRetentionPolicies",
+		retentionInterval, retentionInterval,
+	)
 	// kick off reporting on zpool status
 	go runForever(s.zfs.ReportZpoolCapacity, "reportZPoolUsageReporter",
 		10*time.Minute, 10*time.Minute,
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/dotmesh-io/dotmesh/pkg/registry"
+	"github.com/dotmesh-io/dotmesh/pkg/store"
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+	"github.com/dotmesh-io/dotmesh/pkg/user"
+)
+
+func TestCheckVolumeQuotaOnBranch(t *testing.T) {
+	client, err := store.NewKVDBClient(&store.KVDBConfig{
+		Type: store.KVTypeMem,
+	})
+	if err != nil {
+		t.Fatalf("failed to init kv store: %s", err)
+	}
+	um := user.NewInternal(store.NewKVDBStoreWithIndex(client, "users"))
+	owner, err := um.New("alice", "alice@example.com", "verysecret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := registry.NewRegistry(um, store.NewKVDBFilesystemStore(client))
+	err = reg.UpdateFilesystemFromEtcd(types.VolumeName{Namespace: "alice", Name: "vol"}, types.RegistryFilesystem{
+		Id:      "master",
+		OwnerId: owner.Id,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.UpdateCloneFromEtcd("branch", "master", types.Clone{FilesystemId: "branch"})
+
+	state := &InMemoryState{
+		registry:             reg,
+		globalDirtyCache:     map[string]dirtyInfo{},
+		globalDirtyCacheLock: &sync.RWMutex{},
+	}
+
+	for _, c := range []struct {
+		quota, masterUsed, branchUsed int64
+		refused                       bool
+	}{
+		{quota: 0, masterUsed: 100, branchUsed: 100, refused: false},
+		{quota: 300, masterUsed: 100, branchUsed: 100, refused: false},
+		// the branch is only over quota with the master's space counted too
+		{quota: 150, masterUsed: 100, branchUsed: 100, refused: true},
+	} {
+		state.globalDirtyCache["master"] = dirtyInfo{QuotaBytes: c.quota, CompressedBytes: c.masterUsed}
+		// the branch's own dataset has no quota, the master's counts
+		state.globalDirtyCache["branch"] = dirtyInfo{CompressedBytes: c.branchUsed}
+
+		err = state.checkVolumeQuota("branch")
+		if refused := err != nil; refused != c.refused {
+			t.Errorf("quota %d, master using %d and branch %d: expected refused %t, got %v",
+				c.quota, c.masterUsed, c.branchUsed, c.refused, err)
+		}
+	}
+}
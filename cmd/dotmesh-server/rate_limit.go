@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/sha256"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// rateLimiterIdleTimeout is how long a caller's bucket is kept after their
+// last request; by then it would have refilled anyway.
+const rateLimiterIdleTimeout = 10 * time.Minute
+
+// RateLimitHandler - a middleware that limits how often each API key (or ID
+// token) can call the wrapped handler, with a token bucket per key, and
+// answers any more requests with 429 Too Many Requests and a Retry-After
+// header.
+type RateLimitHandler struct {
+	subHandler        http.Handler
+	requestsPerSecond rate.Limit
+	burst             int
+
+	mu       sync.Mutex
+	limiters map[[sha256.Size]byte]*rateLimiter
+	lastGC   time.Time
+}
+
+type rateLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewRateLimitHandler - requestsPerSecond of 0 turns rate limiting off.
+func NewRateLimitHandler(handler http.Handler, requestsPerSecond, burst int) http.Handler {
+	if requestsPerSecond <= 0 {
+		return handler
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimitHandler{
+		subHandler:        handler,
+		requestsPerSecond: rate.Limit(requestsPerSecond),
+		burst:             burst,
+		limiters:          map[[sha256.Size]byte]*rateLimiter{},
+		lastGC:            time.Now(),
+	}
+}
+
+func (h *RateLimitHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reservation := h.limiterFor(r).Reserve()
+	if delay := reservation.Delay(); delay > 0 {
+		reservation.Cancel()
+		retryAfter := int(math.Ceil(delay.Seconds()))
+		log.WithFields(log.Fields{
+			"path":        r.URL.Path,
+			"remote_addr": r.RemoteAddr,
+			"retry_after": retryAfter,
+		}).Warn("rate limit handler: too many requests")
+
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		http.Error(w, "Too many requests, slow down.", http.StatusTooManyRequests)
+		return
+	}
+	h.subHandler.ServeHTTP(w, r)
+}
+
+// limiterFor returns the bucket for the credentials r was made with. They're
+// only hashed, rather than checked, as this runs before authentication so
+// that floods of bad requests are limited too.
+func (h *RateLimitHandler) limiterFor(r *http.Request) *rate.Limiter {
+	credentials := r.Header.Get("Authorization")
+	if _, password, ok := r.BasicAuth(); ok {
+		credentials = password
+	}
+	key := sha256.Sum256([]byte(credentials))
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	if now.Sub(h.lastGC) > rateLimiterIdleTimeout {
+		for k, l := range h.limiters {
+			if now.Sub(l.lastSeen) > rateLimiterIdleTimeout {
+				delete(h.limiters, k)
+			}
+		}
+		h.lastGC = now
+	}
+
+	l, ok := h.limiters[key]
+	if !ok {
+		l = &rateLimiter{limiter: rate.NewLimiter(h.requestsPerSecond, h.burst)}
+		h.limiters[key] = l
+	}
+	l.lastSeen = now
+	return l.limiter
+}
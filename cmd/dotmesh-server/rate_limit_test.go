@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRateLimitHandler(t *testing.T) {
+	handler := NewRateLimitHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), 1, 2)
+
+	call := func(apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/rpc", nil)
+		req.SetBasicAuth("admin", apiKey)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := call("key"); rec.Code != http.StatusOK {
+			t.Fatalf("expected request %d within the burst to be allowed, got %d", i, rec.Code)
+		}
+	}
+	rec := call("key")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the request after the burst to be limited, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected to be told to retry after a second, got %q", rec.Header().Get("Retry-After"))
+	}
+
+	// Each API key has its own bucket
+	if rec := call("other-key"); rec.Code != http.StatusOK {
+		t.Errorf("expected another API key not to be limited, got %d", rec.Code)
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/gorilla/mux"
 
 	"github.com/dotmesh-io/dotmesh/pkg/fsm"
+	"github.com/dotmesh-io/dotmesh/pkg/types"
 	"github.com/dotmesh-io/dotmesh/pkg/utils"
 	log "github.com/sirupsen/logrus"
 )
@@ -28,6 +29,12 @@ func (z *ZFSSender) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	z.fromSnap = vars["fromSnap"]
 	z.toSnap = vars["toSnap"]
 	z.filesystem = vars["filesystem"]
+	// how the puller would like the stream compressed, if at all
+	compression := r.Header.Get(types.CompressionHeader)
+	if !types.ValidCompression(compression) {
+		http.Error(w, fmt.Sprintf("unknown compression %q", compression), http.StatusBadRequest)
+		return
+	}
 
 	// TODO: add a coarse grained lock to start with: stop other readers from
 	// this filesystem, and also stop us moving this filesystem to another node
@@ -88,6 +95,9 @@ func (z *ZFSSender) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			"admin",
 			admin.ApiKey,
 		)
+		if compression != types.CompressionNone {
+			req.Header.Set(types.CompressionHeader, compression)
+		}
 
 		log.Printf("[ZFSSender:%s] Proxying pull from %s: %s", z.filesystem, masterNodeID, url)
 		resp, err := http.DefaultClient.Do(req)
@@ -100,6 +110,9 @@ func (z *ZFSSender) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 		finished := make(chan bool)
 		log.Printf("[ZFSSender:ServeHTTP] Got HTTP response %+v", resp.StatusCode)
+		if sent := resp.Header.Get(types.CompressionHeader); sent != "" {
+			w.Header().Set(types.CompressionHeader, sent)
+		}
 		w.WriteHeader(resp.StatusCode)
 		go utils.Pipe(resp.Body, url,
 			w, "proxied pull recipient",
@@ -186,6 +199,11 @@ func (z *ZFSSender) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	cmd.Stdout = pipeWriter
 	cmd.Stderr = getLogfile("zfs-send-errors")
 
+	// tell the puller how to decompress the stream; older pullers don't
+	// ask, and get the usual uncompressed gzip
+	if compression != types.CompressionNone {
+		w.Header().Set(types.CompressionHeader, compression)
+	}
 	finished := make(chan bool)
 	go utils.Pipe(
 		pipeReader, fmt.Sprintf("stdout of zfs send for %s", z.filesystem),
@@ -194,7 +212,7 @@ func (z *ZFSSender) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		make(chan *Event),
 		func(e *Event, c chan *Event) {},
 		func(bytes int64, t int64) {},
-		"compress",
+		utils.CompressMode(compression),
 	)
 
 	// log.Printf(
@@ -236,6 +254,12 @@ func (z *ZFSReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	z.fromSnap = vars["fromSnap"]
 	z.toSnap = vars["toSnap"]
 	z.filesystem = vars["filesystem"]
+	// how the pusher compressed the stream
+	compression := r.Header.Get(types.CompressionHeader)
+	if !types.ValidCompression(compression) {
+		http.Error(w, fmt.Sprintf("unknown compression %q", compression), http.StatusBadRequest)
+		return
+	}
 
 	// TODO: add a coarse grained lock to start with: stop other writers from
 	// writing to this filesystem (unlike readers, this is strictly
@@ -309,6 +333,9 @@ func (z *ZFSReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			"admin",
 			admin.ApiKey,
 		)
+		if compression != types.CompressionNone {
+			req.Header.Set(types.CompressionHeader, compression)
+		}
 		postClient := new(http.Client)
 		log.Printf("[ZFSReceiver:%s] Proxying push to %s: %s", z.filesystem, masterNodeID, url)
 		resp, err := postClient.Do(req)
@@ -372,7 +399,7 @@ func (z *ZFSReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				}
 			}()
 		},
-		"decompress",
+		utils.DecompressMode(compression),
 	)
 
 	log.Printf("[ZFSReceiver:%s] about to start consuming prelude on %v", z.filesystem, pipeReader)
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+)
+
+func Test_replicationStatus(t *testing.T) {
+	now := time.Now()
+	snap := func(id string, age time.Duration) *types.Snapshot {
+		return &types.Snapshot{Id: id, Metadata: map[string]string{
+			"timestamp": strconv.FormatInt(now.Add(-age).UnixNano(), 10),
+		}}
+	}
+	a, b, c := snap("a", time.Hour), snap("b", 10*time.Minute), snap("c", time.Second)
+	predicted := map[string]string{}
+	predict := func(from, to string) (int64, error) {
+		predicted[from] = to
+		return 100, nil
+	}
+
+	status, err := replicationStatus("node1", map[string][]*types.Snapshot{
+		"node1": {a, b, c},
+		"node2": {a, b, c},
+		"node3": {a, b},
+		"node4": {a},
+		"node5": {},
+	}, now, predict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.MasterNode != "node1" || len(status.Replicas) != 4 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	expected := []struct {
+		node    string
+		behind  int
+		bytes   int64
+		healthy bool
+		synced  *types.Snapshot
+	}{
+		{"node2", 0, 0, true, c},
+		{"node3", 1, 100, true, b},
+		{"node4", 2, 100, false, a},
+		{"node5", 3, 100, false, nil},
+	}
+	for i, e := range expected {
+		got := status.Replicas[i]
+		if got.Node != e.node || got.CommitsBehind != e.behind || got.BytesBehind != e.bytes || got.Healthy != e.healthy {
+			t.Errorf("expected %+v, got %+v", e, got)
+		}
+		if e.synced == nil && !got.LastSyncAt.IsZero() {
+			t.Errorf("expected %s never to have synced, got %s", e.node, got.LastSyncAt)
+		}
+		if e.synced != nil && !got.LastSyncAt.Equal(snapshotTime(e.synced)) {
+			t.Errorf("expected %s to have synced at %s, got %s", e.node, snapshotTime(e.synced), got.LastSyncAt)
+		}
+	}
+	if predicted["b"] != "c" || predicted["a"] != "c" || predicted[""] != "c" {
+		t.Errorf("unexpected predictions %v", predicted)
+	}
+
+	_, err = replicationStatus("node1", map[string][]*types.Snapshot{
+		"node1": {a},
+		"node2": {},
+	}, now, func(from, to string) (int64, error) {
+		return 0, fmt.Errorf("no zfs")
+	})
+	if err == nil {
+		t.Errorf("expected a prediction error to be returned")
+	}
+}
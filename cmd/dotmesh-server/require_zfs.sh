@@ -47,7 +47,9 @@ POOL=${USE_POOL_NAME:-pool}
 POOL=$(echo $POOL |sed s/\#HOSTNAME\#/$HOSTNAME/)
 DOTMESH_INNER_SERVER_NAME=${DOTMESH_INNER_SERVER_NAME:-dotmesh-server-inner}
 FLEXVOLUME_DRIVER_DIR=${FLEXVOLUME_DRIVER_DIR:-/usr/libexec/kubernetes/kubelet-plugins/volume/exec}
-INHERIT_ENVIRONMENT_NAMES=( "DOTMESH_SERVER_PORT" "FILESYSTEM_METADATA_TIMEOUT" "DOTMESH_UPGRADES_URL" "DOTMESH_UPGRADES_INTERVAL_SECONDS" "NATS_URL" "NATS_USERNAME" "NATS_PASSWORD" "NATS_SUBJECT_PREFIX" "DOTMESH_STORAGE" "DOTMESH_BOLTDB_PATH" "EXTERNAL_USER_MANAGER_URL" "DISABLE_DIRTY_POLLING" "POLL_DIRTY_SUCCESS_TIMEOUT" "POLL_DIRTY_ERROR_TIMEOUT")
+INHERIT_ENVIRONMENT_NAMES=( "DOTMESH_SERVER_PORT" "FILESYSTEM_METADATA_TIMEOUT" "DOTMESH_UPGRADES_URL" "DOTMESH_UPGRADES_INTERVAL_SECONDS" "NATS_URL" "NATS_USERNAME" "NATS_PASSWORD" "NATS_SUBJECT_PREFIX" "DOTMESH_STORAGE" "DOTMESH_BOLTDB_PATH" "EXTERNAL_USER_MANAGER_URL" "DISABLE_DIRTY_POLLING" "POLL_DIRTY_SUCCESS_TIMEOUT" "POLL_DIRTY_ERROR_TIMEOUT" "HTTP_PROXY" "HTTPS_PROXY" "NO_PROXY" "DOTMESH_RPC_RATE_LIMIT_REQUESTS_PER_SECOND" "DOTMESH_RPC_RATE_LIMIT_BURST" "DOTMESH_ETCD_TLS_CERT_FILE" "DOTMESH_ETCD_TLS_KEY_FILE" "DOTMESH_ETCD_TLS_CA_FILE")
+# the operator names the variables from its pod.extraEnv setting here
+INHERIT_ENVIRONMENT_NAMES+=( $EXTRA_INHERIT_ENVIRONMENT_NAMES )
 
 if [ $POOL_SIZE = AUTO ]
 then
@@ -260,9 +262,9 @@ rm -f /run/docker/plugins/dm.sock
 ###done
 
 # Clear away old running server if running
-docker rm -f dotmesh-server-inner || true
+docker rm -f $DOTMESH_INNER_SERVER_NAME || true
 
-echo "Starting the 'real' dotmesh-server in a sub-container. Go check 'docker logs dotmesh-server-inner' if you're looking for dotmesh logs."
+echo "Starting the 'real' dotmesh-server in a sub-container. Go check 'docker logs $DOTMESH_INNER_SERVER_NAME' if you're looking for dotmesh logs."
 
 log_opts=""
 rm_opt=""
@@ -283,6 +285,22 @@ if [ "$PKI_PATH" != "" ]; then
     pki_volume_mount="-v $PKI_PATH:/pki"
 fi
 
+# The etcd TLS files are mounted into this container, and the inner server
+# can't see them there, so copy them into the working directory - which it
+# can see, at $OUTER_DIR - and point it at the copies.
+if [ -n "$DOTMESH_ETCD_TLS_CERT_FILE" ]; then
+    mkdir -p $DIR/etcd-tls
+    chmod 700 $DIR/etcd-tls
+    for name in DOTMESH_ETCD_TLS_CERT_FILE DOTMESH_ETCD_TLS_KEY_FILE DOTMESH_ETCD_TLS_CA_FILE
+    do
+        file=$(eval "echo \$$name")
+        if [ -n "$file" ]; then
+            cp "$file" $DIR/etcd-tls/
+            export $name=$OUTER_DIR/etcd-tls/$(basename "$file")
+        fi
+    done
+fi
+
 PORT=${DOTMESH_SERVER_PORT:-32607}
 net="-p ${PORT}:${PORT} -p 32608:32608 -p 32609:32609 -p 32610:32610 -p 32611:32611"
 if [ ! -z ${DISABLE_EXPOSED_PORTS+x} ]; then
@@ -359,7 +377,7 @@ done
 # we need the logs from the inner server to be sent to the outer container
 # such that k8s will pick them up from the pod - the inner container is not
 # a pod but a container run from /var/run/docker.sock
-(while true; do docker logs -f dotmesh-server-inner || true; sleep 1; done) &
+(while true; do docker logs -f $DOTMESH_INNER_SERVER_NAME || true; sleep 1; done) &
 
 set +e
 
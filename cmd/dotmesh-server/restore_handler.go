@@ -0,0 +1,314 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	uuid "github.com/nu7hatch/gouuid"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	"github.com/dotmesh-io/dotmesh/pkg/auth"
+	"github.com/dotmesh-io/dotmesh/pkg/store"
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+)
+
+// how many records RestoreHandler imports at a time
+const restoreBatchSize = 100
+
+// RestoreHandler restores the users (except admin) and registry from a backup
+// POSTed to it as newline-delimited JSON types.BackupRecords, the format of
+// the backup file, importing them a batch at a time as they arrive rather
+// than holding the whole backup in memory as the RestoreEtcd RPC does. The
+// first record has to be the backup's version. A bad record part way through
+// ends the restore there, with the batches before it already imported. Only
+// the admin user can restore backups.
+type RestoreHandler struct {
+	state *InMemoryState
+}
+
+func NewRestoreHandler(state *InMemoryState) http.Handler {
+	return &RestoreHandler{
+		state: state,
+	}
+}
+
+func (s *RestoreHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	err := ensureAdminUser(req)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	var first types.BackupRecord
+	err = decoder.Decode(&first)
+	if err != nil {
+		http.Error(resp, fmt.Sprintf("failed to read the backup: %s", err), http.StatusBadRequest)
+		return
+	}
+	var header types.BackupV1
+	if first.Key != "version" {
+		http.Error(resp, "the backup doesn't start with its version", http.StatusBadRequest)
+		return
+	}
+	err = header.Add(first)
+	if err == nil {
+		err = checkBackupVersion(header.Version)
+	}
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.state.resetClusterRegistry()
+	restorer := newBackupRestorer(s.state)
+	defer func() {
+		s.audit(req, err)
+	}()
+
+	batch := &types.BackupV1{}
+	inBatch := 0
+	records := 1
+	for {
+		var record types.BackupRecord
+		err = decoder.Decode(&record)
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			err = batch.Add(record)
+		}
+		if err != nil {
+			restorer.importBatch(batch)
+			err = fmt.Errorf("failed to read record %d of the backup, the ones before it have been restored: %s", records+1, err)
+			http.Error(resp, err.Error(), http.StatusBadRequest)
+			return
+		}
+		records++
+		inBatch++
+		if inBatch == restoreBatchSize {
+			restorer.importBatch(batch)
+			batch = &types.BackupV1{}
+			inBatch = 0
+		}
+	}
+	restorer.importBatch(batch)
+
+	err = restorer.finish()
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.WithField("records", records).Info("[RestoreHandler] restored backup")
+	resp.WriteHeader(http.StatusOK)
+}
+
+// audit writes the restore to the audit log, as the RestoreEtcd RPC is.
+func (s *RestoreHandler) audit(req *http.Request, err error) {
+	if s.state.auditStore == nil {
+		return
+	}
+	event := types.AuditEvent{
+		Timestamp:  time.Now().UTC(),
+		Operation:  "DotmeshRPC.RestoreEtcd",
+		RemoteAddr: req.RemoteAddr,
+		Success:    err == nil,
+		Details:    map[string]string{"streamed": "true"},
+	}
+	if u := auth.GetUser(req); u != nil {
+		event.User = u.Name
+	}
+	if err != nil {
+		event.Details["error"] = err.Error()
+	}
+	err = s.state.auditStore.AppendAuditEvent(&event)
+	if err != nil {
+		log.WithError(err).Error("[RestoreHandler] failed to write audit event")
+	}
+}
+
+// checkBackupVersion returns an error if a backup of version can't be
+// restored.
+func checkBackupVersion(version string) error {
+	for _, v := range types.BackupSupportedVersions {
+		if version == v {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported backup version '%s', supported version: %s", version, strings.Join(types.BackupSupportedVersions, ", "))
+}
+
+// backupRestorer imports a backup a batch of records at a time. The first
+// batch with any of a registry list's records in replaces what's there, and
+// finish empties the lists that had none, so the restored registry is just
+// what was in the backup.
+type backupRestorer struct {
+	state    *InMemoryState
+	replaced map[string]bool
+	errs     []error
+}
+
+func newBackupRestorer(state *InMemoryState) *backupRestorer {
+	return &backupRestorer{
+		state:    state,
+		replaced: map[string]bool{},
+	}
+}
+
+func (b *backupRestorer) importBatch(batch *types.BackupV1) {
+	for _, u := range batch.Users {
+		err := b.state.userManager.Import(u)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"user":  u.Name,
+			}).Error("failed to import user")
+			b.errs = append(b.errs, err)
+		}
+	}
+	if len(batch.FilesystemMasters) > 0 {
+		b.importMasters(batch.FilesystemMasters)
+	}
+	if len(batch.RegistryFilesystems) > 0 {
+		b.importFilesystems(batch.RegistryFilesystems)
+	}
+	if len(batch.RegistryClones) > 0 {
+		b.importClones(batch.RegistryClones)
+	}
+}
+
+func (b *backupRestorer) importMasters(masters []*types.FilesystemMaster) {
+	err := b.state.filesystemStore.ImportMasters(masters, b.importOptions("filesystem_masters"))
+	if err != nil {
+		b.errs = append(b.errs, err)
+	}
+}
+
+func (b *backupRestorer) importFilesystems(filesystems []*types.RegistryFilesystem) {
+	err := b.state.registryStore.ImportFilesystems(filesystems, b.importOptions("registry_filesystems"))
+	if err != nil {
+		b.errs = append(b.errs, err)
+	}
+}
+
+func (b *backupRestorer) importClones(clones []*types.Clone) {
+	err := b.state.registryStore.ImportClones(clones, b.importOptions("registry_clones"))
+	if err != nil {
+		b.errs = append(b.errs, err)
+	}
+}
+
+// importOptions deletes what's there the first time a list is imported.
+func (b *backupRestorer) importOptions(key string) *store.ImportOptions {
+	opts := &store.ImportOptions{DeleteExisting: !b.replaced[key]}
+	b.replaced[key] = true
+	return opts
+}
+
+// finish empties the registry lists that weren't in the backup, and returns
+// an error if anything failed to import.
+func (b *backupRestorer) finish() error {
+	if !b.replaced["filesystem_masters"] {
+		b.importMasters([]*types.FilesystemMaster{})
+	}
+	if !b.replaced["registry_filesystems"] {
+		b.importFilesystems([]*types.RegistryFilesystem{})
+	}
+	if !b.replaced["registry_clones"] {
+		b.importClones([]*types.Clone{})
+	}
+	if len(b.errs) > 0 {
+		return fmt.Errorf("got error while importing backup: %v", b.errs)
+	}
+	return nil
+}
+
+// resetClusterRegistry resets the registry of every server in the cluster,
+// ahead of restoring a backup, waiting a few seconds for them all to say
+// they've done it.
+func (s *InMemoryState) resetClusterRegistry() {
+	eventID, _ := uuid.NewV4()
+	resetEvent := types.NewEvent(types.EventNameResetRegistry)
+	resetEvent.ID = eventID.String()
+
+	clusterResetComplete := make(chan struct{})
+	counter := 0
+
+	// servers
+	servers, err := s.serverStore.ListAddresses()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("[RestoreEtcd] failed to list server addresses")
+	}
+	if len(servers) == 1 {
+		// only us, don't bother with cluster reset
+		s.resetRegistry()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ch, err := s.messenger.Subscribe(ctx, &types.SubscribeQuery{
+		Type:      types.EventTypeClusterResponse,
+		RequestID: resetEvent.ID,
+	})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("[RestoreEtcd] failed to subscribe to cluster events")
+		close(clusterResetComplete)
+	} else {
+		go func() {
+			defer close(clusterResetComplete)
+
+			// creating new ctx to wait for the acks
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			for {
+				select {
+				case <-ctx.Done():
+					// timeout
+					log.WithFields(log.Fields{
+						"servers":  len(servers),
+						"received": counter,
+					}).Info("[RestoreEtcd] some registry reset acks were missed, continuing with restore...")
+					return
+				case event, ok := <-ch:
+					if !ok {
+						log.WithFields(log.Fields{
+							"servers":  len(servers),
+							"received": counter,
+						}).Info("[RestoreEtcd] registry reset ack listener closed")
+						return
+					}
+					if event.ID == resetEvent.ID && event.Name == types.EventNameResetRegistryComplete {
+						counter++
+					}
+					if counter >= len(servers) {
+
+						log.WithFields(log.Fields{
+							"servers": len(servers),
+						}).Info("[RestoreEtcd] all registry reset acks received")
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	err = s.messenger.Publish(resetEvent)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("[RestoreEtcd] failed to dispatch reset registry event")
+	} else {
+		log.Info("[RestoreEtcd] cluster registry reset event dispatched, waiting for responses...")
+		<-clusterResetComplete
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/dotmesh-io/dotmesh/pkg/store"
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+	"github.com/dotmesh-io/dotmesh/pkg/user"
+)
+
+func TestBackupRestorerBatches(t *testing.T) {
+	client, err := store.NewKVDBClient(&store.KVDBConfig{
+		Type: store.KVTypeMem,
+	})
+	if err != nil {
+		t.Fatalf("failed to init kv store: %s", err)
+	}
+	kv := store.NewKVDBFilesystemStore(client)
+	state := &InMemoryState{
+		userManager:     user.NewInternal(store.NewKVDBStoreWithIndex(client, "users")),
+		filesystemStore: kv,
+		registryStore:   kv,
+	}
+
+	// what's there before is replaced, even for lists the backup has
+	// nothing in
+	err = kv.SetMaster(&types.FilesystemMaster{FilesystemID: "old", NodeID: "node"}, &store.SetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = kv.SetClone(&types.Clone{TopLevelFilesystemId: "old", Name: "branch", FilesystemId: "old-branch"}, &store.SetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restorer := newBackupRestorer(state)
+	restorer.importBatch(&types.BackupV1{
+		FilesystemMasters: []*types.FilesystemMaster{{FilesystemID: "a", NodeID: "node"}},
+	})
+	restorer.importBatch(&types.BackupV1{
+		FilesystemMasters: []*types.FilesystemMaster{{FilesystemID: "b", NodeID: "node"}},
+	})
+	err = restorer.finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	masters, err := kv.ListMaster()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, m := range masters {
+		ids = append(ids, m.FilesystemID)
+	}
+	sort.Strings(ids)
+	if len(ids) != 2 || ids[0] != "a" || ids[1] != "b" {
+		t.Errorf("expected the masters of both batches and no others, got %v", ids)
+	}
+
+	clones, err := kv.ListClones()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clones) != 0 {
+		t.Errorf("expected the clones to have been emptied, got %d", len(clones))
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/dotmesh-io/dotmesh/pkg/store"
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// A branch's retention policy prunes its commits beyond the newest MaxCount,
+// and those older than MaxAgeDays, sparing tagged ones if KeepTagged is set.
+// Every node enforces the policies of the branches it's the master for, every
+// RetentionPolicies.Interval. A policy is never allowed to prune every commit
+// of a branch: SetRetentionPolicy refuses such a policy, and enforcing one
+// that's come to do so as its commits have aged keeps the newest commit.
+
+// commitsToPrune lists the snapshots, ordered oldest first as they are, that
+// policy prunes at now. tagged is the ids of the snapshots with a tag.
+func commitsToPrune(snapshots []Snapshot, tagged map[string]bool, policy types.RetentionPolicy, now time.Time) ([]Snapshot, error) {
+	prune := policyPrunes(snapshots, tagged, policy, now)
+	if len(snapshots) > 0 && len(prune) == len(snapshots) {
+		return nil, types.NewAPIError(types.ErrCodeWouldDeleteAll, "The retention policy would delete all %d commits", len(snapshots))
+	}
+	return prune, nil
+}
+
+// commitsToPruneKeepingNewest is like commitsToPrune, but if policy would
+// prune every snapshot it spares the newest rather than refusing.
+func commitsToPruneKeepingNewest(snapshots []Snapshot, tagged map[string]bool, policy types.RetentionPolicy, now time.Time) []Snapshot {
+	prune := policyPrunes(snapshots, tagged, policy, now)
+	if len(snapshots) > 0 && len(prune) == len(snapshots) {
+		return prune[:len(prune)-1]
+	}
+	return prune
+}
+
+// policyPrunes is every snapshot policy prunes, even if that's all of them.
+func policyPrunes(snapshots []Snapshot, tagged map[string]bool, policy types.RetentionPolicy, now time.Time) []Snapshot {
+	oldest := now.AddDate(0, 0, -policy.MaxAgeDays)
+	prune := []Snapshot{}
+	for i, snapshot := range snapshots {
+		if policy.KeepTagged && tagged[snapshot.Id] {
+			continue
+		}
+		tooMany := policy.MaxCount > 0 && i < len(snapshots)-policy.MaxCount
+		// snapshots without a timestamp are of unknown age, and so kept
+		taken := snapshotTime(&snapshot)
+		tooOld := policy.MaxAgeDays > 0 && !taken.IsZero() && taken.Before(oldest)
+		if tooMany || tooOld {
+			prune = append(prune, snapshot)
+		}
+	}
+	return prune
+}
+
+// taggedCommits is the ids of the commits of a branch that have a tag.
+func (s *InMemoryState) taggedCommits(filesystemId string) (map[string]bool, error) {
+	tagged := map[string]bool{}
+	ft, err := s.filesystemStore.GetTags(filesystemId)
+	if err != nil {
+		if store.IsKeyNotFound(err) {
+			return tagged, nil
+		}
+		return nil, err
+	}
+	for _, commitId := range ft.Tags {
+		tagged[commitId] = true
+	}
+	return tagged, nil
+}
+
+// branchCommitsToPrune is what policy prunes of a branch's commits now.
+func (s *InMemoryState) branchCommitsToPrune(filesystemId string, policy types.RetentionPolicy) ([]Snapshot, error) {
+	snapshots, tagged, err := s.branchCommits(filesystemId)
+	if err != nil {
+		return nil, err
+	}
+	return commitsToPrune(snapshots, tagged, policy, time.Now())
+}
+
+// branchCommits is a branch's commits, and the ids of those with a tag.
+func (s *InMemoryState) branchCommits(filesystemId string) ([]Snapshot, map[string]bool, error) {
+	snapshots, err := s.SnapshotsForCurrentMaster(filesystemId)
+	if err != nil {
+		return nil, nil, err
+	}
+	tagged, err := s.taggedCommits(filesystemId)
+	if err != nil {
+		return nil, nil, err
+	}
+	return snapshots, tagged, nil
+}
+
+// Prune the commits of the branches this node is the master for, as their
+// retention policies say.
+func (s *InMemoryState) enforceRetentionPolicies() error {
+	policies, err := s.filesystemStore.ListRetentionPolicies()
+	if err != nil {
+		if store.IsKeyNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, rp := range policies {
+		master, err := s.registry.CurrentMasterNode(rp.FilesystemID)
+		if err != nil || master != s.NodeID() {
+			continue
+		}
+
+		err = s.enforceRetentionPolicy(rp)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":         err,
+				"filesystem_id": rp.FilesystemID,
+			}).Error("[enforceRetentionPolicies] failed to enforce retention policy")
+		}
+	}
+	return nil
+}
+
+func (s *InMemoryState) enforceRetentionPolicy(rp *types.FilesystemRetentionPolicy) error {
+	snapshots, tagged, err := s.branchCommits(rp.FilesystemID)
+	if err != nil {
+		return err
+	}
+	prune := commitsToPruneKeepingNewest(snapshots, tagged, rp.Policy, time.Now())
+	if len(prune) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(prune))
+	for i, snapshot := range prune {
+		ids[i] = snapshot.Id
+	}
+	responseChan, err := s.globalFsRequest(rp.FilesystemID, &Event{
+		Name: "prune-snapshots",
+		Args: &EventArgs{"snapshotIds": strings.Join(ids, ",")},
+	})
+	if err != nil {
+		return err
+	}
+	e := <-responseChan
+	if e.Name != "pruned" {
+		return maybeError(e, "pruned")
+	}
+	log.WithFields(log.Fields{
+		"filesystem_id": rp.FilesystemID,
+		"count":         (*e.Args)["count"],
+	}).Info("[enforceRetentionPolicy] pruned commits")
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+)
+
+func Test_commitsToPrune(t *testing.T) {
+	now := time.Unix(0, 0).AddDate(0, 0, 30)
+	commit := func(id string, daysOld int) Snapshot {
+		taken := now.AddDate(0, 0, -daysOld).UnixNano()
+		return Snapshot{Id: id, Metadata: map[string]string{"timestamp": strconv.FormatInt(taken, 10)}}
+	}
+	snapshots := []Snapshot{commit("c1", 20), commit("c2", 10), {Id: "c3"}, commit("c4", 1)}
+	tagged := map[string]bool{"c1": true}
+
+	ids := func(policy types.RetentionPolicy) []string {
+		prune, err := commitsToPrune(snapshots, tagged, policy, now)
+		if err != nil {
+			t.Fatalf("unexpected error for %+v: %s", policy, err)
+		}
+		result := []string{}
+		for _, snapshot := range prune {
+			result = append(result, snapshot.Id)
+		}
+		return result
+	}
+	for _, test := range []struct {
+		policy   types.RetentionPolicy
+		expected []string
+	}{
+		{types.RetentionPolicy{MaxCount: 2}, []string{"c1", "c2"}},
+		{types.RetentionPolicy{MaxCount: 2, KeepTagged: true}, []string{"c2"}},
+		{types.RetentionPolicy{MaxAgeDays: 5}, []string{"c1", "c2"}},
+		{types.RetentionPolicy{MaxCount: 3, MaxAgeDays: 15}, []string{"c1"}},
+		{types.RetentionPolicy{MaxCount: 10}, []string{}},
+	} {
+		got := ids(test.policy)
+		if len(got) != len(test.expected) {
+			t.Errorf("expected %+v to prune %v, got %v", test.policy, test.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.expected[i] {
+				t.Errorf("expected %+v to prune %v, got %v", test.policy, test.expected, got)
+				break
+			}
+		}
+	}
+
+	_, err := commitsToPrune(snapshots[:2], nil, types.RetentionPolicy{MaxAgeDays: 5}, now)
+	if apiErr, ok := err.(*types.APIError); !ok || apiErr.Code != types.ErrCodeWouldDeleteAll {
+		t.Errorf("expected a WOULD_DELETE_ALL error, got %#v", err)
+	}
+
+	// enforcement keeps the newest instead, and then leaves it be
+	prune := commitsToPruneKeepingNewest(snapshots[:2], nil, types.RetentionPolicy{MaxAgeDays: 5}, now)
+	if len(prune) != 1 || prune[0].Id != "c1" {
+		t.Errorf("expected only c1 to be pruned, got %+v", prune)
+	}
+	prune = commitsToPruneKeepingNewest(snapshots[1:2], nil, types.RetentionPolicy{MaxAgeDays: 5}, now)
+	if len(prune) != 0 {
+		t.Errorf("expected the last commit to be kept, got %+v", prune)
+	}
+}
@@ -4,9 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/dotmesh-io/dotmesh/pkg/container"
@@ -20,6 +23,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	uuid "github.com/nu7hatch/gouuid"
+	"github.com/robfig/cron/v3"
 	"golang.org/x/net/context"
 
 	"github.com/dotmesh-io/dotmesh/pkg/auth"
@@ -115,6 +119,10 @@ func (d *DotmeshRPC) Procure(
 	if err != nil {
 		return err
 	}
+	err = d.ensureVolumeAccess(r, filesystemId, types.PermWrite)
+	if err != nil {
+		return err
+	}
 	mountpoint, err := newContainerMountSymlink(vn, filesystemId, args.Subdot)
 	*result = mountpoint
 	return err
@@ -201,6 +209,62 @@ func (d *DotmeshRPC) GetApiKey(r *http.Request, args *struct{}, result *struct{
 	return nil
 }
 
+// RotateAPIKey is ResetApiKey for callers that only have their current API
+// key, such as long-running clients rotating it on a schedule. The old key
+// stops working immediately.
+func (d *DotmeshRPC) RotateAPIKey(r *http.Request, args *struct{}, result *struct{ ApiKey string }) error {
+	user := auth.GetUser(r)
+	if user == nil {
+		return fmt.Errorf("user not found in the request ctx")
+	}
+
+	updated, err := d.usersManager.ResetAPIKey(user.Id)
+	if err != nil {
+		return err
+	}
+
+	result.ApiKey = updated.ApiKey
+	return nil
+}
+
+// RotateAPIKeyForUser lets the admin user rotate anyone's API key, e.g. one
+// that has leaked.
+func (d *DotmeshRPC) RotateAPIKeyForUser(r *http.Request, args *struct{ Username string }, result *struct{ ApiKey string }) error {
+	err := ensureAdminUser(r)
+	if err != nil {
+		return err
+	}
+
+	u, err := d.usersManager.Get(&user.Query{Ref: args.Username})
+	if err != nil {
+		return fmt.Errorf("Unable to find user %s: %s", args.Username, err)
+	}
+
+	updated, err := d.usersManager.ResetAPIKey(u.Id)
+	if err != nil {
+		return err
+	}
+
+	result.ApiKey = updated.ApiKey
+	return nil
+}
+
+// ExchangeOIDCToken gives a user who has authenticated with an OIDC ID token
+// their username and API key, for dm to use from then on.
+func (d *DotmeshRPC) ExchangeOIDCToken(r *http.Request, args *struct{}, result *struct{ User, ApiKey string }) error {
+	if auth.GetAuthenticationType(r) != user.AuthenticationTypeOIDC {
+		return fmt.Errorf("ExchangeOIDCToken must be called with an OIDC ID token as a bearer token.")
+	}
+	u := auth.GetUser(r)
+	if u == nil {
+		return fmt.Errorf("user not found in the request ctx")
+	}
+
+	result.User = u.Name
+	result.ApiKey = u.ApiKey
+	return nil
+}
+
 // the user must have authenticated correctly with their old password in order
 // to run this method
 func (d *DotmeshRPC) UpdatePassword(r *http.Request, args *struct{ NewPassword string }, result *SafeUser) error {
@@ -458,8 +522,16 @@ func (d *DotmeshRPC) List(
 		return err
 	}
 
+	softDeleted, err := d.state.softDeletedFilesystemIds()
+	if err != nil {
+		return err
+	}
+
 	gather := map[string]map[string]DotmeshVolume{}
 	for _, v := range volumes {
+		if _, ok := softDeleted[v.Id]; ok {
+			continue
+		}
 		// Just get top-level filesystems
 		if v.Branch == "" {
 			submap, ok := gather[v.Name.Namespace]
@@ -476,6 +548,39 @@ func (d *DotmeshRPC) List(
 	return nil
 }
 
+// ListWithStats is List, with the space each volume uses.
+func (d *DotmeshRPC) ListWithStats(
+	r *http.Request, args *struct{}, result *map[string]map[string]types.DotmeshVolumeWithStats) error {
+
+	var volumes map[string]map[string]DotmeshVolume
+	err := d.List(r, args, &volumes)
+	if err != nil {
+		return err
+	}
+
+	d.state.globalDirtyCacheLock.RLock()
+	defer d.state.globalDirtyCacheLock.RUnlock()
+
+	gather := map[string]map[string]types.DotmeshVolumeWithStats{}
+	for namespace, byName := range volumes {
+		submap := map[string]types.DotmeshVolumeWithStats{}
+		for name, v := range byName {
+			// not there yet is just 0
+			dirty := d.state.globalDirtyCache[v.Id]
+			submap[name] = types.DotmeshVolumeWithStats{
+				DotmeshVolume:   v,
+				LogicalBytes:    dirty.LogicalBytes,
+				CompressedBytes: dirty.CompressedBytes,
+				CommitCount:     int(v.CommitCount),
+			}
+		}
+		gather[namespace] = submap
+	}
+
+	*result = gather
+	return nil
+}
+
 // List all filesystems in the cluster.
 func (d *DotmeshRPC) ListWithContainers(
 	r *http.Request, args *struct{}, result *map[string]map[string]DotmeshVolumeAndContainers) error {
@@ -485,8 +590,16 @@ func (d *DotmeshRPC) ListWithContainers(
 		return err
 	}
 
+	softDeleted, err := d.state.softDeletedFilesystemIds()
+	if err != nil {
+		return err
+	}
+
 	gather := map[string]map[string]DotmeshVolumeAndContainers{}
 	for _, v := range volumes {
+		if _, ok := softDeleted[v.Id]; ok {
+			continue
+		}
 		// Just get top-level filesystems
 		if v.Branch == "" {
 			var containers []container.DockerContainer
@@ -517,7 +630,7 @@ func (d *DotmeshRPC) ListWithContainers(
 func (d *DotmeshRPC) Create(
 	r *http.Request, filesystemName *VolumeName, result *bool) error {
 
-	err := validator.IsValidVolume(filesystemName.Namespace, filesystemName.Name)
+	err := validator.IsValidNewVolume(filesystemName.Namespace, filesystemName.Name)
 	if err != nil {
 		return err
 	}
@@ -600,6 +713,156 @@ func (d *DotmeshRPC) SwitchContainers(
 	return err
 }
 
+// GetMountPoints maps the name of each branch of a volume that is mounted on
+// this node to where it's mounted.
+func (d *DotmeshRPC) GetMountPoints(r *http.Request, args *VolumeName, result *map[string]string) error {
+	err := validator.IsValidVolume(args.Namespace, args.Name)
+	if err != nil {
+		return err
+	}
+	tlf, err := d.state.registry.LookupFilesystem(*args)
+	if err != nil {
+		return err
+	}
+	err = d.ensureVolumeAccess(r, tlf.MasterBranch.Id, types.PermRead)
+	if err != nil {
+		return err
+	}
+
+	branches := map[string]string{DEFAULT_BRANCH: tlf.MasterBranch.Id}
+	for name, clone := range d.state.registry.ClonesFor(tlf.MasterBranch.Id) {
+		branches[name] = clone.FilesystemId
+	}
+
+	mountPoints := map[string]string{}
+	for branch, filesystemId := range branches {
+		fsMachine, err := d.state.GetFilesystemMachine(filesystemId)
+		if err != nil || !fsMachine.Mounted() {
+			continue
+		}
+		mountPoints[branch] = mnt(filesystemId)
+	}
+	*result = mountPoints
+	return nil
+}
+
+// GetNodeForVolume returns the node that holds the master copy of a volume's
+// master branch, where it's mounted and can be written to.
+func (d *DotmeshRPC) GetNodeForVolume(r *http.Request, args *VolumeName, result *string) error {
+	err := validator.IsValidVolume(args.Namespace, args.Name)
+	if err != nil {
+		return err
+	}
+	filesystemId, err := d.state.registry.IdFromName(*args)
+	if err != nil {
+		return err
+	}
+	err = d.ensureVolumeAccess(r, filesystemId, types.PermRead)
+	if err != nil {
+		return err
+	}
+	node, ok := d.state.registry.GetMasterNode(filesystemId)
+	if !ok {
+		return fmt.Errorf("No node holds the master copy of %s/%s yet", args.Namespace, args.Name)
+	}
+	*result = node
+	return nil
+}
+
+// GetAllVolumeLocations maps the filesystem id of every volume and branch
+// the user can read to the node holding its master copy.
+func (d *DotmeshRPC) GetAllVolumeLocations(r *http.Request, args *struct{}, result *map[string]string) error {
+	locations := map[string]string{}
+	for filesystemId, node := range d.state.registry.ListMasterNodes(&registry.ListMasterNodesQuery{}) {
+		if d.ensureVolumeAccess(r, filesystemId, types.PermRead) != nil {
+			continue
+		}
+		locations[filesystemId] = node
+	}
+	*result = locations
+	return nil
+}
+
+// GetForkLineage returns the volume a volume was forked from and the volumes
+// forked from it, as recorded in the registry when they were forked. Volumes
+// the user can't read are left out.
+func (d *DotmeshRPC) GetForkLineage(r *http.Request, args *VolumeName, result *types.ForkLineage) error {
+	err := validator.IsValidVolume(args.Namespace, args.Name)
+	if err != nil {
+		return err
+	}
+	tlf, err := d.state.registry.LookupFilesystem(*args)
+	if err != nil {
+		return err
+	}
+	err = d.ensureVolumeAccess(r, tlf.MasterBranch.Id, types.PermRead)
+	if err != nil {
+		return err
+	}
+
+	lookup := func(filesystemId string) (types.TopLevelFilesystem, error) {
+		tlf, _, err := d.state.registry.LookupFilesystemById(filesystemId)
+		return tlf, err
+	}
+	visible := func(tlf *types.TopLevelFilesystem) bool {
+		authorized, err := d.state.authorizeVolumeAccess(r.Context(), tlf, types.PermRead)
+		return err == nil && authorized
+	}
+	*result = forkLineage(tlf, d.state.registry.DumpTopLevelFilesystems(), lookup, visible)
+	return nil
+}
+
+// forkLineage works out tlf's lineage from all the top level filesystems.
+// Forks record the filesystem id of the branch they were forked from, so
+// lookup finds the volume a filesystem id is a branch of.
+func forkLineage(
+	tlf types.TopLevelFilesystem,
+	tlfs []*types.TopLevelFilesystem,
+	lookup func(filesystemId string) (types.TopLevelFilesystem, error),
+	visible func(*types.TopLevelFilesystem) bool,
+) types.ForkLineage {
+	lineage := types.ForkLineage{
+		Children:     []types.VolumeName{},
+		ForkCommitID: tlf.ForkParentSnapshotId,
+	}
+
+	if tlf.ForkParentId != "" {
+		parent, err := lookup(tlf.ForkParentId)
+		if err == nil && visible(&parent) {
+			name := parent.MasterBranch.Name
+			lineage.Parent = &name
+		}
+	}
+
+	// Count the forks back to an original, even through volumes the user
+	// can't see; seen guards against a (corrupt) cycle
+	seen := map[string]bool{tlf.MasterBranch.Id: true}
+	for ancestor := tlf; ancestor.ForkParentId != ""; {
+		lineage.ForkDepth++
+		parent, err := lookup(ancestor.ForkParentId)
+		if err != nil || seen[parent.MasterBranch.Id] {
+			break
+		}
+		seen[parent.MasterBranch.Id] = true
+		ancestor = parent
+	}
+
+	for _, other := range tlfs {
+		if other.ForkParentId == "" {
+			continue
+		}
+		parent, err := lookup(other.ForkParentId)
+		if err != nil || parent.MasterBranch.Id != tlf.MasterBranch.Id || !visible(other) {
+			continue
+		}
+		lineage.Children = append(lineage.Children, other.MasterBranch.Name)
+	}
+	sort.Slice(lineage.Children, func(i, j int) bool {
+		return lineage.Children[i].String() < lineage.Children[j].String()
+	})
+	return lineage
+}
+
 // Containers that were recently known to be running on a given filesystem.
 func (d *DotmeshRPC) Containers(r *http.Request, args *struct{ Namespace, Name, Branch string }, result *[]container.DockerContainer) error {
 	log.Printf("[Containers] called with %+v", *args)
@@ -636,6 +899,64 @@ func (d *DotmeshRPC) Containers(r *http.Request, args *struct{ Namespace, Name,
 	return nil
 }
 
+// GetContainerMounts lists the volumes a running container, given by its id
+// (or an unambiguous prefix of at least 12 characters) or name, has mounted.
+// Only volumes the caller can read are listed.
+func (d *DotmeshRPC) GetContainerMounts(r *http.Request, containerID *string, result *[]types.ContainerMount) error {
+	id := strings.TrimPrefix(*containerID, "/")
+	if id == "" {
+		return fmt.Errorf("Please give a container id or name")
+	}
+	matches := func(c container.DockerContainer) bool {
+		return c.Id == id || strings.TrimPrefix(c.Name, "/") == id ||
+			(len(id) >= 12 && strings.HasPrefix(c.Id, id))
+	}
+
+	mountsByFilesystem := map[string][]container.DockerMount{}
+	containerIds := map[string]bool{}
+	d.state.globalContainerCacheLock.Lock()
+	for filesystemId, info := range d.state.globalContainerCache {
+		for _, c := range info.Containers {
+			if matches(c) {
+				mountsByFilesystem[filesystemId] = append(mountsByFilesystem[filesystemId], c.Mounts...)
+				containerIds[c.Id] = true
+			}
+		}
+	}
+	d.state.globalContainerCacheLock.Unlock()
+	if len(containerIds) > 1 {
+		return fmt.Errorf("%s matches more than one container, please give its full id", *containerID)
+	}
+
+	mounts := []types.ContainerMount{}
+	for filesystemId, fsMounts := range mountsByFilesystem {
+		if d.ensureVolumeAccess(r, filesystemId, types.PermRead) != nil {
+			continue
+		}
+		tlf, cloneName, err := d.state.registry.LookupFilesystemById(filesystemId)
+		if err != nil {
+			continue
+		}
+		branch := cloneName
+		if branch == "" {
+			branch = DEFAULT_BRANCH
+		}
+		for _, m := range fsMounts {
+			mounts = append(mounts, types.ContainerMount{
+				VolumeName: tlf.MasterBranch.Name,
+				Branch:     branch,
+				MountPath:  m.Destination,
+				ReadOnly:   m.ReadOnly,
+			})
+		}
+	}
+	sort.Slice(mounts, func(i, j int) bool {
+		return mounts[i].MountPath < mounts[j].MountPath
+	})
+	*result = mounts
+	return nil
+}
+
 // Containers that were recently known to be running on a given filesystem.
 func (d *DotmeshRPC) ContainersById(
 	r *http.Request,
@@ -675,7 +996,11 @@ func (d *DotmeshRPC) Exists(
 	if err != nil {
 		return err
 	}
-	if deleted {
+	softDeleted, err := d.state.isFilesystemSoftDeleted(fsId)
+	if err != nil {
+		return err
+	}
+	if deleted || softDeleted {
 		*result = ""
 	} else {
 		*result = fsId
@@ -712,7 +1037,11 @@ func (d *DotmeshRPC) Lookup(
 	if err != nil {
 		return err
 	}
-	if deleted {
+	softDeleted, err := d.state.isFilesystemSoftDeleted(filesystemId)
+	if err != nil {
+		return err
+	}
+	if deleted || softDeleted {
 		*result = ""
 	} else {
 		*result = filesystemId
@@ -749,7 +1078,47 @@ func (d *DotmeshRPC) Commits(
 	if err != nil {
 		return err
 	}
-	*result = snapshots
+	*result, err = d.tagSnapshots(filesystemId, snapshots)
+	return err
+}
+
+// Like Commits, but only the commits on the branch that match the query.
+func (d *DotmeshRPC) SearchCommits(
+	r *http.Request,
+	args *types.SearchCommitsRequest,
+	result *[]Snapshot,
+) error {
+	err := validator.IsValidVolume(args.Namespace, args.Name)
+	if err != nil {
+		return err
+	}
+
+	err = validator.IsValidBranchName(args.Branch)
+	if err != nil {
+		return err
+	}
+
+	err = args.Query.Validate()
+	if err != nil {
+		return err
+	}
+
+	filesystemId, err := d.state.registry.MaybeCloneFilesystemId(
+		VolumeName{Namespace: args.Namespace, Name: args.Name},
+		args.Branch,
+	)
+	if err != nil {
+		return err
+	}
+	snapshots, err := d.state.SnapshotsForCurrentMaster(filesystemId)
+	if err != nil {
+		return err
+	}
+	snapshots, err = d.tagSnapshots(filesystemId, snapshots)
+	if err != nil {
+		return err
+	}
+	*result = args.Query.Filter(snapshots)
 	return nil
 }
 
@@ -775,6 +1144,10 @@ func (d *DotmeshRPC) StashAfter(
 	if err != nil {
 		return err
 	}
+	err = d.ensureVolumeAccess(r, args.FilesystemId, types.PermWrite)
+	if err != nil {
+		return err
+	}
 	responseChan, err := d.state.globalFsRequest(
 		args.FilesystemId,
 		&Event{Name: "stash",
@@ -797,12 +1170,63 @@ func (d *DotmeshRPC) StashAfter(
 	return nil
 }
 
+// DiscardAfter rolls a filesystem back to a snapshot, deleting the ones after
+// it, for a forced push from a cluster whose copy has diverged from this one.
+func (d *DotmeshRPC) DiscardAfter(
+	r *http.Request,
+	args *types.StashRequest,
+	result *bool,
+) error {
+	err := validator.IsValidSnapshotName(args.SnapshotId)
+	if err != nil {
+		return err
+	}
+	err = d.ensureVolumeAccess(r, args.FilesystemId, types.PermWrite)
+	if err != nil {
+		return err
+	}
+	responseChan, err := d.state.globalFsRequest(
+		args.FilesystemId,
+		&Event{Name: "rollback",
+			Args: &EventArgs{"rollbackTo": args.SnapshotId}},
+	)
+	if err != nil {
+		return err
+	}
+
+	e := <-responseChan
+	if e.Name != "rolled-back" {
+		return maybeError(e, "rolled-back")
+	}
+	log.Printf("Discarded commits after %s on %s for a forced push", args.SnapshotId, args.FilesystemId)
+	*result = true
+	return nil
+}
+
 // Acknowledge that an authenticated connection had been successfully established.
 func (d *DotmeshRPC) Ping(r *http.Request, args *struct{}, result *bool) error {
 	*result = true
 	return nil
 }
 
+// PingVersion is Ping for clients that also want to know which version of
+// dotmesh the server is running. Unlike Version, any user can call it.
+func (d *DotmeshRPC) PingVersion(r *http.Request, args *struct{}, result *string) error {
+	*result = d.state.versionInfo.InstalledVersion
+	return nil
+}
+
+// Capabilities lists what this server can do that older ones can't, for
+// peers to check before asking for it. Like Ping, any user can call it.
+func (d *DotmeshRPC) Capabilities(r *http.Request, args *struct{}, result *map[string]bool) error {
+	*result = map[string]bool{
+		types.CompressionCapability(types.CompressionGzip): true,
+		types.CompressionCapability(types.CompressionLZ4):  true,
+		types.RestoreStreamCapability:                      true,
+	}
+	return nil
+}
+
 // Take a snapshot of a specific filesystem on the master.
 func (d *DotmeshRPC) Commit(
 	r *http.Request, args *types.CommitArgs,
@@ -844,6 +1268,21 @@ func (d *DotmeshRPC) Commit(
 		return err
 	}
 
+	err = d.ensureVolumeAccess(r, filesystemId, types.PermWrite)
+	if err != nil {
+		return err
+	}
+
+	err = d.state.checkNamespaceQuota(args.Namespace)
+	if err != nil {
+		return err
+	}
+
+	err = d.state.checkVolumeQuota(filesystemId)
+	if err != nil {
+		return err
+	}
+
 	// Prepare snapshot event to send to active master
 	eventArgs := EventArgs{}
 
@@ -893,33 +1332,218 @@ func (d *DotmeshRPC) Commit(
 	return nil
 }
 
-func (d *DotmeshRPC) MountCommit(
+// UpdateCommitMetadata sets and deletes keys in an existing commit's
+// metadata, leaving the rest of it as it was.
+func (d *DotmeshRPC) UpdateCommitMetadata(
 	r *http.Request,
-	args *types.MountCommitRequest,
-	result *string,
+	args *types.UpdateCommitMetadataRequest,
+	result *bool,
 ) error {
-
-	// check that a filesystem with that id exists
-	_, _, err := d.state.registry.LookupFilesystemById(args.FilesystemId)
-
+	err := validator.IsValidVolume(args.Namespace, args.Name)
 	if err != nil {
 		return err
 	}
 
-	snapshots, err := d.state.SnapshotsForCurrentMaster(args.FilesystemId)
+	err = validator.IsValidBranchName(args.Branch)
 	if err != nil {
 		return err
 	}
 
-	foundSnapshot := false
-	for _, snapshot := range snapshots {
-		if snapshot.Id == args.CommitId {
-			foundSnapshot = true
-		}
+	err = args.Validate()
+	if err != nil {
+		return err
 	}
 
-	if !foundSnapshot {
-		return fmt.Errorf("Cannot find commit with id %s for filesystem %s", args.CommitId, args.FilesystemId)
+	filesystemId, err := d.state.registry.MaybeCloneFilesystemId(
+		VolumeName{
+			Namespace: args.Namespace,
+			Name:      args.Name,
+		},
+		args.Branch,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = d.ensureVolumeAccess(r, filesystemId, types.PermWrite)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	responseChan, err := d.state.globalFsRequest(
+		filesystemId,
+		&Event{Name: "update-commit-metadata", Args: &EventArgs{"request": string(encoded)}},
+	)
+	if err != nil {
+		return err
+	}
+
+	e := <-responseChan
+	if e.Name != "commit-metadata-updated" {
+		return maybeError(e, "commit-metadata-updated")
+	}
+	*result = true
+	return nil
+}
+
+// Squash replaces the commits of a branch from FromCommitId to ToCommitId,
+// inclusive, with one commit, which has ToCommitId's data and Message as its
+// message. It's refused if branches have been made from any of the commits,
+// as zfs won't destroy those, and the last is renamed. History is only
+// rewritten on the master node, so it's also refused while any other node
+// has a replica of the branch: those would keep the old commits and could no
+// longer be sent new ones. Delete or move the replicas first. The result is
+// the id of the new commit.
+func (d *DotmeshRPC) Squash(r *http.Request, args *types.SquashRequest, result *string) error {
+	err := validator.IsValidVolume(args.Namespace, args.Name)
+	if err != nil {
+		return err
+	}
+	err = validator.IsValidBranchName(args.Branch)
+	if err != nil {
+		return err
+	}
+	for _, commitId := range []string{args.FromCommitId, args.ToCommitId} {
+		err = validator.IsValidSnapshotName(commitId)
+		if err != nil {
+			return err
+		}
+	}
+	if args.Message == "" {
+		return fmt.Errorf("Please give the squashed commit a message")
+	}
+
+	name := VolumeName{Namespace: args.Namespace, Name: args.Name}
+	filesystemId, err := d.state.registry.MaybeCloneFilesystemId(name, args.Branch)
+	if err != nil {
+		return err
+	}
+	err = d.ensureVolumeAccess(r, filesystemId, types.PermWrite)
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := d.state.SnapshotsForCurrentMaster(filesystemId)
+	if err != nil {
+		return err
+	}
+	from, to := -1, -1
+	for i, snapshot := range snapshots {
+		if snapshot.Id == args.FromCommitId {
+			from = i
+		}
+		if snapshot.Id == args.ToCommitId {
+			to = i
+		}
+	}
+	if from < 0 {
+		return fmt.Errorf("No commit %s on %s/%s", args.FromCommitId, args.Namespace, args.Name)
+	}
+	if to < 0 {
+		return fmt.Errorf("No commit %s on %s/%s", args.ToCommitId, args.Namespace, args.Name)
+	}
+	if from > to {
+		return types.NewAPIError(types.ErrCodeOlderCommit, "Commit %s is newer than commit %s, so can't be squashed into it", args.FromCommitId, args.ToCommitId)
+	}
+
+	squashed := map[string]bool{}
+	for _, snapshot := range snapshots[from : to+1] {
+		squashed[snapshot.Id] = true
+	}
+	err = d.state.checkNoBranchesFrom(filesystemId, squashed)
+	if err != nil {
+		return err
+	}
+
+	// replicas would keep the squashed commits, and could no longer be sent
+	// the master's new ones
+	master, err := d.state.registry.CurrentMasterNode(filesystemId)
+	if err != nil {
+		return err
+	}
+	fsMachine, err := d.state.GetFilesystemMachine(filesystemId)
+	if err != nil {
+		return err
+	}
+	for server, serverSnapshots := range fsMachine.ListSnapshots() {
+		if server != master && len(serverSnapshots) > 0 {
+			return fmt.Errorf("%s/%s has a replica on node %s, so it can't be squashed", args.Namespace, args.Name, server)
+		}
+	}
+
+	responseChan, err := d.state.globalFsRequest(filesystemId, &Event{
+		Name: "squash",
+		Args: &EventArgs{
+			"fromCommitId": args.FromCommitId,
+			"toCommitId":   args.ToCommitId,
+			"message":      args.Message,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	e := <-responseChan
+	if e.Name != "squashed" {
+		return maybeError(e, "squashed")
+	}
+	newCommitId, ok := (*e.Args)["SnapshotId"].(string)
+	if !ok {
+		return fmt.Errorf("interface conversion failed to squashed commit id: %v", (*e.Args)["SnapshotId"])
+	}
+
+	// the squashed commit keeps the last commit's tags
+	ft, err := d.state.filesystemStore.GetTags(filesystemId)
+	if err == nil {
+		moved := false
+		for tag, commitId := range ft.Tags {
+			if commitId == args.ToCommitId {
+				ft.Tags[tag] = newCommitId
+				moved = true
+			}
+		}
+		if moved {
+			err = d.state.filesystemStore.SetTags(ft, &store.SetOptions{Force: true})
+		}
+	}
+	if err != nil && !store.IsKeyNotFound(err) {
+		log.WithError(err).WithField("filesystem_id", filesystemId).Error("[Squash] failed to move tags to the squashed commit")
+		return fmt.Errorf("Squashed the commits into %s, but couldn't move the tags of %s to it: %s", newCommitId, args.ToCommitId, err)
+	}
+
+	*result = newCommitId
+	return nil
+}
+
+func (d *DotmeshRPC) MountCommit(
+	r *http.Request,
+	args *types.MountCommitRequest,
+	result *string,
+) error {
+
+	// check that a filesystem with that id exists, and that we may read it
+	err := d.ensureVolumeAccess(r, args.FilesystemId, types.PermRead)
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := d.state.SnapshotsForCurrentMaster(args.FilesystemId)
+	if err != nil {
+		return err
+	}
+
+	foundSnapshot := false
+	for _, snapshot := range snapshots {
+		if snapshot.Id == args.CommitId {
+			foundSnapshot = true
+		}
+	}
+
+	if !foundSnapshot {
+		return fmt.Errorf("Cannot find commit with id %s for filesystem %s", args.CommitId, args.FilesystemId)
 	}
 
 	responseChan, err := d.state.globalFsRequest(
@@ -944,7 +1568,10 @@ func (d *DotmeshRPC) MountCommit(
 // Rollback a specific filesystem to the specified snapshot_id on the master.
 func (d *DotmeshRPC) Rollback(
 	r *http.Request,
-	args *struct{ Namespace, Name, Branch, SnapshotId string },
+	args *struct {
+		Namespace, Name, Branch, SnapshotId string
+		DryRun                              bool
+	},
 	result *bool,
 ) error {
 	err := ensureAdminUser(r)
@@ -978,6 +1605,20 @@ func (d *DotmeshRPC) Rollback(
 	if err != nil {
 		return err
 	}
+	if args.DryRun {
+		// Check there's something to roll back to, but leave it there.
+		snapshots, err := d.state.SnapshotsForCurrentMaster(filesystemId)
+		if err != nil {
+			return err
+		}
+		for _, snapshot := range snapshots {
+			if snapshot.Id == args.SnapshotId {
+				*result = true
+				return nil
+			}
+		}
+		return fmt.Errorf("No such commit %s on %s/%s@%s", args.SnapshotId, args.Namespace, args.Name, args.Branch)
+	}
 	responseChan, err := d.state.globalFsRequest(
 		filesystemId,
 		&Event{Name: "rollback",
@@ -1034,6 +1675,204 @@ func (d *DotmeshRPC) Branches(r *http.Request, filesystemName *VolumeName, resul
 	return nil
 }
 
+// BranchesWithInfo lists every branch of a volume, master included, with its
+// latest commit. The default branch comes first, then the rest by name.
+func (d *DotmeshRPC) BranchesWithInfo(r *http.Request, volumeName *VolumeName, result *[]types.BranchInfo) error {
+	err := validator.IsValidVolume(volumeName.Namespace, volumeName.Name)
+	if err != nil {
+		return err
+	}
+	filesystemId, err := d.state.registry.IdFromName(*volumeName)
+	if err != nil {
+		return err
+	}
+	err = d.ensureVolumeAccess(r, filesystemId, types.PermRead)
+	if err != nil {
+		return err
+	}
+
+	defaultBranch := DEFAULT_BRANCH
+	db, err := d.state.filesystemStore.GetDefaultBranch(filesystemId)
+	if err == nil {
+		if d.state.registry.Exists(*volumeName, db.Branch) != "" {
+			defaultBranch = db.Branch
+		}
+	} else if !store.IsKeyNotFound(err) {
+		return err
+	}
+
+	branchIds := map[string]string{DEFAULT_BRANCH: filesystemId}
+	for name, clone := range d.state.registry.ClonesFor(filesystemId) {
+		branchIds[name] = clone.FilesystemId
+	}
+	branches := []types.BranchInfo{}
+	for name, branchId := range branchIds {
+		snapshots, err := d.state.SnapshotsForCurrentMaster(branchId)
+		if err != nil {
+			return err
+		}
+		branches = append(branches, branchInfo(name, snapshots, name == defaultBranch))
+	}
+	sort.Slice(branches, func(i, j int) bool {
+		if branches[i].IsDefault != branches[j].IsDefault {
+			return branches[i].IsDefault
+		}
+		return branches[i].Name < branches[j].Name
+	})
+	*result = branches
+	return nil
+}
+
+// branchInfo describes the branch called name with the given commits.
+func branchInfo(name string, snapshots []Snapshot, isDefault bool) types.BranchInfo {
+	info := types.BranchInfo{
+		Name:        name,
+		CommitCount: len(snapshots),
+		IsDefault:   isDefault,
+	}
+	if len(snapshots) > 0 {
+		head := snapshots[len(snapshots)-1]
+		info.HeadCommitID = head.Id
+		info.HeadCommitMessage = head.Metadata["message"]
+		info.HeadCommitAt = snapshotTime(&head)
+	}
+	return info
+}
+
+// ListStashes lists the branches of a volume that hold commits stashed by
+// transfers with StashDivergence, oldest first.
+func (d *DotmeshRPC) ListStashes(r *http.Request, volumeName *VolumeName, result *[]types.StashEntry) error {
+	err := validator.IsValidVolume(volumeName.Namespace, volumeName.Name)
+	if err != nil {
+		return err
+	}
+	filesystemId, err := d.state.registry.IdFromName(*volumeName)
+	if err != nil {
+		return err
+	}
+	err = d.ensureVolumeAccess(r, filesystemId, types.PermRead)
+	if err != nil {
+		return err
+	}
+
+	clones := d.state.registry.ClonesFor(filesystemId)
+	branchNames := map[string]string{filesystemId: "master"}
+	for name, clone := range clones {
+		branchNames[clone.FilesystemId] = name
+	}
+
+	stashes := []types.StashEntry{}
+	for name, clone := range clones {
+		stashedAt, ok := types.ParseStashBranchName(name)
+		if !ok {
+			continue
+		}
+		snapshots, err := d.state.SnapshotsForCurrentMaster(clone.FilesystemId)
+		if err != nil {
+			return err
+		}
+		stashes = append(stashes, types.StashEntry{
+			BranchName:     name,
+			OriginalBranch: branchNames[clone.Origin.FilesystemId],
+			StashedAt:      stashedAt,
+			CommitCount:    len(snapshotsAfter(snapshots, clone.Origin.SnapshotId)),
+		})
+	}
+	sort.Slice(stashes, func(i, j int) bool {
+		if !stashes[i].StashedAt.Equal(stashes[j].StashedAt) {
+			return stashes[i].StashedAt.Before(stashes[j].StashedAt)
+		}
+		return stashes[i].BranchName < stashes[j].BranchName
+	})
+	*result = stashes
+	return nil
+}
+
+// snapshotsAfter returns the snapshots after the one with id, or all of them
+// if it's not there.
+func snapshotsAfter(snapshots []Snapshot, id string) []Snapshot {
+	for i, s := range snapshots {
+		if s.Id == id {
+			return snapshots[i+1:]
+		}
+	}
+	return snapshots
+}
+
+// CompareVolumes works out how far two branches, typically of a volume and
+// one forked from it, have diverged since their latest common commit.
+func (d *DotmeshRPC) CompareVolumes(r *http.Request, args *types.CompareVolumesRequest, result *types.VolumeComparison) error {
+	left, err := d.branchHistory(r, args.Left, args.LeftBranch)
+	if err != nil {
+		return err
+	}
+	right, err := d.branchHistory(r, args.Right, args.RightBranch)
+	if err != nil {
+		return err
+	}
+	*result = types.CompareCommitHistories(left, right)
+	return nil
+}
+
+// branchHistory is the commits on branch of volume that the user can read,
+// oldest first, including those of the branch (or branches) it was made
+// from, up to the commit it was made from.
+func (d *DotmeshRPC) branchHistory(r *http.Request, volume VolumeName, branch string) ([]Snapshot, error) {
+	err := validator.IsValidVolume(volume.Namespace, volume.Name)
+	if err != nil {
+		return nil, err
+	}
+	err = validator.IsValidBranchName(branch)
+	if err != nil {
+		return nil, err
+	}
+	masterId, err := d.state.registry.IdFromName(volume)
+	if err != nil {
+		return nil, err
+	}
+	err = d.ensureVolumeAccess(r, masterId, types.PermRead)
+	if err != nil {
+		return nil, err
+	}
+	filesystemId, err := d.state.registry.MaybeCloneFilesystemId(volume, branch)
+	if err != nil {
+		return nil, err
+	}
+	return d.state.commitHistory(filesystemId)
+}
+
+// commitHistory is the snapshots of filesystemId, after those of its
+// origin, if it's a clone, up to the one it was cloned from.
+func (s *InMemoryState) commitHistory(filesystemId string) ([]Snapshot, error) {
+	snapshots, err := s.SnapshotsForCurrentMaster(filesystemId)
+	if err != nil {
+		return nil, err
+	}
+	clone, err := s.registry.LookupCloneById(filesystemId)
+	if err != nil {
+		// Not a clone, so this is all of it
+		return snapshots, nil
+	}
+	for _, snapshot := range snapshots {
+		if snapshot.Id == clone.Origin.SnapshotId {
+			// The origin's commits are already there
+			return snapshots, nil
+		}
+	}
+	origin, err := s.commitHistory(clone.Origin.FilesystemId)
+	if err != nil {
+		return nil, err
+	}
+	history := []Snapshot{}
+	for _, snapshot := range origin {
+		history = append(history, snapshot)
+		if snapshot.Id == clone.Origin.SnapshotId {
+			break
+		}
+	}
+	return append(history, snapshots...), nil
+}
+
 func (d *DotmeshRPC) Branch(
 	r *http.Request,
 	args *struct{ Namespace, Name, SourceBranch, NewBranchName, SourceCommitId string },
@@ -1069,6 +1908,10 @@ func (d *DotmeshRPC) Branch(
 	if err != nil {
 		return err
 	}
+	err = d.ensureVolumeAccess(r, tlf.MasterBranch.Id, types.PermWrite)
+	if err != nil {
+		return err
+	}
 	var originFilesystemId string
 
 	// find whether branch refers to top-level fs or a clone, by guessing based
@@ -1085,6 +1928,22 @@ func (d *DotmeshRPC) Branch(
 			return err
 		}
 	}
+	newFilesystemId, err := d.cloneBranch(tlf.MasterBranch.Id, originFilesystemId, args.SourceCommitId, args.NewBranchName)
+	if err != nil {
+		return err
+	}
+	log.Printf(
+		"Cloned %s:%s@%s (%s) to %s", args.Name,
+		args.SourceBranch, args.SourceCommitId, originFilesystemId, newFilesystemId,
+	)
+	*result = true
+	return nil
+}
+
+// cloneBranch makes a new branch of the volume whose master branch is
+// topLevelFilesystemId, cloned from originFilesystemId at originSnapshotId,
+// and returns the new branch's filesystem id.
+func (d *DotmeshRPC) cloneBranch(topLevelFilesystemId, originFilesystemId, originSnapshotId, newBranchName string) (string, error) {
 	// target node is responsible for creating registry entry (so that they're
 	// as close as possible to eachother), so give it all the info it needs to
 	// do that.
@@ -1092,47 +1951,108 @@ func (d *DotmeshRPC) Branch(
 		originFilesystemId,
 		&Event{Name: "clone",
 			Args: &EventArgs{
-				"topLevelFilesystemId": tlf.MasterBranch.Id,
+				"topLevelFilesystemId": topLevelFilesystemId,
 				"originFilesystemId":   originFilesystemId,
-				"originSnapshotId":     args.SourceCommitId,
-				"newBranchName":        args.NewBranchName,
+				"originSnapshotId":     originSnapshotId,
+				"newBranchName":        newBranchName,
 			},
 		},
 	)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	// TODO this may never succeed, if the master for it never shows up. maybe
 	// this response should have a timeout associated with it.
 	e := <-responseChan
-	if e.Name == "cloned" {
-		log.Printf(
-			"Cloned %s:%s@%s (%s) to %s", args.Name,
-			args.SourceBranch, args.SourceCommitId, originFilesystemId, (*e.Args)["newFilesystemId"].(string),
-		)
-		*result = true
-	} else {
-		return maybeError(e, "cloned")
+	if e.Name != "cloned" {
+		return "", maybeError(e, "cloned")
 	}
-	return nil
+	return (*e.Args)["newFilesystemId"].(string), nil
 }
 
-// Return local version information.
-func (d *DotmeshRPC) Version(
-	r *http.Request, args *struct{}, result *VersionInfo) error {
-	err := ensureAdminUser(r)
-
+// CopyBranch makes a new branch of a volume with the same commits as an
+// existing one, by cloning the latest commit on it. Uncommitted changes on
+// the source branch aren't copied.
+func (d *DotmeshRPC) CopyBranch(r *http.Request, args *types.CopyBranchRequest, result *string) error {
+	err := validator.IsValidVolume(args.Name.Namespace, args.Name.Name)
 	if err != nil {
 		return err
 	}
+	if args.DestBranch == "" {
+		return fmt.Errorf("Please name the branch to copy %s to", args.SourceBranch)
+	}
+	if args.DestBranch == DEFAULT_BRANCH {
+		return types.NewAPIError(types.ErrCodeConflict, "Branch %s already exists on %s/%s", DEFAULT_BRANCH, args.Name.Namespace, args.Name.Name)
+	}
+	if args.SourceBranch == "" {
+		args.SourceBranch = DEFAULT_BRANCH
+	}
+	for _, branch := range []string{args.SourceBranch, args.DestBranch} {
+		err = validator.IsValidBranchName(branch)
+		if err != nil {
+			return err
+		}
+	}
 
-	*result = *d.state.versionInfo
-	return nil
-}
-
-func (d *DotmeshRPC) registerFilesystemBecomeMaster(
-	ctx context.Context,
+	tlf, err := d.state.registry.LookupFilesystem(args.Name)
+	if err != nil {
+		return err
+	}
+	err = d.ensureVolumeAccess(r, tlf.MasterBranch.Id, types.PermWrite)
+	if err != nil {
+		return err
+	}
+	originFilesystemId := tlf.MasterBranch.Id
+	if args.SourceBranch != DEFAULT_BRANCH {
+		clone, err := d.state.registry.LookupClone(tlf.MasterBranch.Id, args.SourceBranch)
+		if err != nil {
+			return err
+		}
+		originFilesystemId = clone.FilesystemId
+	}
+	if d.state.registry.Exists(args.Name, args.DestBranch) != "" {
+		return types.NewAPIError(types.ErrCodeConflict, "Branch %s already exists on %s/%s", args.DestBranch, args.Name.Namespace, args.Name.Name)
+	}
+
+	snapshots, err := d.state.SnapshotsForCurrentMaster(originFilesystemId)
+	if err != nil {
+		return err
+	}
+	if len(snapshots) == 0 {
+		return fmt.Errorf("Branch %s of %s/%s has no commits to copy", args.SourceBranch, args.Name.Namespace, args.Name.Name)
+	}
+	latest := snapshots[len(snapshots)-1].Id
+
+	newFilesystemId, err := d.cloneBranch(tlf.MasterBranch.Id, originFilesystemId, latest, args.DestBranch)
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"source_branch":     args.SourceBranch,
+		"dest_branch":       args.DestBranch,
+		"commit_id":         latest,
+		"new_filesystem_id": newFilesystemId,
+	}).Info("[CopyBranch] copied branch")
+	*result = newFilesystemId
+	return nil
+}
+
+// Return local version information.
+func (d *DotmeshRPC) Version(
+	r *http.Request, args *struct{}, result *VersionInfo) error {
+	err := ensureAdminUser(r)
+
+	if err != nil {
+		return err
+	}
+
+	*result = *d.state.versionInfo
+	return nil
+}
+
+func (d *DotmeshRPC) registerFilesystemBecomeMaster(
+	ctx context.Context,
 	filesystemNamespace, filesystemName, cloneName, filesystemId string,
 	path PathToTopLevelFilesystem,
 ) error {
@@ -1144,7 +2064,7 @@ func (d *DotmeshRPC) registerFilesystemBecomeMaster(
 	_, err := d.state.GetFilesystemMachine(filesystemId)
 	if err == nil {
 		log.Errorf("[registerFilesystemBecomeMaster] failed to initialize filesystem %s due to it already existing", filesystemId)
-		return fmt.Errorf("Filesystem ID %s already exists", filesystemId)
+		return types.NewAPIError(types.ErrCodeConflict, "Filesystem ID %s already exists", filesystemId)
 	}
 
 	// TODO handle the case where the registry entry exists but the filesystems
@@ -1299,6 +2219,46 @@ func (d *DotmeshRPC) GetTransfer(r *http.Request, args *string, result *Transfer
 	return nil
 }
 
+// ListTransfers returns the finished and failed transfers in the transfer
+// history that match filter, oldest first. Users other than admin only see
+// transfers of volumes they can read.
+func (d *DotmeshRPC) ListTransfers(r *http.Request, filter *types.TransferFilter, result *[]types.TransferRecord) error {
+	err := filter.Validate()
+	if err != nil {
+		return err
+	}
+	if d.state.transferHistoryStore == nil {
+		return fmt.Errorf("The transfer history is not enabled on this server")
+	}
+
+	records, err := d.state.transferHistoryStore.ListTransferRecords()
+	if err != nil {
+		return err
+	}
+	everyone := transferQueueOwner(r) == ""
+	visible := []types.TransferRecord{}
+	for _, record := range records {
+		if !filter.Matches(record) {
+			continue
+		}
+		if !everyone {
+			filesystemId, err := d.state.registry.IdFromName(VolumeName{
+				Namespace: record.LocalNamespace,
+				Name:      record.LocalName,
+			})
+			if err != nil || d.ensureVolumeAccess(r, filesystemId, types.PermRead) != nil {
+				continue
+			}
+		}
+		visible = append(visible, record)
+	}
+	if filter.Limit > 0 && len(visible) > filter.Limit {
+		visible = visible[len(visible)-filter.Limit:]
+	}
+	*result = visible
+	return nil
+}
+
 func (d *DotmeshRPC) S3Transfer(r *http.Request, args *types.S3TransferRequest, result *string) error {
 	localVolumeName := VolumeName{
 		Namespace: args.LocalNamespace,
@@ -1313,6 +2273,9 @@ func (d *DotmeshRPC) S3Transfer(r *http.Request, args *types.S3TransferRequest,
 	if err != nil {
 		return err
 	}
+	if args.TargetCommit != "" && args.Direction != "push" {
+		return fmt.Errorf("A target commit can only be given when pushing to S3")
+	}
 	// set up the s3 session and client
 	config := &aws.Config{Credentials: credentials.NewStaticCredentials(args.KeyID, args.SecretKey, "")}
 	if args.Endpoint != "" {
@@ -1348,6 +2311,12 @@ func (d *DotmeshRPC) S3Transfer(r *http.Request, args *types.S3TransferRequest,
 		localVolumeName, args.LocalBranchName,
 	)
 	localExists := localFilesystemId != ""
+	if localExists {
+		err = d.ensureVolumeAccess(r, localFilesystemId, transferPermission(args.Direction))
+		if err != nil {
+			return err
+		}
+	}
 
 	// note; was a bunch of logic checks for whether remote/local ends exist here - I don't think we need them because we'd have returned an error already if remote didn't exist
 	if args.Direction == "pull" && !localExists {
@@ -1429,6 +2398,69 @@ func (d *DotmeshRPC) S3Transfer(r *http.Request, args *types.S3TransferRequest,
 	return nil
 }
 
+func (d *DotmeshRPC) SFTPTransfer(r *http.Request, args *types.SFTPTransferRequest, result *string) error {
+	localVolumeName := VolumeName{
+		Namespace: args.LocalNamespace,
+		Name:      args.LocalName,
+	}
+	err := validator.IsValidVolume(args.LocalNamespace, args.LocalName)
+	if err != nil {
+		return err
+	}
+	err = validator.IsValidBranchName(args.LocalBranchName)
+	if err != nil {
+		return err
+	}
+	if args.Direction != "push" {
+		return fmt.Errorf("SFTP remotes only support push, not '%s'", args.Direction)
+	}
+	if args.Hostname == "" || args.RemotePath == "" {
+		return fmt.Errorf("SFTP transfers need both a hostname and a remote path")
+	}
+	log.Printf("[SFTPTransfer] starting with %s", args)
+
+	localFilesystemId := d.state.registry.Exists(
+		localVolumeName, args.LocalBranchName,
+	)
+	if localFilesystemId == "" {
+		return fmt.Errorf("Unable to find %s", localVolumeName)
+	}
+	err = d.ensureVolumeAccess(r, localFilesystemId, types.PermRead)
+	if err != nil {
+		return err
+	}
+
+	responseChan, requestId, err := d.state.globalFsRequestId(
+		localFilesystemId,
+		&Event{Name: "sftp-transfer",
+			Args: &EventArgs{
+				"Transfer": args,
+			},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	go func() {
+		// asynchronously throw away the response, transfers can be polled via
+		// their own entries in etcd
+		e := <-responseChan
+		log.Printf("finished sftp transfer of %s, %+v", args, e)
+	}()
+
+	*result = requestId
+	return nil
+}
+
+// transferPermission is what a transfer in direction needs of the local
+// volume: pushing reads it, pulling writes to it.
+func transferPermission(direction string) types.Permission {
+	if direction == "pull" {
+		return types.PermWrite
+	}
+	return types.PermRead
+}
+
 // Register a transfer from an initiator (the cluster where the user initially
 // connected) to a peer (the cluster which will be the target of a push/pull).
 func (d *DotmeshRPC) RegisterTransfer(
@@ -1453,6 +2485,21 @@ func (d *DotmeshRPC) RegisterTransfer(
 		return fmt.Errorf("TransferRequestId cannot be empty")
 	}
 
+	// The initiator pushing to us needs to be able to write here, pulling
+	// from us to read. A push creating the filesystem has already been
+	// through RegisterFilesystem's checks, and the registry may not have
+	// caught up with it yet.
+	if _, _, err := d.state.registry.LookupFilesystemById(args.FilesystemId); err == nil {
+		perm := types.PermRead
+		if args.Direction == "push" {
+			perm = types.PermWrite
+		}
+		err = d.ensureVolumeAccess(r, args.FilesystemId, perm)
+		if err != nil {
+			return err
+		}
+	}
+
 	err = d.state.filesystemStore.SetTransfer(args, &store.SetOptions{})
 	if err != nil {
 		return err
@@ -1504,6 +2551,152 @@ func (d *DotmeshRPC) dirtyDataAndRunningContainers(ctx context.Context, filesyst
 	return dirtyBytes, containersRunning, nil
 }
 
+// EstimateTransfer works out how many commits, and roughly how many bytes,
+// Transfer would move for the same request, without starting anything.
+func (d *DotmeshRPC) EstimateTransfer(
+	r *http.Request,
+	args *types.TransferRequest,
+	result *types.TransferEstimate,
+) error {
+	started := time.Now()
+	client := dmclient.NewJsonRpcClient(args.User, args.Peer, args.ApiKey, args.Port)
+	client.SignRequests = true
+
+	err := validator.IsValidVolume(args.LocalNamespace, args.LocalName)
+	if err != nil {
+		return err
+	}
+	err = validator.IsValidBranchName(args.LocalBranchName)
+	if err != nil {
+		return err
+	}
+	if !types.ValidCompression(args.Compression) {
+		return fmt.Errorf("Unknown compression %q, it must be %s, %s or empty", args.Compression, types.CompressionGzip, types.CompressionLZ4)
+	}
+
+	var remoteFilesystemId string
+	err = client.CallRemote(r.Context(),
+		"DotmeshRPC.Exists", map[string]string{
+			"Namespace": args.RemoteNamespace,
+			"Name":      args.RemoteName,
+			"Branch":    args.RemoteBranchName,
+		}, &remoteFilesystemId)
+	if err != nil {
+		return err
+	}
+
+	localFilesystemId := d.state.registry.Exists(
+		VolumeName{Namespace: args.LocalNamespace, Name: args.LocalName}, args.LocalBranchName,
+	)
+
+	remoteExists := remoteFilesystemId != ""
+	localExists := localFilesystemId != ""
+
+	if args.Direction == "push" && !localExists {
+		return fmt.Errorf("Can't push when local doesn't exist")
+	}
+	if args.Direction == "pull" && !remoteExists {
+		return fmt.Errorf("Can't pull when remote doesn't exist")
+	}
+	if args.Direction != "push" && args.Direction != "pull" {
+		return fmt.Errorf("Unknown transfer direction '%s'", args.Direction)
+	}
+	if remoteExists && localExists && remoteFilesystemId != localFilesystemId {
+		return fmt.Errorf(
+			"Cannot reconcile filesystems with different ids, remote=%s, local=%s, args=%+v",
+			remoteFilesystemId, localFilesystemId, safeArgs(*args),
+		)
+	}
+	if localExists {
+		err = d.ensureVolumeAccess(r, localFilesystemId, types.PermRead)
+		if err != nil {
+			return err
+		}
+	}
+
+	localSnapshots := []Snapshot{}
+	if localExists {
+		localSnapshots, err = d.state.SnapshotsForCurrentMaster(localFilesystemId)
+		if err != nil {
+			return err
+		}
+	}
+	remoteSnapshots := []Snapshot{}
+	if remoteExists {
+		err = client.CallRemote(r.Context(), "DotmeshRPC.CommitsById", remoteFilesystemId, &remoteSnapshots)
+		if err != nil {
+			return err
+		}
+	}
+
+	fromSnapshots, toSnapshots := localSnapshots, remoteSnapshots
+	if args.Direction == "pull" {
+		fromSnapshots, toSnapshots = remoteSnapshots, localSnapshots
+	}
+
+	// Only snapshots up to the target commit get sent
+	if args.TargetCommit != "" {
+		found := false
+		for i, snapshot := range fromSnapshots {
+			if snapshot.Id == args.TargetCommit {
+				fromSnapshots = fromSnapshots[:i+1]
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("No such commit %s to transfer", args.TargetCommit)
+		}
+	}
+
+	alreadyThere := map[string]bool{}
+	for _, snapshot := range toSnapshots {
+		alreadyThere[snapshot.Id] = true
+	}
+	var commonSnapshotId string
+	missing := 0
+	for _, snapshot := range fromSnapshots {
+		if alreadyThere[snapshot.Id] {
+			commonSnapshotId = snapshot.Id
+		} else {
+			missing++
+		}
+	}
+
+	estimate := types.TransferEstimate{CommitCount: missing}
+	if missing > 0 {
+		canPredict := false
+		if args.Direction == "push" {
+			master, err := d.state.registry.CurrentMasterNode(localFilesystemId)
+			canPredict = err == nil && master == d.state.NodeID()
+		}
+		if canPredict {
+			estimate.EstimatedBytes, err = d.state.zfs.PredictSize(
+				"", commonSnapshotId, localFilesystemId, fromSnapshots[len(fromSnapshots)-1].Id,
+			)
+			if err != nil {
+				return err
+			}
+		} else {
+			var v DotmeshVolume
+			if args.Direction == "push" {
+				v, err = d.state.getOne(r.Context(), localFilesystemId)
+			} else {
+				err = client.CallRemote(r.Context(), "DotmeshRPC.Get", remoteFilesystemId, &v)
+			}
+			if err != nil {
+				return err
+			}
+			estimate.EstimatedBytes = v.SizeBytes
+			estimate.BytesIsUpperBound = true
+		}
+	}
+
+	estimate.DryRunDuration = time.Since(started)
+	*result = estimate
+	return nil
+}
+
 // Need both push and pull because one cluster will often be behind NAT.
 // Transfer will immediately return a transferId which can be queried until
 // completion
@@ -1512,7 +2705,12 @@ func (d *DotmeshRPC) Transfer(
 	args *types.TransferRequest,
 	result *string,
 ) error {
+	if args.DryRun {
+		return fmt.Errorf("Not starting a dry-run transfer, use EstimateTransfer to see what it would do")
+	}
+
 	client := dmclient.NewJsonRpcClient(args.User, args.Peer, args.ApiKey, args.Port)
+	client.SignRequests = true
 
 	log.Infof("[Transfer] starting with %+v", safeArgs(*args))
 
@@ -1553,6 +2751,12 @@ func (d *DotmeshRPC) Transfer(
 	if args.Direction == "pull" && !remoteExists {
 		return fmt.Errorf("Can't pull when remote doesn't exist")
 	}
+	if localExists {
+		err = d.ensureVolumeAccess(r, localFilesystemId, transferPermission(args.Direction))
+		if err != nil {
+			return err
+		}
+	}
 
 	var localPath, remotePath PathToTopLevelFilesystem
 	if args.Direction == "push" {
@@ -1734,13 +2938,40 @@ func (d *DotmeshRPC) Transfer(
 		)
 	}
 
-	// Now run globalFsRequest, returning the request id, to make the master of
-	// a (possibly nonexisting) filesystem start pulling or pushing it, and
-	// make it update status as it goes in a new pollable "transfers" object in
+	// Wait for a transfer slot on this node if they're all taken, otherwise
+	// start straight away so that any error getting going can be returned.
+	id, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+	requestId := id.String()
+	start := func() error {
+		return d.startTransfer(filesystemId, requestId, args)
+	}
+	if d.state.transferQueue.enqueue(requestId, auth.GetUserID(r), args.Priority, start) {
+		err = start()
+		if err != nil {
+			d.state.transferQueue.finished(requestId)
+			d.state.transferWebhooks.forget(requestId)
+			return err
+		}
+	}
+
+	*result = requestId
+	return nil
+}
+
+// startTransfer makes the transfer requested by Transfer happen, once it has a
+// slot in the transfer queue.
+func (d *DotmeshRPC) startTransfer(filesystemId, requestId string, args *types.TransferRequest) error {
+	// Now run globalFsRequest, with the request id, to make the master of a
+	// (possibly nonexisting) filesystem start pulling or pushing it, and make
+	// it update status as it goes in a new pollable "transfers" object in
 	// etcd.
 
-	responseChan, requestId, err := d.state.globalFsRequestId(
+	responseChan, err := d.state.globalFsRequestWithId(
 		filesystemId,
+		requestId,
 		&Event{Name: "transfer",
 			Args: &EventArgs{
 				"Transfer": args,
@@ -1748,6 +2979,15 @@ func (d *DotmeshRPC) Transfer(
 		},
 	)
 	if err != nil {
+		errorPollResult := TransferPollResult{
+			TransferRequestId: requestId,
+			Status:            "error",
+			Message:           fmt.Sprintf("Transfer failed to start: %s", err),
+		}
+		d.state.UpdateInterclusterTransfer(requestId, errorPollResult)
+		if err := d.state.filesystemStore.SetTransfer(&errorPollResult, &store.SetOptions{}); err != nil {
+			log.WithError(err).Error("Failed setting transfer state for error poll result")
+		}
 		return err
 	}
 
@@ -1776,6 +3016,8 @@ func (d *DotmeshRPC) Transfer(
 		// asynchronously consume the response, and update any in-progress
 		// transfer in error cases
 		e := <-responseChan
+		d.state.transferQueue.finished(requestId)
+		d.state.transferWebhooks.forget(requestId)
 		// detect success cases, ignore them - we assume that the pollResult will be updated in those cases
 		if !(e.Name == "finished-push" || e.Name == "finished-pull" || e.Name == "peer-up-to-date") {
 
@@ -1806,7 +3048,6 @@ func (d *DotmeshRPC) Transfer(
 		log.Infof("finished transfer of %+v, %+v", args, e)
 	}()
 
-	*result = requestId
 	return nil
 }
 
@@ -1958,8 +3199,9 @@ func (d *DotmeshRPC) Fork(r *http.Request, args *types.RPCForkRequest, result *s
 		args.MasterBranchID,
 		&Event{Name: "fork",
 			Args: &EventArgs{
-				"ForkNamespace": args.ForkNamespace,
-				"ForkName":      args.ForkName,
+				"ForkNamespace":  args.ForkNamespace,
+				"ForkName":       args.ForkName,
+				"SourceCommitId": args.SourceCommitId,
 			},
 		},
 	)
@@ -1978,35 +3220,207 @@ func (d *DotmeshRPC) Fork(r *http.Request, args *types.RPCForkRequest, result *s
 	return nil
 }
 
-func (d *DotmeshRPC) AddCollaborator(
-	r *http.Request,
-	args *struct {
-		MasterBranchID string
-		Collaborator   string
-	},
-	result *bool,
-) error {
-	// check authenticated user is owner of volume.
-	crappyTlf, clone, err := d.state.registry.LookupFilesystemById(args.MasterBranchID)
+// Clone copies the latest commit of a branch of one volume, and the commits
+// before it, into a new top-level volume. Unlike Fork, the copy isn't
+// recorded as a fork of the original: it's a volume in its own right, that
+// can be changed or deleted without regard to where it came from. Either way
+// the data is copied with zfs send and receive, so the result reports the
+// size of the stream for callers that want to warn about big copies.
+func (d *DotmeshRPC) Clone(r *http.Request, args *types.CloneVolumeRequest, result *types.CloneVolumeResult) error {
+	err := validator.IsValidVolume(args.Source.Namespace, args.Source.Name)
 	if err != nil {
 		return err
 	}
-	if clone != "" {
-		return fmt.Errorf(
-			"Please add collaborators to the master branch of the dot",
-		)
+	err = validator.IsValidVolume(args.Dest.Namespace, args.Dest.Name)
+	if err != nil {
+		return err
+	}
+	if args.Branch != "" {
+		err = validator.IsValidBranchName(args.Branch)
+		if err != nil {
+			return err
+		}
 	}
 
-	user := auth.GetUser(r)
-
-	authorized, err := d.usersManager.Authorize(user, false, &crappyTlf)
+	sourceId, err := d.state.registry.MaybeCloneFilesystemId(args.Source, args.Branch)
 	if err != nil {
 		return err
 	}
-	if !authorized {
-		return fmt.Errorf(
-			"Not owner. Please ask the owner to add the collaborator.",
-		)
+	err = d.ensureVolumeAccess(r, sourceId, types.PermRead)
+	if err != nil {
+		return err
+	}
+
+	if !args.EstimateOnly {
+		isAdmin, err := AuthenticatedUserIsNamespaceAdministrator(r.Context(), args.Dest.Namespace, d.usersManager)
+		if err != nil {
+			return err
+		}
+		if !isAdmin {
+			return types.NewAPIError(types.ErrCodePermissionDenied, "User is not an administrator for namespace %s, so cannot create volumes", args.Dest.Namespace)
+		}
+		if d.state.registry.Exists(args.Dest, "") != "" {
+			return types.NewAPIError(types.ErrCodeConflict, "Volume %s already exists", args.Dest)
+		}
+	}
+
+	cloned, err := d.state.cloneFilesystem(sourceId, args.Dest, args.EstimateOnly)
+	if err != nil {
+		return err
+	}
+	*result = *cloned
+	if cloned.FilesystemId != "" {
+		log.Printf("[Clone] cloned %s to %s as %s", sourceId, args.Dest, cloned.FilesystemId)
+	}
+	return nil
+}
+
+// checkNoBranchesFrom returns an error if a branch of the volume has been
+// made from any of the commits of filesystemId in commits.
+func (s *InMemoryState) checkNoBranchesFrom(filesystemId string, commits map[string]bool) error {
+	tlf, _, err := s.registry.LookupFilesystemById(filesystemId)
+	if err != nil {
+		return err
+	}
+	for branch, clone := range s.registry.ClonesFor(tlf.MasterBranch.Id) {
+		if clone.Origin.FilesystemId == filesystemId && commits[clone.Origin.SnapshotId] {
+			return fmt.Errorf("Branch %s was made from commit %s, so it can't be squashed", branch, clone.Origin.SnapshotId)
+		}
+	}
+	return nil
+}
+
+// cloneFilesystem asks the filesystem's FSM to clone it to dest, or just say
+// how big the clone would be if estimateOnly is set.
+func (s *InMemoryState) cloneFilesystem(filesystemId string, dest VolumeName, estimateOnly bool) (*types.CloneVolumeResult, error) {
+	responseChan, err := s.globalFsRequest(
+		filesystemId,
+		&Event{Name: "clone",
+			Args: &EventArgs{
+				"DestNamespace": dest.Namespace,
+				"DestName":      dest.Name,
+				"EstimateOnly":  estimateOnly,
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	e := <-responseChan
+	if e.Name != "cloned" {
+		return nil, maybeError(e, "cloned")
+	}
+	cloneId, ok := (*e.Args)["CloneId"].(string)
+	if !ok {
+		return nil, fmt.Errorf("interface conversion failed to clone id: %v", (*e.Args)["CloneId"])
+	}
+	result := &types.CloneVolumeResult{FilesystemId: cloneId}
+	switch size := (*e.Args)["EstimatedBytes"].(type) {
+	case float64:
+		result.EstimatedBytes = int64(size)
+	case int64:
+		result.EstimatedBytes = size
+	}
+	return result, nil
+}
+
+// CrossNamespaceCopy clones the master branch of a volume to one of the same
+// name in another namespace, for sharing a copy of it with whoever that
+// namespace belongs to. Only an administrator of the source volume's
+// namespace can do this.
+func (d *DotmeshRPC) CrossNamespaceCopy(r *http.Request, args *types.CrossNamespaceCopyRequest, result *VolumeName) error {
+	err := validator.IsValidVolume(args.Source.Namespace, args.Source.Name)
+	if err != nil {
+		return err
+	}
+	dest := VolumeName{Namespace: args.DestNamespace, Name: args.Source.Name}
+	err = validator.IsValidVolume(dest.Namespace, dest.Name)
+	if err != nil {
+		return err
+	}
+	if dest.Namespace == args.Source.Namespace {
+		return fmt.Errorf("Volume %s is already in namespace %s", args.Source, dest.Namespace)
+	}
+
+	isAdmin, err := AuthenticatedUserIsNamespaceAdministrator(r.Context(), args.Source.Namespace, d.usersManager)
+	if err != nil {
+		return err
+	}
+	if !isAdmin {
+		return types.NewAPIError(types.ErrCodePermissionDenied, "User is not an administrator for namespace %s, so cannot copy its volumes", args.Source.Namespace)
+	}
+
+	sourceId, err := d.state.registry.MaybeCloneFilesystemId(args.Source, "")
+	if err != nil {
+		return err
+	}
+
+	if d.state.registry.Exists(dest, "") != "" {
+		if !args.Overwrite {
+			return types.NewAPIError(types.ErrCodeConflict, "Volume %s already exists", dest)
+		}
+		existing, err := d.state.registry.LookupFilesystem(dest)
+		if err != nil {
+			return err
+		}
+		// Overwriting it is deleting it, which only its owner can do
+		user := auth.GetUser(r)
+		if user == nil {
+			return fmt.Errorf("no user found in request ctx")
+		}
+		authorized, err := d.usersManager.Authorize(user, false, &existing)
+		if err != nil {
+			return err
+		}
+		if !authorized {
+			return types.NewAPIError(types.ErrCodePermissionDenied, "You are not the owner of volume %s, so cannot overwrite it", dest)
+		}
+		log.Printf("[CrossNamespaceCopy] deleting %s to overwrite it with %s", dest, args.Source)
+		err = d.state.deleteFilesystemAndClones(user.Name, dest, existing)
+		if err != nil {
+			return err
+		}
+	}
+
+	cloned, err := d.state.cloneFilesystem(sourceId, dest, false)
+	if err != nil {
+		return err
+	}
+	log.Printf("[CrossNamespaceCopy] copied %s to %s as %s", args.Source, dest, cloned.FilesystemId)
+	*result = dest
+	return nil
+}
+
+func (d *DotmeshRPC) AddCollaborator(
+	r *http.Request,
+	args *struct {
+		MasterBranchID string
+		Collaborator   string
+	},
+	result *bool,
+) error {
+	// check authenticated user is owner of volume.
+	crappyTlf, clone, err := d.state.registry.LookupFilesystemById(args.MasterBranchID)
+	if err != nil {
+		return err
+	}
+	if clone != "" {
+		return fmt.Errorf(
+			"Please add collaborators to the master branch of the dot",
+		)
+	}
+
+	user := auth.GetUser(r)
+
+	authorized, err := d.usersManager.Authorize(user, false, &crappyTlf)
+	if err != nil {
+		return err
+	}
+	if !authorized {
+		return fmt.Errorf(
+			"Not owner. Please ask the owner to add the collaborator.",
+		)
 	}
 	// add collaborator in registry, re-save.
 	potentialCollaborator, err := d.usersManager.Get(&types.Query{Ref: args.Collaborator})
@@ -2157,46 +3571,1568 @@ func (d *DotmeshRPC) PredictSize(
 	return nil
 }
 
-func checkNotInUse(d *DotmeshRPC, fsid string, origins map[string]string) error {
+func checkNotInUse(s *InMemoryState, fsid string, origins map[string]string) error {
 	containersInUse := func() int {
-		d.state.globalContainerCacheLock.Lock()
-		defer d.state.globalContainerCacheLock.Unlock()
-		containerInfo, ok := d.state.globalContainerCache[fsid]
+		s.globalContainerCacheLock.Lock()
+		defer s.globalContainerCacheLock.Unlock()
+		containerInfo, ok := s.globalContainerCache[fsid]
 		if !ok {
 			return 0
 		}
 		return len(containerInfo.Containers)
 	}()
 	if containersInUse > 0 {
-		return fmt.Errorf("We cannot delete the volume %s when %d containers are still using it", fsid, containersInUse)
+		return types.NewAPIError(types.ErrCodeVolumeInUse, "We cannot delete the volume %s when %d containers are still using it", fsid, containersInUse)
+	}
+	for child, parent := range origins {
+		if parent == fsid {
+			err := checkNotInUse(s, child, origins)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func sortFilesystemsInDeletionOrder(in []string, rootId string, origins map[string]string) []string {
+	// Recursively zap any children
+	for child, parent := range origins {
+		if parent == rootId {
+			in = sortFilesystemsInDeletionOrder(in, child, origins)
+		}
+	}
+	// Then zap the root
+	in = append(in, rootId)
+	return in
+}
+
+func (d *DotmeshRPC) Delete(r *http.Request, args *VolumeName, result *bool) error {
+	*result = false
+
+	err := validator.IsValidVolume(args.Namespace, args.Name)
+	if err != nil {
+		return err
+	}
+
+	user := auth.GetUser(r)
+	if user == nil {
+		return fmt.Errorf("no user found in request ctx")
+	}
+
+	// Look up the top-level filesystem. This will error if the
+	// filesystem name isn't registered.
+	filesystem, err := d.state.registry.LookupFilesystem(*args)
+	if err != nil {
+		return err
+	}
+
+	authorized, err := d.usersManager.Authorize(user, false, &filesystem)
+	if err != nil {
+		return err
+	}
+	if !authorized {
+		return fmt.Errorf(
+			"You are not the owner of volume %s/%s. Only the owner can delete it.",
+			args.Namespace, args.Name,
+		)
+	}
+
+	err = d.state.deleteFilesystemAndClones(user.Name, *args, filesystem)
+	if err != nil {
+		return err
+	}
+
+	*result = true
+	return nil
+}
+
+// deleteFilesystemAndClones deletes a top-level filesystem along with all of
+// its clones, leaves-first. Callers are responsible for checking that the
+// user is allowed to do this.
+func (s *InMemoryState) deleteFilesystemAndClones(username string, name VolumeName, filesystem TopLevelFilesystem) error {
+	// Find the list of all clones of the filesystem, as we need to delete each independently.
+	filesystems := s.registry.ClonesFor(filesystem.MasterBranch.Id)
+
+	// We can't destroy a filesystem that's an origin for another
+	// filesystem, so let's topologically sort them and destroy them leaves-first.
+
+	// Analyse the list of filesystems, putting it into a more useful form for our purposes
+	origins := make(map[string]string)
+	names := make(map[string]string)
+	for cloneName, fs := range filesystems {
+		// Record the origin
+		origins[fs.FilesystemId] = fs.Origin.FilesystemId
+		// Record the name
+		names[fs.FilesystemId] = cloneName
+	}
+
+	// FUTURE WORK: If we ever need to delete just some clones, we
+	// can do so by picking a different rootId here. See
+	// https://github.com/dotmesh-io/dotmesh/issues/58
+	rootId := filesystem.MasterBranch.Id
+
+	// Check all clones are not in use. This is no guarantee one won't
+	// come into use while we're processing the deletion, but it's nice
+	// for the user to try and check first.
+	err := checkNotInUse(s, rootId, origins)
+	if err != nil {
+		return err
+	}
+
+	filesystemsInOrder := make([]string, 0)
+	filesystemsInOrder = sortFilesystemsInDeletionOrder(filesystemsInOrder, rootId, origins)
+
+	// What if we are interrupted during this loop?
+
+	// Because we delete from the leaves up, we SHOULD be OK: the
+	// system may end up in a state where some clones are gone, but
+	// the top-level filesystem remains and a new deletion on that
+	// should pick up where we left off.  I don't know how to easily
+	// test that with the current test harness, however, so here's
+	// hoping I'm right.
+	for _, fsid := range filesystemsInOrder {
+		// At this point, check the filesystem has no containers
+		// using it and error if so, for usability. This does not mean the
+		// filesystem is unused from here onwards, as it could come into
+		// use at any point.
+
+		// This will error if the filesystem is already marked as
+		// deleted; it shouldn't be in the metadata if it was, so
+		// hopefully that will never happen.
+		if filesystem.MasterBranch.Id == fsid {
+			// master clone, so record the name to delete and no clone registry entry to delete
+			err = s.markFilesystemAsDeletedInEtcd(fsid, username, name, "", "")
+		} else {
+			// Not the master clone, so don't record a name to delete, but do record a clone name for deletion
+			err = s.markFilesystemAsDeletedInEtcd(
+				fsid, username, VolumeName{},
+				filesystem.MasterBranch.Id, names[fsid])
+		}
+		if err != nil {
+			return err
+		}
+
+		// Block until the filesystem is gone locally (it may still be
+		// dying on other nodes in the cluster, but it's too costly to
+		// track that for the gains it gives us)
+		s.waitForFilesystemDeath(fsid)
+
+		// As we only block for completion locally, there IS a chance
+		// that the deletions will happen in the wrong order on other
+		// nodes in the cluster.  This may mean that some of them fail
+		// with an error, because their origins still exist.  However,
+		// hopefully, the discovery-triggers-redeletion code will cause
+		// them to eventually be deleted.
+	}
+
+	if s.debugPartialFailDelete {
+		return fmt.Errorf("Injected fault for debugging/testing purposes")
+	}
+
+	// If we're deleting the entire filesystem rather than just a
+	// clone, we need to unregister it.
+
+	// At this point, we have an inconsistent system state: the clone
+	// filesystems are marked for deletion, but their name is still
+	// registered in the registry. If we crash here, the name is taken
+	// by a nonexistant filesystem.
+
+	// This, however, is then recovered from by the
+	// cleanupDeletedFilesystems function, which is invoked
+	// periodically.
+
+	if rootId == filesystem.MasterBranch.Id {
+		err = s.registry.UnregisterFilesystem(name)
+		if err != nil {
+			return err
+		}
+
+		// This duplicates the work done by
+		// cleanupDockerFilesystemState(), and only on the node that the
+		// Delete call happens to land on, as part of a horrible
+		// belt-and-braces
+		err = deleteContainerMntSymlink(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Move a volume into the recycle bin. It disappears from listings, Exists and
+// Lookup, and every call that goes through ensureVolumeAccess, Procure and
+// Clone among them, refuses it; only ListDeleted and Restore still see it.
+// Its datasets are retained until the retention period runs out, at which
+// point purgeExpiredSoftDeletedVolumes deletes it for real.
+func (d *DotmeshRPC) SoftDelete(r *http.Request, args *types.SoftDeleteRequest, result *bool) error {
+	*result = false
+
+	err := validator.IsValidVolume(args.Name.Namespace, args.Name.Name)
+	if err != nil {
+		return err
+	}
+
+	if args.RetentionPeriod <= 0 {
+		return fmt.Errorf("Retention period must be positive, got %s", args.RetentionPeriod)
+	}
+
+	user := auth.GetUser(r)
+	if user == nil {
+		return fmt.Errorf("no user found in request ctx")
+	}
+
+	filesystem, err := d.state.registry.LookupFilesystem(args.Name)
+	if err != nil {
+		return err
+	}
+
+	authorized, err := d.usersManager.Authorize(user, false, &filesystem)
+	if err != nil {
+		return err
+	}
+	if !authorized {
+		return fmt.Errorf(
+			"You are not the owner of volume %s/%s. Only the owner can delete it.",
+			args.Name.Namespace, args.Name.Name,
+		)
+	}
+
+	deletedAt := time.Now()
+	err = d.state.filesystemStore.SetSoftDeleted(&types.FilesystemSoftDeletion{
+		FilesystemID: filesystem.MasterBranch.Id,
+		Name:         args.Name,
+		Username:     user.Name,
+		DeletedAt:    deletedAt,
+		ExpiresAt:    deletedAt.Add(args.RetentionPeriod),
+	}, &store.SetOptions{})
+	if err != nil {
+		if store.IsKeyAlreadyExist(err) {
+			return fmt.Errorf("Volume %s/%s is already deleted", args.Name.Namespace, args.Name.Name)
+		}
+		return err
+	}
+
+	*result = true
+	return nil
+}
+
+// List the volumes in the recycle bin that the authenticated user can see.
+func (d *DotmeshRPC) ListDeleted(r *http.Request, args *struct{}, result *[]types.DeletedVolume) error {
+	softDeleted, err := d.state.filesystemStore.ListSoftDeleted()
+	if err != nil {
+		return err
+	}
+
+	deleted := []types.DeletedVolume{}
+	for _, sd := range softDeleted {
+		v, err := d.state.getOne(r.Context(), sd.FilesystemID)
+		if err != nil {
+			switch err.(type) {
+			case PermissionDenied:
+				continue
+			default:
+				log.WithFields(log.Fields{
+					"error":         err,
+					"filesystem_id": sd.FilesystemID,
+				}).Error("[ListDeleted] failed to look up deleted volume")
+				continue
+			}
+		}
+		deleted = append(deleted, types.DeletedVolume{
+			DotmeshVolume: v,
+			DeletedAt:     sd.DeletedAt,
+			ExpiresAt:     sd.ExpiresAt,
+		})
+	}
+
+	*result = deleted
+	return nil
+}
+
+// Take a volume back out of the recycle bin, as long as it hasn't been purged
+// yet.
+func (d *DotmeshRPC) Restore(r *http.Request, args *VolumeName, result *bool) error {
+	*result = false
+
+	err := validator.IsValidVolume(args.Namespace, args.Name)
+	if err != nil {
+		return err
+	}
+
+	user := auth.GetUser(r)
+	if user == nil {
+		return fmt.Errorf("no user found in request ctx")
+	}
+
+	filesystem, err := d.state.registry.LookupFilesystem(*args)
+	if err != nil {
+		return err
+	}
+
+	authorized, err := d.usersManager.Authorize(user, false, &filesystem)
+	if err != nil {
+		return err
+	}
+	if !authorized {
+		return fmt.Errorf(
+			"You are not the owner of volume %s/%s. Only the owner can restore it.",
+			args.Namespace, args.Name,
+		)
+	}
+
+	sd, err := d.state.filesystemStore.GetSoftDeleted(filesystem.MasterBranch.Id)
+	if err != nil {
+		if store.IsKeyNotFound(err) {
+			return fmt.Errorf("Volume %s/%s is not deleted", args.Namespace, args.Name)
+		}
+		return err
+	}
+	if time.Now().After(sd.ExpiresAt) {
+		return fmt.Errorf(
+			"Volume %s/%s expired at %s and is being purged",
+			args.Namespace, args.Name, sd.ExpiresAt,
+		)
+	}
+
+	err = d.state.filesystemStore.DeleteSoftDeleted(filesystem.MasterBranch.Id)
+	if err != nil {
+		return err
+	}
+
+	*result = true
+	return nil
+}
+
+// ensureVolumeAccess checks that the authenticated user may access the volume
+// that filesystemId (a master branch or a clone) belongs to at perm, and that
+// it isn't in the recycle bin.
+func (d *DotmeshRPC) ensureVolumeAccess(r *http.Request, filesystemId string, perm types.Permission) error {
+	tlf, _, err := d.state.registry.LookupFilesystemById(filesystemId)
+	if err != nil {
+		return err
+	}
+	err = d.state.ensureNotSoftDeleted(filesystemId)
+	if err != nil {
+		return err
+	}
+	authorized, err := d.state.authorizeVolumeAccess(r.Context(), &tlf, perm)
+	if err != nil {
+		return err
+	}
+	if !authorized {
+		return fmt.Errorf(
+			"You do not have %s access to volume %s/%s",
+			perm, tlf.MasterBranch.Name.Namespace, tlf.MasterBranch.Name.Name,
+		)
+	}
+	return nil
+}
+
+// lookupVolumeAsOwner finds the volume called name and checks that the
+// authenticated user owns it, as only owners may change who it's shared with.
+func (d *DotmeshRPC) lookupVolumeAsOwner(r *http.Request, name VolumeName) (types.TopLevelFilesystem, error) {
+	err := validator.IsValidVolume(name.Namespace, name.Name)
+	if err != nil {
+		return types.TopLevelFilesystem{}, err
+	}
+
+	user := auth.GetUser(r)
+	if user == nil {
+		return types.TopLevelFilesystem{}, fmt.Errorf("no user found in request ctx")
+	}
+
+	filesystem, err := d.state.registry.LookupFilesystem(name)
+	if err != nil {
+		return types.TopLevelFilesystem{}, err
+	}
+
+	authorized, err := d.usersManager.Authorize(user, false, &filesystem)
+	if err != nil {
+		return types.TopLevelFilesystem{}, err
+	}
+	if !authorized {
+		return types.TopLevelFilesystem{}, fmt.Errorf(
+			"You are not the owner of volume %s/%s. Only the owner can share it.",
+			name.Namespace, name.Name,
+		)
+	}
+	return filesystem, nil
+}
+
+// Share a volume with another user, or change the permission they have on it.
+func (d *DotmeshRPC) ShareVolume(r *http.Request, args *types.ShareVolumeRequest, result *bool) error {
+	*result = false
+
+	if args.Permission != types.PermRead && args.Permission != types.PermWrite {
+		return fmt.Errorf(
+			"Unknown permission '%s', expected %s or %s",
+			args.Permission, types.PermRead, types.PermWrite,
+		)
+	}
+
+	filesystem, err := d.lookupVolumeAsOwner(r, args.Name)
+	if err != nil {
+		return err
+	}
+
+	target, err := d.usersManager.Get(&types.Query{Ref: args.User})
+	if err != nil {
+		return err
+	}
+
+	acl, err := d.state.filesystemStore.GetACL(filesystem.MasterBranch.Id)
+	if err != nil {
+		if !store.IsKeyNotFound(err) {
+			return err
+		}
+		acl = &types.FilesystemACL{FilesystemID: filesystem.MasterBranch.Id}
+	}
+
+	entries := []types.ACLEntry{}
+	for _, entry := range acl.Entries {
+		if entry.User != target.Name {
+			entries = append(entries, entry)
+		}
+	}
+	acl.Entries = append(entries, types.ACLEntry{User: target.Name, Permission: string(args.Permission)})
+
+	err = d.state.filesystemStore.SetACL(acl, &store.SetOptions{Force: true})
+	if err != nil {
+		return err
+	}
+
+	*result = true
+	return nil
+}
+
+// Stop sharing a volume with a user.
+func (d *DotmeshRPC) RevokeVolumeShare(r *http.Request, args *types.RevokeVolumeShareRequest, result *bool) error {
+	*result = false
+
+	filesystem, err := d.lookupVolumeAsOwner(r, args.Name)
+	if err != nil {
+		return err
+	}
+
+	acl, err := d.state.filesystemStore.GetACL(filesystem.MasterBranch.Id)
+	if err != nil && !store.IsKeyNotFound(err) {
+		return err
+	}
+
+	entries := []types.ACLEntry{}
+	found := false
+	if acl != nil {
+		for _, entry := range acl.Entries {
+			if entry.User == args.User {
+				found = true
+			} else {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	if !found {
+		return fmt.Errorf(
+			"Volume %s/%s is not shared with %s",
+			args.Name.Namespace, args.Name.Name, args.User,
+		)
+	}
+
+	if len(entries) == 0 {
+		err = d.state.filesystemStore.DeleteACL(filesystem.MasterBranch.Id)
+	} else {
+		acl.Entries = entries
+		err = d.state.filesystemStore.SetACL(acl, &store.SetOptions{Force: true})
+	}
+	if err != nil {
+		return err
+	}
+
+	*result = true
+	return nil
+}
+
+// List the users a volume has been shared with. Only the owner can see this.
+func (d *DotmeshRPC) GetVolumeACL(r *http.Request, args *VolumeName, result *[]types.ACLEntry) error {
+	filesystem, err := d.lookupVolumeAsOwner(r, *args)
+	if err != nil {
+		return err
+	}
+
+	acl, err := d.state.filesystemStore.GetACL(filesystem.MasterBranch.Id)
+	if err != nil {
+		if store.IsKeyNotFound(err) {
+			*result = []types.ACLEntry{}
+			return nil
+		}
+		return err
+	}
+
+	*result = acl.Entries
+	return nil
+}
+
+// namespaceVolumes lists the top-level volumes in namespace, including any in
+// the recycle bin.
+func (d *DotmeshRPC) namespaceVolumes(namespace string) []VolumeName {
+	volumes := []VolumeName{}
+	for _, name := range d.state.registry.Filesystems() {
+		if name.Namespace == namespace {
+			volumes = append(volumes, name)
+		}
+	}
+	return volumes
+}
+
+func (d *DotmeshRPC) ensureNamespaceAdministrator(r *http.Request, namespace string) error {
+	err := validator.IsValidVolumeNamespace(namespace)
+	if err != nil {
+		return err
+	}
+	isAdmin, err := AuthenticatedUserIsNamespaceAdministrator(r.Context(), namespace, d.usersManager)
+	if err != nil {
+		return err
+	}
+	if !isAdmin {
+		return fmt.Errorf("User is not an administrator for namespace %s", namespace)
+	}
+	return nil
+}
+
+// Create an empty namespace. Namespaces also spring into existence when
+// volumes are created in them, so this is only needed to claim a namespace
+// before there's anything in it.
+func (d *DotmeshRPC) CreateNamespace(r *http.Request, namespace *string, result *bool) error {
+	*result = false
+
+	err := d.ensureNamespaceAdministrator(r, *namespace)
+	if err != nil {
+		return err
+	}
+
+	if len(d.namespaceVolumes(*namespace)) > 0 {
+		return types.NewAPIError(types.ErrCodeConflict, "Namespace %s already exists", *namespace)
+	}
+
+	err = d.state.registryStore.SetNamespace(&types.RegistryNamespace{
+		Name:  *namespace,
+		Owner: auth.GetUser(r).Name,
+	}, &store.SetOptions{})
+	if err != nil {
+		if store.IsKeyAlreadyExist(err) {
+			return types.NewAPIError(types.ErrCodeConflict, "Namespace %s already exists", *namespace)
+		}
+		return err
+	}
+
+	*result = true
+	return nil
+}
+
+// Delete a namespace. Unless Force is set, it must not have any volumes in it;
+// with Force, they're all deleted first.
+func (d *DotmeshRPC) DeleteNamespace(r *http.Request, args *types.DeleteNamespaceRequest, result *bool) error {
+	*result = false
+
+	err := d.ensureNamespaceAdministrator(r, args.Namespace)
+	if err != nil {
+		return err
+	}
+
+	user := auth.GetUser(r)
+	volumes := d.namespaceVolumes(args.Namespace)
+	if len(volumes) > 0 && !args.Force {
+		return fmt.Errorf(
+			"Namespace %s still has %d volumes in it, delete them first or use force",
+			args.Namespace, len(volumes),
+		)
+	}
+	for _, name := range volumes {
+		filesystem, err := d.state.registry.LookupFilesystem(name)
+		if err != nil {
+			return err
+		}
+		err = d.state.deleteFilesystemAndClones(user.Name, name, filesystem)
+		if err != nil {
+			return fmt.Errorf("Could not delete volume %s: %s", name, err)
+		}
+	}
+
+	err = d.state.registryStore.DeleteNamespace(args.Namespace)
+	if err != nil {
+		if !store.IsKeyNotFound(err) {
+			return err
+		}
+		if len(volumes) == 0 {
+			return fmt.Errorf("Namespace %s does not exist", args.Namespace)
+		}
+	}
+
+	*result = true
+	return nil
+}
+
+// List the namespaces the authenticated user administers or can see volumes
+// in, with the number and size of the volumes they can see.
+func (d *DotmeshRPC) ListNamespaces(r *http.Request, args *struct{}, result *[]types.Namespace) error {
+	volumes, err := d.state.GetListOfVolumes(r.Context())
+	if err != nil {
+		return err
+	}
+
+	softDeleted, err := d.state.softDeletedFilesystemIds()
+	if err != nil {
+		return err
+	}
+
+	namespaces := map[string]*types.Namespace{}
+	gather := func(name string) *types.Namespace {
+		ns, ok := namespaces[name]
+		if !ok {
+			// by convention, namespaces are named after the users that own them
+			ns = &types.Namespace{Name: name, Owner: name}
+			namespaces[name] = ns
+		}
+		return ns
+	}
+
+	for _, v := range volumes {
+		if _, ok := softDeleted[v.Id]; ok {
+			continue
+		}
+		ns := gather(v.Name.Namespace)
+		if v.Branch == "" {
+			ns.VolumeCount++
+		}
+		ns.TotalBytes += v.SizeBytes
+	}
+
+	registered, err := d.state.registryStore.ListNamespaces()
+	if err != nil {
+		return err
+	}
+	for _, rn := range registered {
+		_, visible := namespaces[rn.Name]
+		if !visible {
+			isAdmin, err := AuthenticatedUserIsNamespaceAdministrator(r.Context(), rn.Name, d.usersManager)
+			if err != nil {
+				return err
+			}
+			if !isAdmin {
+				continue
+			}
+		}
+		ns := gather(rn.Name)
+		ns.Owner = rn.Owner
+		ns.MaxBytes = rn.MaxBytes
+	}
+
+	*result = []types.Namespace{}
+	for _, ns := range namespaces {
+		*result = append(*result, *ns)
+	}
+	sort.Slice(*result, func(i, j int) bool {
+		return (*result)[i].Name < (*result)[j].Name
+	})
+	return nil
+}
+
+// Cap the total size of the volumes in a namespace. Once it's reached, no
+// more volumes can be created in it or commits made to them. A MaxBytes of 0
+// removes the quota.
+func (d *DotmeshRPC) SetNamespaceQuota(r *http.Request, args *types.SetNamespaceQuotaRequest, result *bool) error {
+	*result = false
+
+	err := ensureAdminUser(r)
+	if err != nil {
+		return err
+	}
+
+	err = validator.IsValidVolumeNamespace(args.Namespace)
+	if err != nil {
+		return err
+	}
+
+	if args.MaxBytes < 0 {
+		return fmt.Errorf("Quota must not be negative, got %d", args.MaxBytes)
+	}
+
+	ns, err := d.state.registryStore.GetNamespace(args.Namespace)
+	if err != nil {
+		if !store.IsKeyNotFound(err) {
+			return err
+		}
+		ns = &types.RegistryNamespace{Name: args.Namespace, Owner: args.Namespace}
+	}
+	ns.MaxBytes = args.MaxBytes
+
+	err = d.state.registryStore.SetNamespace(ns, &store.SetOptions{Force: true})
+	if err != nil {
+		return err
+	}
+
+	*result = true
+	return nil
+}
+
+// Cap the space a volume's branches and their commits can use between them.
+// The quota's kept in etcd, and checked against all the branches before each
+// commit; each branch's dataset also gets it as its ZFS quota, wherever its
+// master is, so writes to any one branch fail once it alone has reached it. A
+// MaxBytes of 0 removes the quota. Only the admin user can set quotas, as for
+// namespaces.
+func (d *DotmeshRPC) SetVolumeQuota(r *http.Request, args *types.SetVolumeQuotaRequest, result *bool) error {
+	*result = false
+
+	err := ensureAdminUser(r)
+	if err != nil {
+		return err
+	}
+
+	err = validator.IsValidVolume(args.Name.Namespace, args.Name.Name)
+	if err != nil {
+		return err
+	}
+
+	if args.MaxBytes < 0 {
+		return fmt.Errorf("Quota must not be negative, got %d", args.MaxBytes)
+	}
+
+	filesystem, err := d.state.registry.LookupFilesystem(args.Name)
+	if err != nil {
+		return err
+	}
+
+	err = d.state.filesystemStore.SetQuota(&types.FilesystemQuota{
+		FilesystemID: filesystem.MasterBranch.Id,
+		MaxBytes:     args.MaxBytes,
+	}, &store.SetOptions{Force: true})
+	if err != nil {
+		return err
+	}
+
+	filesystemIds := []string{filesystem.MasterBranch.Id}
+	for _, clone := range d.state.registry.ClonesFor(filesystem.MasterBranch.Id) {
+		filesystemIds = append(filesystemIds, clone.FilesystemId)
+	}
+	for _, filesystemId := range filesystemIds {
+		responseChan, err := d.state.globalFsRequest(
+			filesystemId,
+			&Event{
+				Name: "set-quota",
+				Args: &EventArgs{"quotaBytes": strconv.FormatInt(args.MaxBytes, 10)},
+			},
+		)
+		if err != nil {
+			return err
+		}
+
+		e := <-responseChan
+		if e.Name != "quota-set" {
+			return maybeError(e, "quota-set")
+		}
+	}
+
+	*result = true
+	return nil
+}
+
+// GetVolumeQuota returns the quota of a volume, in bytes, or 0 if it has none.
+func (d *DotmeshRPC) GetVolumeQuota(r *http.Request, args *VolumeName, result *int64) error {
+	err := validator.IsValidVolume(args.Namespace, args.Name)
+	if err != nil {
+		return err
+	}
+
+	filesystem, err := d.state.registry.LookupFilesystem(*args)
+	if err != nil {
+		return err
+	}
+
+	err = d.ensureVolumeAccess(r, filesystem.MasterBranch.Id, types.PermRead)
+	if err != nil {
+		return err
+	}
+
+	quota, err := d.state.volumeQuota(filesystem.MasterBranch.Id)
+	if err != nil {
+		return err
+	}
+	*result = quota
+	return nil
+}
+
+// GetQuotaUsage reports a volume's quota alongside the space its branches use
+// between them, and how much of the quota that leaves.
+func (d *DotmeshRPC) GetQuotaUsage(r *http.Request, args *VolumeName, result *types.QuotaUsage) error {
+	err := validator.IsValidVolume(args.Namespace, args.Name)
+	if err != nil {
+		return err
+	}
+
+	filesystem, err := d.state.registry.LookupFilesystem(*args)
+	if err != nil {
+		return err
+	}
+
+	err = d.ensureVolumeAccess(r, filesystem.MasterBranch.Id, types.PermRead)
+	if err != nil {
+		return err
+	}
+
+	usage, err := d.state.quotaUsage(filesystem)
+	if err != nil {
+		return err
+	}
+	*result = *usage
+	return nil
+}
+
+// snapshotScheduleBranch finds the filesystem id of a branch, checking that
+// the authenticated user has perm access to it.
+func (d *DotmeshRPC) snapshotScheduleBranch(r *http.Request, name VolumeName, branch string, perm types.Permission) (string, error) {
+	err := validator.IsValidVolume(name.Namespace, name.Name)
+	if err != nil {
+		return "", err
+	}
+	err = validator.IsValidBranchName(branch)
+	if err != nil {
+		return "", err
+	}
+	filesystemId, err := d.state.registry.MaybeCloneFilesystemId(name, branch)
+	if err != nil {
+		return "", err
+	}
+	err = d.ensureVolumeAccess(r, filesystemId, perm)
+	if err != nil {
+		return "", err
+	}
+	return filesystemId, nil
+}
+
+// Commit to a branch automatically, whenever CronExpr says so. If RetainCount
+// is set, the oldest commits are pruned after each scheduled commit so that
+// there are at most that many. Replaces any existing schedule for the branch.
+func (d *DotmeshRPC) SetSnapshotSchedule(r *http.Request, args *types.SetSnapshotScheduleRequest, result *bool) error {
+	*result = false
+
+	filesystemId, err := d.snapshotScheduleBranch(r, args.Name, args.Branch, types.PermWrite)
+	if err != nil {
+		return err
+	}
+
+	_, err = cron.ParseStandard(args.CronExpr)
+	if err != nil {
+		return fmt.Errorf("Invalid cron expression '%s': %s", args.CronExpr, err)
+	}
+	if args.RetainCount < 0 {
+		return fmt.Errorf("Retain count must not be negative, got %d", args.RetainCount)
+	}
+
+	err = d.state.filesystemStore.SetSnapshotSchedule(&types.SnapshotSchedule{
+		FilesystemID: filesystemId,
+		Name:         args.Name,
+		Branch:       args.Branch,
+		Username:     auth.GetUser(r).Name,
+		CronExpr:     args.CronExpr,
+		RetainCount:  args.RetainCount,
+		LastRun:      time.Now(),
+	}, &store.SetOptions{Force: true})
+	if err != nil {
+		return err
+	}
+
+	*result = true
+	return nil
+}
+
+func (d *DotmeshRPC) GetSnapshotSchedule(r *http.Request, args *types.SnapshotScheduleRequest, result *types.SnapshotSchedule) error {
+	filesystemId, err := d.snapshotScheduleBranch(r, args.Name, args.Branch, types.PermRead)
+	if err != nil {
+		return err
+	}
+
+	ss, err := d.state.filesystemStore.GetSnapshotSchedule(filesystemId)
+	if err != nil {
+		if store.IsKeyNotFound(err) {
+			return fmt.Errorf("No snapshot schedule for %s branch %s", args.Name, args.Branch)
+		}
+		return err
+	}
+
+	*result = *ss
+	return nil
+}
+
+func (d *DotmeshRPC) DeleteSnapshotSchedule(r *http.Request, args *types.SnapshotScheduleRequest, result *bool) error {
+	*result = false
+
+	filesystemId, err := d.snapshotScheduleBranch(r, args.Name, args.Branch, types.PermWrite)
+	if err != nil {
+		return err
+	}
+
+	err = d.state.filesystemStore.DeleteSnapshotSchedule(filesystemId)
+	if err != nil {
+		if store.IsKeyNotFound(err) {
+			return fmt.Errorf("No snapshot schedule for %s branch %s", args.Name, args.Branch)
+		}
+		return err
+	}
+
+	*result = true
+	return nil
+}
+
+// Have a branch's commits pruned every so often, as policy says. A policy with
+// neither MaxCount nor MaxAgeDays removes the branch's policy; one that would
+// prune every commit it has now is refused. Replaces any existing policy for
+// the branch.
+func (d *DotmeshRPC) SetRetentionPolicy(r *http.Request, args *types.SetRetentionPolicyRequest, result *bool) error {
+	*result = false
+
+	filesystemId, err := d.snapshotScheduleBranch(r, args.Name, args.Branch, types.PermWrite)
+	if err != nil {
+		return err
+	}
+	policy := args.Policy
+	if policy.MaxCount < 0 || policy.MaxAgeDays < 0 {
+		return fmt.Errorf("Retention policy limits must not be negative, got %d commits and %d days", policy.MaxCount, policy.MaxAgeDays)
+	}
+
+	if policy.MaxCount == 0 && policy.MaxAgeDays == 0 {
+		err = d.state.filesystemStore.DeleteRetentionPolicy(filesystemId)
+		if err != nil && !store.IsKeyNotFound(err) {
+			return err
+		}
+		*result = true
+		return nil
+	}
+
+	_, err = d.state.branchCommitsToPrune(filesystemId, policy)
+	if err != nil {
+		return err
+	}
+	err = d.state.filesystemStore.SetRetentionPolicy(&types.FilesystemRetentionPolicy{
+		FilesystemID: filesystemId,
+		Name:         args.Name,
+		Branch:       args.Branch,
+		Policy:       policy,
+	}, &store.SetOptions{Force: true})
+	if err != nil {
+		return err
+	}
+
+	*result = true
+	return nil
+}
+
+// Check the ZFS dataset behind a volume, and the pool it's in, on the
+// volume's current master node.
+func (d *DotmeshRPC) CheckVolumeHealth(r *http.Request, args *VolumeName, result *types.VolumeHealth) error {
+	err := validator.IsValidVolume(args.Namespace, args.Name)
+	if err != nil {
+		return err
+	}
+
+	filesystem, err := d.state.registry.LookupFilesystem(*args)
+	if err != nil {
+		return err
+	}
+
+	err = d.ensureVolumeAccess(r, filesystem.MasterBranch.Id, types.PermRead)
+	if err != nil {
+		return err
+	}
+
+	responseChan, err := d.state.globalFsRequest(
+		filesystem.MasterBranch.Id,
+		&Event{Name: "check-health", Args: &EventArgs{}},
+	)
+	if err != nil {
+		return err
+	}
+
+	e := <-responseChan
+	if e.Name != "health-checked" {
+		return maybeError(e, "health-checked")
+	}
+
+	encoded, ok := (*e.Args)["health"].(string)
+	if !ok {
+		return fmt.Errorf("interface conversion failed to health: %v", (*e.Args)["health"])
+	}
+	return json.Unmarshal([]byte(encoded), result)
+}
+
+// GetPoolStatus reports on the ZFS pool of the node named nodeName, or of
+// this node if it's empty. Only the admin user can see pool status.
+func (d *DotmeshRPC) GetPoolStatus(r *http.Request, nodeName *string, result *types.PoolStatus) error {
+	err := ensureAdminUser(r)
+	if err != nil {
+		return err
+	}
+	if *nodeName != "" && *nodeName != d.state.NodeID() {
+		return d.callNode(r.Context(), *nodeName, "DotmeshRPC.GetPoolStatus", nodeName, result)
+	}
+
+	status, err := d.state.zfs.PoolStatus()
+	if err != nil {
+		return err
+	}
+	status.NodeName = d.state.NodeID()
+	*result = *status
+	return nil
+}
+
+// GetAllPoolStatuses reports on the ZFS pool of every node in the cluster,
+// sorted by node name. Nodes that can't be asked have their Error set rather
+// than failing the whole call.
+func (d *DotmeshRPC) GetAllPoolStatuses(r *http.Request, args *struct{}, result *[]types.PoolStatus) error {
+	err := ensureAdminUser(r)
+	if err != nil {
+		return err
+	}
+
+	d.state.serverAddressesCacheLock.RLock()
+	nodes := []string{}
+	for server := range d.state.serverAddressesCache {
+		nodes = append(nodes, server)
+	}
+	d.state.serverAddressesCacheLock.RUnlock()
+	sort.Strings(nodes)
+
+	statuses := make([]types.PoolStatus, len(nodes))
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node string) {
+			defer wg.Done()
+			err := d.GetPoolStatus(r, &node, &statuses[i])
+			if err != nil {
+				statuses[i] = types.PoolStatus{NodeName: node, Error: err.Error()}
+			}
+		}(i, node)
+	}
+	wg.Wait()
+
+	*result = statuses
+	return nil
+}
+
+// callNode calls method on another node of the cluster, as the admin user.
+// The caller has already checked the user may make the call.
+func (d *DotmeshRPC) callNode(ctx context.Context, nodeID, method string, args, result interface{}) error {
+	addresses := d.state.AddressesForServer(nodeID)
+	if len(addresses) == 0 {
+		return fmt.Errorf("Unknown node %s", nodeID)
+	}
+	admin, err := d.state.userManager.Get(&user.Query{Ref: "admin"})
+	if err != nil {
+		return fmt.Errorf("Can't establish API key to call node %s: %s", nodeID, err)
+	}
+	baseURL, err := dmclient.DeduceUrl(ctx, addresses, "internal", "admin", admin.ApiKey)
+	if err != nil {
+		return fmt.Errorf("Can't establish URL to call node %s: %s", nodeID, err)
+	}
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(parsed.Port())
+	if err != nil {
+		return fmt.Errorf("Can't establish URL to call node %s: %s", nodeID, err)
+	}
+	client := dmclient.NewJsonRpcClient("admin", parsed.Hostname(), admin.ApiKey, port)
+	client.SignRequests = true
+	return client.CallRemote(ctx, method, args, result)
+}
+
+// GetAuditLog returns the audit events matching filter, oldest first. Only
+// the admin user can read the audit log.
+func (d *DotmeshRPC) GetAuditLog(r *http.Request, filter *types.AuditFilter, result *[]types.AuditEvent) error {
+	err := ensureAdminUser(r)
+	if err != nil {
+		return err
+	}
+	err = filter.Validate()
+	if err != nil {
+		return err
+	}
+	if d.state.auditStore == nil {
+		return fmt.Errorf("The audit log is not enabled on this server")
+	}
+
+	events, err := d.state.auditStore.ListAuditEvents()
+	if err != nil {
+		return err
+	}
+	*result = filter.Filter(events)
+	return nil
+}
+
+// transferQueueOwner is whose transfers the caller may see and manage in the
+// transfer queue: everyone's ("") for the admin user, otherwise their own.
+func transferQueueOwner(r *http.Request) string {
+	userId := auth.GetUserID(r)
+	if userId == ADMIN_USER_UUID {
+		return ""
+	}
+	return userId
+}
+
+// SetTransferWebhook asks for a transfer's poll results to be POSTed to a URL
+// as it goes. The transfer must be running on, or waiting for, this node,
+// and be the caller's own unless they're the admin user.
+func (d *DotmeshRPC) SetTransferWebhook(r *http.Request, args *types.TransferWebhookRequest, result *bool) error {
+	if !d.state.transferQueue.has(args.TransferId, transferQueueOwner(r)) {
+		return fmt.Errorf("No transfer %s in progress on this node", args.TransferId)
+	}
+	err := d.state.transferWebhooks.add(args.TransferId, args.URL, args.Events)
+	if err != nil {
+		return err
+	}
+	*result = true
+	return nil
+}
+
+// GetTransferQueue lists the transfers running on, or waiting for, this node.
+func (d *DotmeshRPC) GetTransferQueue(r *http.Request, args *struct{}, result *[]types.QueuedTransfer) error {
+	*result = d.state.transferQueue.list(transferQueueOwner(r))
+	return nil
+}
+
+// CancelTransfer removes a transfer from this node's queue before it starts.
+func (d *DotmeshRPC) CancelTransfer(r *http.Request, args *string, result *bool) error {
+	err := d.state.transferQueue.cancel(*args, transferQueueOwner(r))
+	if err != nil {
+		return err
+	}
+	d.state.transferWebhooks.forget(*args)
+	*result = true
+	return nil
+}
+
+// PauseTransfer keeps a queued transfer from starting until ResumeTransfer.
+func (d *DotmeshRPC) PauseTransfer(r *http.Request, args *string, result *bool) error {
+	err := d.state.transferQueue.pause(*args, transferQueueOwner(r))
+	if err != nil {
+		return err
+	}
+	*result = true
+	return nil
+}
+
+func (d *DotmeshRPC) ResumeTransfer(r *http.Request, args *string, result *bool) error {
+	err := d.state.transferQueue.resume(*args, transferQueueOwner(r))
+	if err != nil {
+		return err
+	}
+	*result = true
+	return nil
+}
+
+// tagSnapshots fills in the tags of each of a branch's snapshots.
+func (d *DotmeshRPC) tagSnapshots(filesystemId string, snapshots []Snapshot) ([]Snapshot, error) {
+	ft, err := d.state.filesystemStore.GetTags(filesystemId)
+	if err != nil {
+		if store.IsKeyNotFound(err) {
+			return snapshots, nil
+		}
+		return nil, err
+	}
+	byCommit := map[string][]string{}
+	for tag, commitId := range ft.Tags {
+		byCommit[commitId] = append(byCommit[commitId], tag)
+	}
+	for i := range snapshots {
+		if tags, ok := byCommit[snapshots[i].Id]; ok {
+			sort.Strings(tags)
+			snapshots[i].Tags = tags
+		}
+	}
+	return snapshots, nil
+}
+
+// tagFilesystem validates a tag request and finds the branch it's for,
+// checking the user has perm on the volume.
+func (d *DotmeshRPC) tagFilesystem(r *http.Request, args *types.TagCommitRequest, perm types.Permission) (string, error) {
+	err := validator.IsValidVolume(args.Namespace, args.Name)
+	if err != nil {
+		return "", err
+	}
+	err = validator.IsValidBranchName(args.Branch)
+	if err != nil {
+		return "", err
+	}
+	err = validator.IsValidTagName(args.Tag)
+	if err != nil {
+		return "", err
+	}
+	filesystemId, err := d.state.registry.MaybeCloneFilesystemId(
+		VolumeName{Namespace: args.Namespace, Name: args.Name},
+		args.Branch,
+	)
+	if err != nil {
+		return "", err
+	}
+	err = d.ensureVolumeAccess(r, filesystemId, perm)
+	if err != nil {
+		return "", err
+	}
+	return filesystemId, nil
+}
+
+func (d *DotmeshRPC) commitExists(filesystemId, commitId string) (bool, error) {
+	snapshots, err := d.state.SnapshotsForCurrentMaster(filesystemId)
+	if err != nil {
+		return false, err
+	}
+	for _, snapshot := range snapshots {
+		if snapshot.Id == commitId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Give a commit on a branch a human readable name, which can be used in place
+// of its id. A tag names one commit on each branch.
+func (d *DotmeshRPC) TagCommit(r *http.Request, args *types.TagCommitRequest, result *bool) error {
+	*result = false
+
+	filesystemId, err := d.tagFilesystem(r, args, types.PermWrite)
+	if err != nil {
+		return err
+	}
+	err = validator.IsValidSnapshotName(args.CommitId)
+	if err != nil {
+		return err
+	}
+	exists, err := d.commitExists(filesystemId, args.CommitId)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("No commit %s on %s/%s", args.CommitId, args.Namespace, args.Name)
+	}
+
+	ft, err := d.state.filesystemStore.GetTags(filesystemId)
+	if err != nil {
+		if !store.IsKeyNotFound(err) {
+			return err
+		}
+		ft = &types.FilesystemTags{FilesystemID: filesystemId}
+	}
+	if ft.Tags == nil {
+		ft.Tags = map[string]string{}
+	}
+	if existing, ok := ft.Tags[args.Tag]; ok && existing != args.CommitId {
+		return fmt.Errorf("Tag %s is already on commit %s, untag it first to move it", args.Tag, existing)
+	}
+	ft.Tags[args.Tag] = args.CommitId
+
+	err = d.state.filesystemStore.SetTags(ft, &store.SetOptions{Force: true})
+	if err != nil {
+		return err
+	}
+
+	*result = true
+	return nil
+}
+
+// Remove a tag from a branch.
+func (d *DotmeshRPC) UntagCommit(r *http.Request, args *types.TagCommitRequest, result *bool) error {
+	*result = false
+
+	filesystemId, err := d.tagFilesystem(r, args, types.PermWrite)
+	if err != nil {
+		return err
+	}
+
+	ft, err := d.state.filesystemStore.GetTags(filesystemId)
+	if err != nil && !store.IsKeyNotFound(err) {
+		return err
+	}
+	if ft == nil || ft.Tags[args.Tag] == "" {
+		return fmt.Errorf("No tag %s on %s/%s", args.Tag, args.Namespace, args.Name)
+	}
+
+	delete(ft.Tags, args.Tag)
+	if len(ft.Tags) == 0 {
+		err = d.state.filesystemStore.DeleteTags(filesystemId)
+	} else {
+		err = d.state.filesystemStore.SetTags(ft, &store.SetOptions{Force: true})
+	}
+	if err != nil {
+		return err
+	}
+
+	*result = true
+	return nil
+}
+
+// Find the id of the commit a tag is on.
+func (d *DotmeshRPC) ResolveTag(r *http.Request, args *types.TagCommitRequest, result *string) error {
+	filesystemId, err := d.tagFilesystem(r, args, types.PermRead)
+	if err != nil {
+		return err
+	}
+
+	ft, err := d.state.filesystemStore.GetTags(filesystemId)
+	if err != nil && !store.IsKeyNotFound(err) {
+		return err
+	}
+	if ft == nil || ft.Tags[args.Tag] == "" {
+		return fmt.Errorf("No tag %s on %s/%s", args.Tag, args.Namespace, args.Name)
+	}
+	commitId := ft.Tags[args.Tag]
+
+	// tags aren't removed when their commit is, e.g. by a rollback
+	exists, err := d.commitExists(filesystemId, commitId)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("Tag %s is on commit %s, which no longer exists", args.Tag, commitId)
+	}
+
+	*result = commitId
+	return nil
+}
+
+// Choose the branch of a volume that clients use when no other has been
+// chosen. It's master unless set otherwise.
+func (d *DotmeshRPC) SetDefaultBranch(r *http.Request, args *types.SetDefaultBranchRequest, result *bool) error {
+	*result = false
+
+	err := validator.IsValidVolume(args.Name.Namespace, args.Name.Name)
+	if err != nil {
+		return err
+	}
+	branch := args.Branch
+	if branch == "master" {
+		branch = ""
+	}
+	err = validator.IsValidBranchName(branch)
+	if err != nil {
+		return err
+	}
+
+	filesystemId, err := d.state.registry.IdFromName(args.Name)
+	if err != nil {
+		return err
+	}
+	err = d.ensureVolumeAccess(r, filesystemId, types.PermWrite)
+	if err != nil {
+		return err
+	}
+
+	if branch == "" {
+		err = d.state.filesystemStore.DeleteDefaultBranch(filesystemId)
+		if err != nil && !store.IsKeyNotFound(err) {
+			return err
+		}
+		*result = true
+		return nil
+	}
+
+	if d.state.registry.Exists(args.Name, branch) == "" {
+		return fmt.Errorf("Branch %s does not exist on %s/%s", branch, args.Name.Namespace, args.Name.Name)
+	}
+	err = d.state.filesystemStore.SetDefaultBranch(&types.FilesystemDefaultBranch{
+		FilesystemID: filesystemId,
+		Branch:       branch,
+	}, &store.SetOptions{Force: true})
+	if err != nil {
+		return err
+	}
+
+	*result = true
+	return nil
+}
+
+// The default branch of a volume, "" meaning master. A default branch that has
+// since been deleted falls back to master.
+func (d *DotmeshRPC) GetDefaultBranch(r *http.Request, args *VolumeName, result *string) error {
+	err := validator.IsValidVolume(args.Namespace, args.Name)
+	if err != nil {
+		return err
+	}
+	filesystemId, err := d.state.registry.IdFromName(*args)
+	if err != nil {
+		return err
+	}
+	err = d.ensureVolumeAccess(r, filesystemId, types.PermRead)
+	if err != nil {
+		return err
+	}
+
+	*result = ""
+	db, err := d.state.filesystemStore.GetDefaultBranch(filesystemId)
+	if err != nil {
+		if store.IsKeyNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if d.state.registry.Exists(*args, db.Branch) != "" {
+		*result = db.Branch
+	}
+	return nil
+}
+
+// The default branches of all the volumes the user can see, by namespace and
+// then name, so that listing many volumes doesn't need a GetDefaultBranch
+// call for each. Volumes whose default is master, or whose default branch has
+// since been deleted, are left out.
+func (d *DotmeshRPC) DefaultBranches(
+	r *http.Request, args *struct{}, result *map[string]map[string]string) error {
+
+	var volumes map[string]map[string]DotmeshVolume
+	err := d.List(r, args, &volumes)
+	if err != nil {
+		return err
+	}
+
+	defaults, err := d.state.filesystemStore.ListDefaultBranches()
+	if err != nil && !store.IsKeyNotFound(err) {
+		return err
+	}
+	byId := map[string]string{}
+	for _, db := range defaults {
+		byId[db.FilesystemID] = db.Branch
+	}
+
+	gather := map[string]map[string]string{}
+	for namespace, byName := range volumes {
+		for name, v := range byName {
+			branch, ok := byId[v.Id]
+			if !ok || d.state.registry.Exists(v.Name, branch) == "" {
+				continue
+			}
+			submap, ok := gather[namespace]
+			if !ok {
+				submap = map[string]string{}
+				gather[namespace] = submap
+			}
+			submap[name] = branch
+		}
+	}
+
+	*result = gather
+	return nil
+}
+
+// Give a branch a new name. Master can't be renamed, as it's the volume's top
+// level filesystem rather than a clone. Settings that refer to the branch by
+// name follow it.
+func (d *DotmeshRPC) RenameBranch(r *http.Request, args *types.RenameBranchRequest, result *bool) error {
+	*result = false
+
+	err := validator.IsValidVolume(args.Name.Namespace, args.Name.Name)
+	if err != nil {
+		return err
+	}
+	if args.OldBranch == "" || args.OldBranch == DEFAULT_BRANCH {
+		return fmt.Errorf("The master branch can't be renamed")
+	}
+	if args.NewBranch == "" || args.NewBranch == DEFAULT_BRANCH {
+		return fmt.Errorf("A branch can't be renamed to master")
+	}
+	for _, branch := range []string{args.OldBranch, args.NewBranch} {
+		err = validator.IsValidBranchName(branch)
+		if err != nil {
+			return err
+		}
+	}
+	if args.OldBranch == args.NewBranch {
+		return fmt.Errorf("Branch %s already has that name", args.OldBranch)
+	}
+
+	tlf, err := d.state.registry.LookupFilesystem(args.Name)
+	if err != nil {
+		return err
+	}
+	err = d.ensureVolumeAccess(r, tlf.MasterBranch.Id, types.PermWrite)
+	if err != nil {
+		return err
+	}
+	clone, err := d.state.registry.LookupClone(tlf.MasterBranch.Id, args.OldBranch)
+	if err != nil {
+		return err
 	}
-	for child, parent := range origins {
-		if parent == fsid {
-			err := checkNotInUse(d, child, origins)
-			if err != nil {
-				return err
-			}
-		}
+	if d.state.registry.Exists(args.Name, args.NewBranch) != "" {
+		return types.NewAPIError(types.ErrCodeConflict, "Branch %s already exists on %s/%s", args.NewBranch, args.Name.Namespace, args.Name.Name)
 	}
-	return nil
-}
 
-func sortFilesystemsInDeletionOrder(in []string, rootId string, origins map[string]string) []string {
-	// Recursively zap any children
-	for child, parent := range origins {
-		if parent == rootId {
-			in = sortFilesystemsInDeletionOrder(in, child, origins)
+	// a transfer in progress holds on to the branch's name
+	d.state.interclusterTransfersLock.RLock()
+	for _, t := range d.state.interclusterTransfers {
+		if t.FilesystemId == clone.FilesystemId && t.Status != "finished" && t.Status != "error" {
+			d.state.interclusterTransfersLock.RUnlock()
+			return fmt.Errorf("Branch %s is being transferred (%s), try again once that's finished", args.OldBranch, t.TransferRequestId)
 		}
 	}
-	// Then zap the root
-	in = append(in, rootId)
-	return in
+	d.state.interclusterTransfersLock.RUnlock()
+
+	err = d.state.registry.RenameClone(tlf.MasterBranch.Id, args.OldBranch, args.NewBranch)
+	if err != nil {
+		return err
+	}
+	*result = true
+
+	logger := log.WithFields(log.Fields{
+		"filesystem_id": clone.FilesystemId,
+		"old_branch":    args.OldBranch,
+		"new_branch":    args.NewBranch,
+	})
+	db, err := d.state.filesystemStore.GetDefaultBranch(tlf.MasterBranch.Id)
+	if err == nil && db.Branch == args.OldBranch {
+		db.Branch = args.NewBranch
+		err = d.state.filesystemStore.SetDefaultBranch(db, &store.SetOptions{Force: true})
+	}
+	if err != nil && !store.IsKeyNotFound(err) {
+		logger.WithError(err).Error("[RenameBranch] failed to update default branch")
+		return fmt.Errorf("Renamed branch %s to %s, but couldn't make it the default branch again: %s", args.OldBranch, args.NewBranch, err)
+	}
+	ss, err := d.state.filesystemStore.GetSnapshotSchedule(clone.FilesystemId)
+	if err == nil {
+		ss.Branch = args.NewBranch
+		err = d.state.filesystemStore.SetSnapshotSchedule(ss, &store.SetOptions{Force: true})
+	}
+	if err != nil && !store.IsKeyNotFound(err) {
+		logger.WithError(err).Error("[RenameBranch] failed to update snapshot schedule")
+		return fmt.Errorf("Renamed branch %s to %s, but couldn't update its snapshot schedule: %s", args.OldBranch, args.NewBranch, err)
+	}
+	rp, err := d.state.filesystemStore.GetRetentionPolicy(clone.FilesystemId)
+	if err == nil {
+		rp.Branch = args.NewBranch
+		err = d.state.filesystemStore.SetRetentionPolicy(rp, &store.SetOptions{Force: true})
+	}
+	if err != nil && !store.IsKeyNotFound(err) {
+		logger.WithError(err).Error("[RenameBranch] failed to update retention policy")
+		return fmt.Errorf("Renamed branch %s to %s, but couldn't update its retention policy: %s", args.OldBranch, args.NewBranch, err)
+	}
+	return nil
 }
 
-func (d *DotmeshRPC) Delete(r *http.Request, args *VolumeName, result *bool) error {
+// DeleteBranch deletes a branch of a volume other than master and its default
+// branch, once no containers are using it and no branches have been made from
+// it. Like Delete, it marks the branch's filesystem deleted, which has its zfs
+// clone destroyed and its etcd entries, clone record included, cleaned up.
+func (d *DotmeshRPC) DeleteBranch(r *http.Request, args *types.DeleteBranchRequest, result *bool) error {
 	*result = false
 
-	err := validator.IsValidVolume(args.Namespace, args.Name)
+	err := validator.IsValidVolume(args.Name.Namespace, args.Name.Name)
+	if err != nil {
+		return err
+	}
+	if args.Branch == "" || args.Branch == DEFAULT_BRANCH {
+		return types.NewAPIError(types.ErrCodeDefaultBranch, "The master branch can't be deleted")
+	}
+	err = validator.IsValidBranchName(args.Branch)
 	if err != nil {
 		return err
 	}
@@ -2205,131 +5141,66 @@ func (d *DotmeshRPC) Delete(r *http.Request, args *VolumeName, result *bool) err
 	if user == nil {
 		return fmt.Errorf("no user found in request ctx")
 	}
-
-	// Look up the top-level filesystem. This will error if the
-	// filesystem name isn't registered.
-	filesystem, err := d.state.registry.LookupFilesystem(*args)
+	tlf, err := d.state.registry.LookupFilesystem(args.Name)
 	if err != nil {
 		return err
 	}
-
-	authorized, err := d.usersManager.Authorize(user, false, &filesystem)
+	authorized, err := d.usersManager.Authorize(user, false, &tlf)
 	if err != nil {
 		return err
 	}
 	if !authorized {
 		return fmt.Errorf(
-			"You are not the owner of volume %s/%s. Only the owner can delete it.",
-			args.Namespace, args.Name,
+			"You are not the owner of volume %s/%s. Only the owner can delete its branches.",
+			args.Name.Namespace, args.Name.Name,
 		)
 	}
-
-	// Find the list of all clones of the filesystem, as we need to delete each independently.
-	filesystems := d.state.registry.ClonesFor(filesystem.MasterBranch.Id)
-
-	// We can't destroy a filesystem that's an origin for another
-	// filesystem, so let's topologically sort them and destroy them leaves-first.
-
-	// Analyse the list of filesystems, putting it into a more useful form for our purposes
-	origins := make(map[string]string)
-	names := make(map[string]string)
-	for name, fs := range filesystems {
-		// Record the origin
-		origins[fs.FilesystemId] = fs.Origin.FilesystemId
-		// Record the name
-		names[fs.FilesystemId] = name
-	}
-
-	// FUTURE WORK: If we ever need to delete just some clones, we
-	// can do so by picking a different rootId here. See
-	// https://github.com/dotmesh-io/dotmesh/issues/58
-	rootId := filesystem.MasterBranch.Id
-
-	// Check all clones are not in use. This is no guarantee one won't
-	// come into use while we're processing the deletion, but it's nice
-	// for the user to try and check first.
-	err = checkNotInUse(d, rootId, origins)
+	clone, err := d.state.registry.LookupClone(tlf.MasterBranch.Id, args.Branch)
 	if err != nil {
 		return err
 	}
 
-	filesystemsInOrder := make([]string, 0)
-	filesystemsInOrder = sortFilesystemsInDeletionOrder(filesystemsInOrder, rootId, origins)
-
-	// What if we are interrupted during this loop?
-
-	// Because we delete from the leaves up, we SHOULD be OK: the
-	// system may end up in a state where some clones are gone, but
-	// the top-level filesystem remains and a new deletion on that
-	// should pick up where we left off.  I don't know how to easily
-	// test that with the current test harness, however, so here's
-	// hoping I'm right.
-	for _, fsid := range filesystemsInOrder {
-		// At this point, check the filesystem has no containers
-		// using it and error if so, for usability. This does not mean the
-		// filesystem is unused from here onwards, as it could come into
-		// use at any point.
+	db, err := d.state.filesystemStore.GetDefaultBranch(tlf.MasterBranch.Id)
+	if err != nil && !store.IsKeyNotFound(err) {
+		return err
+	}
+	if err == nil && db.Branch == args.Branch {
+		return types.NewAPIError(types.ErrCodeDefaultBranch, "Branch %s is the default branch of %s/%s, and can't be deleted", args.Branch, args.Name.Namespace, args.Name.Name)
+	}
 
-		// This will error if the filesystem is already marked as
-		// deleted; it shouldn't be in the metadata if it was, so
-		// hopefully that will never happen.
-		if filesystem.MasterBranch.Id == fsid {
-			// master clone, so record the name to delete and no clone registry entry to delete
-			err = d.state.markFilesystemAsDeletedInEtcd(fsid, user.Name, *args, "", "")
-		} else {
-			// Not the master clone, so don't record a name to delete, but do record a clone name for deletion
-			err = d.state.markFilesystemAsDeletedInEtcd(
-				fsid, user.Name, VolumeName{},
-				filesystem.MasterBranch.Id, names[fsid])
+	// zfs won't destroy a clone that other clones were made from
+	origins := map[string]string{}
+	children := []string{}
+	for name, c := range d.state.registry.ClonesFor(tlf.MasterBranch.Id) {
+		origins[c.FilesystemId] = c.Origin.FilesystemId
+		if c.Origin.FilesystemId == clone.FilesystemId {
+			children = append(children, name)
 		}
-		if err != nil {
-			return err
-		}
-
-		// Block until the filesystem is gone locally (it may still be
-		// dying on other nodes in the cluster, but it's too costly to
-		// track that for the gains it gives us)
-		d.state.waitForFilesystemDeath(fsid)
-
-		// As we only block for completion locally, there IS a chance
-		// that the deletions will happen in the wrong order on other
-		// nodes in the cluster.  This may mean that some of them fail
-		// with an error, because their origins still exist.  However,
-		// hopefully, the discovery-triggers-redeletion code will cause
-		// them to eventually be deleted.
 	}
-
-	if d.state.debugPartialFailDelete {
-		return fmt.Errorf("Injected fault for debugging/testing purposes")
+	if len(children) > 0 {
+		sort.Strings(children)
+		return fmt.Errorf("Branches %s were made from branch %s, delete them first", strings.Join(children, ", "), args.Branch)
+	}
+	err = checkNotInUse(d.state, clone.FilesystemId, origins)
+	if err != nil {
+		return err
 	}
 
-	// If we're deleting the entire filesystem rather than just a
-	// clone, we need to unregister it.
-
-	// At this point, we have an inconsistent system state: the clone
-	// filesystems are marked for deletion, but their name is still
-	// registered in the registry. If we crash here, the name is taken
-	// by a nonexistant filesystem.
-
-	// This, however, is then recovered from by the
-	// cleanupDeletedFilesystems function, which is invoked
-	// periodically.
-
-	if rootId == filesystem.MasterBranch.Id {
-		err = d.state.registry.UnregisterFilesystem(*args)
-		if err != nil {
-			return err
+	d.state.interclusterTransfersLock.RLock()
+	for _, t := range d.state.interclusterTransfers {
+		if t.FilesystemId == clone.FilesystemId && t.Status != "finished" && t.Status != "error" {
+			d.state.interclusterTransfersLock.RUnlock()
+			return fmt.Errorf("Branch %s is being transferred (%s), try again once that's finished", args.Branch, t.TransferRequestId)
 		}
+	}
+	d.state.interclusterTransfersLock.RUnlock()
 
-		// This duplicates the work done by
-		// cleanupDockerFilesystemState(), and only on the node that the
-		// Delete call happens to land on, as part of a horrible
-		// belt-and-braces
-		err = deleteContainerMntSymlink(*args)
-		if err != nil {
-			return err
-		}
+	err = d.state.markFilesystemAsDeletedInEtcd(clone.FilesystemId, user.Name, VolumeName{}, tlf.MasterBranch.Id, args.Branch)
+	if err != nil {
+		return err
 	}
+	// as for Delete, only wait for it to go locally
+	d.state.waitForFilesystemDeath(clone.FilesystemId)
 
 	*result = true
 	return nil
@@ -2743,6 +5614,79 @@ func (d *DotmeshRPC) GetReplicationLatencyForBranch(
 	return nil
 }
 
+// GetReplicationStatus reports how far each replica of a branch is behind
+// its master node, in commits and (estimated) bytes.
+func (d *DotmeshRPC) GetReplicationStatus(
+	r *http.Request,
+	args *struct {
+		Namespace, Name, Branch string
+	},
+	result *types.ReplicationStatus,
+) error {
+	err := ensureAdminUser(r)
+	if err != nil {
+		return err
+	}
+
+	err = validator.IsValidVolume(args.Namespace, args.Name)
+	if err != nil {
+		return err
+	}
+	err = validator.IsValidBranchName(args.Branch)
+	if err != nil {
+		return err
+	}
+
+	fs, err := d.state.registry.MaybeCloneFilesystemId(VolumeName{Namespace: args.Namespace, Name: args.Name}, args.Branch)
+	if err != nil {
+		return err
+	}
+
+	status, err := d.state.GetReplicationStatus(fs, func(fromSnapshotId, toSnapshotId string) (int64, error) {
+		return d.predictSizeOnMaster(fs, fromSnapshotId, toSnapshotId)
+	})
+	if err != nil {
+		return err
+	}
+	*result = *status
+	return nil
+}
+
+// predictSizeOnMaster asks fs's master node, which has the data to work it
+// out from, for the size of a ZFS stream between two of fs's commits.
+func (d *DotmeshRPC) predictSizeOnMaster(fs, fromSnapshotId, toSnapshotId string) (int64, error) {
+	responseChan, err := d.state.globalFsRequest(
+		fs,
+		&Event{Name: "predictSize",
+			Args: &EventArgs{
+				"FromFilesystemId": "",
+				"FromSnapshotId":   fromSnapshotId,
+				"ToFilesystemId":   fs,
+				"ToSnapshotId":     toSnapshotId,
+			},
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	e, ok := <-responseChan
+	if !ok {
+		return 0, fmt.Errorf("No response from the master of %s predicting a size", fs)
+	}
+	if e.Name != "predictedSize" {
+		return 0, maybeError(e, "predictedSize")
+	}
+	switch size := (*e.Args)["size"].(type) {
+	case float64:
+		return int64(size), nil
+	case int64:
+		return size, nil
+	default:
+		return 0, fmt.Errorf("interface conversion failed to size: %v", (*e.Args)["size"])
+	}
+}
+
 func (d *DotmeshRPC) ForceBranchMasterById(
 	r *http.Request,
 	args *struct {
@@ -2810,53 +5754,14 @@ func (d *DotmeshRPC) DumpEtcd(
 		return err
 	}
 
-	var backup types.BackupV1
-
-	backup.Version = types.BackupVersion
-	backup.Created = time.Now()
-
-	users, err := d.usersManager.List("")
-	if err != nil {
-		log.WithFields(log.Fields{
-			"error": err,
-		}).Error("failed to list users")
-	} else {
-		backup.Users = users
-	}
-
-	filesystemMasters, err := d.state.filesystemStore.ListMaster()
-	if err != nil {
-		log.WithFields(log.Fields{
-			"error": err,
-		}).Error("failed to list filesystem masters")
-	} else {
-		backup.FilesystemMasters = filesystemMasters
-	}
-
-	registryFilesystems, err := d.state.registryStore.ListFilesystems()
-	if err != nil {
-		log.WithFields(log.Fields{
-			"error": err,
-		}).Error("failed to list registry filesystems")
-	} else {
-		backup.RegistryFilesystems = registryFilesystems
-	}
-
-	registryClones, err := d.state.registryStore.ListClones()
-	if err != nil {
-		log.WithFields(log.Fields{
-			"error": err,
-		}).Error("failed to list registry clones")
-	} else {
-		backup.RegistryClones = registryClones
-	}
-
-	*result = backup
+	*result = *d.state.dumpEtcd()
 
 	return nil
 }
 
-// RestoreEtcd - restores KV store from the backup file
+// RestoreEtcd - restores KV store from the backup file, sent whole. Clients
+// stream backups to RestoreHandler instead where they can, see
+// types.RestoreStreamCapability.
 func (d *DotmeshRPC) RestoreEtcd(r *http.Request, args *struct {
 	Prefix string
 	Dump   string
@@ -2874,137 +5779,16 @@ func (d *DotmeshRPC) RestoreEtcd(r *http.Request, args *struct {
 		return fmt.Errorf("failed to unmarshal into a backup structure: %s", err)
 	}
 
-	supported := false
-	for _, v := range types.BackupSupportedVersions {
-		if backup.Version == v {
-			supported = true
-		}
-	}
-	if !supported {
-		return fmt.Errorf("unsupported backup version '%s', supported version: %s", backup.Version, strings.Join(types.BackupSupportedVersions, ", "))
-	}
-
-	// resetting registry in the cluster
-
-	eventID, _ := uuid.NewV4()
-	resetEvent := types.NewEvent(types.EventNameResetRegistry)
-	resetEvent.ID = eventID.String()
-
-	clusterResetComplete := make(chan struct{})
-	counter := 0
-
-	// servers
-	servers, err := d.state.serverStore.ListAddresses()
-	if err != nil {
-		log.WithFields(log.Fields{
-			"error": err,
-		}).Error("[RestoreEtcd] failed to list server addresses")
-	}
-	if len(servers) == 1 {
-		// only us, don't bother with cluster reset
-		d.state.resetRegistry()
-	} else {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		ch, err := d.state.messenger.Subscribe(ctx, &types.SubscribeQuery{
-			Type:      types.EventTypeClusterResponse,
-			RequestID: resetEvent.ID,
-		})
-		if err != nil {
-			log.WithFields(log.Fields{
-				"error": err,
-			}).Error("[RestoreEtcd] failed to subscribe to cluster events")
-		} else {
-			go func() {
-				defer close(clusterResetComplete)
-
-				// creating new ctx to wait for the acks
-				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-				defer cancel()
-				for {
-					select {
-					case <-ctx.Done():
-						// timeout
-						log.WithFields(log.Fields{
-							"servers":  len(servers),
-							"received": counter,
-						}).Info("[RestoreEtcd] some registry reset acks were missed, continuing with restore...")
-						return
-					case event, ok := <-ch:
-						if !ok {
-							log.WithFields(log.Fields{
-								"servers":  len(servers),
-								"received": counter,
-							}).Info("[RestoreEtcd] registry reset ack listener closed")
-							return
-						}
-						if event.ID == resetEvent.ID && event.Name == types.EventNameResetRegistryComplete {
-							counter++
-						}
-						if counter >= len(servers) {
-
-							log.WithFields(log.Fields{
-								"servers": len(servers),
-							}).Info("[RestoreEtcd] all registry reset acks received")
-							return
-						}
-					}
-				}
-			}()
-		}
-
-		err = d.state.messenger.Publish(resetEvent)
-		if err != nil {
-			log.WithFields(log.Fields{
-				"error": err,
-			}).Error("[RestoreEtcd] failed to dispatch reset registry event")
-		} else {
-			log.Info("[RestoreEtcd] cluster registry reset event dispatched, waiting for responses...")
-			<-clusterResetComplete
-		}
-	}
-
-	// importing objects
-
-	var errs []error
-
-	for _, u := range backup.Users {
-		err = d.usersManager.Import(u)
-		if err != nil {
-			log.WithFields(log.Fields{
-				"error": err,
-				"user":  u.Name,
-			}).Error("failed to import user")
-			errs = append(errs, err)
-		}
-	}
-
-	err = d.state.filesystemStore.ImportMasters(backup.FilesystemMasters, &store.ImportOptions{
-		DeleteExisting: true,
-	})
-	if err != nil {
-		errs = append(errs, err)
-	}
-
-	err = d.state.registryStore.ImportFilesystems(backup.RegistryFilesystems, &store.ImportOptions{
-		DeleteExisting: true,
-	})
-	if err != nil {
-		errs = append(errs, err)
-	}
-
-	err = d.state.registryStore.ImportClones(backup.RegistryClones, &store.ImportOptions{
-		DeleteExisting: true,
-	})
+	err = checkBackupVersion(backup.Version)
 	if err != nil {
-		errs = append(errs, err)
+		return err
 	}
 
-	if len(errs) > 0 {
-		return fmt.Errorf("got error while importing backup: %v", errs)
-	}
+	d.state.resetClusterRegistry()
 
-	return nil
+	restorer := newBackupRestorer(d.state)
+	restorer.importBatch(&backup)
+	return restorer.finish()
 }
 
 func (d *DotmeshRPC) LastModified(r *http.Request, v *types.VolumeName, result *types.LastModified) error {
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+
+	rpc "github.com/gorilla/rpc/v2"
+	rpcjson "github.com/gorilla/rpc/v2/json2"
+)
+
+// apiErrorCodec is a JSON-RPC codec that sends the code of a *types.APIError
+// along with its message, so that clients can get the *types.APIError back.
+type apiErrorCodec struct {
+	rpc.Codec
+}
+
+func newAPIErrorCodec() rpc.Codec {
+	return apiErrorCodec{rpcjson.NewCodec()}
+}
+
+func (c apiErrorCodec) NewRequest(r *http.Request) rpc.CodecRequest {
+	return apiErrorCodecRequest{c.Codec.NewRequest(r)}
+}
+
+type apiErrorCodecRequest struct {
+	rpc.CodecRequest
+}
+
+func (c apiErrorCodecRequest) WriteError(w http.ResponseWriter, status int, err error) {
+	if apiErr := asAPIError(err); apiErr != nil {
+		err = &rpcjson.Error{
+			Code:    rpcjson.E_SERVER,
+			Message: err.Error(),
+			Data:    apiErr,
+		}
+	}
+	c.CodecRequest.WriteError(w, status, err)
+}
+
+// asAPIError is the *types.APIError that err is or wraps, treating
+// permission errors as ErrCodePermissionDenied, or nil for other errors.
+func asAPIError(err error) *types.APIError {
+	var apiErr *types.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	var denied PermissionDenied
+	var typesDenied types.PermissionDenied
+	if errors.As(err, &denied) || errors.As(err, &typesDenied) {
+		return &types.APIError{Code: types.ErrCodePermissionDenied, Message: err.Error()}
+	}
+	return nil
+}
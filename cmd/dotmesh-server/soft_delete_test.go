@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/dotmesh-io/dotmesh/pkg/registry"
+	"github.com/dotmesh-io/dotmesh/pkg/store"
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+	"github.com/dotmesh-io/dotmesh/pkg/user"
+)
+
+func TestSoftDeletedVolumesAreHidden(t *testing.T) {
+	client, err := store.NewKVDBClient(&store.KVDBConfig{
+		Type: store.KVTypeMem,
+	})
+	if err != nil {
+		t.Fatalf("failed to init kv store: %s", err)
+	}
+	um := user.NewInternal(store.NewKVDBStoreWithIndex(client, "users"))
+	owner, err := um.New("alice", "alice@example.com", "verysecret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv := store.NewKVDBFilesystemStore(client)
+	reg := registry.NewRegistry(um, kv)
+	name := types.VolumeName{Namespace: "alice", Name: "vol"}
+	err = reg.UpdateFilesystemFromEtcd(name, types.RegistryFilesystem{
+		Id:      "master",
+		OwnerId: owner.Id,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.UpdateCloneFromEtcd("branch", "master", types.Clone{FilesystemId: "branch"})
+
+	state := &InMemoryState{
+		registry:        reg,
+		userManager:     um,
+		filesystemStore: kv,
+		registryStore:   kv,
+	}
+	d := NewDotmeshRPC(state, um)
+
+	err = kv.SetSoftDeleted(&types.FilesystemSoftDeletion{
+		FilesystemID: "master",
+		Name:         name,
+		Username:     owner.Name,
+		DeletedAt:    time.Now(),
+		ExpiresAt:    time.Now().Add(time.Hour),
+	}, &store.SetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, branch := range []string{"", "branch"} {
+		var exists string
+		err = d.Exists(httptest.NewRequest("POST", "/rpc", nil), &struct{ Namespace, Name, Branch string }{
+			Namespace: name.Namespace, Name: name.Name, Branch: branch,
+		}, &exists)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists != "" {
+			t.Errorf("branch %q: expected Exists to hide the deleted volume, got %q", branch, exists)
+		}
+	}
+
+	// Clone and everything else that checks access through ensureVolumeAccess
+	// refuse the volume and its branches
+	for _, fsId := range []string{"master", "branch"} {
+		err = d.ensureVolumeAccess(httptest.NewRequest("POST", "/rpc", nil), fsId, types.PermRead)
+		apiErr, ok := err.(*types.APIError)
+		if !ok || apiErr.Code != types.ErrCodeVolumeNotFound {
+			t.Errorf("%s: expected a volume not found error, got %v", fsId, err)
+		}
+	}
+
+	_, err = state.procureFilesystem(context.Background(), types.VolumeName{Namespace: "alice", Name: "vol@branch"})
+	if apiErr, ok := err.(*types.APIError); !ok || apiErr.Code != types.ErrCodeVolumeNotFound {
+		t.Errorf("expected procuring the deleted volume to be refused, got %v", err)
+	}
+}
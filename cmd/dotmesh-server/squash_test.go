@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dotmesh-io/dotmesh/pkg/registry"
+	"github.com/dotmesh-io/dotmesh/pkg/store"
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+	"github.com/dotmesh-io/dotmesh/pkg/user"
+)
+
+func TestSquashRefusedForBranchOrigins(t *testing.T) {
+	client, err := store.NewKVDBClient(&store.KVDBConfig{
+		Type: store.KVTypeMem,
+	})
+	if err != nil {
+		t.Fatalf("failed to init kv store: %s", err)
+	}
+	um := user.NewInternal(store.NewKVDBStoreWithIndex(client, "users"))
+	owner, err := um.New("alice", "alice@example.com", "verysecret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := registry.NewRegistry(um, store.NewKVDBFilesystemStore(client))
+	err = reg.UpdateFilesystemFromEtcd(types.VolumeName{Namespace: "alice", Name: "vol"}, types.RegistryFilesystem{
+		Id:      "master",
+		OwnerId: owner.Id,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// feature was made from master's c2, and fix from feature's f1
+	reg.UpdateCloneFromEtcd("feature", "master", types.Clone{
+		FilesystemId: "feature",
+		Origin:       types.Origin{FilesystemId: "master", SnapshotId: "c2"},
+	})
+	reg.UpdateCloneFromEtcd("fix", "master", types.Clone{
+		FilesystemId: "fix",
+		Origin:       types.Origin{FilesystemId: "feature", SnapshotId: "f1"},
+	})
+	state := &InMemoryState{registry: reg}
+
+	for _, c := range []struct {
+		filesystemId string
+		commits      []string
+		refusedFor   string
+	}{
+		{filesystemId: "master", commits: []string{"c1", "c2"}, refusedFor: "feature"},
+		{filesystemId: "master", commits: []string{"c3", "c4"}},
+		// the same commit id on another branch isn't an origin
+		{filesystemId: "feature", commits: []string{"c2"}},
+		{filesystemId: "feature", commits: []string{"f1"}, refusedFor: "fix"},
+	} {
+		commits := map[string]bool{}
+		for _, id := range c.commits {
+			commits[id] = true
+		}
+		err := state.checkNoBranchesFrom(c.filesystemId, commits)
+		if c.refusedFor == "" && err != nil {
+			t.Errorf("squashing %v on %s: expected no error, got %s", c.commits, c.filesystemId, err)
+		}
+		if c.refusedFor != "" && (err == nil || !strings.Contains(err.Error(), "Branch "+c.refusedFor+" was made from")) {
+			t.Errorf("squashing %v on %s: expected to be refused for branch %s, got %v", c.commits, c.filesystemId, c.refusedFor, err)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dotmesh-io/dotmesh/pkg/store"
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// transferQueue limits how many transfers this node initiates at once. The
+// rest wait, highest priority first and then in the order they arrived.
+// Transfers can only be paused or cancelled while they're waiting: once one
+// is running it has a zfs send/receive in flight which we can't interrupt.
+type transferQueue struct {
+	mu sync.Mutex
+	// 0 means no limit
+	maxConcurrent int
+	waiting       []*queuedTransfer
+	running       map[string]*queuedTransfer
+	// onWaiting is called, with mu held so that updates for one transfer
+	// can't overtake each other, when a waiting transfer is queued, paused,
+	// resumed or cancelled (status "cancelled")
+	onWaiting func(id, status string)
+}
+
+type queuedTransfer struct {
+	types.QueuedTransfer
+	// user id of whoever asked for the transfer
+	owner string
+	start func() error
+}
+
+const transferCancelled = "cancelled"
+
+func newTransferQueue(maxConcurrent int, onWaiting func(id, status string)) *transferQueue {
+	return &transferQueue{
+		maxConcurrent: maxConcurrent,
+		running:       map[string]*queuedTransfer{},
+		onWaiting:     onWaiting,
+	}
+}
+
+func (q *transferQueue) full() bool {
+	return q.maxConcurrent > 0 && len(q.running) >= q.maxConcurrent
+}
+
+// enqueue adds a transfer. If there's a free slot it's marked as running and
+// enqueue returns true, and the caller should start it; otherwise start is
+// called on its own goroutine once a slot frees up. Either way, finished must
+// be called when the transfer is over.
+func (q *transferQueue) enqueue(id, owner string, priority int, start func() error) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	t := &queuedTransfer{
+		QueuedTransfer: types.QueuedTransfer{
+			TransferID: id,
+			Status:     types.TransferQueued,
+			Priority:   priority,
+			EnqueuedAt: time.Now(),
+		},
+		owner: owner,
+		start: start,
+	}
+	if !q.full() {
+		q.markRunning(t)
+		return true
+	}
+	q.waiting = append(q.waiting, t)
+	sort.SliceStable(q.waiting, func(i, j int) bool {
+		return q.waiting[i].Priority > q.waiting[j].Priority
+	})
+	q.onWaiting(id, types.TransferQueued)
+	return false
+}
+
+func (q *transferQueue) markRunning(t *queuedTransfer) {
+	now := time.Now()
+	t.Status = types.TransferRunning
+	t.StartedAt = &now
+	q.running[t.TransferID] = t
+}
+
+// schedule starts as many waiting transfers as there are free slots. mu must
+// be held.
+func (q *transferQueue) schedule() {
+	for i := 0; i < len(q.waiting) && !q.full(); {
+		t := q.waiting[i]
+		if t.Status == types.TransferPaused {
+			i++
+			continue
+		}
+		q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+		q.markRunning(t)
+		go func() {
+			if err := t.start(); err != nil {
+				q.finished(t.TransferID)
+			}
+		}()
+	}
+}
+
+// finished frees the slot held by a running transfer.
+func (q *transferQueue) finished(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.running, id)
+	q.schedule()
+}
+
+// list returns the running transfers and then the waiting ones in the order
+// they'll start, restricted to those owned by owner unless it's "".
+func (q *transferQueue) list(owner string) []types.QueuedTransfer {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var running []types.QueuedTransfer
+	for _, t := range q.running {
+		if owner == "" || t.owner == owner {
+			running = append(running, t.QueuedTransfer)
+		}
+	}
+	sort.Slice(running, func(i, j int) bool {
+		return running[i].StartedAt.Before(*running[j].StartedAt)
+	})
+	result := append([]types.QueuedTransfer{}, running...)
+	for _, t := range q.waiting {
+		if owner == "" || t.owner == owner {
+			result = append(result, t.QueuedTransfer)
+		}
+	}
+	return result
+}
+
+// has returns whether a transfer owned by owner (or by anyone, if it's "")
+// is running or waiting.
+func (q *transferQueue) has(id, owner string) bool {
+	for _, t := range q.list(owner) {
+		if t.TransferID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// findWaiting returns the index of a transfer in q.waiting, or an error
+// explaining why it's not there. mu must be held.
+func (q *transferQueue) findWaiting(id, owner, action string) (int, error) {
+	if t, ok := q.running[id]; ok && (owner == "" || t.owner == owner) {
+		return -1, fmt.Errorf("Transfer %s is already running and can't be %s", id, action)
+	}
+	for i, t := range q.waiting {
+		if t.TransferID == id && (owner == "" || t.owner == owner) {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("No such queued transfer %s", id)
+}
+
+// cancel removes a waiting transfer from the queue. owner is checked as for
+// list.
+func (q *transferQueue) cancel(id, owner string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i, err := q.findWaiting(id, owner, "cancelled")
+	if err != nil {
+		return err
+	}
+	q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+	q.onWaiting(id, transferCancelled)
+	return nil
+}
+
+// pause keeps a waiting transfer from starting until it's resumed.
+func (q *transferQueue) pause(id, owner string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i, err := q.findWaiting(id, owner, "paused")
+	if err != nil {
+		return err
+	}
+	if q.waiting[i].Status != types.TransferPaused {
+		q.waiting[i].Status = types.TransferPaused
+		q.onWaiting(id, types.TransferPaused)
+	}
+	return nil
+}
+
+// resume puts a paused transfer back in its place in the queue.
+func (q *transferQueue) resume(id, owner string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if t, ok := q.running[id]; ok && (owner == "" || t.owner == owner) {
+		// nothing to do
+		return nil
+	}
+	i, err := q.findWaiting(id, owner, "resumed")
+	if err != nil {
+		return err
+	}
+	if q.waiting[i].Status == types.TransferPaused {
+		q.waiting[i].Status = types.TransferQueued
+		q.onWaiting(id, types.TransferQueued)
+		q.schedule()
+	}
+	return nil
+}
+
+// updateWaitingTransfer records the status of a transfer in the queue where
+// GetTransfer, and so dm's progress bar, can see it.
+func (s *InMemoryState) updateWaitingTransfer(id, status string) {
+	pollResult := TransferPollResult{
+		TransferRequestId: id,
+		Status:            status,
+	}
+	if status == transferCancelled {
+		// dm stops polling on errors
+		pollResult.Status = "error"
+		pollResult.Message = "Transfer cancelled"
+	}
+	s.UpdateInterclusterTransfer(id, pollResult)
+	err := s.filesystemStore.SetTransfer(&pollResult, &store.SetOptions{})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"transfer_id": id,
+			"status":      status,
+			"error":       err,
+		}).Error("[transferQueue] failed setting transfer state")
+	}
+}
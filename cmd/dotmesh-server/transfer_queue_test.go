@@ -0,0 +1,104 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_transferQueue(t *testing.T) {
+	var mu sync.Mutex
+	statuses := map[string]string{}
+	started := make(chan string, 10)
+	q := newTransferQueue(1, func(id, status string) {
+		mu.Lock()
+		defer mu.Unlock()
+		statuses[id] = status
+	})
+	start := func(id string) func() error {
+		return func() error {
+			started <- id
+			return nil
+		}
+	}
+
+	if !q.enqueue("first", "alice", 0, start("first")) {
+		t.Fatalf("expected the first transfer to get the free slot")
+	}
+	for _, id := range []string{"low", "high", "paused", "cancelled"} {
+		priority := 0
+		if id == "high" {
+			priority = 10
+		}
+		if q.enqueue(id, "alice", priority, start(id)) {
+			t.Fatalf("expected %s to be queued", id)
+		}
+	}
+	if err := q.pause("paused", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.cancel("cancelled", "bob"); err == nil {
+		t.Errorf("expected another user's transfer not to be cancellable")
+	}
+	if err := q.cancel("cancelled", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.cancel("first", "alice"); err == nil {
+		t.Errorf("expected a running transfer not to be cancellable")
+	}
+
+	queue := q.list("")
+	var order []string
+	for _, qt := range queue {
+		order = append(order, qt.TransferID+":"+qt.Status)
+	}
+	expected := []string{"first:running", "high:queued", "low:queued", "paused:paused"}
+	if len(order) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, order)
+	}
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, order)
+		}
+	}
+	if len(q.list("bob")) != 0 {
+		t.Errorf("expected bob to see none of alice's transfers")
+	}
+
+	// each finished transfer lets the next one start, skipping paused ones
+	for _, next := range []string{"high", "low"} {
+		q.finished(queue[0].TransferID)
+		select {
+		case id := <-started:
+			if id != next {
+				t.Fatalf("expected %s to start next, got %s", next, id)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected %s to start", next)
+		}
+		queue = q.list("")
+	}
+	q.finished("low")
+	select {
+	case id := <-started:
+		t.Fatalf("expected paused transfer not to start, but %s did", id)
+	case <-time.After(10 * time.Millisecond):
+	}
+	if err := q.resume("paused", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case id := <-started:
+		if id != "paused" {
+			t.Fatalf("expected the resumed transfer to start, got %s", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the resumed transfer to start")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if statuses["cancelled"] != transferCancelled || statuses["paused"] != "queued" {
+		t.Errorf("unexpected statuses %v", statuses)
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// transferWebhooks POSTs a transfer's poll results to the URLs registered
+// for it with SetTransferWebhook, so that CI systems needn't poll. Webhooks
+// are only held in memory on the node they were registered with, and are
+// forgotten once the transfer finishes, fails or leaves the queue.
+//
+// Anyone who can start a transfer can register a webhook, so they're only
+// delivered to public addresses: otherwise the node would POST, from inside
+// the cluster, wherever it was asked to. The check is made on the address
+// actually dialled, after DNS resolution, so a name can't be re-pointed at a
+// private address between checking the URL and delivering to it.
+type transferWebhooks struct {
+	mu       sync.Mutex
+	webhooks map[string][]*transferWebhook // by transfer id
+
+	client *http.Client
+	// delivery is retried this many times, waiting retryDelay and then
+	// twice as long each time
+	retries    int
+	retryDelay time.Duration
+	// webhooks are kept this long after their transfer leaves the queue,
+	// in case its last poll result is still on its way
+	forgetDelay time.Duration
+	// checkAddress is called with each address dialled, and refuses the
+	// connection with an error
+	checkAddress func(ip net.IP) error
+}
+
+type transferWebhook struct {
+	url    string
+	events map[string]bool
+
+	// Results waiting to be delivered, in order, by a single goroutine
+	// which runs while delivering is true
+	mu         sync.Mutex
+	pending    []transferWebhookDelivery
+	delivering bool
+}
+
+type transferWebhookDelivery struct {
+	event  string
+	result types.TransferPollResult
+}
+
+func newTransferWebhooks() *transferWebhooks {
+	w := &transferWebhooks{
+		webhooks:     map[string][]*transferWebhook{},
+		retries:      3,
+		retryDelay:   time.Second,
+		forgetDelay:  time.Minute,
+		checkAddress: publicWebhookAddress,
+	}
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			return w.checkAddress(net.ParseIP(host))
+		},
+	}
+	w.client = &http.Client{
+		Timeout: 10 * time.Second,
+		// no proxy, as it'd be the proxy's address that was checked
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, address)
+			},
+		},
+	}
+	return w
+}
+
+var errWebhookAddressForbidden = errors.New("webhook address isn't public")
+
+// webhookForbiddenNets are the private, shared and reserved IPv4 and IPv6
+// ranges, beyond the loopback and link-local ones net.IP knows about.
+var webhookForbiddenNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10",
+		"172.16.0.0/12",
+		"192.168.0.0/16",
+		"fc00::/7",
+	} {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// publicWebhookAddress returns errWebhookAddressForbidden if ip is a
+// loopback, link-local, private or unspecified address.
+func publicWebhookAddress(ip net.IP) error {
+	if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified() {
+		return errWebhookAddressForbidden
+	}
+	for _, n := range webhookForbiddenNets {
+		if n.Contains(ip) {
+			return errWebhookAddressForbidden
+		}
+	}
+	return nil
+}
+
+// transferWebhookEvent is the webhook event a poll result is for.
+func transferWebhookEvent(result types.TransferPollResult) string {
+	switch result.Status {
+	case "finished":
+		return types.TransferWebhookComplete
+	case "error":
+		return types.TransferWebhookError
+	default:
+		return types.TransferWebhookProgress
+	}
+}
+
+// checkWebhookURL returns an error unless u is an http(s) URL, at a public
+// address, that answers requests. Any response will do, as a webhook receiver
+// may well only accept POSTs. Why it can't be reached is only logged, as it
+// would tell the caller about whatever's at that address.
+func (w *transferWebhooks) checkWebhookURL(u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return fmt.Errorf("Invalid webhook URL %q: %s", u, err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("Invalid webhook URL %q: it must be an http:// or https:// URL", u)
+	}
+	resp, err := w.client.Head(u)
+	if errors.Is(err, errWebhookAddressForbidden) {
+		return fmt.Errorf("Invalid webhook URL %q: it must be at a public address", u)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"url":   u,
+		}).Warn("[transferWebhooks] webhook URL isn't reachable")
+		return fmt.Errorf("Webhook URL %q isn't reachable", u)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// add registers a webhook for transferId's events (all of them, if events
+// is empty).
+func (w *transferWebhooks) add(transferId, u string, events []string) error {
+	hook := &transferWebhook{url: u, events: map[string]bool{}}
+	for _, event := range events {
+		switch event {
+		case types.TransferWebhookProgress, types.TransferWebhookComplete, types.TransferWebhookError:
+			hook.events[event] = true
+		default:
+			return fmt.Errorf(
+				"Unknown transfer webhook event %q, expected %q, %q or %q",
+				event, types.TransferWebhookProgress, types.TransferWebhookComplete, types.TransferWebhookError,
+			)
+		}
+	}
+	if len(events) == 0 {
+		hook.events[types.TransferWebhookProgress] = true
+		hook.events[types.TransferWebhookComplete] = true
+		hook.events[types.TransferWebhookError] = true
+	}
+
+	err := w.checkWebhookURL(u)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.webhooks[transferId] = append(w.webhooks[transferId], hook)
+	return nil
+}
+
+// forget drops transferId's webhooks, once forgetDelay has passed to let any
+// last poll result for it be delivered.
+func (w *transferWebhooks) forget(transferId string) {
+	time.AfterFunc(w.forgetDelay, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.webhooks, transferId)
+	})
+}
+
+// notify queues result for delivery to the transfer's webhooks that want
+// its event. It doesn't block.
+func (w *transferWebhooks) notify(result types.TransferPollResult) {
+	event := transferWebhookEvent(result)
+	// The poll result carries the API key for the other cluster, which
+	// mustn't be sent anywhere else
+	result.ApiKey = ""
+
+	w.mu.Lock()
+	hooks := w.webhooks[result.TransferRequestId]
+	if event != types.TransferWebhookProgress {
+		delete(w.webhooks, result.TransferRequestId)
+	}
+	w.mu.Unlock()
+
+	for _, hook := range hooks {
+		if hook.events[event] {
+			w.enqueue(hook, transferWebhookDelivery{event: event, result: result})
+		}
+	}
+}
+
+func (w *transferWebhooks) enqueue(hook *transferWebhook, delivery transferWebhookDelivery) {
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+	// Progress that hasn't been delivered yet is out of date, so there's no
+	// point delivering it as well
+	last := len(hook.pending) - 1
+	if last >= 0 && hook.pending[last].event == types.TransferWebhookProgress && delivery.event == types.TransferWebhookProgress {
+		hook.pending[last] = delivery
+	} else {
+		hook.pending = append(hook.pending, delivery)
+	}
+	if !hook.delivering {
+		hook.delivering = true
+		go w.deliverPending(hook)
+	}
+}
+
+func (w *transferWebhooks) deliverPending(hook *transferWebhook) {
+	for {
+		hook.mu.Lock()
+		if len(hook.pending) == 0 {
+			hook.delivering = false
+			hook.mu.Unlock()
+			return
+		}
+		delivery := hook.pending[0]
+		hook.pending = hook.pending[1:]
+		hook.mu.Unlock()
+
+		err := w.deliver(hook.url, delivery.result)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":       err,
+				"url":         hook.url,
+				"event":       delivery.event,
+				"transfer_id": delivery.result.TransferRequestId,
+			}).Error("[transferWebhooks] giving up delivering transfer webhook")
+		}
+	}
+}
+
+// deliver POSTs result to u, retrying with exponential backoff until it's
+// accepted with a 2xx response or the retries run out.
+func (w *transferWebhooks) deliver(u string, result types.TransferPollResult) error {
+	body, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	delay := w.retryDelay
+	for attempt := 0; ; attempt++ {
+		err = w.post(u, body)
+		if err == nil || attempt == w.retries {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (w *transferWebhooks) post(u string, body []byte) error {
+	resp, err := w.client.Post(u, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+)
+
+func Test_transferWebhooks(t *testing.T) {
+	var mu sync.Mutex
+	var received []types.TransferPollResult
+	failures := 2
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var result types.TransferPollResult
+		if err := json.NewDecoder(r.Body).Decode(&result); err != nil {
+			t.Errorf("bad webhook body: %s", err)
+		}
+		received = append(received, result)
+		if result.Status == "finished" {
+			close(done)
+		}
+	}))
+	defer server.Close()
+
+	w := newTransferWebhooks()
+	w.retryDelay = time.Millisecond
+	if err := w.add("t1", server.URL, nil); err == nil || !strings.Contains(err.Error(), "public address") {
+		t.Errorf("expected a loopback URL to be refused, got %v", err)
+	}
+	// the test server's on loopback
+	w.checkAddress = func(ip net.IP) error { return nil }
+
+	if err := w.add("t1", "ftp://example.com/", nil); err == nil {
+		t.Errorf("expected a non-http URL to be refused")
+	}
+	if err := w.add("t1", server.URL, []string{"finished"}); err == nil {
+		t.Errorf("expected an unknown event to be refused")
+	}
+	if err := w.add("t1", server.URL, []string{types.TransferWebhookComplete}); err != nil {
+		t.Fatal(err)
+	}
+
+	w.notify(types.TransferPollResult{TransferRequestId: "t1", Status: "running", ApiKey: "secret"})
+	w.notify(types.TransferPollResult{TransferRequestId: "t2", Status: "finished"})
+	w.notify(types.TransferPollResult{TransferRequestId: "t1", Status: "finished", ApiKey: "secret"})
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for the webhook, after retries")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 1 || received[0].TransferRequestId != "t1" {
+		t.Fatalf("expected only t1's completion to be delivered, got %+v", received)
+	}
+	if received[0].ApiKey != "" {
+		t.Errorf("expected the API key not to be sent to the webhook")
+	}
+	if len(w.webhooks) != 0 {
+		t.Errorf("expected the webhook to be forgotten once the transfer finished")
+	}
+}
+
+func TestPublicWebhookAddress(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1", "::1", "10.1.2.3", "172.20.0.1", "192.168.1.1", "169.254.169.254", "100.64.0.1", "0.0.0.0", "fe80::1", "fd00::1"} {
+		if err := publicWebhookAddress(net.ParseIP(addr)); err != errWebhookAddressForbidden {
+			t.Errorf("expected %s to be refused, got %v", addr, err)
+		}
+	}
+	for _, addr := range []string{"8.8.8.8", "172.32.0.1", "2001:4860:4860::8888"} {
+		if err := publicWebhookAddress(net.ParseIP(addr)); err != nil {
+			t.Errorf("expected %s to be allowed, got %v", addr, err)
+		}
+	}
+}
+
+func TestTransferWebhooksForget(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	w := newTransferWebhooks()
+	w.checkAddress = func(ip net.IP) error { return nil }
+	w.forgetDelay = time.Millisecond
+	if err := w.add("t1", server.URL, nil); err != nil {
+		t.Fatal(err)
+	}
+	w.forget("t1")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w.mu.Lock()
+		n := len(w.webhooks)
+		w.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the webhook to be forgotten")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -13,9 +13,12 @@ import (
 const DEFAULT_BRANCH = "master"
 
 type dirtyInfo struct {
-	Server     string
-	DirtyBytes int64
-	SizeBytes  int64
+	Server          string
+	DirtyBytes      int64
+	SizeBytes       int64
+	LogicalBytes    int64
+	CompressedBytes int64
+	QuotaBytes      int64
 }
 
 type PermissionDenied struct {
@@ -97,6 +100,9 @@ type Opts struct {
 	RegistryStore   store.RegistryStore
 	FilesystemStore store.FilesystemStore
 	ServerStore     store.ServerStore
+	AuditStore      store.AuditStore
+
+	TransferHistoryStore store.TransferHistoryStore
 
 	// variables used to create fsm.FsMachine
 	ZFSExecPath string
@@ -110,6 +116,11 @@ type Opts struct {
 
 	// External user manager base URL (optional)
 	ExternalUserManagerURL string
+
+	// OIDC provider whose ID tokens are accepted in place of API keys, and
+	// the client ID they have to be issued for (both optional)
+	OIDCIssuerURL string
+	OIDCClientID  string
 }
 
 type containerInfo struct {
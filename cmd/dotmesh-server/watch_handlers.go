@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+	"github.com/dotmesh-io/dotmesh/pkg/validator"
+
+	"github.com/gorilla/mux"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// how often an idle watch stream gets a comment line, so that proxies don't
+// time it out and we notice clients that have gone away
+const watchKeepaliveInterval = 30 * time.Second
+
+// WatchHandler streams a branch's new commits to the client as Server-Sent
+// Events, one JSON-encoded Snapshot per event.
+type WatchHandler struct {
+	state *InMemoryState
+}
+
+func NewWatchHandler(state *InMemoryState) http.Handler {
+	return &WatchHandler{
+		state: state,
+	}
+}
+
+func (s *WatchHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	if !validator.EnsureValidOrRespond(vars["namespace"], validator.IsValidVolumeNamespace, resp) {
+		return
+	}
+	if !validator.EnsureValidOrRespond(vars["name"], validator.IsValidVolumeName, resp) {
+		return
+	}
+	branch := vars["branch"]
+	if branch == "master" {
+		branch = ""
+	}
+	if branch != "" && !validator.EnsureValidOrRespond(branch, validator.IsValidBranchName, resp) {
+		return
+	}
+	since := req.URL.Query().Get("since")
+	if since != "" && !validator.EnsureValidOrRespond(since, validator.IsValidSnapshotName, resp) {
+		return
+	}
+
+	volName := VolumeName{
+		Name:      vars["name"],
+		Namespace: vars["namespace"],
+	}
+
+	tlf, err := s.state.registry.LookupFilesystem(volName)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusNotFound)
+		return
+	}
+	authorized, err := s.state.authorizeVolumeAccess(req.Context(), &tlf, types.PermRead)
+	if err != nil {
+		log.Warnf("[WatchHandler.ServeHTTP] authorization failed: %s", err)
+		http.Error(resp, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !authorized {
+		http.Error(resp, fmt.Sprintf("You do not have read access to volume %s", volName), http.StatusUnauthorized)
+		return
+	}
+
+	filesystemID, err := s.state.registry.MaybeCloneFilesystemId(volName, branch)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	flusher, ok := resp.(http.Flusher)
+	if !ok {
+		http.Error(resp, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// subscribe before looking at the current commits, so none can slip in
+	// between the two
+	newSnaps := make(chan interface{})
+	s.state.newSnapsOnMaster.Subscribe(filesystemID, newSnaps)
+	defer s.state.newSnapsOnMaster.Unsubscribe(filesystemID, newSnaps)
+
+	snapshots, err := s.state.SnapshotsForCurrentMaster(filesystemID)
+	if err != nil {
+		http.Error(resp, fmt.Sprintf("failed to retrieve snapshots: %s", err), http.StatusInternalServerError)
+		return
+	}
+	start := len(snapshots)
+	if since != "" {
+		start = -1
+		for i, snap := range snapshots {
+			if snap.Id == since {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			http.Error(resp, fmt.Sprintf("commit %s not found on %s", since, volName), http.StatusNotFound)
+			return
+		}
+	}
+
+	resp.Header().Set("Content-Type", "text/event-stream")
+	resp.Header().Set("Cache-Control", "no-cache")
+	resp.Header().Set("Connection", "keep-alive")
+	resp.WriteHeader(200)
+	flusher.Flush()
+
+	sent := map[string]bool{}
+	for _, snap := range snapshots[:start] {
+		sent[snap.Id] = true
+	}
+	// send writes any commits that haven't been sent yet, oldest first
+	send := func(snapshots []Snapshot) error {
+		for _, snap := range snapshots {
+			if sent[snap.Id] {
+				continue
+			}
+			b, err := json.Marshal(snap)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(resp, "data: %s\n\n", b)
+			if err != nil {
+				return err
+			}
+			sent[snap.Id] = true
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	err = send(snapshots)
+	if err != nil {
+		log.Warnf("[WatchHandler.ServeHTTP] failed to send commits of %s: %s", filesystemID, err)
+		return
+	}
+
+	keepalive := time.NewTicker(watchKeepaliveInterval)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-keepalive.C:
+			_, err = fmt.Fprint(resp, ": keepalive\n\n")
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-newSnaps:
+			// notifications may arrive out of order, so just treat them as a
+			// prompt to look at the full list
+			snapshots, err := s.state.SnapshotsForCurrentMaster(filesystemID)
+			if err != nil {
+				log.Warnf("[WatchHandler.ServeHTTP] failed to retrieve snapshots of %s: %s", filesystemID, err)
+				continue
+			}
+			err = send(snapshots)
+			if err != nil {
+				log.Warnf("[WatchHandler.ServeHTTP] failed to send commits of %s: %s", filesystemID, err)
+				return
+			}
+		}
+	}
+}
+
+// how often a watch-modified stream checks whether the volume has changed
+const watchModifiedPollInterval = 5 * time.Second
+
+// WatchModifiedHandler streams a volume's last modified time to the client
+// as Server-Sent Events, one JSON-encoded LastModified per event, whenever it
+// changes.
+type WatchModifiedHandler struct {
+	state *InMemoryState
+}
+
+func NewWatchModifiedHandler(state *InMemoryState) http.Handler {
+	return &WatchModifiedHandler{
+		state: state,
+	}
+}
+
+func (s *WatchModifiedHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	if !validator.EnsureValidOrRespond(vars["namespace"], validator.IsValidVolumeNamespace, resp) {
+		return
+	}
+	if !validator.EnsureValidOrRespond(vars["name"], validator.IsValidVolumeName, resp) {
+		return
+	}
+
+	volName := VolumeName{
+		Name:      vars["name"],
+		Namespace: vars["namespace"],
+	}
+
+	tlf, err := s.state.registry.LookupFilesystem(volName)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusNotFound)
+		return
+	}
+	authorized, err := s.state.authorizeVolumeAccess(req.Context(), &tlf, types.PermRead)
+	if err != nil {
+		log.Warnf("[WatchModifiedHandler.ServeHTTP] authorization failed: %s", err)
+		http.Error(resp, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !authorized {
+		http.Error(resp, fmt.Sprintf("You do not have read access to volume %s", volName), http.StatusUnauthorized)
+		return
+	}
+	filesystemID := tlf.MasterBranch.Id
+
+	flusher, ok := resp.(http.Flusher)
+	if !ok {
+		http.Error(resp, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// the first time is only compared with, as for WatchLastModified
+	previous, err := s.state.zfs.LastModified(filesystemID)
+	if err != nil {
+		http.Error(resp, fmt.Sprintf("failed to get last modified time: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	resp.Header().Set("Content-Type", "text/event-stream")
+	resp.Header().Set("Cache-Control", "no-cache")
+	resp.Header().Set("Connection", "keep-alive")
+	resp.WriteHeader(200)
+	flusher.Flush()
+
+	poll := time.NewTicker(watchModifiedPollInterval)
+	defer poll.Stop()
+	keepalive := time.NewTicker(watchKeepaliveInterval)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-keepalive.C:
+			_, err = fmt.Fprint(resp, ": keepalive\n\n")
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-poll.C:
+			latest, err := s.state.zfs.LastModified(filesystemID)
+			if err != nil {
+				log.Warnf("[WatchModifiedHandler.ServeHTTP] failed to get last modified time of %s: %s", filesystemID, err)
+				continue
+			}
+			if latest.Time.Equal(previous.Time) {
+				continue
+			}
+			previous = latest
+			b, err := json.Marshal(latest)
+			if err != nil {
+				log.Warnf("[WatchModifiedHandler.ServeHTTP] failed to encode last modified time of %s: %s", filesystemID, err)
+				return
+			}
+			_, err = fmt.Fprintf(resp, "data: %s\n\n", b)
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
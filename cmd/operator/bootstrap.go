@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The dotmesh Secret holds the admin user's initial password and API key,
+// which every dotmesh server pod mounts on /secret, and is normally created
+// by whoever installs dotmesh. With bootstrap.autoCreateSecret set to "true",
+// the operator makes one with random credentials if it's missing, so that a
+// cluster can be brought up unattended.
+
+const DOTMESH_SECRET = "dotmesh"
+const DOTMESH_SECRET_ADMIN_PASSWORD_KEY = "dotmesh-admin-password.txt"
+const DOTMESH_SECRET_API_KEY_KEY = "dotmesh-api-key.txt"
+
+// randomCredential is 32 hex characters from crypto/rand.
+func randomCredential() (string, error) {
+	randBytes := make([]byte, 16)
+	_, err := rand.Read(randBytes)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(randBytes), nil
+}
+
+// ensureDotmeshSecret creates the dotmesh Secret if it doesn't exist. An
+// existing one is never changed.
+func (c *dotmeshController) ensureDotmeshSecret() error {
+	secrets := c.client.Core().Secrets(c.namespace)
+	_, err := secrets.Get(DOTMESH_SECRET, meta_v1.GetOptions{})
+	if err == nil {
+		return nil
+	}
+	if !errors.IsNotFound(err) {
+		return fmt.Errorf("Error getting secret %s: %+v", DOTMESH_SECRET, err)
+	}
+
+	password, err := randomCredential()
+	if err != nil {
+		return fmt.Errorf("Error generating the admin password: %+v", err)
+	}
+	apiKey, err := randomCredential()
+	if err != nil {
+		return fmt.Errorf("Error generating the admin API key: %+v", err)
+	}
+
+	_, err = secrets.Create(&v1.Secret{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Namespace: c.namespace,
+			Name:      DOTMESH_SECRET,
+		},
+		StringData: map[string]string{
+			DOTMESH_SECRET_ADMIN_PASSWORD_KEY: password,
+			DOTMESH_SECRET_API_KEY_KEY:        apiKey,
+		},
+	})
+	if errors.IsAlreadyExists(err) {
+		// Someone else made it in the meantime, theirs is kept
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Error creating secret %s: %+v", DOTMESH_SECRET, err)
+	}
+
+	c.log.Warnf(
+		"***** Secret %s/%s was missing, so it's been created with a random admin password and API key, as %s is true. "+
+			"Get the admin password with: kubectl get secret %s -n %s -o jsonpath='{.data.%s}' | base64 -d *****",
+		c.namespace, DOTMESH_SECRET, CONFIG_BOOTSTRAP_AUTO_CREATE_SECRET,
+		DOTMESH_SECRET, c.namespace, strings.Replace(DOTMESH_SECRET_ADMIN_PASSWORD_KEY, ".", `\.`, -1),
+	)
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+
+	v1 "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// In ceph mode, each dotmesh server keeps its pool on a Ceph RBD volume
+// rather than on the host: a PVC per node, from a StorageClass the operator
+// maintains from the ceph.* ConfigMap keys, is mounted at /backend-pv as in
+// pvcPerNode mode, and require_zfs.sh finds where that is on the host and
+// creates the pool in it, sized to fill it.
+
+const CEPH_STORAGE_CLASS = "dotmesh-ceph"
+const CEPH_PROVISIONER = "kubernetes.io/rbd"
+
+func cephPoolPVCName(node string) string {
+	return fmt.Sprintf("dotmesh-pool-%s", node)
+}
+
+// ensureCephStorageClass creates the StorageClass for pool PVCs, or updates
+// it if the ConfigMap has changed.
+func (c *dotmeshController) ensureCephStorageClass() error {
+	for _, key := range []string{CONFIG_CEPH_MONITORS, CONFIG_CEPH_POOL, CONFIG_CEPH_USER, CONFIG_CEPH_SECRET_NAME} {
+		if c.config.Data[key] == "" {
+			return fmt.Errorf("%s is %s, but %s isn't set", CONFIG_MODE, CONFIG_MODE_CEPH, key)
+		}
+	}
+	parameters := map[string]string{
+		"monitors":             c.config.Data[CONFIG_CEPH_MONITORS],
+		"pool":                 c.config.Data[CONFIG_CEPH_POOL],
+		"adminId":              c.config.Data[CONFIG_CEPH_USER],
+		"adminSecretName":      c.config.Data[CONFIG_CEPH_SECRET_NAME],
+		"adminSecretNamespace": c.namespace,
+		"userId":               c.config.Data[CONFIG_CEPH_USER],
+		"userSecretName":       c.config.Data[CONFIG_CEPH_SECRET_NAME],
+	}
+
+	storageClasses := c.client.StorageV1().StorageClasses()
+	storageClass := c.namespacedName(CEPH_STORAGE_CLASS)
+	existing, err := storageClasses.Get(storageClass, meta_v1.GetOptions{})
+	if errors.IsNotFound(err) {
+		c.log.Infof("Creating storage class %s", storageClass)
+		_, err = storageClasses.Create(&storage.StorageClass{
+			ObjectMeta:  meta_v1.ObjectMeta{Name: storageClass},
+			Provisioner: CEPH_PROVISIONER,
+			Parameters:  parameters,
+		})
+	} else if err == nil && !reflect.DeepEqual(existing.Parameters, parameters) {
+		c.log.Infof("Updating storage class %s", storageClass)
+		updated := existing.DeepCopy()
+		updated.Parameters = parameters
+		_, err = storageClasses.Update(updated)
+	}
+	if err != nil {
+		return fmt.Errorf("Error ensuring storage class %s: %+v", storageClass, err)
+	}
+	return nil
+}
+
+// ensureCephPoolPVC creates node's pool PVC if it doesn't exist yet, and
+// returns its name. An existing one is reused, so the pool outlives the pod.
+func (c *dotmeshController) ensureCephPoolPVC(node string) (string, error) {
+	pvcName := cephPoolPVCName(node)
+	pvcs := c.client.Core().PersistentVolumeClaims(c.namespace)
+	_, err := pvcs.Get(pvcName, meta_v1.GetOptions{})
+	if err == nil {
+		return pvcName, nil
+	}
+	if !errors.IsNotFound(err) {
+		return "", fmt.Errorf("Error getting pvc %s: %+v", pvcName, err)
+	}
+
+	storageNeeded, err := resource.ParseQuantity(c.config.Data[CONFIG_CEPH_POOL_SIZE_PER_NODE])
+	if err != nil {
+		return "", fmt.Errorf("Error parsing %s value %s: %+v", CONFIG_CEPH_POOL_SIZE_PER_NODE, c.config.Data[CONFIG_CEPH_POOL_SIZE_PER_NODE], err)
+	}
+	storageClass := c.namespacedName(CEPH_STORAGE_CLASS)
+
+	c.log.Infof("Creating new pvc %s for the pool on node %s", pvcName, node)
+	_, err = pvcs.Create(&v1.PersistentVolumeClaim{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Namespace: c.namespace,
+			Name:      pvcName,
+			Labels: map[string]string{
+				// Not DOTMESH_ROLE_PVC, so that pvcPerNode mode never
+				// hands it to another node
+				DOTMESH_ROLE_LABEL: DOTMESH_ROLE_POOL_PVC,
+				DOTMESH_NODE_LABEL: node,
+			},
+		},
+		Spec: v1.PersistentVolumeClaimSpec{
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{
+					v1.ResourceStorage: storageNeeded,
+				},
+			},
+			AccessModes: []v1.PersistentVolumeAccessMode{
+				v1.ReadWriteOnce,
+			},
+			StorageClassName: &storageClass,
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("Error creating pvc %s: %+v", pvcName, err)
+	}
+	return pvcName, nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// The configuration ConfigMap is watched, so that changing it takes effect
+// at the next reconcile rather than when the operator's next restarted.
+// Deleting it goes back to the defaults, as if it had never existed. The
+// nodeSelector decides which nodes the node informer lists and watches in
+// the first place, so changing it remakes that informer (see
+// restartableInformer); until the new one has synced, process() can't
+// list nodes, and gives up.
+
+// trackConfigMap makes c.configInformer, which watches the ConfigMap.
+func (c *dotmeshController) trackConfigMap() {
+	selector := fields.OneTermEqualSelector("metadata.name", DOTMESH_CONFIG_MAP).String()
+	_, configInformer := cache.NewInformer(
+		&cache.ListWatch{
+			ListFunc: func(lo meta_v1.ListOptions) (runtime.Object, error) {
+				lo.FieldSelector = selector
+				return c.client.Core().ConfigMaps(c.namespace).List(lo)
+			},
+			WatchFunc: func(lo meta_v1.ListOptions) (watch.Interface, error) {
+				lo.FieldSelector = selector
+				return c.client.Core().ConfigMaps(c.namespace).Watch(lo)
+			},
+		},
+		&v1.ConfigMap{},
+		// Only actual changes are of interest
+		0,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				c.reloadConfig(obj.(*v1.ConfigMap))
+			},
+			UpdateFunc: func(old, new interface{}) {
+				c.reloadConfig(new.(*v1.ConfigMap))
+			},
+			DeleteFunc: func(obj interface{}) {
+				c.log.Infof("Configmap %s/%s has been deleted, using defaults", c.namespace, DOTMESH_CONFIG_MAP)
+				c.reloadConfig(&v1.ConfigMap{})
+			},
+		},
+	)
+	c.configInformer = configInformer
+}
+
+// reloadConfig makes config the controller's configuration, if it's changed,
+// and has the change acted on.
+func (c *dotmeshController) reloadConfig(config *v1.ConfigMap) {
+	c.configLock.RLock()
+	unchanged := config.ResourceVersion != "" && config.ResourceVersion == c.config.ResourceVersion
+	c.configLock.RUnlock()
+	if unchanged {
+		// The informer's first sight of the ConfigMap newDotmeshController
+		// already fetched
+		return
+	}
+
+	changed := c.setConfig(config)
+	if len(changed) == 0 {
+		return
+	}
+	c.log.Infof("Configmap %s/%s has changed: %s", c.namespace, DOTMESH_CONFIG_MAP, strings.Join(changed, ", "))
+	for _, key := range changed {
+		if key == CONFIG_NODE_SELECTOR && c.restartableNodeInformer != nil {
+			c.log.Infof("Restarting the node informer with the new %s", CONFIG_NODE_SELECTOR)
+			c.restartableNodeInformer.Restart()
+		}
+	}
+	c.scheduleUpdate()
+}
+
+// nodeSelector is the ConfigMap's nodeSelector. Unlike the rest of the
+// configuration, it's used outside process(), by the node informer.
+func (c *dotmeshController) nodeSelector() string {
+	c.configLock.RLock()
+	defer c.configLock.RUnlock()
+	return c.config.Data[CONFIG_NODE_SELECTOR]
+}
+
+// changedConfigKeys lists the keys set, changed or removed between old and
+// new, in order.
+func changedConfigKeys(old, new map[string]string) []string {
+	changed := []string{}
+	for key, value := range new {
+		if oldValue, ok := old[key]; !ok || oldValue != value {
+			changed = append(changed, key)
+		}
+	}
+	for key := range old {
+		if _, ok := new[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// restartableInformer is an informer (and the indexer it caches objects in)
+// that can be thrown away and remade by newInformer, for when what it lists
+// and watches has changed. It passes for the informer it currently is.
+type restartableInformer struct {
+	newInformer func() (cache.Indexer, cache.Controller)
+
+	lock     sync.Mutex
+	indexer  cache.Indexer
+	informer cache.Controller
+	// stop stops the current informer; nil until Run is called
+	stop chan struct{}
+}
+
+func newRestartableInformer(newInformer func() (cache.Indexer, cache.Controller)) *restartableInformer {
+	r := &restartableInformer{newInformer: newInformer}
+	r.indexer, r.informer = newInformer()
+	return r
+}
+
+func (r *restartableInformer) Run(stopCh <-chan struct{}) {
+	r.lock.Lock()
+	r.start()
+	r.lock.Unlock()
+
+	<-stopCh
+
+	r.lock.Lock()
+	close(r.stop)
+	r.stop = nil
+	r.lock.Unlock()
+}
+
+// start runs the current informer until r.stop is closed; r.lock must be
+// held.
+func (r *restartableInformer) start() {
+	r.stop = make(chan struct{})
+	go r.informer.Run(r.stop)
+}
+
+// Restart stops the current informer, and replaces it with a new one, which
+// is run if the old one was.
+func (r *restartableInformer) Restart() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	running := r.stop != nil
+	if running {
+		close(r.stop)
+	}
+	r.indexer, r.informer = r.newInformer()
+	if running {
+		r.start()
+	}
+}
+
+func (r *restartableInformer) HasSynced() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.informer.HasSynced()
+}
+
+func (r *restartableInformer) LastSyncResourceVersion() string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.informer.LastSyncResourceVersion()
+}
+
+// Indexer is the current informer's indexer.
+func (r *restartableInformer) Indexer() cache.Indexer {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.indexer
+}
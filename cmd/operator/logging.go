@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/sirupsen/logrus"
+)
+
+// The operator logs through a logrus Logger, in one of two --log-format
+// formats: glog, the default, hands every entry to glog, so the output is as
+// it always was; json writes entries as JSON, for log pipelines that need
+// them structured. glog's -v still says how verbose the logging is, as
+// c.logV(level) only logs when glog.V(level) is on. --log-verbosity-map can
+// override it for some components of the operator, each logging through a
+// componentLogger, so that one part can be debugged without the noise of
+// the rest (client-go's included).
+//
+// glog (which client-go logs through too) can only write text to stderr,
+// so in json mode it's made to write to a pipe instead, and each line it
+// writes is logged to the Logger (see redirectGlog).
+
+const LOG_FORMAT_GLOG = "glog"
+const LOG_FORMAT_JSON = "json"
+
+// The field logV adds, holding the glog verbosity level of the entry
+const LOG_FIELD_VERBOSITY = "v"
+
+// The field json entries give the file and line they were logged from in
+const LOG_FIELD_SOURCE = "source"
+
+// The field a componentLogger adds, holding the component
+const LOG_FIELD_COMPONENT = "component"
+
+// Components of the operator, for --log-verbosity-map
+const LOG_COMPONENT_PROCESS = "process"   // process(), deciding which pods to create and delete
+const LOG_COMPONENT_INFORMER = "informer" // the informers' callbacks, on every change they see
+const LOG_COMPONENT_SCHEDULE = "schedule" // scheduleUpdate, as changes are debounced
+
+var logComponents = []string{LOG_COMPONENT_PROCESS, LOG_COMPONENT_INFORMER, LOG_COMPONENT_SCHEDULE}
+
+// newLogger makes the Logger for format, and in json mode redirects glog to
+// it; the returned flush function is to be called, in place of glog.Flush,
+// as the operator exits.
+func newLogger(format string) (*logrus.Logger, func(), error) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.InfoLevel)
+	switch format {
+	case LOG_FORMAT_GLOG:
+		logger.Out = ioutil.Discard
+		logger.AddHook(glogHook{})
+		return logger, glog.Flush, nil
+	case LOG_FORMAT_JSON:
+		logger.Out = os.Stderr
+		logger.Formatter = &logrus.JSONFormatter{}
+		logger.AddHook(sourceHook{})
+		redirect, err := redirectGlog(logger)
+		if err != nil {
+			return nil, nil, err
+		}
+		return logger, redirect.Flush, nil
+	}
+	return nil, nil, fmt.Errorf("Unsupported --log-format %q, it must be %s or %s", format, LOG_FORMAT_GLOG, LOG_FORMAT_JSON)
+}
+
+// logV is c.log if glog.V(level) is on, with the level in the entry, or a
+// logger that drops everything if not.
+func (c *dotmeshController) logV(level glog.Level) logrus.FieldLogger {
+	if !glog.V(level) {
+		return discardLogger
+	}
+	return c.log.WithField(LOG_FIELD_VERBOSITY, int(level))
+}
+
+// componentVerbosity is the verbosity of each component in
+// --log-verbosity-map, which overrides glog's -v for them.
+var componentVerbosity = map[string]glog.Level{}
+
+// parseVerbosityMap parses --log-verbosity-map, a comma-separated list of
+// component=level.
+func parseVerbosityMap(verbosityMap string) (map[string]glog.Level, error) {
+	verbosity := map[string]glog.Level{}
+	for _, entry := range strings.Split(verbosityMap, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		component := strings.TrimSpace(parts[0])
+		known := false
+		for _, c := range logComponents {
+			known = known || c == component
+		}
+		if !known {
+			return nil, fmt.Errorf("Unknown component %q in --log-verbosity-map, it must be one of %s", component, strings.Join(logComponents, ", "))
+		}
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("No level for %s in --log-verbosity-map, it must be a list of component=level", component)
+		}
+		level, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || level < 0 {
+			return nil, fmt.Errorf("Invalid level %q for %s in --log-verbosity-map, it must be a whole number", parts[1], component)
+		}
+		verbosity[component] = glog.Level(level)
+	}
+	return verbosity, nil
+}
+
+// componentLogger is logV for one component of the operator, at its level
+// in --log-verbosity-map if it's there, or glog's -v otherwise.
+type componentLogger struct {
+	log       *logrus.Logger
+	component string
+}
+
+// logFor is the componentLogger for component.
+func (c *dotmeshController) logFor(component string) componentLogger {
+	return componentLogger{log: c.log, component: component}
+}
+
+// Enabled is whether the component logs at level.
+func (l componentLogger) Enabled(level glog.Level) bool {
+	if verbosity, ok := componentVerbosity[l.component]; ok {
+		return level <= verbosity
+	}
+	return bool(glog.V(level))
+}
+
+// V is the Logger, with the level and component in the entry, if the
+// component logs at level, or a logger that drops everything if not.
+func (l componentLogger) V(level glog.Level) logrus.FieldLogger {
+	if !l.Enabled(level) {
+		return discardLogger
+	}
+	return l.log.WithFields(logrus.Fields{
+		LOG_FIELD_VERBOSITY: int(level),
+		LOG_FIELD_COMPONENT: l.component,
+	})
+}
+
+var discardLogger = &logrus.Logger{
+	Out:       ioutil.Discard,
+	Formatter: &logrus.TextFormatter{},
+	Hooks:     logrus.LevelHooks{},
+	Level:     logrus.PanicLevel,
+}
+
+// glogHook writes each entry to glog, at the entry's level, with its fields
+// (other than the verbosity and component logV and componentLogger add,
+// which keep glog's output as it was) after the message.
+type glogHook struct{}
+
+func (glogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (glogHook) Fire(entry *logrus.Entry) error {
+	message := entry.Message
+	for key, value := range entry.Data {
+		if key != LOG_FIELD_VERBOSITY && key != LOG_FIELD_COMPONENT {
+			message += fmt.Sprintf(" %s=%v", key, value)
+		}
+	}
+	_, depth := loggerCaller()
+	switch entry.Level {
+	case logrus.FatalLevel:
+		glog.FatalDepth(depth, message)
+	case logrus.PanicLevel, logrus.ErrorLevel:
+		glog.ErrorDepth(depth, message)
+	case logrus.WarnLevel:
+		glog.WarningDepth(depth, message)
+	default:
+		glog.InfoDepth(depth, message)
+	}
+	return nil
+}
+
+// sourceHook adds the file and line the entry was logged from, unless it
+// already has them (as the lines redirectGlog logs do).
+type sourceHook struct{}
+
+func (sourceHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (sourceHook) Fire(entry *logrus.Entry) error {
+	if _, ok := entry.Data[LOG_FIELD_SOURCE]; !ok {
+		frame, _ := loggerCaller()
+		entry.Data[LOG_FIELD_SOURCE] = fmt.Sprintf("%s:%d", filepath.Base(frame.File), frame.Line)
+	}
+	return nil
+}
+
+// loggerCaller is the frame of the code that called the Logger, as seen from
+// a hook's Fire, and how many frames up from Fire it is (so that glog can
+// be given the depth to find it at itself).
+func loggerCaller() (runtime.Frame, int) {
+	pcs := make([]uintptr, 32)
+	// Skip runtime.Callers and loggerCaller itself
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	depth := 0
+	for {
+		frame, more := frames.Next()
+		if !strings.Contains(frame.Function, "sirupsen/logrus") && !strings.HasSuffix(frame.Function, "Hook.Fire") {
+			return frame, depth
+		}
+		if !more {
+			return frame, 0
+		}
+		depth++
+	}
+}
+
+// glogRedirect reads what glog writes to stderr, which is replaced with a
+// pipe, and logs it to a Logger.
+type glogRedirect struct {
+	pipe *os.File
+	done chan struct{}
+}
+
+func redirectGlog(logger *logrus.Logger) (*glogRedirect, error) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("Error redirecting glog: %+v", err)
+	}
+	// glog looks os.Stderr up for every line it writes, but logger's
+	// Out is still the real stderr
+	os.Stderr = writer
+	redirect := &glogRedirect{pipe: writer, done: make(chan struct{})}
+	go func() {
+		defer close(redirect.done)
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			logGlogLine(logger, scanner.Text())
+		}
+	}()
+	return redirect, nil
+}
+
+// Flush is glog.Flush, and then waits for everything glog has written to be
+// logged. Like glog.Flush, it's for calling as the operator exits: glog's
+// output is lost after it.
+func (r *glogRedirect) Flush() {
+	glog.Flush()
+	r.pipe.Close()
+	<-r.done
+}
+
+// logGlogLine logs a line of glog's output, which (apart from the second or
+// later line of a message with newlines in) looks like
+// "Lmmdd hh:mm:ss.uuuuuu threadid file:line] message", at the level L
+// stands for.
+func logGlogLine(logger *logrus.Logger, line string) {
+	end := strings.Index(line, "] ")
+	header := strings.Fields(line[:end+1])
+	if end < 0 || len(header) != 4 || len(header[0]) != 5 {
+		logger.Info(line)
+		return
+	}
+	if _, err := strconv.Atoi(header[0][1:]); err != nil {
+		logger.Info(line)
+		return
+	}
+	entry := logger.WithField(LOG_FIELD_SOURCE, strings.TrimSuffix(header[3], "]"))
+	message := line[end+2:]
+	switch header[0][0] {
+	case 'E', 'F':
+		entry.Error(message)
+	case 'W':
+		entry.Warn(message)
+	default:
+		entry.Info(message)
+	}
+}
@@ -5,15 +5,21 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"math"
+	"net"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 
 	"github.com/dotmesh-io/dotmesh/pkg/messaging/nats"
 	"github.com/golang/glog"
+	"github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -71,26 +77,90 @@ const DOTMESH_ROLE_LABEL = "dotmesh.io/role"
 const DOTMESH_ROLE_SERVER = "dotmesh-server"
 const DOTMESH_ROLE_SENTINEL = "dotmesh-sentinel"
 const DOTMESH_ROLE_PVC = "dotmesh-pvc"
+const DOTMESH_ROLE_POOL_PVC = "dotmesh-pool-pvc"
+const DOTMESH_CANARY_LABEL = "dotmesh.io/canary" // "true" on pods running canary.image, "false" on the rest
 
 // ConfigMap keys
 
 const CONFIG_NODE_SELECTOR = "nodeSelector"
 const CONFIG_UPGRADES_URL = "upgradesUrl"
 const CONFIG_UPGRADES_INTERVAL_SECONDS = "upgradesIntervalSeconds"
+const CONFIG_UPGRADES_ENABLED = "upgrades.enabled" // "false" turns upgrade checks off, for air-gapped clusters
+const CONFIG_UPGRADES_PROXY = "upgrades.proxy"     // an HTTP proxy to reach upgradesUrl through
 const CONFIG_FLEXVOLUME_DRIVER_DIR = "flexvolumeDriverDir"
 const CONFIG_POOL_NAME_PREFIX = "poolNamePrefix"
 const CONFIG_LOG_ADDRESS = "logAddress"
+const CONFIG_LOG_ADDRESS_NODE_PREFIX = CONFIG_LOG_ADDRESS + "." // logAddress.{nodeName} overrides logAddress on that node
 const CONFIG_KERNEL_ZFS_VERSION = "kernel.zfsVersion"
+const CONFIG_TRANSFER_MAX_CONCURRENT = "transfer.maxConcurrent"                     // 0 or unset means no limit
+const CONFIG_RPC_RATE_LIMIT_REQUESTS_PER_SECOND = "rpc.rateLimit.requestsPerSecond" // per API key, 0 means no limit
+const CONFIG_RPC_RATE_LIMIT_BURST = "rpc.rateLimit.burst"
 const CONFIG_MODE = "storageMode"
+const CONFIG_OPERATOR_PARALLELISM = "operator.parallelism"                 // how many pods to create or delete at once
+const CONFIG_NETWORK_POLICY_ENABLED = "network.policyEnabled"              // "true" restricts ingress to dotmesh server pods with a NetworkPolicy
+const CONFIG_NETWORK_ALLOW_FROM_NAMESPACES = "network.allowFromNamespaces" // comma-separated namespaces whose pods may use the dotmesh API
+const CONFIG_POD_INIT_CONTAINERS = "pod.initContainers"                    // a JSON []v1.Container, run before require_zfs.sh
+const CONFIG_POD_EXTRA_ENV = "pod.extraEnv"                                // a JSON []v1.EnvVar, added to the outer and inner dotmesh server containers' environment
+const CONFIG_POD_PENDING_TIMEOUT = "pod.pendingTimeoutSeconds"             // how long a dotmesh pod may stay Pending before it's replaced
+const CONFIG_NODE_MIN_AGE_SECONDS = "node.minAgeSeconds"
+const CONFIG_NODE_SCALING_GROUP_LABEL = "node.scalingGroupLabel" // a node label naming its auto-scaling group
+const CONFIG_NODE_MIN_GROUP_SIZE = "node.minGroupSize"
+const CONFIG_NODE_NOT_READY_GRACE_PERIOD_SECONDS = "node.notReadyGracePeriodSeconds" // how long until pods on a NotReady node are treated as orphaned
+
+// etcd client certificates: when etcd.tlsEnabled is "true", the Secret named
+// by etcd.tlsSecretName, holding tls.crt, tls.key and ca.crt, is mounted on
+// dotmesh pods at ETCD_TLS_MOUNT_PATH, and require_zfs.sh copies it to where
+// the inner server can read it to talk to etcd over https.
+const CONFIG_ETCD_TLS_ENABLED = "etcd.tlsEnabled"
+const CONFIG_ETCD_TLS_SECRET_NAME = "etcd.tlsSecretName"
+const ETCD_TLS_MOUNT_PATH = "/etcd-tls"
+const ETCD_CLIENT_ADDRESS_FORMAT = "dotmesh-etcd-cluster-client.%s.svc.cluster.local:2379" // formatted with the namespace
+
+// Canary mode: when canary.image is set, it runs on canary.nodeCount nodes
+// (or canary.nodePercent percent of them), and DOTMESH_IMAGE on the rest.
+// With canary.nodeSelector, a label selector such as "dotmesh.io/canary=true",
+// the canary nodes are chosen from the nodes it matches, all of them unless
+// there's a count or percentage too.
+const CONFIG_CANARY_IMAGE = "canary.image"
+const CONFIG_CANARY_NODE_COUNT = "canary.nodeCount"
+const CONFIG_CANARY_NODE_PERCENT = "canary.nodePercent"
+const CONFIG_CANARY_NODE_SELECTOR = "canary.nodeSelector"
+
+// When bootstrap.autoCreateSecret is "true", a missing dotmesh Secret is
+// created with random credentials, see bootstrap.go.
+const CONFIG_BOOTSTRAP_AUTO_CREATE_SECRET = "bootstrap.autoCreateSecret"
+
+// How pods running the wrong image are replaced, see updatestrategy.go.
+const CONFIG_POD_UPDATE_STRATEGY = "pod.updateStrategy"
+
+// Whether dotmesh pods run privileged, or with just the capabilities they
+// need, and their seccomp profile, see securitycontext.go.
+const CONFIG_POD_PRIVILEGED = "pod.privileged"
+const CONFIG_POD_SECCOMP_PROFILE = "pod.seccompProfile"
+
+// Whether pods that look like dotmesh pods, but haven't got the labels the
+// operator looks for, are deleted rather than just warned about, see
+// orphans.go.
+const CONFIG_ORPHAN_DELETE_UNLABELLED = "orphan.deleteUnlabelled"
 
 const CONFIG_MODE_LOCAL = "local" // Value for CONFIG_MODE
 const CONFIG_LOCAL_POOL_SIZE_PER_NODE = "local.poolSizePerNode"
 const CONFIG_LOCAL_POOL_LOCATION = "local.poolLocation"
+const CONFIG_LOCAL_POOL_SIZE_AUTO = "auto" // Value for CONFIG_LOCAL_POOL_SIZE_PER_NODE, sizing the pool from the node's ephemeral storage
+const CONFIG_LOCAL_POOL_AUTO_FRACTION = "local.poolAutoFraction"
+const CONFIG_LOCAL_POOL_MAX_SIZE = "local.poolMaxSize"
 
 const CONFIG_MODE_PPN = "pvcPerNode" // Value for CONFIG_MODE
 const CONFIG_PPN_POOL_SIZE_PER_NODE = "pvcPerNode.pvSizePerNode"
 const CONFIG_PPN_POOL_STORAGE_CLASS = "pvcPerNode.storageClass"
 
+const CONFIG_MODE_CEPH = "ceph" // Value for CONFIG_MODE
+const CONFIG_CEPH_MONITORS = "ceph.monitors"
+const CONFIG_CEPH_POOL = "ceph.pool"
+const CONFIG_CEPH_USER = "ceph.user"
+const CONFIG_CEPH_SECRET_NAME = "ceph.secretName" // a Secret in dotmesh's namespace holding the user's key
+const CONFIG_CEPH_POOL_SIZE_PER_NODE = "ceph.poolSizePerNode"
+
 // These values are fed in via the build system at link time
 var DOTMESH_VERSION string
 var DOTMESH_IMAGE string
@@ -111,38 +181,148 @@ type dotmeshSentinel struct {
 	pvc  string
 }
 
+// dotmeshNodeSettings are the settings for a node's dotmesh pod that can
+// differ from node to node.
+type dotmeshNodeSettings struct {
+	logAddress    string
+	localPoolSize string // POOL_SIZE in local mode
+}
+
 func main() {
 	// When running as a pod in-cluster, a kubeconfig is not needed. Instead
 	// this will make use of the service account injected into the pod.
 	// However, allow the use of a local kubeconfig as this can make local
 	// development & testing easier.
 	kubeconfig := flag.String("kubeconfig", "", "Path to a kubeconfig file")
+	debounceMs := flag.Int("debounce-ms", 500, "Wait this long after the last cluster event before acting on events")
+	maxDebounceMs := flag.Int("max-debounce-ms", 10000, "But never wait longer than this after the first one")
+
+	// Namespace-scoped mode, for clusters the operator can't have
+	// cluster-wide permissions on
+	namespace := flag.String("namespace", DOTMESH_NAMESPACE, "Namespace to run dotmesh in when --cluster-scoped, so that several dotmesh clusters can share a Kubernetes cluster")
+	clusterScoped := flag.Bool("cluster-scoped", true, "Run dotmesh on the cluster's nodes from --namespace (if false, run it in each of --watch-namespaces instead)")
+	watchNamespaces := flag.String("watch-namespaces", "", "Comma-separated namespaces to run dotmesh in, on the nodes their pods are on, when --cluster-scoped=false")
+
+	// The pod validation webhook is only enabled if it's given an address
+	webhook := webhookConfig{}
+	flag.StringVar(&webhook.address, "webhook-addr", "", "Address to serve the pod validation webhook on, e.g. :8443 (disabled if empty)")
+	flag.StringVar(&webhook.certFile, "webhook-tls-cert", "", "Path to the webhook's TLS certificate")
+	flag.StringVar(&webhook.keyFile, "webhook-tls-key", "", "Path to the webhook's TLS key")
+	flag.StringVar(&webhook.caFile, "webhook-ca-bundle", "", "Path to the CA bundle the API server should trust the webhook's certificate with")
+	flag.StringVar(&webhook.service, "webhook-service", "dotmesh-operator-webhook", "Name of the Service in --namespace that reaches the webhook")
+
+	skipRBACSetup := flag.Bool("skip-rbac-setup", false, "Don't create the dotmesh service account and its roles and bindings, for clusters where RBAC is managed externally")
+
+	logFormat := flag.String("log-format", LOG_FORMAT_GLOG, "Log as glog does (glog), or as a JSON object per line (json)")
+	logVerbosityMap := flag.String("log-verbosity-map", "", "Comma-separated component=level verbosities overriding -v for those components: "+strings.Join(logComponents, ", "))
 
 	// We log to stderr because glog will default to logging to a file.
 	// By setting this debugging is easier via `kubectl logs`
 	flag.Set("logtostderr", "true")
 	flag.Parse()
 
+	logger, flushLogs, err := newLogger(*logFormat)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	defer flushLogs()
+
+	componentVerbosity, err = parseVerbosityMap(*logVerbosityMap)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
 	// Build the client config - optionally using a provided kubeconfig file.
 	config, err := GetClientConfig(*kubeconfig)
 	if err != nil {
-		glog.Fatalf("Failed to load client config: %v", err)
+		logger.Fatalf("Failed to load client config: %v", err)
 	}
 	// Construct the Kubernetes client
 	client, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		glog.Fatalf("Failed to create kubernetes client: %v", err)
+		logger.Fatalf("Failed to create kubernetes client: %v", err)
 	}
 
 	stopCh := make(chan struct{})
 	defer close(stopCh)
 
-	newDotmeshController(client).Run(stopCh)
+	namespaces := []string{*namespace}
+	if !*clusterScoped {
+		namespaces = parseWatchNamespaces(*watchNamespaces)
+		if len(namespaces) == 0 {
+			logger.Fatalf("--watch-namespaces must list at least one namespace when --cluster-scoped=false")
+		}
+		if webhook.address != "" {
+			logger.Fatalf("The pod validation webhook can only be used when --cluster-scoped")
+		}
+	}
+
+	running := &sync.WaitGroup{}
+	controllers := []*dotmeshController{}
+	for _, namespace := range namespaces {
+		controller := newDotmeshController(client, logger, namespace, *clusterScoped, *skipRBACSetup,
+			time.Duration(*debounceMs)*time.Millisecond,
+			time.Duration(*maxDebounceMs)*time.Millisecond,
+		)
+		if webhook.address != "" {
+			err = controller.startWebhook(webhook)
+			if err != nil {
+				logger.Fatalf("Failed to start pod validation webhook: %v", err)
+			}
+		}
+		controllers = append(controllers, controller)
+	}
+	siblingNodes := newServerNodeClaims()
+	for _, controller := range controllers {
+		if !*clusterScoped {
+			controller.siblings = controllers
+			controller.siblingNodes = siblingNodes
+		}
+		controller := controller
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			controller.Run(stopCh)
+		}()
+	}
+	go serveMetrics(logger, controllers)
+	running.Wait()
+}
+
+// serveMetrics serves the metrics every controller registers, and their
+// latest process summaries.
+func serveMetrics(logger *logrus.Logger, controllers []*dotmeshController) {
+	router := mux.NewRouter()
+	router.Handle("/metrics", promhttp.Handler())
+	router.HandleFunc("/debug/last-process-summary", serveLastProcessSummary(controllers)).Methods("GET")
+	err := http.ListenAndServe(":32608", router)
+	logger.Fatal(err)
 }
 
 type dotmeshController struct {
-	client           kubernetes.Interface
-	nodeLister       lister_v1.NodeLister
+	client kubernetes.Interface
+	log    *logrus.Logger
+
+	// The namespace dotmesh runs in, and the node label dotmesh pods are
+	// bound to nodes by. In the usual, cluster-scoped mode, they're
+	// --namespace (DOTMESH_NAMESPACE by default) and DOTMESH_NODE_LABEL,
+	// but in namespace-scoped mode there's a controller per watched
+	// namespace, and nodes can't be labelled (see nsscope.go).
+	namespace     string
+	clusterScoped bool
+	nodeLabel     string
+	// The controllers for every watched namespace, in namespace-scoped
+	// mode, whose server pods this one's mustn't share a node with, and the
+	// nodes they've claimed for their server pods
+	siblings     []*dotmeshController
+	siblingNodes *serverNodeClaims
+
+	// Whether bootstrap leaves the dotmesh service account's RBAC alone
+	skipRBACSetup bool
+
+	// listNodes lists the nodes dotmesh should run on, from nodeInformer's
+	// cache
+	listNodes        func() ([]*v1.Node, error)
 	pvcLister        lister_v1.PersistentVolumeClaimLister
 	sentinelLister   lister_v1.PodLister
 	podLister        lister_v1.PodLister
@@ -150,11 +330,44 @@ type dotmeshController struct {
 	pvcInformer      cache.Controller
 	sentinelInformer cache.Controller
 	podInformer      cache.Controller
-
-	updatesNeeded     bool
+	configInformer   cache.Controller
+	// Every pod in the namespace, for finding orphans in. In
+	// namespace-scoped mode it's nodeInformer's cache, and
+	// namespacePodInformer is nil
+	namespacePodLister   lister_v1.PodLister
+	namespacePodInformer cache.Controller
+	// nodeInformer, when it lists the cluster's nodes, to be remade if
+	// the ConfigMap's nodeSelector changes; nil in namespace-scoped mode
+	restartableNodeInformer *restartableInformer
+
+	// Updates are debounced: process() runs once events have stopped
+	// arriving for debounceDelay, or maxDebounceDelay after the first of
+	// them, whichever is sooner. Both are zero when no update is needed.
+	firstUpdateAt     time.Time
+	lastUpdateAt      time.Time
 	updatesNeededLock *sync.Mutex
+	debounceDelay     time.Duration
+	maxDebounceDelay  time.Duration
+
+	// The ConfigMap, with defaults filled in, and what's parsed from it.
+	// process() holds configLock for reading throughout, so the
+	// configuration can only change between reconciles.
+	configLock *sync.RWMutex
+	config     *v1.ConfigMap
 
-	config *v1.ConfigMap
+	// Extra init containers for dotmesh server pods, from the ConfigMap;
+	// if they're invalid, initContainersErr is returned from process()
+	// rather than creating pods without them
+	initContainers    []v1.Container
+	initContainersErr error
+
+	// Extra environment variables for dotmesh server containers, likewise
+	extraEnv    []v1.EnvVar
+	extraEnvErr error
+
+	// How dotmesh pods are secured, likewise
+	podSecurity    *podSecurity
+	podSecurityErr error
 
 	nodesGauge           *prometheus.GaugeVec
 	dottedNodesGauge     *prometheus.GaugeVec
@@ -162,7 +375,15 @@ type dotmeshController struct {
 	runningPodsGauge     *prometheus.GaugeVec
 	dotmeshesToKillGauge *prometheus.GaugeVec
 	suspendedNodesGauge  *prometheus.GaugeVec
+	replacingNodesGauge  *prometheus.GaugeVec
 	targetMinPodsGauge   *prometheus.GaugeVec
+	pressureNodesGauge   *prometheus.GaugeVec
+
+	reconcileMetrics *reconcileMetrics
+
+	// The latest process() summary, see summary.go
+	lastSummaryLock sync.Mutex
+	lastSummary     *ProcessSummary
 }
 
 func provideDefault(m *map[string]string, key string, deflt string) {
@@ -175,115 +396,159 @@ func provideDefault(m *map[string]string, key string, deflt string) {
 	}
 }
 
-func newDotmeshController(client kubernetes.Interface) *dotmeshController {
+func newDotmeshController(client kubernetes.Interface, log *logrus.Logger, namespace string, clusterScoped bool, skipRBACSetup bool, debounceDelay, maxDebounceDelay time.Duration) *dotmeshController {
+	// Metrics from each namespace's controller are told apart by a
+	// namespace label, which cluster-scoped mode's never needed
+	metricLabels := prometheus.Labels{}
+	nodeLabel := DOTMESH_NODE_LABEL
+	if !clusterScoped {
+		metricLabels["namespace"] = namespace
+		nodeLabel = NAMESPACE_SCOPED_NODE_LABEL
+	}
+
 	rc := &dotmeshController{
 		client:            client,
-		updatesNeeded:     false,
+		log:               log,
+		namespace:         namespace,
+		clusterScoped:     clusterScoped,
+		skipRBACSetup:     skipRBACSetup,
+		nodeLabel:         nodeLabel,
 		updatesNeededLock: &sync.Mutex{},
+		configLock:        &sync.RWMutex{},
+		debounceDelay:     debounceDelay,
+		maxDebounceDelay:  maxDebounceDelay,
 
 		nodesGauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Name: "dm_operator_nodes",
-			Help: "Number of eligible nodes in the cluster",
+			Name:        "dm_operator_nodes",
+			Help:        "Number of eligible nodes in the cluster",
+			ConstLabels: metricLabels,
 		}, []string{}),
 		dottedNodesGauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Name: "dm_operator_nodes_running_dotmesh",
-			Help: "Number of nodes running Dotmesh",
+			Name:        "dm_operator_nodes_running_dotmesh",
+			Help:        "Number of nodes running Dotmesh",
+			ConstLabels: metricLabels,
 		}, []string{}),
 		undottedNodesGauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Name: "dm_operator_nodes_not_running_dotmesh",
-			Help: "Number of nodes not running Dotmesh",
+			Name:        "dm_operator_nodes_not_running_dotmesh",
+			Help:        "Number of nodes not running Dotmesh",
+			ConstLabels: metricLabels,
 		}, []string{}),
 		suspendedNodesGauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Name: "dm_operator_nodes_on_hold",
-			Help: "Number of nodes not ready to run a new Dotmesh yet",
+			Name:        "dm_operator_nodes_on_hold",
+			Help:        "Number of nodes not ready to run a new Dotmesh yet",
+			ConstLabels: metricLabels,
 		}, []string{}),
+		replacingNodesGauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name:        "dm_operator_nodes_replacing_dotmesh",
+			Help:        "Number of nodes temporarily running a new Dotmesh alongside the one it's replacing",
+			ConstLabels: metricLabels,
+		}, []string{}),
+		pressureNodesGauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name:        "dotmesh_nodes_under_pressure",
+			Help:        "Number of nodes under disk, memory or PID pressure, by type",
+			ConstLabels: metricLabels,
+		}, []string{"type"}),
 
 		runningPodsGauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Name: "dm_operator_pods",
-			Help: "Number of Dotmesh pods in the cluster",
+			Name:        "dm_operator_pods",
+			Help:        "Number of Dotmesh pods in the cluster",
+			ConstLabels: metricLabels,
 		}, []string{}),
 		dotmeshesToKillGauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Name: "dm_operator_pods_to_kill",
-			Help: "Number of Dotmesh pods marked for termination",
+			Name:        "dm_operator_pods_to_kill",
+			Help:        "Number of Dotmesh pods marked for termination",
+			ConstLabels: metricLabels,
 		}, []string{}),
 		targetMinPodsGauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Name: "dm_operator_pods_low_water_mark",
-			Help: "Number of Dotmesh pods we won't go below if we can help it",
+			Name:        "dm_operator_pods_low_water_mark",
+			Help:        "Number of Dotmesh pods we won't go below if we can help it",
+			ConstLabels: metricLabels,
 		}, []string{}),
+
+		reconcileMetrics: newReconcileMetrics(metricLabels),
 	}
 
-	config, err := client.Core().ConfigMaps(DOTMESH_NAMESPACE).Get(DOTMESH_CONFIG_MAP, meta_v1.GetOptions{})
+	config, err := client.Core().ConfigMaps(namespace).Get(DOTMESH_CONFIG_MAP, meta_v1.GetOptions{})
 
 	if err != nil {
-		glog.Infof("Error fetching configmap %s/%s: %+v, using defaults", DOTMESH_NAMESPACE, DOTMESH_CONFIG_MAP, err)
-		rc.config = &v1.ConfigMap{Data: map[string]string{}}
-	} else {
-		rc.config = config.DeepCopy()
+		rc.log.Infof("Error fetching configmap %s/%s: %+v, using defaults", namespace, DOTMESH_CONFIG_MAP, err)
+		config = &v1.ConfigMap{}
 	}
+	rc.setConfig(config)
 
-	// Fill in defaults
-	provideDefault(&rc.config.Data, CONFIG_NODE_SELECTOR, "")
-	provideDefault(&rc.config.Data, CONFIG_UPGRADES_URL, "https://checkpoint.dotmesh.com/")
-	provideDefault(&rc.config.Data, CONFIG_UPGRADES_INTERVAL_SECONDS, "14400")
-	provideDefault(&rc.config.Data, CONFIG_FLEXVOLUME_DRIVER_DIR, "/usr/libexec/kubernetes/kubelet-plugins/volume/exec")
-	provideDefault(&rc.config.Data, CONFIG_POOL_NAME_PREFIX, "")
-	provideDefault(&rc.config.Data, CONFIG_LOG_ADDRESS, "")
-	provideDefault(&rc.config.Data, CONFIG_KERNEL_ZFS_VERSION, "")
-	provideDefault(&rc.config.Data, CONFIG_MODE, CONFIG_MODE_LOCAL)
-	provideDefault(&rc.config.Data, CONFIG_LOCAL_POOL_SIZE_PER_NODE, "10G")
-	provideDefault(&rc.config.Data, CONFIG_LOCAL_POOL_LOCATION, "/var/lib/dotmesh")
-	provideDefault(&rc.config.Data, CONFIG_PPN_POOL_SIZE_PER_NODE, "10G")
-	provideDefault(&rc.config.Data, CONFIG_PPN_POOL_STORAGE_CLASS, "standard")
+	// TRACK THE CONFIGMAP, so that changes to it are acted on without
+	// restarting the operator
+	rc.trackConfigMap()
 
 	// TRACK NODES
 
-	nodeIndexer, nodeInformer := cache.NewIndexerInformer(
-		&cache.ListWatch{
-			ListFunc: func(lo meta_v1.ListOptions) (runtime.Object, error) {
-				// Add user-configurable selector to only care about certain nodes
-				lo2 := lo.DeepCopy()
-				if rc.config.Data[CONFIG_NODE_SELECTOR] != "" {
-					lo2.LabelSelector = rc.config.Data[CONFIG_NODE_SELECTOR]
-				}
-				return client.Core().Nodes().List(*lo2)
-			},
-			WatchFunc: func(lo meta_v1.ListOptions) (watch.Interface, error) {
-				// Add user-configurable selector to only care about certain nodes
-				lo2 := lo.DeepCopy()
-				if rc.config.Data[CONFIG_NODE_SELECTOR] != "" {
-					lo2.LabelSelector = rc.config.Data[CONFIG_NODE_SELECTOR]
-				}
-				return client.Core().Nodes().Watch(*lo2)
-			},
-		},
-		// The types of objects this informer will return
-		&v1.Node{},
-		// The resync period of this object. This will force a re-update of all
-		// cached objects at this interval.  Every object will trigger the
-		// `Updatefunc` even if there have been no actual updates triggered.
-		60*time.Second,
-		// Callback Functions to trigger on add/update/delete
-		cache.ResourceEventHandlerFuncs{
-			AddFunc: func(obj interface{}) {
-				glog.V(3).Infof("NODE ADD %#v", obj)
-				rc.scheduleUpdate()
-			},
-			UpdateFunc: func(old, new interface{}) {
-				glog.V(3).Infof("NODE UPDATE %#v -> %#v", old, new)
-				rc.scheduleUpdate()
-			},
-			DeleteFunc: func(obj interface{}) {
-				glog.V(3).Infof("NODE DELETE %#v", obj)
-				rc.scheduleUpdate()
-			},
-		},
-		cache.Indexers{},
-	)
-
-	rc.nodeInformer = nodeInformer
-	// NodeLister avoids some boilerplate code (e.g. convert runtime.Object to
-	// *v1.node)
-	rc.nodeLister = lister_v1.NewNodeLister(nodeIndexer)
+	if clusterScoped {
+		// The nodes are listed with the ConfigMap's nodeSelector, so the
+		// informer is remade when it changes
+		nodes := newRestartableInformer(func() (cache.Indexer, cache.Controller) {
+			return cache.NewIndexerInformer(
+				&cache.ListWatch{
+					ListFunc: func(lo meta_v1.ListOptions) (runtime.Object, error) {
+						// Add user-configurable selector to only care about certain nodes
+						lo2 := lo.DeepCopy()
+						if selector := rc.nodeSelector(); selector != "" {
+							lo2.LabelSelector = selector
+						}
+						return client.Core().Nodes().List(*lo2)
+					},
+					WatchFunc: func(lo meta_v1.ListOptions) (watch.Interface, error) {
+						// Add user-configurable selector to only care about certain nodes
+						lo2 := lo.DeepCopy()
+						if selector := rc.nodeSelector(); selector != "" {
+							lo2.LabelSelector = selector
+						}
+						return client.Core().Nodes().Watch(*lo2)
+					},
+				},
+				// The types of objects this informer will return
+				&v1.Node{},
+				// The resync period of this object. This will force a re-update of all
+				// cached objects at this interval.  Every object will trigger the
+				// `Updatefunc` even if there have been no actual updates triggered.
+				60*time.Second,
+				// Callback Functions to trigger on add/update/delete
+				cache.ResourceEventHandlerFuncs{
+					AddFunc: func(obj interface{}) {
+						rc.logFor(LOG_COMPONENT_INFORMER).V(3).Infof("NODE ADD %#v", obj)
+						rc.scheduleUpdate()
+					},
+					UpdateFunc: func(old, new interface{}) {
+						rc.logFor(LOG_COMPONENT_INFORMER).V(3).Infof("NODE UPDATE %#v -> %#v", old, new)
+						rc.scheduleUpdate()
+					},
+					DeleteFunc: func(obj interface{}) {
+						rc.logFor(LOG_COMPONENT_INFORMER).V(3).Infof("NODE DELETE %#v", obj)
+						rc.scheduleUpdate()
+					},
+				},
+				cache.Indexers{},
+			)
+		})
+
+		rc.nodeInformer = nodes
+		rc.restartableNodeInformer = nodes
+		rc.listNodes = func() ([]*v1.Node, error) {
+			// Until a remade informer has synced, its cache is missing
+			// nodes, whose dotmesh pods mustn't be taken for strays
+			if !nodes.HasSynced() {
+				return nil, fmt.Errorf("Node cache is being resynced, after a change to %s", CONFIG_NODE_SELECTOR)
+			}
+			// NodeLister avoids some boilerplate code (e.g. convert
+			// runtime.Object to *v1.node)
+			return lister_v1.NewNodeLister(nodes.Indexer()).List(labels.Everything())
+		}
+	} else {
+		// Nodes come from the pods in the namespace instead
+		rc.trackWorkloadNodes()
+	}
+	if rc.namespacePodLister == nil {
+		rc.trackNamespacePods()
+	}
 
 	// TRACK DOTMESH SENTINELS
 	sentinelIndexer, sentinelInformer := cache.NewIndexerInformer(
@@ -292,13 +557,13 @@ func newDotmeshController(client kubernetes.Interface) *dotmeshController {
 				// Add selectors to only list Sentinel pods
 				dmLo := lo.DeepCopy()
 				dmLo.LabelSelector = fmt.Sprintf("%s=%s", DOTMESH_ROLE_LABEL, DOTMESH_ROLE_SENTINEL)
-				return client.Core().Pods(DOTMESH_NAMESPACE).List(*dmLo)
+				return client.Core().Pods(namespace).List(*dmLo)
 			},
 			WatchFunc: func(lo meta_v1.ListOptions) (watch.Interface, error) {
 				// Add selectors to only list Dotmesh pods
 				dmLo := lo.DeepCopy()
 				dmLo.LabelSelector = fmt.Sprintf("%s=%s", DOTMESH_ROLE_LABEL, DOTMESH_ROLE_SENTINEL)
-				return client.Core().Pods(DOTMESH_NAMESPACE).Watch(*dmLo)
+				return client.Core().Pods(namespace).Watch(*dmLo)
 			},
 		},
 		// The types of objects this informer will return
@@ -310,15 +575,15 @@ func newDotmeshController(client kubernetes.Interface) *dotmeshController {
 		// Callback Functions to trigger on add/update/delete
 		cache.ResourceEventHandlerFuncs{
 			AddFunc: func(obj interface{}) {
-				glog.V(3).Infof("SENTINEL ADD %#v", obj)
+				rc.logFor(LOG_COMPONENT_INFORMER).V(3).Infof("SENTINEL ADD %#v", obj)
 				rc.scheduleUpdate()
 			},
 			UpdateFunc: func(old, new interface{}) {
-				glog.V(3).Infof("SENTINEL UPDATE %#v -> %#v", old, new)
+				rc.logFor(LOG_COMPONENT_INFORMER).V(3).Infof("SENTINEL UPDATE %#v -> %#v", old, new)
 				rc.scheduleUpdate()
 			},
 			DeleteFunc: func(obj interface{}) {
-				glog.V(3).Infof("SENTINEL DELETE %#v", obj)
+				rc.logFor(LOG_COMPONENT_INFORMER).V(3).Infof("SENTINEL DELETE %#v", obj)
 				rc.scheduleUpdate()
 			},
 		},
@@ -336,14 +601,14 @@ func newDotmeshController(client kubernetes.Interface) *dotmeshController {
 			ListFunc: func(lo meta_v1.ListOptions) (runtime.Object, error) {
 				// Add selectors to only list Dotmesh pods
 				dmLo := lo.DeepCopy()
-				dmLo.LabelSelector = fmt.Sprintf("%s=%s", DOTMESH_ROLE_LABEL, DOTMESH_ROLE_SERVER)
-				return client.Core().Pods(DOTMESH_NAMESPACE).List(*dmLo)
+				dmLo.LabelSelector = rc.serverPodSelector()
+				return client.Core().Pods(namespace).List(*dmLo)
 			},
 			WatchFunc: func(lo meta_v1.ListOptions) (watch.Interface, error) {
 				// Add selectors to only list Dotmesh pods
 				dmLo := lo.DeepCopy()
-				dmLo.LabelSelector = fmt.Sprintf("%s=%s", DOTMESH_ROLE_LABEL, DOTMESH_ROLE_SERVER)
-				return client.Core().Pods(DOTMESH_NAMESPACE).Watch(*dmLo)
+				dmLo.LabelSelector = rc.serverPodSelector()
+				return client.Core().Pods(namespace).Watch(*dmLo)
 			},
 		},
 		// The types of objects this informer will return
@@ -355,15 +620,15 @@ func newDotmeshController(client kubernetes.Interface) *dotmeshController {
 		// Callback Functions to trigger on add/update/delete
 		cache.ResourceEventHandlerFuncs{
 			AddFunc: func(obj interface{}) {
-				glog.V(3).Infof("POD ADD %#v", obj)
+				rc.logFor(LOG_COMPONENT_INFORMER).V(3).Infof("POD ADD %#v", obj)
 				rc.scheduleUpdate()
 			},
 			UpdateFunc: func(old, new interface{}) {
-				glog.V(3).Infof("POD UPDATE %#v -> %#v", old, new)
+				rc.logFor(LOG_COMPONENT_INFORMER).V(3).Infof("POD UPDATE %#v -> %#v", old, new)
 				rc.scheduleUpdate()
 			},
 			DeleteFunc: func(obj interface{}) {
-				glog.V(3).Infof("POD DELETE %#v", obj)
+				rc.logFor(LOG_COMPONENT_INFORMER).V(3).Infof("POD DELETE %#v", obj)
 				rc.scheduleUpdate()
 			},
 		},
@@ -382,13 +647,13 @@ func newDotmeshController(client kubernetes.Interface) *dotmeshController {
 				// Add selectors to only list Dotmesh pvcs
 				dmLo := lo.DeepCopy()
 				dmLo.LabelSelector = fmt.Sprintf("%s=%s", DOTMESH_ROLE_LABEL, DOTMESH_ROLE_PVC)
-				return client.Core().PersistentVolumeClaims(DOTMESH_NAMESPACE).List(*dmLo)
+				return client.Core().PersistentVolumeClaims(namespace).List(*dmLo)
 			},
 			WatchFunc: func(lo meta_v1.ListOptions) (watch.Interface, error) {
 				// Add selectors to only list Dotmesh pvcs
 				dmLo := lo.DeepCopy()
 				dmLo.LabelSelector = fmt.Sprintf("%s=%s", DOTMESH_ROLE_LABEL, DOTMESH_ROLE_PVC)
-				return client.Core().PersistentVolumeClaims(DOTMESH_NAMESPACE).Watch(*dmLo)
+				return client.Core().PersistentVolumeClaims(namespace).Watch(*dmLo)
 			},
 		},
 		// The types of objects this informer will return
@@ -400,15 +665,15 @@ func newDotmeshController(client kubernetes.Interface) *dotmeshController {
 		// Callback Functions to trigger on add/update/delete
 		cache.ResourceEventHandlerFuncs{
 			AddFunc: func(obj interface{}) {
-				glog.V(3).Infof("PVC ADD %#v", obj)
+				rc.logFor(LOG_COMPONENT_INFORMER).V(3).Infof("PVC ADD %#v", obj)
 				rc.scheduleUpdate()
 			},
 			UpdateFunc: func(old, new interface{}) {
-				glog.V(3).Infof("PVC UPDATE %#v -> %#v", old, new)
+				rc.logFor(LOG_COMPONENT_INFORMER).V(3).Infof("PVC UPDATE %#v -> %#v", old, new)
 				rc.scheduleUpdate()
 			},
 			DeleteFunc: func(obj interface{}) {
-				glog.V(3).Infof("PVC DELETE %#v", obj)
+				rc.logFor(LOG_COMPONENT_INFORMER).V(3).Infof("PVC DELETE %#v", obj)
 				rc.scheduleUpdate()
 			},
 		},
@@ -423,96 +688,264 @@ func newDotmeshController(client kubernetes.Interface) *dotmeshController {
 	return rc
 }
 
+// setConfig makes config, with defaults filled in, the controller's
+// configuration, and returns the keys whose values have changed.
+func (c *dotmeshController) setConfig(config *v1.ConfigMap) []string {
+	config = config.DeepCopy()
+	data := map[string]string{}
+	for key, value := range config.Data {
+		data[key] = value
+	}
+
+	// Fill in defaults
+	provideDefault(&data, CONFIG_NODE_SELECTOR, "")
+	provideDefault(&data, CONFIG_UPGRADES_URL, "https://checkpoint.dotmesh.com/")
+	provideDefault(&data, CONFIG_UPGRADES_INTERVAL_SECONDS, "14400")
+	provideDefault(&data, CONFIG_UPGRADES_ENABLED, "true")
+	provideDefault(&data, CONFIG_UPGRADES_PROXY, "")
+	provideDefault(&data, CONFIG_BOOTSTRAP_AUTO_CREATE_SECRET, "false")
+	provideDefault(&data, CONFIG_RPC_RATE_LIMIT_REQUESTS_PER_SECOND, "100")
+	provideDefault(&data, CONFIG_RPC_RATE_LIMIT_BURST, "20")
+	provideDefault(&data, CONFIG_FLEXVOLUME_DRIVER_DIR, "/usr/libexec/kubernetes/kubelet-plugins/volume/exec")
+	provideDefault(&data, CONFIG_POOL_NAME_PREFIX, "")
+	provideDefault(&data, CONFIG_LOG_ADDRESS, "")
+	provideDefault(&data, CONFIG_KERNEL_ZFS_VERSION, "")
+	provideDefault(&data, CONFIG_MODE, CONFIG_MODE_LOCAL)
+	provideDefault(&data, CONFIG_LOCAL_POOL_SIZE_PER_NODE, "10G")
+	provideDefault(&data, CONFIG_LOCAL_POOL_LOCATION, "/var/lib/dotmesh")
+	provideDefault(&data, CONFIG_LOCAL_POOL_AUTO_FRACTION, "0.8")
+	provideDefault(&data, CONFIG_LOCAL_POOL_MAX_SIZE, "500G")
+	provideDefault(&data, CONFIG_POD_INIT_CONTAINERS, "")
+
+	initContainers, initContainersErr := parseInitContainers(data[CONFIG_POD_INIT_CONTAINERS])
+	if initContainersErr != nil {
+		c.log.Error(initContainersErr)
+	}
+	provideDefault(&data, CONFIG_POD_EXTRA_ENV, "")
+
+	extraEnv, extraEnvErr := parseExtraEnv(data[CONFIG_POD_EXTRA_ENV])
+	if extraEnvErr != nil {
+		c.log.Error(extraEnvErr)
+	}
+	provideDefault(&data, CONFIG_PPN_POOL_SIZE_PER_NODE, "10G")
+	provideDefault(&data, CONFIG_PPN_POOL_STORAGE_CLASS, "standard")
+	provideDefault(&data, CONFIG_CEPH_MONITORS, "")
+	provideDefault(&data, CONFIG_CEPH_POOL, "")
+	provideDefault(&data, CONFIG_CEPH_USER, "")
+	provideDefault(&data, CONFIG_CEPH_SECRET_NAME, "")
+	provideDefault(&data, CONFIG_CEPH_POOL_SIZE_PER_NODE, "10G")
+	provideDefault(&data, CONFIG_NODE_NOT_READY_GRACE_PERIOD_SECONDS, "120")
+	provideDefault(&data, CONFIG_NETWORK_ALLOW_FROM_NAMESPACES, "")
+	provideDefault(&data, CONFIG_OPERATOR_PARALLELISM, "10")
+	provideDefault(&data, CONFIG_POD_PENDING_TIMEOUT, "300")
+	provideDefault(&data, CONFIG_POD_UPDATE_STRATEGY, POD_UPDATE_STRATEGY_DELETE_FIRST)
+	provideDefault(&data, CONFIG_POD_PRIVILEGED, "true")
+	provideDefault(&data, CONFIG_POD_SECCOMP_PROFILE, "")
+	provideDefault(&data, CONFIG_ORPHAN_DELETE_UNLABELLED, "false")
+
+	podSecurity, podSecurityErr := parsePodSecurity(data[CONFIG_POD_PRIVILEGED], data[CONFIG_POD_SECCOMP_PROFILE])
+	if podSecurityErr != nil {
+		c.log.Error(podSecurityErr)
+	}
+	provideDefault(&data, CONFIG_NODE_MIN_AGE_SECONDS, "0")
+	provideDefault(&data, CONFIG_NODE_SCALING_GROUP_LABEL, "")
+	provideDefault(&data, CONFIG_NODE_MIN_GROUP_SIZE, "1")
+	provideDefault(&data, CONFIG_ETCD_TLS_ENABLED, "false")
+	provideDefault(&data, CONFIG_ETCD_TLS_SECRET_NAME, "")
+
+	c.configLock.Lock()
+	defer c.configLock.Unlock()
+	var changed []string
+	if c.config != nil {
+		changed = changedConfigKeys(c.config.Data, data)
+	}
+	config.Data = data
+	c.config = config
+	c.initContainers, c.initContainersErr = initContainers, initContainersErr
+	c.extraEnv, c.extraEnvErr = extraEnv, extraEnvErr
+	c.podSecurity, c.podSecurityErr = podSecurity, podSecurityErr
+	return changed
+}
+
 func (c *dotmeshController) scheduleUpdate() {
 	c.updatesNeededLock.Lock()
 	defer c.updatesNeededLock.Unlock()
 
-	c.updatesNeeded = true
+	now := time.Now()
+	if c.firstUpdateAt.IsZero() {
+		c.logFor(LOG_COMPONENT_SCHEDULE).V(2).Infof("Scheduling an update in %s, or once events have stopped arriving for that long", c.debounceDelay)
+		c.firstUpdateAt = now
+	} else {
+		c.logFor(LOG_COMPONENT_SCHEDULE).V(3).Infof("Putting off the update scheduled %s ago, for at most %s", now.Sub(c.firstUpdateAt), c.maxDebounceDelay-now.Sub(c.firstUpdateAt))
+	}
+	c.lastUpdateAt = now
 }
 
 func (c *dotmeshController) Run(stopCh chan struct{}) {
-	glog.Infof("Starting Dotmesh Operator version %s, installing Dotmesh Server image %s", DOTMESH_VERSION, DOTMESH_IMAGE)
+	c.log.Infof("Starting Dotmesh Operator version %s, installing Dotmesh Server image %s in namespace %s", DOTMESH_VERSION, DOTMESH_IMAGE, c.namespace)
 
 	go c.nodeInformer.Run(stopCh)
 	go c.podInformer.Run(stopCh)
 	go c.pvcInformer.Run(stopCh)
 	go c.sentinelInformer.Run(stopCh)
+	go c.configInformer.Run(stopCh)
+	if c.namespacePodInformer != nil {
+		go c.namespacePodInformer.Run(stopCh)
+	}
 
 	// Wait for all caches to be synced, before processing is started
 	if !cache.WaitForCacheSync(stopCh, c.nodeInformer.HasSynced) {
-		glog.Error(fmt.Errorf("Timed out waiting for node cache to sync"))
+		c.log.Error(fmt.Errorf("Timed out waiting for node cache to sync"))
 		return
 	}
 
 	if !cache.WaitForCacheSync(stopCh, c.podInformer.HasSynced) {
-		glog.Error(fmt.Errorf("Timed out waiting for pod cache to sync"))
+		c.log.Error(fmt.Errorf("Timed out waiting for pod cache to sync"))
 		return
 	}
 
 	if !cache.WaitForCacheSync(stopCh, c.pvcInformer.HasSynced) {
-		glog.Error(fmt.Errorf("Timed out waiting for pvc cache to sync"))
+		c.log.Error(fmt.Errorf("Timed out waiting for pvc cache to sync"))
 		return
 	}
 
 	if !cache.WaitForCacheSync(stopCh, c.sentinelInformer.HasSynced) {
-		glog.Error(fmt.Errorf("Timed out waiting for sentinel cache to sync"))
+		c.log.Error(fmt.Errorf("Timed out waiting for sentinel cache to sync"))
+		return
+	}
+
+	if !cache.WaitForCacheSync(stopCh, c.configInformer.HasSynced) {
+		c.log.Error(fmt.Errorf("Timed out waiting for configmap cache to sync"))
 		return
 	}
 
-	// Set up the monitoring HTTP server
+	if c.namespacePodInformer != nil && !cache.WaitForCacheSync(stopCh, c.namespacePodInformer.HasSynced) {
+		c.log.Error(fmt.Errorf("Timed out waiting for namespace pod cache to sync"))
+		return
+	}
+
+	err := c.bootstrap()
+	if err != nil {
+		c.log.Error(err)
+	}
+
+	// The servers' DNS names don't depend on anything that changes, so the
+	// service for them needn't be reconciled by process()
+	err = c.ensureServersService()
+	if err != nil {
+		c.log.Error(err)
+	}
+
+	// Register with the monitoring HTTP server
 
-	router := mux.NewRouter()
-	router.Handle("/metrics", promhttp.Handler())
 	prometheus.MustRegister(c.nodesGauge)
 	prometheus.MustRegister(c.dottedNodesGauge)
 	prometheus.MustRegister(c.undottedNodesGauge)
 	prometheus.MustRegister(c.runningPodsGauge)
 	prometheus.MustRegister(c.dotmeshesToKillGauge)
 	prometheus.MustRegister(c.suspendedNodesGauge)
+	prometheus.MustRegister(c.replacingNodesGauge)
 	prometheus.MustRegister(c.targetMinPodsGauge)
-	go func() {
-		err := http.ListenAndServe(":32608", router)
-		glog.Fatal(err)
-	}()
+	prometheus.MustRegister(c.pressureNodesGauge)
+	c.reconcileMetrics.register()
 
 	// Start the polling loop
 
-	go wait.Until(c.runWorker, time.Second, stopCh)
+	// runWorker does its own waiting, so that it can act as soon as
+	// updates are debounced
+	go wait.Until(c.runWorker, 0, stopCh)
 
 	<-stopCh
-	glog.Info("Stopping Dotmesh Operator")
+	c.log.Info("Stopping Dotmesh Operator")
 }
 
 func (c *dotmeshController) runWorker() {
-	needed :=
-		func() bool {
+	needed, wait :=
+		func() (bool, time.Duration) {
 			c.updatesNeededLock.Lock()
 			defer c.updatesNeededLock.Unlock()
-			needed := c.updatesNeeded
-			c.updatesNeeded = false
-			return needed
+			if c.lastUpdateAt.IsZero() {
+				return false, time.Second
+			}
+			now := time.Now()
+			wait := c.lastUpdateAt.Add(c.debounceDelay).Sub(now)
+			if untilMax := c.firstUpdateAt.Add(c.maxDebounceDelay).Sub(now); untilMax < wait {
+				wait = untilMax
+			}
+			if wait > 0 {
+				// Events are still arriving, wait for them to settle
+				return false, wait
+			}
+			c.firstUpdateAt = time.Time{}
+			c.lastUpdateAt = time.Time{}
+			return true, 0
 		}()
 
 	if needed {
-		err := c.process()
+		summary, err := c.process()
+		c.reconcileMetrics.observeReconcile(summary.Started, err)
+		c.recordSummary(summary)
 		if err != nil {
-			glog.Error(err)
+			c.log.Error(err)
 		}
 	} else {
-		time.Sleep(time.Second)
+		time.Sleep(wait)
 	}
 }
 
-func (c *dotmeshController) process() error {
-	glog.V(1).Info("Analysing cluster status...")
+func (c *dotmeshController) process() (summary ProcessSummary, err error) {
+	summary.Started = time.Now()
+	defer func() {
+		summary.Duration = time.Since(summary.Started)
+		summary.Errors = errorMessages(err)
+	}()
+
+	c.configLock.RLock()
+	defer c.configLock.RUnlock()
+
+	c.logFor(LOG_COMPONENT_PROCESS).V(1).Info("Analysing cluster status...")
+
+	// RESTRICT TRAFFIC TO DOTMESH PODS
+
+	if c.initContainersErr != nil {
+		return summary, c.reconcileMetrics.reconcileError(RECONCILE_CONFIG_INVALID, c.initContainersErr)
+	}
+	if c.extraEnvErr != nil {
+		return summary, c.reconcileMetrics.reconcileError(RECONCILE_CONFIG_INVALID, c.extraEnvErr)
+	}
+	if c.podSecurityErr != nil {
+		return summary, c.reconcileMetrics.reconcileError(RECONCILE_CONFIG_INVALID, c.podSecurityErr)
+	}
+
+	err = c.ensureNetworkPolicy()
+	if err != nil {
+		return summary, err
+	}
+
+	if c.config.Data[CONFIG_BOOTSTRAP_AUTO_CREATE_SECRET] == "true" {
+		err = c.ensureDotmeshSecret()
+		if err != nil {
+			return summary, err
+		}
+	}
+
+	if c.config.Data[CONFIG_MODE] == CONFIG_MODE_CEPH {
+		if !c.clusterScoped {
+			return summary, c.reconcileMetrics.reconcileError(RECONCILE_CONFIG_INVALID, fmt.Errorf("%s %s needs a StorageClass, which a namespace-scoped operator can't create", CONFIG_MODE, CONFIG_MODE_CEPH))
+		}
+		err = c.ensureCephStorageClass()
+		if err != nil {
+			return summary, err
+		}
+	}
 
 	// EXAMINE NODES
 
 	// nodes is a []*v1.Node
 	// v1.Node is documented at https://godoc.org/k8s.io/api/core/v1#Node
-	nodes, err := c.nodeLister.List(labels.Everything())
+	nodes, err := c.listNodes()
 	if err != nil {
-		return err
+		return summary, c.reconcileMetrics.reconcileError(RECONCILE_NODE_LIST_FAILED, err)
 	}
 
 	// Set of all node IDs
@@ -524,11 +957,72 @@ func (c *dotmeshController) process() error {
 
 	// Set of node IDs where starting new Dotmeshes is temporarily prohibited
 	suspendedNodes := map[string]struct{}{}
+	summary.NodesUnderPressure = map[string]int{NODE_PRESSURE_DISK: 0, NODE_PRESSURE_MEMORY: 0, NODE_PRESSURE_PID: 0}
+
+	// Map from node ID to when it became NotReady, for nodes that are;
+	// new Dotmeshes aren't started on them, and existing ones are left
+	// alone until the grace period is up
+	notReadyNodes := map[string]time.Time{}
+
+	gracePeriodSeconds, err := c.configInt(CONFIG_NODE_NOT_READY_GRACE_PERIOD_SECONDS, 0)
+	if err != nil {
+		return summary, c.reconcileMetrics.reconcileError(RECONCILE_CONFIG_INVALID, err)
+	}
+	notReadyGracePeriod := time.Duration(gracePeriodSeconds) * time.Second
+
+	pendingTimeoutSeconds, err := c.configInt(CONFIG_POD_PENDING_TIMEOUT, 0)
+	if err != nil {
+		return summary, c.reconcileMetrics.reconcileError(RECONCILE_CONFIG_INVALID, err)
+	}
+	pendingTimeout := time.Duration(pendingTimeoutSeconds) * time.Second
+
+	updateStrategy, err := c.podUpdateStrategy()
+	if err != nil {
+		return summary, c.reconcileMetrics.reconcileError(RECONCILE_CONFIG_INVALID, err)
+	}
+
+	parallelism, err := c.configInt(CONFIG_OPERATOR_PARALLELISM, 1)
+	if err != nil {
+		return summary, c.reconcileMetrics.reconcileError(RECONCILE_CONFIG_INVALID, err)
+	}
+
+	// New nodes only get a Dotmesh once they're node.minAgeSeconds old,
+	// and, if node.scalingGroupLabel is set, once their scaling group has
+	// at least node.minGroupSize nodes, so that nodes an autoscaler adds
+	// and soon removes again don't get one. (Nodes' status is updated
+	// regularly, which re-runs this as they age.)
+	minAgeSeconds, err := c.configInt(CONFIG_NODE_MIN_AGE_SECONDS, 0)
+	if err != nil {
+		return summary, c.reconcileMetrics.reconcileError(RECONCILE_CONFIG_INVALID, err)
+	}
+	minNodeAge := time.Duration(minAgeSeconds) * time.Second
+	minGroupSize, err := c.configInt(CONFIG_NODE_MIN_GROUP_SIZE, 0)
+	if err != nil {
+		return summary, c.reconcileMetrics.reconcileError(RECONCILE_CONFIG_INVALID, err)
+	}
+	scalingGroupLabel := c.config.Data[CONFIG_NODE_SCALING_GROUP_LABEL]
+	scalingGroupSizes := map[string]int{}
+	if scalingGroupLabel != "" {
+		for _, node := range nodes {
+			if group, ok := node.ObjectMeta.Labels[scalingGroupLabel]; ok && !node.Spec.Unschedulable {
+				scalingGroupSizes[group]++
+			}
+		}
+	}
+
+	// Map from node ID to the settings for dotmesh pods on that node
+	nodeSettings := map[string]dotmeshNodeSettings{}
+	// Map from node ID to the node's labels, for choosing canary nodes by
+	nodeLabels := map[string]labels.Set{}
 
 	// Ensure nodes are labelled correctly, so we can bind Dotmesh instances to them
 	for _, node := range nodes {
 		nodeName := node.ObjectMeta.Name
-		labelName, ok := node.ObjectMeta.Labels[DOTMESH_NODE_LABEL]
+		if !c.nodeInCluster(node) {
+			c.logFor(LOG_COMPONENT_PROCESS).V(2).Infof("Ignoring node %s, as its %s label gives it to another dotmesh cluster", nodeName, DOTMESH_CLUSTER_LABEL)
+			continue
+		}
+		labelName, ok := node.ObjectMeta.Labels[c.nodeLabel]
 
 		// We COULD use something other than the k8s node name as the
 		// label name; if so, here is the place to do that.  The code
@@ -538,22 +1032,31 @@ func (c *dotmeshController) process() error {
 		// id.
 		if !ok || labelName != nodeName {
 			n2 := node.DeepCopy()
-			n2.ObjectMeta.Labels[DOTMESH_NODE_LABEL] = nodeName
-			glog.Infof("Labelling unfamiliar node %s so we can bind a Dotmesh to it", n2.ObjectMeta.Name)
+			n2.ObjectMeta.Labels[c.nodeLabel] = nodeName
+			c.log.Infof("Labelling unfamiliar node %s so we can bind a Dotmesh to it", n2.ObjectMeta.Name)
 			_, err := c.client.Core().Nodes().Update(n2)
 			if err != nil {
-				return err
+				return summary, err
 			}
 			// Don't try to work with this node yet; it needs its label
 			// in place, so wait until the change to the node of it
 			// getting a label re-triggers this algorithm before we
 			// process it.
 		} else {
+			nodeLabels[labelName] = labels.Set(node.ObjectMeta.Labels)
 			if node.Spec.Unschedulable {
 				// Mark unschedulable nodes as valid (so existing dotmesh
 				// pods won't be killed) but not even consider them as
 				// undotted (so new dotmesh pods won't get created).
-				glog.V(2).Infof("Ignoring node %s as it's marked as unschedulable", node.ObjectMeta.Name)
+				c.logFor(LOG_COMPONENT_PROCESS).V(2).Infof("Ignoring node %s as it's marked as unschedulable", node.ObjectMeta.Name)
+				validNodes[labelName] = struct{}{}
+			} else if age := time.Since(node.ObjectMeta.CreationTimestamp.Time); age < minNodeAge {
+				// Likewise for nodes that are too new, or in too small a
+				// scaling group
+				c.logFor(LOG_COMPONENT_PROCESS).V(2).Infof("Ignoring node %s for now as it's only %s old", node.ObjectMeta.Name, age)
+				validNodes[labelName] = struct{}{}
+			} else if group, ok := node.ObjectMeta.Labels[scalingGroupLabel]; scalingGroupLabel != "" && ok && scalingGroupSizes[group] < minGroupSize {
+				c.logFor(LOG_COMPONENT_PROCESS).V(2).Infof("Ignoring node %s as its scaling group %s has only %d node(s)", node.ObjectMeta.Name, group, scalingGroupSizes[group])
 				validNodes[labelName] = struct{}{}
 			} else {
 				// This node is correctly labelled, so add it to the list of
@@ -561,20 +1064,56 @@ func (c *dotmeshController) process() error {
 				// we will eliminate it from that list when we examine the
 				// list of dotmesh pods, if we find a dotmesh pod running on
 				// that node.
-				glog.V(2).Infof("Observing node %s (labelled %s)", node.ObjectMeta.Name, labelName)
+				c.logFor(LOG_COMPONENT_PROCESS).V(2).Infof("Observing node %s (labelled %s)", node.ObjectMeta.Name, labelName)
 				undottedNodes[labelName] = struct{}{}
 				validNodes[labelName] = struct{}{}
 			}
+
+			for _, condition := range node.Status.Conditions {
+				if condition.Type == v1.NodeReady && condition.Status != v1.ConditionTrue {
+					c.log.Infof("Node %s is NotReady since %s (%s: %s), not starting a Dotmesh on it", nodeName, condition.LastTransitionTime, condition.Reason, condition.Message)
+					notReadyNodes[labelName] = condition.LastTransitionTime.Time
+				}
+				if pressure, ok := nodePressureCondition(condition); ok {
+					summary.NodesUnderPressure[pressure]++
+					if pressure == NODE_PRESSURE_DISK {
+						c.log.Warnf("Node %s is under disk pressure since %s (%s: %s), not starting a Dotmesh on it", nodeName, condition.LastTransitionTime, condition.Reason, condition.Message)
+						suspendedNodes[labelName] = struct{}{}
+					} else {
+						c.log.Warnf("Node %s is under %s pressure since %s (%s: %s)", nodeName, pressure, condition.LastTransitionTime, condition.Reason, condition.Message)
+					}
+				}
+			}
+
+			logAddress, err := c.logAddressForNode(nodeName)
+			if err != nil {
+				return summary, c.reconcileMetrics.reconcileError(RECONCILE_CONFIG_INVALID, err)
+			}
+			localPoolSize, err := c.localPoolSizeForNode(node)
+			if err != nil {
+				return summary, c.reconcileMetrics.reconcileError(RECONCILE_CONFIG_INVALID, err)
+			}
+			nodeSettings[labelName] = dotmeshNodeSettings{
+				logAddress:    logAddress,
+				localPoolSize: localPoolSize,
+			}
 		}
 	}
 
+	// CHOOSE CANARY NODES
+
+	canaryNodes, err := c.chooseCanaryNodes(validNodes, nodeLabels)
+	if err != nil {
+		return summary, c.reconcileMetrics.reconcileError(RECONCILE_CONFIG_INVALID, err)
+	}
+
 	// GET A LIST OF DOTMESH PVCS
 
 	// pvcs is a []*v1.PersistentVolumeClaim
 	// v1.PersistentVolumeClaim is documented at https://godoc.org/k8s.io/api/core/v1#PersistentVolumeClaim
 	pvcs, err := c.pvcLister.List(labels.Everything())
 	if err != nil {
-		return err
+		return summary, err
 	}
 
 	unusedPVCs := map[string]struct{}{}
@@ -589,7 +1128,7 @@ func (c *dotmeshController) process() error {
 	sentinels := map[string]dotmeshSentinel{} // Set of sentinel pod IDs that are in the "Running" state
 	sentinelPods, err := c.sentinelLister.List(labels.Everything())
 	if err != nil {
-		return err
+		return summary, err
 	}
 
 	for _, sentinel := range sentinelPods {
@@ -601,13 +1140,13 @@ func (c *dotmeshController) process() error {
 			c.logPodInfo(sentinel)
 
 			// Broken, delete it
-			glog.Infof("Deleting pod %s", sentinelName)
+			c.log.Infof("Deleting pod %s", sentinelName)
 			dp := meta_v1.DeletePropagationBackground
-			err = c.client.Core().Pods(DOTMESH_NAMESPACE).Delete(sentinelName, &meta_v1.DeleteOptions{
+			err = c.client.Core().Pods(c.namespace).Delete(sentinelName, &meta_v1.DeleteOptions{
 				PropagationPolicy: &dp,
 			})
 			if err != nil {
-				glog.Error(err)
+				c.log.Error(c.reconcileMetrics.reconcileError(RECONCILE_POD_DELETE_FAILED, err))
 			}
 			continue
 		}
@@ -619,9 +1158,9 @@ func (c *dotmeshController) process() error {
 			}
 		}
 
-		sentinelNode, ok := sentinel.Spec.NodeSelector[DOTMESH_NODE_LABEL]
+		sentinelNode, ok := sentinel.Spec.NodeSelector[c.nodeLabel]
 		if !ok {
-			glog.Infof("Observing sentinel %s - cannot find %s label", sentinelName, DOTMESH_NODE_LABEL)
+			c.log.Infof("Observing sentinel %s - cannot find %s label", sentinelName, c.nodeLabel)
 		}
 		sentinels[sentinelNode] = dotmeshSentinel{
 			name: sentinelName,
@@ -635,13 +1174,26 @@ func (c *dotmeshController) process() error {
 	// v1.Pod is documented at https://godoc.org/k8s.io/api/core/v1#Pod
 	dotmeshes, err := c.podLister.List(labels.Everything())
 	if err != nil {
-		return err
+		return summary, err
 	}
 
+	// Pods that look like dotmesh pods, but the listers can't see
+	summary.PodsOrphaned = c.handleOrphanedPods(sentinelPods, dotmeshes)
+
+	// More than one pod acting as the master for a filesystem is only
+	// reported, see splitbrain.go
+	summary.SplitBrainFilesystems = c.detectSplitBrain(dotmeshes)
+
 	dotmeshesToKill := map[string]struct{}{} // Set of pod IDs of dotmesh pods that need to die
 	dotmeshIsRunning := map[string]bool{}    // Set of pod IDs that are in the "Running" state
+	dotmeshLabels := map[string]map[string]string{}
 
 	runningPodCount := 0
+	pendingPodCount := 0
+	failedPodCount := 0
+	stuckPendingPods := map[string]struct{}{} // Set of UIDs of pods Pending for longer than pendingTimeout
+	outdatedPods := map[string]string{}       // Map from node to its running pod with the wrong image, under createFirst
+	currentPodReady := map[string]bool{}      // Map from node to whether its pod with the right image is Ready
 
 	for _, dotmesh := range dotmeshes {
 		podName := dotmesh.ObjectMeta.Name
@@ -649,8 +1201,14 @@ func (c *dotmeshController) process() error {
 		var pvcAttachedToPod string
 
 		dotmeshIsRunning[podName] = status == v1.PodRunning
-		if status == v1.PodRunning {
+		dotmeshLabels[podName] = dotmesh.ObjectMeta.Labels
+		switch status {
+		case v1.PodRunning:
 			runningPodCount++
+		case v1.PodPending:
+			pendingPodCount++
+		case v1.PodFailed:
+			failedPodCount++
 		}
 
 		// Find any PVCs bound to this pod, and knock them out of
@@ -671,17 +1229,36 @@ func (c *dotmeshController) process() error {
 
 		// Find the node this pod is bound to, as if it's starting up it
 		// won't actually be scheduled onto that node yet
-		boundNode, ok := dotmesh.Spec.NodeSelector[DOTMESH_NODE_LABEL]
+		boundNode, ok := dotmesh.Spec.NodeSelector[c.nodeLabel]
 		if !ok {
-			glog.Infof("Observing pod %s - cannot find %s label", podName, DOTMESH_NODE_LABEL)
+			c.log.Infof("Observing pod %s - cannot find %s label", podName, c.nodeLabel)
 			// Weird and strange, mark it for death
 			dotmeshesToKill[podName] = struct{}{}
 			continue
 		}
 
+		// A pod that's been Pending too long may never start (the
+		// scheduler can't place it, say), and would stop a new one being
+		// created on its node forever
+		if status == v1.PodPending {
+			pendingSince := dotmesh.ObjectMeta.CreationTimestamp.Time
+			if dotmesh.Status.StartTime != nil {
+				pendingSince = dotmesh.Status.StartTime.Time
+			}
+			pendingFor := time.Since(pendingSince)
+			if pendingFor > pendingTimeout {
+				c.log.Infof("Observing pod %s - it has been Pending for %s, replacing it", podName, pendingFor)
+				stuckPendingPods[string(dotmesh.ObjectMeta.UID)] = struct{}{}
+				dotmeshesToKill[podName] = struct{}{}
+				// But don't try starting any new dotmesh on the node it's SUPPOSED to be on until it's gone
+				suspendedNodes[boundNode] = struct{}{}
+				continue
+			}
+		}
+
 		// Find the image this pod is running
 		if len(dotmesh.Spec.Containers) != 1 {
-			glog.Infof("Observing pod %s - it has %d containers, should be 1", podName, len(dotmesh.Spec.Containers))
+			c.log.Infof("Observing pod %s - it has %d containers, should be 1", podName, len(dotmesh.Spec.Containers))
 			// Weird and strange, mark it for death
 			dotmeshesToKill[podName] = struct{}{}
 			// But don't try starting any new dotmesh on the node it's SUPPOSED to be on until it's gone
@@ -689,11 +1266,30 @@ func (c *dotmeshController) process() error {
 			continue
 		}
 
+		// Pods from before the role label included the namespace are
+		// replaced, so that the Service and NetworkPolicy cover them
+		if dotmesh.ObjectMeta.Labels[DOTMESH_ROLE_LABEL] != c.serverRole() {
+			c.log.Infof("Observing pod %s - its %s label is %s, should be %s", podName, DOTMESH_ROLE_LABEL, dotmesh.ObjectMeta.Labels[DOTMESH_ROLE_LABEL], c.serverRole())
+			dotmeshesToKill[podName] = struct{}{}
+			// But don't try starting any new dotmesh on the node it's SUPPOSED to be on until it's gone
+			suspendedNodes[boundNode] = struct{}{}
+			continue
+		}
+
 		image := dotmesh.Spec.Containers[0].Image
 
 		//check version dotmesh-server image
-		if image != DOTMESH_IMAGE {
-			glog.V(2).Infof("Observing pod %s running wrong image %s (should be %s)", podName, image, DOTMESH_IMAGE)
+		_, canary := canaryNodes[boundNode]
+		expectedImage := c.dotmeshImage(canary)
+		if image != expectedImage {
+			c.logFor(LOG_COMPONENT_PROCESS).V(2).Infof("Observing pod %s running wrong image %s (should be %s)", podName, image, expectedImage)
+			_, replacing := outdatedPods[boundNode]
+			if updateStrategy == POD_UPDATE_STRATEGY_CREATE_FIRST && status == v1.PodRunning && !replacing {
+				// Leave it be, and the node undotted, until its
+				// replacement is Ready
+				outdatedPods[boundNode] = podName
+				continue
+			}
 			dotmeshesToKill[podName] = struct{}{}
 			// But don't try starting any new dotmesh on the node it's SUPPOSED to be on until it's gone
 			suspendedNodes[boundNode] = struct{}{}
@@ -704,7 +1300,7 @@ func (c *dotmeshController) process() error {
 		// This is not set if the pod isn't running yet
 		if runningNode != "" {
 			if runningNode != boundNode {
-				glog.Infof("Observing pod %s - running on node %s but bound to node %s", podName, runningNode, boundNode)
+				c.log.Infof("Observing pod %s - running on node %s but bound to node %s", podName, runningNode, boundNode)
 				// Weird and strange, mark it for death
 				dotmeshesToKill[podName] = struct{}{}
 
@@ -717,15 +1313,23 @@ func (c *dotmeshController) process() error {
 
 		_, nodeOk := validNodes[boundNode]
 		if !nodeOk {
-			glog.Infof("Observing pod %s - bound to invalid node %s", podName, boundNode)
+			c.log.Infof("Observing pod %s - bound to invalid node %s", podName, boundNode)
 			// Weird and strange, mark it for death
 			dotmeshesToKill[podName] = struct{}{}
 			continue
 		}
 
+		notReadySince, notReady := notReadyNodes[boundNode]
+		if notReady && time.Since(notReadySince) > notReadyGracePeriod {
+			c.log.Infof("Observing pod %s - node %s has been NotReady since %s, treating the pod as orphaned", podName, boundNode, notReadySince)
+			// Mark it for death, so its PVC (if any) can be used elsewhere
+			dotmeshesToKill[podName] = struct{}{}
+			continue
+		}
+
 		if status == v1.PodFailed || status == v1.PodSucceeded {
 			c.logPodInfo(dotmesh)
-			glog.Infof("Observing pod %s - on node %s found to be in status %s", podName, boundNode, status)
+			c.log.Infof("Observing pod %s - on node %s found to be in status %s", podName, boundNode, status)
 			// Broken, mark it for death
 			dotmeshesToKill[podName] = struct{}{}
 
@@ -737,34 +1341,36 @@ func (c *dotmeshController) process() error {
 		// At this point, we believe this is a valid running Dotmesh pod.
 		// That node has a dotmesh, so isn't undotted.
 
-		glog.V(2).Infof("Observing pod %s running %s on %s (status: %s)", podName, image, boundNode, dotmesh.Status.Phase)
+		c.logFor(LOG_COMPONENT_PROCESS).V(2).Infof("Observing pod %s running %s on %s (status: %s)", podName, image, boundNode, dotmesh.Status.Phase)
 		delete(undottedNodes, boundNode)
+		currentPodReady[boundNode] = currentPodReady[boundNode] || podReady(dotmesh)
 
 		// Check sentinels running on pod
 		if dotmeshIsRunning[podName] {
 			_, sentinelFound := sentinels[runningNode]
 			if c.config.Data[CONFIG_MODE] == CONFIG_MODE_PPN && !sentinelFound {
-				glog.Infof("Dotmesh pod without Sentinel found. Creating new sentinel. PodName %s on Node %s ", podName, runningNode)
+				c.log.Infof("Dotmesh pod without Sentinel found. Creating new sentinel. PodName %s on Node %s ", podName, runningNode)
 				if pvcAttachedToPod != "" {
-					c.createSentinelPod(pvcAttachedToPod, runningNode)
+					err := c.createSentinelPod(pvcAttachedToPod, runningNode)
+					if err != nil {
+						// Do not abort in error case, just keep pressing on
+						c.log.Error(err)
+					}
 				} else {
-					glog.Infof("No PVC attached to Pod and pod is in pvcPerNodeMode, scheduling pod ot be killed. PodName %s on Node : %s", podName, runningNode)
+					c.log.Infof("No PVC attached to Pod and pod is in pvcPerNodeMode, scheduling pod ot be killed. PodName %s on Node : %s", podName, runningNode)
 					dotmeshesToKill[podName] = struct{}{}
 				}
 			}
 		}
 	}
 
-	dottedNodeCount := len(validNodes) - len(undottedNodes)
+	c.reconcileMetrics.countStuckPending(stuckPendingPods)
 
-	c.nodesGauge.WithLabelValues().Set(float64(len(validNodes)))
-	c.dottedNodesGauge.WithLabelValues().Set(float64(dottedNodeCount))
-	c.undottedNodesGauge.WithLabelValues().Set(float64(len(undottedNodes)))
-	c.runningPodsGauge.WithLabelValues().Set(float64(runningPodCount))
-	c.dotmeshesToKillGauge.WithLabelValues().Set(float64(len(dotmeshesToKill)))
-	c.suspendedNodesGauge.WithLabelValues().Set(float64(len(suspendedNodes)))
+	replacingNodes := c.replaceOutdatedPods(outdatedPods, undottedNodes, currentPodReady, dotmeshesToKill)
+
+	dottedNodeCount := len(validNodes) - len(undottedNodes)
 
-	glog.V(1).Infof("%d healthy-looking dotmeshes exist to run on %d nodes; %d of them seem to be actually running; %d dotmeshes need deleting, and %d out of %d undotted nodes are temporarily suspended",
+	c.logFor(LOG_COMPONENT_PROCESS).V(1).Infof("%d healthy-looking dotmeshes exist to run on %d nodes; %d of them seem to be actually running; %d dotmeshes need deleting, and %d out of %d undotted nodes are temporarily suspended",
 		dottedNodeCount, len(validNodes),
 		runningPodCount,
 		len(dotmeshesToKill),
@@ -797,45 +1403,338 @@ func (c *dotmeshController) process() error {
 	// available), and consider *that* the population.
 	clusterPopulation := runningPodCount
 
-	glog.V(1).Infof("%d/%d nodes might just be running or getting there, minimum target is %d",
+	c.logFor(LOG_COMPONENT_PROCESS).V(1).Infof("%d/%d nodes might just be running or getting there, minimum target is %d",
 		clusterPopulation, len(validNodes),
 		clusterMinimumPopulation)
 
-	c.targetMinPodsGauge.WithLabelValues().Set(float64(clusterMinimumPopulation))
+	// What's been seen, for runWorker to update the metrics and the status
+	// ConfigMap with
+	summary.Analysed = true
+	summary.NodesTotal = len(validNodes)
+	summary.NodesDotted = dottedNodeCount
+	summary.NodesUndotted = len(undottedNodes)
+	summary.NodesSuspended = len(suspendedNodes)
+	summary.NodesReplacing = len(replacingNodes)
+	summary.PodsRunning = runningPodCount
+	summary.PodsPending = pendingPodCount
+	summary.PodsFailed = failedPodCount
+	summary.PodsToKill = len(dotmeshesToKill)
+	summary.ClusterMinimum = clusterMinimumPopulation
+
+	// Deletions run in parallel, so each one that would take a running pod
+	// away takes it out of clusterPopulation before it starts; if it fails,
+	// the pod is put back.
+	clusterPopulationLock := &sync.Mutex{}
+	deletions := newBoundedGroup(parallelism)
+
+	// Running pods are also spared if a PodDisruptionBudget says so; if
+	// the budgets can't be read, the operator carries on without them
+	budgets, err := c.exhaustedDisruptionBudgets()
+	if err != nil {
+		c.log.Warn(err)
+		budgets = disruptionBudgets{}
+	}
 
 	for dotmeshName, _ := range dotmeshesToKill {
-		if glog.V(4) {
-			glog.Infof("Sparing pod %s so it can be debugged", dotmeshName)
-		} else {
-			if !dotmeshIsRunning[dotmeshName] || clusterPopulation > clusterMinimumPopulation {
-				glog.Infof("Deleting pod %s", dotmeshName)
-				dp := meta_v1.DeletePropagationBackground
-				err = c.client.Core().Pods(DOTMESH_NAMESPACE).Delete(dotmeshName, &meta_v1.DeleteOptions{
-					PropagationPolicy: &dp,
-				})
-				if err != nil {
-					// Do not abort in error case, just keep pressing on
-					glog.Error(err)
-				}
+		if c.logFor(LOG_COMPONENT_PROCESS).Enabled(4) {
+			c.log.Infof("Sparing pod %s so it can be debugged", dotmeshName)
+			continue
+		}
 
-				if dotmeshIsRunning[dotmeshName] {
-					// We're killing a running pod
-					clusterPopulation--
-				}
-			} else {
-				glog.Infof("Sparing pod %s to rate-limit the deletion of running pods", dotmeshName)
+		running := dotmeshIsRunning[dotmeshName]
+		if running {
+			if budget := budgets.blocking(dotmeshLabels[dotmeshName]); budget != "" {
+				c.log.Infof("Sparing pod %s as pod disruption budget %s allows no disruptions", dotmeshName, budget)
+				continue
 			}
 		}
+
+		clusterPopulationLock.Lock()
+		spare := running && clusterPopulation <= clusterMinimumPopulation
+		if !spare && running {
+			// We're killing a running pod
+			clusterPopulation--
+		}
+		clusterPopulationLock.Unlock()
+		if spare {
+			c.log.Infof("Sparing pod %s to rate-limit the deletion of running pods", dotmeshName)
+			continue
+		}
+
+		dotmeshName := dotmeshName
+		deletions.Go(func() error {
+			c.log.Infof("Deleting pod %s", dotmeshName)
+			dp := meta_v1.DeletePropagationBackground
+			err := c.client.Core().Pods(c.namespace).Delete(dotmeshName, &meta_v1.DeleteOptions{
+				PropagationPolicy: &dp,
+			})
+			if err != nil {
+				if running {
+					clusterPopulationLock.Lock()
+					clusterPopulation++
+					clusterPopulationLock.Unlock()
+				}
+				return c.reconcileMetrics.reconcileError(RECONCILE_POD_DELETE_FAILED, fmt.Errorf("Error deleting pod %s: %+v", dotmeshName, err))
+			}
+			clusterPopulationLock.Lock()
+			summary.PodsKilled++
+			clusterPopulationLock.Unlock()
+			return nil
+		})
 	}
+	deleteErr := deletions.Wait()
 
 	// CREATE NEW DOTMESH PODS WHERE NEEDED
-	c.createDotmeshPods(undottedNodes, suspendedNodes, unusedPVCs, sentinels)
+	c.claimServerNodes(dotmeshes, undottedNodes)
+	var createErr error
+	summary.PodsCreated, createErr = c.createDotmeshPods(undottedNodes, suspendedNodes, notReadyNodes, unusedPVCs, sentinels, nodeSettings, canaryNodes, outdatedPods, parallelism)
 
-	return nil
+	errs := []error{}
+	for _, err := range []error{deleteErr, createErr} {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return summary, partialFailure{combineErrors(errs)}
+	}
+	return summary, nil
+}
+
+// chooseCanaryNodes returns the set of node IDs, out of validNodes, that
+// should run canary.image: the first canary.nodeCount of them (or
+// canary.nodePercent percent, rounded up) sorted by name, so the same nodes
+// are chosen every time. When canary.nodeSelector is set, only the nodes
+// whose nodeLabels it matches are candidates. It's empty unless canary.image
+// is set.
+func (c *dotmeshController) chooseCanaryNodes(validNodes map[string]struct{}, nodeLabels map[string]labels.Set) (map[string]struct{}, error) {
+	canaryNodes := map[string]struct{}{}
+	if c.config.Data[CONFIG_CANARY_IMAGE] == "" {
+		return canaryNodes, nil
+	}
+
+	candidates := validNodes
+	selectorString := c.config.Data[CONFIG_CANARY_NODE_SELECTOR]
+	if selectorString != "" {
+		selector, err := labels.Parse(selectorString)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s %q in the ConfigMap, it must be a label selector: %s", CONFIG_CANARY_NODE_SELECTOR, selectorString, err)
+		}
+		candidates = map[string]struct{}{}
+		for node := range validNodes {
+			if selector.Matches(nodeLabels[node]) {
+				candidates[node] = struct{}{}
+			}
+		}
+	}
+
+	var count int
+	if countString := c.config.Data[CONFIG_CANARY_NODE_COUNT]; countString != "" {
+		n, err := strconv.Atoi(countString)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("Invalid %s %q in the ConfigMap, it must be a number of nodes", CONFIG_CANARY_NODE_COUNT, countString)
+		}
+		count = n
+	} else if percentString := c.config.Data[CONFIG_CANARY_NODE_PERCENT]; percentString != "" {
+		percent, err := strconv.ParseFloat(percentString, 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return nil, fmt.Errorf("Invalid %s %q in the ConfigMap, it must be a percentage", CONFIG_CANARY_NODE_PERCENT, percentString)
+		}
+		count = int(math.Ceil(percent * float64(len(candidates)) / 100))
+	} else if selectorString != "" {
+		count = len(candidates)
+	} else {
+		return nil, fmt.Errorf("%s is set in the ConfigMap, but none of %s, %s and %s is", CONFIG_CANARY_IMAGE, CONFIG_CANARY_NODE_COUNT, CONFIG_CANARY_NODE_PERCENT, CONFIG_CANARY_NODE_SELECTOR)
+	}
+
+	nodeNames := make([]string, 0, len(candidates))
+	for node := range candidates {
+		nodeNames = append(nodeNames, node)
+	}
+	sort.Strings(nodeNames)
+	if count > len(nodeNames) {
+		count = len(nodeNames)
+	}
+	for _, node := range nodeNames[:count] {
+		canaryNodes[node] = struct{}{}
+	}
+	c.logFor(LOG_COMPONENT_PROCESS).V(2).Infof("Running canary image %s on %d node(s): %s", c.config.Data[CONFIG_CANARY_IMAGE], count, strings.Join(nodeNames[:count], ", "))
+	return canaryNodes, nil
+}
+
+// dotmeshImage returns the dotmesh server image for canary or stable nodes.
+func (c *dotmeshController) dotmeshImage(canary bool) string {
+	if canary {
+		return c.config.Data[CONFIG_CANARY_IMAGE]
+	}
+	return DOTMESH_IMAGE
+}
+
+// parseInitContainers parses the pod.initContainers ConfigMap value.
+func parseInitContainers(value string) ([]v1.Container, error) {
+	if strings.TrimSpace(value) == "" {
+		return []v1.Container{}, nil
+	}
+	var containers []v1.Container
+	err := json.Unmarshal([]byte(value), &containers)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s in the ConfigMap, it must be a JSON list of containers: %+v", CONFIG_POD_INIT_CONTAINERS, err)
+	}
+	for i, container := range containers {
+		if container.Image == "" {
+			return nil, fmt.Errorf("Invalid %s in the ConfigMap, init container %d (%q) has no image", CONFIG_POD_INIT_CONTAINERS, i, container.Name)
+		}
+	}
+	return containers, nil
+}
+
+// The environment variables createDotmeshPods may set on dotmesh server
+// containers, in any mode, which pod.extraEnv mustn't override
+var serverContainerEnvVars = map[string]bool{
+	"HOSTNAME":                                   true,
+	"DOTMESH_ETCD_ENDPOINT":                      true,
+	"DOTMESH_JOIN_OUTER_NETWORK":                 true,
+	"DOTMESH_DOCKER_IMAGE":                       true,
+	"DOTMESH_INNER_SERVER_NAME":                  true,
+	"PATH":                                       true,
+	"LD_LIBRARY_PATH":                            true,
+	"ALLOW_PUBLIC_REGISTRATION":                  true,
+	"INITIAL_ADMIN_PASSWORD_FILE":                true,
+	"INITIAL_ADMIN_API_KEY_FILE":                 true,
+	"LOG_ADDR":                                   true,
+	"DOTMESH_UPGRADES_URL":                       true,
+	"DOTMESH_UPGRADES_INTERVAL_SECONDS":          true,
+	"FLEXVOLUME_DRIVER_DIR":                      true,
+	"DOTMESH_TRANSFER_MAX_CONCURRENT":            true,
+	"DOTMESH_RPC_RATE_LIMIT_REQUESTS_PER_SECOND": true,
+	"DOTMESH_RPC_RATE_LIMIT_BURST":               true,
+	"HTTP_PROXY":                                 true,
+	"HTTPS_PROXY":                                true,
+	"NO_PROXY":                                   true,
+	"DOTMESH_ETCD_TLS_CERT_FILE":                 true,
+	"DOTMESH_ETCD_TLS_KEY_FILE":                  true,
+	"DOTMESH_ETCD_TLS_CA_FILE":                   true,
+	"KERNEL_ZFS_VERSION":                         true,
+	"USE_POOL_DIR":                               true,
+	"USE_POOL_NAME":                              true,
+	"POOL_SIZE":                                  true,
+	"CONTAINER_POOL_MNT":                         true,
+	"CONTAINER_POOL_PVC_NAME":                    true,
+	"EXTRA_INHERIT_ENVIRONMENT_NAMES":            true,
+}
+
+// parseExtraEnv parses the pod.extraEnv ConfigMap value.
+func parseExtraEnv(value string) ([]v1.EnvVar, error) {
+	if strings.TrimSpace(value) == "" {
+		return []v1.EnvVar{}, nil
+	}
+	var env []v1.EnvVar
+	err := json.Unmarshal([]byte(value), &env)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s in the ConfigMap, it must be a JSON list of environment variables: %+v", CONFIG_POD_EXTRA_ENV, err)
+	}
+	for i, envVar := range env {
+		if envVar.Name == "" {
+			return nil, fmt.Errorf("Invalid %s in the ConfigMap, environment variable %d has no name", CONFIG_POD_EXTRA_ENV, i)
+		}
+		if serverContainerEnvVars[envVar.Name] {
+			return nil, fmt.Errorf("Invalid %s in the ConfigMap, %s is set by the operator and can't be overridden", CONFIG_POD_EXTRA_ENV, envVar.Name)
+		}
+	}
+	return env, nil
+}
+
+// withInheritedNames adds EXTRA_INHERIT_ENVIRONMENT_NAMES to env, naming the
+// variables in it so that require_zfs.sh passes them on to the inner server
+// container as well as setting them on the outer one.
+func withInheritedNames(env []v1.EnvVar) []v1.EnvVar {
+	if len(env) == 0 {
+		return env
+	}
+	names := make([]string, 0, len(env))
+	for _, envVar := range env {
+		names = append(names, envVar.Name)
+	}
+	return append(append([]v1.EnvVar{}, env...), v1.EnvVar{
+		Name:  "EXTRA_INHERIT_ENVIRONMENT_NAMES",
+		Value: strings.Join(names, " "),
+	})
+}
+
+// configInt returns the ConfigMap value for key as a whole number, which
+// must be at least minimum.
+func (c *dotmeshController) configInt(key string, minimum int) (int, error) {
+	value := c.config.Data[key]
+	n, err := strconv.Atoi(value)
+	if err != nil || n < minimum {
+		return 0, fmt.Errorf("Invalid %s %q in the ConfigMap, it must be a whole number of at least %d", key, value, minimum)
+	}
+	return n, nil
+}
+
+// localPoolSizeForNode returns the POOL_SIZE for a local mode pool on node:
+// local.poolSizePerNode, unless that's "auto", in which case it's
+// local.poolAutoFraction of the node's ephemeral storage capacity, up to
+// local.poolMaxSize.
+func (c *dotmeshController) localPoolSizeForNode(node *v1.Node) (string, error) {
+	poolSize := c.config.Data[CONFIG_LOCAL_POOL_SIZE_PER_NODE]
+	if poolSize != CONFIG_LOCAL_POOL_SIZE_AUTO || c.config.Data[CONFIG_MODE] != CONFIG_MODE_LOCAL {
+		return poolSize, nil
+	}
+
+	fractionString := c.config.Data[CONFIG_LOCAL_POOL_AUTO_FRACTION]
+	fraction, err := strconv.ParseFloat(fractionString, 64)
+	if err != nil || fraction <= 0 || fraction > 1 {
+		return "", fmt.Errorf("Invalid %s %q in the ConfigMap, it must be a fraction between 0 and 1", CONFIG_LOCAL_POOL_AUTO_FRACTION, fractionString)
+	}
+	maxSize, err := resource.ParseQuantity(c.config.Data[CONFIG_LOCAL_POOL_MAX_SIZE])
+	if err != nil {
+		return "", fmt.Errorf("Error parsing %s value %s: %+v", CONFIG_LOCAL_POOL_MAX_SIZE, c.config.Data[CONFIG_LOCAL_POOL_MAX_SIZE], err)
+	}
+	capacity, ok := node.Status.Capacity[v1.ResourceEphemeralStorage]
+	if !ok {
+		return "", fmt.Errorf("%s is %s, but node %s doesn't report its %s capacity", CONFIG_LOCAL_POOL_SIZE_PER_NODE, CONFIG_LOCAL_POOL_SIZE_AUTO, node.ObjectMeta.Name, v1.ResourceEphemeralStorage)
+	}
+
+	bytes := int64(float64(capacity.Value()) * fraction)
+	if bytes > maxSize.Value() {
+		bytes = maxSize.Value()
+	}
+	// In whole MiB, which is what require_zfs.sh's own automatic sizing
+	// uses too
+	size := fmt.Sprintf("%dM", bytes/(1024*1024))
+	c.logFor(LOG_COMPONENT_PROCESS).V(2).Infof("Sizing the pool on node %s at %s, from its %s of ephemeral storage", node.ObjectMeta.Name, size, capacity.String())
+	return size, nil
+}
+
+// logAddressForNode returns the LOG_ADDR for dotmesh pods on nodeName: the
+// logAddress.{nodeName} ConfigMap key if there is one, so that nodes can log
+// to different aggregators, otherwise logAddress. An address that isn't
+// host:port is an error, so bad config is caught before pods start with it.
+func (c *dotmeshController) logAddressForNode(nodeName string) (string, error) {
+	key := CONFIG_LOG_ADDRESS
+	logAddress := c.config.Data[CONFIG_LOG_ADDRESS]
+	if nodeLogAddress, ok := c.config.Data[CONFIG_LOG_ADDRESS_NODE_PREFIX+nodeName]; ok {
+		key = CONFIG_LOG_ADDRESS_NODE_PREFIX + nodeName
+		logAddress = nodeLogAddress
+	}
+	if logAddress == "" {
+		// No logging configured
+		return "", nil
+	}
+	_, port, err := net.SplitHostPort(logAddress)
+	if err != nil {
+		return "", fmt.Errorf("Invalid %s %q in the ConfigMap, it must be host:port: %s", key, logAddress, err)
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", fmt.Errorf("Invalid %s %q in the ConfigMap, %q isn't a port number", key, logAddress, port)
+	}
+	return logAddress, nil
 }
 
 func (c *dotmeshController) createDotmeshPods(undottedNodes map[string]struct{}, suspendedNodes map[string]struct{},
-	unusedPVCs map[string]struct{}, sentinels map[string]dotmeshSentinel) {
+	notReadyNodes map[string]time.Time, unusedPVCs map[string]struct{}, sentinels map[string]dotmeshSentinel, nodeSettings map[string]dotmeshNodeSettings,
+	canaryNodes map[string]struct{}, outdatedPods map[string]string, parallelism int) (int, error) {
 	// FIXME: This hardcodes the name of the Deployment to be the
 	// ownerRef of created pods. It would be nicer to use an API to
 	// find the Pod containing the currently running process and then
@@ -844,237 +1743,334 @@ func (c *dotmeshController) createDotmeshPods(undottedNodes map[string]struct{},
 
 	// GET /apis/extensions/v1beta1/namespaces/{namespace}/deployments/dotmesh-operator
 
-nodeLoop:
+	etcdTLS := c.config.Data[CONFIG_ETCD_TLS_ENABLED] == "true"
+	etcdTLSSecret := c.config.Data[CONFIG_ETCD_TLS_SECRET_NAME]
+	if etcdTLS && etcdTLSSecret == "" {
+		c.reconcileMetrics.errors.WithLabelValues(RECONCILE_CONFIG_INVALID).Inc()
+		c.log.Errorf("%s is set, but %s isn't, so not creating any pods", CONFIG_ETCD_TLS_ENABLED, CONFIG_ETCD_TLS_SECRET_NAME)
+		return 0, nil
+	}
+	etcdEndpoint := "http://" + fmt.Sprintf(ETCD_CLIENT_ADDRESS_FORMAT, c.namespace)
+	if etcdTLS {
+		etcdEndpoint = "https://" + fmt.Sprintf(ETCD_CLIENT_ADDRESS_FORMAT, c.namespace)
+	}
+
+	// Pods are created in parallel, which is safe as each is on a different
+	// node; only unusedPVCs, and the count of pods created, are shared
+	// between them
+	unusedPVCsLock := &sync.Mutex{}
+	created := 0
+	createdLock := &sync.Mutex{}
+	creations := newBoundedGroup(parallelism)
+
 	for node, _ := range undottedNodes {
 		_, suspended := suspendedNodes[node]
 		if suspended {
-			glog.Infof("Not creating a pod on undotted node %s, as the old pod is being cleared up", node)
+			c.log.Infof("Not creating a pod on undotted node %s, as it's suspended: its old pod is being cleared up, or it's under disk pressure", node)
+			continue
+		}
+		_, notReady := notReadyNodes[node]
+		if notReady {
+			c.log.Infof("Not creating a pod on undotted node %s, as it's NotReady", node)
+			continue
+		}
+		if sibling := c.siblingOnNode(node); sibling != "" {
+			c.log.Warnf("Not creating a pod on undotted node %s, as namespace %s's dotmesh server is there", node, sibling)
 			continue
 		}
 
-		// Common volumes and their mounts, for all modes
+		node := node
+		creations.Go(func() error {
+			// Common volumes and their mounts, for all modes
+
+			volumeMounts := []v1.VolumeMount{
+				{Name: "docker-sock", MountPath: "/var/run/docker.sock"},
+				{Name: "run-docker", MountPath: "/run/docker"},
+				{Name: "var-lib", MountPath: "/var/lib"},
+				{Name: "system-lib", MountPath: "/system-lib/lib"},
+				{Name: "dotmesh-kernel-modules", MountPath: "/bundled-lib"},
+				{Name: "dotmesh-secret", MountPath: "/secret"},
+				{Name: "test-pools-dir", MountPath: "/dotmesh-test-pools"},
+			}
 
-		volumeMounts := []v1.VolumeMount{
-			{Name: "docker-sock", MountPath: "/var/run/docker.sock"},
-			{Name: "run-docker", MountPath: "/run/docker"},
-			{Name: "var-lib", MountPath: "/var/lib"},
-			{Name: "system-lib", MountPath: "/system-lib/lib"},
-			{Name: "dotmesh-kernel-modules", MountPath: "/bundled-lib"},
-			{Name: "dotmesh-secret", MountPath: "/secret"},
-			{Name: "test-pools-dir", MountPath: "/dotmesh-test-pools"},
-		}
+			volumes := []v1.Volume{
+				{Name: "test-pools-dir", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/dotmesh-test-pools"}}},
+				{Name: "run-docker", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/var/run/docker"}}},
+				{Name: "docker-sock", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/var/run/docker.sock"}}},
+				{Name: "var-lib", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/var/lib"}}},
+				{Name: "system-lib", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/lib"}}},
+				{Name: "dotmesh-kernel-modules", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+				{Name: "dotmesh-secret", VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: DOTMESH_SECRET}}},
+			}
 
-		volumes := []v1.Volume{
-			{Name: "test-pools-dir", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/dotmesh-test-pools"}}},
-			{Name: "run-docker", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/var/run/docker"}}},
-			{Name: "docker-sock", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/var/run/docker.sock"}}},
-			{Name: "var-lib", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/var/lib"}}},
-			{Name: "system-lib", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/lib"}}},
-			{Name: "dotmesh-kernel-modules", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
-			{Name: "dotmesh-secret", VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: "dotmesh"}}},
-		}
+			_, canary := canaryNodes[node]
+			image := c.dotmeshImage(canary)
 
-		env := []v1.EnvVar{
-			{Name: "HOSTNAME", ValueFrom: &v1.EnvVarSource{FieldRef: &v1.ObjectFieldSelector{APIVersion: "v1", FieldPath: "spec.nodeName"}}},
-			{Name: "DOTMESH_ETCD_ENDPOINT", Value: "http://dotmesh-etcd-cluster-client.dotmesh.svc.cluster.local:2379"},
-			{Name: "DOTMESH_JOIN_OUTER_NETWORK", Value: "true"},
-			{Name: "DOTMESH_DOCKER_IMAGE", Value: DOTMESH_IMAGE},
-			{Name: "PATH", Value: "/bundled-lib/sbin:/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"},
-			{Name: "LD_LIBRARY_PATH", Value: "/bundled-lib/lib:/bundled-lib/usr/lib/"},
-			{Name: "ALLOW_PUBLIC_REGISTRATION", Value: "1"},
-			{Name: "INITIAL_ADMIN_PASSWORD_FILE", Value: "/secret/dotmesh-admin-password.txt"},
-			{Name: "INITIAL_ADMIN_API_KEY_FILE", Value: "/secret/dotmesh-api-key.txt"},
-			{Name: "LOG_ADDR", Value: c.config.Data[CONFIG_LOG_ADDRESS]},
-			{Name: "DOTMESH_UPGRADES_URL", Value: c.config.Data[CONFIG_UPGRADES_URL]},
-			{Name: "DOTMESH_UPGRADES_INTERVAL_SECONDS", Value: c.config.Data[CONFIG_UPGRADES_INTERVAL_SECONDS]},
-			{Name: "FLEXVOLUME_DRIVER_DIR", Value: c.config.Data[CONFIG_FLEXVOLUME_DRIVER_DIR]},
-		}
+			// A pod replacing one that's still running goes in the other slot
+			slot := serverPodSlot(node, outdatedPods[node])
+			innerServerName := c.innerServerName() + slot
 
-		if c.config.Data[CONFIG_KERNEL_ZFS_VERSION] != "" {
-			env = append(env, v1.EnvVar{
-				Name:  "KERNEL_ZFS_VERSION",
-				Value: c.config.Data[CONFIG_KERNEL_ZFS_VERSION],
-			})
-		}
+			// The server doesn't check for upgrades at all when it's given no
+			// URL
+			upgradesURL := c.config.Data[CONFIG_UPGRADES_URL]
+			upgradesInterval := c.config.Data[CONFIG_UPGRADES_INTERVAL_SECONDS]
+			if c.config.Data[CONFIG_UPGRADES_ENABLED] == "false" {
+				upgradesURL = ""
+				upgradesInterval = ""
+			}
 
-		var podName string
-		var pvc string
-		var provisionSentinelOnNode bool
-		var pvVolumes []v1.Volume
-		var pvEnvs []v1.EnvVar
-		var pvVolumeMounts []v1.VolumeMount
-
-		switch c.config.Data[CONFIG_MODE] {
-		case CONFIG_MODE_LOCAL:
-			podName = fmt.Sprintf("server-%s", node)
-
-			// The pool directory is the location on the host, and will
-			// also be the location inside the container so that the
-			// paths are aligned for ZFS purposes.
-			rawPoolDir := c.config.Data[CONFIG_LOCAL_POOL_LOCATION]
-
-			// However, for CI testing (where all the nodes are the same
-			// physical host), we need to interpolate any #HOSTNAME#
-			// references in the configured pool location for each node
-			// to uniqify them.
-
-			// require_zfs.sh does this itself for the contents of
-			// USE_POOL_DIR, but we need to make sure the paths in the
-			// k8s volume mounts match as well, so need to (also) do it
-			// here.
-
-			poolDir := strings.Replace(rawPoolDir, "#HOSTNAME#", node, 1)
-
-			env = append(env,
-				v1.EnvVar{
-					Name:  "USE_POOL_DIR",
-					Value: poolDir,
-				},
-				v1.EnvVar{
-					Name:  "USE_POOL_NAME",
-					Value: c.config.Data[CONFIG_POOL_NAME_PREFIX] + "pool",
-				},
-				v1.EnvVar{
-					Name:  "POOL_SIZE",
-					Value: c.config.Data[CONFIG_LOCAL_POOL_SIZE_PER_NODE],
-				},
-			)
-			volumeMounts = append(volumeMounts,
-				v1.VolumeMount{
-					Name:      "pool-dir",
-					MountPath: poolDir,
-				},
-			)
-			volumes = append(volumes,
-				v1.Volume{
-					Name: "pool-dir",
-					VolumeSource: v1.VolumeSource{
-						HostPath: &v1.HostPathVolumeSource{
-							Path: poolDir}}},
-			)
-		case CONFIG_MODE_PPN:
-			//If no PVC's are available or they are available but allocated to sentinels NOT on this node
-			sentinelOnNode, ok := sentinels[node]
-			if !ok {
-				provisionSentinelOnNode = true
-				if len(unusedPVCs) != 0 {
-					glog.Infof("Reusing existing pvc that is unattached to any pods. PVC: %s on node %s", pvc, node)
-					// TODO: Is there a better basis for picking one? Most recently used?
+			env := []v1.EnvVar{
+				{Name: "HOSTNAME", ValueFrom: &v1.EnvVarSource{FieldRef: &v1.ObjectFieldSelector{APIVersion: "v1", FieldPath: "spec.nodeName"}}},
+				{Name: "DOTMESH_ETCD_ENDPOINT", Value: etcdEndpoint},
+				{Name: "DOTMESH_JOIN_OUTER_NETWORK", Value: "true"},
+				{Name: "DOTMESH_DOCKER_IMAGE", Value: image},
+				{Name: "DOTMESH_INNER_SERVER_NAME", Value: innerServerName},
+				{Name: "PATH", Value: "/bundled-lib/sbin:/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"},
+				{Name: "LD_LIBRARY_PATH", Value: "/bundled-lib/lib:/bundled-lib/usr/lib/"},
+				{Name: "ALLOW_PUBLIC_REGISTRATION", Value: "1"},
+				{Name: "INITIAL_ADMIN_PASSWORD_FILE", Value: "/secret/" + DOTMESH_SECRET_ADMIN_PASSWORD_KEY},
+				{Name: "INITIAL_ADMIN_API_KEY_FILE", Value: "/secret/" + DOTMESH_SECRET_API_KEY_KEY},
+				{Name: "LOG_ADDR", Value: nodeSettings[node].logAddress},
+				{Name: "DOTMESH_UPGRADES_URL", Value: upgradesURL},
+				{Name: "DOTMESH_UPGRADES_INTERVAL_SECONDS", Value: upgradesInterval},
+				{Name: "FLEXVOLUME_DRIVER_DIR", Value: c.config.Data[CONFIG_FLEXVOLUME_DRIVER_DIR]},
+				{Name: "DOTMESH_TRANSFER_MAX_CONCURRENT", Value: c.config.Data[CONFIG_TRANSFER_MAX_CONCURRENT]},
+				{Name: "DOTMESH_RPC_RATE_LIMIT_REQUESTS_PER_SECOND", Value: c.config.Data[CONFIG_RPC_RATE_LIMIT_REQUESTS_PER_SECOND]},
+				{Name: "DOTMESH_RPC_RATE_LIMIT_BURST", Value: c.config.Data[CONFIG_RPC_RATE_LIMIT_BURST]},
+			}
+
+			if c.config.Data[CONFIG_UPGRADES_PROXY] != "" {
+				// HTTPS_PROXY too, as the checkpoint URL is normally https,
+				// and NO_PROXY so that etcd is still reached directly
+				env = append(env,
+					v1.EnvVar{Name: "HTTP_PROXY", Value: c.config.Data[CONFIG_UPGRADES_PROXY]},
+					v1.EnvVar{Name: "HTTPS_PROXY", Value: c.config.Data[CONFIG_UPGRADES_PROXY]},
+					v1.EnvVar{Name: "NO_PROXY", Value: "localhost,127.0.0.1,.svc,.cluster.local"},
+				)
+			}
+
+			if etcdTLS {
+				env = append(env,
+					v1.EnvVar{Name: "DOTMESH_ETCD_TLS_CERT_FILE", Value: ETCD_TLS_MOUNT_PATH + "/tls.crt"},
+					v1.EnvVar{Name: "DOTMESH_ETCD_TLS_KEY_FILE", Value: ETCD_TLS_MOUNT_PATH + "/tls.key"},
+					v1.EnvVar{Name: "DOTMESH_ETCD_TLS_CA_FILE", Value: ETCD_TLS_MOUNT_PATH + "/ca.crt"},
+				)
+				volumeMounts = append(volumeMounts, v1.VolumeMount{Name: "etcd-tls", MountPath: ETCD_TLS_MOUNT_PATH, ReadOnly: true})
+				volumes = append(volumes, v1.Volume{Name: "etcd-tls", VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: etcdTLSSecret}}})
+			}
+
+			if c.config.Data[CONFIG_KERNEL_ZFS_VERSION] != "" {
+				env = append(env, v1.EnvVar{
+					Name:  "KERNEL_ZFS_VERSION",
+					Value: c.config.Data[CONFIG_KERNEL_ZFS_VERSION],
+				})
+			}
+
+			var podName string
+			var pvc string
+			var provisionSentinelOnNode bool
+			var pvVolumes []v1.Volume
+			var pvEnvs []v1.EnvVar
+			var pvVolumeMounts []v1.VolumeMount
+
+			switch c.config.Data[CONFIG_MODE] {
+			case CONFIG_MODE_LOCAL:
+				podName = fmt.Sprintf("server-%s", node) + slot
+
+				// The pool directory is the location on the host, and will
+				// also be the location inside the container so that the
+				// paths are aligned for ZFS purposes.
+				rawPoolDir := c.config.Data[CONFIG_LOCAL_POOL_LOCATION]
+
+				// However, for CI testing (where all the nodes are the same
+				// physical host), we need to interpolate any #HOSTNAME#
+				// references in the configured pool location for each node
+				// to uniqify them.
+
+				// require_zfs.sh does this itself for the contents of
+				// USE_POOL_DIR, but we need to make sure the paths in the
+				// k8s volume mounts match as well, so need to (also) do it
+				// here.
+
+				poolDir := strings.Replace(rawPoolDir, "#HOSTNAME#", node, 1)
+
+				env = append(env,
+					v1.EnvVar{
+						Name:  "USE_POOL_DIR",
+						Value: poolDir,
+					},
+					v1.EnvVar{
+						Name:  "USE_POOL_NAME",
+						Value: c.config.Data[CONFIG_POOL_NAME_PREFIX] + "pool",
+					},
+					v1.EnvVar{
+						Name:  "POOL_SIZE",
+						Value: nodeSettings[node].localPoolSize,
+					},
+				)
+				volumeMounts = append(volumeMounts,
+					v1.VolumeMount{
+						Name:      "pool-dir",
+						MountPath: poolDir,
+					},
+				)
+				volumes = append(volumes,
+					v1.Volume{
+						Name: "pool-dir",
+						VolumeSource: v1.VolumeSource{
+							HostPath: &v1.HostPathVolumeSource{
+								Path: poolDir}}},
+				)
+			case CONFIG_MODE_CEPH:
+				var err error
+				pvc, err = c.ensureCephPoolPVC(node)
+				if err != nil {
+					return err
+				}
+
+				// Configured like pvcPerNode mode, but with the node's own
+				// PVC and no sentinel
+				podName = fmt.Sprintf("server-%s", node) + slot
+				volumeMounts = append(volumeMounts, getDotmeshPVVolumeMounts()...)
+				volumes = append(volumes, getDotmeshPVVolumes(pvc)...)
+				env = append(env, getDotmeshPVEnvs(c.config.Data[CONFIG_POOL_NAME_PREFIX], pvc)...)
+			case CONFIG_MODE_PPN:
+				//If no PVC's are available or they are available but allocated to sentinels NOT on this node
+				sentinelOnNode, ok := sentinels[node]
+				if !ok {
+					provisionSentinelOnNode = true
+					unusedPVCsLock.Lock()
 					for pvcName, _ := range unusedPVCs {
+						// TODO: Is there a better basis for picking one? Most recently used?
 						pvc = pvcName
+						delete(unusedPVCs, pvc)
 						break
 					}
-					delete(unusedPVCs, pvc)
-				} else {
-					glog.Infof("Creating new PVC for dotmesh server on node. PVC: %s on node %s", pvc, node)
-					randBytes := make([]byte, PVC_NAME_RANDOM_BYTES)
-					_, err := rand.Read(randBytes)
-					if err != nil {
-						glog.Errorf("Error picking a random PVC name: %+v", err)
-						continue nodeLoop
-					}
-					pvc = fmt.Sprintf("pvc-%s", hex.EncodeToString(randBytes))
-
-					storageNeeded, err := resource.ParseQuantity(c.config.Data[CONFIG_PPN_POOL_SIZE_PER_NODE])
-					if err != nil {
-						glog.Errorf("Error parsing %s value %s: %+v", CONFIG_PPN_POOL_SIZE_PER_NODE, c.config.Data[CONFIG_PPN_POOL_SIZE_PER_NODE], err)
-						continue nodeLoop
-					}
-
-					storageClass := c.config.Data[CONFIG_PPN_POOL_STORAGE_CLASS]
-
-					newPVC := v1.PersistentVolumeClaim{
-						ObjectMeta: meta_v1.ObjectMeta{
-							Namespace: DOTMESH_NAMESPACE,
-							Name:      pvc,
-							Labels: map[string]string{
-								DOTMESH_ROLE_LABEL: DOTMESH_ROLE_PVC,
-							},
-							Annotations: map[string]string{},
-						},
-						Spec: v1.PersistentVolumeClaimSpec{
-							Resources: v1.ResourceRequirements{
-								Requests: v1.ResourceList{
-									v1.ResourceStorage: storageNeeded,
+					unusedPVCsLock.Unlock()
+					if pvc != "" {
+						c.log.Infof("Reusing existing pvc that is unattached to any pods. PVC: %s on node %s", pvc, node)
+					} else {
+						c.log.Infof("Creating new PVC for dotmesh server on node. PVC: %s on node %s", pvc, node)
+						randBytes := make([]byte, PVC_NAME_RANDOM_BYTES)
+						_, err := rand.Read(randBytes)
+						if err != nil {
+							return fmt.Errorf("Error picking a random PVC name: %+v", err)
+						}
+						pvc = fmt.Sprintf("pvc-%s", hex.EncodeToString(randBytes))
+
+						storageNeeded, err := resource.ParseQuantity(c.config.Data[CONFIG_PPN_POOL_SIZE_PER_NODE])
+						if err != nil {
+							return fmt.Errorf("Error parsing %s value %s: %+v", CONFIG_PPN_POOL_SIZE_PER_NODE, c.config.Data[CONFIG_PPN_POOL_SIZE_PER_NODE], err)
+						}
+
+						storageClass := c.config.Data[CONFIG_PPN_POOL_STORAGE_CLASS]
+
+						newPVC := v1.PersistentVolumeClaim{
+							ObjectMeta: meta_v1.ObjectMeta{
+								Namespace: c.namespace,
+								Name:      pvc,
+								Labels: map[string]string{
+									DOTMESH_ROLE_LABEL: DOTMESH_ROLE_PVC,
 								},
+								Annotations: map[string]string{},
 							},
-							AccessModes: []v1.PersistentVolumeAccessMode{
-								v1.ReadWriteOnce,
+							Spec: v1.PersistentVolumeClaimSpec{
+								Resources: v1.ResourceRequirements{
+									Requests: v1.ResourceList{
+										v1.ResourceStorage: storageNeeded,
+									},
+								},
+								AccessModes: []v1.PersistentVolumeAccessMode{
+									v1.ReadWriteOnce,
+								},
+								StorageClassName: &storageClass,
 							},
-							StorageClassName: &storageClass,
-						},
-					}
+						}
 
-					glog.Infof("Creating new pvc %s", pvc)
-					_, err = c.client.Core().PersistentVolumeClaims(DOTMESH_NAMESPACE).Create(&newPVC)
-					if err != nil {
-						glog.Errorf("Error creating pvc: %+v", err)
-						continue nodeLoop
+						c.log.Infof("Creating new pvc %s", pvc)
+						_, err = c.client.Core().PersistentVolumeClaims(c.namespace).Create(&newPVC)
+						if err != nil {
+							return fmt.Errorf("Error creating pvc %s: %+v", pvc, err)
+						}
 					}
+				} else {
+					pvc = sentinelOnNode.pvc
+					c.log.Infof("Reusing the PVC that the sentinel on this node is attached to. PVC: %s on Sentinel: %s", pvc, sentinelOnNode.name)
 				}
-			} else {
-				pvc = sentinelOnNode.pvc
-				glog.Infof("Reusing the PVC that the sentinel on this node is attached to. PVC: %s on Sentinel: %s", pvc, sentinelOnNode.name)
+
+				// Configure the pod to use PV storage
+
+				podName = fmt.Sprintf("server-pvc-%s-%s", string(pvc[len(pvc)-4:]), node)
+				pvVolumeMounts = getDotmeshPVVolumeMounts()
+				volumeMounts = append(volumeMounts, pvVolumeMounts...)
+				pvVolumes = getDotmeshPVVolumes(pvc)
+				volumes = append(volumes, pvVolumes...)
+				pvEnvs = getDotmeshPVEnvs(c.config.Data[CONFIG_POOL_NAME_PREFIX], pvc)
+				env = append(env, pvEnvs...)
+			default:
+				return c.reconcileMetrics.reconcileError(RECONCILE_CONFIG_INVALID, fmt.Errorf("Unsupported %s: %s", CONFIG_MODE, c.config.Data[CONFIG_MODE]))
 			}
 
-			// Configure the pod to use PV storage
-
-			podName = fmt.Sprintf("server-pvc-%s-%s", string(pvc[len(pvc)-4:]), node)
-			pvVolumeMounts = getDotmeshPVVolumeMounts()
-			volumeMounts = append(volumeMounts, pvVolumeMounts...)
-			pvVolumes = getDotmeshPVVolumes(pvc)
-			volumes = append(volumes, pvVolumes...)
-			pvEnvs = getDotmeshPVEnvs(c.config.Data[CONFIG_POOL_NAME_PREFIX], pvc)
-			env = append(env, pvEnvs...)
-		default:
-			glog.Errorf("Unsupported %s: %s", CONFIG_MODE, c.config.Data[CONFIG_MODE])
-			continue nodeLoop
-		}
+			env = append(env, withInheritedNames(c.extraEnv)...)
 
-		c.createServerPod(podName, node, env, volumeMounts, volumes)
+			err := c.createServerPod(podName, node, canary, innerServerName, env, volumeMounts, volumes)
+			if err != nil {
+				return err
+			}
+			createdLock.Lock()
+			created++
+			createdLock.Unlock()
 
-		if provisionSentinelOnNode {
-			c.createSentinelPod(pvc, node)
-		}
+			if provisionSentinelOnNode {
+				return c.createSentinelPod(pvc, node)
+			}
+			return nil
+		})
 	}
+	err := creations.Wait()
+	return created, err
 }
 
-func (c *dotmeshController) createServerPod(podName string, node string, env []v1.EnvVar, volumeMounts []v1.VolumeMount, volumes []v1.Volume) {
+func (c *dotmeshController) createServerPod(podName string, node string, canary bool, innerServerName string, env []v1.EnvVar, volumeMounts []v1.VolumeMount, volumes []v1.Volume) error {
 
-	privileged := true
+	image := c.dotmeshImage(canary)
 
 	dotmeshServer := v1.Pod{
 		ObjectMeta: meta_v1.ObjectMeta{
 			Name:      podName,
-			Namespace: "dotmesh",
+			Namespace: c.namespace,
 			Labels: map[string]string{
-				DOTMESH_ROLE_LABEL: DOTMESH_ROLE_SERVER,
+				DOTMESH_ROLE_LABEL:   c.serverRole(),
+				DOTMESH_CANARY_LABEL: strconv.FormatBool(canary),
 			},
 			Annotations: map[string]string{},
 		},
 		Spec: v1.PodSpec{
 			HostPID: true,
-			// This is what binds the pod to a specific node
+			// Gives the pod its name under the dotmesh-servers service
+			Hostname:  serverPodHostname(node),
+			Subdomain: DOTMESH_SERVERS_SERVICE,
+			// This is what binds the pod to a specific node. Every node
+			// that can run dotmesh gets one, so there's no choosing
+			// nodes near etcd (or anything else) by affinity
 			NodeSelector: map[string]string{
-				DOTMESH_NODE_LABEL: node,
+				c.nodeLabel: node,
 			},
 			Tolerations: []v1.Toleration{
 				v1.Toleration{
 					Effect:   v1.TaintEffectNoSchedule,
 					Operator: v1.TolerationOpExists,
 				}},
-			InitContainers: []v1.Container{},
+			InitContainers: append([]v1.Container{}, c.initContainers...),
 			Containers: []v1.Container{
 				v1.Container{
 					Name:  "dotmesh-outer",
-					Image: DOTMESH_IMAGE,
+					Image: image,
 					Command: []string{
 						"/require_zfs.sh",
 						"dotmesh-server",
 					},
-					SecurityContext: &v1.SecurityContext{
-						Privileged: &privileged,
-					},
+					SecurityContext: c.podSecurity.containerSecurityContext(),
 					Ports: []v1.ContainerPort{
 						{
 							Name:          "dotmesh-api",
@@ -1106,7 +2102,7 @@ func (c *dotmeshController) createServerPod(podName string, node string, env []v
 					Lifecycle: &v1.Lifecycle{
 						PreStop: &v1.Handler{
 							Exec: &v1.ExecAction{
-								Command: []string{"docker", "rm", "-f", "dotmesh-server-inner"},
+								Command: []string{"docker", "rm", "-f", innerServerName},
 							},
 						},
 					},
@@ -1138,24 +2134,24 @@ func (c *dotmeshController) createServerPod(podName string, node string, env []v
 				},
 			},
 			RestartPolicy:      v1.RestartPolicyNever,
-			ServiceAccountName: "dotmesh",
+			ServiceAccountName: DOTMESH_SERVICE_ACCOUNT,
 			Volumes:            volumes,
 		},
 	}
 
-	c.createResource(dotmeshServer, node)
+	c.podSecurity.annotate(dotmeshServer.ObjectMeta.Annotations)
+	return c.createResource(dotmeshServer, node)
 }
 
-func (c *dotmeshController) createSentinelPod(pvcName string, node string) {
+func (c *dotmeshController) createSentinelPod(pvcName string, node string) error {
 	sentinelName := fmt.Sprintf("sentinel-pvc-%s-%s", string(pvcName[len(pvcName)-4:]), node)
-	privileged := true
 	sentinelImage := "busybox"
 
-	glog.Infof("Creating sentinel %#v", sentinelName)
+	c.log.Infof("Creating sentinel %#v", sentinelName)
 	sentinel := v1.Pod{
 		ObjectMeta: meta_v1.ObjectMeta{
 			Name:      sentinelName,
-			Namespace: "dotmesh",
+			Namespace: c.namespace,
 			Labels: map[string]string{
 				DOTMESH_ROLE_LABEL: DOTMESH_ROLE_SENTINEL,
 			},
@@ -1165,7 +2161,7 @@ func (c *dotmeshController) createSentinelPod(pvcName string, node string) {
 			HostPID: true,
 			// This is what binds the pod to a specific node
 			NodeSelector: map[string]string{
-				DOTMESH_NODE_LABEL: node,
+				c.nodeLabel: node,
 			},
 			Tolerations: []v1.Toleration{
 				v1.Toleration{
@@ -1182,9 +2178,7 @@ func (c *dotmeshController) createSentinelPod(pvcName string, node string) {
 						"-f",
 						"/dev/null",
 					},
-					SecurityContext: &v1.SecurityContext{
-						Privileged: &privileged,
-					},
+					SecurityContext: c.podSecurity.containerSecurityContext(),
 					VolumeMounts:    getDotmeshPVVolumeMounts(),
 					Env:             getDotmeshPVEnvs(c.config.Data[CONFIG_POOL_NAME_PREFIX], pvcName),
 					ImagePullPolicy: v1.PullAlways,
@@ -1196,21 +2190,22 @@ func (c *dotmeshController) createSentinelPod(pvcName string, node string) {
 				},
 			},
 			RestartPolicy:      v1.RestartPolicyNever,
-			ServiceAccountName: "dotmesh",
+			ServiceAccountName: DOTMESH_SERVICE_ACCOUNT,
 			Volumes:            getDotmeshPVVolumes(pvcName),
 		},
 	}
 
-	c.createResource(sentinel, node)
+	c.podSecurity.annotate(sentinel.ObjectMeta.Annotations)
+	return c.createResource(sentinel, node)
 }
 
-func (c *dotmeshController) createResource(pod v1.Pod, node string) {
-	glog.Infof("Creating pod %s running %s on node %s", pod.ObjectMeta.Name, DOTMESH_IMAGE, node)
-	_, err := c.client.Core().Pods(DOTMESH_NAMESPACE).Create(&pod)
+func (c *dotmeshController) createResource(pod v1.Pod, node string) error {
+	c.log.Infof("Creating pod %s running %s on node %s", pod.ObjectMeta.Name, pod.Spec.Containers[0].Image, node)
+	_, err := c.client.Core().Pods(c.namespace).Create(&pod)
 	if err != nil {
-		// Do not abort in error case, just keep pressing on
-		glog.Error(err)
+		return c.reconcileMetrics.reconcileError(RECONCILE_POD_CREATE_FAILED, fmt.Errorf("Error creating pod %s on node %s: %+v", pod.ObjectMeta.Name, node, err))
 	}
+	return nil
 }
 
 func getDotmeshPVVolumes(pvcName string) []v1.Volume {
@@ -1268,17 +2263,17 @@ func (c *dotmeshController) logPodInfo(pod *v1.Pod) {
 	podName := pod.ObjectMeta.Name
 	status := pod.Status.Phase
 	// We're deleting the pod, so the user can't "kubectl describe" it, so let's log lots of stuff
-	glog.Infof("Observing pod %s - status %s: FAILED (Message: %s) (Reason: %s)",
+	c.log.Infof("Observing pod %s - status %s: FAILED (Message: %s) (Reason: %s)",
 		podName,
 		status,
 		pod.Status.Message,
 		pod.Status.Reason,
 	)
 	for idx, cond := range pod.Status.Conditions {
-		glog.Infof("Failed pod %s - condition %d: %#v", podName, idx, cond)
+		c.log.Infof("Failed pod %s - condition %d: %#v", podName, idx, cond)
 	}
 	for idx, cont := range pod.Status.ContainerStatuses {
-		glog.Infof("Failed pod %s - container %d: %#v", podName, idx, cont)
+		c.log.Infof("Failed pod %s - container %d: %#v", podName, idx, cont)
 	}
 
 	// Get logs
@@ -1290,7 +2285,7 @@ func (c *dotmeshController) logPodInfo(pod *v1.Pod) {
 	func() {
 		readCloser, err := logReq.Stream()
 		if err != nil {
-			glog.Errorf("Failed pod %s - error getting logs - %#v", podName, err)
+			c.log.Errorf("Failed pod %s - error getting logs - %#v", podName, err)
 			return // Only from inner func
 		}
 		defer readCloser.Close()
@@ -1298,14 +2293,14 @@ func (c *dotmeshController) logPodInfo(pod *v1.Pod) {
 		for {
 			line, err := scanner.ReadString('\n')
 			if line != "" {
-				glog.Infof("Failed pod %s log: %s", podName, line)
+				c.log.Infof("Failed pod %s log: %s", podName, line)
 			}
 			if err != nil {
 				if err == io.EOF {
-					glog.Infof("Failed pod %s log ends %s", podName, line)
+					c.log.Infof("Failed pod %s log ends %s", podName, line)
 					return // Only from inner func
 				} else {
-					glog.Errorf("Failed pod %s - error reading logs - %#v", podName, err)
+					c.log.Errorf("Failed pod %s - error reading logs - %#v", podName, err)
 					return // Only from inner func
 				}
 			}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// testController is a controller with just the ConfigMap data given, for
+// testing the functions that work from the config.
+func testController(data map[string]string) *dotmeshController {
+	return &dotmeshController{
+		log:    logrus.New(),
+		config: &v1.ConfigMap{Data: data},
+	}
+}
+
+func TestChooseCanaryNodes(t *testing.T) {
+	validNodes := map[string]struct{}{"a": {}, "b": {}, "c": {}, "d": {}}
+	nodeLabels := map[string]labels.Set{
+		"a": {},
+		"b": {"dotmesh.io/canary": "true"},
+		"c": {"dotmesh.io/canary": "true", "zone": "west"},
+		"d": {"zone": "west"},
+	}
+	for _, c := range []struct {
+		name     string
+		data     map[string]string
+		expected []string
+		err      string
+	}{
+		{name: "no canary image", data: map[string]string{CONFIG_CANARY_NODE_COUNT: "2"}, expected: []string{}},
+		{name: "count", data: map[string]string{CONFIG_CANARY_IMAGE: "canary", CONFIG_CANARY_NODE_COUNT: "2"}, expected: []string{"a", "b"}},
+		{name: "count over the number of nodes", data: map[string]string{CONFIG_CANARY_IMAGE: "canary", CONFIG_CANARY_NODE_COUNT: "10"}, expected: []string{"a", "b", "c", "d"}},
+		{name: "percent rounds up", data: map[string]string{CONFIG_CANARY_IMAGE: "canary", CONFIG_CANARY_NODE_PERCENT: "30"}, expected: []string{"a", "b"}},
+		{name: "count wins over percent", data: map[string]string{CONFIG_CANARY_IMAGE: "canary", CONFIG_CANARY_NODE_COUNT: "1", CONFIG_CANARY_NODE_PERCENT: "100"}, expected: []string{"a"}},
+		{name: "selector alone", data: map[string]string{CONFIG_CANARY_IMAGE: "canary", CONFIG_CANARY_NODE_SELECTOR: "dotmesh.io/canary=true"}, expected: []string{"b", "c"}},
+		{name: "selector and count", data: map[string]string{CONFIG_CANARY_IMAGE: "canary", CONFIG_CANARY_NODE_SELECTOR: "zone=west", CONFIG_CANARY_NODE_COUNT: "1"}, expected: []string{"c"}},
+		{name: "selector and percent", data: map[string]string{CONFIG_CANARY_IMAGE: "canary", CONFIG_CANARY_NODE_SELECTOR: "dotmesh.io/canary", CONFIG_CANARY_NODE_PERCENT: "50"}, expected: []string{"b"}},
+		{name: "selector matching nothing", data: map[string]string{CONFIG_CANARY_IMAGE: "canary", CONFIG_CANARY_NODE_SELECTOR: "zone=east"}, expected: []string{}},
+		{name: "bad selector", data: map[string]string{CONFIG_CANARY_IMAGE: "canary", CONFIG_CANARY_NODE_SELECTOR: "zone in west"}, err: "must be a label selector"},
+		{name: "bad count", data: map[string]string{CONFIG_CANARY_IMAGE: "canary", CONFIG_CANARY_NODE_COUNT: "-1"}, err: "must be a number of nodes"},
+		{name: "bad percent", data: map[string]string{CONFIG_CANARY_IMAGE: "canary", CONFIG_CANARY_NODE_PERCENT: "101"}, err: "must be a percentage"},
+		{name: "no nodes chosen", data: map[string]string{CONFIG_CANARY_IMAGE: "canary"}, err: "but none of"},
+	} {
+		canaryNodes, err := testController(c.data).chooseCanaryNodes(validNodes, nodeLabels)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: expected an error containing %q, got %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", c.name, err)
+			continue
+		}
+		chosen := []string{}
+		for node := range canaryNodes {
+			chosen = append(chosen, node)
+		}
+		sort.Strings(chosen)
+		if !reflect.DeepEqual(chosen, c.expected) {
+			t.Errorf("%s: expected canary nodes %v, got %v", c.name, c.expected, chosen)
+		}
+	}
+}
+
+func TestLogAddressForNode(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		data     map[string]string
+		expected string
+		err      string
+	}{
+		{name: "no logging", data: map[string]string{CONFIG_LOG_ADDRESS: ""}, expected: ""},
+		{name: "cluster wide", data: map[string]string{CONFIG_LOG_ADDRESS: "logs:514"}, expected: "logs:514"},
+		{name: "node override", data: map[string]string{CONFIG_LOG_ADDRESS: "logs:514", CONFIG_LOG_ADDRESS_NODE_PREFIX + "node1": "local-logs:514"}, expected: "local-logs:514"},
+		{name: "other node's override", data: map[string]string{CONFIG_LOG_ADDRESS: "logs:514", CONFIG_LOG_ADDRESS_NODE_PREFIX + "node2": "local-logs:514"}, expected: "logs:514"},
+		{name: "override turning logging off", data: map[string]string{CONFIG_LOG_ADDRESS: "logs:514", CONFIG_LOG_ADDRESS_NODE_PREFIX + "node1": ""}, expected: ""},
+		{name: "no port", data: map[string]string{CONFIG_LOG_ADDRESS: "logs"}, err: "must be host:port"},
+		{name: "bad port", data: map[string]string{CONFIG_LOG_ADDRESS_NODE_PREFIX + "node1": "logs:99999"}, err: "logAddress.node1"},
+	} {
+		logAddress, err := testController(c.data).logAddressForNode("node1")
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: expected an error containing %q, got %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil || logAddress != c.expected {
+			t.Errorf("%s: expected %q, got %q, %v", c.name, c.expected, logAddress, err)
+		}
+	}
+}
+
+func TestLocalPoolSizeForNode(t *testing.T) {
+	node := func(ephemeralStorage string) *v1.Node {
+		n := &v1.Node{ObjectMeta: meta_v1.ObjectMeta{Name: "node1"}}
+		if ephemeralStorage != "" {
+			n.Status.Capacity = v1.ResourceList{v1.ResourceEphemeralStorage: resource.MustParse(ephemeralStorage)}
+		}
+		return n
+	}
+	auto := func(fraction, maxSize string) map[string]string {
+		return map[string]string{
+			CONFIG_MODE:                     CONFIG_MODE_LOCAL,
+			CONFIG_LOCAL_POOL_SIZE_PER_NODE: CONFIG_LOCAL_POOL_SIZE_AUTO,
+			CONFIG_LOCAL_POOL_AUTO_FRACTION: fraction,
+			CONFIG_LOCAL_POOL_MAX_SIZE:      maxSize,
+		}
+	}
+	for _, c := range []struct {
+		name     string
+		data     map[string]string
+		node     *v1.Node
+		expected string
+		err      string
+	}{
+		{name: "fixed size", data: map[string]string{CONFIG_MODE: CONFIG_MODE_LOCAL, CONFIG_LOCAL_POOL_SIZE_PER_NODE: "10G"}, node: node(""), expected: "10G"},
+		{name: "auto outside local mode", data: map[string]string{CONFIG_MODE: "pvcPerNode", CONFIG_LOCAL_POOL_SIZE_PER_NODE: CONFIG_LOCAL_POOL_SIZE_AUTO}, node: node(""), expected: CONFIG_LOCAL_POOL_SIZE_AUTO},
+		{name: "auto", data: auto("0.5", "500G"), node: node("100Gi"), expected: "51200M"},
+		{name: "auto up to the maximum", data: auto("0.8", "10Gi"), node: node("100Gi"), expected: "10240M"},
+		{name: "bad fraction", data: auto("1.5", "500G"), node: node("100Gi"), err: "must be a fraction"},
+		{name: "bad maximum", data: auto("0.5", "lots"), node: node("100Gi"), err: CONFIG_LOCAL_POOL_MAX_SIZE},
+		{name: "no capacity", data: auto("0.5", "500G"), node: node(""), err: "doesn't report its"},
+	} {
+		size, err := testController(c.data).localPoolSizeForNode(c.node)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: expected an error containing %q, got %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil || size != c.expected {
+			t.Errorf("%s: expected %q, got %q, %v", c.name, c.expected, size, err)
+		}
+	}
+}
+
+func TestParseExtraEnv(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		value    string
+		expected []v1.EnvVar
+		err      string
+	}{
+		{name: "empty", value: "  ", expected: []v1.EnvVar{}},
+		{name: "variables", value: `[{"name":"GOGC","value":"50"},{"name":"TZ","value":"UTC"}]`, expected: []v1.EnvVar{{Name: "GOGC", Value: "50"}, {Name: "TZ", Value: "UTC"}}},
+		{name: "not JSON", value: "GOGC=50", err: "must be a JSON list"},
+		{name: "no name", value: `[{"value":"50"}]`, err: "has no name"},
+		{name: "operator's own", value: `[{"name":"LOG_ADDR","value":"logs:514"}]`, err: "LOG_ADDR is set by the operator"},
+		{name: "inherited names", value: `[{"name":"EXTRA_INHERIT_ENVIRONMENT_NAMES","value":"X"}]`, err: "set by the operator"},
+	} {
+		env, err := parseExtraEnv(c.value)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: expected an error containing %q, got %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(env, c.expected) {
+			t.Errorf("%s: expected %+v, got %+v, %v", c.name, c.expected, env, err)
+		}
+	}
+}
+
+func TestWithInheritedNames(t *testing.T) {
+	if env := withInheritedNames([]v1.EnvVar{}); len(env) != 0 {
+		t.Errorf("expected nothing to be added to no variables, got %+v", env)
+	}
+	extraEnv := []v1.EnvVar{{Name: "GOGC", Value: "50"}, {Name: "TZ", Value: "UTC"}}
+	env := withInheritedNames(extraEnv)
+	expected := append(append([]v1.EnvVar{}, extraEnv...), v1.EnvVar{Name: "EXTRA_INHERIT_ENVIRONMENT_NAMES", Value: "GOGC TZ"})
+	if !reflect.DeepEqual(env, expected) {
+		t.Errorf("expected %+v, got %+v", expected, env)
+	}
+	if len(extraEnv) != 2 {
+		t.Errorf("expected the parsed variables to be left alone, got %+v", extraEnv)
+	}
+}
+
+func TestParseInitContainers(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		value    string
+		expected []v1.Container
+		err      string
+	}{
+		{name: "empty", value: "", expected: []v1.Container{}},
+		{name: "containers", value: `[{"name":"modprobe","image":"busybox","command":["modprobe","zfs"]}]`, expected: []v1.Container{{Name: "modprobe", Image: "busybox", Command: []string{"modprobe", "zfs"}}}},
+		{name: "not JSON", value: "busybox", err: "must be a JSON list"},
+		{name: "no image", value: `[{"name":"modprobe"}]`, err: `init container 0 ("modprobe") has no image`},
+	} {
+		containers, err := parseInitContainers(c.value)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: expected an error containing %q, got %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(containers, c.expected) {
+			t.Errorf("%s: expected %+v, got %+v, %v", c.name, c.expected, containers, err)
+		}
+	}
+}
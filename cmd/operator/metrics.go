@@ -0,0 +1,120 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reasons for dotmesh_reconcile_errors_total
+const RECONCILE_POD_CREATE_FAILED = "pod_create_failed"
+const RECONCILE_POD_DELETE_FAILED = "pod_delete_failed"
+const RECONCILE_NODE_LIST_FAILED = "node_list_failed"
+const RECONCILE_CONFIG_INVALID = "config_invalid"
+
+// Outcomes for dotmesh_reconcile_duration_seconds: process() either gets as
+// far as deleting and creating pods, some of which may fail, or gives up
+// before changing anything.
+const RECONCILE_SUCCESS = "success"
+const RECONCILE_PARTIAL_FAILURE = "partial_failure"
+const RECONCILE_TOTAL_FAILURE = "total_failure"
+
+// reconcileMetrics are the operator's metrics about process() itself, rather
+// than the cluster it's looking after.
+type reconcileMetrics struct {
+	errors   *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	// Pods counted by stuckPending, by UID, so that a pod isn't counted
+	// again each time process() finds it's still there
+	stuckPending        prometheus.Counter
+	stuckPendingCounted map[string]struct{}
+	// Filesystems counted by splitBrain, likewise
+	splitBrain        prometheus.Counter
+	splitBrainCounted map[string]struct{}
+}
+
+func newReconcileMetrics(metricLabels prometheus.Labels) *reconcileMetrics {
+	return &reconcileMetrics{
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "dotmesh_reconcile_errors_total",
+			Help:        "Number of errors reconciling Dotmesh pods, by reason",
+			ConstLabels: metricLabels,
+		}, []string{"reason"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "dotmesh_reconcile_duration_seconds",
+			Help:        "How long reconciling Dotmesh pods took, by outcome",
+			ConstLabels: metricLabels,
+			Buckets:     prometheus.ExponentialBuckets(0.01, 2, 14),
+		}, []string{"outcome"}),
+		stuckPending: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "dotmesh_pods_stuck_pending_total",
+			Help:        "Number of Dotmesh pods found Pending for longer than pod.pendingTimeoutSeconds",
+			ConstLabels: metricLabels,
+		}),
+		stuckPendingCounted: map[string]struct{}{},
+		splitBrain: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "dotmesh_split_brain_detected",
+			Help:        "Number of filesystems found with more than one Dotmesh pod thinking it's the master for them",
+			ConstLabels: metricLabels,
+		}),
+		splitBrainCounted: map[string]struct{}{},
+	}
+}
+
+func (m *reconcileMetrics) register() {
+	prometheus.MustRegister(m.errors)
+	prometheus.MustRegister(m.duration)
+	prometheus.MustRegister(m.stuckPending)
+	prometheus.MustRegister(m.splitBrain)
+}
+
+// reconcileError counts err under reason, and returns it.
+func (m *reconcileMetrics) reconcileError(reason string, err error) error {
+	if err != nil {
+		m.errors.WithLabelValues(reason).Inc()
+	}
+	return err
+}
+
+// partialFailure is returned from process() when it got as far as changing
+// pods, but some of the changes failed.
+type partialFailure struct {
+	error
+}
+
+func (m *reconcileMetrics) observeReconcile(started time.Time, err error) {
+	outcome := RECONCILE_SUCCESS
+	if _, ok := err.(partialFailure); ok {
+		outcome = RECONCILE_PARTIAL_FAILURE
+	} else if err != nil {
+		outcome = RECONCILE_TOTAL_FAILURE
+	}
+	m.duration.WithLabelValues(outcome).Observe(time.Since(started).Seconds())
+}
+
+// countStuckPending counts the stuck Pending pods process() found, by UID,
+// that it hadn't already.
+func (m *reconcileMetrics) countStuckPending(uids map[string]struct{}) {
+	for uid := range uids {
+		if _, ok := m.stuckPendingCounted[uid]; !ok {
+			m.stuckPending.Inc()
+		}
+	}
+	m.stuckPendingCounted = uids
+}
+
+// countSplitBrain counts the split-brain filesystems process() found, by id,
+// that it hadn't already, and returns those.
+func (m *reconcileMetrics) countSplitBrain(split map[string][]string) map[string]struct{} {
+	counted := map[string]struct{}{}
+	newlySplit := map[string]struct{}{}
+	for filesystemId := range split {
+		counted[filesystemId] = struct{}{}
+		if _, ok := m.splitBrainCounted[filesystemId]; !ok {
+			m.splitBrain.Inc()
+			newlySplit[filesystemId] = struct{}{}
+		}
+	}
+	m.splitBrainCounted = counted
+	return newlySplit
+}
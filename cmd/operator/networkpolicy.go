@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const DOTMESH_NETWORK_POLICY = "dotmesh-server"
+const DOTMESH_CLIENT_LABEL = "dotmesh.io/client" // pods labelled "true" may use the dotmesh API
+const DOTMESH_API_PORT = 32607
+const DOTMESH_LIVENESS_PORT = 32608
+const DOTMESH_OPERATOR_APP = "dotmesh-operator" // the operator's own pods' "app" label
+const NAMESPACE_NAME_LABEL = "kubernetes.io/metadata.name"
+
+// The NetworkPolicy on dotmesh server pods lets other dotmesh servers reach
+// them on any port, for replication and NATS, and lets pods labelled
+// dotmesh.io/client=true in any namespace, and every pod in the namespaces
+// listed in network.allowFromNamespaces, reach the API port. The operator's
+// own pods may reach the liveness port, to ask each server which filesystems
+// it's the master for (see splitbrain.go). Namespaces are matched by the
+// kubernetes.io/metadata.name label, which Kubernetes sets on every namespace
+// from 1.21.
+func (c *dotmeshController) dotmeshNetworkPolicySpec() networking.NetworkPolicySpec {
+	serverPods := meta_v1.LabelSelector{
+		MatchLabels: map[string]string{DOTMESH_ROLE_LABEL: c.serverRole()},
+	}
+
+	apiPeers := []networking.NetworkPolicyPeer{
+		{
+			PodSelector:       &meta_v1.LabelSelector{MatchLabels: map[string]string{DOTMESH_CLIENT_LABEL: "true"}},
+			NamespaceSelector: &meta_v1.LabelSelector{},
+		},
+	}
+	namespaces := []string{}
+	for _, namespace := range strings.Split(c.config.Data[CONFIG_NETWORK_ALLOW_FROM_NAMESPACES], ",") {
+		namespace = strings.TrimSpace(namespace)
+		if namespace != "" {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	if len(namespaces) > 0 {
+		apiPeers = append(apiPeers, networking.NetworkPolicyPeer{
+			NamespaceSelector: &meta_v1.LabelSelector{
+				MatchExpressions: []meta_v1.LabelSelectorRequirement{
+					{Key: NAMESPACE_NAME_LABEL, Operator: meta_v1.LabelSelectorOpIn, Values: namespaces},
+				},
+			},
+		})
+	}
+
+	tcp := v1.ProtocolTCP
+	apiPort := intstr.FromInt(DOTMESH_API_PORT)
+	livenessPort := intstr.FromInt(DOTMESH_LIVENESS_PORT)
+	return networking.NetworkPolicySpec{
+		PodSelector: serverPods,
+		Ingress: []networking.NetworkPolicyIngressRule{
+			{
+				From: []networking.NetworkPolicyPeer{{PodSelector: &serverPods}},
+			},
+			{
+				Ports: []networking.NetworkPolicyPort{{Protocol: &tcp, Port: &apiPort}},
+				From:  apiPeers,
+			},
+			{
+				Ports: []networking.NetworkPolicyPort{{Protocol: &tcp, Port: &livenessPort}},
+				From: []networking.NetworkPolicyPeer{
+					{PodSelector: &meta_v1.LabelSelector{MatchLabels: map[string]string{"app": DOTMESH_OPERATOR_APP}}},
+				},
+			},
+		},
+		PolicyTypes: []networking.PolicyType{networking.PolicyTypeIngress},
+	}
+}
+
+// ensureNetworkPolicy creates the dotmesh server NetworkPolicy, or updates it
+// if it's been changed or the ConfigMap asks for a different one. The policy
+// is opt-in, with network.policyEnabled, as it cuts off any client that
+// isn't labelled or in an allowed namespace; turning it off again deletes it.
+func (c *dotmeshController) ensureNetworkPolicy() error {
+	policies := c.client.NetworkingV1().NetworkPolicies(c.namespace)
+
+	if c.config.Data[CONFIG_NETWORK_POLICY_ENABLED] != "true" {
+		err := policies.Delete(DOTMESH_NETWORK_POLICY, &meta_v1.DeleteOptions{})
+		if err == nil {
+			c.log.Infof("Deleted network policy %s, as it's no longer enabled", DOTMESH_NETWORK_POLICY)
+		} else if !errors.IsNotFound(err) {
+			return fmt.Errorf("Error deleting network policy %s: %+v", DOTMESH_NETWORK_POLICY, err)
+		}
+		return nil
+	}
+
+	spec := c.dotmeshNetworkPolicySpec()
+	existing, err := policies.Get(DOTMESH_NETWORK_POLICY, meta_v1.GetOptions{})
+	if errors.IsNotFound(err) {
+		c.log.Infof("Creating network policy %s", DOTMESH_NETWORK_POLICY)
+		_, err = policies.Create(&networking.NetworkPolicy{
+			ObjectMeta: meta_v1.ObjectMeta{
+				Name:      DOTMESH_NETWORK_POLICY,
+				Namespace: c.namespace,
+			},
+			Spec: spec,
+		})
+	} else if err == nil && !reflect.DeepEqual(existing.Spec, spec) {
+		c.log.Infof("Updating network policy %s", DOTMESH_NETWORK_POLICY)
+		updated := existing.DeepCopy()
+		updated.Spec = spec
+		_, err = policies.Update(updated)
+	}
+	if err != nil {
+		return fmt.Errorf("Error ensuring network policy %s: %+v", DOTMESH_NETWORK_POLICY, err)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+// Nodes can be under memory, disk or PID pressure while still Ready. The
+// kubelet evicts pods from a node under disk pressure, so no new dotmesh pod
+// is started on one (it's treated as suspended), but an existing one is left
+// running. Memory and PID pressure are only warned about.
+// dotmesh_nodes_under_pressure counts the nodes under each.
+
+// Values of the type label of dotmesh_nodes_under_pressure
+const NODE_PRESSURE_DISK = "disk"
+const NODE_PRESSURE_MEMORY = "memory"
+const NODE_PRESSURE_PID = "pid"
+
+var nodePressureConditions = map[v1.NodeConditionType]string{
+	v1.NodeDiskPressure:   NODE_PRESSURE_DISK,
+	v1.NodeMemoryPressure: NODE_PRESSURE_MEMORY,
+	v1.NodePIDPressure:    NODE_PRESSURE_PID,
+}
+
+// nodePressureCondition is the NODE_PRESSURE_* the condition says the node
+// is under, if any.
+func nodePressureCondition(condition v1.NodeCondition) (string, bool) {
+	pressure, ok := nodePressureConditions[condition.Type]
+	if !ok || condition.Status != v1.ConditionTrue {
+		return "", false
+	}
+	return pressure, true
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	lister_v1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// In namespace-scoped mode (--cluster-scoped=false), for multi-tenant
+// clusters where the operator can't be given cluster-wide permissions,
+// there's a controller for each of --watch-namespaces, which runs dotmesh
+// in that namespace on the nodes that namespace's own pods are on. It
+// can't list or label nodes, so the nodes it runs dotmesh on are stand-ins
+// made from the pods' spec.nodeName, and dotmesh pods are bound to them by
+// the hostname label the kubelet gives every node, rather than by
+// DOTMESH_NODE_LABEL. Each namespace's dotmesh has its own ConfigMap and
+// etcd, and must be given a poolName and local.poolLocation that no other
+// namespace uses.
+//
+// Two namespaces' dotmesh servers can't share a node, though: require_zfs.sh
+// replaces the docker plugin socket /run/docker/plugins/dm.sock, and mounts
+// the dotmesh-boltdb docker volume, whichever cluster it's for. So a node that already has another watched
+// namespace's server pod on isn't given one, and namespaces whose pods are
+// on the same nodes only get dotmesh on whichever nodes they got first.
+//
+// The same goes for several cluster-scoped operators, each given its own
+// --namespace. Outside the default DOTMESH_NAMESPACE, the names of
+// cluster-wide objects, the inner server container, and the server pods'
+// role label all have the namespace added, so that they don't clash. Their
+// servers can't share nodes either, so each such operator only runs dotmesh
+// on the nodes labelled DOTMESH_CLUSTER_LABEL=<its namespace>, and the
+// default one only on the nodes without the label (or labelled with
+// DOTMESH_NAMESPACE).
+
+const NAMESPACE_SCOPED_NODE_LABEL = "kubernetes.io/hostname"
+
+// Which cluster-scoped operator's dotmesh a node is for, by its --namespace
+const DOTMESH_CLUSTER_LABEL = "dotmesh.io/cluster"
+
+func parseWatchNamespaces(value string) []string {
+	namespaces := []string{}
+	for _, namespace := range strings.Split(value, ",") {
+		namespace = strings.TrimSpace(namespace)
+		if namespace != "" {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces
+}
+
+// serverNodeClaims is which watched namespace has each node for its server
+// pod, shared by the controllers in namespace-scoped mode, so that two of
+// them processing at once can't both create one on the same node before
+// either's pod reaches the other's cache.
+type serverNodeClaims struct {
+	lock   sync.Mutex
+	claims map[string]string // node to namespace
+}
+
+func newServerNodeClaims() *serverNodeClaims {
+	return &serverNodeClaims{claims: map[string]string{}}
+}
+
+// claim gives node to namespace if no other namespace has it, and returns
+// the namespace that has it.
+func (n *serverNodeClaims) claim(node, namespace string) string {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	owner, ok := n.claims[node]
+	if !ok {
+		n.claims[node] = namespace
+		owner = namespace
+	}
+	return owner
+}
+
+// release gives up namespace's claims on the nodes not in keep.
+func (n *serverNodeClaims) release(namespace string, keep map[string]struct{}) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	for node, owner := range n.claims {
+		if _, ok := keep[node]; owner == namespace && !ok {
+			delete(n.claims, node)
+		}
+	}
+}
+
+// claimServerNodes updates this namespace's claims, in namespace-scoped
+// mode, to the nodes its server pods are on and the undotted nodes it's
+// about to create them on, claiming the former.
+func (c *dotmeshController) claimServerNodes(dotmeshes []*v1.Pod, undottedNodes map[string]struct{}) {
+	if c.siblingNodes == nil {
+		return
+	}
+	keep := map[string]struct{}{}
+	for node := range undottedNodes {
+		keep[node] = struct{}{}
+	}
+	for _, pod := range dotmeshes {
+		node, ok := pod.Spec.NodeSelector[c.nodeLabel]
+		if !ok {
+			continue
+		}
+		keep[node] = struct{}{}
+		if owner := c.siblingNodes.claim(node, c.namespace); owner != c.namespace {
+			c.log.Errorf("Pod %s is on node %s, which namespace %s's dotmesh server is also on; they will get in each other's way", pod.ObjectMeta.Name, node, owner)
+		}
+	}
+	c.siblingNodes.release(c.namespace, keep)
+}
+
+// nodeInCluster is whether node is for this operator's dotmesh cluster, by
+// its DOTMESH_CLUSTER_LABEL. In namespace-scoped mode, nodes are stand-ins
+// without labels, and are shared out by serverNodeClaims instead.
+func (c *dotmeshController) nodeInCluster(node *v1.Node) bool {
+	if !c.clusterScoped {
+		return true
+	}
+	cluster, ok := node.ObjectMeta.Labels[DOTMESH_CLUSTER_LABEL]
+	if !ok {
+		return c.namespace == DOTMESH_NAMESPACE
+	}
+	return cluster == c.namespace
+}
+
+// siblingOnNode is the other watched namespace whose server pod is on, or is
+// about to be created on, node, or "" if there isn't one, in which case the
+// node is claimed for this namespace's.
+func (c *dotmeshController) siblingOnNode(node string) string {
+	if c.siblingNodes == nil {
+		return ""
+	}
+	for _, sibling := range c.siblings {
+		if sibling == c {
+			continue
+		}
+		pods, err := sibling.podLister.List(labels.Everything())
+		if err != nil {
+			continue
+		}
+		for _, pod := range pods {
+			if pod.Spec.NodeSelector[sibling.nodeLabel] == node {
+				return sibling.namespace
+			}
+		}
+	}
+	if owner := c.siblingNodes.claim(node, c.namespace); owner != c.namespace {
+		return owner
+	}
+	return ""
+}
+
+// innerServerName is the name of the Docker container require_zfs.sh runs
+// the real dotmesh server in, which must differ between namespaces sharing
+// a node.
+func (c *dotmeshController) innerServerName() string {
+	if c.clusterScoped && c.namespace == DOTMESH_NAMESPACE {
+		return "dotmesh-server-inner"
+	}
+	return "dotmesh-server-inner-" + c.namespace
+}
+
+// namespacedName is name with the namespace added, unless it's
+// DOTMESH_NAMESPACE, for objects (and labels) that must differ between
+// namespaces.
+func (c *dotmeshController) namespacedName(name string) string {
+	if c.namespace == DOTMESH_NAMESPACE {
+		return name
+	}
+	return name + "-" + c.namespace
+}
+
+// serverRole is the DOTMESH_ROLE_LABEL value of this namespace's server
+// pods.
+func (c *dotmeshController) serverRole() string {
+	return c.namespacedName(DOTMESH_ROLE_SERVER)
+}
+
+// serverPodSelector selects this namespace's server pods, and any still
+// labelled with plain DOTMESH_ROLE_SERVER, so that process() replaces them.
+func (c *dotmeshController) serverPodSelector() string {
+	if c.serverRole() == DOTMESH_ROLE_SERVER {
+		return fmt.Sprintf("%s=%s", DOTMESH_ROLE_LABEL, DOTMESH_ROLE_SERVER)
+	}
+	return fmt.Sprintf("%s in (%s,%s)", DOTMESH_ROLE_LABEL, DOTMESH_ROLE_SERVER, c.serverRole())
+}
+
+// trackWorkloadNodes watches every pod in the namespace, in place of the
+// cluster-scoped node informer, and makes listNodes list the nodes that
+// have any pods other than dotmesh's own on.
+func (c *dotmeshController) trackWorkloadNodes() {
+	podIndexer, podInformer := cache.NewIndexerInformer(
+		&cache.ListWatch{
+			ListFunc: func(lo meta_v1.ListOptions) (runtime.Object, error) {
+				return c.client.Core().Pods(c.namespace).List(lo)
+			},
+			WatchFunc: func(lo meta_v1.ListOptions) (watch.Interface, error) {
+				return c.client.Core().Pods(c.namespace).Watch(lo)
+			},
+		},
+		&v1.Pod{},
+		60*time.Second,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				c.logFor(LOG_COMPONENT_INFORMER).V(3).Infof("WORKLOAD POD ADD %#v", obj)
+				c.scheduleUpdate()
+			},
+			UpdateFunc: func(old, new interface{}) {
+				c.logFor(LOG_COMPONENT_INFORMER).V(3).Infof("WORKLOAD POD UPDATE %#v -> %#v", old, new)
+				c.scheduleUpdate()
+			},
+			DeleteFunc: func(obj interface{}) {
+				c.logFor(LOG_COMPONENT_INFORMER).V(3).Infof("WORKLOAD POD DELETE %#v", obj)
+				c.scheduleUpdate()
+			},
+		},
+		cache.Indexers{},
+	)
+
+	c.nodeInformer = podInformer
+	c.namespacePodLister = lister_v1.NewPodLister(podIndexer)
+	c.listNodes = func() ([]*v1.Node, error) {
+		nodeNames := map[string]struct{}{}
+		for _, obj := range podIndexer.List() {
+			pod := obj.(*v1.Pod)
+			if _, ok := pod.ObjectMeta.Labels[DOTMESH_ROLE_LABEL]; ok {
+				continue
+			}
+			if pod.Spec.NodeName == "" || pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+				continue
+			}
+			nodeNames[pod.Spec.NodeName] = struct{}{}
+		}
+
+		nodes := []*v1.Node{}
+		for nodeName := range nodeNames {
+			nodes = append(nodes, &v1.Node{
+				ObjectMeta: meta_v1.ObjectMeta{
+					Name:   nodeName,
+					Labels: map[string]string{NAMESPACE_SCOPED_NODE_LABEL: nodeName},
+				},
+			})
+		}
+		sort.Slice(nodes, func(i, j int) bool {
+			return nodes[i].ObjectMeta.Name < nodes[j].ObjectMeta.Name
+		})
+		return nodes, nil
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	lister_v1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// The listers only see pods with the right DOTMESH_ROLE_LABEL, so a dotmesh
+// pod that's lost its label, or was created without it, is never reconciled
+// and runs forever. process() also looks through every pod in the namespace,
+// from namespacePodLister's cache, and warns about the ones that look like
+// dotmesh pods - they have one of dotmesh's pod labels, or run the dotmesh
+// server image - that the listers don't know about, deleting them if
+// orphan.deleteUnlabelled is "true". Pods with an owner, such as the
+// operator's own and etcd's, are left alone: something else is looking
+// after them.
+
+// trackNamespacePods caches every pod in the namespace for findOrphanedPods.
+// It isn't needed in namespace-scoped mode, where trackWorkloadNodes caches
+// them already.
+func (c *dotmeshController) trackNamespacePods() {
+	podIndexer, podInformer := cache.NewIndexerInformer(
+		&cache.ListWatch{
+			ListFunc: func(lo meta_v1.ListOptions) (runtime.Object, error) {
+				return c.client.Core().Pods(c.namespace).List(lo)
+			},
+			WatchFunc: func(lo meta_v1.ListOptions) (watch.Interface, error) {
+				return c.client.Core().Pods(c.namespace).Watch(lo)
+			},
+		},
+		&v1.Pod{},
+		60*time.Second,
+		// Orphans are looked for in process(), which the tracked pods'
+		// informers trigger often enough
+		cache.ResourceEventHandlerFuncs{},
+		cache.Indexers{},
+	)
+	c.namespacePodInformer = podInformer
+	c.namespacePodLister = lister_v1.NewPodLister(podIndexer)
+}
+
+// findOrphanedPods lists the pods in the namespace that look like dotmesh
+// pods, but aren't among the tracked pods the listers returned.
+func (c *dotmeshController) findOrphanedPods(tracked ...[]*v1.Pod) ([]*v1.Pod, error) {
+	trackedUIDs := map[string]struct{}{}
+	for _, pods := range tracked {
+		for _, pod := range pods {
+			trackedUIDs[string(pod.ObjectMeta.UID)] = struct{}{}
+		}
+	}
+
+	pods, err := c.namespacePodLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	orphans := []*v1.Pod{}
+	for _, pod := range pods {
+		if _, ok := trackedUIDs[string(pod.ObjectMeta.UID)]; ok {
+			continue
+		}
+		if !c.looksLikeDotmesh(pod) || len(pod.ObjectMeta.OwnerReferences) > 0 {
+			continue
+		}
+		if pod.ObjectMeta.DeletionTimestamp != nil {
+			// Already on its way out
+			continue
+		}
+		orphans = append(orphans, pod)
+	}
+	return orphans, nil
+}
+
+// looksLikeDotmesh is whether pod has either of the labels the operator
+// gives dotmesh pods, or has a container running the dotmesh server image,
+// or the canary one, at any tag.
+func (c *dotmeshController) looksLikeDotmesh(pod *v1.Pod) bool {
+	for _, label := range []string{DOTMESH_ROLE_LABEL, DOTMESH_CANARY_LABEL} {
+		if _, ok := pod.ObjectMeta.Labels[label]; ok {
+			return true
+		}
+	}
+
+	images := map[string]struct{}{imageRepository(c.dotmeshImage(false)): struct{}{}}
+	if c.config.Data[CONFIG_CANARY_IMAGE] != "" {
+		images[imageRepository(c.dotmeshImage(true))] = struct{}{}
+	}
+	for _, containers := range [][]v1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for _, container := range containers {
+			if _, ok := images[imageRepository(container.Image)]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// imageRepository is image without its tag or digest.
+func imageRepository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	// a colon before the last slash is a registry's port
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
+
+// handleOrphanedPods warns about, and if configured deletes, the orphaned
+// pods, and returns how many there were. Failing to list them is only
+// logged, as it doesn't stop the tracked pods being reconciled.
+func (c *dotmeshController) handleOrphanedPods(tracked ...[]*v1.Pod) int {
+	orphans, err := c.findOrphanedPods(tracked...)
+	if err != nil {
+		c.log.Warnf("Error listing pods in %s to look for orphaned dotmesh pods: %+v", c.namespace, err)
+		return 0
+	}
+
+	deleteOrphans := c.config.Data[CONFIG_ORPHAN_DELETE_UNLABELLED] == "true"
+	for _, pod := range orphans {
+		if !deleteOrphans {
+			c.log.Warnf("Pod %s looks like a dotmesh pod, but hasn't got a %s label the operator looks after; set %s to \"true\" to have it deleted",
+				pod.ObjectMeta.Name, DOTMESH_ROLE_LABEL, CONFIG_ORPHAN_DELETE_UNLABELLED)
+			continue
+		}
+		c.log.Warnf("Deleting pod %s, which looks like a dotmesh pod but hasn't got a %s label the operator looks after", pod.ObjectMeta.Name, DOTMESH_ROLE_LABEL)
+		dp := meta_v1.DeletePropagationBackground
+		err := c.client.Core().Pods(c.namespace).Delete(pod.ObjectMeta.Name, &meta_v1.DeleteOptions{
+			PropagationPolicy: &dp,
+		})
+		if err != nil {
+			c.log.Error(c.reconcileMetrics.reconcileError(RECONCILE_POD_DELETE_FAILED, err))
+		}
+	}
+	return len(orphans)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// boundedGroup runs functions in goroutines, at most parallelism of them at
+// once, and collects their errors, so that process() can make its
+// Kubernetes API calls concurrently. It's errgroup.Group with a semaphore,
+// except that one failure doesn't cancel the rest: like the serial loops it
+// replaced, it presses on and reports every error at the end.
+type boundedGroup struct {
+	semaphore chan struct{}
+	wg        sync.WaitGroup
+	errsLock  sync.Mutex
+	errs      []error
+}
+
+func newBoundedGroup(parallelism int) *boundedGroup {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	return &boundedGroup{
+		semaphore: make(chan struct{}, parallelism),
+	}
+}
+
+// Go runs f in a goroutine once there's room for it.
+func (g *boundedGroup) Go(f func() error) {
+	g.wg.Add(1)
+	g.semaphore <- struct{}{}
+	go func() {
+		defer func() {
+			<-g.semaphore
+			g.wg.Done()
+		}()
+		err := f()
+		if err != nil {
+			g.errsLock.Lock()
+			g.errs = append(g.errs, err)
+			g.errsLock.Unlock()
+		}
+	}()
+}
+
+// Wait waits for every function to return, and returns their errors
+// combined into one, or nil if there weren't any.
+func (g *boundedGroup) Wait() error {
+	g.wg.Wait()
+	return combineErrors(g.errs)
+}
+
+func combineErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return combinedErrors(append([]error{}, errs...))
+}
+
+// combinedErrors is several errors as one, see combineErrors.
+type combinedErrors []error
+
+func (errs combinedErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("%d errors: %s", len(errs), strings.Join(messages, "; "))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// disruptionBudgets are the PodDisruptionBudgets in the namespace that
+// allow no disruptions right now, which something other than the operator
+// may have made. A running dotmesh pod they select isn't deleted until they
+// allow it again, even if CLUSTER_MINIMUM_RATIO would.
+type disruptionBudgets map[string]labels.Selector // by name
+
+func (c *dotmeshController) exhaustedDisruptionBudgets() (disruptionBudgets, error) {
+	pdbs, err := c.client.PolicyV1beta1().PodDisruptionBudgets(c.namespace).List(meta_v1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Error listing pod disruption budgets: %+v", err)
+	}
+	budgets := disruptionBudgets{}
+	for _, pdb := range pdbs.Items {
+		if pdb.Status.PodDisruptionsAllowed > 0 {
+			continue
+		}
+		selector, err := meta_v1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil {
+			c.log.Warnf("Ignoring pod disruption budget %s, as its selector is invalid: %+v", pdb.ObjectMeta.Name, err)
+			continue
+		}
+		budgets[pdb.ObjectMeta.Name] = selector
+	}
+	return budgets, nil
+}
+
+// blocking returns the name of a budget that stops a pod with podLabels
+// being deleted, or "" if there isn't one.
+func (b disruptionBudgets) blocking(podLabels map[string]string) string {
+	for name, selector := range b {
+		if selector.Matches(labels.Set(podLabels)) {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	rbac_v1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Dotmesh server pods run as the dotmesh ServiceAccount, which needs to be
+// able to read nodes and namespaces, and read and write pods in its own
+// namespace. When the operator starts, bootstrap creates the ServiceAccount
+// and the roles and bindings giving it that, unless --skip-rbac-setup is
+// given, for clusters whose RBAC is managed some other way. Existing
+// objects are left as they are, so they can be customised with
+// additional rules.
+//
+// The read-only ClusterRole is namespacedName(DOTMESH_SERVICE_ACCOUNT),
+// like the other cluster-wide objects; a namespace-scoped operator can't
+// create it, so it only makes the Role, which lets the servers read pods
+// but not nodes.
+
+const DOTMESH_SERVICE_ACCOUNT = "dotmesh"
+
+// The rules of the dotmesh ClusterRole, which is bound cluster-wide
+var dotmeshClusterRules = []rbac_v1.PolicyRule{
+	{
+		APIGroups: []string{""},
+		Resources: []string{"pods", "namespaces", "nodes"},
+		Verbs:     []string{"get", "list", "watch"},
+	},
+}
+
+// The rules of the dotmesh Role, in the controller's namespace
+var dotmeshNamespaceRules = []rbac_v1.PolicyRule{
+	{
+		APIGroups: []string{""},
+		Resources: []string{"pods"},
+		Verbs:     []string{"get", "list", "watch", "create", "update", "patch", "delete"},
+	},
+}
+
+// bootstrap creates whatever the dotmesh server pods need to exist before
+// any are created: the ServiceAccount they run as, and its permissions.
+func (c *dotmeshController) bootstrap() error {
+	if c.skipRBACSetup {
+		c.logV(1).Infof("Not setting up RBAC for service account %s, as --skip-rbac-setup was given", DOTMESH_SERVICE_ACCOUNT)
+		return nil
+	}
+
+	err := c.ensureServiceAccount()
+	if err != nil {
+		return err
+	}
+	subjects := []rbac_v1.Subject{{
+		Kind:      rbac_v1.ServiceAccountKind,
+		Name:      DOTMESH_SERVICE_ACCOUNT,
+		Namespace: c.namespace,
+	}}
+
+	rbac := c.client.RbacV1()
+	role := &rbac_v1.Role{
+		ObjectMeta: meta_v1.ObjectMeta{Name: DOTMESH_SERVICE_ACCOUNT, Namespace: c.namespace},
+		Rules:      dotmeshNamespaceRules,
+	}
+	_, err = rbac.Roles(c.namespace).Create(role)
+	err = c.createdOrExists(err, "role", role.Name)
+	if err != nil {
+		return err
+	}
+	roleBinding := &rbac_v1.RoleBinding{
+		ObjectMeta: meta_v1.ObjectMeta{Name: DOTMESH_SERVICE_ACCOUNT, Namespace: c.namespace},
+		RoleRef:    rbac_v1.RoleRef{APIGroup: rbac_v1.GroupName, Kind: "Role", Name: role.Name},
+		Subjects:   subjects,
+	}
+	_, err = rbac.RoleBindings(c.namespace).Create(roleBinding)
+	err = c.createdOrExists(err, "role binding", roleBinding.Name)
+	if err != nil {
+		return err
+	}
+
+	if !c.clusterScoped {
+		return nil
+	}
+	clusterRole := &rbac_v1.ClusterRole{
+		ObjectMeta: meta_v1.ObjectMeta{Name: c.namespacedName(DOTMESH_SERVICE_ACCOUNT)},
+		Rules:      dotmeshClusterRules,
+	}
+	_, err = rbac.ClusterRoles().Create(clusterRole)
+	err = c.createdOrExists(err, "cluster role", clusterRole.Name)
+	if err != nil {
+		return err
+	}
+	clusterRoleBinding := &rbac_v1.ClusterRoleBinding{
+		ObjectMeta: meta_v1.ObjectMeta{Name: c.namespacedName(DOTMESH_SERVICE_ACCOUNT)},
+		RoleRef:    rbac_v1.RoleRef{APIGroup: rbac_v1.GroupName, Kind: "ClusterRole", Name: clusterRole.Name},
+		Subjects:   subjects,
+	}
+	_, err = rbac.ClusterRoleBindings().Create(clusterRoleBinding)
+	return c.createdOrExists(err, "cluster role binding", clusterRoleBinding.Name)
+}
+
+func (c *dotmeshController) ensureServiceAccount() error {
+	_, err := c.client.Core().ServiceAccounts(c.namespace).Create(&v1.ServiceAccount{
+		ObjectMeta: meta_v1.ObjectMeta{Name: DOTMESH_SERVICE_ACCOUNT, Namespace: c.namespace},
+	})
+	return c.createdOrExists(err, "service account", DOTMESH_SERVICE_ACCOUNT)
+}
+
+// createdOrExists turns err, from creating the kind of object called name,
+// into nil if the object was created or already existed.
+func (c *dotmeshController) createdOrExists(err error, kind, name string) error {
+	if errors.IsAlreadyExists(err) {
+		c.logV(2).Infof("Not creating %s %s, which already exists", kind, name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Error creating %s %s: %+v", kind, name, err)
+	}
+	c.log.Infof("Created %s %s", kind, name)
+	return nil
+}
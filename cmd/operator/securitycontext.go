@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// Dotmesh pods run privileged by default. Clusters whose admission control
+// won't allow that can set pod.privileged to "false", and the containers are
+// given just the capabilities dotmesh needs instead: mounting filesystems
+// and running zfs (SYS_ADMIN), setting up its networking (NET_ADMIN) and
+// loading the zfs kernel module (SYS_MODULE). pod.seccompProfile, if set,
+// is the seccomp profile the pods are annotated with.
+
+const SECCOMP_PROFILE_RUNTIME_DEFAULT = "runtime/default"
+const SECCOMP_PROFILE_UNCONFINED = "unconfined"
+
+var unprivilegedCapabilities = []v1.Capability{"SYS_ADMIN", "NET_ADMIN", "SYS_MODULE"}
+
+// podSecurity is how dotmesh pods are secured, from the ConfigMap.
+type podSecurity struct {
+	privileged     bool
+	seccompProfile string
+}
+
+func parsePodSecurity(privileged, seccompProfile string) (*podSecurity, error) {
+	security := &podSecurity{seccompProfile: seccompProfile}
+	switch privileged {
+	case "true":
+		security.privileged = true
+	case "false":
+	default:
+		return nil, fmt.Errorf("Invalid %s in the ConfigMap: %q, it must be true or false", CONFIG_POD_PRIVILEGED, privileged)
+	}
+	switch seccompProfile {
+	case "", SECCOMP_PROFILE_RUNTIME_DEFAULT, SECCOMP_PROFILE_UNCONFINED:
+	default:
+		return nil, fmt.Errorf("Invalid %s in the ConfigMap: %q, it must be %s, %s, or empty", CONFIG_POD_SECCOMP_PROFILE, seccompProfile,
+			SECCOMP_PROFILE_RUNTIME_DEFAULT, SECCOMP_PROFILE_UNCONFINED)
+	}
+	return security, nil
+}
+
+// containerSecurityContext is the SecurityContext for every container of a
+// dotmesh pod.
+func (s *podSecurity) containerSecurityContext() *v1.SecurityContext {
+	privileged := s.privileged
+	securityContext := &v1.SecurityContext{
+		Privileged: &privileged,
+	}
+	if !privileged {
+		securityContext.Capabilities = &v1.Capabilities{
+			Add: append([]v1.Capability{}, unprivilegedCapabilities...),
+		}
+	}
+	return securityContext
+}
+
+// annotate adds the seccomp profile, if there is one, to a dotmesh pod's
+// annotations.
+func (s *podSecurity) annotate(annotations map[string]string) {
+	if s.seccompProfile != "" {
+		annotations[v1.SeccompPodAnnotationKey] = s.seccompProfile
+	}
+}
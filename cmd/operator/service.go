@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// The headless dotmesh-servers Service gives each dotmesh server pod a
+// stable DNS name, dotmesh-<node>.dotmesh-servers.<namespace>.svc.cluster.local,
+// for the servers to find each other by while replicating, however often
+// the pods' IPs change.
+const DOTMESH_SERVERS_SERVICE = "dotmesh-servers"
+
+// serverPodHostname is the hostname a server pod on node is given under the
+// dotmesh-servers Service, or "" if that wouldn't be a valid DNS label (so
+// the pod has no DNS name of its own).
+func serverPodHostname(node string) string {
+	hostname := "dotmesh-" + node
+	if len(validation.IsDNS1123Label(hostname)) > 0 {
+		return ""
+	}
+	return hostname
+}
+
+func (c *dotmeshController) dotmeshServersServiceSpec() v1.ServiceSpec {
+	return v1.ServiceSpec{
+		ClusterIP: v1.ClusterIPNone,
+		Selector:  map[string]string{DOTMESH_ROLE_LABEL: c.serverRole()},
+		Ports: []v1.ServicePort{
+			{
+				Name:       "dotmesh-api",
+				Port:       DOTMESH_API_PORT,
+				TargetPort: intstr.FromInt(DOTMESH_API_PORT),
+				Protocol:   v1.ProtocolTCP,
+			},
+		},
+		// Servers must be able to resolve each other while they're still
+		// starting up
+		PublishNotReadyAddresses: true,
+	}
+}
+
+// ensureServersService creates the dotmesh-servers Service, or fixes it up
+// if it's been changed. Its spec doesn't depend on the ConfigMap, so this is
+// only done once, when the operator starts.
+func (c *dotmeshController) ensureServersService() error {
+	spec := c.dotmeshServersServiceSpec()
+	services := c.client.Core().Services(c.namespace)
+
+	existing, err := services.Get(DOTMESH_SERVERS_SERVICE, meta_v1.GetOptions{})
+	if err == nil && existing.Spec.ClusterIP != v1.ClusterIPNone {
+		// A Service's clusterIP can't be changed, so it has to be remade
+		c.log.Infof("Deleting service %s, which isn't headless", DOTMESH_SERVERS_SERVICE)
+		err = services.Delete(DOTMESH_SERVERS_SERVICE, &meta_v1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("Error deleting service %s: %+v", DOTMESH_SERVERS_SERVICE, err)
+		}
+		existing = nil
+	} else if errors.IsNotFound(err) {
+		existing = nil
+	} else if err != nil {
+		return fmt.Errorf("Error getting service %s: %+v", DOTMESH_SERVERS_SERVICE, err)
+	}
+
+	if existing == nil {
+		c.log.Infof("Creating service %s", DOTMESH_SERVERS_SERVICE)
+		_, err = services.Create(&v1.Service{
+			ObjectMeta: meta_v1.ObjectMeta{
+				Name:      DOTMESH_SERVERS_SERVICE,
+				Namespace: c.namespace,
+			},
+			Spec: spec,
+		})
+	} else if !reflect.DeepEqual(existing.Spec.Selector, spec.Selector) ||
+		!reflect.DeepEqual(existing.Spec.Ports, spec.Ports) ||
+		existing.Spec.PublishNotReadyAddresses != spec.PublishNotReadyAddresses {
+		c.log.Infof("Updating service %s", DOTMESH_SERVERS_SERVICE)
+		updated := existing.DeepCopy()
+		updated.Spec.Selector = spec.Selector
+		updated.Spec.Ports = spec.Ports
+		updated.Spec.PublishNotReadyAddresses = spec.PublishNotReadyAddresses
+		_, err = services.Update(updated)
+	}
+	if err != nil {
+		return fmt.Errorf("Error ensuring service %s: %+v", DOTMESH_SERVERS_SERVICE, err)
+	}
+	return nil
+}
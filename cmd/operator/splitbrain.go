@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Each dotmesh server reports the filesystems it's acting as the master for
+// on its liveness port's /status. If two of them think they're the master
+// for the same filesystem, both will take writes to it and their copies will
+// diverge, so process() asks every running pod, and when it finds a
+// filesystem claimed more than once logs an error, counts it in
+// dotmesh_split_brain_detected, and puts a SplitBrainDetected event on each
+// pod claiming it. Nothing is done to resolve it: which copy to keep is for a
+// human to decide.
+
+const SPLIT_BRAIN_EVENT_REASON = "SplitBrainDetected"
+
+// how long a pod has to say what it's the master for
+const SPLIT_BRAIN_STATUS_TIMEOUT = 5 * time.Second
+
+// dotmeshNodeStatus is what a dotmesh server's /status says, see
+// cmd/dotmesh-server/liveness.go.
+type dotmeshNodeStatus struct {
+	NodeID            string
+	MasterFilesystems []string
+}
+
+var splitBrainStatusClient = &http.Client{Timeout: SPLIT_BRAIN_STATUS_TIMEOUT}
+
+// podMasterFilesystems asks pod which filesystems it's the master for.
+func podMasterFilesystems(pod *v1.Pod) ([]string, error) {
+	resp, err := splitBrainStatusClient.Get(fmt.Sprintf("http://%s:%d/status", pod.Status.PodIP, DOTMESH_LIVENESS_PORT))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("/status returned %s", resp.Status)
+	}
+	var status dotmeshNodeStatus
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	if err != nil {
+		return nil, err
+	}
+	return status.MasterFilesystems, nil
+}
+
+// splitBrainFilesystems picks the filesystems claimed by more than one pod
+// out of claims, a map from pod name to the filesystems it's the master for,
+// and returns them mapped to the names of the pods claiming them, sorted.
+func splitBrainFilesystems(claims map[string][]string) map[string][]string {
+	claimants := map[string][]string{}
+	for podName, filesystemIds := range claims {
+		for _, filesystemId := range filesystemIds {
+			claimants[filesystemId] = append(claimants[filesystemId], podName)
+		}
+	}
+	split := map[string][]string{}
+	for filesystemId, podNames := range claimants {
+		if len(podNames) > 1 {
+			sort.Strings(podNames)
+			split[filesystemId] = podNames
+		}
+	}
+	return split
+}
+
+// detectSplitBrain returns the ids, sorted, of the filesystems that more
+// than one of the running dotmeshes claims to be the master for, raising the
+// alarm about each one it hadn't already found last time. Pods that can't be
+// asked are only logged about, as they can't be told apart from ones still
+// starting up.
+func (c *dotmeshController) detectSplitBrain(dotmeshes []*v1.Pod) []string {
+	podsByName := map[string]*v1.Pod{}
+	claims := map[string][]string{}
+	var claimsLock sync.Mutex
+	queries := newBoundedGroup(len(dotmeshes))
+	for _, dotmesh := range dotmeshes {
+		pod := dotmesh
+		if pod.Status.Phase != v1.PodRunning || pod.Status.PodIP == "" {
+			continue
+		}
+		podsByName[pod.ObjectMeta.Name] = pod
+		queries.Go(func() error {
+			filesystemIds, err := podMasterFilesystems(pod)
+			if err != nil {
+				return fmt.Errorf("Error asking pod %s which filesystems it's the master for: %+v", pod.ObjectMeta.Name, err)
+			}
+			claimsLock.Lock()
+			defer claimsLock.Unlock()
+			claims[pod.ObjectMeta.Name] = filesystemIds
+			return nil
+		})
+	}
+	err := queries.Wait()
+	if err != nil {
+		c.logFor(LOG_COMPONENT_PROCESS).V(1).Infof("Can't check every pod for split-brain: %+v", err)
+	}
+
+	split := splitBrainFilesystems(claims)
+	filesystemIds := make([]string, 0, len(split))
+	for filesystemId := range split {
+		filesystemIds = append(filesystemIds, filesystemId)
+	}
+	sort.Strings(filesystemIds)
+
+	newlySplit := c.reconcileMetrics.countSplitBrain(split)
+	for _, filesystemId := range filesystemIds {
+		podNames := split[filesystemId]
+		message := fmt.Sprintf("Split-brain: pods %s all think they are the master for filesystem %s; writes to it may be lost, and one of them needs stopping by hand",
+			strings.Join(podNames, ", "), filesystemId)
+		c.log.Error(message)
+		if _, ok := newlySplit[filesystemId]; !ok {
+			continue
+		}
+		for _, podName := range podNames {
+			c.recordSplitBrainEvent(podsByName[podName], message)
+		}
+	}
+	return filesystemIds
+}
+
+// recordSplitBrainEvent puts a SplitBrainDetected warning event on pod.
+// Failing to is only logged, as the error's been logged anyway.
+func (c *dotmeshController) recordSplitBrainEvent(pod *v1.Pod, message string) {
+	now := meta_v1.Now()
+	_, err := c.client.Core().Events(c.namespace).Create(&v1.Event{
+		ObjectMeta: meta_v1.ObjectMeta{
+			GenerateName: pod.ObjectMeta.Name + ".",
+			Namespace:    c.namespace,
+		},
+		InvolvedObject: v1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "Pod",
+			Namespace:  pod.ObjectMeta.Namespace,
+			Name:       pod.ObjectMeta.Name,
+			UID:        pod.ObjectMeta.UID,
+		},
+		Reason:         SPLIT_BRAIN_EVENT_REASON,
+		Message:        message,
+		Type:           v1.EventTypeWarning,
+		Source:         v1.EventSource{Component: DOTMESH_OPERATOR_APP},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	})
+	if err != nil {
+		c.log.Errorf("Error recording %s event on pod %s: %+v", SPLIT_BRAIN_EVENT_REASON, pod.ObjectMeta.Name, err)
+	}
+}
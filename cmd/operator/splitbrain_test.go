@@ -0,0 +1,33 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitBrainFilesystems(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		claims   map[string][]string
+		expected map[string][]string
+	}{
+		{name: "no pods", claims: map[string][]string{}, expected: map[string][]string{}},
+		{name: "one master each", claims: map[string][]string{
+			"dotmesh-a": {"fs1", "fs2"},
+			"dotmesh-b": {"fs3"},
+		}, expected: map[string][]string{}},
+		{name: "two masters", claims: map[string][]string{
+			"dotmesh-c": {"fs1"},
+			"dotmesh-a": {"fs1", "fs2"},
+			"dotmesh-b": {"fs2", "fs1", "fs3"},
+		}, expected: map[string][]string{
+			"fs1": {"dotmesh-a", "dotmesh-b", "dotmesh-c"},
+			"fs2": {"dotmesh-a", "dotmesh-b"},
+		}},
+	} {
+		split := splitBrainFilesystems(c.claims)
+		if !reflect.DeepEqual(split, c.expected) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.expected, split)
+		}
+	}
+}
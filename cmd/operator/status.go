@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The operator writes a summary of what process() last saw to this
+// ConfigMap, so that the cluster's health can be checked with kubectl
+// without reading the operator's logs.
+const DOTMESH_STATUS_CONFIG_MAP = "dotmesh-operator-status"
+
+// writeStatus writes summary to the status ConfigMap, creating it if it
+// doesn't exist. It's called once per process(), and failing to write it
+// is only logged, as it doesn't affect the cluster.
+func (c *dotmeshController) writeStatus(summary ProcessSummary) {
+	statusMap := &v1.ConfigMap{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      DOTMESH_STATUS_CONFIG_MAP,
+			Namespace: c.namespace,
+		},
+		Data: map[string]string{
+			"lastReconcileTime": time.Now().UTC().Format(time.RFC3339),
+			"nodesTotal":        strconv.Itoa(summary.NodesTotal),
+			"nodesHealthy":      strconv.Itoa(summary.NodesDotted),
+			"podsRunning":       strconv.Itoa(summary.PodsRunning),
+			"podsPending":       strconv.Itoa(summary.PodsPending),
+			"podsFailed":        strconv.Itoa(summary.PodsFailed),
+			"clusterMinimum":    strconv.Itoa(summary.ClusterMinimum),
+			"operatorVersion":   DOTMESH_VERSION,
+		},
+	}
+
+	configMaps := c.client.Core().ConfigMaps(c.namespace)
+	_, err := configMaps.Create(statusMap)
+	if errors.IsAlreadyExists(err) {
+		_, err = configMaps.Update(statusMap)
+	}
+	if err != nil {
+		c.log.Errorf("Error writing status to %s/%s: %+v", c.namespace, DOTMESH_STATUS_CONFIG_MAP, err)
+	}
+}
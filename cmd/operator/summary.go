@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// process() returns a ProcessSummary of what it saw and did, which runWorker
+// updates the metrics and the status ConfigMap from, and keeps for
+// /debug/last-process-summary on the metrics server: the quickest way to
+// see what the operator thinks of the cluster, and why it last did what it
+// did.
+
+type ProcessSummary struct {
+	Started  time.Time
+	Duration time.Duration
+	// Analysed is whether process() got as far as looking at the nodes and
+	// pods; if not, the counts are all zero, and Errors says why
+	Analysed bool
+
+	NodesTotal     int
+	NodesDotted    int // nodes with a healthy-looking dotmesh pod
+	NodesUndotted  int
+	NodesSuspended int // undotted nodes waiting for their old pod to go
+	NodesReplacing int // nodes whose outdated pod is being replaced
+	ClusterMinimum int // running pods deletions mustn't take the cluster below
+	// nodes under each NODE_PRESSURE_*, see nodepressure.go
+	NodesUnderPressure map[string]int
+
+	PodsRunning int
+	PodsPending int
+	PodsFailed  int
+	PodsToKill  int // pods that needed deleting, some of which may have been spared
+	PodsKilled  int
+	PodsCreated int
+	// pods that look like dotmesh pods, but aren't labelled as the operator
+	// expects, see orphans.go
+	PodsOrphaned int
+	// ids of the filesystems more than one pod thinks it's the master for,
+	// see splitbrain.go
+	SplitBrainFilesystems []string
+
+	Errors []string
+}
+
+// recordSummary updates the metrics and the status ConfigMap from summary,
+// if process() got far enough to have counted anything, and keeps it for
+// /debug/last-process-summary.
+func (c *dotmeshController) recordSummary(summary ProcessSummary) {
+	c.lastSummaryLock.Lock()
+	c.lastSummary = &summary
+	c.lastSummaryLock.Unlock()
+
+	if !summary.Analysed {
+		return
+	}
+	c.nodesGauge.WithLabelValues().Set(float64(summary.NodesTotal))
+	c.dottedNodesGauge.WithLabelValues().Set(float64(summary.NodesDotted))
+	c.undottedNodesGauge.WithLabelValues().Set(float64(summary.NodesUndotted))
+	c.runningPodsGauge.WithLabelValues().Set(float64(summary.PodsRunning))
+	c.dotmeshesToKillGauge.WithLabelValues().Set(float64(summary.PodsToKill))
+	c.suspendedNodesGauge.WithLabelValues().Set(float64(summary.NodesSuspended))
+	c.replacingNodesGauge.WithLabelValues().Set(float64(summary.NodesReplacing))
+	c.targetMinPodsGauge.WithLabelValues().Set(float64(summary.ClusterMinimum))
+	for pressure, count := range summary.NodesUnderPressure {
+		c.pressureNodesGauge.WithLabelValues(pressure).Set(float64(count))
+	}
+	c.writeStatus(summary)
+}
+
+// lastProcessSummary is the summary from the most recent process(), or nil
+// if there hasn't been one yet.
+func (c *dotmeshController) lastProcessSummary() *ProcessSummary {
+	c.lastSummaryLock.Lock()
+	defer c.lastSummaryLock.Unlock()
+	return c.lastSummary
+}
+
+// serveLastProcessSummary serves the latest ProcessSummary of the
+// controller for the namespace in the query string, which can be left out
+// when there's only one.
+func serveLastProcessSummary(controllers []*dotmeshController) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		namespace := r.URL.Query().Get("namespace")
+		var controller *dotmeshController
+		if namespace == "" && len(controllers) == 1 {
+			controller = controllers[0]
+		}
+		namespaces := []string{}
+		for _, c := range controllers {
+			if c.namespace == namespace {
+				controller = c
+			}
+			namespaces = append(namespaces, c.namespace)
+		}
+		if controller == nil {
+			sort.Strings(namespaces)
+			http.Error(w, fmt.Sprintf("Please give ?namespace= one of: %s", strings.Join(namespaces, ", ")), http.StatusNotFound)
+			return
+		}
+
+		summary := controller.lastProcessSummary()
+		if summary == nil {
+			http.Error(w, "The operator hasn't reconciled yet", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(summary)
+	}
+}
+
+// errorMessages lists the errors process() returned, separately even when
+// they were combined by combineErrors.
+func errorMessages(err error) []string {
+	switch e := err.(type) {
+	case nil:
+		return []string{}
+	case partialFailure:
+		return errorMessages(e.error)
+	case combinedErrors:
+		messages := []string{}
+		for _, err := range e {
+			messages = append(messages, errorMessages(err)...)
+		}
+		return messages
+	}
+	return []string{err.Error()}
+}
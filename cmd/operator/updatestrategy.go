@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// pod.updateStrategy says how a dotmesh server pod running the wrong image
+// is replaced:
+//
+// deleteFirst (the default) deletes the old pod, and creates the new one
+// once it's gone, so the node has no dotmesh server for a while.
+//
+// createFirst creates the new pod alongside the old one, in the node's other
+// "slot" (a pod name, and inner server container name, ending in
+// SERVER_POD_SECOND_SLOT_SUFFIX, or not), and only deletes the old pod once
+// the new one is Ready. The node needs room for both pods in the meantime.
+// The two don't clash: each inner server has its own container name and runs
+// in its own pod's network, rather than on the host's ports, and the new one
+// takes over the docker plugin socket as it starts. They do share the node's
+// pool until the old one goes. A pvcPerNode pool's PVC can only be used by
+// one pod, and a boltdb store (DOTMESH_STORAGE=boltdb, in pod.extraEnv) can
+// only be opened by one server, so deleteFirst is used for those regardless.
+//
+// sidecar, handing the data over to the new server from a sidecar in the old
+// pod, isn't implemented yet; deleteFirst is used instead.
+
+const POD_UPDATE_STRATEGY_DELETE_FIRST = "deleteFirst"
+const POD_UPDATE_STRATEGY_CREATE_FIRST = "createFirst"
+const POD_UPDATE_STRATEGY_SIDECAR = "sidecar"
+
+const SERVER_POD_SECOND_SLOT_SUFFIX = "-b"
+
+// podUpdateStrategy is the pod.updateStrategy to use, or an error if it's
+// not one of the strategies above.
+func (c *dotmeshController) podUpdateStrategy() (string, error) {
+	strategy := c.config.Data[CONFIG_POD_UPDATE_STRATEGY]
+	switch strategy {
+	case POD_UPDATE_STRATEGY_DELETE_FIRST:
+		return strategy, nil
+	case POD_UPDATE_STRATEGY_CREATE_FIRST:
+		if c.config.Data[CONFIG_MODE] == CONFIG_MODE_PPN {
+			c.logFor(LOG_COMPONENT_PROCESS).V(1).Infof("Using %s %s, as %s can't be used in %s mode", CONFIG_POD_UPDATE_STRATEGY, POD_UPDATE_STRATEGY_DELETE_FIRST, strategy, CONFIG_MODE_PPN)
+			return POD_UPDATE_STRATEGY_DELETE_FIRST, nil
+		}
+		for _, env := range c.extraEnv {
+			// see types.EnvStorageBackend
+			if env.Name == "DOTMESH_STORAGE" && env.Value == "boltdb" {
+				c.logFor(LOG_COMPONENT_PROCESS).V(1).Infof("Using %s %s, as %s can't be used with a boltdb store", CONFIG_POD_UPDATE_STRATEGY, POD_UPDATE_STRATEGY_DELETE_FIRST, strategy)
+				return POD_UPDATE_STRATEGY_DELETE_FIRST, nil
+			}
+		}
+		return strategy, nil
+	case POD_UPDATE_STRATEGY_SIDECAR:
+		c.log.Warnf("%s %s isn't supported yet, using %s", CONFIG_POD_UPDATE_STRATEGY, strategy, POD_UPDATE_STRATEGY_DELETE_FIRST)
+		return POD_UPDATE_STRATEGY_DELETE_FIRST, nil
+	}
+	return "", fmt.Errorf("Invalid %s in the ConfigMap: %q, it must be %s, %s or %s", CONFIG_POD_UPDATE_STRATEGY, strategy,
+		POD_UPDATE_STRATEGY_DELETE_FIRST, POD_UPDATE_STRATEGY_CREATE_FIRST, POD_UPDATE_STRATEGY_SIDECAR)
+}
+
+// podReady is whether pod is passing its readiness probe.
+func podReady(pod *v1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == v1.PodReady {
+			return cond.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// serverPodSlot is the suffix for the name of a new server pod on node, and
+// its inner server container: the second slot's if oldPod, the pod it's
+// replacing, is in the first, and the first's otherwise.
+func serverPodSlot(node string, oldPod string) string {
+	if oldPod != "" && oldPod == fmt.Sprintf("server-%s", node) {
+		return SERVER_POD_SECOND_SLOT_SUFFIX
+	}
+	return ""
+}
+
+// replaceOutdatedPods decides what happens to each createFirst node's old
+// pod (in outdatedPods, by node) this time round: while the node's undotted,
+// the old pod's left running while its replacement is created; once the
+// replacement is Ready, the old pod's marked for death. It returns the nodes
+// that have, or are about to have, two pods.
+func (c *dotmeshController) replaceOutdatedPods(outdatedPods map[string]string, undottedNodes map[string]struct{},
+	currentPodReady map[string]bool, dotmeshesToKill map[string]struct{}) map[string]struct{} {
+	replacingNodes := map[string]struct{}{}
+	for node, oldPod := range outdatedPods {
+		if _, undotted := undottedNodes[node]; undotted {
+			c.log.Infof("Creating a replacement for pod %s on node %s before deleting it", oldPod, node)
+		} else if currentPodReady[node] {
+			c.log.Infof("Replacement for pod %s on node %s is ready, deleting the old pod", oldPod, node)
+			dotmeshesToKill[oldPod] = struct{}{}
+		} else {
+			c.logFor(LOG_COMPONENT_PROCESS).V(2).Infof("Waiting for the replacement for pod %s on node %s to be ready", oldPod, node)
+		}
+		replacingNodes[node] = struct{}{}
+	}
+	return replacingNodes
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	admissionregistration "k8s.io/api/admissionregistration/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The validating admission webhook checks dotmesh server pods before
+// Kubernetes admits them, so that a misconfigured pod is rejected when it's
+// created rather than found and killed by process() afterwards. It's
+// optional, as the API server will only call it over TLS: it's enabled by
+// giving the operator -webhook-addr, a certificate and key for it, and the
+// CA bundle that signed them.
+
+// ValidatingWebhookConfigurations aren't namespaced, so outside
+// DOTMESH_NAMESPACE the configuration's name is suffixed with the namespace
+// by namespacedName, giving each namespace's operator its own.
+const WEBHOOK_CONFIGURATION_NAME = "dotmesh-pod-validation"
+const WEBHOOK_NAME = "pods.validation.dotmesh.io"
+const WEBHOOK_PATH = "/validate-pod"
+
+// The volumes every dotmesh server pod needs, whatever the storage mode;
+// these are the ones createDotmeshPods sets up.
+var requiredServerVolumes = []string{
+	"docker-sock",
+	"run-docker",
+	"var-lib",
+	"system-lib",
+	"dotmesh-kernel-modules",
+	"dotmesh-secret",
+	"test-pools-dir",
+}
+
+type webhookConfig struct {
+	address  string
+	certFile string
+	keyFile  string
+	caFile   string
+	service  string // the Service in the controller's namespace that reaches address
+}
+
+// admissionReview is the part of the admission.k8s.io/v1beta1 AdmissionReview
+// the webhook uses; that API group isn't vendored, and only these fields of
+// it are needed.
+type admissionReview struct {
+	meta_v1.TypeMeta `json:",inline"`
+	Request          *admissionRequest  `json:"request,omitempty"`
+	Response         *admissionResponse `json:"response,omitempty"`
+}
+
+type admissionRequest struct {
+	UID       string          `json:"uid"`
+	Namespace string          `json:"namespace,omitempty"`
+	Object    json.RawMessage `json:"object,omitempty"`
+}
+
+type admissionResponse struct {
+	UID     string          `json:"uid"`
+	Allowed bool            `json:"allowed"`
+	Result  *meta_v1.Status `json:"status,omitempty"`
+}
+
+// startWebhook registers the webhook with the API server and starts serving
+// it in the background.
+func (c *dotmeshController) startWebhook(config webhookConfig) error {
+	caBundle, err := ioutil.ReadFile(config.caFile)
+	if err != nil {
+		return fmt.Errorf("Error reading webhook CA bundle %s: %+v", config.caFile, err)
+	}
+	err = c.registerWebhook(config.service, caBundle)
+	if err != nil {
+		return err
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc(WEBHOOK_PATH, c.serveValidatePod)
+	go func() {
+		err := http.ListenAndServeTLS(config.address, config.certFile, config.keyFile, router)
+		c.log.Fatal(err)
+	}()
+	c.log.Infof("Serving pod validation webhook on %s", config.address)
+	return nil
+}
+
+// registerWebhook creates the ValidatingWebhookConfiguration that sends
+// pod creations to the webhook, or updates it if it already exists.
+func (c *dotmeshController) registerWebhook(service string, caBundle []byte) error {
+	path := WEBHOOK_PATH
+	failurePolicy := admissionregistration.Ignore // don't stop pods being created when the operator is down
+	webhooks := []admissionregistration.Webhook{
+		{
+			Name: WEBHOOK_NAME,
+			ClientConfig: admissionregistration.WebhookClientConfig{
+				Service: &admissionregistration.ServiceReference{
+					Namespace: c.namespace,
+					Name:      service,
+					Path:      &path,
+				},
+				CABundle: caBundle,
+			},
+			Rules: []admissionregistration.RuleWithOperations{
+				{
+					Operations: []admissionregistration.OperationType{admissionregistration.Create},
+					Rule: admissionregistration.Rule{
+						APIGroups:   []string{""},
+						APIVersions: []string{"v1"},
+						Resources:   []string{"pods"},
+					},
+				},
+			},
+			FailurePolicy: &failurePolicy,
+		},
+	}
+
+	configurations := c.client.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations()
+	name := c.namespacedName(WEBHOOK_CONFIGURATION_NAME)
+	existing, err := configurations.Get(name, meta_v1.GetOptions{})
+	if errors.IsNotFound(err) {
+		c.log.Infof("Creating %s webhook configuration", name)
+		_, err = configurations.Create(&admissionregistration.ValidatingWebhookConfiguration{
+			ObjectMeta: meta_v1.ObjectMeta{Name: name},
+			Webhooks:   webhooks,
+		})
+	} else if err == nil {
+		c.log.Infof("Updating %s webhook configuration", name)
+		updated := existing.DeepCopy()
+		updated.Webhooks = webhooks
+		_, err = configurations.Update(updated)
+	}
+	if err != nil {
+		return fmt.Errorf("Error registering webhook configuration %s: %+v", name, err)
+	}
+	return nil
+}
+
+func (c *dotmeshController) serveValidatePod(resp http.ResponseWriter, req *http.Request) {
+	var review admissionReview
+	err := json.NewDecoder(req.Body).Decode(&review)
+	if err != nil || review.Request == nil {
+		http.Error(resp, fmt.Sprintf("Error decoding AdmissionReview: %+v", err), http.StatusBadRequest)
+		return
+	}
+
+	response := &admissionResponse{
+		UID:     review.Request.UID,
+		Allowed: true,
+	}
+	var pod v1.Pod
+	err = json.Unmarshal(review.Request.Object, &pod)
+	if err != nil {
+		response.Allowed = false
+		response.Result = &meta_v1.Status{Message: fmt.Sprintf("Error decoding pod: %+v", err)}
+	} else {
+		namespace := review.Request.Namespace
+		if namespace == "" {
+			namespace = pod.ObjectMeta.Namespace
+		}
+		// Only dotmesh server pods are validated; the webhook sees every
+		// pod created in the cluster
+		if namespace == c.namespace && pod.ObjectMeta.Labels[DOTMESH_ROLE_LABEL] == c.serverRole() {
+			problems := c.validateServerPod(&pod)
+			if len(problems) > 0 {
+				c.log.Infof("Rejecting pod %s: %s", pod.ObjectMeta.Name, strings.Join(problems, "; "))
+				response.Allowed = false
+				response.Result = &meta_v1.Status{
+					Message: fmt.Sprintf("Invalid dotmesh server pod: %s", strings.Join(problems, "; ")),
+				}
+			}
+		}
+	}
+
+	review.Request = nil
+	review.Response = response
+	resp.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(resp).Encode(review)
+	if err != nil {
+		c.log.Errorf("Error writing AdmissionReview response: %+v", err)
+	}
+}
+
+// validateServerPod returns what's wrong with a dotmesh server pod, if
+// anything, checking the things process() would otherwise kill it for.
+func (c *dotmeshController) validateServerPod(pod *v1.Pod) []string {
+	// The expected image comes from the ConfigMap, which may be reloaded
+	// while this runs
+	c.configLock.RLock()
+	defer c.configLock.RUnlock()
+
+	problems := []string{}
+
+	if pod.Spec.NodeSelector[DOTMESH_NODE_LABEL] == "" {
+		problems = append(problems, fmt.Sprintf("it has no %s node selector", DOTMESH_NODE_LABEL))
+	}
+
+	if len(pod.Spec.Containers) != 1 {
+		problems = append(problems, fmt.Sprintf("it has %d containers, should be 1", len(pod.Spec.Containers)))
+	} else {
+		container := pod.Spec.Containers[0]
+		expectedImage := c.dotmeshImage(pod.ObjectMeta.Labels[DOTMESH_CANARY_LABEL] == "true")
+		if container.Image != expectedImage {
+			problems = append(problems, fmt.Sprintf("it runs image %s, should be %s", container.Image, expectedImage))
+		}
+		for _, env := range container.Env {
+			if env.Name == "DOTMESH_DOCKER_IMAGE" && env.Value != container.Image {
+				problems = append(problems, fmt.Sprintf("DOTMESH_DOCKER_IMAGE is %s, but it runs %s", env.Value, container.Image))
+			}
+		}
+	}
+
+	volumes := map[string]struct{}{}
+	for _, volume := range pod.Spec.Volumes {
+		volumes[volume.Name] = struct{}{}
+	}
+	for _, name := range requiredServerVolumes {
+		if _, ok := volumes[name]; !ok {
+			problems = append(problems, fmt.Sprintf("it has no %s volume", name))
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestWebhookConfigurationName(t *testing.T) {
+	for _, c := range []struct {
+		namespace string
+		expected  string
+	}{
+		{namespace: DOTMESH_NAMESPACE, expected: "dotmesh-pod-validation"},
+		{namespace: "team-a", expected: "dotmesh-pod-validation-team-a"},
+		{namespace: "team-b", expected: "dotmesh-pod-validation-team-b"},
+	} {
+		controller := &dotmeshController{namespace: c.namespace}
+		name := controller.namespacedName(WEBHOOK_CONFIGURATION_NAME)
+		if name != c.expected {
+			t.Errorf("namespace %s: expected webhook configuration %q, got %q", c.namespace, c.expected, name)
+		}
+	}
+}
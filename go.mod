@@ -21,7 +21,7 @@ require (
 	github.com/coreos/go-systemd v0.0.0-20180511133405-39ca1b05acc7 // indirect
 	github.com/coreos/pkg v0.0.0-20180108230652-97fdf19511ea // indirect
 	github.com/cyphar/filepath-securejoin v0.2.2
-	github.com/dgrijalva/jwt-go v3.2.0+incompatible // indirect
+	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/docker/distribution v2.6.2+incompatible // indirect
 	github.com/dotmesh-io/citools v0.0.0-20200414134058-7aa7221e95a0
 	github.com/dotmesh-io/go-checkpoint v0.0.0-20180205120253-edad9decbae8
@@ -35,7 +35,7 @@ require (
 	github.com/fatih/color v1.9.0 // indirect
 	github.com/frankban/quicktest v1.9.0 // indirect
 	github.com/fsouza/go-dockerclient v0.0.0-20160310013113-b87634a9d98e
-	github.com/ghodss/yaml v1.0.0 // indirect
+	github.com/ghodss/yaml v1.0.0
 	github.com/go-ini/ini v1.37.0 // indirect
 	github.com/go-openapi/analysis v0.0.0-20180629165206-ecce8cb68f3d // indirect
 	github.com/go-openapi/errors v0.0.0-20180515155515-b2b2befaf267 // indirect
@@ -99,7 +99,7 @@ require (
 	github.com/openzipkin/zipkin-go-opentracing v0.2.1
 	github.com/pborman/uuid v0.0.0-20170612153648-e790cca94e6c // indirect
 	github.com/petar/GoLLRB v0.0.0-20130427215148-53be0d36a84c // indirect
-	github.com/pierrec/lz4 v2.5.2+incompatible // indirect
+	github.com/pierrec/lz4 v2.5.2+incompatible
 	github.com/pkg/errors v0.8.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/portworx/kvdb v0.0.0-20200330200952-71ae616a5956
@@ -108,6 +108,7 @@ require (
 	github.com/prometheus/common v0.0.0-20180518154759-7600349dcfe1 // indirect
 	github.com/prometheus/procfs v0.0.0-20180629160828-40f013a808ec // indirect
 	github.com/rcrowley/go-metrics v0.0.0-20180503174638-e2704e165165 // indirect
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/rusenask/kvdb v0.0.0-20190516133219-ba4127d5b9cc // indirect
 	github.com/sean-/seed v0.0.0-20170313163322-e2103e2c3529 // indirect
 	github.com/sirupsen/logrus v1.4.2
@@ -122,6 +123,8 @@ require (
 	github.com/ulikunitz/xz v0.5.7 // indirect
 	github.com/xi2/xz v0.0.0-20171230120015-48954b6210f8 // indirect
 	github.com/xiang90/probing v0.0.0-20160813154853-07dd2e8dfe18 // indirect
+	go.opentelemetry.io/otel v0.20.0
+	go.opentelemetry.io/otel/trace v0.20.0
 	golang.org/x/crypto v0.0.0-20190308221718-c2843e01d9a2
 	golang.org/x/net v0.0.0-20190311183353-d8887717615a
 	golang.org/x/sys v0.0.0-20200223170610-d5e6a3e2c0ae
@@ -0,0 +1,175 @@
+package archiver
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A volume archive is a tar file holding a manifest followed by a ZFS send
+// stream. The stream's size isn't known until it's been sent, and tar headers
+// need one, so it's split into entries of at most VolumeStreamChunkSize bytes
+// which are concatenated again on import. A final entry records the total
+// size, so that an archive cut short between chunks isn't taken for a whole
+// one.
+const (
+	VolumeManifestName    = "dotmesh-volume.json"
+	volumeStreamPrefix    = "stream/"
+	volumeStreamEnd       = "stream.end"
+	VolumeStreamChunkSize = 16 * 1024 * 1024
+
+	// VolumeArchiveVersion is bumped for changes an older dotmesh couldn't
+	// import
+	VolumeArchiveVersion = 1
+)
+
+// VolumeManifest describes where a volume archive came from.
+type VolumeManifest struct {
+	Version      int
+	Namespace    string
+	Name         string
+	Branch       string
+	FilesystemId string
+	CommitId     string
+	ExportedAt   time.Time
+}
+
+// WriteVolumeArchive writes manifest and then everything read from stream to
+// w as a volume archive. If reading stream fails the archive is left without
+// its end entry, so that it can't be mistaken for a complete one.
+func WriteVolumeArchive(w io.Writer, manifest VolumeManifest, stream io.Reader) error {
+	manifest.Version = VolumeArchiveVersion
+	manifestBytes, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(w)
+	err = writeTarEntry(tw, VolumeManifestName, manifestBytes, manifest.ExportedAt)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, VolumeStreamChunkSize)
+	var total int64
+	for i := 0; ; i++ {
+		n, err := io.ReadFull(stream, buf)
+		total += int64(n)
+		if n > 0 {
+			writeErr := writeTarEntry(tw, fmt.Sprintf("%s%08d", volumeStreamPrefix, i), buf[:n], manifest.ExportedAt)
+			if writeErr != nil {
+				return writeErr
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Error reading ZFS stream: %s", err)
+		}
+	}
+	err = writeTarEntry(tw, volumeStreamEnd, []byte(strconv.FormatInt(total, 10)), manifest.ExportedAt)
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func writeTarEntry(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(data)
+	return err
+}
+
+// ReadVolumeArchive reads the manifest from a volume archive, and returns a
+// reader for the ZFS stream that follows it. Reading the stream returns an
+// error if the archive turns out to be truncated.
+func ReadVolumeArchive(r io.Reader) (*VolumeManifest, io.Reader, error) {
+	tr := tar.NewReader(r)
+	header, err := tr.Next()
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error reading volume archive: %s", err)
+	}
+	if header.Name != VolumeManifestName {
+		return nil, nil, fmt.Errorf("Not a dotmesh volume archive, it starts with %s rather than %s", header.Name, VolumeManifestName)
+	}
+	var manifest VolumeManifest
+	err = json.NewDecoder(tr).Decode(&manifest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error reading volume archive manifest: %s", err)
+	}
+	if manifest.Version > VolumeArchiveVersion {
+		return nil, nil, fmt.Errorf("Volume archive is version %d, this dotmesh only understands up to version %d", manifest.Version, VolumeArchiveVersion)
+	}
+	return &manifest, &volumeStreamReader{tr: tr}, nil
+}
+
+type volumeStreamReader struct {
+	tr      *tar.Reader
+	started bool
+	done    bool
+	read    int64
+}
+
+func (s *volumeStreamReader) Read(p []byte) (int, error) {
+	for {
+		if s.done {
+			return 0, io.EOF
+		}
+		if s.started {
+			n, err := s.tr.Read(p)
+			s.read += int64(n)
+			if err != io.EOF {
+				return n, err
+			}
+			if n > 0 {
+				return n, nil
+			}
+		}
+		// on to the next chunk
+		header, err := s.tr.Next()
+		if err == io.EOF {
+			return 0, fmt.Errorf("Volume archive is truncated, it ends after %d bytes of ZFS stream", s.read)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("Error reading volume archive: %s", err)
+		}
+		if header.Name == volumeStreamEnd {
+			return 0, s.end()
+		}
+		if !strings.HasPrefix(header.Name, volumeStreamPrefix) {
+			return 0, fmt.Errorf("Unexpected entry %s in volume archive", header.Name)
+		}
+		s.started = true
+	}
+}
+
+// end checks the size recorded at the end of the archive against what was
+// read.
+func (s *volumeStreamReader) end() error {
+	totalBytes, err := ioutil.ReadAll(s.tr)
+	if err != nil {
+		return fmt.Errorf("Error reading volume archive: %s", err)
+	}
+	total, err := strconv.ParseInt(string(totalBytes), 10, 64)
+	if err != nil {
+		return fmt.Errorf("Error reading volume archive: bad stream size %q", totalBytes)
+	}
+	if total != s.read {
+		return fmt.Errorf("Volume archive is corrupt, it should hold %d bytes of ZFS stream but has %d", total, s.read)
+	}
+	s.done = true
+	return io.EOF
+}
@@ -0,0 +1,83 @@
+package archiver
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestVolumeArchive(t *testing.T) {
+	// more than one chunk, and not a whole number of them
+	stream := make([]byte, VolumeStreamChunkSize*2+123)
+	rand.Read(stream)
+	manifest := VolumeManifest{
+		Namespace:    "admin",
+		Name:         "apples",
+		Branch:       "master",
+		FilesystemId: "fs",
+		CommitId:     "commit",
+		ExportedAt:   time.Now(),
+	}
+
+	var archive bytes.Buffer
+	err := WriteVolumeArchive(&archive, manifest, bytes.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, gotStream, err := ReadVolumeArchive(bytes.NewReader(archive.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "apples" || got.CommitId != "commit" || got.Version != VolumeArchiveVersion {
+		t.Errorf("unexpected manifest %+v", got)
+	}
+	gotBytes, err := ioutil.ReadAll(gotStream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(gotBytes, stream) {
+		t.Errorf("stream changed in the archive: got %d bytes, expected %d", len(gotBytes), len(stream))
+	}
+
+	// a truncated archive must not read as a complete stream
+	_, gotStream, err = ReadVolumeArchive(bytes.NewReader(archive.Bytes()[:archive.Len()/2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(gotStream); err == nil {
+		t.Errorf("expected an error reading a truncated archive")
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("zfs send failed")
+}
+
+func TestVolumeArchiveStreamError(t *testing.T) {
+	var archive bytes.Buffer
+	err := WriteVolumeArchive(&archive, VolumeManifest{}, io.MultiReader(bytes.NewReader([]byte("partial")), failingReader{}))
+	if err == nil {
+		t.Fatalf("expected the stream error to be returned")
+	}
+	_, gotStream, err := ReadVolumeArchive(&archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(gotStream); err == nil {
+		t.Errorf("expected an archive without an end marker not to read as complete")
+	}
+}
+
+func TestReadVolumeArchiveRejectsOtherTars(t *testing.T) {
+	_, _, err := ReadVolumeArchive(bytes.NewReader([]byte("not a tar file at all")))
+	if err == nil {
+		t.Errorf("expected garbage to be rejected")
+	}
+}
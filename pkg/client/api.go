@@ -7,13 +7,17 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"path"
 	"regexp"
 	"sort"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/blang/semver"
 	"github.com/dotmesh-io/dotmesh/pkg/types"
+	"github.com/dotmesh-io/dotmesh/pkg/validator"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/net/context"
 	pb "gopkg.in/cheggaaa/pb.v1"
 
@@ -23,6 +27,10 @@ import (
 const DefaultBranch string = "master"
 const RPCTimeout time.Duration = 20 * time.Second
 
+// DefaultHealthCheckTimeout is how long CheckVolumeHealth waits by default,
+// health checks run zpool and zfs commands so can take longer than most RPCs.
+const DefaultHealthCheckTimeout time.Duration = 60 * time.Second
+
 // TransferPollResult - an alias for dotmesh server type
 type TransferPollResult = types.TransferPollResult
 
@@ -41,7 +49,77 @@ type DotmeshAPI struct {
 	configPath    string
 	Client        *JsonRpcClient
 	PB            *pb.ProgressBar
-	verbose       bool
+	// logLevel is the most detailed level the client logs at, see SetLogLevel
+	logLevel log.Level
+	logger   *log.Logger
+	// Out is where messages for the user, saying which transfer
+	// RequestTransfer is starting and what a dry run would have done, are
+	// printed, os.Stdout if nil
+	Out io.Writer
+	// DryRun stops destructive operations before they reach the server, they
+	// return a *DryRunError describing what they would have done instead.
+	DryRun bool
+	// ForcePush makes RequestTransfer's pushes overwrite commits on the
+	// remote that have diverged from ours, see types.TransferRequest.Force
+	ForcePush bool
+	// ForcePushWarningOut, if set, has RequestTransfer write a warning there
+	// before a forced push, listing the remote's commits it will overwrite
+	ForcePushWarningOut io.Writer
+	// PushTargetCommit makes RequestTransfer's pushes stop at this commit
+	// (an id, tag or HEAD^-style reference on the branch being pushed)
+	// rather than sending every commit up to the latest
+	PushTargetCommit string
+	// TransferEstimateOut, if set, has RequestTransfer write what a transfer
+	// with a dotmesh remote is expected to move, from GetTransferEstimate,
+	// before starting it
+	TransferEstimateOut io.Writer
+	// TransferCompression is how RequestTransfer's transfers with dotmesh
+	// remotes compress the data they send, see
+	// types.TransferRequest.Compression
+	TransferCompression string
+	// ShowTransferProgress has the methods that wait for their own
+	// transfers, CloneFromRemote and MigrateVolume, show a progress bar as
+	// PollTransfer does with UpdateBar
+	ShowTransferProgress bool
+	// CompressArchives gzips the archives written by ExportVolume and read
+	// by ImportVolume
+	CompressArchives bool
+	// tracer is only set by NewDotmeshAPIWithTracing
+	tracer trace.Tracer
+	// timeout overrides RPCTimeout for every method, see WithTimeout
+	timeout time.Duration
+	// methodTimeouts overrides RPCTimeout (and timeout) for individual RPC
+	// methods, keyed by e.g. "DotmeshRPC.Commits"
+	methodTimeouts map[string]time.Duration
+	// healthCheckTimeout overrides DefaultHealthCheckTimeout
+	healthCheckTimeout time.Duration
+	// circuit is nil when there's no config directory to keep its state in,
+	// or it's been disabled
+	circuit *circuitBreaker
+	// httpClient is used for every call to a server, by way of httpClientFor,
+	// and insecureHTTPClient for those to remotes with InsecureTLS set. Both
+	// share NewDotmeshAPIWithPool's settings.
+	httpClient         *http.Client
+	insecureHTTPClient *http.Client
+	// clientMu guards the lazy initialisation of Client, so that a DotmeshAPI
+	// can be shared between goroutines. It's set by the constructors, and
+	// shared with the copies WithTimeout makes.
+	clientMu *sync.Mutex
+}
+
+// DryRunError is returned by destructive operations when the API is in
+// dry-run mode. Message describes what would have happened.
+type DryRunError struct {
+	Message string
+}
+
+func (e *DryRunError) Error() string {
+	return "dry run: " + e.Message
+}
+
+func IsDryRun(err error) bool {
+	_, ok := err.(*DryRunError)
+	return ok
 }
 
 type Dotmesh interface {
@@ -53,19 +131,32 @@ type Dotmesh interface {
 	LastModified(namespace, name string) (*types.LastModified, error)
 	GetFsId(namespace, name, branch string) (string, error)
 	Get(fsId string) (types.DotmeshVolume, error)
-	Procure(data types.ProcureArgs) (string, error)
+	Procure(ctx context.Context, data types.ProcureArgs) (string, error)
+	ProcureWithTimeout(ctx context.Context, data types.ProcureArgs, timeout time.Duration) (string, error)
 	CommitWithStruct(args types.CommitArgs) (string, error)
+	MergeCommitMetadata(ctx context.Context, namespace, name, branch, commitID string, extraMeta map[string]string) error
+	DeleteCommitMetadataKey(ctx context.Context, namespace, name, branch, commitID, key string) error
 	NewVolumeFromStruct(name types.VolumeName) (bool, error)
 	GetMasterBranchId(volume types.VolumeName) (string, error)
+	WaitForVolume(ctx context.Context, vol types.VolumeName, timeout time.Duration) error
 	DeleteVolumeFromStruct(name types.VolumeName) (bool, error)
 	MountCommit(request types.MountCommitRequest) (string, error)
 	Rollback(request types.RollbackRequest) (bool, error)
 	Fork(request types.ForkRequest) (string, error)
+	CrossNamespaceCopy(ctx context.Context, source types.VolumeName, destNamespace string) (types.VolumeName, error)
+	CompareVolumes(ctx context.Context, left, right types.VolumeName, leftBranch, rightBranch string) (*types.VolumeComparison, error)
+	GetNodeForVolume(ctx context.Context, vol types.VolumeName) (string, error)
+	GetAllVolumeLocations(ctx context.Context) (map[string]string, error)
 	List() (map[string]map[string]types.DotmeshVolume, error)
 	GetVersion() (VersionInfo, error)
 	GetTransfer(transferId string) (TransferPollResult, error)
+	ListTransfers(ctx context.Context, filter types.TransferFilter) ([]types.TransferRecord, error)
 	Transfer(request types.TransferRequest) (string, error)
+	CloneFromRemote(ctx context.Context, peer, remoteVolume, localVolume string) error
+	GetTransferEstimate(ctx context.Context, req types.TransferRequest) (*types.TransferEstimate, error)
 	S3Transfer(request types.S3TransferRequest) (string, error)
+	RenameBranch(ctx context.Context, vol types.VolumeName, oldBranch, newBranch string) error
+	DeleteBranch(ctx context.Context, vol types.VolumeName, branch string) error
 }
 
 var _ Dotmesh = &DotmeshAPI{}
@@ -83,32 +174,144 @@ func NewDotmeshAPI(configPath string, verbose bool) (*DotmeshAPI, error) {
 
 	d := &DotmeshAPI{
 		Configuration: c,
+		configPath:    configPath,
 		Client:        nil,
-		verbose:       verbose,
+		circuit:       newCircuitBreaker(configPath),
+		clientMu:      &sync.Mutex{},
+	}
+	d.SetVerboseFlag(verbose)
+	d.setTransport(http.DefaultTransport.(*http.Transport).Clone())
+	return d, nil
+}
+
+// setTransport makes calls to servers use transport, or a copy of it that
+// doesn't verify certificates for remotes with InsecureTLS set.
+func (dm *DotmeshAPI) setTransport(transport *http.Transport) {
+	dm.httpClient = &http.Client{Transport: transport}
+	dm.insecureHTTPClient = insecureHTTPClient(transport)
+}
+
+// httpClientFor is the client for calls to a server, which skips verifying
+// its TLS certificate when insecureTLS is set.
+func (dm *DotmeshAPI) httpClientFor(insecureTLS bool) *http.Client {
+	if insecureTLS {
+		if dm.insecureHTTPClient == nil {
+			return defaultInsecureHTTPClient
+		}
+		return dm.insecureHTTPClient
+	}
+	if dm.httpClient == nil {
+		return http.DefaultClient
+	}
+	return dm.httpClient
+}
+
+// clusterFromRemote is a client for the dotmesh remote called name, sharing
+// dm's HTTP clients.
+func (dm *DotmeshAPI) clusterFromRemote(name string) (*JsonRpcClient, error) {
+	client, err := dm.Configuration.ClusterFromRemote(name, dm.verbose())
+	if err != nil {
+		return nil, err
+	}
+	client.HTTPClient = dm.httpClientFor(client.InsecureTLS)
+	return client, nil
+}
+
+// NewDotmeshAPIWithTimeouts is NewDotmeshAPI, but calls to the RPC methods in
+// timeouts (e.g. "DotmeshRPC.Commits") give up after the given duration rather
+// than RPCTimeout.
+func NewDotmeshAPIWithTimeouts(configPath string, verbose bool, timeouts map[string]time.Duration) (*DotmeshAPI, error) {
+	d, err := NewDotmeshAPI(configPath, verbose)
+	if err != nil {
+		return nil, err
+	}
+	d.methodTimeouts = timeouts
+	return d, nil
+}
+
+// NewDotmeshAPIWithPool is NewDotmeshAPI, but calls to the server share a
+// transport that keeps up to maxConns idle connections to it open, for
+// processes that make many concurrent calls. Call Close when done with it.
+func NewDotmeshAPIWithPool(configPath string, verbose bool, maxConns int) (*DotmeshAPI, error) {
+	if maxConns <= 0 {
+		return nil, fmt.Errorf("maxConns must be positive, got %d", maxConns)
+	}
+	d, err := NewDotmeshAPI(configPath, verbose)
+	if err != nil {
+		return nil, err
 	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = maxConns
+	if transport.MaxIdleConns < maxConns {
+		transport.MaxIdleConns = maxConns
+	}
+	d.setTransport(transport)
 	return d, nil
 }
 
+// Close drops any idle connections held open by NewDotmeshAPIWithPool's
+// transport. It's safe to call on any DotmeshAPI, and to keep using it after.
+func (dm *DotmeshAPI) Close() error {
+	for _, client := range []*http.Client{dm.httpClient, dm.insecureHTTPClient} {
+		if client != nil {
+			client.CloseIdleConnections()
+		}
+	}
+	return nil
+}
+
+// WithTimeout returns a shallow copy of the API client whose calls give up
+// after d rather than RPCTimeout. Per-method timeouts still take precedence.
+func (dm *DotmeshAPI) WithTimeout(d time.Duration) *DotmeshAPI {
+	dm.clientMu.Lock()
+	defer dm.clientMu.Unlock()
+	c := *dm
+	c.timeout = d
+	return &c
+}
+
+// rpcTimeout is how long a call to method may take when the caller's context
+// doesn't already have a deadline.
+func (dm *DotmeshAPI) rpcTimeout(method string) time.Duration {
+	if t, ok := dm.methodTimeouts[method]; ok {
+		return t
+	}
+	if dm.timeout > 0 {
+		return dm.timeout
+	}
+	return RPCTimeout
+}
+
 func NewDotmeshAPIFromClient(client *JsonRpcClient, verbose bool) *DotmeshAPI {
-	return &DotmeshAPI{
+	dm := &DotmeshAPI{
 		Configuration: nil,
 		Client:        client,
-		verbose:       verbose,
+		clientMu:      &sync.Mutex{},
 	}
+	dm.SetVerboseFlag(verbose)
+	return dm
 }
 
 func (dm *DotmeshAPI) openClient() error {
+	dm.clientMu.Lock()
+	defer dm.clientMu.Unlock()
 	if dm.Client == nil {
-		client, err := dm.Configuration.ClusterFromCurrentRemote(dm.verbose)
-		if err == nil {
-			dm.Client = client
-			return nil
-		} else {
+		ctx, cancel := context.WithTimeout(context.Background(), RPCTimeout)
+		err := dm.Configuration.refreshOIDC(ctx, dm.Configuration.GetCurrentRemote())
+		cancel()
+		if err != nil {
 			return err
 		}
-	} else {
-		return nil
+		client, err := dm.clusterFromRemote(dm.Configuration.GetCurrentRemote())
+		if err != nil {
+			return err
+		}
+		dm.Client = client
 	}
+	if dm.circuit != nil {
+		return dm.circuit.allow(dm.Client.Hostname)
+	}
+	return nil
 }
 
 // proxy thru
@@ -117,14 +320,92 @@ func (dm *DotmeshAPI) CallRemote(
 ) error {
 	err := dm.openClient()
 	if err == nil {
-		return dm.Client.CallRemote(ctx, method, args, response)
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, dm.rpcTimeout(method))
+			defer cancel()
+		}
+		ctx, end := dm.startSpan(ctx, method)
+		err = dm.Client.CallRemote(ctx, method, args, response)
+		end(err)
+		if dm.circuit != nil {
+			dm.circuit.record(dm.Client.Hostname, err)
+		}
+		return err
 	} else {
 		return err
 	}
 }
 
+// SetVerboseFlag logs everything, including RPC requests and responses, if
+// verbose is true, or only warnings and errors if it isn't.
 func (dm *DotmeshAPI) SetVerboseFlag(verbose bool) {
-	dm.verbose = verbose
+	dm.SetLogLevel(verboseLogLevel(verbose))
+}
+
+// SetLogLevel sets the most detailed level the client logs at, which is
+// log.WarnLevel unless it was made verbose. Logs go to the standard logrus
+// logger's output, with the formatter and hooks it has when this is called,
+// however its own level is set.
+func (dm *DotmeshAPI) SetLogLevel(level log.Level) {
+	dm.logLevel = level
+	dm.logger = levelLogger(level)
+}
+
+// levelLogger logs at level to the standard logger's output.
+func levelLogger(level log.Level) *log.Logger {
+	std := log.StandardLogger()
+	return &log.Logger{
+		Out:          std.Out,
+		Hooks:        std.Hooks,
+		Formatter:    std.Formatter,
+		ReportCaller: std.ReportCaller,
+		Level:        level,
+		ExitFunc:     std.ExitFunc,
+	}
+}
+
+func verboseLogLevel(verbose bool) log.Level {
+	if verbose {
+		return log.DebugLevel
+	}
+	return log.WarnLevel
+}
+
+// verbose is true if RPCs should be dumped to stdout, see JsonRpcClient.
+func (dm *DotmeshAPI) verbose() bool {
+	return dm.logLevel >= log.DebugLevel
+}
+
+// log is an entry logging at dm's level to the standard logger's output.
+func (dm *DotmeshAPI) log() *log.Entry {
+	if dm.logger == nil {
+		return log.NewEntry(levelLogger(dm.logLevel))
+	}
+	return log.NewEntry(dm.logger)
+}
+
+// printf prints a message for the user to dm.Out.
+func (dm *DotmeshAPI) printf(format string, args ...interface{}) {
+	out := dm.Out
+	if out == nil {
+		out = os.Stdout
+	}
+	fmt.Fprintf(out, format, args...)
+}
+
+func (dm *DotmeshAPI) SetDryRun(dryRun bool) {
+	dm.DryRun = dryRun
+}
+
+func (dm *DotmeshAPI) SetHealthCheckTimeout(timeout time.Duration) {
+	dm.healthCheckTimeout = timeout
+}
+
+func (dm *DotmeshAPI) dryRun(format string, args ...interface{}) error {
+	message := fmt.Sprintf("would have "+format, args...)
+	dm.printf("[dry-run] %s\n", message)
+	return &DryRunError{Message: message}
 }
 
 func (dm *DotmeshAPI) List() (map[string]map[string]types.DotmeshVolume, error) {
@@ -141,12 +422,135 @@ func (dm *DotmeshAPI) Fork(request types.ForkRequest) (string, error) {
 	return forkDotId, err
 }
 
+// ForkAtCommit - forks the master branch as Fork does, but from the commit
+// named by commitRef rather than the latest one. commitRef may be a commit id
+// or HEAD^N-style relative reference.
+func (dm *DotmeshAPI) ForkAtCommit(ctx context.Context, req types.ForkRequest, commitRef string) (string, error) {
+	var volume types.DotmeshVolume
+	err := dm.CallRemote(ctx, "DotmeshRPC.Get", req.MasterBranchId, &volume)
+	if err != nil {
+		return "", err
+	}
+	commitId, err := dm.findCommit(commitRef, volume.Name.String(), volume.Branch)
+	if err != nil {
+		return "", err
+	}
+	req.SourceCommitId = commitId
+
+	var forkDotId string
+	err = dm.CallRemote(ctx, "DotmeshRPC.Fork", req, &forkDotId)
+	return forkDotId, err
+}
+
+// CloneVolume copies the latest commit on branch of source, and the commits
+// before it, into a new volume dest, and returns its filesystem id.
+//
+// A fork is copied the same way, but stays linked to the volume it was forked
+// from; a clone is a volume in its own right, which can have its commits
+// deleted or be deleted itself without regard to the original. The copy is
+// of the whole volume, so check EstimateCloneVolume first for big ones.
+func (dm *DotmeshAPI) CloneVolume(ctx context.Context, source, dest types.VolumeName, branch string) (string, error) {
+	if dm.DryRun {
+		return "", dm.dryRun("cloned %s to %s", source, dest)
+	}
+	var result types.CloneVolumeResult
+	err := dm.CallRemote(ctx, "DotmeshRPC.Clone", types.CloneVolumeRequest{
+		Source: source,
+		Dest:   dest,
+		Branch: deMasterify(branch),
+	}, &result)
+	if err != nil {
+		return "", err
+	}
+	dm.log().WithField("bytes", result.EstimatedBytes).Debugf("[CloneVolume] cloned %s to %s", source, dest)
+	return result.FilesystemId, nil
+}
+
+// EstimateCloneVolume is how many bytes CloneVolume would copy to clone
+// branch of source.
+func (dm *DotmeshAPI) EstimateCloneVolume(ctx context.Context, source types.VolumeName, branch string) (int64, error) {
+	var result types.CloneVolumeResult
+	err := dm.CallRemote(ctx, "DotmeshRPC.Clone", types.CloneVolumeRequest{
+		Source:       source,
+		Dest:         source,
+		Branch:       deMasterify(branch),
+		EstimateOnly: true,
+	}, &result)
+	if err != nil {
+		return 0, err
+	}
+	return result.EstimatedBytes, nil
+}
+
+// CrossNamespaceCopy clones the master branch of source, as CloneVolume does,
+// to a volume of the same name in destNamespace, and returns its name. The
+// caller must be an administrator of source's namespace, and there mustn't
+// already be a volume of that name in destNamespace.
+func (dm *DotmeshAPI) CrossNamespaceCopy(ctx context.Context, source types.VolumeName, destNamespace string) (types.VolumeName, error) {
+	return dm.crossNamespaceCopy(ctx, source, destNamespace, false)
+}
+
+// CrossNamespaceCopyOverwriting is CrossNamespaceCopy, but deletes any volume
+// of the same name already in destNamespace (which the caller must own)
+// first.
+func (dm *DotmeshAPI) CrossNamespaceCopyOverwriting(ctx context.Context, source types.VolumeName, destNamespace string) (types.VolumeName, error) {
+	return dm.crossNamespaceCopy(ctx, source, destNamespace, true)
+}
+
+func (dm *DotmeshAPI) crossNamespaceCopy(ctx context.Context, source types.VolumeName, destNamespace string, overwrite bool) (types.VolumeName, error) {
+	if dm.DryRun {
+		return types.VolumeName{}, dm.dryRun("copied %s to namespace %s", source, destNamespace)
+	}
+	var dest types.VolumeName
+	err := dm.CallRemote(ctx, "DotmeshRPC.CrossNamespaceCopy", types.CrossNamespaceCopyRequest{
+		Source:        source,
+		DestNamespace: destNamespace,
+		Overwrite:     overwrite,
+	}, &dest)
+	return dest, err
+}
+
 func (dm *DotmeshAPI) GetMasterBranchId(volume types.VolumeName) (string, error) {
 	var masterBranchId string
 	err := dm.CallRemote(context.Background(), "DotmeshRPC.Exists", &volume, &masterBranchId)
 	return masterBranchId, err
 }
 
+// volumeWaitInterval is how often WaitForVolume asks after the volume.
+var volumeWaitInterval = 500 * time.Millisecond
+
+// WaitForVolume polls until vol exists and has a master branch, e.g. after
+// creating it with NewVolumeFromStruct, while the server is still setting it
+// up. It gives up with an error wrapping ErrVolumeTimeout after timeout, or
+// sooner if ctx is done.
+func (dm *DotmeshAPI) WaitForVolume(ctx context.Context, vol types.VolumeName, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	started := time.Now()
+	for {
+		var masterBranchId string
+		err := dm.CallRemote(ctx, "DotmeshRPC.Exists", &vol, &masterBranchId)
+		if err == nil && masterBranchId != "" {
+			return nil
+		}
+		if IsPermissionDenied(err) {
+			return err
+		}
+		if err != nil {
+			dm.log().WithError(err).WithField("volume", vol.String()).Debug("[WaitForVolume] error from Exists, trying again")
+		}
+
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.Canceled {
+				return ctx.Err()
+			}
+			return fmt.Errorf("%w: %s wasn't ready after %s", ErrVolumeTimeout, vol.StringWithoutAdmin(), time.Since(started).Round(time.Millisecond))
+		case <-time.After(volumeWaitInterval):
+		}
+	}
+}
+
 func (dm *DotmeshAPI) MountCommit(request types.MountCommitRequest) (string, error) {
 	var mountpoint string
 	err := dm.CallRemote(context.Background(), "DotmeshRPC.MountCommit", request, &mountpoint)
@@ -162,40 +566,114 @@ func (dm *DotmeshAPI) PingLocal() (bool, error) {
 	}
 }
 
-func (dm *DotmeshAPI) BackupEtcd() (string, error) {
-	var response types.BackupV1
-	err := dm.CallRemote(context.Background(), "DotmeshRPC.DumpEtcd",
-		struct{ Prefix string }{Prefix: ""},
-		&response,
-	)
+// PingWithLatency pings the current remote, and returns how long the round
+// trip took and the version of dotmesh it's running. The version is empty if
+// the server is too old to say. Only the ping itself is timed, not finding
+// which of the remote's addresses answers.
+func (dm *DotmeshAPI) PingWithLatency(ctx context.Context) (time.Duration, string, error) {
+	err := dm.openClient()
 	if err != nil {
-		return "", err
+		return 0, "", err
 	}
-
-	bts, err := json.Marshal(&response)
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dm.rpcTimeout("DotmeshRPC.PingVersion"))
+		defer cancel()
+	}
+	base, err := dm.Client.serverURL(ctx)
 	if err != nil {
-		return "", err
+		if dm.circuit != nil {
+			dm.circuit.record(dm.Client.Hostname, err)
+		}
+		return 0, "", err
 	}
 
-	return string(bts), nil
+	ping := func(method string, result interface{}) (time.Duration, error) {
+		start := time.Now()
+		err := dm.Client.reallyCallRemote(ctx, method, struct{}{}, result, base+"/rpc")
+		return time.Since(start), err
+	}
+	var version string
+	latency, err := ping("DotmeshRPC.PingVersion", &version)
+	if isMethodNotFound(err) {
+		var ok bool
+		latency, err = ping("DotmeshRPC.Ping", &ok)
+	}
+	if dm.circuit != nil {
+		dm.circuit.record(dm.Client.Hostname, err)
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	return latency, version, nil
 }
 
-func (dm *DotmeshAPI) RestoreEtcd(dump string) error {
-	var response bool
-	err := dm.CallRemote(context.Background(), "DotmeshRPC.RestoreEtcd",
-		struct {
-			Prefix string
-			Dump   string
-		}{
-			Prefix: "",
-			Dump:   dump,
-		},
-		&response,
-	)
+// hasCapability is true if the current remote says it can do capability, one
+// of the keys in the result of DotmeshRPC.Capabilities. Servers from before
+// Capabilities can't do any of them.
+func (dm *DotmeshAPI) hasCapability(ctx context.Context, capability string) (bool, error) {
+	var capabilities map[string]bool
+	err := dm.CallRemote(ctx, "DotmeshRPC.Capabilities", struct{}{}, &capabilities)
+	if isMethodNotFound(err) {
+		return false, nil
+	}
 	if err != nil {
-		return err
+		return false, err
 	}
-	return nil
+	return capabilities[capability], nil
+}
+
+// PingAll pings each of remoteNames at once, and returns the result for each.
+// A remote that can't be pinged has the reason in its result rather than
+// making PingAll fail; the error is for names that aren't dotmesh remotes.
+func (dm *DotmeshAPI) PingAll(ctx context.Context, remoteNames []string) (map[string]types.PingResult, error) {
+	clients := map[string]*JsonRpcClient{}
+	for _, name := range remoteNames {
+		client, err := dm.clusterFromRemote(name)
+		if err != nil {
+			return nil, err
+		}
+		clients[name] = client
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := map[string]types.PingResult{}
+	for name, client := range clients {
+		wg.Add(1)
+		go func(name string, client *JsonRpcClient) {
+			defer wg.Done()
+			var result types.PingResult
+			latency, version, err := NewDotmeshAPIFromClient(client, dm.verbose()).PingWithLatency(ctx)
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Latency = latency
+				result.ServerVersion = version
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			results[name] = result
+		}(name, client)
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// ListRemotes lists the configured remotes. It only reads the local
+// configuration, so works without a server.
+func (dm *DotmeshAPI) ListRemotes(ctx context.Context) ([]types.RemoteInfo, error) {
+	return dm.Configuration.RemoteInfos(), nil
+}
+
+// RemoveRemote removes a remote from the configuration file.
+func (dm *DotmeshAPI) RemoveRemote(name string) error {
+	return dm.Configuration.RemoveRemote(name)
+}
+
+// RenameRemote renames a remote in the configuration file.
+func (dm *DotmeshAPI) RenameRemote(oldName, newName string) error {
+	return dm.Configuration.RenameRemote(oldName, newName)
 }
 
 func (dm *DotmeshAPI) GetVersion() (VersionInfo, error) {
@@ -207,6 +685,72 @@ func (dm *DotmeshAPI) GetVersion() (VersionInfo, error) {
 	return response, nil
 }
 
+// ClientVersion is the version of the program using this package, which
+// CheckCompatibility compares to the server's. The dm binary sets it to the
+// version it was built as.
+var ClientVersion string
+
+// CheckCompatibility compares the server's version to ClientVersion. The
+// versions are compatible if their major and minor versions match.
+func (dm *DotmeshAPI) CheckCompatibility(ctx context.Context) (*types.CompatibilityResult, error) {
+	var version VersionInfo
+	err := dm.CallRemote(ctx, "DotmeshRPC.Version", struct{}{}, &version)
+	if err != nil {
+		return nil, err
+	}
+	result := compareVersions(ClientVersion, version.InstalledVersion)
+	return &result, nil
+}
+
+// CompatibilityCacheTTL is how long CachedCompatibility trusts the result of
+// checking a remote's compatibility.
+const CompatibilityCacheTTL = 24 * time.Hour
+
+// CachedCompatibility is CheckCompatibility for the current remote, but only
+// asks the server if it hasn't been asked in the last CompatibilityCacheTTL,
+// or ClientVersion has changed since; otherwise it returns the result saved
+// in the configuration last time.
+func (dm *DotmeshAPI) CachedCompatibility(ctx context.Context) (*types.CompatibilityResult, error) {
+	remote := dm.Configuration.CurrentRemote
+	check, ok := dm.Configuration.CompatibilityFor(remote)
+	if ok && check.Result.ClientVersion == ClientVersion && time.Since(check.CheckedAt) < CompatibilityCacheTTL {
+		return &check.Result, nil
+	}
+	result, err := dm.CheckCompatibility(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = dm.Configuration.SetCompatibilityFor(remote, CompatibilityCheck{Result: *result, CheckedAt: time.Now()})
+	if err != nil {
+		log.WithError(err).Debug("[CachedCompatibility] couldn't save the result")
+	}
+	return result, nil
+}
+
+func compareVersions(clientVersion, serverVersion string) types.CompatibilityResult {
+	result := types.CompatibilityResult{
+		Compatible:    true,
+		ClientVersion: clientVersion,
+		ServerVersion: serverVersion,
+	}
+	cv, err := semver.ParseTolerant(strings.TrimPrefix(clientVersion, "release-"))
+	if err != nil {
+		return result
+	}
+	sv, err := semver.ParseTolerant(strings.TrimPrefix(serverVersion, "release-"))
+	if err != nil {
+		return result
+	}
+	if cv.Major != sv.Major || cv.Minor != sv.Minor {
+		result.Compatible = false
+		result.Warning = fmt.Sprintf(
+			"dm client version %s may not work with dotmesh server version %s; upgrade whichever is older to match the other",
+			clientVersion, serverVersion,
+		)
+	}
+	return result
+}
+
 func (dm *DotmeshAPI) Get(FsID string) (types.DotmeshVolume, error) {
 	volume := types.DotmeshVolume{}
 	err := dm.CallRemote(context.Background(), "DotmeshRPC.Get", FsID, &volume)
@@ -233,8 +777,14 @@ func (dm *DotmeshAPI) NewVolume(volumeName string) error {
 }
 
 func (dm *DotmeshAPI) NewVolumeFromStruct(name types.VolumeName) (bool, error) {
+	// Only new volumes are held to this, so that existing ones that
+	// wouldn't pass can still be named
+	err := validator.IsValidNewVolume(name.Namespace, name.Name)
+	if err != nil {
+		return false, fmt.Errorf("Can't create %s/%s: %w", name.Namespace, name.Name, err)
+	}
 	var response bool
-	err := dm.CallRemote(context.Background(), "DotmeshRPC.Create", name, &response)
+	err = dm.CallRemote(context.Background(), "DotmeshRPC.Create", name, &response)
 	if err != nil {
 		return false, err
 	}
@@ -251,15 +801,47 @@ func (dm *DotmeshAPI) ProcureVolume(volumeName string) (string, error) {
 		Name:      name,
 		Subdot:    "__default__",
 	}
-	return dm.Procure(sendVolumeName)
+	return dm.Procure(context.Background(), sendVolumeName)
 }
 
-func (dm *DotmeshAPI) Procure(data types.ProcureArgs) (string, error) {
+func (dm *DotmeshAPI) Procure(ctx context.Context, data types.ProcureArgs) (string, error) {
 	var response string
-	err := dm.CallRemote(context.Background(), "DotmeshRPC.Procure", data, &response)
+	err := dm.CallRemote(ctx, "DotmeshRPC.Procure", data, &response)
 	return response, err
 }
 
+// procureRetryInterval is how long ProcureWithTimeout first waits before
+// asking again, doubling each time up to procureMaxRetryInterval.
+var procureRetryInterval = 500 * time.Millisecond
+
+const procureMaxRetryInterval = 8 * time.Second
+
+// ProcureWithTimeout procures the volume like Procure, but asks again, backing
+// off exponentially, while the server says it isn't ready yet, giving up after
+// timeout.
+func (dm *DotmeshAPI) ProcureWithTimeout(ctx context.Context, data types.ProcureArgs, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	interval := procureRetryInterval
+	for {
+		mountpoint, err := dm.Procure(ctx, data)
+		if !IsNotReady(err) {
+			return mountpoint, err
+		}
+		dm.log().WithError(err).WithField("volume", data.Namespace+"/"+data.Name).Debugf("[ProcureWithTimeout] not ready, trying again in %s", interval)
+
+		select {
+		case <-ctx.Done():
+			return "", err
+		case <-time.After(interval):
+		}
+		interval *= 2
+		if interval > procureMaxRetryInterval {
+			interval = procureMaxRetryInterval
+		}
+	}
+}
+
 func (dm *DotmeshAPI) setCurrentVolume(volumeName string) error {
 	return dm.Configuration.SetCurrentVolume(volumeName)
 }
@@ -269,7 +851,10 @@ func (dm *DotmeshAPI) setCurrentBranch(volumeName, branchName string) error {
 	return dm.Configuration.SetCurrentBranchForVolume(volumeName, branchName)
 }
 
-func (dm *DotmeshAPI) CreateBranch(volumeName, sourceBranch, newBranch string) error {
+// CreateBranch makes newBranch from fromCommit on sourceBranch, or on the
+// volume's default branch if sourceBranch is "". fromCommit can be anything
+// findCommit understands, and "" means the latest commit (HEAD).
+func (dm *DotmeshAPI) CreateBranch(volumeName, sourceBranch, newBranch, fromCommit string) error {
 	var result bool
 
 	namespace, name, err := ParseNamespacedVolume(volumeName)
@@ -277,10 +862,26 @@ func (dm *DotmeshAPI) CreateBranch(volumeName, sourceBranch, newBranch string) e
 		return err
 	}
 
-	commitId, err := dm.findCommit("HEAD", volumeName, sourceBranch)
+	if sourceBranch == "" {
+		sourceBranch, err = dm.GetDefaultBranch(context.Background(), types.VolumeName{Namespace: namespace, Name: name})
+		if err != nil {
+			return err
+		}
+	}
+
+	if fromCommit == "" {
+		fromCommit = "HEAD"
+	}
+	commitId, err := dm.findCommit(fromCommit, volumeName, sourceBranch)
 	if err != nil {
 		return err
 	}
+	if fromCommit != "HEAD" {
+		err = dm.ensureCommitExists(namespace, name, sourceBranch, commitId)
+		if err != nil {
+			return err
+		}
+	}
 
 	return dm.CallRemote(
 		context.Background(),
@@ -305,23 +906,132 @@ func (dm *DotmeshAPI) CreateBranch(volumeName, sourceBranch, newBranch string) e
 	*/
 }
 
-func (dm *DotmeshAPI) CheckoutBranch(volumeName, from, to string, create bool) error {
+// ensureCommitExists checks with CommitsById that commitId is one of
+// branch's commits, as findCommit passes anything that looks like an id
+// straight through.
+func (dm *DotmeshAPI) ensureCommitExists(namespace, name, branch, commitId string) error {
+	fsId, err := dm.GetFsId(namespace, name, deMasterify(branch))
+	if err != nil {
+		return err
+	}
+	commits, err := dm.CommitsById(fsId)
+	if err != nil {
+		return err
+	}
+	for _, commit := range commits {
+		if commit.Id == commitId {
+			return nil
+		}
+	}
+	return fmt.Errorf("No commit %s on branch %s of %s/%s", commitId, branch, namespace, name)
+}
+
+// CopyBranch makes destBranch of vol a copy of sourceBranch's commits, e.g.
+// to keep them safe before anything destructive is done to sourceBranch. It
+// returns an error wrapping ErrBranchExists if destBranch already exists.
+func (dm *DotmeshAPI) CopyBranch(ctx context.Context, vol types.VolumeName, sourceBranch, destBranch string) error {
+	if dm.DryRun {
+		return dm.dryRun("copied branch %s of %s to %s", sourceBranch, vol, destBranch)
+	}
+	var newFilesystemId string
+	err := dm.CallRemote(ctx, "DotmeshRPC.CopyBranch", types.CopyBranchRequest{
+		Name:         vol,
+		SourceBranch: sourceBranch,
+		DestBranch:   destBranch,
+	}, &newFilesystemId)
+	if IsConflict(err) {
+		return fmt.Errorf("%w: %s on %s", ErrBranchExists, destBranch, vol.StringWithoutAdmin())
+	}
+	return err
+}
+
+// RenameBranch gives oldBranch of vol a new name, and follows it if it was
+// the current branch. The master branch can't be renamed.
+func (dm *DotmeshAPI) RenameBranch(ctx context.Context, vol types.VolumeName, oldBranch, newBranch string) error {
+	if oldBranch == DefaultBranch {
+		return fmt.Errorf("The %s branch can't be renamed", DefaultBranch)
+	}
+	if dm.DryRun {
+		return dm.dryRun("renamed branch %s of %s to %s", oldBranch, vol, newBranch)
+	}
+	var result bool
+	err := dm.CallRemote(ctx, "DotmeshRPC.RenameBranch", types.RenameBranchRequest{
+		Name:      vol,
+		OldBranch: oldBranch,
+		NewBranch: newBranch,
+	}, &result)
+	if err != nil {
+		return err
+	}
+
+	if dm.Configuration != nil {
+		volumeName := vol.StringWithoutAdmin()
+		if branch, ok := dm.Configuration.SelectedBranchFor(volumeName); ok && branch == oldBranch {
+			return dm.setCurrentBranch(volumeName, newBranch)
+		}
+	}
+	return nil
+}
+
+// DeleteBranch deletes branch of vol, and goes back to the master branch if it
+// was the current branch. Neither master nor the volume's default branch can
+// be deleted, nor a branch that containers are using.
+func (dm *DotmeshAPI) DeleteBranch(ctx context.Context, vol types.VolumeName, branch string) error {
+	if branch == DefaultBranch {
+		return fmt.Errorf("%w: %s", ErrCannotDeleteDefaultBranch, DefaultBranch)
+	}
+	if dm.DryRun {
+		return dm.dryRun("deleted branch %s of %s", branch, vol)
+	}
+	var result bool
+	err := dm.CallRemote(ctx, "DotmeshRPC.DeleteBranch", types.DeleteBranchRequest{
+		Name:   vol,
+		Branch: branch,
+	}, &result)
+	if hasErrorCode(err, types.ErrCodeDefaultBranch) {
+		return fmt.Errorf("%w: %s on %s", ErrCannotDeleteDefaultBranch, branch, vol.StringWithoutAdmin())
+	}
+	if err != nil {
+		return err
+	}
+
+	if dm.Configuration != nil {
+		volumeName := vol.StringWithoutAdmin()
+		if current, ok := dm.Configuration.SelectedBranchFor(volumeName); ok && current == branch {
+			return dm.Configuration.ClearCurrentBranchFor(volumeName)
+		}
+	}
+	return nil
+}
+
+// CheckoutBranch switches volumeName to branch to, first making it from
+// branch from if create is set. The new branch starts at fromCommit, or at
+// from's latest commit if fromCommit is "".
+func (dm *DotmeshAPI) CheckoutBranch(volumeName, from, to string, create bool, fromCommit string) error {
 	namespace, name, err := ParseNamespacedVolume(volumeName)
 	if err != nil {
 		return err
 	}
 
+	if to == "" {
+		to, err = dm.GetDefaultBranch(context.Background(), types.VolumeName{Namespace: namespace, Name: name})
+		if err != nil {
+			return err
+		}
+	}
+
 	exists, err := dm.BranchExists(volumeName, to)
 	if err != nil {
 		return err
 	}
-	// The DEFAULT_BRANCH always implicitly exists
+	// The master branch (DEFAULT_BRANCH) always implicitly exists, whatever
+	// the volume's default branch is
 	exists = exists || to == DefaultBranch
 	if create {
 		if exists {
 			return fmt.Errorf("Branch already exists: %s", to)
 		}
-		if err := dm.CreateBranch(volumeName, from, to); err != nil {
+		if err := dm.CreateBranch(volumeName, from, to, fromCommit); err != nil {
 			return err
 		}
 	}
@@ -387,6 +1097,9 @@ func (dm *DotmeshAPI) CurrentVolume() (string, error) {
 }
 
 func (dm *DotmeshAPI) Rollback(request types.RollbackRequest) (bool, error) {
+	if dm.DryRun {
+		return false, dm.dryRun("rolled back %s/%s@%s to %s", request.Namespace, request.Name, request.Branch, request.SnapshotId)
+	}
 	var result bool
 	err := dm.CallRemote(context.Background(), "DotmeshRPC.Rollback", request, &result)
 	return result, err
@@ -464,19 +1177,59 @@ func (dm *DotmeshAPI) DeleteVolume(volumeName string) error {
 }
 
 func (dm *DotmeshAPI) DeleteVolumeFromStruct(name types.VolumeName) (bool, error) {
+	if dm.DryRun {
+		return false, dm.dryRun("deleted %s and all of its branches", name)
+	}
 	var result bool
+	var inUse error
 	err := retryUntilSucceeds(func() error {
 		err := dm.CallRemote(
 			context.Background(), "DotmeshRPC.Delete", name, &result,
 		)
-		if err != nil {
+		if IsInUse(err) {
+			// not going to change by trying again
+			inUse = err
+			return nil
+		}
+		if err != nil {
 			return err
 		}
 		return nil
 	}, 5, 1*time.Second)
+	if inUse != nil {
+		return false, inUse
+	}
 	return result, err
 }
 
+// SoftDeleteVolume moves a volume into the recycle bin. It stops showing up in
+// listings, but can be brought back with RestoreVolume until retentionPeriod
+// has passed, after which the server purges it.
+func (dm *DotmeshAPI) SoftDeleteVolume(ctx context.Context, name types.VolumeName, retentionPeriod time.Duration) error {
+	if dm.DryRun {
+		return dm.dryRun("moved %s to the recycle bin for %s", name, retentionPeriod)
+	}
+	var result bool
+	return dm.CallRemote(ctx, "DotmeshRPC.SoftDelete", types.SoftDeleteRequest{
+		Name:            name,
+		RetentionPeriod: retentionPeriod,
+	}, &result)
+}
+
+func (dm *DotmeshAPI) ListDeletedVolumes(ctx context.Context) ([]types.DeletedVolume, error) {
+	var result []types.DeletedVolume
+	err := dm.CallRemote(ctx, "DotmeshRPC.ListDeleted", struct{}{}, &result)
+	if err != nil {
+		return []types.DeletedVolume{}, err
+	}
+	return result, nil
+}
+
+func (dm *DotmeshAPI) RestoreVolume(ctx context.Context, name types.VolumeName) error {
+	var result bool
+	return dm.CallRemote(ctx, "DotmeshRPC.Restore", name, &result)
+}
+
 func retryUntilSucceeds(f func() error, retries int, delay time.Duration) error {
 	var err error
 	for try := 0; try < retries; try++ {
@@ -512,12 +1265,207 @@ func (dm *DotmeshAPI) GetReplicationLatencyForBranch(volumeName string, branch s
 	return result, err
 }
 
+// GetReplicationStatus reports how far each replica of branch is behind the
+// copy on its master node. Only the admin user can ask.
+func (dm *DotmeshAPI) GetReplicationStatus(ctx context.Context, namespace, name, branch string) (*types.ReplicationStatus, error) {
+	var result types.ReplicationStatus
+	err := dm.CallRemote(
+		ctx, "DotmeshRPC.GetReplicationStatus",
+		struct {
+			Namespace, Name, Branch string
+		}{
+			Namespace: namespace,
+			Name:      name,
+			Branch:    deMasterify(branch),
+		},
+		&result,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetVolumeMountPoints maps the name of each branch of vol that's mounted to
+// the path on the host where its files are. Only branches mounted on the node
+// the current remote points at are included.
+func (dm *DotmeshAPI) GetVolumeMountPoints(ctx context.Context, vol types.VolumeName) (map[string]string, error) {
+	var mountPoints map[string]string
+	err := dm.CallRemote(ctx, "DotmeshRPC.GetMountPoints", vol, &mountPoints)
+	if err != nil {
+		return nil, err
+	}
+	return mountPoints, nil
+}
+
+// GetMountPointForBranch is where on the host branch of vol is mounted, or an
+// error if it isn't.
+func (dm *DotmeshAPI) GetMountPointForBranch(ctx context.Context, vol types.VolumeName, branch string) (string, error) {
+	if branch == "" {
+		branch = DefaultBranch
+	}
+	mountPoints, err := dm.GetVolumeMountPoints(ctx, vol)
+	if err != nil {
+		return "", err
+	}
+	mountPoint, ok := mountPoints[branch]
+	if !ok {
+		return "", fmt.Errorf("Branch %s of %s isn't mounted on %s", branch, vol, dm.Client.Hostname)
+	}
+	return mountPoint, nil
+}
+
+// GetForkLineage returns the volume vol was forked from, if any, and the
+// volumes that have been forked from it.
+func (dm *DotmeshAPI) GetForkLineage(ctx context.Context, vol types.VolumeName) (*types.ForkLineage, error) {
+	var lineage types.ForkLineage
+	err := dm.CallRemote(ctx, "DotmeshRPC.GetForkLineage", vol, &lineage)
+	if err != nil {
+		return nil, err
+	}
+	return &lineage, nil
+}
+
+// GetNodeForVolume returns the node holding the master copy of vol, the one
+// it's mounted on and written to, for debugging replication.
+func (dm *DotmeshAPI) GetNodeForVolume(ctx context.Context, vol types.VolumeName) (string, error) {
+	var node string
+	err := dm.CallRemote(ctx, "DotmeshRPC.GetNodeForVolume", vol, &node)
+	if err != nil {
+		return "", err
+	}
+	return node, nil
+}
+
+// GetAllVolumeLocations maps the filesystem id of every volume and branch
+// the user can see to the node holding its master copy.
+func (dm *DotmeshAPI) GetAllVolumeLocations(ctx context.Context) (map[string]string, error) {
+	locations := map[string]string{}
+	err := dm.CallRemote(ctx, "DotmeshRPC.GetAllVolumeLocations", struct{}{}, &locations)
+	if err != nil {
+		return nil, err
+	}
+	return locations, nil
+}
+
+// CompareVolumes compares leftBranch of left with rightBranch of right,
+// typically a volume's branch and the same branch of a fork of it: which
+// commit they last had in common, and the commits each has had since.
+func (dm *DotmeshAPI) CompareVolumes(ctx context.Context, left, right types.VolumeName, leftBranch, rightBranch string) (*types.VolumeComparison, error) {
+	var comparison types.VolumeComparison
+	err := dm.CallRemote(ctx, "DotmeshRPC.CompareVolumes", types.CompareVolumesRequest{
+		Left:        left,
+		LeftBranch:  deMasterify(leftBranch),
+		Right:       right,
+		RightBranch: deMasterify(rightBranch),
+	}, &comparison)
+	if err != nil {
+		return nil, err
+	}
+	return &comparison, nil
+}
+
+// ListStashes lists the branches of vol that pulls and pushes with
+// StashDivergence have moved diverged commits to, oldest first.
+func (dm *DotmeshAPI) ListStashes(ctx context.Context, vol types.VolumeName) ([]types.StashEntry, error) {
+	var stashes []types.StashEntry
+	err := dm.CallRemote(ctx, "DotmeshRPC.ListStashes", vol, &stashes)
+	if err != nil {
+		return nil, err
+	}
+	return stashes, nil
+}
+
 func (dm *DotmeshAPI) SwitchVolume(volumeName string) error {
 	return dm.setCurrentVolume(volumeName)
 }
 
+// CurrentBranch is the branch of volumeName the user last switched to, or
+// the volume's default branch if they haven't.
 func (dm *DotmeshAPI) CurrentBranch(volumeName string) (string, error) {
-	return dm.Configuration.CurrentBranchFor(volumeName)
+	if branch, ok := dm.Configuration.SelectedBranchFor(volumeName); ok {
+		return branch, nil
+	}
+	namespace, name, err := ParseNamespacedVolume(volumeName)
+	if err != nil {
+		return "", err
+	}
+	return dm.GetDefaultBranch(context.Background(), types.VolumeName{Namespace: namespace, Name: name})
+}
+
+// CurrentBranchFrom is CurrentBranch, but takes the volume's default branch
+// from defaults, as returned by DefaultBranches, rather than asking the
+// server. Use it when looking up the current branch of many volumes.
+func (dm *DotmeshAPI) CurrentBranchFrom(volumeName string, defaults map[string]map[string]string) (string, error) {
+	if branch, ok := dm.Configuration.SelectedBranchFor(volumeName); ok {
+		return branch, nil
+	}
+	namespace, name, err := ParseNamespacedVolume(volumeName)
+	if err != nil {
+		return "", err
+	}
+	if branch, ok := defaults[namespace][name]; ok && branch != "" {
+		return branch, nil
+	}
+	return DefaultBranch, nil
+}
+
+// DefaultBranches returns the default branch of every volume the user can
+// see, by namespace and then name, in one call. Volumes whose default is
+// DefaultBranch are left out, as are all volumes on servers too old to have
+// default branches.
+func (dm *DotmeshAPI) DefaultBranches(ctx context.Context) (map[string]map[string]string, error) {
+	defaults := map[string]map[string]string{}
+	err := dm.CallRemote(ctx, "DotmeshRPC.DefaultBranches", struct{}{}, &defaults)
+	if isMethodNotFound(err) {
+		return map[string]map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return defaults, nil
+}
+
+// SetDefaultBranch makes branch the one used for vol when the user hasn't
+// switched to another.
+func (dm *DotmeshAPI) SetDefaultBranch(ctx context.Context, vol types.VolumeName, branch string) error {
+	if dm.DryRun {
+		return dm.dryRun("made %s the default branch of %s", branch, vol)
+	}
+	var result bool
+	return dm.CallRemote(ctx, "DotmeshRPC.SetDefaultBranch", types.SetDefaultBranchRequest{
+		Name:   vol,
+		Branch: deMasterify(branch),
+	}, &result)
+}
+
+// GetDefaultBranch returns the default branch of vol, which is DefaultBranch
+// unless SetDefaultBranch has been used, or the server is too old to have
+// default branches.
+func (dm *DotmeshAPI) GetDefaultBranch(ctx context.Context, vol types.VolumeName) (string, error) {
+	var branch string
+	err := dm.CallRemote(ctx, "DotmeshRPC.GetDefaultBranch", vol, &branch)
+	if isMethodNotFound(err) {
+		return DefaultBranch, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if branch == "" {
+		return DefaultBranch, nil
+	}
+	return branch, nil
+}
+
+// ListBranchesWithInfo lists every branch of vol with its latest commit, in
+// one call. The default branch comes first, then the rest by name.
+func (dm *DotmeshAPI) ListBranchesWithInfo(ctx context.Context, vol types.VolumeName) ([]types.BranchInfo, error) {
+	var branches []types.BranchInfo
+	err := dm.CallRemote(ctx, "DotmeshRPC.BranchesWithInfo", vol, &branches)
+	if err != nil {
+		return nil, err
+	}
+	return branches, nil
 }
 
 func (dm *DotmeshAPI) AllBranches(volumeName string) ([]string, error) {
@@ -530,11 +1478,26 @@ func (dm *DotmeshAPI) AllBranches(volumeName string) ([]string, error) {
 	err = dm.CallRemote(
 		context.Background(), "DotmeshRPC.Branches", types.VolumeName{namespace, name}, &branches,
 	)
+	if err != nil {
+		return branches, err
+	}
 	// the "main" filesystem (topLevelFilesystemId) is the master branch
 	// (DEFAULT_BRANCH)
 	branches = append(branches, DefaultBranch)
 	sort.Strings(branches)
-	return branches, err
+
+	// the volume's default branch comes first
+	defaultBranch, err := dm.GetDefaultBranch(context.Background(), types.VolumeName{Namespace: namespace, Name: name})
+	if err != nil {
+		return branches, err
+	}
+	result := []string{defaultBranch}
+	for _, branch := range branches {
+		if branch != defaultBranch {
+			result = append(result, branch)
+		}
+	}
+	return result, nil
 }
 
 func (dm *DotmeshAPI) GetFsId(namespace, name, branch string) (string, error) {
@@ -569,6 +1532,9 @@ func (dm *DotmeshAPI) BranchInfo(namespace, name, branch string) (types.DotmeshV
 }
 
 func (dm *DotmeshAPI) ForceBranchMaster(namespace, name, branch, newMaster string) error {
+	if dm.DryRun {
+		return dm.dryRun("made %s the master of %s/%s@%s", newMaster, namespace, name, branch)
+	}
 	var fsId string
 	err := dm.CallRemote(
 		context.Background(), "DotmeshRPC.Lookup", struct{ Namespace, Name, Branch string }{
@@ -662,6 +1628,91 @@ func (dm *DotmeshAPI) CommitWithStruct(args types.CommitArgs) (string, error) {
 	return result, err
 }
 
+// MergeCommitMetadata sets the keys in extraMeta in an existing commit's
+// metadata, overwriting any values they already have and leaving the other
+// keys as they were.
+func (dm *DotmeshAPI) MergeCommitMetadata(ctx context.Context, namespace, name, branch, commitID string, extraMeta map[string]string) error {
+	return dm.updateCommitMetadata(ctx, types.UpdateCommitMetadataRequest{
+		Namespace: namespace,
+		Name:      name,
+		Branch:    deMasterify(branch),
+		CommitId:  commitID,
+		Metadata:  extraMeta,
+	})
+}
+
+// DeleteCommitMetadataKey removes key from an existing commit's metadata.
+func (dm *DotmeshAPI) DeleteCommitMetadataKey(ctx context.Context, namespace, name, branch, commitID, key string) error {
+	return dm.updateCommitMetadata(ctx, types.UpdateCommitMetadataRequest{
+		Namespace:  namespace,
+		Name:       name,
+		Branch:     deMasterify(branch),
+		CommitId:   commitID,
+		DeleteKeys: []string{key},
+	})
+}
+
+func (dm *DotmeshAPI) updateCommitMetadata(ctx context.Context, req types.UpdateCommitMetadataRequest) error {
+	err := req.Validate()
+	if err != nil {
+		return err
+	}
+	var result bool
+	return dm.CallRemote(ctx, "DotmeshRPC.UpdateCommitMetadata", req, &result)
+}
+
+// SquashCommits replaces the commits of branch of vol from fromCommitID to
+// toCommitID, inclusive, with one commit that has toCommitID's data and
+// newMessage as its message, and returns the new commit's id. The branch's
+// history is rewritten, so pushing it afterwards needs forcing. Volumes with
+// replicas on other nodes can't be squashed.
+func (dm *DotmeshAPI) SquashCommits(ctx context.Context, vol types.VolumeName, branch, fromCommitID, toCommitID, newMessage string) (string, error) {
+	if dm.DryRun {
+		return "", dm.dryRun("squashed commits %s to %s of %s", fromCommitID, toCommitID, vol)
+	}
+	var commitID string
+	err := dm.CallRemote(ctx, "DotmeshRPC.Squash", types.SquashRequest{
+		Namespace:    vol.Namespace,
+		Name:         vol.Name,
+		Branch:       deMasterify(branch),
+		FromCommitId: fromCommitID,
+		ToCommitId:   toCommitID,
+		Message:      newMessage,
+	}, &commitID)
+	if hasErrorCode(err, types.ErrCodeOlderCommit) {
+		return "", fmt.Errorf("%w: %s", ErrCannotSquashToOlderCommit, err)
+	}
+	if err != nil {
+		return "", err
+	}
+	return commitID, nil
+}
+
+// SearchCommits is ListCommits, but only returning the commits that match
+// query. The query must have at least one filter set, use ListCommits to get
+// every commit.
+func (dm *DotmeshAPI) SearchCommits(ctx context.Context, namespace, name, branch string, query types.CommitQuery) ([]types.Snapshot, error) {
+	if query.IsEmpty() {
+		return nil, fmt.Errorf("Please specify something to search for, or use ListCommits to get every commit")
+	}
+	err := query.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []types.Snapshot
+	err = dm.CallRemote(ctx, "DotmeshRPC.SearchCommits", types.SearchCommitsRequest{
+		Namespace: namespace,
+		Name:      name,
+		Branch:    deMasterify(branch),
+		Query:     query,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 func (dm *DotmeshAPI) ListCommits(activeVolumeName, activeBranch string) ([]types.Snapshot, error) {
 	var result []types.Snapshot
 
@@ -696,6 +1747,49 @@ func (dm *DotmeshAPI) CommitsById(dotID string) ([]types.Snapshot, error) {
 	return commits, err
 }
 
+// TagCommit gives commitID on branch of a volume a name, which can be used
+// in place of the commit's id.
+func (dm *DotmeshAPI) TagCommit(ctx context.Context, namespace, name, branch, commitID, tag string) error {
+	if dm.DryRun {
+		return dm.dryRun("tagged %s/%s@%s commit %s as %s", namespace, name, branch, commitID, tag)
+	}
+	var result bool
+	return dm.CallRemote(ctx, "DotmeshRPC.TagCommit", types.TagCommitRequest{
+		Namespace: namespace,
+		Name:      name,
+		Branch:    deMasterify(branch),
+		CommitId:  commitID,
+		Tag:       tag,
+	}, &result)
+}
+
+func (dm *DotmeshAPI) UntagCommit(ctx context.Context, namespace, name, branch, tag string) error {
+	if dm.DryRun {
+		return dm.dryRun("removed tag %s from %s/%s@%s", tag, namespace, name, branch)
+	}
+	var result bool
+	return dm.CallRemote(ctx, "DotmeshRPC.UntagCommit", types.TagCommitRequest{
+		Namespace: namespace,
+		Name:      name,
+		Branch:    deMasterify(branch),
+		Tag:       tag,
+	}, &result)
+}
+
+// ResolveTag returns the id of the commit tag is on.
+func (dm *DotmeshAPI) ResolveTag(ctx context.Context, namespace, name, branch, tag string) (string, error) {
+	var commitID string
+	err := dm.CallRemote(ctx, "DotmeshRPC.ResolveTag", types.TagCommitRequest{
+		Namespace: namespace,
+		Name:      name,
+		Branch:    deMasterify(branch),
+		Tag:       tag,
+	}, &commitID)
+	return commitID, err
+}
+
+// findCommit turns ref into a commit id: ref can be HEAD followed by any
+// number of ^s, a tag, or already a commit id.
 func (dm *DotmeshAPI) findCommit(ref, volumeName, branchName string) (string, error) {
 	hatRegex := regexp.MustCompile(`^HEAD\^*$`)
 	if hatRegex.MatchString(ref) {
@@ -712,11 +1806,38 @@ func (dm *DotmeshAPI) findCommit(ref, volumeName, branchName string) (string, er
 			return "", fmt.Errorf("Commits don't go back that far")
 		}
 		return cs[i].Id, nil
+	} else if !validator.IsUUID(ref) && validator.IsValidTagName(ref) == nil {
+		namespace, name, err := ParseNamespacedVolume(volumeName)
+		if err != nil {
+			return "", err
+		}
+		return dm.ResolveTag(context.Background(), namespace, name, branchName, ref)
 	} else {
 		return ref, nil
 	}
 }
 
+// findLocalCommit is findCommit, but checks the commit is on the branch.
+func (dm *DotmeshAPI) findLocalCommit(ref, volumeName, branchName string) (string, error) {
+	commitId, err := dm.findCommit(ref, volumeName, branchName)
+	if err != nil {
+		return "", err
+	}
+	commits, err := dm.ListCommits(volumeName, branchName)
+	if err != nil {
+		return "", err
+	}
+	for _, commit := range commits {
+		if commit.Id == commitId {
+			return commitId, nil
+		}
+	}
+	if branchName == "" {
+		branchName = DefaultBranch
+	}
+	return "", fmt.Errorf("Commit %s isn't on branch %s of %s", ref, branchName, volumeName)
+}
+
 func (dm *DotmeshAPI) ResetCurrentVolume(commit string) error {
 	activeVolume, err := dm.CurrentVolume()
 	if err != nil {
@@ -741,6 +1862,9 @@ func (dm *DotmeshAPI) ResetCurrentVolume(commit string) error {
 	if err != nil {
 		return err
 	}
+	if dm.DryRun {
+		return dm.dryRun("reset %s@%s to %s", activeVolume, activeBranch, commitId)
+	}
 	err = dm.CallRemote(
 		context.Background(),
 		"DotmeshRPC.Rollback",
@@ -758,6 +1882,38 @@ func (dm *DotmeshAPI) ResetCurrentVolume(commit string) error {
 	return nil
 }
 
+// DryRunRollback returns the commits on the current branch of the current
+// volume that resetting it to commitRef (as ResetCurrentVolume would) would
+// destroy, oldest first, without resetting anything.
+func (dm *DotmeshAPI) DryRunRollback(ctx context.Context, commitRef string) ([]types.Snapshot, error) {
+	activeVolume, err := dm.CurrentVolume()
+	if err != nil {
+		return nil, err
+	}
+	if activeVolume == "" {
+		return nil, fmt.Errorf("No current volume is selected. List them with 'dm list' and select one with 'dm switch'.")
+	}
+	activeBranch, err := dm.CurrentBranch(activeVolume)
+	if err != nil {
+		return nil, err
+	}
+
+	commitId, err := dm.findCommit(commitRef, activeVolume, activeBranch)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := dm.ListCommits(activeVolume, activeBranch)
+	if err != nil {
+		return nil, err
+	}
+	for i, commit := range commits {
+		if commit.Id == commitId {
+			return commits[i+1:], nil
+		}
+	}
+	return nil, fmt.Errorf("Commit %s isn't on %s@%s", commitId, activeVolume, activeBranch)
+}
+
 type Container struct {
 	Id   string
 	Name string
@@ -800,6 +1956,26 @@ func (dm *DotmeshAPI) AllVolumesWithContainers() ([]DotmeshVolumeAndContainers,
 	return result, nil
 }
 
+// AllVolumesWithStats lists every volume, sorted by name, with the space each
+// one uses, in one RPC.
+func (dm *DotmeshAPI) AllVolumesWithStats(ctx context.Context) ([]types.DotmeshVolumeWithStats, error) {
+	filesystems := map[string]map[string]types.DotmeshVolumeWithStats{}
+	err := dm.CallRemote(ctx, "DotmeshRPC.ListWithStats", nil, &filesystems)
+	if err != nil {
+		return nil, err
+	}
+	result := []types.DotmeshVolumeWithStats{}
+	for _, volumesInNamespace := range filesystems {
+		for _, v := range volumesInNamespace {
+			result = append(result, v)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name.StringWithoutAdmin() < result[j].Name.StringWithoutAdmin()
+	})
+	return result, nil
+}
+
 func (dm *DotmeshAPI) RelatedContainers(volumeName types.VolumeName, branch string) ([]Container, error) {
 	result := []Container{}
 	err := dm.CallRemote(
@@ -818,8 +1994,66 @@ func (dm *DotmeshAPI) RelatedContainers(volumeName types.VolumeName, branch stri
 	return result, nil
 }
 
+// GetContainerMounts lists the volumes the running container containerID
+// (an id, an id prefix of at least 12 characters, or a name) has mounted,
+// e.g. so that they can be committed before it's stopped.
+func (dm *DotmeshAPI) GetContainerMounts(ctx context.Context, containerID string) ([]types.ContainerMount, error) {
+	var result []types.ContainerMount
+	err := dm.CallRemote(ctx, "DotmeshRPC.GetContainerMounts", containerID, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// warnForcePush warns, on ForcePushWarningOut, that a forced push is about to
+// destroy commits on the remote, listing them if it can find out which they
+// are.
+func (dm *DotmeshAPI) warnForcePush(peer, localNamespace, localVolume, localBranchName, remoteNamespace, remoteVolume, remoteBranchName string) {
+	out := dm.ForcePushWarningOut
+	fmt.Fprintf(out, "WARNING: force-pushing to %s:%s/%s will DELETE any commits there that aren't on %s/%s here.\n",
+		peer, remoteNamespace, remoteVolume, localNamespace, localVolume)
+
+	remoteClient, err := dm.clusterFromRemote(peer)
+	if err != nil {
+		return
+	}
+	remoteCommits, err := NewDotmeshAPIFromClient(remoteClient, dm.verbose()).ListCommits(remoteNamespace+"/"+remoteVolume, remoteBranchName)
+	if err != nil {
+		// Most likely it doesn't exist yet, so there's nothing to lose
+		return
+	}
+	localCommits, err := dm.ListCommits(localNamespace+"/"+localVolume, localBranchName)
+	if err != nil {
+		return
+	}
+	diverged := divergedCommits(localCommits, remoteCommits)
+	if len(diverged) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "The remote's %d diverged commit(s) will be overwritten:\n", len(diverged))
+	for _, commit := range diverged {
+		fmt.Fprintf(out, "  %s %s\n", commit.Id, commit.Metadata["message"])
+	}
+}
+
+// divergedCommits returns the commits in remote since the latest one that's
+// also in local.
+func divergedCommits(local, remote []types.Snapshot) []types.Snapshot {
+	ours := map[string]bool{}
+	for _, commit := range local {
+		ours[commit.Id] = true
+	}
+	for i := len(remote) - 1; i >= 0; i-- {
+		if ours[remote[i].Id] {
+			return remote[i+1:]
+		}
+	}
+	return remote
+}
+
 func (dm *DotmeshAPI) GetTransfer(transferId string) (TransferPollResult, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), RPCTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), dm.rpcTimeout("DotmeshRPC.GetTransfer"))
 	defer cancel()
 	return dm.GetTransferWithContext(ctx, transferId)
 }
@@ -832,6 +2066,22 @@ func (dm *DotmeshAPI) GetTransferWithContext(ctx context.Context, transferId str
 	return result, err
 }
 
+// ListTransfers returns the server's record of past transfers, finished or
+// failed, that match filter, oldest first. The server only keeps the most
+// recent ones.
+func (dm *DotmeshAPI) ListTransfers(ctx context.Context, filter types.TransferFilter) ([]types.TransferRecord, error) {
+	err := filter.Validate()
+	if err != nil {
+		return nil, err
+	}
+	var result []types.TransferRecord
+	err = dm.CallRemote(ctx, "DotmeshRPC.ListTransfers", filter, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 type PollTransferInternalResult struct {
 	result TransferPollResult
 	err    error
@@ -885,7 +2135,7 @@ func (dm *DotmeshAPI) UpdateBar(result TransferPollResult, err error, started bo
 
 func (dm *DotmeshAPI) PollTransfer(transferId string, out io.Writer, callback func(result TransferPollResult, err error, started bool) bool) error {
 
-	logger := log.WithField("transferId", transferId)
+	logger := dm.log().WithField("transferId", transferId)
 
 	started := false
 
@@ -894,7 +2144,7 @@ func (dm *DotmeshAPI) PollTransfer(transferId string, out io.Writer, callback fu
 
 		var result PollTransferInternalResult
 
-		ctx, cancel := context.WithTimeout(context.Background(), RPCTimeout)
+		ctx, cancel := context.WithTimeout(context.Background(), dm.rpcTimeout("DotmeshRPC.GetTransfer"))
 		result.result, result.err = dm.GetTransferWithContext(ctx, transferId)
 
 		if result.err != nil {
@@ -943,70 +2193,28 @@ func (dm *DotmeshAPI) PollTransfer(transferId string, out io.Writer, callback fu
 	}
 }
 
-/*
-
-pull
-----
-
-  to   from
-  O*<-----O
-
-push
-----
-
-  from   to
-  O*----->O
-
-* = current
-
-*/
-
-// attempt to get the latest commits in filesystemId (which may be a branch)
-// from fromRemote to toRemote as a one-off.
-//
-// the reason for supporting both directions is that the "current" is often
-// behind NAT from its peer, and so it must initiate the connection.
-func (dm *DotmeshAPI) RequestTransfer(
-	direction, peer,
-	localFilesystemName, localBranchName,
-	remoteFilesystemName, remoteBranchName string,
-	prefixes []string,
-	stashDivergence bool,
-) (string, error) {
-	connectionInitiator := dm.Configuration.CurrentRemote
-
-	debugMode := os.Getenv("DEBUG_MODE") != ""
-
-	if debugMode {
-		fmt.Printf("[DEBUG RequestTransfer] dir=%s peer=%s lfs=%s lb=%s rfs=%s rb=%s\n",
-			direction, peer,
-			localFilesystemName, localBranchName,
-			remoteFilesystemName, remoteBranchName)
-	}
-
-	var err error
-
-	remote, err := dm.Configuration.GetRemote(peer)
-	if err != nil {
-		return "", err
-	}
-
-	// Let's replace any missing things with defaults.
-	// The defaults depend on whether we're pushing or pulling.
-	if direction == "push" {
-		// We are pushing, so if no local filesystem/branch is
-		// specified, take the current one.
-		if localFilesystemName == "" {
-			localFilesystemName, err = dm.Configuration.CurrentVolume()
-			if err != nil {
-				return "", err
-			}
-		}
+// transferVolumeNames fills in the defaults RequestTransfer uses for whichever
+// of the local and remote volume and branch names weren't given.
+func (dm *DotmeshAPI) transferVolumeNames(
+	direction, peer string, remote Remote,
+	localFilesystemName, localBranchName, remoteFilesystemName string,
+) (localNamespace, localVolume, localBranch, remoteNamespace, remoteVolume string, err error) {
+	// Let's replace any missing things with defaults.
+	// The defaults depend on whether we're pushing or pulling.
+	if direction == "push" {
+		// We are pushing, so if no local filesystem/branch is
+		// specified, take the current one.
+		if localFilesystemName == "" {
+			localFilesystemName, err = dm.Configuration.CurrentVolume()
+			if err != nil {
+				return "", "", "", "", "", err
+			}
+		}
 
 		if localBranchName == "" {
-			localBranchName, err = dm.Configuration.CurrentBranch()
+			localBranchName, err = dm.CurrentBranch(localFilesystemName)
 			if err != nil {
-				return "", err
+				return "", "", "", "", "", err
 			}
 		}
 	} else if direction == "pull" {
@@ -1017,19 +2225,18 @@ func (dm *DotmeshAPI) RequestTransfer(
 		if localFilesystemName == "" && remoteFilesystemName != "" {
 			_, localFilesystemName, err = ParseNamespacedVolume(remoteFilesystemName)
 			if err != nil {
-				return "", err
+				return "", "", "", "", "", err
 			}
 		}
 	}
 
 	// Split the local volume name's namespace out
-	localNamespace, localVolume, err := ParseNamespacedVolume(localFilesystemName)
+	localNamespace, localVolume, err = ParseNamespacedVolume(localFilesystemName)
 	if err != nil {
-		return "", err
+		return "", "", "", "", "", err
 	}
 
 	// Guess defaults for the remote filesystem
-	var remoteNamespace, remoteVolume string
 	if remoteFilesystemName == "" {
 		// No remote specified. Do we already have a default configured?
 		defaultRemoteNamespace, defaultRemoteVolume, ok := dm.Configuration.DefaultRemoteVolumeFor(peer, localNamespace, localVolume)
@@ -1048,13 +2255,72 @@ func (dm *DotmeshAPI) RequestTransfer(
 		// Default namespace for remote volume is the username on this remote
 		remoteNamespace, remoteVolume, err = ParseNamespacedVolumeWithDefault(remoteFilesystemName, remote.DefaultNamespace())
 		if err != nil {
-			return "", err
+			return "", "", "", "", "", err
 		}
 	}
+	return localNamespace, localVolume, localBranchName, remoteNamespace, remoteVolume, nil
+}
+
+/*
+
+pull
+----
+
+  to   from
+  O*<-----O
+
+push
+----
+
+  from   to
+  O*----->O
+
+* = current
+
+*/
+
+// attempt to get the latest commits in filesystemId (which may be a branch)
+// from fromRemote to toRemote as a one-off.
+//
+// the reason for supporting both directions is that the "current" is often
+// behind NAT from its peer, and so it must initiate the connection.
+func (dm *DotmeshAPI) RequestTransfer(
+	direction, peer,
+	localFilesystemName, localBranchName,
+	remoteFilesystemName, remoteBranchName string,
+	prefixes []string,
+	stashDivergence bool,
+) (string, error) {
+	connectionInitiator := dm.Configuration.CurrentRemote
+
+	logger := dm.log().WithFields(log.Fields{
+		"direction": direction,
+		"peer":      peer,
+	})
+	logger.WithFields(log.Fields{
+		"local_filesystem":  localFilesystemName,
+		"local_branch":      localBranchName,
+		"remote_filesystem": remoteFilesystemName,
+		"remote_branch":     remoteBranchName,
+	}).Debug("[RequestTransfer] requesting transfer")
+
+	var err error
+
+	remote, err := dm.Configuration.GetRemote(peer)
+	if err != nil {
+		return "", err
+	}
+
+	localNamespace, localVolume, localBranchName, remoteNamespace, remoteVolume, err := dm.transferVolumeNames(
+		direction, peer, remote, localFilesystemName, localBranchName, remoteFilesystemName,
+	)
+	if err != nil {
+		return "", err
+	}
 
 	// Remember default remote if there isn't already one
 	_, _, ok := dm.Configuration.DefaultRemoteVolumeFor(peer, localNamespace, localVolume)
-	if !ok {
+	if !ok && !dm.DryRun {
 		dm.Configuration.SetDefaultRemoteVolumeFor(peer, localNamespace, localVolume, remoteNamespace, remoteVolume)
 	}
 
@@ -1070,21 +2336,29 @@ func (dm *DotmeshAPI) RequestTransfer(
 	}
 
 	if direction == "push" {
-		fmt.Printf("Pushing %s/%s to %s:%s/%s\n",
+		dm.printf("Pushing %s/%s to %s:%s/%s\n",
 			localNamespace, localVolume,
 			peer,
 			remoteNamespace, remoteVolume,
 		)
 	} else {
-		fmt.Printf("Pulling %s/%s from %s:%s/%s\n",
+		dm.printf("Pulling %s/%s from %s:%s/%s\n",
 			localNamespace, localVolume,
 			peer,
 			remoteNamespace, remoteVolume,
 		)
 	}
 
+	var targetCommit string
+	if dm.PushTargetCommit != "" && direction == "push" {
+		targetCommit, err = dm.findLocalCommit(dm.PushTargetCommit, localNamespace+"/"+localVolume, localBranchName)
+		if err != nil {
+			return "", err
+		}
+	}
+
 	// connect to connectionInitiator
-	client, err := dm.Configuration.ClusterFromRemote(connectionInitiator, dm.verbose)
+	client, err := dm.clusterFromRemote(connectionInitiator)
 	if err != nil {
 		return "", err
 	}
@@ -1106,13 +2380,39 @@ func (dm *DotmeshAPI) RequestTransfer(
 			RemoteNamespace:  remoteNamespace,
 			RemoteName:       remoteVolume,
 			RemoteBranchName: deMasterify(remoteBranchName),
+			TargetCommit:     targetCommit,
 			StashDivergence:  stashDivergence,
-			// TODO add TargetSnapshot here, to support specifying "push to a given
-			// snapshot" rather than just "push all snapshots up to the latest"
+			Force:            dm.ForcePush && direction == "push",
+			Compression:      dm.TransferCompression,
 		}
 
-		if debugMode {
-			fmt.Printf("[DEBUG] TransferRequest: %#v\n", transferRequest)
+		// not the whole request, which has the remote's API key in
+		logger.WithFields(log.Fields{
+			"remote_host":      transferRequest.Peer,
+			"remote_port":      transferRequest.Port,
+			"remote_user":      transferRequest.User,
+			"stash_divergence": transferRequest.StashDivergence,
+			"force":            transferRequest.Force,
+			"compression":      transferRequest.Compression,
+		}).Debug("[RequestTransfer] dotmesh transfer request")
+
+		if transferRequest.Force && dm.ForcePushWarningOut != nil {
+			dm.warnForcePush(peer, localNamespace, localVolume, localBranchName, remoteNamespace, remoteVolume, remoteBranchName)
+		}
+
+		if dm.DryRun || dm.TransferEstimateOut != nil {
+			estimateRequest := transferRequest
+			estimateRequest.DryRun = true
+			var estimate types.TransferEstimate
+			err = client.CallRemote(context.Background(),
+				"DotmeshRPC.EstimateTransfer", estimateRequest, &estimate)
+			if err != nil {
+				return "", err
+			}
+			if dm.DryRun {
+				return "", dm.dryRun("%sed %s", direction, describeTransferEstimate(estimate))
+			}
+			fmt.Fprintf(dm.TransferEstimateOut, "Estimated %s: %s\n", direction, describeTransferEstimate(estimate))
 		}
 
 		transferId, err = dm.Transfer(transferRequest)
@@ -1136,13 +2436,18 @@ func (dm *DotmeshAPI) RequestTransfer(
 				LocalName:       localVolume,
 				LocalBranchName: deMasterify(localBranchName),
 				RemoteName:      remoteVolume,
-				// TODO add TargetSnapshot here, to support specifying "push to a given
-				// snapshot" rather than just "push all snapshots up to the latest"
+				TargetCommit:    targetCommit,
 				// todo is stash divergence needed here?? (issue dotscience-agent#88)
 			}
 
-			if debugMode {
-				fmt.Printf("[DEBUG] S3TransferRequest: %#v\n", transferRequest)
+			logger.WithFields(log.Fields{
+				"endpoint": transferRequest.Endpoint,
+				"bucket":   transferRequest.RemoteName,
+				"prefixes": transferRequest.Prefixes,
+			}).Debug("[RequestTransfer] S3 transfer request")
+
+			if dm.DryRun {
+				return "", dm.dryRun("%sed %s/%s, S3 bucket %s", direction, localNamespace, localVolume, remoteVolume)
 			}
 
 			err = client.CallRemote(context.Background(),
@@ -1150,6 +2455,35 @@ func (dm *DotmeshAPI) RequestTransfer(
 			if err != nil {
 				return "", err
 			}
+		} else if sftpRemote, ok := remote.(*SFTPRemote); ok {
+			privateKey, err := ioutil.ReadFile(sftpRemote.IdentityFile)
+			if err != nil {
+				return "", fmt.Errorf("Unable to read identity file for remote '%s': %s", peer, err)
+			}
+			transferRequest := types.SFTPTransferRequest{
+				Hostname:        sftpRemote.Hostname,
+				Port:            sftpRemote.Port,
+				Username:        sftpRemote.Username,
+				PrivateKey:      string(privateKey),
+				HostKey:         sftpRemote.HostKey,
+				RemotePath:      path.Join(sftpRemote.RemotePath, remoteVolume),
+				Direction:       direction,
+				LocalNamespace:  localNamespace,
+				LocalName:       localVolume,
+				LocalBranchName: deMasterify(localBranchName),
+			}
+
+			logger.WithField("request", transferRequest.String()).Debug("[RequestTransfer] SFTP transfer request")
+
+			if dm.DryRun {
+				return "", dm.dryRun("%sed %s/%s, remote path %s:%s", direction, localNamespace, localVolume, sftpRemote.Hostname, transferRequest.RemotePath)
+			}
+
+			err = client.CallRemote(context.Background(),
+				"DotmeshRPC.SFTPTransfer", transferRequest, &transferId)
+			if err != nil {
+				return "", err
+			}
 		} else {
 			return "", fmt.Errorf("Unknown remote type %#v\n", remote)
 		}
@@ -1158,18 +2492,161 @@ func (dm *DotmeshAPI) RequestTransfer(
 
 }
 
+// CloneFromRemote makes a copy of the master branch of remoteVolume on peer,
+// as git clone does: remoteVolume is in the user's namespace on peer unless
+// it says otherwise, and localVolume defaults to its name without the
+// namespace. The local volume is created if it doesn't exist, and the
+// transfer waited for; peer's remoteVolume then becomes localVolume's
+// default remote volume, for later pushes and pulls.
+func (dm *DotmeshAPI) CloneFromRemote(ctx context.Context, peer, remoteVolume, localVolume string) error {
+	remote, err := dm.Configuration.GetRemote(peer)
+	if err != nil {
+		return err
+	}
+	remoteNamespace, remoteName, err := ParseNamespacedVolumeWithDefault(remoteVolume, remote.DefaultNamespace())
+	if err != nil {
+		return err
+	}
+	if localVolume == "" {
+		localVolume = remoteName
+	}
+	localNamespace, localName, err := ParseNamespacedVolume(localVolume)
+	if err != nil {
+		return err
+	}
+	localVolume = localNamespace + "/" + localName
+
+	if !dm.DryRun {
+		exists, err := dm.VolumeExists(localVolume)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			_, err = dm.NewVolumeFromStruct(types.VolumeName{Namespace: localNamespace, Name: localName})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	transferId, err := dm.RequestTransfer(
+		"pull", peer,
+		localVolume, DefaultBranch,
+		remoteNamespace+"/"+remoteName, DefaultBranch,
+		nil, false,
+	)
+	if err != nil {
+		return err
+	}
+	err = dm.waitForTransfer(ctx, transferId)
+	if err != nil {
+		return err
+	}
+	return dm.Configuration.SetDefaultRemoteVolumeFor(peer, localNamespace, localName, remoteNamespace, remoteName)
+}
+
 func (dm *DotmeshAPI) Transfer(request types.TransferRequest) (string, error) {
+	if dm.DryRun || request.DryRun {
+		estimate, err := dm.GetTransferEstimate(context.Background(), request)
+		if err != nil {
+			return "", err
+		}
+		return "", dm.dryRun("%sed %s", request.Direction, describeTransferEstimate(*estimate))
+	}
 	var transferId string
 	err := dm.CallRemote(context.Background(), "DotmeshRPC.Transfer", request, &transferId)
 	return transferId, err
 }
 
+// GetTransferEstimate asks the server how many commits and bytes Transfer
+// would move for req, without starting it. The server sizes the zfs send
+// streams with zfs send -nP, so nothing is actually sent.
+func (dm *DotmeshAPI) GetTransferEstimate(ctx context.Context, req types.TransferRequest) (*types.TransferEstimate, error) {
+	var estimate types.TransferEstimate
+	req.DryRun = true
+	err := dm.CallRemote(ctx, "DotmeshRPC.EstimateTransfer", req, &estimate)
+	if err != nil {
+		return nil, err
+	}
+	return &estimate, nil
+}
+
+func describeTransferEstimate(estimate types.TransferEstimate) string {
+	size := fmt.Sprintf("%.2fMiB", float64(estimate.EstimatedBytes)/(1024*1024))
+	if estimate.BytesIsUpperBound {
+		size = "at most " + size
+	}
+	return fmt.Sprintf("%d commits (%s)", estimate.CommitCount, size)
+}
+
 func (dm *DotmeshAPI) S3Transfer(request types.S3TransferRequest) (string, error) {
+	if dm.DryRun {
+		return "", dm.dryRun("%sed %s/%s, S3 bucket %s", request.Direction, request.LocalNamespace, request.LocalName, request.RemoteName)
+	}
 	var transferId string
 	err := dm.CallRemote(context.Background(), "DotmeshRPC.S3Transfer", request, &transferId)
 	return transferId, err
 }
 
+func (dm *DotmeshAPI) SFTPTransfer(request types.SFTPTransferRequest) (string, error) {
+	if dm.DryRun {
+		return "", dm.dryRun("%sed %s/%s, remote path %s:%s", request.Direction, request.LocalNamespace, request.LocalName, request.Hostname, request.RemotePath)
+	}
+	var transferId string
+	err := dm.CallRemote(context.Background(), "DotmeshRPC.SFTPTransfer", request, &transferId)
+	return transferId, err
+}
+
+// GetTransferQueue lists the transfers running on, or waiting for, the
+// current remote. The admin user sees everyone's, other users their own.
+func (dm *DotmeshAPI) GetTransferQueue(ctx context.Context) ([]types.QueuedTransfer, error) {
+	var result []types.QueuedTransfer
+	err := dm.CallRemote(ctx, "DotmeshRPC.GetTransferQueue", struct{}{}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// CancelTransfer removes a transfer from the queue. Transfers that have
+// already started can't be cancelled.
+func (dm *DotmeshAPI) CancelTransfer(ctx context.Context, transferId string) error {
+	return dm.manageQueuedTransfer(ctx, "DotmeshRPC.CancelTransfer", "cancelled", transferId)
+}
+
+// PauseTransfer keeps a queued transfer from starting until it's resumed.
+func (dm *DotmeshAPI) PauseTransfer(ctx context.Context, transferId string) error {
+	return dm.manageQueuedTransfer(ctx, "DotmeshRPC.PauseTransfer", "paused", transferId)
+}
+
+func (dm *DotmeshAPI) ResumeTransfer(ctx context.Context, transferId string) error {
+	return dm.manageQueuedTransfer(ctx, "DotmeshRPC.ResumeTransfer", "resumed", transferId)
+}
+
+// SetTransferWebhook has the server POST the transfer's poll result to
+// webhookURL for each of events ("progress", "complete" and "error"; all of
+// them if events is empty), retrying failed deliveries. It fails if the URL
+// isn't at a public address, or can't be reached.
+func (dm *DotmeshAPI) SetTransferWebhook(ctx context.Context, transferId, webhookURL string, events []string) error {
+	if dm.DryRun {
+		return dm.dryRun("set a webhook on transfer %s to %s", transferId, webhookURL)
+	}
+	var result bool
+	return dm.CallRemote(ctx, "DotmeshRPC.SetTransferWebhook", types.TransferWebhookRequest{
+		TransferId: transferId,
+		URL:        webhookURL,
+		Events:     events,
+	}, &result)
+}
+
+func (dm *DotmeshAPI) manageQueuedTransfer(ctx context.Context, method, action, transferId string) error {
+	if dm.DryRun {
+		return dm.dryRun("%s transfer %s", action, transferId)
+	}
+	var result bool
+	return dm.CallRemote(ctx, method, transferId, &result)
+}
+
 func (dm *DotmeshAPI) IsUserPriveledged() bool {
 	err := dm.openClient()
 
@@ -1191,6 +2668,10 @@ type S3VolumeName struct {
 }
 
 func ParseNamespacedVolumeWithDefault(name, defaultNamespace string) (string, string, error) {
+	// The server separates namespaces and names with a colon in places
+	if strings.Contains(name, ":") {
+		return "", "", fmt.Errorf("Volume names can't contain colons: '%s'", name)
+	}
 	parts := strings.Split(name, "/")
 	switch len(parts) {
 	case 0: // name was empty
@@ -1213,22 +2694,16 @@ func (dm *DotmeshAPI) Diff(namespace, name string) ([]types.ZFSFileDiff, error)
 }
 
 func (dm *DotmeshAPI) DiffFromCommit(namespace, name, commitID string) ([]types.ZFSFileDiff, error) {
-	remoteCreds, err := dm.Configuration.CredsForRemote(dm.Configuration.CurrentRemote)
+	err := dm.openClient()
 	if err != nil {
 		return nil, err
 	}
 
-	var url string
-
-	if remoteCreds.Port == 0 {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		url, err = DeduceUrl(ctx, []string{remoteCreds.Hostname}, "external", remoteCreds.User, remoteCreds.ApiKey)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		url = "http://" + remoteCreds.Hostname + ":" + strconv.Itoa(remoteCreds.Port)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	url, err := dm.Client.serverURL(ctx)
+	cancel()
+	if err != nil {
+		return nil, err
 	}
 
 	// NB: commitID can be empty string, which means to diff from the latest
@@ -1245,9 +2720,9 @@ func (dm *DotmeshAPI) DiffFromCommit(namespace, name, commitID string) ([]types.
 			return nil, err
 		}
 	}
-	req.SetBasicAuth(remoteCreds.User, remoteCreds.ApiKey)
+	dm.Client.setAuth(req)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := dm.Client.httpClient().Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -1275,3 +2750,255 @@ func (dm *DotmeshAPI) LastModified(namespace, name string) (*types.LastModified,
 	err := dm.CallRemote(context.Background(), "DotmeshRPC.LastModified", &types.VolumeName{Namespace: namespace, Name: name}, &lastModified)
 	return &lastModified, err
 }
+
+// ShareVolume gives targetUser permission on vol, replacing whatever
+// permission they had before. Only the owner of vol can share it.
+func (dm *DotmeshAPI) ShareVolume(ctx context.Context, vol types.VolumeName, targetUser string, permission types.Permission) error {
+	var result bool
+	return dm.CallRemote(ctx, "DotmeshRPC.ShareVolume", types.ShareVolumeRequest{
+		Name:       vol,
+		User:       targetUser,
+		Permission: permission,
+	}, &result)
+}
+
+// RevokeVolumeShare stops sharing vol with targetUser.
+func (dm *DotmeshAPI) RevokeVolumeShare(ctx context.Context, vol types.VolumeName, targetUser string) error {
+	var result bool
+	return dm.CallRemote(ctx, "DotmeshRPC.RevokeVolumeShare", types.RevokeVolumeShareRequest{
+		Name: vol,
+		User: targetUser,
+	}, &result)
+}
+
+// GetVolumeACL lists the users vol has been shared with.
+func (dm *DotmeshAPI) GetVolumeACL(ctx context.Context, vol types.VolumeName) ([]types.ACLEntry, error) {
+	var result []types.ACLEntry
+	err := dm.CallRemote(ctx, "DotmeshRPC.GetVolumeACL", vol, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// CreateNamespace creates an empty namespace. There's no need to call this
+// before creating volumes, which create their namespace if need be.
+func (dm *DotmeshAPI) CreateNamespace(ctx context.Context, namespace string) error {
+	var result bool
+	return dm.CallRemote(ctx, "DotmeshRPC.CreateNamespace", namespace, &result)
+}
+
+// DeleteNamespace deletes a namespace, which must be empty unless force is
+// set, in which case all of its volumes are deleted first.
+func (dm *DotmeshAPI) DeleteNamespace(ctx context.Context, namespace string, force bool) error {
+	if dm.DryRun {
+		if force {
+			return dm.dryRun("deleted namespace %s and all of its volumes", namespace)
+		}
+		return dm.dryRun("deleted namespace %s", namespace)
+	}
+	var result bool
+	return dm.CallRemote(ctx, "DotmeshRPC.DeleteNamespace", types.DeleteNamespaceRequest{
+		Namespace: namespace,
+		Force:     force,
+	}, &result)
+}
+
+func (dm *DotmeshAPI) ListNamespaces(ctx context.Context) ([]types.Namespace, error) {
+	var result []types.Namespace
+	err := dm.CallRemote(ctx, "DotmeshRPC.ListNamespaces", struct{}{}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SetNamespaceQuota caps the total size of the volumes in namespace at
+// maxBytes, 0 removes the cap. Only the admin user can set quotas.
+func (dm *DotmeshAPI) SetNamespaceQuota(ctx context.Context, namespace string, maxBytes int64) error {
+	var result bool
+	return dm.CallRemote(ctx, "DotmeshRPC.SetNamespaceQuota", types.SetNamespaceQuotaRequest{
+		Namespace: namespace,
+		MaxBytes:  maxBytes,
+	}, &result)
+}
+
+// SetVolumeQuota caps the space vol's branches and their commits can use
+// between them at maxBytes, 0 removes the cap. Only the admin user can set
+// quotas.
+func (dm *DotmeshAPI) SetVolumeQuota(ctx context.Context, vol types.VolumeName, maxBytes int64) error {
+	var result bool
+	return dm.CallRemote(ctx, "DotmeshRPC.SetVolumeQuota", types.SetVolumeQuotaRequest{
+		Name:     vol,
+		MaxBytes: maxBytes,
+	}, &result)
+}
+
+// GetVolumeQuota returns the cap on the space vol can use, or 0 if it has
+// none.
+func (dm *DotmeshAPI) GetVolumeQuota(ctx context.Context, vol types.VolumeName) (int64, error) {
+	var result int64
+	err := dm.CallRemote(ctx, "DotmeshRPC.GetVolumeQuota", vol, &result)
+	if err != nil {
+		return 0, err
+	}
+	return result, nil
+}
+
+// GetQuotaUsage returns vol's quota along with how much space it's using and
+// has left.
+func (dm *DotmeshAPI) GetQuotaUsage(ctx context.Context, vol types.VolumeName) (*types.QuotaUsage, error) {
+	var result types.QuotaUsage
+	err := dm.CallRemote(ctx, "DotmeshRPC.GetQuotaUsage", vol, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SetSnapshotSchedule makes the server commit to branch of vol whenever
+// cronExpr (e.g. "0 * * * *" or "@hourly") says so. If retainCount is
+// positive, the oldest commits are pruned so that only that many are kept.
+func (dm *DotmeshAPI) SetSnapshotSchedule(ctx context.Context, vol types.VolumeName, branch, cronExpr string, retainCount int) error {
+	var result bool
+	return dm.CallRemote(ctx, "DotmeshRPC.SetSnapshotSchedule", types.SetSnapshotScheduleRequest{
+		Name:        vol,
+		Branch:      deMasterify(branch),
+		CronExpr:    cronExpr,
+		RetainCount: retainCount,
+	}, &result)
+}
+
+// SetRetentionPolicy has the server prune the commits of branch of vol every
+// so often, as policy says. A policy with neither MaxCount nor MaxAgeDays
+// removes the branch's policy.
+func (dm *DotmeshAPI) SetRetentionPolicy(ctx context.Context, vol types.VolumeName, branch string, policy types.RetentionPolicy) error {
+	var result bool
+	err := dm.CallRemote(ctx, "DotmeshRPC.SetRetentionPolicy", types.SetRetentionPolicyRequest{
+		Name:   vol,
+		Branch: deMasterify(branch),
+		Policy: policy,
+	}, &result)
+	if hasErrorCode(err, types.ErrCodeWouldDeleteAll) {
+		return fmt.Errorf("%w: %s", ErrWouldDeleteAll, err)
+	}
+	return err
+}
+
+func (dm *DotmeshAPI) GetSnapshotSchedule(ctx context.Context, vol types.VolumeName, branch string) (*types.SnapshotSchedule, error) {
+	var result types.SnapshotSchedule
+	err := dm.CallRemote(ctx, "DotmeshRPC.GetSnapshotSchedule", types.SnapshotScheduleRequest{
+		Name:   vol,
+		Branch: deMasterify(branch),
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (dm *DotmeshAPI) DeleteSnapshotSchedule(ctx context.Context, vol types.VolumeName, branch string) error {
+	var result bool
+	return dm.CallRemote(ctx, "DotmeshRPC.DeleteSnapshotSchedule", types.SnapshotScheduleRequest{
+		Name:   vol,
+		Branch: deMasterify(branch),
+	}, &result)
+}
+
+// CheckVolumeHealth asks the master node for vol to check its ZFS dataset and
+// pool. Unless ctx already has a deadline, it gives up after the health check
+// timeout rather than RPCTimeout.
+func (dm *DotmeshAPI) CheckVolumeHealth(ctx context.Context, vol types.VolumeName) (*types.VolumeHealth, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		timeout := dm.healthCheckTimeout
+		if timeout <= 0 {
+			timeout = DefaultHealthCheckTimeout
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	var result types.VolumeHealth
+	err := dm.CallRemote(ctx, "DotmeshRPC.CheckVolumeHealth", vol, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetPoolStatus reports on the ZFS pool of the node named nodeName, or of
+// the node the call is made to if it's empty. Only the admin user can call
+// it.
+func (dm *DotmeshAPI) GetPoolStatus(ctx context.Context, nodeName string) (*types.PoolStatus, error) {
+	var result types.PoolStatus
+	err := dm.CallRemote(ctx, "DotmeshRPC.GetPoolStatus", nodeName, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetAllPoolStatuses is GetPoolStatus for every node in the cluster. Nodes
+// that couldn't be asked have their Error set.
+func (dm *DotmeshAPI) GetAllPoolStatuses(ctx context.Context) ([]types.PoolStatus, error) {
+	var result []types.PoolStatus
+	err := dm.CallRemote(ctx, "DotmeshRPC.GetAllPoolStatuses", struct{}{}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// RotateAPIKey replaces the current user's API key with a new one, which is
+// saved to the config file for the current remote and used for all further
+// calls. The old key stops working straight away.
+func (dm *DotmeshAPI) RotateAPIKey(ctx context.Context) (string, error) {
+	if dm.DryRun {
+		return "", dm.dryRun("rotated your API key")
+	}
+	var result struct{ ApiKey string }
+	err := dm.CallRemote(ctx, "DotmeshRPC.RotateAPIKey", struct{}{}, &result)
+	if err != nil {
+		return "", err
+	}
+	return result.ApiKey, dm.useAPIKey(result.ApiKey)
+}
+
+// RotateAPIKeyForUser is RotateAPIKey for any user, and is only allowed for
+// the admin user. The new key is returned so it can be passed on to them.
+func (dm *DotmeshAPI) RotateAPIKeyForUser(ctx context.Context, username string) (string, error) {
+	if dm.DryRun {
+		return "", dm.dryRun("rotated the API key of user %s", username)
+	}
+	var result struct{ ApiKey string }
+	err := dm.CallRemote(ctx, "DotmeshRPC.RotateAPIKeyForUser", struct{ Username string }{
+		Username: username,
+	}, &result)
+	if err != nil {
+		return "", err
+	}
+	if username == dm.Client.User {
+		return result.ApiKey, dm.useAPIKey(result.ApiKey)
+	}
+	return result.ApiKey, nil
+}
+
+// useAPIKey switches dm.Client over to apiKey, and remembers it in the config
+// file when there is one.
+func (dm *DotmeshAPI) useAPIKey(apiKey string) error {
+	dm.clientMu.Lock()
+	defer dm.clientMu.Unlock()
+
+	client := *dm.Client
+	client.ApiKey = apiKey
+	dm.Client = &client
+
+	if dm.Configuration == nil {
+		return nil
+	}
+	err := dm.Configuration.SetApiKeyForRemote(dm.Configuration.CurrentRemote, apiKey)
+	if err != nil {
+		return fmt.Errorf("Your API key was rotated, but saving the new one to %s failed: %s", dm.configPath, err)
+	}
+	return nil
+}
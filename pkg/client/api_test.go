@@ -0,0 +1,688 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// newTestAPI returns a client of a test server that handles its requests with
+// handler, and a func to close the server.
+func newTestAPI(t *testing.T, handler http.Handler) (*DotmeshAPI, func()) {
+	server := httptest.NewServer(handler)
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	return NewDotmeshAPIFromClient(NewJsonRpcClient("admin", u.Hostname(), "key", port), false), server.Close
+}
+
+func TestRPCTimeout(t *testing.T) {
+	dm := NewDotmeshAPIFromClient(nil, false)
+	dm.methodTimeouts = map[string]time.Duration{
+		"DotmeshRPC.Commits": time.Minute,
+	}
+	if got := dm.rpcTimeout("DotmeshRPC.Ping"); got != RPCTimeout {
+		t.Errorf("expected default timeout %s, got %s", RPCTimeout, got)
+	}
+
+	fast := dm.WithTimeout(time.Second)
+	if got := fast.rpcTimeout("DotmeshRPC.Ping"); got != time.Second {
+		t.Errorf("expected instance timeout 1s, got %s", got)
+	}
+	if got := fast.rpcTimeout("DotmeshRPC.Commits"); got != time.Minute {
+		t.Errorf("expected per-method timeout 1m, got %s", got)
+	}
+	if got := dm.rpcTimeout("DotmeshRPC.Ping"); got != RPCTimeout {
+		t.Errorf("WithTimeout changed the original client's timeout to %s", got)
+	}
+}
+
+func TestWithTimeoutKeepsOptions(t *testing.T) {
+	dm := NewDotmeshAPIFromClient(NewJsonRpcClient("admin", "localhost", "key", 32607), true)
+	dm.Out = &bytes.Buffer{}
+	dm.DryRun = true
+	dm.ForcePush = true
+	dm.ForcePushWarningOut = &bytes.Buffer{}
+	dm.PushTargetCommit = "HEAD^"
+	dm.TransferEstimateOut = &bytes.Buffer{}
+	dm.TransferCompression = types.CompressionLZ4
+	dm.ShowTransferProgress = true
+	dm.CompressArchives = true
+
+	fast := dm.WithTimeout(time.Second)
+	if fast.timeout != time.Second {
+		t.Errorf("expected the copy's timeout to be 1s, got %s", fast.timeout)
+	}
+	// everything else, including fields added since, is as it was
+	copied := *fast
+	copied.timeout = dm.timeout
+	if !reflect.DeepEqual(&copied, dm) {
+		t.Errorf("expected WithTimeout to keep every option, got %+v from %+v", copied, *dm)
+	}
+}
+
+func TestNewDotmeshAPIWithPool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configPath := filepath.Join(dir, "config")
+
+	if _, err := NewDotmeshAPIWithPool(configPath, false, 0); err == nil {
+		t.Error("expected an error for maxConns 0")
+	}
+
+	dm, err := NewDotmeshAPIWithPool(configPath, false, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dm.Close()
+	transport, ok := dm.httpClient.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("expected an *http.Transport, got %T", dm.httpClient.Transport)
+	}
+	if transport.MaxIdleConnsPerHost != 16 {
+		t.Errorf("expected MaxIdleConnsPerHost 16, got %d", transport.MaxIdleConnsPerHost)
+	}
+	if dm.WithTimeout(time.Second).httpClient != dm.httpClient {
+		t.Error("expected WithTimeout to share the connection pool")
+	}
+}
+
+func TestPingWithLatency(t *testing.T) {
+	for _, oldServer := range []bool{false, true} {
+		requests := 0
+		dm, closeServer := newTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			var req struct{ Method string }
+			json.NewDecoder(r.Body).Decode(&req)
+			switch {
+			case req.Method == "DotmeshRPC.PingVersion" && !oldServer:
+				fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":"1.2.3"}`)
+			case req.Method == "DotmeshRPC.PingVersion":
+				fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"rpc: can't find method \"DotmeshRPC.PingVersion\""}}`)
+			default:
+				fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":true}`)
+			}
+		}))
+
+		latency, version, err := dm.PingWithLatency(context.Background())
+		closeServer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if latency <= 0 {
+			t.Errorf("expected a latency, got %s", latency)
+		}
+		expected := "1.2.3"
+		if oldServer {
+			expected = ""
+		}
+		if version != expected {
+			t.Errorf("expected version %q, got %q", expected, version)
+		}
+		if expectedRequests := map[bool]int{false: 1, true: 2}[oldServer]; requests != expectedRequests {
+			t.Errorf("old server %t: expected %d requests, got %d", oldServer, expectedRequests, requests)
+		}
+	}
+}
+
+func TestDefaultBranches(t *testing.T) {
+	for _, oldServer := range []bool{false, true} {
+		calls := map[string]int{}
+		dm, closeServer := newTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req struct{ Method string }
+			json.NewDecoder(r.Body).Decode(&req)
+			calls[req.Method]++
+			switch {
+			case oldServer:
+				fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"rpc: can't find method \"%s\""}}`, req.Method)
+			case req.Method == "DotmeshRPC.DefaultBranches":
+				fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":{"admin":{"a":"main"}}}`)
+			default:
+				fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":"main"}`)
+			}
+		}))
+		dm.Configuration = &Configuration{
+			CurrentRemote: "local",
+			DMRemotes: map[string]*DMRemote{
+				"local": {CurrentBranches: map[string]string{"admin/c": "switched"}},
+			},
+		}
+
+		defaults, err := dm.DefaultBranches(context.Background())
+		if err != nil {
+			closeServer()
+			t.Fatal(err)
+		}
+		expected := map[string]string{"admin/a": "main", "admin/b": DefaultBranch, "admin/c": "switched"}
+		if oldServer {
+			expected["admin/a"] = DefaultBranch
+		}
+		for volume, branch := range expected {
+			got, err := dm.CurrentBranchFrom(volume, defaults)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != branch {
+				t.Errorf("old server %t: expected %s to be on %s, got %s", oldServer, volume, branch, got)
+			}
+		}
+		if calls["DotmeshRPC.DefaultBranches"] != 1 || calls["DotmeshRPC.GetDefaultBranch"] != 0 {
+			t.Errorf("old server %t: expected a single DefaultBranches call, got %v", oldServer, calls)
+		}
+
+		// CurrentBranch asks about the one volume, and falls back to
+		// master on servers without default branches too
+		got, err := dm.CurrentBranch("admin/a")
+		closeServer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != expected["admin/a"] {
+			t.Errorf("old server %t: expected CurrentBranch %s, got %s", oldServer, expected["admin/a"], got)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, tc := range []struct {
+		client, server string
+		compatible     bool
+	}{
+		{"0.5.0", "0.5.3", true},
+		{"release-0.5.1", "0.5.0", true},
+		{"v1.2.0", "1.2.0-rc1", true},
+		{"0.5.0", "0.6.0", false},
+		{"1.0.0", "0.9.9", false},
+		{"latest", "0.5.0", true},
+		{"", "0.5.0", true},
+	} {
+		result := compareVersions(tc.client, tc.server)
+		if result.Compatible != tc.compatible {
+			t.Errorf("client %q, server %q: expected compatible=%t, got %t", tc.client, tc.server, tc.compatible, result.Compatible)
+		}
+		if result.Compatible == (result.Warning != "") {
+			t.Errorf("client %q, server %q: compatible=%t but warning is %q", tc.client, tc.server, result.Compatible, result.Warning)
+		}
+		if result.ClientVersion != tc.client || result.ServerVersion != tc.server {
+			t.Errorf("client %q, server %q: got versions %q and %q", tc.client, tc.server, result.ClientVersion, result.ServerVersion)
+		}
+	}
+}
+
+func TestCachedCompatibility(t *testing.T) {
+	defer func(v string) { ClientVersion = v }(ClientVersion)
+	ClientVersion = "0.5.0"
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":{"installed_version":"0.6.0"}}`)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "compatibility")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configPath := filepath.Join(dir, "config")
+	dm, err := NewDotmeshAPI(configPath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(u.Port())
+	if err := dm.Configuration.AddRemote("local", "admin", u.Hostname(), port, "key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dm.Configuration.SetCurrentRemote("local"); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(expectedCalls int) {
+		t.Helper()
+		// a new dm, as each command is, reads the cache from the config
+		dm, err := NewDotmeshAPI(configPath, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := dm.CachedCompatibility(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Compatible || result.ServerVersion != "0.6.0" {
+			t.Errorf("expected 0.6.0 to be incompatible, got %+v", result)
+		}
+		if calls != expectedCalls {
+			t.Errorf("expected the server to have been asked %d times, got %d", expectedCalls, calls)
+		}
+	}
+	check(1)
+	check(1)
+
+	// a new client asks again
+	ClientVersion = "0.5.1"
+	check(2)
+
+	// and so does the same client a day later
+	if err := dm.Configuration.Load(); err != nil {
+		t.Fatal(err)
+	}
+	cached, _ := dm.Configuration.CompatibilityFor("local")
+	cached.CheckedAt = cached.CheckedAt.Add(-CompatibilityCacheTTL)
+	if err := dm.Configuration.SetCompatibilityFor("local", cached); err != nil {
+		t.Fatal(err)
+	}
+	check(3)
+}
+
+func TestDivergedCommits(t *testing.T) {
+	commits := func(ids ...string) []types.Snapshot {
+		result := []types.Snapshot{}
+		for _, id := range ids {
+			result = append(result, types.Snapshot{Id: id})
+		}
+		return result
+	}
+	for _, tc := range []struct {
+		local, remote []types.Snapshot
+		expected      []types.Snapshot
+	}{
+		{commits("a", "b", "c"), commits("a", "b"), commits()},
+		{commits("a", "b", "x"), commits("a", "b", "c", "d"), commits("c", "d")},
+		{commits("x"), commits("a"), commits("a")},
+		{commits("a"), commits(), commits()},
+	} {
+		got := divergedCommits(tc.local, tc.remote)
+		if len(got) != len(tc.expected) {
+			t.Errorf("local %v, remote %v: expected %v, got %v", tc.local, tc.remote, tc.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i].Id != tc.expected[i].Id {
+				t.Errorf("local %v, remote %v: expected %v, got %v", tc.local, tc.remote, tc.expected, got)
+			}
+		}
+	}
+}
+
+func TestHostURL(t *testing.T) {
+	for _, tc := range []struct {
+		hostname, port, expected string
+	}{
+		{"dothub.com", "443", "https://dothub.com:443"},
+		{"10.0.0.1", SERVER_PORT, "https://10.0.0.1:32607"},
+		{"::1", SERVER_PORT, "https://[::1]:32607"},
+		{"2001:db8::1", "80", "https://[2001:db8::1]:80"},
+		{"[2001:db8::1]", "80", "https://[2001:db8::1]:80"},
+	} {
+		got := hostURL("https", tc.hostname, tc.port)
+		if got != tc.expected {
+			t.Errorf("expected %s:%s to give %q, got %q", tc.hostname, tc.port, tc.expected, got)
+		}
+		if _, err := url.Parse(got); err != nil {
+			t.Errorf("%q doesn't parse: %s", got, err)
+		}
+	}
+
+	// IPv6 remotes with a port are reached directly
+	j := NewJsonRpcClient("admin", "2001:db8::1", "secret", 32607)
+	got, err := j.serverURL(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "http://[2001:db8::1]:32607" {
+		t.Errorf("expected server URL http://[2001:db8::1]:32607, got %q", got)
+	}
+}
+
+func TestParseNamespacedVolumeColons(t *testing.T) {
+	_, _, err := ParseNamespacedVolume("alice/ba:d")
+	if err == nil {
+		t.Fatal("expected a volume name with a colon to be rejected")
+	}
+	namespace, name, err := ParseNamespacedVolume("alice/good")
+	if err != nil || namespace != "alice" || name != "good" {
+		t.Errorf("expected alice/good, got %q %q %v", namespace, name, err)
+	}
+}
+
+func TestNewVolumeNamesValidated(t *testing.T) {
+	// Parsing is left permissive, so that existing volumes can be named...
+	namespace, name, err := ParseNamespacedVolume("alice/Old.Volume")
+	if err != nil || namespace != "alice" || name != "Old.Volume" {
+		t.Errorf("expected alice/Old.Volume to parse, got %q %q %v", namespace, name, err)
+	}
+	namespace, name, err = ParseNamespacedVolume("")
+	if err != nil || namespace != "admin" || name != "" {
+		t.Errorf("expected an empty name to be left be, got %q %q %v", namespace, name, err)
+	}
+
+	// ...but new ones are checked before the server's asked to create them
+	dm := &DotmeshAPI{}
+	for _, volumeName := range []types.VolumeName{
+		{Namespace: "alice", Name: "Bad"},
+		{Namespace: "alice", Name: "master"},
+		{Namespace: "al ice", Name: "good"},
+		{Namespace: "", Name: "good"},
+	} {
+		if _, err := dm.NewVolumeFromStruct(volumeName); err == nil {
+			t.Errorf("expected %s/%s to be rejected", volumeName.Namespace, volumeName.Name)
+		}
+	}
+}
+
+func TestSetLogLevel(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	dm := NewDotmeshAPIFromClient(NewJsonRpcClient("admin", "localhost", "key", 0), false)
+	dm.log().Info("hidden")
+	if buf.Len() != 0 {
+		t.Errorf("expected info to be hidden by default, got %q", buf.String())
+	}
+	dm.SetLogLevel(log.InfoLevel)
+	dm.log().Info("shown")
+	if !strings.Contains(buf.String(), "shown") {
+		t.Errorf("expected info to be logged once enabled, got %q", buf.String())
+	}
+	if dm.verbose() {
+		t.Error("expected RPCs not to be dumped below debug level")
+	}
+}
+
+func TestDryRunPrinted(t *testing.T) {
+	var out bytes.Buffer
+	dm := NewDotmeshAPIFromClient(NewJsonRpcClient("admin", "localhost", "key", 0), false)
+	dm.Out = &out
+	err := dm.dryRun("deleted %s", "admin/apples")
+	if !IsDryRun(err) {
+		t.Errorf("expected a dry-run error, got %v", err)
+	}
+	// it's for the user, so isn't hidden by the log level
+	if out.String() != "[dry-run] would have deleted admin/apples\n" {
+		t.Errorf("expected the dry run to be printed, got %q", out.String())
+	}
+}
+
+func TestWaitForVolume(t *testing.T) {
+	defer func(interval time.Duration) { volumeWaitInterval = interval }(volumeWaitInterval)
+	volumeWaitInterval = 10 * time.Millisecond
+
+	calls := 0
+	dm, closeServer := newTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		id := ""
+		if calls >= 3 {
+			id = "fs-id"
+		}
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":%q}`, id)
+	}))
+	defer closeServer()
+	vol := types.VolumeName{Namespace: "admin", Name: "apples"}
+
+	if err := dm.WaitForVolume(context.Background(), vol, time.Second); err != nil {
+		t.Fatalf("expected the volume to become ready, got %s", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 polls, got %d", calls)
+	}
+
+	calls = -1000
+	err := dm.WaitForVolume(context.Background(), vol, 50*time.Millisecond)
+	if !errors.Is(err, ErrVolumeTimeout) {
+		t.Errorf("expected ErrVolumeTimeout, got %#v", err)
+	}
+}
+
+func TestProcureWithTimeout(t *testing.T) {
+	defer func(interval time.Duration) { procureRetryInterval = interval }(procureRetryInterval)
+	procureRetryInterval = 10 * time.Millisecond
+
+	calls := 0
+	dm, closeServer := newTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":%q}}`, types.ProcureNotReadyPrefix+"timed out")
+			return
+		}
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":"/mnt/apples"}`)
+	}))
+	defer closeServer()
+	args := types.ProcureArgs{Namespace: "admin", Name: "apples", Subdot: "__default__"}
+
+	mountpoint, err := dm.ProcureWithTimeout(context.Background(), args, time.Second)
+	if err != nil {
+		t.Fatalf("expected the volume to be procured, got %s", err)
+	}
+	if mountpoint != "/mnt/apples" || calls != 3 {
+		t.Errorf("expected /mnt/apples after 3 calls, got %q after %d", mountpoint, calls)
+	}
+
+	calls = -1000
+	_, err = dm.ProcureWithTimeout(context.Background(), args, 50*time.Millisecond)
+	if !IsNotReady(err) {
+		t.Errorf("expected a not ready error, got %#v", err)
+	}
+}
+
+func TestGetTransferEstimate(t *testing.T) {
+	dm, closeServer := newTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string
+			Params types.TransferRequest
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("bad request body: %s", err)
+		}
+		if req.Method != "DotmeshRPC.EstimateTransfer" || !req.Params.DryRun {
+			t.Errorf("expected a dry-run EstimateTransfer call, got %+v", req)
+		}
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":{"CommitCount":3,"EstimatedBytes":3145728,"BytesIsUpperBound":false,"DryRunDuration":1000000}}`)
+	}))
+	defer closeServer()
+
+	estimate, err := dm.GetTransferEstimate(context.Background(), types.TransferRequest{Direction: "push"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if estimate.CommitCount != 3 || estimate.EstimatedBytes != 3145728 || estimate.DryRunDuration != time.Millisecond {
+		t.Errorf("unexpected estimate %+v", estimate)
+	}
+	if description := describeTransferEstimate(*estimate); description != "3 commits (3.00MiB)" {
+		t.Errorf("unexpected description %q", description)
+	}
+}
+
+func TestCreateBranchFromMissingCommit(t *testing.T) {
+	commitId := "6f7d4e2c-4b1a-4f1e-9a5c-0c2d1e3f4a5b"
+	methods := []string{}
+	dm, closeServer := newTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ Method string }
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("bad request body: %s", err)
+		}
+		methods = append(methods, req.Method)
+		switch req.Method {
+		case "DotmeshRPC.Lookup":
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":"fs-id"}`)
+		case "DotmeshRPC.CommitsById":
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":[{"Id":"some-other-commit"}]}`)
+		default:
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":true}`)
+		}
+	}))
+	defer closeServer()
+
+	err := dm.CreateBranch("apples", "master", "old", commitId)
+	if err == nil || !strings.Contains(err.Error(), commitId) {
+		t.Errorf("expected an error about the missing commit, got %v", err)
+	}
+	for _, method := range methods {
+		if method == "DotmeshRPC.Branch" {
+			t.Errorf("expected no branch to be made from a missing commit")
+		}
+	}
+}
+
+func TestCrossNamespaceCopy(t *testing.T) {
+	dm, closeServer := newTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string
+			Params types.CrossNamespaceCopyRequest
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("bad request body: %s", err)
+		}
+		if req.Method != "DotmeshRPC.CrossNamespaceCopy" || req.Params.Source.Name != "apples" || req.Params.DestNamespace != "bob" {
+			t.Errorf("unexpected CrossNamespaceCopy call %+v", req)
+		}
+		if req.Params.Overwrite {
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":{"Namespace":"bob","Name":"apples"}}`)
+		} else {
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"error":"Volume bob/apples already exists"}`)
+		}
+	}))
+	defer closeServer()
+
+	source := types.VolumeName{Namespace: "alice", Name: "apples"}
+	_, err := dm.CrossNamespaceCopy(context.Background(), source, "bob")
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("expected a copy over an existing volume to be refused, got %v", err)
+	}
+	dest, err := dm.CrossNamespaceCopyOverwriting(context.Background(), source, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dest != (types.VolumeName{Namespace: "bob", Name: "apples"}) {
+		t.Errorf("unexpected destination %v", dest)
+	}
+}
+
+func TestCompareVolumes(t *testing.T) {
+	dm, closeServer := newTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string
+			Params types.CompareVolumesRequest
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("bad request body: %s", err)
+		}
+		if req.Method != "DotmeshRPC.CompareVolumes" || req.Params.Right.Namespace != "bob" || req.Params.LeftBranch != "" || req.Params.RightBranch != "fix" {
+			t.Errorf("unexpected CompareVolumes call %+v", req)
+		}
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":{"CommonAncestorCommitID":"a","LeftAheadBy":0,"RightAheadBy":1,"RightUniqueCommits":[{"Id":"b"}]}}`)
+	}))
+	defer closeServer()
+
+	comparison, err := dm.CompareVolumes(context.Background(), types.VolumeName{Namespace: "alice", Name: "apples"},
+		types.VolumeName{Namespace: "bob", Name: "apples"}, "master", "fix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comparison.CommonAncestorCommitID != "a" || comparison.RightAheadBy != 1 || comparison.RightUniqueCommits[0].Id != "b" {
+		t.Errorf("unexpected comparison %+v", comparison)
+	}
+}
+
+func TestGetNodeForVolume(t *testing.T) {
+	dm, closeServer := newTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string
+			Params types.VolumeName
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("bad request body: %s", err)
+		}
+		switch req.Method {
+		case "DotmeshRPC.GetNodeForVolume":
+			if req.Params.Name == "apples" {
+				fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":"node-2"}`)
+			} else {
+				fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"error":"No node holds the master copy of admin/pears yet"}`)
+			}
+		case "DotmeshRPC.GetAllVolumeLocations":
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":{"fs-1":"node-2","fs-2":"node-1"}}`)
+		default:
+			t.Errorf("unexpected call %+v", req)
+		}
+	}))
+	defer closeServer()
+
+	node, err := dm.GetNodeForVolume(context.Background(), types.VolumeName{Namespace: "admin", Name: "apples"})
+	if err != nil || node != "node-2" {
+		t.Errorf("expected node-2, got %q, %v", node, err)
+	}
+	_, err = dm.GetNodeForVolume(context.Background(), types.VolumeName{Namespace: "admin", Name: "pears"})
+	if err == nil {
+		t.Errorf("expected an error for a volume no node holds")
+	}
+	locations, err := dm.GetAllVolumeLocations(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != 2 || locations["fs-1"] != "node-2" {
+		t.Errorf("unexpected locations %v", locations)
+	}
+}
+
+func TestGetQuotaUsage(t *testing.T) {
+	dm, closeServer := newTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string
+			Params types.VolumeName
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("bad request body: %s", err)
+		}
+		switch req.Method {
+		case "DotmeshRPC.GetQuotaUsage":
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":{"QuotaBytes":1073741824,"UsedBytes":25088,"AvailableBytes":1073716736}}`)
+		case "DotmeshRPC.GetVolumeQuota":
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":1073741824}`)
+		default:
+			t.Errorf("unexpected call %+v", req)
+		}
+	}))
+	defer closeServer()
+
+	vol := types.VolumeName{Namespace: "admin", Name: "apples"}
+	usage, err := dm.GetQuotaUsage(context.Background(), vol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.QuotaBytes != 1073741824 || usage.UsedBytes != 25088 || usage.AvailableBytes != 1073716736 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+	quota, err := dm.GetVolumeQuota(context.Background(), vol)
+	if err != nil || quota != 1073741824 {
+		t.Errorf("expected a quota of 1073741824, got %d, %v", quota, err)
+	}
+}
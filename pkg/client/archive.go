@@ -0,0 +1,101 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+)
+
+// ExportVolume writes commitID on branch of vol, with the commits before it,
+// to w as a tar archive that ImportVolume can load into another cluster. The
+// archive is gzipped if CompressArchives is set.
+func (dm *DotmeshAPI) ExportVolume(ctx context.Context, vol types.VolumeName, branch, commitID string, w io.Writer) error {
+	if branch == "" {
+		branch = DefaultBranch
+	}
+	resp, err := dm.archiveRequest(ctx, fmt.Sprintf(
+		"/export/%s/%s/%s/%s",
+		url.PathEscape(vol.Namespace), url.PathEscape(vol.Name), url.PathEscape(branch), url.PathEscape(commitID),
+	), nil)
+	if err != nil {
+		return fmt.Errorf("Error exporting %s: %s", vol, err)
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	if err != nil {
+		return fmt.Errorf("Error exporting %s: %s", vol, err)
+	}
+	return nil
+}
+
+// ImportVolume creates vol from an archive written by ExportVolume (gzipped
+// if CompressArchives is set), and returns its filesystem id. Only the master
+// branch of a new volume can be imported.
+func (dm *DotmeshAPI) ImportVolume(ctx context.Context, vol types.VolumeName, branch string, r io.Reader) (string, error) {
+	if branch == "" {
+		branch = DefaultBranch
+	}
+	if dm.DryRun {
+		return "", dm.dryRun("imported %s", vol)
+	}
+	resp, err := dm.archiveRequest(ctx, fmt.Sprintf(
+		"/import/%s/%s/%s",
+		url.PathEscape(vol.Namespace), url.PathEscape(vol.Name), url.PathEscape(branch),
+	), r)
+	if err != nil {
+		return "", fmt.Errorf("Error importing %s: %s", vol, err)
+	}
+	defer resp.Body.Close()
+	var filesystemId string
+	err = json.NewDecoder(resp.Body).Decode(&filesystemId)
+	if err != nil {
+		return "", fmt.Errorf("Error reading response to importing %s: %s", vol, err)
+	}
+	return filesystemId, nil
+}
+
+// archiveRequest POSTs body to path on the current remote, and returns the
+// response if it was successful. There's no timeout: archives can be as big
+// as the volume, so it's up to ctx.
+func (dm *DotmeshAPI) archiveRequest(ctx context.Context, path string, body io.Reader) (*http.Response, error) {
+	err := dm.openClient()
+	if err != nil {
+		return nil, err
+	}
+	base, err := dm.Client.serverURL(ctx)
+	if dm.circuit != nil {
+		dm.circuit.record(dm.Client.Hostname, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if dm.CompressArchives {
+		path += "?compress=true"
+	}
+
+	req, err := http.NewRequest("POST", base+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	dm.Client.setAuth(req)
+
+	resp, err := dm.Client.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		message, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%s %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+)
+
+// FormatCSV is understood by ExportAuditLog, as well as FormatJSON
+const FormatCSV = "csv"
+
+// GetAuditLog returns the audit events matching filter, oldest first. Only
+// the admin user is allowed to read the audit log.
+func (dm *DotmeshAPI) GetAuditLog(ctx context.Context, filter types.AuditFilter) ([]types.AuditEvent, error) {
+	err := filter.Validate()
+	if err != nil {
+		return nil, err
+	}
+	var result []types.AuditEvent
+	err = dm.CallRemote(ctx, "DotmeshRPC.GetAuditLog", filter, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ExportAuditLog writes the audit events matching filter to w, either as
+// "json", one JSON object per line, or as "csv" with a header row.
+func (dm *DotmeshAPI) ExportAuditLog(ctx context.Context, filter types.AuditFilter, format string, w io.Writer) error {
+	if format != FormatJSON && format != FormatCSV {
+		return fmt.Errorf("Unknown format '%s', expected %s or %s", format, FormatJSON, FormatCSV)
+	}
+	events, err := dm.GetAuditLog(ctx, filter)
+	if err != nil {
+		return err
+	}
+	return writeAuditLog(events, format, w)
+}
+
+var auditCSVHeader = []string{
+	"timestamp", "user", "namespace", "volume", "operation", "remote_addr", "success", "details",
+}
+
+func writeAuditLog(events []types.AuditEvent, format string, w io.Writer) error {
+	if format == FormatJSON {
+		encoder := json.NewEncoder(w)
+		for _, e := range events {
+			err := encoder.Encode(e)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	cw := csv.NewWriter(w)
+	err := cw.Write(auditCSVHeader)
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		err = cw.Write([]string{
+			e.Timestamp.Format(time.RFC3339Nano), e.User, e.Namespace, e.VolumeName,
+			e.Operation, e.RemoteAddr, strconv.FormatBool(e.Success), formatAuditDetails(e.Details),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// formatAuditDetails - "key=value" pairs sorted by key, separated by ";"
+func formatAuditDetails(details map[string]string) string {
+	pairs := []string{}
+	for k, v := range details {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ";")
+}
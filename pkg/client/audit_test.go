@@ -0,0 +1,65 @@
+package client
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+)
+
+var testAuditEvents = []types.AuditEvent{
+	{
+		Timestamp:  time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		User:       "admin",
+		Namespace:  "admin",
+		VolumeName: "apples",
+		Operation:  "DotmeshRPC.Commit",
+		RemoteAddr: "10.0.0.1:1234",
+		Success:    true,
+		Details:    map[string]string{"branch": "feature"},
+	},
+	{
+		Timestamp: time.Date(2020, 1, 2, 3, 5, 0, 0, time.UTC),
+		User:      "bob",
+		Operation: "DotmeshRPC.UpdatePassword",
+		Details:   map[string]string{"error": "nope, \"no\""},
+	},
+}
+
+func TestWriteAuditLogCSV(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeAuditLog(testAuditEvents, FormatCSV, &buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a header and 2 rows, got %q", buf.String())
+	}
+	if lines[0] != strings.Join(auditCSVHeader, ",") {
+		t.Errorf("unexpected header %q", lines[0])
+	}
+	if lines[1] != "2020-01-02T03:04:05Z,admin,admin,apples,DotmeshRPC.Commit,10.0.0.1:1234,true,branch=feature" {
+		t.Errorf("unexpected row %q", lines[1])
+	}
+	if !strings.HasSuffix(lines[2], `,false,"error=nope, ""no"""`) {
+		t.Errorf("expected details to be quoted, got %q", lines[2])
+	}
+}
+
+func TestWriteAuditLogJSON(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeAuditLog(testAuditEvents, FormatJSON, &buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected one line per event, got %q", buf.String())
+	}
+	if !strings.Contains(lines[0], `"VolumeName":"apples"`) {
+		t.Errorf("unexpected line %q", lines[0])
+	}
+}
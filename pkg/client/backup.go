@@ -0,0 +1,316 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/context"
+	pb "gopkg.in/cheggaaa/pb.v1"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+)
+
+// How many keys BackupEtcdWithProgress writes between calls to its progressFn
+const backupProgressInterval = 100
+
+// BackupEtcd writes a backup of the users and registry of the current remote
+// to w, which RestoreEtcd can read back, as the server streams it. If
+// progress isn't nil, a progress bar counting the keys written is drawn on
+// it.
+func (dm *DotmeshAPI) BackupEtcd(w io.Writer, progress io.Writer) error {
+	var bar *pb.ProgressBar
+	err := dm.streamBackup(w, func(keysProcessed, total int) {
+		if progress == nil {
+			return
+		}
+		if bar == nil {
+			bar = pb.New(total)
+			bar.Output = progress
+			bar.Prefix("Backing up")
+			bar.Start()
+		}
+		bar.Set(keysProcessed)
+	})
+	if bar != nil {
+		bar.Finish()
+	}
+	return err
+}
+
+// BackupEtcdWithProgress is BackupEtcd, calling progressFn with the number of
+// keys written every 100 keys, and once they all have been, rather than
+// drawing a progress bar.
+func (dm *DotmeshAPI) BackupEtcdWithProgress(w io.Writer, progressFn func(keysProcessed int)) error {
+	return dm.streamBackup(w, func(keysProcessed, total int) {
+		if keysProcessed%backupProgressInterval == 0 || keysProcessed == total {
+			progressFn(keysProcessed)
+		}
+	})
+}
+
+// streamBackup copies the backup the server streams to w a key at a time,
+// calling written after each one with how many have been written out of how
+// many there are. Servers that can't stream backups are asked for the whole
+// of it with DumpEtcd instead.
+func (dm *DotmeshAPI) streamBackup(w io.Writer, written func(keysProcessed, total int)) error {
+	ctx := context.Background()
+	resp, err := dm.openStream(ctx, "/backup", "application/x-ndjson", "backing up etcd")
+	if errors.Is(err, errStreamNotFound) {
+		backup, err := dm.dumpEtcd()
+		if err != nil {
+			return err
+		}
+		return writeBackup(w, backup, written)
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	total, err := strconv.Atoi(resp.Header.Get("X-Dotmesh-Backup-Records"))
+	if err != nil {
+		return fmt.Errorf("Error backing up etcd: bad record count from the server: %s", err)
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	encoder := json.NewEncoder(w)
+	keys := 0
+	for {
+		var record types.BackupRecord
+		err = decoder.Decode(&record)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Error backing up etcd: %s", err)
+		}
+		err = encoder.Encode(record)
+		if err != nil {
+			return err
+		}
+		keys++
+		written(keys, total)
+	}
+	if keys != total {
+		return fmt.Errorf("Error backing up etcd: the server sent %d of %d keys", keys, total)
+	}
+	return nil
+}
+
+func (dm *DotmeshAPI) dumpEtcd() (*types.BackupV1, error) {
+	var backup types.BackupV1
+	err := dm.CallRemote(context.Background(), "DotmeshRPC.DumpEtcd",
+		struct{ Prefix string }{Prefix: ""},
+		&backup,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &backup, nil
+}
+
+// writeBackup writes backup to w as newline-delimited JSON
+// types.BackupRecords, calling written after each one.
+func writeBackup(w io.Writer, backup *types.BackupV1, written func(keysProcessed, total int)) error {
+	encoder := json.NewEncoder(w)
+	total := backup.RecordCount()
+	keys := 0
+	return backup.EachRecord(func(record types.BackupRecord) error {
+		err := encoder.Encode(record)
+		if err != nil {
+			return err
+		}
+		keys++
+		written(keys, total)
+		return nil
+	})
+}
+
+// eachBackupRecord calls fn with each record of a backup written by
+// BackupEtcd as it's read from r, stopping at fn's first error. The backup's
+// version is checked before fn is called, and each record before it's passed
+// on. Backups from before they were written a record at a time, as a single
+// JSON object, are read whole and passed on as records.
+func eachBackupRecord(r io.Reader, fn func(types.BackupRecord) error) error {
+	decoder := json.NewDecoder(r)
+	first := true
+	for {
+		var raw json.RawMessage
+		err := decoder.Decode(&raw)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		var record types.BackupRecord
+		err = json.Unmarshal(raw, &record)
+		if err != nil {
+			return err
+		}
+		if first && record.Key == "" {
+			var backup types.BackupV1
+			err = json.Unmarshal(raw, &backup)
+			if err != nil {
+				return err
+			}
+			err = checkBackupVersion(backup.Version)
+			if err != nil {
+				return err
+			}
+			return backup.EachRecord(fn)
+		}
+
+		// check the record before passing it on
+		var check types.BackupV1
+		err = check.Add(record)
+		if err != nil {
+			return err
+		}
+		if first {
+			if record.Key != "version" {
+				return fmt.Errorf("the backup doesn't start with its version")
+			}
+			err = checkBackupVersion(check.Version)
+			if err != nil {
+				return err
+			}
+		}
+		first = false
+
+		err = fn(record)
+		if err != nil {
+			return err
+		}
+	}
+	if first {
+		return fmt.Errorf("the backup has no version")
+	}
+	return nil
+}
+
+// checkBackupVersion returns an error if a backup of version can't be
+// restored.
+func checkBackupVersion(version string) error {
+	for _, v := range types.BackupSupportedVersions {
+		if version == v {
+			return nil
+		}
+	}
+	return fmt.Errorf("Unsupported etcd backup version '%s', supported versions: %s", version, strings.Join(types.BackupSupportedVersions, ", "))
+}
+
+// readBackup reads the whole of a backup written by BackupEtcd, for servers
+// that can't have it streamed to them.
+func readBackup(r io.Reader) (*types.BackupV1, error) {
+	backup := &types.BackupV1{}
+	err := eachBackupRecord(r, backup.Add)
+	if err != nil {
+		return nil, err
+	}
+
+	// Lists with nothing in are restored as empty, not null
+	if backup.Users == nil {
+		backup.Users = []*types.User{}
+	}
+	if backup.FilesystemMasters == nil {
+		backup.FilesystemMasters = []*types.FilesystemMaster{}
+	}
+	if backup.RegistryFilesystems == nil {
+		backup.RegistryFilesystems = []*types.RegistryFilesystem{}
+	}
+	if backup.RegistryClones == nil {
+		backup.RegistryClones = []*types.Clone{}
+	}
+	return backup, nil
+}
+
+// RestoreEtcd restores the users (except admin) and registry of the current
+// remote from a backup written by BackupEtcd, read from r. If progress isn't
+// nil, a progress bar counting the bytes read is drawn on it. The backup is
+// streamed to the server a record at a time, as it's read, and a bad record
+// part way through stops the restore there, with the records before it
+// restored. Servers that can't have backups streamed to them are sent the
+// whole of it with the RestoreEtcd RPC instead, once it's all been read and
+// checked.
+func (dm *DotmeshAPI) RestoreEtcd(r io.Reader, progress io.Writer) error {
+	if progress != nil {
+		bar := pb.New64(0)
+		bar.Output = progress
+		bar.SetUnits(pb.U_BYTES)
+		bar.Prefix("Reading backup")
+		bar.Start()
+		defer bar.Finish()
+		r = bar.NewProxyReader(r)
+	}
+
+	if dm.DryRun {
+		keys := 0
+		err := eachBackupRecord(r, func(types.BackupRecord) error {
+			keys++
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("Error reading etcd backup: %s", err)
+		}
+		return dm.dryRun("restored etcd from a %d key backup", keys)
+	}
+
+	ctx := context.Background()
+	streaming, err := dm.hasCapability(ctx, types.RestoreStreamCapability)
+	if err != nil {
+		return err
+	}
+	if !streaming {
+		return dm.restoreEtcdWhole(r)
+	}
+
+	body, w := io.Pipe()
+	readErr := make(chan error, 1)
+	go func() {
+		encoder := json.NewEncoder(w)
+		err := eachBackupRecord(r, func(record types.BackupRecord) error {
+			return encoder.Encode(record)
+		})
+		readErr <- err
+		w.CloseWithError(err)
+	}()
+	resp, err := dm.streamRequest(ctx, "POST", "/restore", body, "text/plain", "restoring etcd")
+	// stops the reader if the server gave up before the end
+	body.Close()
+	if err := <-readErr; err != nil && err != io.ErrClosedPipe {
+		return fmt.Errorf("Error reading etcd backup: %s", err)
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// restoreEtcdWhole reads the whole backup from r and sends it to the server
+// in one RestoreEtcd RPC.
+func (dm *DotmeshAPI) restoreEtcdWhole(r io.Reader) error {
+	backup, err := readBackup(r)
+	if err != nil {
+		return fmt.Errorf("Error reading etcd backup: %s", err)
+	}
+	dump, err := json.Marshal(backup)
+	if err != nil {
+		return err
+	}
+	var response bool
+	return dm.CallRemote(context.Background(), "DotmeshRPC.RestoreEtcd",
+		struct {
+			Prefix string
+			Dump   string
+		}{
+			Prefix: "",
+			Dump:   string(dump),
+		},
+		&response,
+	)
+}
@@ -0,0 +1,172 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+)
+
+func TestBackupAndRestoreEtcd(t *testing.T) {
+	backup := types.BackupV1{
+		Version: types.BackupVersion,
+		Created: time.Now().UTC().Round(time.Second),
+		Users:   []*types.User{{Id: "1", Name: "alice"}, {Id: "2", Name: "bob"}},
+		FilesystemMasters: []*types.FilesystemMaster{
+			{FilesystemID: "fs", NodeID: "node"},
+		},
+		RegistryClones: []*types.Clone{},
+	}
+	var restored string
+	streaming := true
+	dm, closeServer := newTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/restore" {
+			var got types.BackupV1
+			decoder := json.NewDecoder(r.Body)
+			for decoder.More() {
+				var record types.BackupRecord
+				err := decoder.Decode(&record)
+				if err == nil {
+					err = got.Add(record)
+				}
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+			if got.RegistryFilesystems == nil {
+				got.RegistryFilesystems = []*types.RegistryFilesystem{}
+			}
+			dump, _ := json.Marshal(got)
+			restored = string(dump)
+			return
+		}
+		if r.URL.Path == "/backup" {
+			if !streaming {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("X-Dotmesh-Backup-Records", strconv.Itoa(backup.RecordCount()))
+			encoder := json.NewEncoder(w)
+			backup.EachRecord(func(record types.BackupRecord) error {
+				return encoder.Encode(record)
+			})
+			return
+		}
+		var req struct {
+			Method string
+			Params struct{ Dump string }
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		switch req.Method {
+		case "DotmeshRPC.Capabilities":
+			if !streaming {
+				fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"rpc: can't find method \"DotmeshRPC.Capabilities\""}}`)
+				return
+			}
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":{%q:true}}`, types.RestoreStreamCapability)
+		case "DotmeshRPC.DumpEtcd":
+			result, _ := json.Marshal(backup)
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":%s}`, result)
+		case "DotmeshRPC.RestoreEtcd":
+			restored = req.Params.Dump
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":true}`)
+		}
+	}))
+	defer closeServer()
+
+	var out bytes.Buffer
+	err := dm.BackupEtcd(&out, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected a line for each of 5 keys, got %d:\n%s", len(lines), out.String())
+	}
+	for _, line := range lines {
+		var record types.BackupRecord
+		err = json.Unmarshal([]byte(line), &record)
+		if err != nil || record.Key == "" {
+			t.Fatalf("backup line isn't a key-value pair: %s", line)
+		}
+	}
+
+	checkRestored := func() {
+		var got types.BackupV1
+		err := json.Unmarshal([]byte(restored), &got)
+		if err != nil {
+			t.Fatalf("restored backup isn't valid JSON: %s\n%s", err, restored)
+		}
+		if !got.Created.Equal(backup.Created) || len(got.Users) != 2 || got.Users[1].Name != "bob" ||
+			!reflect.DeepEqual(got.FilesystemMasters, backup.FilesystemMasters) || got.RegistryFilesystems == nil {
+			t.Errorf("backup didn't round trip: %s", restored)
+		}
+	}
+
+	err = dm.RestoreEtcd(bytes.NewReader(out.Bytes()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRestored()
+
+	// backups from before they were streamed are a single object
+	restored = ""
+	legacy, _ := json.Marshal(backup)
+	err = dm.RestoreEtcd(bytes.NewReader(legacy), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRestored()
+
+	err = dm.RestoreEtcd(strings.NewReader(`{"version":"v0"}`), nil)
+	if err == nil {
+		t.Errorf("expected an unsupported version to be refused")
+	}
+	err = dm.RestoreEtcd(strings.NewReader(`{"key":"version","value":"v1"}`+"\n"+`{"key":"nonsense","value":1}`), nil)
+	if err == nil {
+		t.Errorf("expected an unknown key to be refused")
+	}
+
+	backup.Users = make([]*types.User, 250)
+	for i := range backup.Users {
+		backup.Users[i] = &types.User{Id: strconv.Itoa(i)}
+	}
+	progress := []int{}
+	err = dm.BackupEtcdWithProgress(ioutil.Discard, func(keysProcessed int) {
+		progress = append(progress, keysProcessed)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(progress, []int{100, 200, 253}) {
+		t.Errorf("expected progress every 100 keys and at the end, got %v", progress)
+	}
+
+	// servers that can't stream backups are asked for all of it at once
+	streaming = false
+	var fromDump bytes.Buffer
+	err = dm.BackupEtcd(&fromDump, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(fromDump.String(), "\n"); n != 253 {
+		t.Errorf("expected 253 keys backed up from DumpEtcd, got %d", n)
+	}
+
+	// and are sent backups to restore all at once
+	restored = ""
+	err = dm.RestoreEtcd(bytes.NewReader(out.Bytes()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRestored()
+}
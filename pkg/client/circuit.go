@@ -0,0 +1,168 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrCircuitOpen is returned instead of calling a server that has recently
+// failed to respond, until the circuit breaker lets another attempt through.
+var ErrCircuitOpen = errors.New("dotmesh server is unreachable, not trying again yet (circuit breaker is open)")
+
+const (
+	DefaultCircuitFailureThreshold = 3
+	DefaultCircuitOpenTimeout      = 30 * time.Second
+
+	// number of consecutive failures before the circuit opens, 0 disables
+	// the circuit breaker
+	CircuitFailureThresholdEnv = "DOTMESH_CIRCUIT_FAILURE_THRESHOLD"
+	// how long the circuit stays open, e.g. "30s"
+	CircuitOpenTimeoutEnv = "DOTMESH_CIRCUIT_OPEN_TIMEOUT"
+
+	circuitStateFilename = "circuit-state"
+)
+
+type circuitState string
+
+const (
+	circuitClosed   circuitState = "closed"
+	circuitOpen     circuitState = "open"
+	circuitHalfOpen circuitState = "half-open"
+)
+
+// circuitRecord is what's kept in the circuit-state file, so that the
+// breaker works across separate dm invocations.
+type circuitRecord struct {
+	Hostname string       `json:"hostname"`
+	State    circuitState `json:"state"`
+	Failures int          `json:"failures"`
+	// when the circuit last opened, or went half-open
+	Since time.Time `json:"since"`
+}
+
+// circuitBreaker stops a DotmeshAPI from repeatedly waiting on a server that
+// isn't answering. Only failures to reach the server count; errors returned by
+// the server itself mean it's up.
+type circuitBreaker struct {
+	path      string
+	threshold int
+	timeout   time.Duration
+	now       func() time.Time
+}
+
+// newCircuitBreaker keeps its state next to the dm config file, thresholds
+// come from the environment. Returns nil if the breaker is disabled.
+func newCircuitBreaker(configPath string) *circuitBreaker {
+	threshold := DefaultCircuitFailureThreshold
+	if v := os.Getenv(CircuitFailureThresholdEnv); v != "" {
+		t, err := strconv.Atoi(v)
+		if err != nil {
+			log.Warnf("[circuitBreaker] ignoring invalid %s '%s': %s", CircuitFailureThresholdEnv, v, err)
+		} else {
+			threshold = t
+		}
+	}
+	if threshold <= 0 {
+		return nil
+	}
+
+	timeout := DefaultCircuitOpenTimeout
+	if v := os.Getenv(CircuitOpenTimeoutEnv); v != "" {
+		t, err := time.ParseDuration(v)
+		if err != nil {
+			log.Warnf("[circuitBreaker] ignoring invalid %s '%s': %s", CircuitOpenTimeoutEnv, v, err)
+		} else {
+			timeout = t
+		}
+	}
+
+	return &circuitBreaker{
+		path:      filepath.Join(filepath.Dir(configPath), circuitStateFilename),
+		threshold: threshold,
+		timeout:   timeout,
+		now:       time.Now,
+	}
+}
+
+func (cb *circuitBreaker) load(hostname string) circuitRecord {
+	closed := circuitRecord{Hostname: hostname, State: circuitClosed}
+	b, err := ioutil.ReadFile(cb.path)
+	if err != nil {
+		return closed
+	}
+	var record circuitRecord
+	err = json.Unmarshal(b, &record)
+	if err != nil || record.Hostname != hostname {
+		// corrupt, or about a different server
+		return closed
+	}
+	return record
+}
+
+func (cb *circuitBreaker) save(record circuitRecord) {
+	b, err := json.Marshal(record)
+	if err == nil {
+		err = ioutil.WriteFile(cb.path, b, 0600)
+	}
+	if err != nil {
+		// the breaker is an optimisation, never fail a command over it
+		log.Debugf("[circuitBreaker] failed to save %s: %s", cb.path, err)
+	}
+}
+
+// allow returns ErrCircuitOpen if calls to hostname should fail fast. Once the
+// timeout has passed, one call is let through to see if the server is back.
+func (cb *circuitBreaker) allow(hostname string) error {
+	record := cb.load(hostname)
+	switch record.State {
+	case circuitOpen, circuitHalfOpen:
+		if cb.now().Sub(record.Since) < cb.timeout {
+			return ErrCircuitOpen
+		}
+		record.State = circuitHalfOpen
+		record.Since = cb.now()
+		cb.save(record)
+	}
+	return nil
+}
+
+// record updates the breaker with the outcome of a call to hostname.
+func (cb *circuitBreaker) record(hostname string, err error) {
+	record := cb.load(hostname)
+	if !isUnreachable(err) {
+		if record.State != circuitClosed || record.Failures != 0 {
+			cb.save(circuitRecord{Hostname: hostname, State: circuitClosed})
+		}
+		return
+	}
+	record.Failures++
+	if record.State == circuitHalfOpen || record.Failures >= cb.threshold {
+		record.State = circuitOpen
+		record.Since = cb.now()
+	}
+	cb.save(record)
+}
+
+// isUnreachable is true for errors that mean we never got an answer from the
+// server, as opposed to the server answering with an error.
+func isUnreachable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	switch err.(type) {
+	case *url.Error, *unreachableError, net.Error:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "circuit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	cb := newCircuitBreaker(filepath.Join(dir, "config"))
+	cb.now = func() time.Time { return now }
+
+	unreachable := &url.Error{Op: "Post", URL: "http://localhost/rpc", Err: errors.New("connection refused")}
+
+	for i := 0; i < DefaultCircuitFailureThreshold; i++ {
+		if err := cb.allow("localhost"); err != nil {
+			t.Fatalf("expected call %d to be allowed, got %s", i, err)
+		}
+		cb.record("localhost", unreachable)
+	}
+	if err := cb.allow("localhost"); err != ErrCircuitOpen {
+		t.Fatalf("expected circuit to be open, got %v", err)
+	}
+	if err := cb.allow("elsewhere"); err != nil {
+		t.Errorf("expected a different server to be allowed, got %s", err)
+	}
+
+	// half-open: one attempt, which fails and reopens the circuit
+	now = now.Add(DefaultCircuitOpenTimeout)
+	if err := cb.allow("localhost"); err != nil {
+		t.Fatalf("expected half-open attempt to be allowed, got %s", err)
+	}
+	if err := cb.allow("localhost"); err != ErrCircuitOpen {
+		t.Errorf("expected only one half-open attempt, got %v", err)
+	}
+	cb.record("localhost", unreachable)
+	if err := cb.allow("localhost"); err != ErrCircuitOpen {
+		t.Fatalf("expected circuit to reopen, got %v", err)
+	}
+
+	// half-open again; an error from the server itself means it's back
+	now = now.Add(DefaultCircuitOpenTimeout)
+	if err := cb.allow("localhost"); err != nil {
+		t.Fatalf("expected half-open attempt to be allowed, got %s", err)
+	}
+	cb.record("localhost", errors.New("no such volume"))
+	if err := cb.allow("localhost"); err != nil {
+		t.Errorf("expected circuit to close, got %s", err)
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	os.Setenv(CircuitFailureThresholdEnv, "0")
+	defer os.Unsetenv(CircuitFailureThresholdEnv)
+	if cb := newCircuitBreaker("/nonexistent/config"); cb != nil {
+		t.Errorf("expected circuit breaker to be disabled, got %#v", cb)
+	}
+}
@@ -2,11 +2,16 @@ package client
 
 import (
 	"bytes"
+	"crypto/tls"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
 	"reflect"
+	"strconv"
+	"strings"
+	"time"
 
 	"golang.org/x/net/context"
 
@@ -15,6 +20,10 @@ import (
 
 	//	opentracinglog "github.com/opentracing/opentracing-go/log"
 	"github.com/openzipkin/zipkin-go-opentracing/examples/middleware"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/dotmesh-io/dotmesh/pkg/crypto"
+	"github.com/dotmesh-io/dotmesh/pkg/types"
 )
 
 // RPC client for inter-cluster operation
@@ -29,6 +38,16 @@ type JsonRpcClient struct {
 	ApiKey   string
 	Port     int
 	Verbose  bool
+	// HTTPClient is used for calls to the server, http.DefaultClient if nil
+	HTTPClient *http.Client
+	// IDToken, if set, is sent as a bearer token instead of User and ApiKey
+	IDToken string
+	// SignRequests makes calls carry a signature of their body, keyed with
+	// ApiKey, that the server checks
+	SignRequests bool
+	// InsecureTLS skips verifying the server's TLS certificate when
+	// HTTPClient isn't set, for servers with self-signed ones
+	InsecureTLS bool
 }
 
 func (jsonRpcClient JsonRpcClient) String() string {
@@ -36,8 +55,10 @@ func (jsonRpcClient JsonRpcClient) String() string {
 	toString := ""
 	for i := 0; i < v.NumField(); i++ {
 		fieldName := v.Type().Field(i).Name
-		if fieldName == "ApiKey" {
+		if fieldName == "ApiKey" || fieldName == "IDToken" {
 			toString = toString + fmt.Sprintf(" %v=%v,", fieldName, "****")
+		} else if fieldName == "HTTPClient" {
+			continue
 		} else {
 			toString = toString + fmt.Sprintf(" %v=%v,", fieldName, v.Field(i).Interface())
 		}
@@ -45,6 +66,29 @@ func (jsonRpcClient JsonRpcClient) String() string {
 	return toString
 }
 
+func (j *JsonRpcClient) httpClient() *http.Client {
+	if j.HTTPClient != nil {
+		return j.HTTPClient
+	}
+	if j.InsecureTLS {
+		return defaultInsecureHTTPClient
+	}
+	return http.DefaultClient
+}
+
+var defaultInsecureHTTPClient = insecureHTTPClient(http.DefaultTransport.(*http.Transport))
+
+// insecureHTTPClient is a client using a copy of transport that doesn't
+// verify servers' TLS certificates.
+func insecureHTTPClient(transport *http.Transport) *http.Client {
+	insecure := transport.Clone()
+	if insecure.TLSClientConfig == nil {
+		insecure.TLSClientConfig = &tls.Config{}
+	}
+	insecure.TLSClientConfig.InsecureSkipVerify = true
+	return &http.Client{Transport: insecure}
+}
+
 func NewJsonRpcClient(user, hostname, apiKey string, port int) *JsonRpcClient {
 	return &JsonRpcClient{
 		User:     user,
@@ -59,21 +103,30 @@ func NewJsonRpcClient(user, hostname, apiKey string, port int) *JsonRpcClient {
 func (j *JsonRpcClient) CallRemote(
 	ctx context.Context, method string, args interface{}, result interface{},
 ) error {
-	// RPCs are always between clusters, so "external"
-	var url string
-	var err error
-	if j.Port == 0 {
-		url, err = DeduceUrl(ctx, []string{j.Hostname}, "external", j.User, j.ApiKey)
-		if err != nil {
-			return err
-		}
-	} else {
-		url = fmt.Sprintf("http://%s:%d", j.Hostname, j.Port)
+	url, err := j.serverURL(ctx)
+	if err != nil {
+		return err
 	}
 	url = fmt.Sprintf("%s/rpc", url)
 	return j.reallyCallRemote(ctx, method, args, result, url)
 }
 
+// serverURL is the base URL of the server, without a trailing slash.
+func (j *JsonRpcClient) serverURL(ctx context.Context) (string, error) {
+	// RPCs are always between clusters, so "external"
+	if j.Port == 0 {
+		return deduceUrl(ctx, []string{j.Hostname}, "external", j)
+	}
+	return hostURL("http", j.Hostname, strconv.Itoa(j.Port)), nil
+}
+
+// hostURL is the base URL of the server at hostname and port. hostname may
+// be an IPv6 literal, with or without the brackets URLs need around it.
+func hostURL(scheme, hostname, port string) string {
+	hostname = strings.TrimSuffix(strings.TrimPrefix(hostname, "["), "]")
+	return scheme + "://" + net.JoinHostPort(hostname, port)
+}
+
 func (j *JsonRpcClient) reallyCallRemote(
 	ctx context.Context, method string, args interface{}, result interface{},
 	urlToUse string,
@@ -98,23 +151,29 @@ func (j *JsonRpcClient) reallyCallRemote(
 		fmt.Fprintln(os.Stdout, string(message))
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(message))
-	if err != nil {
-		return err
-	}
-
-	req = req.WithContext(ctx)
-
-	tracer := opentracing.GlobalTracer()
-	// use our middleware to propagate our trace
-	req = middleware.ToHTTPRequest(tracer)(req.WithContext(ctx))
-
-	req.Header.Set("Content-Type", "application/json")
-	req.SetBasicAuth(j.User, j.ApiKey)
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
+	var resp *http.Response
+	for attempt := 0; ; attempt++ {
+		req, err := j.newRPCRequest(ctx, url, method, message)
+		if err != nil {
+			return err
+		}
+		resp, err = j.httpClient().Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusTooManyRequests {
+			break
+		}
+		resp.Body.Close()
+		if attempt == rateLimitRetries {
+			span.SetTag("error", "Rate limited")
+			return fmt.Errorf("%w: gave up calling %s after %d retries", ErrRateLimited, method, rateLimitRetries)
+		}
+		select {
+		case <-time.After(retryAfter(resp.Header.Get("Retry-After"))):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
 	defer resp.Body.Close()
 
@@ -122,7 +181,7 @@ func (j *JsonRpcClient) reallyCallRemote(
 		// TODO add user mgmt subcommands, then reference them in this error message
 		// annotate our span with the error condition
 		span.SetTag("error", "Permission denied")
-		return fmt.Errorf("Permission denied. Please check that your API key is still valid.")
+		return types.NewAPIError(types.ErrCodePermissionDenied, "Permission denied. Please check that your API key is still valid.")
 	}
 	b, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
@@ -136,14 +195,76 @@ func (j *JsonRpcClient) reallyCallRemote(
 	}
 
 	err = json2.DecodeClientResponse(bytes.NewBuffer(b), &result)
+	if apiErr, ok := structuredError(err); ok {
+		span.SetTag("error", apiErr.Error())
+		return apiErr
+	}
 	if err != nil {
 		span.SetTag("error", fmt.Sprintf("Response '%s' yields error %s", string(b), err))
-		return fmt.Errorf("Response '%s' yields error %s", string(b), err)
+		return fmt.Errorf("Response '%s' yields error %w", string(b), err)
 	}
 	return nil
 }
 
+// newRPCRequest makes the HTTP request for a JSON-RPC call, made afresh for
+// each attempt so that a signed request's timestamp is current.
+func (j *JsonRpcClient) newRPCRequest(ctx context.Context, url, method string, message []byte) (*http.Request, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(message))
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.WithContext(ctx)
+
+	tracer := opentracing.GlobalTracer()
+	// use our middleware to propagate our trace
+	req = middleware.ToHTTPRequest(tracer)(req.WithContext(ctx))
+	// and pass on any OpenTelemetry span as a traceparent header
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	req.Header.Set("Content-Type", "application/json")
+	j.setAuth(req)
+	if j.IDToken == "" && j.SignRequests {
+		timestamp := crypto.SignatureTimestamp(time.Now())
+		req.Header.Set(crypto.SignatureTimestampHeader, timestamp)
+		req.Header.Set(crypto.SignatureHeader, crypto.Signature(j.ApiKey, method, message, timestamp))
+	}
+	return req, nil
+}
+
+// setAuth authenticates req with j's ID token if it has one, and its user
+// and API key if not.
+func (j *JsonRpcClient) setAuth(req *http.Request) {
+	if j.IDToken != "" {
+		req.Header.Set("Authorization", "Bearer "+j.IDToken)
+	} else {
+		req.SetBasicAuth(j.User, j.ApiKey)
+	}
+}
+
+// retryAfter is how long a Retry-After header says to wait, either in
+// seconds or until an HTTP date, or a second if it doesn't say.
+func retryAfter(header string) time.Duration {
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if when, err := http.ParseTime(header); err == nil {
+		if wait := time.Until(when); wait > 0 {
+			return wait
+		}
+		return 0
+	}
+	return time.Second
+}
+
 func DeduceUrl(ctx context.Context, hostnames []string, mode, user, apiKey string) (string, error) {
+	// hostname (2nd arg) doesn't matter because we're just calling
+	// reallyCallRemote which doesn't use it.
+	return deduceUrl(ctx, hostnames, mode, NewJsonRpcClient(user, "", apiKey, 0))
+}
+
+// deduceUrl is DeduceUrl, pinging with j's credentials.
+func deduceUrl(ctx context.Context, hostnames []string, mode string, j *JsonRpcClient) (string, error) {
 	// "mode" is "internal" if you're trying to connect within a cluster (e.g.
 	// directly to another node's IP address), or "external" if you're trying
 	// to connect an external cluster.
@@ -153,21 +274,18 @@ func DeduceUrl(ctx context.Context, hostnames []string, mode, user, apiKey strin
 		var urlsToTry []string
 		if mode == "external" {
 			urlsToTry = []string{
-				fmt.Sprintf("https://%s:443", hostname),
-				fmt.Sprintf("http://%s:80", hostname),
-				fmt.Sprintf("http://%s:%s", hostname, SERVER_PORT),
+				hostURL("https", hostname, "443"),
+				hostURL("http", hostname, "80"),
+				hostURL("http", hostname, SERVER_PORT),
 			}
 		} else {
 			urlsToTry = []string{
-				fmt.Sprintf("http://%s:%s", hostname, SERVER_PORT),
-				fmt.Sprintf("http://%s:%s", hostname, SERVER_PORT_OLD),
+				hostURL("http", hostname, SERVER_PORT),
+				hostURL("http", hostname, SERVER_PORT_OLD),
 			}
 		}
 
 		for _, urlToTry := range urlsToTry {
-			// hostname (2nd arg) doesn't matter because we're just calling
-			// reallyCallRemote which doesn't use it.
-			j := NewJsonRpcClient(user, "", apiKey, 0)
 			var result bool
 			err := j.reallyCallRemote(ctx, "DotmeshRPC.Ping", nil, &result, urlToTry+"/rpc")
 			if err == nil {
@@ -178,8 +296,18 @@ func DeduceUrl(ctx context.Context, hostnames []string, mode, user, apiKey strin
 		}
 	}
 
-	return "", fmt.Errorf("Unable to connect to any of the addresses attempted: %+v, errs: %v", hostnames, errs)
+	return "", &unreachableError{hostnames: hostnames, errs: errs}
+
+}
+
+// unreachableError is returned by DeduceUrl when none of the hostnames answered
+type unreachableError struct {
+	hostnames []string
+	errs      []error
+}
 
+func (e *unreachableError) Error() string {
+	return fmt.Sprintf("Unable to connect to any of the addresses attempted: %+v, errs: %v", e.hostnames, e.errs)
 }
 
 func (client *JsonRpcClient) Ping() (bool, error) {
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/gorilla/rpc/v2/json2"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+)
+
+// ErrBranchExists is returned, wrapped, by CopyBranch when the branch to
+// copy to already exists.
+var ErrBranchExists = errors.New("branch already exists")
+
+// ErrCannotDeleteDefaultBranch is returned, wrapped, by DeleteBranch when
+// the branch is master or the volume's default branch.
+var ErrCannotDeleteDefaultBranch = errors.New("the default branch can't be deleted")
+
+// ErrWouldDeleteAll is returned, wrapped, by SetRetentionPolicy when the
+// policy would prune every commit of the branch.
+var ErrWouldDeleteAll = errors.New("retention policy would delete all commits")
+
+// ErrCannotSquashToOlderCommit is returned, wrapped, by SquashCommits when
+// the commit to squash from is newer than the one to squash to.
+var ErrCannotSquashToOlderCommit = errors.New("can't squash to an older commit")
+
+// ErrVolumeTimeout is returned, wrapped, by WaitForVolume when the volume
+// isn't ready in time.
+var ErrVolumeTimeout = errors.New("timed out waiting for volume")
+
+// ErrRateLimited is returned, wrapped, by calls the server still refused
+// with 429 Too Many Requests after they'd been retried rateLimitRetries
+// times, waiting as long as it asked each time.
+var ErrRateLimited = errors.New("rate limited by the server")
+
+// rateLimitRetries is how many times a call that's rate limited is retried.
+const rateLimitRetries = 3
+
+// IsNotFound is true if err is the server saying the volume or branch asked
+// for doesn't exist.
+func IsNotFound(err error) bool {
+	return hasErrorCode(err, types.ErrCodeVolumeNotFound)
+}
+
+// IsConflict is true if err is the server refusing to create something
+// because it already exists.
+func IsConflict(err error) bool {
+	return hasErrorCode(err, types.ErrCodeConflict)
+}
+
+// IsPermissionDenied is true if err is the server refusing the request
+// because of who made it.
+func IsPermissionDenied(err error) bool {
+	return hasErrorCode(err, types.ErrCodePermissionDenied)
+}
+
+// IsInUse is true if err is the server refusing to delete a volume because
+// containers are using it, or one of its branches.
+func IsInUse(err error) bool {
+	return hasErrorCode(err, types.ErrCodeVolumeInUse)
+}
+
+// IsNotReady is true if err is the server saying a volume can't be procured
+// yet, but might be if asked again.
+func IsNotReady(err error) bool {
+	var rpcErr *json2.Error
+	return errors.As(err, &rpcErr) && strings.HasPrefix(rpcErr.Message, types.ProcureNotReadyPrefix)
+}
+
+// isMethodNotFound is true if err is the server saying it has no such RPC,
+// because it's older than the client.
+func isMethodNotFound(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "can't find method")
+}
+
+func hasErrorCode(err error, code string) bool {
+	var apiErr *types.APIError
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+// structuredError is the *types.APIError sent with a JSON-RPC error, if the
+// server sent one.
+func structuredError(err error) (*types.APIError, bool) {
+	rpcErr, ok := err.(*json2.Error)
+	if !ok || rpcErr.Data == nil {
+		return nil, false
+	}
+	// Data has been decoded into a map, round trip it into an APIError
+	data, err := json.Marshal(rpcErr.Data)
+	if err != nil {
+		return nil, false
+	}
+	var apiErr types.APIError
+	if json.Unmarshal(data, &apiErr) != nil || apiErr.Code == "" {
+		return nil, false
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = rpcErr.Message
+	}
+	return &apiErr, true
+}
@@ -0,0 +1,125 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+	"golang.org/x/net/context"
+)
+
+func TestCallRemoteErrors(t *testing.T) {
+	responses := map[string]string{
+		"notFound":  `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"No such filesystem named 'admin/nope'","data":{"Code":"VOLUME_NOT_FOUND","Message":"No such filesystem named 'admin/nope'"}}}`,
+		"conflict":  `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"Namespace bob already exists","data":{"Code":"CONFLICT","Message":"Namespace bob already exists"}}}`,
+		"plain":     `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"something broke","data":null}}`,
+		"forbidden": "",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		kind := r.URL.Query().Get("kind")
+		if kind == "forbidden" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, responses[kind])
+	}))
+	defer server.Close()
+
+	call := func(kind string) error {
+		var result bool
+		return NewJsonRpcClient("admin", "", "key", 0).reallyCallRemote(
+			context.Background(), "DotmeshRPC.Test", nil, &result, server.URL+"/rpc?kind="+kind,
+		)
+	}
+
+	err := call("notFound")
+	if !IsNotFound(err) || IsConflict(err) || err.Error() != "No such filesystem named 'admin/nope'" {
+		t.Errorf("expected a not found error, got %#v", err)
+	}
+	if err := call("conflict"); !IsConflict(err) || IsNotFound(err) {
+		t.Errorf("expected a conflict, got %#v", err)
+	}
+	if err := call("forbidden"); !IsPermissionDenied(err) {
+		t.Errorf("expected permission denied, got %#v", err)
+	}
+	err = call("plain")
+	if err == nil || IsNotFound(err) || IsConflict(err) || IsPermissionDenied(err) {
+		t.Errorf("expected an error without a code, got %#v", err)
+	}
+	if IsNotFound(nil) {
+		t.Errorf("nil isn't an error")
+	}
+}
+
+func TestCopyBranchExists(t *testing.T) {
+	dm, closeServer := newTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"Branch backup already exists on admin/db","data":{"Code":"CONFLICT","Message":"Branch backup already exists on admin/db"}}}`)
+	}))
+	defer closeServer()
+	err := dm.CopyBranch(context.Background(), types.VolumeName{Namespace: "admin", Name: "db"}, "master", "backup")
+	if !errors.Is(err, ErrBranchExists) {
+		t.Errorf("expected ErrBranchExists, got %#v", err)
+	}
+}
+
+func TestDeleteDefaultBranch(t *testing.T) {
+	dm, closeServer := newTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"Branch live is the default branch of admin/db, and can't be deleted","data":{"Code":"DEFAULT_BRANCH","Message":"Branch live is the default branch of admin/db, and can't be deleted"}}}`)
+	}))
+	defer closeServer()
+	vol := types.VolumeName{Namespace: "admin", Name: "db"}
+	for _, branch := range []string{"master", "live"} {
+		err := dm.DeleteBranch(context.Background(), vol, branch)
+		if !errors.Is(err, ErrCannotDeleteDefaultBranch) {
+			t.Errorf("expected ErrCannotDeleteDefaultBranch deleting %s, got %#v", branch, err)
+		}
+	}
+}
+
+func TestSquashToOlderCommit(t *testing.T) {
+	dm, closeServer := newTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"Commit c2 is newer than commit c1","data":{"Code":"OLDER_COMMIT","Message":"Commit c2 is newer than commit c1"}}}`)
+	}))
+	defer closeServer()
+	_, err := dm.SquashCommits(context.Background(), types.VolumeName{Namespace: "admin", Name: "db"}, "master", "c2", "c1", "squashed")
+	if !errors.Is(err, ErrCannotSquashToOlderCommit) {
+		t.Errorf("expected ErrCannotSquashToOlderCommit, got %#v", err)
+	}
+}
+
+func TestRateLimitedRetries(t *testing.T) {
+	calls, limitedCalls := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls <= limitedCalls {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":true}`)
+	}))
+	defer server.Close()
+
+	call := func() error {
+		var result bool
+		return NewJsonRpcClient("admin", "", "key", 0).reallyCallRemote(
+			context.Background(), "DotmeshRPC.Test", nil, &result, server.URL+"/rpc",
+		)
+	}
+
+	limitedCalls = rateLimitRetries
+	if err := call(); err != nil {
+		t.Errorf("expected the call to succeed once the limit passed, got %s", err)
+	}
+	if calls != rateLimitRetries+1 {
+		t.Errorf("expected %d attempts, got %d", rateLimitRetries+1, calls)
+	}
+
+	calls, limitedCalls = 0, rateLimitRetries+1
+	if err := call(); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected ErrRateLimited, got %#v", err)
+	}
+}
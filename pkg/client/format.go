@@ -0,0 +1,111 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+	"github.com/ghodss/yaml"
+)
+
+// Output formats understood by FormatVolumes and FormatVolumesWithContainers
+const (
+	FormatJSON  = "json"
+	FormatYAML  = "yaml"
+	FormatTable = "table"
+)
+
+// PrettyPrintSize - size in KiB, MiB or GiB, or "-" when empty
+func PrettyPrintSize(size int64) string {
+	s := "-"
+	if size > 0 {
+		if size < 1024*1024 {
+			s = fmt.Sprintf("%.2f kiB", float64(size)/1024)
+		} else if size < 1024*1024*1024 {
+			s = fmt.Sprintf("%.2f MiB", float64(size)/(1024*1024))
+		} else {
+			s = fmt.Sprintf("%.2f GiB", float64(size)/(1024*1024*1024))
+		}
+	}
+	return s
+}
+
+// FormatVolumes renders vols, as returned by AllVolumes, as "json", "yaml" or
+// an aligned "table".
+func FormatVolumes(vols []types.DotmeshVolume, format string) ([]byte, error) {
+	if format != FormatTable {
+		return marshalFormat(vols, format)
+	}
+	rows := [][]string{}
+	for _, v := range vols {
+		rows = append(rows, volumeCells(v))
+	}
+	return formatTable(
+		[]string{"DOT", "BRANCH", "SERVER", "SIZE", "COMMITS", "DIRTY"},
+		rows,
+	)
+}
+
+// FormatVolumesWithContainers is FormatVolumes for the result of
+// AllVolumesWithContainers; the table gains a CONTAINERS column.
+func FormatVolumesWithContainers(vols []DotmeshVolumeAndContainers, format string) ([]byte, error) {
+	if format != FormatTable {
+		return marshalFormat(vols, format)
+	}
+	rows := [][]string{}
+	for _, vc := range vols {
+		containerNames := []string{}
+		for _, container := range vc.Containers {
+			containerNames = append(containerNames, container.Name)
+		}
+		// containers go after the server, as in 'dm list'
+		cells := volumeCells(vc.Volume)
+		row := append([]string{}, cells[:3]...)
+		row = append(row, strings.Join(containerNames, ","))
+		row = append(row, cells[3:]...)
+		rows = append(rows, row)
+	}
+	return formatTable(
+		[]string{"DOT", "BRANCH", "SERVER", "CONTAINERS", "SIZE", "COMMITS", "DIRTY"},
+		rows,
+	)
+}
+
+func volumeCells(v types.DotmeshVolume) []string {
+	branch := v.Branch
+	if branch == "" {
+		branch = DefaultBranch
+	}
+	return []string{
+		v.Name.StringWithoutAdmin(), branch, v.Master,
+		PrettyPrintSize(v.SizeBytes), fmt.Sprintf("%d", v.CommitCount), PrettyPrintSize(v.DirtyBytes),
+	}
+}
+
+func marshalFormat(v interface{}, format string) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		return json.MarshalIndent(v, "", "  ")
+	case FormatYAML:
+		return yaml.Marshal(v)
+	default:
+		return nil, fmt.Errorf("Unknown format '%s', expected one of %s, %s or %s", format, FormatJSON, FormatYAML, FormatTable)
+	}
+}
+
+func formatTable(columnNames []string, rows [][]string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 3, 8, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(columnNames, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	err := w.Flush()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
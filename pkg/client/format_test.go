@@ -0,0 +1,93 @@
+package client
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+)
+
+var testVolumes = []types.DotmeshVolume{
+	{
+		Id:          "fs-1",
+		Name:        types.VolumeName{Namespace: "admin", Name: "apples"},
+		Master:      "node-1",
+		SizeBytes:   2 * 1024 * 1024,
+		CommitCount: 3,
+	},
+	{
+		Id:     "fs-2",
+		Name:   types.VolumeName{Namespace: "bob", Name: "oranges"},
+		Branch: "feature",
+		Master: "node-2",
+	},
+}
+
+func TestFormatVolumesJSON(t *testing.T) {
+	out, err := FormatVolumes(testVolumes, FormatJSON)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var decoded []types.DotmeshVolume
+	err = json.Unmarshal(out, &decoded)
+	if err != nil {
+		t.Fatalf("output isn't valid json: %s", err)
+	}
+	if len(decoded) != 2 || decoded[1].Name.Name != "oranges" {
+		t.Errorf("unexpected round trip result %+v", decoded)
+	}
+}
+
+func TestFormatVolumesYAML(t *testing.T) {
+	out, err := FormatVolumes(testVolumes, FormatYAML)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(string(out), "Id: fs-1") {
+		t.Errorf("expected yaml to use the json field names, got:\n%s", out)
+	}
+}
+
+func TestFormatVolumesTable(t *testing.T) {
+	out, err := FormatVolumes(testVolumes, FormatTable)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a header and two rows, got:\n%s", out)
+	}
+	if !strings.HasPrefix(lines[1], "apples ") || !strings.Contains(lines[1], "master") || !strings.Contains(lines[1], "2.00 MiB") {
+		t.Errorf("unexpected first row %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "bob/oranges ") || !strings.Contains(lines[2], "feature") {
+		t.Errorf("unexpected second row %q", lines[2])
+	}
+	// columns are aligned, so every row starts its BRANCH at the same offset
+	branchAt := strings.Index(lines[0], "BRANCH")
+	if strings.Index(lines[1], "master") != branchAt || strings.Index(lines[2], "feature") != branchAt {
+		t.Errorf("columns aren't aligned:\n%s", out)
+	}
+}
+
+func TestFormatVolumesWithContainersTable(t *testing.T) {
+	vcs := []DotmeshVolumeAndContainers{{
+		Volume:     testVolumes[0],
+		Containers: []Container{{Id: "c1", Name: "web"}, {Id: "c2", Name: "db"}},
+	}}
+	out, err := FormatVolumesWithContainers(vcs, FormatTable)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(string(out), "CONTAINERS") || !strings.Contains(string(out), "web,db") {
+		t.Errorf("expected container names in table, got:\n%s", out)
+	}
+}
+
+func TestFormatVolumesUnknownFormat(t *testing.T) {
+	_, err := FormatVolumes(testVolumes, "xml")
+	if err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
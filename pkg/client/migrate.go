@@ -0,0 +1,218 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// MigrateVolume moves a volume to or from peer: it transfers localBranch of
+// localFS to remoteBranch of remoteFS (with the same defaults as
+// RequestTransfer), waits for the transfer to finish, and then deletes the
+// volume it came from - the local one for a push, the remote one for a pull.
+//
+// Deleting a volume deletes all of its branches, so the source is only
+// deleted once every commit on every one of them is verified to be on the
+// destination; other branches can be moved first with plain transfers.
+// If deleting the source fails, a destination volume that the migration
+// created is deleted again, so the volume is left where it started.
+func (dm *DotmeshAPI) MigrateVolume(ctx context.Context, direction string, peer, localFS, localBranch, remoteFS, remoteBranch string) error {
+	if direction != "push" && direction != "pull" {
+		return fmt.Errorf("Volumes can only be migrated by a push or a pull, not %q", direction)
+	}
+	if dm.PushTargetCommit != "" {
+		return fmt.Errorf("Volumes can't be migrated with a target commit, every commit has to be transferred")
+	}
+	remote, err := dm.Configuration.GetRemote(peer)
+	if err != nil {
+		return err
+	}
+	if _, ok := remote.(*DMRemote); !ok {
+		return fmt.Errorf("Volumes can only be migrated to and from dotmesh remotes, and '%s' isn't one", peer)
+	}
+	peerClient, err := dm.clusterFromRemote(peer)
+	if err != nil {
+		return err
+	}
+	peerDM := NewDotmeshAPIFromClient(peerClient, dm.verbose())
+
+	localNamespace, localVolume, localBranch, remoteNamespace, remoteVolume, err := dm.transferVolumeNames(
+		direction, peer, remote, localFS, localBranch, remoteFS,
+	)
+	if err != nil {
+		return err
+	}
+	if remoteBranch == "" {
+		remoteBranch = localBranch
+	}
+
+	source := migrationEnd{dm, localNamespace + "/" + localVolume, localBranch, "this cluster"}
+	dest := migrationEnd{peerDM, remoteNamespace + "/" + remoteVolume, remoteBranch, peer}
+	if direction == "pull" {
+		source, dest = dest, source
+	}
+
+	if dm.DryRun {
+		return dm.dryRun("%sed %s to %s on %s, and then deleted it from %s", direction, source.volume, dest.volume, dest.where, source.where)
+	}
+
+	destExisted, err := dest.dm.VolumeExists(dest.volume)
+	if err != nil {
+		return fmt.Errorf("Can't tell whether %s already exists on %s: %s", dest.volume, dest.where, err)
+	}
+
+	transferId, err := dm.RequestTransfer(
+		direction, peer,
+		localNamespace+"/"+localVolume, localBranch,
+		remoteNamespace+"/"+remoteVolume, remoteBranch,
+		nil, false,
+	)
+	if err != nil {
+		return err
+	}
+	err = dm.waitForTransfer(ctx, transferId)
+	if err != nil {
+		return fmt.Errorf("Not deleting %s from %s, the transfer didn't complete: %s", source.volume, source.where, err)
+	}
+
+	err = verifyMigration(source, dest)
+	if err != nil {
+		return fmt.Errorf("Not deleting %s from %s: %s", source.volume, source.where, err)
+	}
+
+	return finishMigration(source, dest, destExisted)
+}
+
+// finishMigration deletes the source of a migration whose transfer has been
+// verified, or if that fails, deletes the destination again when the
+// migration created it and the source is certainly still there.
+func finishMigration(source, dest migrationEnd, destExisted bool) error {
+	err := source.dm.DeleteVolume(source.volume)
+	if err == nil {
+		return nil
+	}
+	deleteErr := err
+	if IsInUse(deleteErr) {
+		deleteErr = fmt.Errorf("stop the containers using it and try again: %w", deleteErr)
+	}
+	if destExisted {
+		return fmt.Errorf("%s was copied to %s, but deleting it from %s failed, so it's now on both: %w", source.volume, dest.where, source.where, deleteErr)
+	}
+	if exists, err := source.dm.VolumeExists(source.volume); err != nil || !exists {
+		// only roll back when it's certain the source is still there
+		return fmt.Errorf("Deleting %s from %s failed, and it may be gone, so the copy on %s has been kept: %w", source.volume, source.where, dest.where, deleteErr)
+	}
+	log.WithField("volume", dest.volume).Warnf("[MigrateVolume] deleting %s from %s failed, deleting the new copy on %s", source.volume, source.where, dest.where)
+	err = dest.dm.DeleteVolume(dest.volume)
+	if err != nil {
+		return fmt.Errorf("Deleting %s from %s failed (%s), and so did rolling back by deleting its copy on %s: %s", source.volume, source.where, deleteErr, dest.where, err)
+	}
+	return fmt.Errorf("Deleting %s from %s failed, so the migration was rolled back: %w", source.volume, source.where, deleteErr)
+}
+
+// migrationEnd is one side of a migration.
+type migrationEnd struct {
+	dm     *DotmeshAPI
+	volume string
+	branch string
+	where  string
+}
+
+// transferWaitInterval is how often waitForTransfer polls a transfer.
+var transferWaitInterval = time.Second
+
+// transferWaitMaxErrors is how many times in a row waitForTransfer can fail
+// to get a transfer's status before it gives up.
+var transferWaitMaxErrors = 30
+
+// waitForTransfer polls transferId, like PollTransfer without the output
+// (other than a progress bar, if ShowTransferProgress is set), until it has
+// finished or failed, or its status can't be got transferWaitMaxErrors times
+// in a row.
+func (dm *DotmeshAPI) waitForTransfer(ctx context.Context, transferId string) error {
+	started := false
+	errorCount := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(transferWaitInterval):
+		}
+		result, err := dm.GetTransferWithContext(ctx, transferId)
+		if err != nil {
+			errorCount++
+			if errorCount >= transferWaitMaxErrors {
+				return fmt.Errorf("Gave up waiting for transfer %s, its status couldn't be got %d times in a row: %w", transferId, errorCount, err)
+			}
+			log.WithError(err).WithField("transferId", transferId).Debug("[waitForTransfer] error from GetTransfer, trying again")
+			continue
+		}
+		errorCount = 0
+		if dm.ShowTransferProgress {
+			started = dm.UpdateBar(result, nil, started)
+		}
+		if result.Index == result.Total && result.Status == "finished" {
+			return nil
+		}
+		if result.Status == "error" {
+			return errors.New(result.Message)
+		}
+	}
+}
+
+// verifyMigration checks that every commit on every branch of the source
+// volume is on the destination. The branch that was transferred may have
+// a different name there; other branches are expected under their own names.
+func verifyMigration(source, dest migrationEnd) error {
+	branches, err := source.dm.Branches(source.volume)
+	if err != nil {
+		return err
+	}
+	branches = append([]string{DefaultBranch}, branches...)
+
+	missing := []string{}
+	for _, branch := range branches {
+		destBranch := branch
+		if branch == orMaster(source.branch) {
+			destBranch = orMaster(dest.branch)
+		}
+		sourceCommits, err := source.dm.ListCommits(source.volume, branch)
+		if err != nil {
+			return err
+		}
+		if len(sourceCommits) == 0 {
+			continue
+		}
+		destCommits, err := dest.dm.ListCommits(dest.volume, destBranch)
+		if err != nil {
+			missing = append(missing, fmt.Sprintf("%s (%s)", branch, err))
+			continue
+		}
+		destIds := map[string]bool{}
+		for _, commit := range destCommits {
+			destIds[commit.Id] = true
+		}
+		for _, commit := range sourceCommits {
+			if !destIds[commit.Id] {
+				missing = append(missing, branch)
+				break
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%s on %s is missing commits from these branches: %s", dest.volume, dest.where, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func orMaster(branch string) string {
+	if branch == "" {
+		return DefaultBranch
+	}
+	return branch
+}
@@ -0,0 +1,229 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+)
+
+func TestCloneFromRemote(t *testing.T) {
+	defer func(interval time.Duration) { transferWaitInterval = interval }(transferWaitInterval)
+	transferWaitInterval = 10 * time.Millisecond
+
+	var created []types.VolumeName
+	var transferred []types.TransferRequest
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string
+			Params json.RawMessage
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		switch req.Method {
+		case "DotmeshRPC.List":
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":{}}`)
+		case "DotmeshRPC.Create":
+			var name types.VolumeName
+			json.Unmarshal(req.Params, &name)
+			created = append(created, name)
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":true}`)
+		case "DotmeshRPC.Transfer":
+			var request types.TransferRequest
+			json.Unmarshal(req.Params, &request)
+			transferred = append(transferred, request)
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":"transfer-1"}`)
+		case "DotmeshRPC.GetTransfer":
+			polls++
+			if polls == 1 {
+				// a blip that's tried again
+				fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"etcd is busy"}}`)
+				return
+			}
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":{"Index":1,"Total":1,"Status":"finished"}}`)
+		default:
+			t.Errorf("unexpected call to %s", req.Method)
+		}
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "clone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dm, err := NewDotmeshAPI(filepath.Join(dir, "config"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dm.Out = ioutil.Discard
+	u, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(u.Port())
+	if err := dm.Configuration.AddRemote("local", "admin", u.Hostname(), port, "key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dm.Configuration.SetCurrentRemote("local"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dm.Configuration.AddRemote("hub", "alice", "hub.example.com", 0, "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	err = dm.CloneFromRemote(context.Background(), "hub", "apples", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 1 || created[0].Namespace != "admin" || created[0].Name != "apples" {
+		t.Errorf("expected admin/apples to be created, got %+v", created)
+	}
+	if len(transferred) != 1 {
+		t.Fatalf("expected one transfer, got %d", len(transferred))
+	}
+	request := transferred[0]
+	if request.Direction != "pull" || request.Peer != "hub.example.com" ||
+		request.LocalNamespace != "admin" || request.LocalName != "apples" ||
+		request.RemoteNamespace != "alice" || request.RemoteName != "apples" {
+		t.Errorf("expected admin/apples to be pulled from alice/apples on hub, got %+v", request)
+	}
+	if polls != 2 {
+		t.Errorf("expected the transfer to be polled until it finished, got %d polls", polls)
+	}
+	namespace, name, ok := dm.Configuration.DefaultRemoteVolumeFor("hub", "admin", "apples")
+	if !ok || namespace != "alice" || name != "apples" {
+		t.Errorf("expected alice/apples to become the default remote volume, got %q %q %v", namespace, name, ok)
+	}
+}
+
+func TestWaitForTransferGivesUp(t *testing.T) {
+	defer func(interval time.Duration, maxErrors int) {
+		transferWaitInterval, transferWaitMaxErrors = interval, maxErrors
+	}(transferWaitInterval, transferWaitMaxErrors)
+	transferWaitInterval, transferWaitMaxErrors = time.Millisecond, 3
+
+	status := ""
+	polls := 0
+	dm, closeServer := newTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		if status == "" {
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"etcd is down"}}`)
+			return
+		}
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":{"Status":%q,"Message":"50%% of disk full"}}`, status)
+	}))
+	defer closeServer()
+
+	err := dm.waitForTransfer(context.Background(), "transfer-1")
+	if err == nil || !strings.Contains(err.Error(), "etcd is down") || polls != 3 {
+		t.Errorf("expected to give up after 3 errors, got %v after %d polls", err, polls)
+	}
+
+	// the message isn't taken for a format
+	status = "error"
+	err = dm.waitForTransfer(context.Background(), "transfer-1")
+	if err == nil || err.Error() != "50% of disk full" {
+		t.Errorf("expected the transfer's error, got %v", err)
+	}
+}
+
+func TestFinishMigration(t *testing.T) {
+	inUse := `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"We cannot delete the volume fs-1 when 1 containers are still using it","data":{"Code":"VOLUME_IN_USE","Message":"We cannot delete the volume fs-1 when 1 containers are still using it"}}}`
+	deleted := `{"jsonrpc":"2.0","id":1,"result":true}`
+	listed := `{"jsonrpc":"2.0","id":1,"result":{"admin":{"db":{}}}}`
+
+	// end is a cluster with admin/db on it, which answers DotmeshRPC.Delete
+	// with deleteReply and records the calls made to it in calls
+	end := func(deleteReply string, calls *[]string) (*DotmeshAPI, func()) {
+		return newTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				Method string
+				Params types.VolumeName
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			*calls = append(*calls, req.Method)
+			switch req.Method {
+			case "DotmeshRPC.Delete":
+				if req.Params.Namespace != "admin" || req.Params.Name != "db" {
+					t.Errorf("expected admin/db to be deleted, got %+v", req.Params)
+				}
+				fmt.Fprint(w, deleteReply)
+			case "DotmeshRPC.List":
+				fmt.Fprint(w, listed)
+			default:
+				t.Errorf("unexpected call to %s", req.Method)
+			}
+		}))
+	}
+
+	for _, c := range []struct {
+		name        string
+		destExisted bool
+		sourceReply string
+		sourceCalls []string
+		destCalls   []string
+		errContains string
+	}{
+		{
+			name:        "source deleted",
+			sourceReply: deleted,
+			sourceCalls: []string{"DotmeshRPC.Delete"},
+		},
+		{
+			// the source isn't asked again, and the copy the migration made
+			// is deleted
+			name:        "source in use",
+			sourceReply: inUse,
+			sourceCalls: []string{"DotmeshRPC.Delete", "DotmeshRPC.List"},
+			destCalls:   []string{"DotmeshRPC.Delete"},
+			errContains: "so the migration was rolled back: stop the containers using it",
+		},
+		{
+			// a volume that was already there is left alone
+			name:        "source in use, destination existed",
+			destExisted: true,
+			sourceReply: inUse,
+			sourceCalls: []string{"DotmeshRPC.Delete"},
+			errContains: "so it's now on both",
+		},
+	} {
+		var sourceCalls, destCalls []string
+		sourceDM, closeSource := end(c.sourceReply, &sourceCalls)
+		destDM, closeDest := end(deleted, &destCalls)
+
+		err := finishMigration(
+			migrationEnd{sourceDM, "admin/db", "", "this cluster"},
+			migrationEnd{destDM, "admin/db", "", "hub"},
+			c.destExisted,
+		)
+		closeSource()
+		closeDest()
+
+		if c.errContains == "" && err != nil {
+			t.Errorf("%s: expected no error, got %s", c.name, err)
+		}
+		if c.errContains != "" {
+			if err == nil || !strings.Contains(err.Error(), c.errContains) {
+				t.Errorf("%s: expected an error containing %q, got %v", c.name, c.errContains, err)
+			} else if !IsInUse(err) {
+				t.Errorf("%s: expected the error to still be an in use error, got %#v", c.name, err)
+			}
+		}
+		if strings.Join(sourceCalls, ",") != strings.Join(c.sourceCalls, ",") {
+			t.Errorf("%s: expected calls %v to the source, got %v", c.name, c.sourceCalls, sourceCalls)
+		}
+		if strings.Join(destCalls, ",") != strings.Join(c.destCalls, ",") {
+			t.Errorf("%s: expected calls %v to the destination, got %v", c.name, c.destCalls, destCalls)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dotmesh-io/dotmesh/pkg/oidc"
+
+	"golang.org/x/net/context"
+)
+
+// OIDCSettings - how to log in to a remote through an OIDC provider, and the
+// refresh token that lets us do it again without asking the user
+type OIDCSettings struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string `json:",omitempty"`
+	RefreshToken string `json:",omitempty"`
+	// Expiry is when the ID token we last exchanged stops being valid; after
+	// that we refresh before talking to the remote.
+	Expiry time.Time
+}
+
+func (s *OIDCSettings) client(ctx context.Context) (*oidc.Client, error) {
+	provider, err := oidc.Discover(ctx, nil, s.IssuerURL)
+	if err != nil {
+		return nil, err
+	}
+	return &oidc.Client{
+		Provider:     provider,
+		ClientID:     s.ClientID,
+		ClientSecret: s.ClientSecret,
+	}, nil
+}
+
+// OIDCLogin logs in to alias through its OIDC provider with the device flow,
+// and stores the API key the remote issues in exchange for the ID token.
+func (c *Configuration) OIDCLogin(alias string) (*DMRemote, error) {
+	return c.oidcLogin(context.Background(), alias)
+}
+
+func (c *Configuration) oidcSettings(alias string) (DMRemote, OIDCSettings, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	remote, ok := c.DMRemotes[alias]
+	if !ok {
+		return DMRemote{}, OIDCSettings{}, fmt.Errorf("No such remote '%s'", alias)
+	}
+	if remote.OIDC == nil {
+		return DMRemote{}, OIDCSettings{}, fmt.Errorf("Remote '%s' is not set up for OIDC login", alias)
+	}
+	return *remote, *remote.OIDC, nil
+}
+
+func (c *Configuration) oidcLogin(ctx context.Context, alias string) (*DMRemote, error) {
+	remote, settings, err := c.oidcSettings(alias)
+	if err != nil {
+		return nil, err
+	}
+	oc, err := settings.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	da, err := oc.StartDeviceAuthorization(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if da.VerificationURIComplete != "" {
+		fmt.Fprintf(os.Stdout, "To log in to %s, visit %s\n", alias, da.VerificationURIComplete)
+	} else {
+		fmt.Fprintf(os.Stdout, "To log in to %s, visit %s and enter the code %s\n", alias, da.VerificationURI, da.UserCode)
+	}
+	tokens, err := oc.PollDeviceToken(ctx, da)
+	if err != nil {
+		return nil, err
+	}
+	return c.exchangeOIDCTokens(ctx, alias, remote, tokens)
+}
+
+// refreshOIDC gets a fresh API key for alias using its stored refresh token,
+// if the last ID token has expired. It does nothing for non-OIDC remotes.
+func (c *Configuration) refreshOIDC(ctx context.Context, alias string) error {
+	remote, settings, err := c.oidcSettings(alias)
+	if err != nil || settings.Expiry.After(time.Now()) {
+		// not an OIDC remote (ClusterFromRemote will report a missing one),
+		// or still logged in
+		return nil
+	}
+	if settings.RefreshToken == "" {
+		return fmt.Errorf("OIDC login to '%s' has expired, please log in again", alias)
+	}
+	oc, err := settings.client(ctx)
+	if err != nil {
+		return err
+	}
+	tokens, err := oc.Refresh(ctx, settings.RefreshToken)
+	if err != nil {
+		return fmt.Errorf("%s; please log in to '%s' again", err, alias)
+	}
+	_, err = c.exchangeOIDCTokens(ctx, alias, remote, tokens)
+	return err
+}
+
+func (c *Configuration) exchangeOIDCTokens(ctx context.Context, alias string, remote DMRemote, tokens *oidc.Tokens) (*DMRemote, error) {
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("OIDC provider did not return an ID token")
+	}
+	j := &JsonRpcClient{
+		Hostname: remote.Hostname,
+		Port:     remote.Port,
+		IDToken:  tokens.IDToken,
+	}
+	var result struct {
+		User   string
+		ApiKey string
+	}
+	err := j.CallRemote(ctx, "DotmeshRPC.ExchangeOIDCToken", struct{}{}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	expiry := tokens.IDTokenExpiry()
+	if expiry.IsZero() && tokens.ExpiresIn > 0 {
+		expiry = time.Now().Add(time.Duration(tokens.ExpiresIn) * time.Second)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	stored, ok := c.DMRemotes[alias]
+	if !ok || stored.OIDC == nil {
+		return nil, fmt.Errorf("Remote '%s' was removed while logging in", alias)
+	}
+	stored.User = result.User
+	stored.ApiKey = result.ApiKey
+	stored.OIDC.RefreshToken = tokens.RefreshToken
+	stored.OIDC.Expiry = expiry
+	err = c.save()
+	if err != nil {
+		return nil, err
+	}
+	res := new(DMRemote)
+	*res = *stored
+	return res, nil
+}
+
+// AddOIDCRemote sets up an existing remote to log in through an OIDC
+// provider, and does the first login.
+func (dm *DotmeshAPI) AddOIDCRemote(ctx context.Context, alias, issuerURL, clientID, clientSecret string) error {
+	if issuerURL == "" || clientID == "" {
+		return fmt.Errorf("Both an issuer URL and a client ID are needed for OIDC login")
+	}
+	c := dm.Configuration
+	c.lock.Lock()
+	remote, ok := c.DMRemotes[alias]
+	if !ok {
+		c.lock.Unlock()
+		return fmt.Errorf("No such remote '%s' - add it with dm remote add first", alias)
+	}
+	remote.OIDC = &OIDCSettings{
+		IssuerURL:    issuerURL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+	}
+	c.lock.Unlock()
+
+	_, err := c.oidcLogin(ctx, alias)
+	if err != nil {
+		return err
+	}
+	if c.GetCurrentRemote() == alias {
+		dm.clientMu.Lock()
+		dm.Client = nil
+		dm.clientMu.Unlock()
+	}
+	return nil
+}
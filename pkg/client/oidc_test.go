@@ -0,0 +1,30 @@
+package client
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestRefreshOIDC(t *testing.T) {
+	c := &Configuration{
+		DMRemotes: map[string]*DMRemote{
+			"plain": {User: "admin", ApiKey: "key"},
+			"fresh": {OIDC: &OIDCSettings{Expiry: time.Now().Add(time.Hour)}},
+			"stale": {OIDC: &OIDCSettings{Expiry: time.Now().Add(-time.Hour)}},
+		},
+	}
+	ctx := context.Background()
+
+	for _, alias := range []string{"plain", "fresh", "missing"} {
+		if err := c.refreshOIDC(ctx, alias); err != nil {
+			t.Errorf("expected nothing to do for %s, got %s", alias, err)
+		}
+	}
+	err := c.refreshOIDC(ctx, "stale")
+	if err == nil || !strings.Contains(err.Error(), "log in again") {
+		t.Errorf("expected an expired login without a refresh token to ask for a new login, got %v", err)
+	}
+}
@@ -26,12 +26,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/dotmesh-io/dotmesh/pkg/types"
+	"golang.org/x/crypto/ssh"
 )
 
 type Remote interface {
@@ -47,6 +52,20 @@ type S3Remote struct {
 	DefaultRemoteVolumes map[string]map[string]S3VolumeName
 }
 
+// SFTPRemote - a plain SSH server which we stream ZFS snapshots to, for users
+// with neither S3 nor a peer dotmesh cluster to push to.
+type SFTPRemote struct {
+	Hostname             string
+	Port                 int `json:",omitempty"`
+	Username             string
+	IdentityFile         string
+	RemotePath           string
+	DefaultRemoteVolumes map[string]map[string]types.VolumeName
+	// HostKey - the server's public key, in authorized_keys format, which it
+	// must present for transfers to go ahead
+	HostKey string
+}
+
 type DMRemote struct {
 	User                 string
 	Hostname             string
@@ -55,6 +74,19 @@ type DMRemote struct {
 	CurrentVolume        string
 	CurrentBranches      map[string]string
 	DefaultRemoteVolumes map[string]map[string]types.VolumeName
+	// OIDC is set for remotes logged in to with OIDCLogin
+	OIDC *OIDCSettings `json:",omitempty"`
+	// InsecureTLS skips verifying the remote's TLS certificate
+	InsecureTLS bool `json:",omitempty"`
+	// Compatibility is the last CheckCompatibility result for the remote,
+	// kept by CachedCompatibility
+	Compatibility *CompatibilityCheck `json:",omitempty"`
+}
+
+// CompatibilityCheck is a CheckCompatibility result, and when it was got.
+type CompatibilityCheck struct {
+	Result    types.CompatibilityResult
+	CheckedAt time.Time
 }
 
 func (remote DMRemote) DefaultNamespace() string {
@@ -65,6 +97,10 @@ func (remote S3Remote) DefaultNamespace() string {
 	return ""
 }
 
+func (remote SFTPRemote) DefaultNamespace() string {
+	return ""
+}
+
 // TODO is there a less hacky way of doing this? hate the duplication, but otherwise you need to cast all over the place
 func (remote *DMRemote) SetDefaultRemoteVolumeFor(localNamespace, localVolume, remoteNamespace, remoteVolume string) {
 	if remote.DefaultRemoteVolumes == nil {
@@ -145,6 +181,30 @@ func (remote *S3Remote) DefaultRemoteVolumeFor(localNamespace, localVolume strin
 	return "", "", false
 }
 
+func (remote *SFTPRemote) SetDefaultRemoteVolumeFor(localNamespace, localVolume, remoteNamespace, remoteVolume string) {
+	if remote.DefaultRemoteVolumes == nil {
+		remote.DefaultRemoteVolumes = map[string]map[string]types.VolumeName{}
+	}
+	if remote.DefaultRemoteVolumes[localNamespace] == nil {
+		remote.DefaultRemoteVolumes[localNamespace] = map[string]types.VolumeName{}
+	}
+	remote.DefaultRemoteVolumes[localNamespace][localVolume] = types.VolumeName{Namespace: remoteNamespace, Name: remoteVolume}
+}
+
+func (remote *SFTPRemote) DefaultRemoteVolumeFor(localNamespace, localVolume string) (string, string, bool) {
+	if remote.DefaultRemoteVolumes == nil {
+		remote.DefaultRemoteVolumes = map[string]map[string]types.VolumeName{}
+	}
+	if remote.DefaultRemoteVolumes[localNamespace] == nil {
+		remote.DefaultRemoteVolumes[localNamespace] = map[string]types.VolumeName{}
+	}
+	volName, ok := remote.DefaultRemoteVolumes[localNamespace][localVolume]
+	if ok {
+		return volName.Namespace, volName.Name, ok
+	}
+	return "", "", false
+}
+
 func (remote DMRemote) String() string {
 	v := reflect.ValueOf(remote)
 	toString := ""
@@ -163,15 +223,20 @@ type Configuration struct {
 	CurrentRemote string
 	DMRemotes     map[string]*DMRemote `json:"Remotes"`
 	S3Remotes     map[string]*S3Remote
-	lock          sync.Mutex
-	configPath    string
+	SFTPRemotes   map[string]*SFTPRemote
+	// SignRequests makes RPCs to dotmesh remotes signed, see
+	// JsonRpcClient.SignRequests
+	SignRequests bool `json:",omitempty"`
+	lock         sync.Mutex
+	configPath   string
 }
 
 func NewConfiguration(configPath string) (*Configuration, error) {
 	c := &Configuration{
-		configPath: configPath,
-		DMRemotes:  make(map[string]*DMRemote),
-		S3Remotes:  make(map[string]*S3Remote),
+		configPath:  configPath,
+		DMRemotes:   make(map[string]*DMRemote),
+		S3Remotes:   make(map[string]*S3Remote),
+		SFTPRemotes: make(map[string]*SFTPRemote),
 	}
 	if err := c.Load(); err != nil {
 		return nil, err
@@ -218,7 +283,10 @@ func (c *Configuration) getRemote(name string) (Remote, error) {
 	if !ok {
 		r, ok = c.S3Remotes[name]
 		if !ok {
-			return nil, fmt.Errorf("Unable to find remote '%s'", name)
+			r, ok = c.SFTPRemotes[name]
+			if !ok {
+				return nil, fmt.Errorf("Unable to find remote '%s'", name)
+			}
 		}
 	}
 	return r, nil
@@ -243,6 +311,12 @@ func (c *Configuration) GetS3Remotes() map[string]*S3Remote {
 	return c.S3Remotes
 }
 
+func (c *Configuration) GetSFTPRemotes() map[string]*SFTPRemote {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.SFTPRemotes
+}
+
 func (c *Configuration) GetCurrentRemote() string {
 	c.lock.Lock()
 	defer c.lock.Unlock()
@@ -256,6 +330,8 @@ func (c *Configuration) SetCurrentRemote(remote string) error {
 	if !ok {
 		if _, ok = c.S3Remotes[remote]; ok {
 			return fmt.Errorf("Cannot switch to remote '%s' - is an S3 remote", remote)
+		} else if _, ok = c.SFTPRemotes[remote]; ok {
+			return fmt.Errorf("Cannot switch to remote '%s' - is an SFTP remote", remote)
 		} else {
 			return fmt.Errorf("No such remote '%s'", remote)
 		}
@@ -264,6 +340,14 @@ func (c *Configuration) SetCurrentRemote(remote string) error {
 	return c.save()
 }
 
+// SetSignRequests turns request signing on or off for every dotmesh remote.
+func (c *Configuration) SetSignRequests(sign bool) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.SignRequests = sign
+	return c.save()
+}
+
 func (c *Configuration) CurrentVolume() (string, error) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
@@ -354,6 +438,15 @@ func (c *Configuration) CurrentBranchFor(volume string) (string, error) {
 	return currentBranch, nil
 }
 
+// SelectedBranchFor is the branch of volume the user last switched to, if
+// they ever have.
+func (c *Configuration) SelectedBranchFor(volume string) (string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	currentBranch, ok := c.DMRemotes[c.CurrentRemote].CurrentBranches[volume]
+	return currentBranch, ok
+}
+
 func (c *Configuration) CurrentBranch() (string, error) {
 	c.lock.Lock()
 	cur, err := c.currentVolume()
@@ -415,11 +508,30 @@ func (c *Configuration) SetCurrentBranchForVolume(volume, branch string) error {
 	return c.save()
 }
 
+// ClearCurrentBranchFor forgets which branch of volume the user switched to,
+// which is the master branch again.
+func (c *Configuration) ClearCurrentBranchFor(volume string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	_, ok := c.DMRemotes[c.CurrentRemote]
+	if !ok {
+		return fmt.Errorf(
+			"Unable to find remote '%s', which was apparently current",
+			c.CurrentRemote,
+		)
+	}
+	delete(c.DMRemotes[c.CurrentRemote].CurrentBranches, volume)
+	return c.save()
+}
+
 func (c *Configuration) RemoteExists(remote string) bool {
 	_, ok := c.DMRemotes[remote]
 	if !ok {
 		_, ok = c.S3Remotes[remote]
 	}
+	if !ok {
+		_, ok = c.SFTPRemotes[remote]
+	}
 	return ok
 }
 
@@ -436,6 +548,59 @@ func (c *Configuration) AddS3Remote(remote, keyID, secretKey, endpoint string) e
 	return c.save()
 }
 
+func (c *Configuration) AddSFTPRemote(remote, username, hostname string, port int, identityFile, hostKey, remotePath string) error {
+	ok := c.RemoteExists(remote)
+	if ok {
+		return fmt.Errorf("Remote exists '%s'", remote)
+	}
+	_, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostKey))
+	if err != nil {
+		return fmt.Errorf("Invalid host key '%s', expected e.g. 'ssh-ed25519 AAAA...': %s", hostKey, err)
+	}
+	if c.SFTPRemotes == nil {
+		c.SFTPRemotes = make(map[string]*SFTPRemote)
+	}
+	c.SFTPRemotes[remote] = &SFTPRemote{
+		Hostname:     hostname,
+		Port:         port,
+		Username:     username,
+		IdentityFile: identityFile,
+		HostKey:      hostKey,
+		RemotePath:   remotePath,
+	}
+	return c.save()
+}
+
+// ParseSFTPRemoteURL - parses sftp://user@host[:port]/path into an SFTP
+// remote called remote, using the private key in identityFile and expecting
+// the server to have hostKey, and stores it in the configuration.
+func (c *Configuration) ParseSFTPRemoteURL(remote, rawURL, identityFile, hostKey string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("Unable to parse SFTP URL '%s': %s", rawURL, err)
+	}
+	if u.Scheme != "sftp" {
+		return fmt.Errorf("Please specify an sftp:// URL, got '%s'", rawURL)
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return fmt.Errorf("Please specify a user in the SFTP URL, e.g. sftp://user@host/path")
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("Please specify a host in the SFTP URL, e.g. sftp://user@host/path")
+	}
+	if u.Path == "" || u.Path == "/" {
+		return fmt.Errorf("Please specify a remote path in the SFTP URL, e.g. sftp://user@host/path")
+	}
+	var port int
+	if u.Port() != "" {
+		port, err = strconv.Atoi(u.Port())
+		if err != nil {
+			return fmt.Errorf("Invalid port '%s' in SFTP URL: %s", u.Port(), err)
+		}
+	}
+	return c.AddSFTPRemote(remote, u.User.Username(), u.Hostname(), port, identityFile, hostKey, u.Path)
+}
+
 func (c *Configuration) AddRemote(remote, user, hostname string, port int, apiKey string) error {
 	ok := c.RemoteExists(remote)
 	if ok {
@@ -450,12 +615,64 @@ func (c *Configuration) AddRemote(remote, user, hostname string, port int, apiKe
 	return c.save()
 }
 
+// SetApiKeyForRemote replaces the API key stored for a dotmesh remote, e.g.
+// after it's been rotated.
+func (c *Configuration) SetApiKeyForRemote(remote, apiKey string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	remoteCreds, ok := c.DMRemotes[remote]
+	if !ok {
+		return fmt.Errorf("No such remote '%s'", remote)
+	}
+	remoteCreds.ApiKey = apiKey
+	return c.save()
+}
+
+// CompatibilityFor returns the compatibility check last saved for a dotmesh
+// remote, if there is one.
+func (c *Configuration) CompatibilityFor(remote string) (CompatibilityCheck, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	remoteCreds, ok := c.DMRemotes[remote]
+	if !ok || remoteCreds.Compatibility == nil {
+		return CompatibilityCheck{}, false
+	}
+	return *remoteCreds.Compatibility, true
+}
+
+// SetCompatibilityFor saves a compatibility check for a dotmesh remote.
+func (c *Configuration) SetCompatibilityFor(remote string, check CompatibilityCheck) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	remoteCreds, ok := c.DMRemotes[remote]
+	if !ok {
+		return fmt.Errorf("No such remote '%s'", remote)
+	}
+	remoteCreds.Compatibility = &check
+	return c.save()
+}
+
+// SetInsecureTLSForRemote turns verifying a dotmesh remote's TLS certificate
+// off (or back on), for servers with self-signed certificates.
+func (c *Configuration) SetInsecureTLSForRemote(remote string, insecure bool) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	remoteCreds, ok := c.DMRemotes[remote]
+	if !ok {
+		return fmt.Errorf("No such remote '%s'", remote)
+	}
+	remoteCreds.InsecureTLS = insecure
+	return c.save()
+}
+
 func (c *Configuration) RemoveRemote(remote string) error {
 	_, ok := c.DMRemotes[remote]
 	if !ok {
 		_, ok = c.S3Remotes[remote]
 		if ok {
 			delete(c.S3Remotes, remote)
+		} else if _, ok = c.SFTPRemotes[remote]; ok {
+			delete(c.SFTPRemotes, remote)
 		} else {
 			return fmt.Errorf("No such remote '%s'", remote)
 		}
@@ -468,6 +685,73 @@ func (c *Configuration) RemoveRemote(remote string) error {
 	return c.save()
 }
 
+// RenameRemote renames a remote of any type, keeping it current if it was.
+func (c *Configuration) RenameRemote(oldName, newName string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if newName == "" {
+		return fmt.Errorf("Please give the remote a new name")
+	}
+	if !c.RemoteExists(oldName) {
+		return fmt.Errorf("No such remote '%s'", oldName)
+	}
+	if c.RemoteExists(newName) {
+		return fmt.Errorf("Remote exists '%s'", newName)
+	}
+	if r, ok := c.DMRemotes[oldName]; ok {
+		c.DMRemotes[newName] = r
+		delete(c.DMRemotes, oldName)
+	} else if r, ok := c.S3Remotes[oldName]; ok {
+		c.S3Remotes[newName] = r
+		delete(c.S3Remotes, oldName)
+	} else {
+		c.SFTPRemotes[newName] = c.SFTPRemotes[oldName]
+		delete(c.SFTPRemotes, oldName)
+	}
+	if c.CurrentRemote == oldName {
+		c.CurrentRemote = newName
+	}
+	return c.save()
+}
+
+// RemoteInfos lists every remote, sorted by name, without credentials.
+func (c *Configuration) RemoteInfos() []types.RemoteInfo {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	infos := []types.RemoteInfo{}
+	for name, r := range c.DMRemotes {
+		infos = append(infos, types.RemoteInfo{
+			Name:             name,
+			Type:             "dotmesh",
+			Hostname:         r.Hostname,
+			User:             r.User,
+			HasAPIKey:        r.ApiKey != "",
+			DefaultNamespace: r.DefaultNamespace(),
+		})
+	}
+	for name, r := range c.S3Remotes {
+		infos = append(infos, types.RemoteInfo{
+			Name:             name,
+			Type:             "s3",
+			Hostname:         r.Endpoint,
+			User:             r.KeyID,
+			HasAPIKey:        r.SecretKey != "",
+			DefaultNamespace: r.DefaultNamespace(),
+		})
+	}
+	for name, r := range c.SFTPRemotes {
+		infos = append(infos, types.RemoteInfo{
+			Name:             name,
+			Type:             "sftp",
+			Hostname:         r.Hostname,
+			User:             r.Username,
+			DefaultNamespace: r.DefaultNamespace(),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
 func (c *Configuration) CredsForRemote(remote string) (*DMRemote, error) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
@@ -489,11 +773,13 @@ func (c *Configuration) ClusterFromRemote(remote string, verbose bool) (*JsonRpc
 		return nil, fmt.Errorf("No such remote '%s'", remote)
 	}
 	return &JsonRpcClient{
-		User:     remoteCreds.User,
-		Hostname: remoteCreds.Hostname,
-		Port:     remoteCreds.Port,
-		ApiKey:   remoteCreds.ApiKey,
-		Verbose:  verbose,
+		User:         remoteCreds.User,
+		Hostname:     remoteCreds.Hostname,
+		Port:         remoteCreds.Port,
+		ApiKey:       remoteCreds.ApiKey,
+		Verbose:      verbose,
+		SignRequests: c.SignRequests,
+		InsecureTLS:  remoteCreds.InsecureTLS,
 	}, nil
 }
 
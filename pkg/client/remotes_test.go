@@ -0,0 +1,129 @@
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+	"golang.org/x/net/context"
+)
+
+const testSFTPHostKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIEPbrFlaNg3ALrgIRQfEFDk6f3klry6uPwbexdKpEz48"
+
+func TestRemotesConfiguration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remotes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configPath := filepath.Join(dir, "config")
+
+	dm, err := NewDotmeshAPI(configPath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dm.Configuration.AddRemote("origin", "alice", "dothub.com", 0, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dm.Configuration.AddS3Remote("backups", "AKIA", "s3secret", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := dm.Configuration.AddSFTPRemote("archive", "bob", "files.example.com", 22, "/id_rsa", "", "/srv"); err == nil {
+		t.Fatal("expected an SFTP remote without a host key to be refused")
+	}
+	if err := dm.Configuration.AddSFTPRemote("archive", "bob", "files.example.com", 22, "/id_rsa", testSFTPHostKey, "/srv"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dm.Configuration.SetCurrentRemote("origin"); err != nil {
+		t.Fatal(err)
+	}
+
+	remotes, err := dm.ListRemotes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []types.RemoteInfo{
+		{Name: "archive", Type: "sftp", Hostname: "files.example.com", User: "bob"},
+		{Name: "backups", Type: "s3", User: "AKIA", HasAPIKey: true},
+		{Name: "origin", Type: "dotmesh", Hostname: "dothub.com", User: "alice", HasAPIKey: true, DefaultNamespace: "alice"},
+	}
+	if !reflect.DeepEqual(remotes, expected) {
+		t.Errorf("expected remotes %+v, got %+v", expected, remotes)
+	}
+
+	if err := dm.RenameRemote("origin", "backups"); err == nil {
+		t.Error("expected renaming onto an existing remote to fail")
+	}
+	if err := dm.RenameRemote("missing", "other"); err == nil {
+		t.Error("expected renaming a missing remote to fail")
+	}
+	if err := dm.RenameRemote("origin", "hub"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dm.RemoveRemote("archive"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The changes are saved, and the renamed remote is still current
+	reloaded, err := NewConfiguration(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.CurrentRemote != "hub" {
+		t.Errorf("expected the current remote to be renamed to hub, got %q", reloaded.CurrentRemote)
+	}
+	names := []string{}
+	for _, info := range reloaded.RemoteInfos() {
+		names = append(names, info.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"backups", "hub"}) {
+		t.Errorf("expected remotes backups and hub, got %v", names)
+	}
+}
+
+func TestInsecureTLSRemote(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "remotes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dm, err := NewDotmeshAPI(filepath.Join(dir, "config"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dm.Configuration.AddRemote("selfsigned", "admin", "localhost", 0, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dm.Configuration.AddRemote("verified", "admin", "localhost", 0, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dm.Configuration.SetInsecureTLSForRemote("selfsigned", true); err != nil {
+		t.Fatal(err)
+	}
+
+	insecure, err := dm.clusterFromRemote("selfsigned")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := insecure.httpClient().Get(server.URL)
+	if err != nil {
+		t.Fatalf("expected a remote with InsecureTLS to accept a self-signed certificate, got %s", err)
+	}
+	resp.Body.Close()
+
+	verified, err := dm.clusterFromRemote("verified")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verified.httpClient().Get(server.URL); err == nil {
+		t.Error("expected other remotes to verify certificates")
+	}
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"runtime"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
+)
+
+const tracerName = "github.com/dotmesh-io/dotmesh/pkg/client"
+
+// NewDotmeshAPIWithTracing is NewDotmeshAPI, but every call the API makes to
+// the server is recorded as an OpenTelemetry span from tp, and the span's
+// context is passed on to the server in a traceparent header.
+func NewDotmeshAPIWithTracing(configPath string, verbose bool, tp trace.TracerProvider) (*DotmeshAPI, error) {
+	d, err := NewDotmeshAPI(configPath, verbose)
+	if err != nil {
+		return nil, err
+	}
+	if tp != nil {
+		d.tracer = tp.Tracer(tracerName)
+	}
+	return d, nil
+}
+
+// startSpan starts a span named dotmesh.{MethodName}, where MethodName is the
+// public DotmeshAPI method that's making the RPC. It's a no-op when no tracer
+// was configured.
+func (dm *DotmeshAPI) startSpan(ctx context.Context, rpcMethod string) (context.Context, func(error)) {
+	if dm.tracer == nil {
+		return ctx, func(error) {}
+	}
+	apiMethod := callingAPIMethod()
+	ctx, span := dm.tracer.Start(ctx, "dotmesh."+apiMethod)
+	attributes := []attribute.KeyValue{
+		attribute.String("dotmesh.method", apiMethod),
+		attribute.String("dotmesh.rpc_method", rpcMethod),
+	}
+	if dm.Client != nil {
+		attributes = append(attributes, attribute.String("dotmesh.hostname", dm.Client.Hostname))
+	}
+	span.SetAttributes(attributes...)
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		} else {
+			span.SetStatus(codes.Ok, "")
+		}
+		span.End()
+	}
+}
+
+// callingAPIMethod walks up the stack to the outermost exported DotmeshAPI
+// method, so that e.g. DeleteVolume's span isn't named after the
+// DeleteVolumeFromStruct it calls.
+func callingAPIMethod() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	method := "CallRemote"
+	for {
+		frame, more := frames.Next()
+		const prefix = "pkg/client.(*DotmeshAPI)."
+		if i := strings.Index(frame.Function, prefix); i >= 0 {
+			name := frame.Function[i+len(prefix):]
+			if name != "" && strings.ToUpper(name[:1]) == name[:1] && !strings.Contains(name, ".") {
+				method = name
+			}
+		}
+		if !more {
+			break
+		}
+	}
+	return method
+}
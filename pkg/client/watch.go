@@ -0,0 +1,395 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+)
+
+// WatchVolume streams the commits made on branch of vol as they happen. If
+// since is a commit ID, the commits after it are sent first; if it's empty,
+// only commits made from now on are. Both channels are closed when ctx is
+// cancelled, or after an error has been sent.
+func (dm *DotmeshAPI) WatchVolume(ctx context.Context, vol types.VolumeName, branch string, since string) (<-chan types.Snapshot, <-chan error) {
+	snapshots := make(chan types.Snapshot)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(snapshots)
+		defer close(errs)
+
+		err := dm.watchVolume(ctx, vol, branch, since, snapshots)
+		if err != nil && ctx.Err() == nil {
+			errs <- err
+		}
+	}()
+
+	return snapshots, errs
+}
+
+func (dm *DotmeshAPI) watchVolume(ctx context.Context, vol types.VolumeName, branch string, since string, snapshots chan<- types.Snapshot) error {
+	if branch == "" {
+		branch = DefaultBranch
+	}
+	path := fmt.Sprintf(
+		"/volumes/%s/%s/branches/%s/watch",
+		url.PathEscape(vol.Namespace), url.PathEscape(vol.Name), url.PathEscape(branch),
+	)
+	if since != "" {
+		path += "?since=" + url.QueryEscape(since)
+	}
+
+	body, err := dm.openEventStream(ctx, path, fmt.Sprintf("watching %s", vol))
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return readSnapshotEvents(ctx, body, snapshots)
+}
+
+// WatchLastModified polls LastModified every interval, and sends the result
+// whenever its time changes (but not the first one, which it's compared
+// with). Both channels are closed when ctx is cancelled, or after an error
+// has been sent.
+func (dm *DotmeshAPI) WatchLastModified(ctx context.Context, namespace, name string, interval time.Duration) (<-chan types.LastModified, <-chan error) {
+	modifications := make(chan types.LastModified)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(modifications)
+		defer close(errs)
+
+		previous, err := dm.LastModified(namespace, name)
+		if err != nil {
+			errs <- err
+			return
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			latest, err := dm.LastModified(namespace, name)
+			if err != nil {
+				if ctx.Err() == nil {
+					errs <- err
+				}
+				return
+			}
+			if latest.Time.Equal(previous.Time) {
+				continue
+			}
+			previous = latest
+			select {
+			case modifications <- *latest:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return modifications, errs
+}
+
+// WatchLastModifiedLong is WatchLastModified, but with the server watching
+// for changes and streaming them over one long-lived connection, rather than
+// the client polling.
+func (dm *DotmeshAPI) WatchLastModifiedLong(ctx context.Context, namespace, name string) (<-chan types.LastModified, <-chan error) {
+	modifications := make(chan types.LastModified)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(modifications)
+		defer close(errs)
+
+		err := dm.watchLastModified(ctx, namespace, name, modifications)
+		if err != nil && ctx.Err() == nil {
+			errs <- err
+		}
+	}()
+
+	return modifications, errs
+}
+
+func (dm *DotmeshAPI) watchLastModified(ctx context.Context, namespace, name string, modifications chan<- types.LastModified) error {
+	path := fmt.Sprintf("/volumes/%s/%s/watch-modified", url.PathEscape(namespace), url.PathEscape(name))
+	body, err := dm.openEventStream(ctx, path, fmt.Sprintf("watching %s/%s for modifications", namespace, name))
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return readServerSentEvents(ctx, body, func(data []byte) error {
+		var lastModified types.LastModified
+		err := json.Unmarshal(data, &lastModified)
+		if err != nil {
+			return fmt.Errorf("Error decoding modification time from watch stream: %s", err)
+		}
+		select {
+		case modifications <- lastModified:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+// watchRetryInterval is how long WatchAllVolumes first waits before asking
+// again after an error, doubling each time up to watchMaxRetryInterval. It
+// gives up after watchMaxErrors errors in a row.
+var watchRetryInterval = time.Second
+
+var watchMaxErrors = 10
+
+const watchMaxRetryInterval = 30 * time.Second
+
+// WatchAllVolumes polls AllVolumes every interval, and sends the volumes
+// every time a volume's been added or removed or its commit count has
+// changed, starting with the first list. Errors are retried, backing off
+// exponentially, until there have been watchMaxErrors in a row. Both channels
+// are closed when ctx is cancelled, or after an error has been sent.
+func (dm *DotmeshAPI) WatchAllVolumes(ctx context.Context, interval time.Duration) (<-chan []types.DotmeshVolume, <-chan error) {
+	lists := make(chan []types.DotmeshVolume)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(lists)
+		defer close(errs)
+
+		previous := ""
+		first := true
+		wait := time.Duration(0)
+		errorCount := 0
+		retryInterval := watchRetryInterval
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+			volumes, err := dm.AllVolumes()
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				errorCount++
+				if errorCount >= watchMaxErrors {
+					errs <- fmt.Errorf("gave up watching the volumes after %d errors in a row: %w", errorCount, err)
+					return
+				}
+				dm.log().WithError(err).Debugf("[WatchAllVolumes] error listing volumes, trying again in %s", retryInterval)
+				wait = retryInterval
+				retryInterval *= 2
+				if retryInterval > watchMaxRetryInterval {
+					retryInterval = watchMaxRetryInterval
+				}
+				continue
+			}
+			errorCount = 0
+			retryInterval = watchRetryInterval
+			wait = interval
+
+			summary := volumesSummary(volumes)
+			if !first && summary == previous {
+				continue
+			}
+			first = false
+			previous = summary
+			select {
+			case lists <- volumes:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return lists, errs
+}
+
+// volumesSummary is what WatchAllVolumes compares lists of volumes by: each
+// one's name and commit count.
+func volumesSummary(volumes []types.DotmeshVolume) string {
+	summaries := make([]string, len(volumes))
+	for i, volume := range volumes {
+		summaries[i] = fmt.Sprintf("%s/%s@%d", volume.Name.Namespace, volume.Name.Name, volume.CommitCount)
+	}
+	sort.Strings(summaries)
+	return strings.Join(summaries, "\n")
+}
+
+// WatchClusterEvents streams what happens to the volumes the user can see,
+// anywhere on the cluster, from now on: volumes created and deleted, commits
+// added and transfers started, finished and failed. Both channels are closed
+// when ctx is cancelled, or after an error has been sent.
+func (dm *DotmeshAPI) WatchClusterEvents(ctx context.Context) (<-chan types.ClusterEvent, <-chan error) {
+	events := make(chan types.ClusterEvent)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(events)
+		defer close(errs)
+
+		err := dm.watchClusterEvents(ctx, events)
+		if err != nil && ctx.Err() == nil {
+			errs <- err
+		}
+	}()
+
+	return events, errs
+}
+
+func (dm *DotmeshAPI) watchClusterEvents(ctx context.Context, events chan<- types.ClusterEvent) error {
+	body, err := dm.openEventStream(ctx, "/events", "watching the cluster's events")
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return readServerSentEvents(ctx, body, func(data []byte) error {
+		var event types.ClusterEvent
+		err := json.Unmarshal(data, &event)
+		if err != nil {
+			return fmt.Errorf("Error decoding event from watch stream: %s", err)
+		}
+		select {
+		case events <- event:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+// openEventStream makes a GET request for path on the server, which answers
+// with a stream of Server-Sent Events, and returns the stream for the caller
+// to close. doing describes the request, for errors.
+func (dm *DotmeshAPI) openEventStream(ctx context.Context, path, doing string) (io.ReadCloser, error) {
+	resp, err := dm.openStream(ctx, path, "text/event-stream", doing)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// errStreamNotFound is returned, wrapped, by openStream when the server
+// responds 404, as older ones will for paths they don't have.
+var errStreamNotFound = errors.New("not found")
+
+// openStream makes a GET request for path on the server, accepting a stream
+// of the content type accept, and returns the response for the caller to
+// close its body. doing describes the request, for errors.
+func (dm *DotmeshAPI) openStream(ctx context.Context, path, accept, doing string) (*http.Response, error) {
+	return dm.streamRequest(ctx, "GET", path, nil, accept, doing)
+}
+
+// streamRequest is openStream for any HTTP method, sending body with the
+// request if it isn't nil.
+func (dm *DotmeshAPI) streamRequest(ctx context.Context, method, path string, body io.Reader, accept, doing string) (*http.Response, error) {
+	err := dm.openClient()
+	if err != nil {
+		return nil, err
+	}
+	base, err := dm.Client.serverURL(ctx)
+	if dm.circuit != nil {
+		dm.circuit.record(dm.Client.Hostname, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(method, base+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	dm.Client.setAuth(req)
+	req.Header.Set("Accept", accept)
+
+	// no timeout, the stream stays open until it ends or ctx is cancelled
+	resp, err := dm.Client.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("Error %s: %w: %s", doing, errStreamNotFound, strings.TrimSpace(string(body)))
+		}
+		return nil, fmt.Errorf("Error %s: %s %s", doing, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+// readSnapshotEvents decodes the data of each Server-Sent Event in r as a
+// Snapshot and sends it on snapshots, until r ends or ctx is cancelled.
+func readSnapshotEvents(ctx context.Context, r io.Reader, snapshots chan<- types.Snapshot) error {
+	return readServerSentEvents(ctx, r, func(data []byte) error {
+		var snapshot types.Snapshot
+		err := json.Unmarshal(data, &snapshot)
+		if err != nil {
+			return fmt.Errorf("Error decoding commit from watch stream: %s", err)
+		}
+		select {
+		case snapshots <- snapshot:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+// readServerSentEvents calls handle with the data of each Server-Sent Event
+// in r, until r ends, ctx is cancelled or handle returns an error.
+func readServerSentEvents(ctx context.Context, r io.Reader, handle func(data []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	// commit metadata can make for long lines
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var data bytes.Buffer
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" {
+			// lines starting with ':' are comments, e.g. keepalives
+			if strings.HasPrefix(line, "data:") {
+				if data.Len() > 0 {
+					data.WriteByte('\n')
+				}
+				data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+			}
+			continue
+		}
+		// a blank line ends an event
+		if data.Len() == 0 {
+			continue
+		}
+		err := handle(data.Bytes())
+		data.Reset()
+		if err != nil {
+			return err
+		}
+	}
+	err := scanner.Err()
+	if err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return fmt.Errorf("Watch stream closed by the server")
+}
@@ -0,0 +1,218 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+)
+
+func TestReadSnapshotEvents(t *testing.T) {
+	stream := strings.Join([]string{
+		`data: {"Id":"a","Metadata":{"message":"first"}}`,
+		``,
+		`: keepalive`,
+		``,
+		`data: {"Id":"b","Metadata":{"message":"second"}}`,
+		``,
+		// unterminated, so never sent
+		`data: {"Id":"c"}`,
+	}, "\n")
+
+	snapshots := make(chan types.Snapshot, 10)
+	err := readSnapshotEvents(context.Background(), strings.NewReader(stream), snapshots)
+	if err == nil || !strings.Contains(err.Error(), "closed by the server") {
+		t.Errorf("expected the end of the stream to be reported, got %v", err)
+	}
+	close(snapshots)
+
+	ids := []string{}
+	for snapshot := range snapshots {
+		ids = append(ids, snapshot.Id)
+	}
+	if strings.Join(ids, ",") != "a,b" {
+		t.Errorf("expected commits a,b, got %v", ids)
+	}
+}
+
+func TestReadSnapshotEventsBadData(t *testing.T) {
+	snapshots := make(chan types.Snapshot, 1)
+	err := readSnapshotEvents(context.Background(), strings.NewReader("data: nope\n\n"), snapshots)
+	if err == nil || !strings.Contains(err.Error(), "Error decoding commit") {
+		t.Errorf("expected a decoding error, got %v", err)
+	}
+}
+
+func TestReadSnapshotEventsCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// unbuffered and never read, so only cancellation can unblock it
+	snapshots := make(chan types.Snapshot)
+	err := readSnapshotEvents(ctx, strings.NewReader("data: {\"Id\":\"a\"}\n\n"), snapshots)
+	if err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestWatchLastModified(t *testing.T) {
+	// the volume is modified on the third poll, and not again
+	times := []string{"2019-10-15T11:01:00Z", "2019-10-15T11:01:00Z", "2019-10-15T11:05:00Z"}
+	var polls int32
+	dm, closeServer := newTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&polls, 1)) - 1
+		if n >= len(times) {
+			n = len(times) - 1
+		}
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":{"Time":%q}}`, times[n])
+	}))
+	defer closeServer()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	modifications, errs := dm.WatchLastModified(ctx, "admin", "vol", 10*time.Millisecond)
+
+	select {
+	case modified := <-modifications:
+		expected, _ := time.Parse(time.RFC3339, times[2])
+		if !modified.Time.Equal(expected) {
+			t.Errorf("expected the modification at %s, got %s", expected, modified.Time)
+		}
+	case err := <-errs:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the modification")
+	}
+
+	select {
+	case modified, ok := <-modifications:
+		if ok {
+			t.Errorf("expected no more modifications, got %+v", modified)
+		}
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	cancel()
+	for range modifications {
+	}
+	if err, ok := <-errs; ok {
+		t.Errorf("expected cancelling to close the channels without an error, got %v", err)
+	}
+}
+
+func TestWatchClusterEvents(t *testing.T) {
+	dm, closeServer := newTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/events" {
+			t.Errorf("expected a request for /events, got %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"Type\":\"VolumeCreated\",\"Volume\":{\"Namespace\":\"admin\",\"Name\":\"vol\"}}\n\n")
+		fmt.Fprint(w, ": keepalive\n\n")
+		fmt.Fprint(w, "data: {\"Type\":\"CommitAdded\",\"Volume\":{\"Namespace\":\"admin\",\"Name\":\"vol\"},\"CommitID\":\"a\"}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer closeServer()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, errs := dm.WatchClusterEvents(ctx)
+	received := []types.ClusterEvent{}
+	for len(received) < 2 {
+		select {
+		case event := <-events:
+			received = append(received, event)
+		case err := <-errs:
+			t.Fatal(err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for events")
+		}
+	}
+
+	cancel()
+	for range events {
+	}
+	if err, ok := <-errs; ok {
+		t.Errorf("expected cancelling to close the channels without an error, got %v", err)
+	}
+
+	if received[0].Type != types.ClusterEventVolumeCreated || received[0].Volume.Name != "vol" {
+		t.Errorf("expected vol to be created, got %+v", received[0])
+	}
+	if received[1].Type != types.ClusterEventCommitAdded || received[1].CommitID != "a" {
+		t.Errorf("expected commit a to be added, got %+v", received[1])
+	}
+}
+
+func TestStreamsSendIDToken(t *testing.T) {
+	dm, closeServer := newTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer token" {
+			http.Error(w, "expected the ID token, got "+got, http.StatusUnauthorized)
+		}
+	}))
+	defer closeServer()
+	dm.Client.IDToken = "token"
+
+	resp, err := dm.openStream(context.Background(), "/events", "text/event-stream", "watching the cluster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+func TestWatchAllVolumesRetries(t *testing.T) {
+	defer func(interval time.Duration, maxErrors int) {
+		watchRetryInterval, watchMaxErrors = interval, maxErrors
+	}(watchRetryInterval, watchMaxErrors)
+	watchRetryInterval, watchMaxErrors = time.Millisecond, 3
+
+	// two blips before the list, then the server goes away for good
+	var polls int32
+	dm, closeServer := newTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&polls, 1)
+		if n == 3 {
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":{"admin":{"vol":{"Name":{"Namespace":"admin","Name":"vol"},"CommitCount":2}}}}`)
+			return
+		}
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"etcd is down"}}`)
+	}))
+	defer closeServer()
+
+	lists, errs := dm.WatchAllVolumes(context.Background(), 10*time.Millisecond)
+	select {
+	case volumes := <-lists:
+		if len(volumes) != 1 || volumes[0].Name.Name != "vol" {
+			t.Errorf("expected vol to be listed, got %+v", volumes)
+		}
+	case err := <-errs:
+		t.Fatalf("expected the errors before the list to be retried, got %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the list")
+	}
+
+	for range lists {
+	}
+	err := <-errs
+	if err == nil || !strings.Contains(err.Error(), "etcd is down") {
+		t.Errorf("expected to give up after 3 errors in a row, got %v", err)
+	}
+	if n := atomic.LoadInt32(&polls); n != 6 {
+		t.Errorf("expected 6 polls, got %d", n)
+	}
+}
+
+func TestVolumesSummary(t *testing.T) {
+	a := types.DotmeshVolume{Name: types.VolumeName{Namespace: "admin", Name: "a"}, CommitCount: 1}
+	b := types.DotmeshVolume{Name: types.VolumeName{Namespace: "admin", Name: "b"}, CommitCount: 2}
+	if volumesSummary([]types.DotmeshVolume{a, b}) != volumesSummary([]types.DotmeshVolume{b, a}) {
+		t.Error("expected the order of the volumes not to matter")
+	}
+	committed := b
+	committed.CommitCount = 3
+	if volumesSummary([]types.DotmeshVolume{a, b}) == volumesSummary([]types.DotmeshVolume{a, committed}) {
+		t.Error("expected a commit to change the summary")
+	}
+}
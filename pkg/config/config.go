@@ -24,6 +24,35 @@ type (
 			URL             string     `envconfig:"DOTMESH_UPGRADES_URL"`
 			IntervalSeconds DefaultInt `default:"300" envconfig:"DOTMESH_UPGRADES_INTERVAL_SECONDS"`
 		}
+
+		RPC struct {
+			// RateLimit is per API key, with a token bucket that holds
+			// Burst requests and refills at RequestsPerSecond. 0
+			// RequestsPerSecond means no limit.
+			RateLimit struct {
+				RequestsPerSecond DefaultInt `default:"100" envconfig:"DOTMESH_RPC_RATE_LIMIT_REQUESTS_PER_SECOND"`
+				Burst             DefaultInt `default:"20" envconfig:"DOTMESH_RPC_RATE_LIMIT_BURST"`
+			}
+			// RequireSignedRequests rejects RPCs authenticated with a
+			// username and API key that don't carry a request signature,
+			// see pkg/crypto/signature.go
+			RequireSignedRequests DefaultBool `default:"false" envconfig:"DOTMESH_RPC_REQUIRE_SIGNED_REQUESTS"`
+		}
+
+		Transfers struct {
+			// MaxConcurrent transfers started by this node, the rest are
+			// queued. 0 means no limit.
+			MaxConcurrent DefaultInt `default:"0" envconfig:"DOTMESH_TRANSFER_MAX_CONCURRENT"`
+			// HistorySize is how many finished and failed transfers are kept
+			// for ListTransfers, at most 1000.
+			HistorySize DefaultInt `default:"1000" envconfig:"DOTMESH_TRANSFER_HISTORY_SIZE"`
+		}
+
+		RetentionPolicies struct {
+			// Interval between enforcements of branches' retention
+			// policies
+			Interval DefaultDuration `default:"10m" envconfig:"DOTMESH_RETENTION_POLICY_INTERVAL"`
+		}
 	}
 )
 
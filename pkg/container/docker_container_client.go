@@ -21,6 +21,14 @@ type Client interface {
 type DockerContainer struct {
 	Name string
 	Id   string
+	// Mounts are where the container has the filesystem it's listed
+	// against mounted, as found by AllRelated
+	Mounts []DockerMount `json:",omitempty"`
+}
+
+type DockerMount struct {
+	Destination string
+	ReadOnly    bool
 }
 
 type Options struct {
@@ -83,14 +91,14 @@ func (d *DockerClient) AllRelated() (map[string][]DockerContainer, error) {
 			if err != nil {
 				return map[string][]DockerContainer{}, err
 			}
-			for _, filesystem := range filesystems {
+			for filesystem, mounts := range filesystems {
 				_, ok := relatedContainers[filesystem]
 				if !ok {
 					relatedContainers[filesystem] = []DockerContainer{}
 				}
 				relatedContainers[filesystem] = append(
 					relatedContainers[filesystem],
-					DockerContainer{Id: container.ID, Name: container.Name},
+					DockerContainer{Id: container.ID, Name: container.Name, Mounts: mounts},
 				)
 			}
 		}
@@ -149,10 +157,11 @@ func (d *DockerClient) findDotRoot(path string) string {
 	}
 }
 
-// Given a container, return a list of filesystem ids of dotmesh volumes that
-// are currently in-use by it (by resolving the symlinks of its mount sources).
-func (d *DockerClient) relatedFilesystems(container *docker.Container) ([]string, error) {
-	result := []string{}
+// Given a container, return the filesystem ids of dotmesh volumes that are
+// currently in-use by it (by resolving the symlinks of its mount sources),
+// and where in the container each is mounted.
+func (d *DockerClient) relatedFilesystems(container *docker.Container) (map[string][]DockerMount, error) {
+	result := map[string][]DockerMount{}
 	for _, mount := range container.Mounts {
 		if mount.Driver != "dm" {
 			continue
@@ -168,7 +177,10 @@ func (d *DockerClient) relatedFilesystems(container *docker.Container) ([]string
 		shrapnel := strings.Split(target, "/")
 		if len(shrapnel) > 1 {
 			filesystemId := shrapnel[len(shrapnel)-1]
-			result = append(result, filesystemId)
+			result[filesystemId] = append(result[filesystemId], DockerMount{
+				Destination: mount.Destination,
+				ReadOnly:    !mount.RW,
+			})
 		}
 	}
 	return result, nil
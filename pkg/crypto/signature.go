@@ -0,0 +1,53 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Signed requests carry an HMAC of the RPC method, the JSON body and the time
+// they were made, keyed with the API key they authenticate with, so that the
+// server can tell they weren't tampered with or replayed.
+const SignatureHeader = "X-Dotmesh-Signature"
+const SignatureTimestampHeader = "X-Dotmesh-Timestamp" // unix seconds
+
+// SignatureMaxAge is how old (or, allowing for clock skew, how far in the
+// future) a signed request's timestamp may be.
+const SignatureMaxAge = 5 * time.Minute
+
+// Signature is the hex HMAC-SHA256 of method+":"+body+":"+timestamp.
+func Signature(apiKey, method string, body []byte, timestamp string) string {
+	mac := hmac.New(sha256.New, []byte(apiKey))
+	mac.Write([]byte(method + ":"))
+	mac.Write(body)
+	mac.Write([]byte(":" + timestamp))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignatureTimestamp formats t for SignatureTimestampHeader.
+func SignatureTimestamp(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+// VerifySignature returns an error unless signature is method and body's
+// signature with apiKey at timestamp, and timestamp is within
+// SignatureMaxAge of now.
+func VerifySignature(apiKey, method string, body []byte, timestamp, signature string, now time.Time) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid signature timestamp %q", timestamp)
+	}
+	age := now.Sub(time.Unix(seconds, 0))
+	if age > SignatureMaxAge || age < -SignatureMaxAge {
+		return fmt.Errorf("signature timestamp %s is more than %s from now", timestamp, SignatureMaxAge)
+	}
+	expected := Signature(apiKey, method, body, timestamp)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return fmt.Errorf("signature doesn't match the request")
+	}
+	return nil
+}
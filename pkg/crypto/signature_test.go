@@ -0,0 +1,32 @@
+package crypto
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVerifySignature(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	body := []byte(`{"method":"DotmeshRPC.List","params":[null],"id":1}`)
+	timestamp := SignatureTimestamp(now)
+	signature := Signature("apikey", "DotmeshRPC.List", body, timestamp)
+
+	if err := VerifySignature("apikey", "DotmeshRPC.List", body, timestamp, signature, now.Add(time.Minute)); err != nil {
+		t.Errorf("expected a fresh signature to verify, got %s", err)
+	}
+	if err := VerifySignature("other", "DotmeshRPC.List", body, timestamp, signature, now); err == nil {
+		t.Error("expected a signature made with another key to fail")
+	}
+	if err := VerifySignature("apikey", "DotmeshRPC.Delete", body, timestamp, signature, now); err == nil {
+		t.Error("expected a signature for another method to fail")
+	}
+	if err := VerifySignature("apikey", "DotmeshRPC.List", []byte(`{}`), timestamp, signature, now); err == nil {
+		t.Error("expected a signature for another body to fail")
+	}
+	if err := VerifySignature("apikey", "DotmeshRPC.List", body, timestamp, signature, now.Add(6*time.Minute)); err == nil {
+		t.Error("expected a signature older than five minutes to fail")
+	}
+	if err := VerifySignature("apikey", "DotmeshRPC.List", body, "yesterday", signature, now); err == nil {
+		t.Error("expected an unparseable timestamp to fail")
+	}
+}
@@ -399,15 +399,27 @@ func (f *FsMachine) pollDirty() error {
 		if err != nil {
 			return err
 		}
-		if f.dirtyDelta != dirtyDelta || f.sizeBytes != sizeBytes {
+		logicalBytes, compressedBytes, quotaBytes, err := f.zfs.GetSpaceUsage(f.filesystemId)
+		if err != nil {
+			return err
+		}
+		if f.dirtyDelta != dirtyDelta || f.sizeBytes != sizeBytes ||
+			f.logicalBytes != logicalBytes || f.compressedBytes != compressedBytes ||
+			f.quotaBytes != quotaBytes {
 			f.dirtyDelta = dirtyDelta
 			f.sizeBytes = sizeBytes
+			f.logicalBytes = logicalBytes
+			f.compressedBytes = compressedBytes
+			f.quotaBytes = quotaBytes
 
 			fd := &types.FilesystemDirty{
-				FilesystemID: f.filesystemId,
-				NodeID:       f.state.NodeID(),
-				DirtyBytes:   dirtyDelta,
-				SizeBytes:    sizeBytes,
+				FilesystemID:    f.filesystemId,
+				NodeID:          f.state.NodeID(),
+				DirtyBytes:      dirtyDelta,
+				SizeBytes:       sizeBytes,
+				LogicalBytes:    logicalBytes,
+				CompressedBytes: compressedBytes,
+				QuotaBytes:      quotaBytes,
 			}
 			err = f.filesystemStore.SetDirty(fd, &store.SetOptions{})
 			if err != nil {
@@ -428,6 +440,17 @@ func (f *FsMachine) latestSnapshot() string {
 	return ""
 }
 
+func (f *FsMachine) hasSnapshot(snapshotId string) bool {
+	f.snapshotsLock.Lock()
+	defer f.snapshotsLock.Unlock()
+	for _, s := range f.filesystem.Snapshots {
+		if s.Id == snapshotId {
+			return true
+		}
+	}
+	return false
+}
+
 func (f *FsMachine) markFilesystemAsLive() error {
 	return f.state.MarkFilesystemAsLiveInEtcd(f.filesystemId)
 }
@@ -658,10 +681,25 @@ func (f *FsMachine) fork(e *types.Event) (responseEvent *types.Event, nextState
 		return types.NewErrorEvent("cannot-fork", fmt.Errorf("type error: name is not a string")), activeState
 	}
 
+	// Optional commit to fork from, defaulting to the latest one
+	var sourceCommitId string
+	if sourceCommitIdIf, ok := (*e.Args)["SourceCommitId"]; ok && sourceCommitIdIf != nil {
+		sourceCommitId, ok = sourceCommitIdIf.(string)
+		if !ok {
+			return types.NewErrorEvent("cannot-fork", fmt.Errorf("type error: source commit id is not a string")), activeState
+		}
+	}
+
 	forkId := uuid.New().String()
 
 	// Find our latest snapshot ID
 	latestSnap := f.latestSnapshot()
+	if sourceCommitId != "" {
+		if !f.hasSnapshot(sourceCommitId) {
+			return types.NewErrorEvent("cannot-fork", fmt.Errorf("commit '%s' not found on filesystem '%s', cannot fork", sourceCommitId, f.ID())), activeState
+		}
+		latestSnap = sourceCommitId
+	}
 	if latestSnap == "" {
 		log.WithFields(log.Fields{
 			"originFilesystemId": f.filesystemId,
@@ -704,6 +742,67 @@ func (f *FsMachine) fork(e *types.Event) (responseEvent *types.Event, nextState
 	return &types.Event{Name: "forked", Args: &types.EventArgs{"ForkId": forkId}}, activeState
 }
 
+// clone copies the filesystem as it is at its latest snapshot into a new
+// top-level volume, the same way fork does, but without recording where it
+// came from: the copy isn't a fork of anything, and nothing about it depends
+// on this filesystem.
+func (f *FsMachine) clone(e *types.Event) (responseEvent *types.Event, nextState StateFn) {
+	destNamespace, ok := (*e.Args)["DestNamespace"].(string)
+	if !ok {
+		return types.NewErrorEvent("cannot-clone", fmt.Errorf("destination namespace not specified")), activeState
+	}
+	destName, ok := (*e.Args)["DestName"].(string)
+	if !ok {
+		return types.NewErrorEvent("cannot-clone", fmt.Errorf("destination name not specified")), activeState
+	}
+	estimateOnly, _ := (*e.Args)["EstimateOnly"].(bool)
+
+	latestSnap := f.latestSnapshot()
+	if latestSnap == "" {
+		return types.NewErrorEvent("cannot-clone", fmt.Errorf("filesystem '%s' doesn't have any commits, cannot clone", f.ID())), activeState
+	}
+
+	size, err := f.zfs.PredictSize("", "", f.filesystemId, latestSnap)
+	if err != nil {
+		return types.NewErrorEvent("cannot-clone:error-predicting-size", err), activeState
+	}
+	if estimateOnly {
+		return &types.Event{Name: "cloned", Args: &types.EventArgs{"CloneId": "", "EstimatedBytes": size}}, activeState
+	}
+
+	cloneId := uuid.New().String()
+	log.WithFields(log.Fields{
+		"originFilesystemId": f.filesystemId,
+		"originSnapshotId":   latestSnap,
+		"destNamespace":      destNamespace,
+		"destName":           destName,
+		"cloneId":            cloneId,
+		"estimatedBytes":     size,
+	}).Info("[clone] copying filesystem in zfs...")
+
+	err = f.zfs.Fork(f.filesystemId, latestSnap, cloneId)
+	if err != nil {
+		log.WithError(err).Error("Error copying filesystem")
+		return types.NewErrorEvent("cannot-clone:error-copying-filesystem", err), activeState
+	}
+
+	// with no origin, the registry entry is an ordinary top-level volume
+	err = f.state.RegisterNewFork("", "", destNamespace, destName, cloneId)
+	if err != nil {
+		log.WithError(err).Error("Error registering clone")
+		if deleteErr := f.zfs.DeleteFilesystemInZFS(cloneId); deleteErr != nil {
+			log.WithError(deleteErr).Warn("[clone] couldn't clean up after failing to register the clone")
+		}
+		return types.NewErrorEvent("cannot-clone:error-registering-clone", err), activeState
+	}
+
+	_, err = f.state.InitFilesystemMachine(cloneId)
+	if err != nil {
+		return types.NewErrorEvent("cannot-clone:error-activating-statemachine", err), activeState
+	}
+	return &types.Event{Name: "cloned", Args: &types.EventArgs{"CloneId": cloneId, "EstimatedBytes": size}}, activeState
+}
+
 func (f *FsMachine) snapshot(e *types.Event) (responseEvent *types.Event, nextState StateFn) {
 	var err error
 	var meta map[string]string
@@ -759,6 +858,201 @@ func (f *FsMachine) snapshot(e *types.Event) (responseEvent *types.Event, nextSt
 	return &types.Event{Name: "snapshotted", Args: &types.EventArgs{"SnapshotId": snapshotId}}, activeState
 }
 
+// pruneSnapshots destroys the oldest snapshots, keeping the newest
+// "retainCount", or else the snapshots listed, comma separated, in
+// "snapshotIds". Snapshots that branches were cloned from can't be destroyed,
+// so they're kept regardless.
+func (f *FsMachine) pruneSnapshots(e *types.Event) (responseEvent *types.Event, nextState StateFn) {
+	f.snapshotsLock.Lock()
+	snapshots := append([]*types.Snapshot{}, f.filesystem.Snapshots...)
+	f.snapshotsLock.Unlock()
+
+	var doomed []*types.Snapshot
+	if ids, ok := (*e.Args)["snapshotIds"].(string); ok {
+		wanted := map[string]bool{}
+		for _, id := range strings.Split(ids, ",") {
+			wanted[id] = true
+		}
+		for _, snapshot := range snapshots {
+			if wanted[snapshot.Id] {
+				doomed = append(doomed, snapshot)
+			}
+		}
+	} else {
+		// event args are JSON encoded on their way here, so numbers arrive
+		// as float64s
+		retainCount, err := strconv.Atoi(fmt.Sprintf("%v", (*e.Args)["retainCount"]))
+		if err != nil || retainCount <= 0 {
+			return types.NewErrorEvent("invalid-retain-count", fmt.Errorf("invalid retainCount %v", (*e.Args)["retainCount"])), activeState
+		}
+		if len(snapshots) > retainCount {
+			doomed = snapshots[:len(snapshots)-retainCount]
+		}
+	}
+
+	if len(doomed) == 0 {
+		return &types.Event{Name: "pruned", Args: &types.EventArgs{"count": 0}}, activeState
+	}
+
+	pruned := map[string]bool{}
+	for _, snapshot := range doomed {
+		output, err := f.zfs.DestroySnapshot(f.filesystemId, snapshot.Id)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":         err,
+				"filesystem_id": f.filesystemId,
+				"snapshot_id":   snapshot.Id,
+				"output":        string(output),
+			}).Warn("[pruneSnapshots] failed to destroy snapshot, keeping it")
+			continue
+		}
+		pruned[snapshot.Id] = true
+	}
+
+	if len(pruned) > 0 {
+		f.snapshotsLock.Lock()
+		remaining := []*types.Snapshot{}
+		for _, snapshot := range f.filesystem.Snapshots {
+			if !pruned[snapshot.Id] {
+				remaining = append(remaining, snapshot)
+			}
+		}
+		f.filesystem.Snapshots = remaining
+		f.snapshotsLock.Unlock()
+
+		err := f.snapshotsChanged()
+		if err != nil {
+			log.Errorf("[pruneSnapshots] %v while trying to inform that snapshots changed %s", err, f.zfs.FQ(f.filesystemId))
+			return &types.Event{
+				Name: "failed-snapshot-changed",
+				Args: &types.EventArgs{"err": fmt.Sprintf("%v", err)},
+			}, backoffState
+		}
+	}
+	return &types.Event{Name: "pruned", Args: &types.EventArgs{"count": len(pruned)}}, activeState
+}
+
+// squashSnapshots replaces the snapshots from "fromCommitId" to
+// "toCommitId", inclusive, with one that has the latter's data and "message"
+// as its message. toCommitId is renamed to a new id first, and its metadata,
+// with the new message, set as the renamed snapshot's user properties, so it
+// goes wherever the snapshot does, rollbacks and replication included; then
+// the snapshots before it are destroyed. If destroying one fails, the
+// snapshot list is still updated with what was done, so it doesn't go on
+// listing commits that are gone.
+func (f *FsMachine) squashSnapshots(e *types.Event) (responseEvent *types.Event, nextState StateFn) {
+	fromCommitId, _ := (*e.Args)["fromCommitId"].(string)
+	toCommitId, _ := (*e.Args)["toCommitId"].(string)
+	message, _ := (*e.Args)["message"].(string)
+
+	f.snapshotsLock.Lock()
+	from, to := -1, -1
+	for i, snapshot := range f.filesystem.Snapshots {
+		if snapshot.Id == fromCommitId {
+			from = i
+		}
+		if snapshot.Id == toCommitId {
+			to = i
+		}
+	}
+	if from < 0 || to < 0 {
+		f.snapshotsLock.Unlock()
+		return types.NewErrorEvent("no-such-commit", fmt.Errorf("Commits %s and %s aren't both on this branch", fromCommitId, toCommitId)), activeState
+	}
+	if from > to {
+		f.snapshotsLock.Unlock()
+		return types.NewErrorEvent("cannot-squash-to-older-commit", fmt.Errorf("Commit %s is newer than commit %s", fromCommitId, toCommitId)), activeState
+	}
+	doomed := append([]*types.Snapshot{}, f.filesystem.Snapshots[from:to]...)
+	last := f.filesystem.Snapshots[to]
+	meta := map[string]string{}
+	for k, v := range last.Metadata {
+		meta[k] = v
+	}
+	f.snapshotsLock.Unlock()
+	meta["message"] = message
+
+	newCommitId := uuid.New().String()
+	output, err := f.zfs.RenameSnapshot(f.filesystemId, toCommitId, newCommitId)
+	if err != nil {
+		return types.NewErrorEvent("failed-renaming-snapshot", fmt.Errorf("Couldn't rename commit %s: %s", toCommitId, output)), backoffState
+	}
+	err = f.zfs.SetSnapshotMetadata(f.filesystemId, newCommitId, meta)
+	if err != nil {
+		log.WithError(err).Error("[squashSnapshots] failed setting the squashed commit's metadata")
+		output, renameErr := f.zfs.RenameSnapshot(f.filesystemId, newCommitId, toCommitId)
+		if renameErr == nil {
+			return types.NewErrorEvent("failed-writing-metadata", err), backoffState
+		}
+		log.WithFields(log.Fields{
+			"error":         renameErr,
+			"filesystem_id": f.filesystemId,
+			"snapshot_id":   newCommitId,
+			"output":        string(output),
+		}).Error("[squashSnapshots] failed renaming the squashed commit back")
+		// it's been renamed, so list it under its new id with its old metadata
+		return f.squashedSnapshotsChanged(nil, toCommitId, newCommitId, last.Metadata, types.NewErrorEvent("failed-writing-metadata", err))
+	}
+
+	destroyed := []*types.Snapshot{}
+	for _, snapshot := range doomed {
+		output, err := f.zfs.DestroySnapshot(f.filesystemId, snapshot.Id)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":         err,
+				"filesystem_id": f.filesystemId,
+				"snapshot_id":   snapshot.Id,
+				"output":        string(output),
+			}).Error("[squashSnapshots] failed to destroy snapshot")
+			return f.squashedSnapshotsChanged(destroyed, toCommitId, newCommitId, meta,
+				types.NewErrorEvent("failed-destroying-snapshot", fmt.Errorf("Couldn't destroy commit %s: %s", snapshot.Id, output)))
+		}
+		destroyed = append(destroyed, snapshot)
+	}
+	return f.squashedSnapshotsChanged(destroyed, toCommitId, newCommitId, meta,
+		&types.Event{Name: "squashed", Args: &types.EventArgs{"SnapshotId": newCommitId}})
+}
+
+// squashedSnapshotsChanged updates the snapshot list with what squashSnapshots
+// did: the destroyed snapshots taken out, and toCommitId renamed to
+// newCommitId with meta as its metadata. It responds with "done", and goes back
+// to the active state if that was "squashed", or backs off if not.
+func (f *FsMachine) squashedSnapshotsChanged(destroyed []*types.Snapshot, toCommitId, newCommitId string, meta map[string]string, done *types.Event) (*types.Event, StateFn) {
+	f.snapshotsLock.Lock()
+	gone := map[string]bool{}
+	for _, snapshot := range destroyed {
+		gone[snapshot.Id] = true
+	}
+	remaining := []*types.Snapshot{}
+	for _, snapshot := range f.filesystem.Snapshots {
+		if gone[snapshot.Id] {
+			continue
+		}
+		if snapshot.Id == toCommitId {
+			squashed := *snapshot
+			squashed.Id = newCommitId
+			squashed.Metadata = meta
+			snapshot = &squashed
+		}
+		remaining = append(remaining, snapshot)
+	}
+	f.filesystem.Snapshots = remaining
+	f.snapshotsLock.Unlock()
+
+	err := f.snapshotsChanged()
+	if err != nil {
+		log.Errorf("[squashSnapshots] %v while trying to inform that snapshots changed %s", err, f.zfs.FQ(f.filesystemId))
+		return &types.Event{
+			Name: "failed-snapshot-changed",
+			Args: &types.EventArgs{"err": fmt.Sprintf("%v", err)},
+		}, backoffState
+	}
+	if done.Name != "squashed" {
+		return done, backoffState
+	}
+	return done, activeState
+}
+
 // find the user-facing name of a given filesystem id. if we're a branch
 // (clone), return the name of our parent filesystem.
 func (f *FsMachine) name() (types.VolumeName, error) {
@@ -884,6 +1178,10 @@ func (f *FsMachine) snapshotsChanged() error {
 	// XXX this _might_ break the fact that handoff doesn't check what snapshot
 	// it's notified about.
 	var snaps []*types.Snapshot
+	changed, err := f.changedCommitMetadata()
+	if err != nil {
+		log.WithError(err).Error("snapshotsChanged: couldn't get changed commit metadata")
+	}
 	f.snapshotsLock.Lock()
 	defer f.snapshotsLock.Unlock()
 
@@ -898,6 +1196,12 @@ func (f *FsMachine) snapshotsChanged() error {
 		} else {
 			s.Metadata = newMeta
 		}
+		if meta, ok := changed[s.Id]; ok {
+			s.Metadata = map[string]string{}
+			for k, v := range meta {
+				s.Metadata[k] = v
+			}
+		}
 		snaps = append(snaps, s.DeepCopy())
 	}
 	return f.state.UpdateSnapshotsFromKnownState(
@@ -906,7 +1210,7 @@ func (f *FsMachine) snapshotsChanged() error {
 }
 
 // Attempt to recover from a divergence by creating a new branch from the current position, and rolling the
-// existing branch back to rollbackTo.
+// existing branch back to rollbackTo. Returns the new (stash) branch's name.
 // TODO: create a new local clone (branch), then roll back to
 // rollbackTo (except, you can't roll back a snapshot
 // that a clone depends on without promoting the clone... hmmm)
@@ -914,37 +1218,34 @@ func (f *FsMachine) snapshotsChanged() error {
 // step 4: Make dotmesh aware of the new branch
 // ...something something FsMachine something etcd...
 
-func (f *FsMachine) recoverFromDivergence(rollbackToId string) error {
+func (f *FsMachine) recoverFromDivergence(rollbackToId string) (string, error) {
 	// Mint an ID for the new branch
 	newFilesystemId := uuid.New().String()
 
 	// Roll back the filesystem to rollbackTo, but leaving the new filesystem pointing to its original state
 	err := f.zfs.StashBranch(f.filesystemId, newFilesystemId, rollbackToId)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	tlf, parentBranchName, err := f.registry.LookupFilesystemById(f.filesystemId)
+	tlf, _, err := f.registry.LookupFilesystemById(f.filesystemId)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	topLevelFilesystemId := tlf.MasterBranch.Id
-	t := time.Now().UTC()
-	newBranchName := ""
-	if parentBranchName == "" {
-		newBranchName = fmt.Sprintf("master-DIVERGED-%s", strings.Replace(t.Format(time.RFC3339), ":", "-", -1))
-	} else {
-		newBranchName = fmt.Sprintf("%s-DIVERGED-%s", parentBranchName, strings.Replace(t.Format(time.RFC3339), ":", "-", -1))
-	}
+	newBranchName := types.StashBranchName(time.Now(), func(name string) bool {
+		_, err := f.registry.LookupClone(topLevelFilesystemId, name)
+		return err == nil
+	})
 
 	errorName, err := f.state.ActivateClone(topLevelFilesystemId, f.filesystemId, rollbackToId, newFilesystemId, newBranchName)
 
 	if err != nil {
-		return fmt.Errorf("Error recovering from divergence: %+v in %s", err, errorName)
+		return "", fmt.Errorf("Error recovering from divergence: %+v in %s", err, errorName)
 	}
 
-	return nil
+	return newBranchName, nil
 }
 
 // TODO this method shouldn't really be on a FsMachine, because it is
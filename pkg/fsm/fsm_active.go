@@ -1,6 +1,9 @@
 package fsm
 
 import (
+	"encoding/json"
+	"strconv"
+
 	"github.com/dotmesh-io/dotmesh/pkg/types"
 	"github.com/dotmesh-io/dotmesh/pkg/uuid"
 
@@ -115,6 +118,36 @@ func activeState(f *FsMachine) StateFn {
 			} else if f.lastS3TransferRequest.Direction == "pull" {
 				return s3PullInitiatorState
 			}
+		} else if e.Name == "sftp-transfer" {
+
+			transferRequest, err := sftpTransferRequestify((*e.Args)["Transfer"])
+			if err != nil {
+				f.innerResponses <- &types.Event{
+					Name: "sftp-cant-cast-transfer-request",
+					Args: &types.EventArgs{"err": err},
+				}
+				return backoffState
+			}
+			f.lastSFTPTransferRequest = transferRequest
+			transferRequestId, ok := (*e.Args)["RequestId"].(string)
+			if !ok {
+				f.innerResponses <- &types.Event{
+					Name: "sftp-cant-cast-transfer-requestid",
+					Args: &types.EventArgs{"err": err},
+				}
+				return backoffState
+			}
+			f.lastTransferRequestId = transferRequestId
+
+			log.Printf("GOT SFTP TRANSFER REQUEST %+v", f.lastSFTPTransferRequest)
+			if f.lastSFTPTransferRequest.Direction == "push" {
+				return sftpPushInitiatorState
+			}
+			f.innerResponses <- &types.Event{
+				Name: "sftp-unsupported-direction",
+				Args: &types.EventArgs{"direction": f.lastSFTPTransferRequest.Direction},
+			}
+			return backoffState
 		} else if e.Name == "peer-transfer" {
 
 			// TODO dedupe
@@ -170,6 +203,10 @@ func activeState(f *FsMachine) StateFn {
 			response, state := f.fork(e)
 			f.innerResponses <- response
 			return state
+		} else if e.Name == "clone" {
+			response, state := f.clone(e)
+			f.innerResponses <- response
+			return state
 		} else if e.Name == "diff" {
 			response, state := f.diff(e)
 			f.innerResponses <- response
@@ -178,6 +215,66 @@ func activeState(f *FsMachine) StateFn {
 			response, state := f.snapshot(e)
 			f.innerResponses <- response
 			return state
+		} else if e.Name == "update-commit-metadata" {
+			response, state := f.updateCommitMetadata(e)
+			f.innerResponses <- response
+			return state
+		} else if e.Name == "check-health" {
+			health, err := f.zfs.CheckHealth(f.filesystemId)
+			if err != nil {
+				f.innerResponses <- types.NewErrorEvent("failed-health-check", err)
+				return activeState
+			}
+			// encoded so that it survives the trip back to the requesting
+			// node intact
+			encoded, err := json.Marshal(health)
+			if err != nil {
+				f.innerResponses <- types.NewErrorEvent("failed-health-check", err)
+				return activeState
+			}
+			f.innerResponses <- &types.Event{
+				Name: "health-checked",
+				Args: &types.EventArgs{"health": string(encoded)},
+			}
+			return activeState
+		} else if e.Name == "set-quota" {
+			// a string, as a number wouldn't come through JSON as an int64
+			quotaBytes, err := strconv.ParseInt((*e.Args)["quotaBytes"].(string), 10, 64)
+			if err != nil {
+				f.innerResponses <- types.NewErrorEvent("failed-set-quota", err)
+				return activeState
+			}
+			err = f.zfs.SetQuota(f.filesystemId, quotaBytes)
+			if err != nil {
+				f.innerResponses <- types.NewErrorEvent("failed-set-quota", err)
+				return activeState
+			}
+			f.innerResponses <- &types.Event{Name: "quota-set"}
+			return activeState
+		} else if e.Name == "get-quota-usage" {
+			usage, err := f.zfs.GetQuotaUsage(f.filesystemId)
+			if err != nil {
+				f.innerResponses <- types.NewErrorEvent("failed-get-quota-usage", err)
+				return activeState
+			}
+			encoded, err := json.Marshal(usage)
+			if err != nil {
+				f.innerResponses <- types.NewErrorEvent("failed-get-quota-usage", err)
+				return activeState
+			}
+			f.innerResponses <- &types.Event{
+				Name: "quota-usage",
+				Args: &types.EventArgs{"usage": string(encoded)},
+			}
+			return activeState
+		} else if e.Name == "prune-snapshots" {
+			response, state := f.pruneSnapshots(e)
+			f.innerResponses <- response
+			return state
+		} else if e.Name == "squash" {
+			response, state := f.squashSnapshots(e)
+			f.innerResponses <- response
+			return state
 		} else if e.Name == "mount-snapshot" {
 			snapId := (*e.Args)["snapId"].(string)
 			response, state := f.mountSnap(snapId, true)
@@ -185,7 +282,7 @@ func activeState(f *FsMachine) StateFn {
 			return state
 		} else if e.Name == "stash" {
 			snapshotId := (*e.Args)["snapshotId"].(string)
-			err := f.recoverFromDivergence(snapshotId)
+			newBranchName, err := f.recoverFromDivergence(snapshotId)
 			if err != nil {
 				f.innerResponses <- &types.Event{
 					Name: "failed-stash",
@@ -195,7 +292,7 @@ func activeState(f *FsMachine) StateFn {
 			}
 			f.innerResponses <- &types.Event{
 				Name: "stashed",
-				Args: &types.EventArgs{"NewBranchName": "TODO"},
+				Args: &types.EventArgs{"NewBranchName": newBranchName},
 			}
 			return discoveringState
 		} else if e.Name == "rollback" {
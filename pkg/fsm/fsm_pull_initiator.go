@@ -51,6 +51,8 @@ func pullInitiatorState(f *FsMachine) StateFn {
 		transferRequest.ApiKey,
 		transferRequest.Port,
 	)
+	client.SignRequests = true
+	transferRequest.Compression = negotiateCompression(client, transferRequest.Compression)
 
 	var path types.PathToTopLevelFilesystem
 	// XXX Not propagating context here; not needed for auth, but would be nice
@@ -188,6 +190,9 @@ func (f *FsMachine) pull(
 		transferRequest.User,
 		transferRequest.ApiKey,
 	)
+	if transferRequest.Compression != types.CompressionNone {
+		req.Header.Set(types.CompressionHeader, transferRequest.Compression)
+	}
 	getClient := new(http.Client)
 	resp, err := getClient.Do(req)
 	if err != nil {
@@ -269,7 +274,9 @@ func (f *FsMachine) pull(
 			}
 
 		},
-		"decompress",
+		// as the sender says it's compressed it, which is the usual
+		// uncompressed gzip if it ignored our CompressionHeader
+		utils.DecompressMode(resp.Header.Get(types.CompressionHeader)),
 	)
 
 	log.Printf("[pull] about to start consuming prelude on %v", pipeReader)
@@ -394,7 +401,7 @@ func (f *FsMachine) retryPull(
 		case *ToSnapsDiverged:
 			if transferRequest.StashDivergence {
 				fmt.Printf("[retryPull] hit divergence case, have permission to stash - will stash local changes")
-				e := f.recoverFromDivergence(typedErr.latestCommonSnapshot.Id)
+				_, e := f.recoverFromDivergence(typedErr.latestCommonSnapshot.Id)
 				if e != nil {
 					return &types.Event{
 						Name: "failed-stashing",
@@ -71,6 +71,8 @@ func pushInitiatorState(f *FsMachine) StateFn {
 		transferRequest.ApiKey,
 		transferRequest.Port,
 	)
+	client.SignRequests = true
+	transferRequest.Compression = negotiateCompression(client, transferRequest.Compression)
 
 	// TODO should we wait for the remote to ack that it's gone into the right state?
 
@@ -259,13 +261,16 @@ func (f *FsMachine) push(
 			}
 
 		},
-		"compress",
+		utils.CompressMode(transferRequest.Compression),
 	)
 
 	req.SetBasicAuth(
 		transferRequest.User,
 		transferRequest.ApiKey,
 	)
+	if transferRequest.Compression != types.CompressionNone {
+		req.Header.Set(types.CompressionHeader, transferRequest.Compression)
+	}
 	postClient := new(http.Client)
 
 	log.Printf("[actualPush:%s] About to postClient.Do with req %+v", filesystemId, req)
@@ -379,6 +384,27 @@ func stash(filesystemId, snapId string, client *dmclient.JsonRpcClient, ctx cont
 	return nil, discoveringState
 }
 
+// discardAfter has the remote end roll filesystemId back to snapId, losing
+// its commits since then, for a forced push.
+func discardAfter(filesystemId, snapId string, client *dmclient.JsonRpcClient, ctx context.Context) (*types.Event, StateFn) {
+	var result bool
+	e := client.CallRemote(
+		ctx,
+		"DotmeshRPC.DiscardAfter",
+		types.StashRequest{
+			FilesystemId: filesystemId,
+			SnapshotId:   snapId,
+		},
+		&result,
+	)
+	if e != nil {
+		return &types.Event{
+			Name: "failed-discarding-remote-divergence", Args: &types.EventArgs{"err": e},
+		}, backoffState
+	}
+	return nil, discoveringState
+}
+
 func (f *FsMachine) retryPush(
 	fromFilesystemId, fromSnapshotId, toFilesystemId, toSnapshotId string,
 	transferRequestId string,
@@ -468,6 +494,15 @@ func (f *FsMachine) retryPush(
 							}, backoffState
 						}
 					}
+					if transferRequest.Force {
+						event, state := discardAfter(toFilesystemId, err.latestCommonSnapshot.Id, client, ctx)
+						if event != nil {
+							return event, state
+						}
+						return &types.Event{
+							Name: "discarded-remote-divergence",
+						}, backoffState
+					}
 				case *ToSnapsAhead:
 					if transferRequest.StashDivergence {
 						f.updateTransfer("finished", "The remote is ahead of the cluster you are pushing from - nothing to do")
@@ -40,7 +40,7 @@ func receivingState(f *FsMachine) StateFn {
 		case *ToSnapsAhead:
 			log.Printf("receivingState: ToSnapsAhead %s got %s", f.filesystemId, err)
 			// erk, slave is ahead of master
-			errx := f.recoverFromDivergence(err.latestCommonSnapshot.Id)
+			_, errx := f.recoverFromDivergence(err.latestCommonSnapshot.Id)
 			if errx != nil {
 				return backoffStateWithReason(fmt.Sprintf("receivingState(%s): Unable to recover from divergence: %+v", f.filesystemId, errx))
 			}
@@ -48,7 +48,7 @@ func receivingState(f *FsMachine) StateFn {
 			return discoveringState
 		case *ToSnapsDiverged:
 			log.Printf("receivingState: ToSnapsDiverged %s got %s", f.filesystemId, err)
-			errx := f.recoverFromDivergence(err.latestCommonSnapshot.Id)
+			_, errx := f.recoverFromDivergence(err.latestCommonSnapshot.Id)
 			if errx != nil {
 				return backoffStateWithReason(fmt.Sprintf("receivingState(%s): Unable to recover from divergence: %+v", f.filesystemId, errx))
 			}
@@ -25,7 +25,7 @@ func s3PushInitiatorState(f *FsMachine) StateFn {
 		},
 	}
 
-	latestSnap, err := f.getLastNonMetadataSnapshot()
+	latestSnap, err := f.getS3PushSnapshot(transferRequest.TargetCommit)
 	if err != nil {
 		f.errorDuringTransfer("s3-push-initiator-cant-get-snapshot-data", err)
 		return backoffState
@@ -160,3 +160,21 @@ func s3PushInitiatorState(f *FsMachine) StateFn {
 	}
 	return discoveringState
 }
+
+// getS3PushSnapshot is the commit whose files an S3 push sends: targetCommit,
+// or the latest one that isn't just S3 metadata if that's empty.
+func (f *FsMachine) getS3PushSnapshot(targetCommit string) (*types.Snapshot, error) {
+	if targetCommit == "" {
+		return f.getLastNonMetadataSnapshot()
+	}
+	snaps, err := f.state.SnapshotsForCurrentMaster(f.filesystemId)
+	if err != nil {
+		return nil, err
+	}
+	for idx := range snaps {
+		if snaps[idx].Id == targetCommit {
+			return &snaps[idx], nil
+		}
+	}
+	return nil, fmt.Errorf("No such commit %s to push", targetCommit)
+}
@@ -0,0 +1,205 @@
+package fsm
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+	"github.com/dotmesh-io/dotmesh/pkg/utils"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+const defaultSFTPPort = 22
+
+func getSSHClient(transferRequest types.SFTPTransferRequest) (*ssh.Client, error) {
+	signer, err := ssh.ParsePrivateKey([]byte(transferRequest.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse private key: %s", err)
+	}
+	if transferRequest.HostKey == "" {
+		return nil, fmt.Errorf("no host key for %s, please add the remote again with --host-key", transferRequest.Hostname)
+	}
+	hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(transferRequest.HostKey))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse host key: %s", err)
+	}
+	port := transferRequest.Port
+	if port == 0 {
+		port = defaultSFTPPort
+	}
+	config := &ssh.ClientConfig{
+		User:            transferRequest.Username,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.FixedHostKey(hostKey),
+	}
+	return ssh.Dial("tcp", net.JoinHostPort(transferRequest.Hostname, strconv.Itoa(port)), config)
+}
+
+// shellQuote wraps s in single quotes so the remote shell treats it as one
+// literal word.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'"'"'`, -1) + "'"
+}
+
+func sftpPushInitiatorState(f *FsMachine) StateFn {
+	f.transitionedTo("sftpPushInitiatorState", "requesting")
+	transferRequest := f.lastSFTPTransferRequest
+	transferRequestId := f.lastTransferRequestId
+
+	f.transferUpdates <- types.TransferUpdate{
+		Kind: types.TransferStart,
+		Changes: types.TransferPollResult{
+			TransferRequestId: transferRequestId,
+			Direction:         transferRequest.Direction,
+			LocalNamespace:    transferRequest.LocalNamespace,
+			LocalName:         transferRequest.LocalName,
+			LocalBranchName:   transferRequest.LocalBranchName,
+			FilesystemId:      f.filesystemId,
+			InitiatorNodeId:   f.state.NodeID(),
+			Index:             0,
+			Total:             1,
+			Status:            "starting",
+		},
+	}
+
+	latestSnap, err := f.getLastNonMetadataSnapshot()
+	if err != nil {
+		return f.errorDuringTransfer("sftp-push-initiator-cant-get-snapshot-data", err)
+	}
+	if latestSnap == nil {
+		f.innerResponses <- &types.Event{
+			Name: "sftp-no-commits-to-push",
+		}
+		f.updateUser("No commits to push!")
+		return backoffState
+	}
+
+	snaps, err := f.state.SnapshotsFor(f.state.NodeID(), f.filesystemId)
+	if err != nil {
+		return f.errorDuringTransfer("error-calculating-prelude", err)
+	}
+	prelude, err := CalculatePrelude(snaps, latestSnap.Id)
+	if err != nil {
+		return f.errorDuringTransfer("error-calculating-prelude", err)
+	}
+	preludeEncoded, err := EncodePrelude(prelude)
+	if err != nil {
+		return f.errorDuringTransfer("cant-encode-prelude", err)
+	}
+
+	size, err := f.zfs.PredictSize("", "", f.filesystemId, latestSnap.Id)
+	if err != nil {
+		return f.errorDuringTransfer("error-predicting", err)
+	}
+
+	client, err := getSSHClient(transferRequest)
+	if err != nil {
+		return f.errorDuringTransfer("couldnt-connect-to-sftp-host", err)
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return f.errorDuringTransfer("couldnt-start-ssh-session", err)
+	}
+	defer session.Close()
+
+	sessionStdin, err := session.StdinPipe()
+	if err != nil {
+		return f.errorDuringTransfer("couldnt-open-ssh-stdin", err)
+	}
+
+	remoteFile := fmt.Sprintf(
+		"%s/%s@%s.zfs",
+		strings.TrimSuffix(transferRequest.RemotePath, "/"), f.filesystemId, latestSnap.Id,
+	)
+	remoteCommand := fmt.Sprintf(
+		"mkdir -p %s && cat > %s",
+		shellQuote(transferRequest.RemotePath), shellQuote(remoteFile),
+	)
+	log.Printf("[sftpPushInitiatorState] streaming %s@%s to %s:%s", f.filesystemId, latestSnap.Id, transferRequest.Hostname, remoteFile)
+
+	err = session.Start(remoteCommand)
+	if err != nil {
+		return f.errorDuringTransfer("couldnt-start-remote-command", err)
+	}
+
+	f.transferUpdates <- types.TransferUpdate{
+		Kind: types.TransferCalculatedSize,
+		Changes: types.TransferPollResult{
+			Status: "pushing",
+			Size:   size,
+		},
+	}
+
+	pipeReader, errch := f.zfs.Send("", "", f.filesystemId, latestSnap.Id, preludeEncoded)
+
+	finished := make(chan bool)
+	go utils.Pipe(
+		pipeReader, fmt.Sprintf("stdout of zfs send for %s", f.filesystemId),
+		sessionStdin, "ssh session stdin",
+		finished,
+
+		// Permanently empty cancellation channel, and noop cancellation callback
+		make(chan *types.Event),
+		func(e *types.Event, c chan *types.Event) {},
+
+		func(bytes int64, t int64) {
+			f.transferUpdates <- types.TransferUpdate{
+				Kind: types.TransferProgress,
+				Changes: types.TransferPollResult{
+					Status:             "pushing",
+					Sent:               bytes,
+					NanosecondsElapsed: t,
+				},
+			}
+			f.transitionedTo("sftpPushInitiatorState",
+				fmt.Sprintf(
+					"transferred %.2fMiB in %.2fs (%.2fMiB/s)...",
+					// bytes => mebibytes       nanoseconds => seconds
+					float64(bytes)/(1024*1024), float64(t)/(1000*1000*1000),
+					// mib/sec
+					(float64(bytes)/(1024*1024))/(float64(t)/(1000*1000*1000)),
+				),
+			)
+
+			select {
+			case _ = <-f.innerRequests:
+				f.innerResponses <- &types.Event{
+					Name: "busy-transferring",
+					Args: &types.EventArgs{
+						"currentState": "sftpPushInitiatorState",
+						"progress":     bytes,
+					},
+				}
+			default:
+			}
+		},
+		"none",
+	)
+
+	sendErr := <-errch
+	_ = <-finished
+	if sendErr != nil {
+		return f.errorDuringTransfer("error-from-zfs-send", sendErr)
+	}
+
+	err = session.Wait()
+	if err != nil {
+		return f.errorDuringTransfer("error-from-remote-command", err)
+	}
+
+	f.transferUpdates <- types.TransferUpdate{
+		Kind: types.TransferFinished,
+	}
+
+	f.innerResponses <- &types.Event{
+		Name: "sftp-pushed",
+		Args: &types.EventArgs{"path": remoteFile},
+	}
+	return discoveringState
+}
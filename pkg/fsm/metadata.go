@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"regexp"
 
+	"github.com/dotmesh-io/dotmesh/pkg/store"
 	"github.com/dotmesh-io/dotmesh/pkg/types"
 	"github.com/dotmesh-io/dotmesh/pkg/utils"
 
@@ -78,11 +79,27 @@ func (f *FsMachine) writeMetadata(meta map[string]string, filesystemId, snapshot
 	if err != nil {
 		return err
 	}
-	err = ioutil.WriteFile(metaFile, data, os.ModePerm)
+	// written alongside and renamed into place, so that it's never seen half
+	// written, even by a snapshot
+	tmpFile := metaFile + ".tmp"
+	err = ioutil.WriteFile(tmpFile, data, os.ModePerm)
 	if err != nil {
 		return err
 	}
-	return nil
+	return os.Rename(tmpFile, metaFile)
+}
+
+// changedCommitMetadata returns the metadata updateCommitMetadata has
+// recorded for the branch's commits, by commit id.
+func (f *FsMachine) changedCommitMetadata() (map[string]map[string]string, error) {
+	fcm, err := f.filesystemStore.GetCommitMetadata(f.filesystemId)
+	if err != nil {
+		if store.IsKeyNotFound(err) {
+			return map[string]map[string]string{}, nil
+		}
+		return nil, err
+	}
+	return fcm.Commits, nil
 }
 
 func (f *FsMachine) getMetadata(commit *types.Snapshot) (map[string]string, error) {
@@ -119,3 +136,65 @@ func (f *FsMachine) getMetadata(commit *types.Snapshot) (map[string]string, erro
 	}
 	return commit.Metadata, nil
 }
+
+// updateCommitMetadata changes an existing commit's metadata. The snapshot
+// can't be changed, so the commit's new metadata is kept in the KV store,
+// where every node can see it, and snapshotsChanged uses it instead of what
+// the snapshot was made with. As this runs in the state machine, one change
+// is made at a time, and none are lost.
+func (f *FsMachine) updateCommitMetadata(e *types.Event) (responseEvent *types.Event, nextState StateFn) {
+	// encoded so that the lists in it survive the trip from the requesting
+	// node intact
+	encoded, ok := (*e.Args)["request"].(string)
+	if !ok {
+		return types.NewErrorEvent("invalid-request", fmt.Errorf("interface conversion failed to request: %v", (*e.Args)["request"])), activeState
+	}
+	var req types.UpdateCommitMetadataRequest
+	err := json.Unmarshal([]byte(encoded), &req)
+	if err != nil {
+		return types.NewErrorEvent("invalid-request", err), activeState
+	}
+
+	f.snapshotsLock.Lock()
+	var commit *types.Snapshot
+	for _, s := range f.filesystem.Snapshots {
+		if s.Id == req.CommitId {
+			commit = s
+		}
+	}
+	if commit == nil {
+		f.snapshotsLock.Unlock()
+		return types.NewErrorEvent("no-such-commit", fmt.Errorf("No commit %s on this branch", req.CommitId)), activeState
+	}
+	meta := req.Apply(commit.Metadata)
+	f.snapshotsLock.Unlock()
+
+	changed, err := f.changedCommitMetadata()
+	if err == nil {
+		changed[req.CommitId] = meta
+		err = f.filesystemStore.SetCommitMetadata(&types.FilesystemCommitMetadata{
+			FilesystemID: f.filesystemId,
+			Commits:      changed,
+		}, &store.SetOptions{Force: true})
+	}
+	if err != nil {
+		log.WithError(err).Error("[updateCommitMetadata] failed recording commit metadata")
+		return &types.Event{
+			Name: "failed-writing-metadata", Args: &types.EventArgs{"err": err.Error()},
+		}, backoffState
+	}
+
+	f.snapshotsLock.Lock()
+	commit.Metadata = meta
+	f.snapshotsLock.Unlock()
+
+	err = f.snapshotsChanged()
+	if err != nil {
+		log.Errorf("[updateCommitMetadata] %v while trying to inform that snapshots changed %s", err, f.zfs.FQ(f.filesystemId))
+		return &types.Event{
+			Name: "failed-snapshot-changed",
+			Args: &types.EventArgs{"err": fmt.Sprintf("%v", err)},
+		}, backoffState
+	}
+	return &types.Event{Name: "commit-metadata-updated"}, activeState
+}
@@ -169,3 +169,34 @@ func TestGetKeysForDirLimitSubPathLimit2Page2(t *testing.T) {
 	}
 	t.Logf("files: %d, total files count: %d", len(listKeysResponse.Items), listKeysResponse.TotalCount)
 }
+
+func TestS3TransferRequestifyTargetCommit(t *testing.T) {
+	args := map[string]interface{}{
+		"KeyID":           "AKIA",
+		"SecretKey":       "secret",
+		"Endpoint":        "",
+		"Prefixes":        []interface{}{"data/"},
+		"Direction":       "push",
+		"LocalNamespace":  "admin",
+		"LocalName":       "apples",
+		"LocalBranchName": "",
+		"RemoteName":      "bucket",
+	}
+	// requests from older clients have no target commit
+	request, err := s3TransferRequestify(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.TargetCommit != "" {
+		t.Errorf("expected no target commit, got %q", request.TargetCommit)
+	}
+
+	args["TargetCommit"] = "c1"
+	request, err = s3TransferRequestify(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.TargetCommit != "c1" || len(request.Prefixes) != 1 {
+		t.Errorf("expected target commit c1 and one prefix, got %+v", request)
+	}
+}
@@ -3,13 +3,15 @@ package fsm
 import (
 	"fmt"
 
+	"golang.org/x/net/context"
+
 	dmclient "github.com/dotmesh-io/dotmesh/pkg/client"
 	"github.com/dotmesh-io/dotmesh/pkg/types"
 
 	log "github.com/sirupsen/logrus"
 )
 
-// stuff used to do transfers, both for DM and S3
+// stuff used to do transfers, for DM, S3 and SFTP
 
 func s3TransferRequestify(in interface{}) (types.S3TransferRequest, error) {
 	typed, ok := in.(map[string]interface{})
@@ -19,6 +21,8 @@ func s3TransferRequestify(in interface{}) (types.S3TransferRequest, error) {
 			"Unable to cast %s to map[string]interface{}", in,
 		)
 	}
+	// missing from requests made by older clients
+	targetCommit, _ := typed["TargetCommit"].(string)
 	prefixInter, ok := typed["Prefixes"].([]interface{})
 	var prefixes []string
 	for _, pref := range prefixInter {
@@ -34,6 +38,36 @@ func s3TransferRequestify(in interface{}) (types.S3TransferRequest, error) {
 		LocalName:       typed["LocalName"].(string),
 		LocalBranchName: typed["LocalBranchName"].(string),
 		RemoteName:      typed["RemoteName"].(string),
+		TargetCommit:    targetCommit,
+	}, nil
+}
+
+func sftpTransferRequestify(in interface{}) (types.SFTPTransferRequest, error) {
+	typed, ok := in.(map[string]interface{})
+	if !ok {
+		log.Errorf("[sftpTransferRequestify] Unable to cast %#v to map[string]interface{}", in)
+		return types.SFTPTransferRequest{}, fmt.Errorf(
+			"Unable to cast %s to map[string]interface{}", in,
+		)
+	}
+	var port int
+	if typed["Port"] == nil {
+		port = 0
+	} else {
+		port = int(typed["Port"].(float64))
+	}
+	hostKey, _ := typed["HostKey"].(string)
+	return types.SFTPTransferRequest{
+		Hostname:        typed["Hostname"].(string),
+		Port:            port,
+		Username:        typed["Username"].(string),
+		PrivateKey:      typed["PrivateKey"].(string),
+		HostKey:         hostKey,
+		RemotePath:      typed["RemotePath"].(string),
+		Direction:       typed["Direction"].(string),
+		LocalNamespace:  typed["LocalNamespace"].(string),
+		LocalName:       typed["LocalName"].(string),
+		LocalBranchName: typed["LocalBranchName"].(string),
 	}, nil
 }
 
@@ -60,6 +94,14 @@ func transferRequestify(in interface{}) (types.TransferRequest, error) {
 	} else {
 		stash = typed["StashDivergence"].(bool)
 	}
+	var force bool
+	if typed["Force"] != nil {
+		force = typed["Force"].(bool)
+	}
+	var compression string
+	if typed["Compression"] != nil {
+		compression = typed["Compression"].(string)
+	}
 	return types.TransferRequest{
 		Peer:             typed["Peer"].(string),
 		User:             typed["User"].(string),
@@ -74,9 +116,32 @@ func transferRequestify(in interface{}) (types.TransferRequest, error) {
 		RemoteBranchName: typed["RemoteBranchName"].(string),
 		TargetCommit:     typed["TargetCommit"].(string),
 		StashDivergence:  stash,
+		Force:            force,
+		Compression:      compression,
 	}, nil
 }
 
+// negotiateCompression is how the zfs send streams of a transfer with the
+// peer client talks to are compressed: as asked for, if the peer says it can
+// (see DotmeshRPC.Capabilities), otherwise not at all.
+func negotiateCompression(client *dmclient.JsonRpcClient, compression string) string {
+	if compression == types.CompressionNone {
+		return compression
+	}
+	var capabilities map[string]bool
+	err := client.CallRemote(context.Background(), "DotmeshRPC.Capabilities", struct{}{}, &capabilities)
+	if err != nil {
+		// servers from before Capabilities can't compress either
+		log.Warnf("[negotiateCompression] Can't get the peer's capabilities, sending uncompressed: %s", err)
+		return types.CompressionNone
+	}
+	if !capabilities[types.CompressionCapability(compression)] {
+		log.Infof("[negotiateCompression] The peer can't do %s compression, sending uncompressed", compression)
+		return types.CompressionNone
+	}
+	return compression
+}
+
 // for each clone, ensure its origin snapshot exists on the remote. if it
 // doesn't, transfer it.
 func (f *FsMachine) applyPath(path types.PathToTopLevelFilesystem, transferFn transferFn, transferRequestId string, client *dmclient.JsonRpcClient, transferRequest *types.TransferRequest) (*types.Event, StateFn) {
@@ -158,10 +223,9 @@ func (f *FsMachine) applyPath(path types.PathToTopLevelFilesystem, transferFn tr
 	log.Printf("[applyPath] applying path %#v", path)
 
 	if len(path.Clones) == 0 {
-		// just pushing a master branch to its latest snapshot
-		// do a push with empty origin and empty target snapshot
-		// TODO parametrize "push to snapshot" and expose in the UI
-		firstSnapshot = ""
+		// just pushing a master branch to its latest snapshot (or the
+		// target commit, if there is one), so do a push with empty origin
+		firstSnapshot = transferRequest.TargetCommit
 	} else {
 		// push the master branch up to the first snapshot
 		firstSnapshot = path.Clones[0].Clone.Origin.SnapshotId
@@ -210,6 +274,10 @@ func (f *FsMachine) applyPath(path types.PathToTopLevelFilesystem, transferFn tr
 			// last item so the guard evaluates to false; if we're on the first
 			// item, 2 > 1 is true, so guard is true.
 			nextOrigin = path.Clones[i+1].Clone.Origin
+		} else {
+			// the last clone is the branch being transferred, so it stops at
+			// the target commit, if there is one
+			nextOrigin.SnapshotId = transferRequest.TargetCommit
 		}
 		log.Printf(
 			"[applyPath,i] calling transferFn with fF=%v, fS=%v, tF=%v, tS=%v",
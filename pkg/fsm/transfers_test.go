@@ -0,0 +1,59 @@
+package fsm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	dmclient "github.com/dotmesh-io/dotmesh/pkg/client"
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+)
+
+// testPeer is a client for a server answering DotmeshRPC.Capabilities with
+// capabilities, or like a server from before it existed if that's nil.
+func testPeer(t *testing.T, capabilities map[string]bool) (*dmclient.JsonRpcClient, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ Method string }
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Method != "DotmeshRPC.Capabilities" || capabilities == nil {
+			// what gorilla/rpc says about methods it hasn't got
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"rpc: can't find method %q"}}`, req.Method)
+			return
+		}
+		result, _ := json.Marshal(capabilities)
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":%s}`, result)
+	}))
+	u, _ := url.Parse(server.URL)
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	return dmclient.NewJsonRpcClient("admin", u.Hostname(), "key", port), server.Close
+}
+
+func TestNegotiateCompression(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		capabilities map[string]bool
+		compression  string
+		expected     string
+	}{
+		{"old peer", nil, types.CompressionLZ4, types.CompressionNone},
+		{"peer without lz4", map[string]bool{types.CompressionCapability(types.CompressionGzip): true}, types.CompressionLZ4, types.CompressionNone},
+		{"peer with lz4", map[string]bool{types.CompressionCapability(types.CompressionLZ4): true}, types.CompressionLZ4, types.CompressionLZ4},
+		{"uncompressed", nil, types.CompressionNone, types.CompressionNone},
+	} {
+		client, closeServer := testPeer(t, tc.capabilities)
+		got := negotiateCompression(client, tc.compression)
+		closeServer()
+		if got != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, got)
+		}
+	}
+}
@@ -101,11 +101,15 @@ type FsMachine struct {
 	lastTransitionTimestamp int64
 	transitionObserver      observer.Observer
 	lastS3TransferRequest   types.S3TransferRequest
+	lastSFTPTransferRequest types.SFTPTransferRequest
 	lastTransferRequest     types.TransferRequest
 	lastTransferRequestId   string
 	pushCompleted           chan bool
 	dirtyDelta              int64
 	sizeBytes               int64
+	logicalBytes            int64
+	compressedBytes         int64
+	quotaBytes              int64
 	transferUpdates         chan types.TransferUpdate
 	// only to be accessed via the updateEtcdAboutTransfers goroutine!
 	currentPollResult types.TransferPollResult
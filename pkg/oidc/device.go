@@ -0,0 +1,164 @@
+package oidc
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"golang.org/x/net/context"
+)
+
+const deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// how long to wait between polls if the provider doesn't say, and how much to
+// back off by when it asks us to slow down (RFC 8628 section 3.5)
+const (
+	defaultPollInterval = 5 * time.Second
+	slowDownIncrement   = 5 * time.Second
+)
+
+// DeviceAuthorization is what the user needs to approve a device login
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	// seconds
+	ExpiresIn int `json:"expires_in"`
+	Interval  int `json:"interval"`
+}
+
+// Tokens - a successful token endpoint response
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	IDToken      string `json:"id_token"`
+	RefreshToken string `json:"refresh_token"`
+	// seconds
+	ExpiresIn int `json:"expires_in"`
+}
+
+// IDTokenExpiry is when the ID token stops being accepted, or the zero time if
+// it can't be read. The token isn't verified here; that's the server's job.
+func (t *Tokens) IDTokenExpiry() time.Time {
+	var claims jwt.MapClaims
+	_, _, err := new(jwt.Parser).ParseUnverified(t.IDToken, &claims)
+	if err != nil {
+		return time.Time{}
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return time.Time{}
+	}
+	return time.Unix(int64(exp), 0)
+}
+
+// Client is an OAuth2 client of a provider
+type Client struct {
+	Provider     *ProviderMetadata
+	ClientID     string
+	ClientSecret string
+	// HTTPClient is http.DefaultClient if nil
+	HTTPClient *http.Client
+	// sleep is replaced in tests
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func (c *Client) form(values url.Values) url.Values {
+	values.Set("client_id", c.ClientID)
+	if c.ClientSecret != "" {
+		values.Set("client_secret", c.ClientSecret)
+	}
+	return values
+}
+
+// StartDeviceAuthorization asks the provider for a code for the user to enter
+// at its verification URI.
+func (c *Client) StartDeviceAuthorization(ctx context.Context) (*DeviceAuthorization, error) {
+	if c.Provider.DeviceAuthorizationEndpoint == "" {
+		return nil, fmt.Errorf("OIDC provider %s doesn't support the device authorization flow", c.Provider.Issuer)
+	}
+	var da DeviceAuthorization
+	err := postForm(ctx, c.HTTPClient, c.Provider.DeviceAuthorizationEndpoint, c.form(url.Values{
+		// offline_access so that we get a refresh token
+		"scope": {"openid email offline_access"},
+	}), &da)
+	if err != nil {
+		return nil, fmt.Errorf("Error starting OIDC device login: %s", err)
+	}
+	return &da, nil
+}
+
+// PollDeviceToken waits for the user to approve da, and returns the tokens
+// the provider then issues.
+func (c *Client) PollDeviceToken(ctx context.Context, da *DeviceAuthorization) (*Tokens, error) {
+	interval := defaultPollInterval
+	if da.Interval > 0 {
+		interval = time.Duration(da.Interval) * time.Second
+	}
+	if da.ExpiresIn > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(da.ExpiresIn)*time.Second)
+		defer cancel()
+	}
+	sleep := c.sleep
+	if sleep == nil {
+		sleep = sleepContext
+	}
+
+	for {
+		err := sleep(ctx, interval)
+		if err != nil {
+			return nil, fmt.Errorf("Gave up waiting for OIDC login to be approved: %s", err)
+		}
+		var tokens Tokens
+		err = postForm(ctx, c.HTTPClient, c.Provider.TokenEndpoint, c.form(url.Values{
+			"grant_type":  {deviceCodeGrantType},
+			"device_code": {da.DeviceCode},
+		}), &tokens)
+		if err == nil {
+			return &tokens, nil
+		}
+		oe, ok := err.(*oauthError)
+		if !ok {
+			return nil, err
+		}
+		switch oe.Code {
+		case "authorization_pending":
+		case "slow_down":
+			interval += slowDownIncrement
+		default:
+			return nil, fmt.Errorf("OIDC login failed: %s", oe)
+		}
+	}
+}
+
+// Refresh exchanges refreshToken for fresh tokens. The provider may or may
+// not issue a new refresh token too.
+func (c *Client) Refresh(ctx context.Context, refreshToken string) (*Tokens, error) {
+	var tokens Tokens
+	err := postForm(ctx, c.HTTPClient, c.Provider.TokenEndpoint, c.form(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	}), &tokens)
+	if err != nil {
+		return nil, fmt.Errorf("Error refreshing OIDC tokens: %s", err)
+	}
+	if tokens.RefreshToken == "" {
+		tokens.RefreshToken = refreshToken
+	}
+	return &tokens, nil
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,94 @@
+// Package oidc is the small part of OpenID Connect that dotmesh needs: the
+// device authorization flow (RFC 8628) for dm, and ID token verification for
+// the server.
+package oidc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// ProviderMetadata - the parts of the issuer's discovery document we use
+type ProviderMetadata struct {
+	Issuer                      string `json:"issuer"`
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+	TokenEndpoint               string `json:"token_endpoint"`
+	JWKSURI                     string `json:"jwks_uri"`
+}
+
+func httpClientOrDefault(c *http.Client) *http.Client {
+	if c != nil {
+		return c
+	}
+	return http.DefaultClient
+}
+
+// Discover fetches the issuer's /.well-known/openid-configuration.
+func Discover(ctx context.Context, httpClient *http.Client, issuerURL string) (*ProviderMetadata, error) {
+	wellKnown := strings.TrimSuffix(issuerURL, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequest("GET", wellKnown, nil)
+	if err != nil {
+		return nil, err
+	}
+	var metadata ProviderMetadata
+	err = doJSON(ctx, httpClient, req, &metadata)
+	if err != nil {
+		return nil, fmt.Errorf("Error discovering OIDC provider %s: %s", issuerURL, err)
+	}
+	if strings.TrimSuffix(metadata.Issuer, "/") != strings.TrimSuffix(issuerURL, "/") {
+		return nil, fmt.Errorf("OIDC provider %s claims to be issuer %s", issuerURL, metadata.Issuer)
+	}
+	return &metadata, nil
+}
+
+// oauthError is the error response from a token or device endpoint
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *oauthError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("%s: %s", e.Code, e.Description)
+	}
+	return e.Code
+}
+
+func postForm(ctx context.Context, httpClient *http.Client, endpoint string, form url.Values, result interface{}) error {
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return doJSON(ctx, httpClient, req, result)
+}
+
+// doJSON makes req and decodes the JSON response into result, or returns an
+// *oauthError if that's what came back.
+func doJSON(ctx context.Context, httpClient *http.Client, req *http.Request, result interface{}) error {
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	resp, err := httpClientOrDefault(httpClient).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var oe oauthError
+		if json.Unmarshal(body, &oe) == nil && oe.Code != "" {
+			return &oe
+		}
+		return fmt.Errorf("%s from %s: %s", resp.Status, req.URL, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, result)
+}
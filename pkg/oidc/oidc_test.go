@@ -0,0 +1,164 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"golang.org/x/net/context"
+)
+
+type testProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+	// token endpoint polls to answer with authorization_pending
+	pending int
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testProvider{key: key, pending: 2}
+	mux := http.NewServeMux()
+	p.Server = httptest.NewServer(mux)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ProviderMetadata{
+			Issuer:                      p.URL,
+			DeviceAuthorizationEndpoint: p.URL + "/device",
+			TokenEndpoint:               p.URL + "/token",
+			JWKSURI:                     p.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []jsonWebKey{{
+				Kty: "RSA",
+				Kid: "test",
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(DeviceAuthorization{
+			DeviceCode:      "device-code",
+			UserCode:        "ABCD-EFGH",
+			VerificationURI: p.URL + "/verify",
+			ExpiresIn:       600,
+			Interval:        1,
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("grant_type") == deviceCodeGrantType && p.pending > 0 {
+			p.pending--
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(oauthError{Code: "authorization_pending"})
+			return
+		}
+		json.NewEncoder(w).Encode(Tokens{
+			IDToken:      p.idToken(t, "dotmesh", time.Now().Add(time.Hour)),
+			RefreshToken: "refresh-" + r.Form.Get("grant_type"),
+		})
+	})
+	return p
+}
+
+func (p *testProvider) idToken(t *testing.T, audience string, expiry time.Time) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            p.URL,
+		"aud":            []string{audience},
+		"sub":            "12345",
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"exp":            expiry.Unix(),
+	})
+	token.Header["kid"] = "test"
+	signed, err := token.SignedString(p.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestDeviceFlowAndVerify(t *testing.T) {
+	p := newTestProvider(t)
+	defer p.Close()
+	ctx := context.Background()
+
+	metadata, err := Discover(ctx, nil, p.URL)
+	if err != nil {
+		t.Fatalf("discovery failed: %s", err)
+	}
+	c := &Client{
+		Provider: metadata,
+		ClientID: "dotmesh",
+		sleep:    func(context.Context, time.Duration) error { return nil },
+	}
+	da, err := c.StartDeviceAuthorization(ctx)
+	if err != nil {
+		t.Fatalf("device authorization failed: %s", err)
+	}
+	tokens, err := c.PollDeviceToken(ctx, da)
+	if err != nil {
+		t.Fatalf("polling for tokens failed: %s", err)
+	}
+	if p.pending != 0 {
+		t.Errorf("expected to keep polling while authorization was pending")
+	}
+
+	if tokens.IDTokenExpiry().Before(time.Now()) {
+		t.Errorf("expected the ID token to expire in the future, got %s", tokens.IDTokenExpiry())
+	}
+
+	v := NewVerifier(p.URL, "dotmesh")
+	claims, err := v.Verify(ctx, tokens.IDToken)
+	if err != nil {
+		t.Fatalf("verification failed: %s", err)
+	}
+	if claims.Email != "alice@example.com" || !claims.EmailVerified {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+
+	refreshed, err := c.Refresh(ctx, tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("refresh failed: %s", err)
+	}
+	if refreshed.RefreshToken != "refresh-refresh_token" {
+		t.Errorf("unexpected refresh token %s", refreshed.RefreshToken)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	p := newTestProvider(t)
+	defer p.Close()
+	ctx := context.Background()
+	v := NewVerifier(p.URL, "dotmesh")
+
+	if _, err := v.Verify(ctx, p.idToken(t, "someone-else", time.Now().Add(time.Hour))); err == nil {
+		t.Errorf("expected a token for another client to be rejected")
+	}
+	if _, err := v.Verify(ctx, p.idToken(t, "dotmesh", time.Now().Add(-time.Hour))); err == nil {
+		t.Errorf("expected an expired token to be rejected")
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.key = other
+	if _, err := v.Verify(ctx, p.idToken(t, "dotmesh", time.Now().Add(time.Hour))); err == nil {
+		t.Errorf("expected a token signed with the wrong key to be rejected")
+	}
+}
@@ -0,0 +1,166 @@
+package oidc
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"golang.org/x/net/context"
+)
+
+// keys are fetched again when a token is signed with one we don't know, but
+// no more often than this
+const minKeyRefreshInterval = time.Minute
+
+// Claims - what the server needs to know about a verified ID token
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Expiry        time.Time
+}
+
+// Verifier checks ID tokens issued by one provider for one client.
+type Verifier struct {
+	issuerURL string
+	clientID  string
+	// HTTPClient is http.DefaultClient if nil
+	HTTPClient *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+}
+
+func NewVerifier(issuerURL, clientID string) *Verifier {
+	return &Verifier{
+		issuerURL: issuerURL,
+		clientID:  clientID,
+		keys:      map[string]*rsa.PublicKey{},
+	}
+}
+
+// Verify checks rawIDToken's signature, issuer, audience and expiry.
+func (v *Verifier) Verify(ctx context.Context, rawIDToken string) (*Claims, error) {
+	token, err := jwt.Parse(rawIDToken, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return v.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %s", err)
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("invalid ID token: unexpected claims %T", token.Claims)
+	}
+
+	issuer, _ := claims["iss"].(string)
+	if strings.TrimSuffix(issuer, "/") != strings.TrimSuffix(v.issuerURL, "/") {
+		return nil, fmt.Errorf("ID token was issued by %s, not %s", issuer, v.issuerURL)
+	}
+	if !hasAudience(claims["aud"], v.clientID) {
+		return nil, fmt.Errorf("ID token was not issued for client %s", v.clientID)
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("ID token has no expiry")
+	}
+
+	result := &Claims{Expiry: time.Unix(int64(exp), 0)}
+	result.Subject, _ = claims["sub"].(string)
+	result.Email, _ = claims["email"].(string)
+	result.EmailVerified, _ = claims["email_verified"].(bool)
+	return result, nil
+}
+
+// aud is either a string or a list of them
+func hasAudience(aud interface{}, clientID string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == clientID
+	case []interface{}:
+		for _, s := range a {
+			if s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (v *Verifier) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(v.keysFetched) < minKeyRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	keys, err := v.fetchKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	v.keys = keys
+	v.keysFetched = time.Now()
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func (v *Verifier) fetchKeys(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	metadata, err := Discover(ctx, v.HTTPClient, v.issuerURL)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", metadata.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	err = doJSON(ctx, v.HTTPClient, req, &jwks)
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching signing keys from %s: %s", metadata.JWKSURI, err)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return keys, nil
+}
@@ -40,6 +40,7 @@ type Registry interface {
 
 	UpdateCollaborators(ctx context.Context, tlf types.TopLevelFilesystem, newCollaborators []user.SafeUser) error
 	RegisterClone(name string, topLevelFilesystemId string, clone types.Clone) error
+	RenameClone(topLevelFilesystemId, oldName, newName string) error
 	RegisterFork(originFilesystemId string, originSnapshotId string, forkName types.VolumeName, forkFilesystemId string) error
 
 	// TODO: why ..FromEtcd?
@@ -195,7 +196,7 @@ func (r *DefaultRegistry) GetByName(name types.VolumeName) (types.TopLevelFilesy
 	tlf, ok := r.topLevelFilesystems[name]
 	if !ok {
 		return types.TopLevelFilesystem{},
-			fmt.Errorf("No such top-level filesystem")
+			types.NewAPIError(types.ErrCodeVolumeNotFound, "No such top-level filesystem")
 	}
 	return tlf, nil
 }
@@ -350,6 +351,18 @@ func (r *DefaultRegistry) RegisterClone(name string, topLevelFilesystemId string
 	return r.registryStore.SetClone(&clone, &store.SetOptions{})
 }
 
+// RenameClone gives a branch a new name; its filesystem, and so its data and
+// commits, stay the same.
+func (r *DefaultRegistry) RenameClone(topLevelFilesystemId, oldName, newName string) error {
+	clone, err := r.registryStore.RenameClone(topLevelFilesystemId, oldName, newName)
+	if err != nil {
+		return err
+	}
+	r.UpdateCloneFromEtcd(newName, topLevelFilesystemId, *clone)
+	r.DeleteCloneFromEtcd(oldName, topLevelFilesystemId)
+	return nil
+}
+
 func (r *DefaultRegistry) DeleteFilesystemFromEtcd(name types.VolumeName) {
 	r.topLevelFilesystemsLock.Lock()
 	delete(r.topLevelFilesystems, name)
@@ -407,14 +420,17 @@ func (r *DefaultRegistry) DeleteCloneFromEtcd(name string, topLevelFilesystemId
 	r.clonesLock.Lock()
 	defer r.clonesLock.Unlock()
 
-	delete(r.clones, topLevelFilesystemId)
+	delete(r.clones[topLevelFilesystemId], name)
+	if len(r.clones[topLevelFilesystemId]) == 0 {
+		delete(r.clones, topLevelFilesystemId)
+	}
 }
 
 func (r *DefaultRegistry) LookupFilesystem(name types.VolumeName) (types.TopLevelFilesystem, error) {
 	r.topLevelFilesystemsLock.RLock()
 	defer r.topLevelFilesystemsLock.RUnlock()
 	if _, ok := r.topLevelFilesystems[name]; !ok {
-		return types.TopLevelFilesystem{}, fmt.Errorf("No such filesystem named '%s'", name)
+		return types.TopLevelFilesystem{}, types.NewAPIError(types.ErrCodeVolumeNotFound, "No such filesystem named '%s'", name)
 	}
 	return r.topLevelFilesystems[name], nil
 }
@@ -425,10 +441,10 @@ func (r *DefaultRegistry) LookupClone(topLevelFilesystemId, cloneName string) (t
 	r.clonesLock.RLock()
 	defer r.clonesLock.RUnlock()
 	if _, ok := r.clones[topLevelFilesystemId]; !ok {
-		return types.Clone{}, fmt.Errorf("No clones at all, let alone named '%s' for filesystem id '%s'", cloneName, topLevelFilesystemId)
+		return types.Clone{}, types.NewAPIError(types.ErrCodeVolumeNotFound, "No clones at all, let alone named '%s' for filesystem id '%s'", cloneName, topLevelFilesystemId)
 	}
 	if _, ok := r.clones[topLevelFilesystemId][cloneName]; !ok {
-		return types.Clone{}, fmt.Errorf("No clone named '%s' for filesystem id '%s'", cloneName, topLevelFilesystemId)
+		return types.Clone{}, types.NewAPIError(types.ErrCodeVolumeNotFound, "No clone named '%s' for filesystem id '%s'", cloneName, topLevelFilesystemId)
 	}
 	return r.clones[topLevelFilesystemId][cloneName], nil
 }
@@ -236,3 +236,41 @@ func TestGetFilesystemByID(t *testing.T) {
 		t.Errorf("unexpected clone origin fs ID: %s", foundClone.Origin.FilesystemId)
 	}
 }
+
+func TestRenameClone(t *testing.T) {
+	client, err := store.NewKVDBClient(&store.KVDBConfig{
+		Type: store.KVTypeMem,
+	})
+	if err != nil {
+		t.Fatalf("failed to init kv store: %s", err)
+	}
+	idxStore := store.NewKVDBStoreWithIndex(client, "users")
+
+	um := user.NewInternal(idxStore)
+	kvClient := store.NewKVDBFilesystemStore(client)
+	registry := NewRegistry(um, kvClient)
+
+	for _, name := range []string{"typo", "other"} {
+		err = registry.RegisterClone(name, "tlf-1", types.Clone{FilesystemId: "fs-" + name})
+		if err != nil {
+			t.Fatalf("failed to register clone: %s", err)
+		}
+	}
+
+	err = registry.RenameClone("tlf-1", "typo", "fixed")
+	if err != nil {
+		t.Fatalf("failed to rename clone: %s", err)
+	}
+
+	if _, err := registry.LookupClone("tlf-1", "typo"); err == nil {
+		t.Errorf("expected the old name to be gone")
+	}
+	clone, err := registry.LookupClone("tlf-1", "fixed")
+	if err != nil || clone.FilesystemId != "fs-typo" {
+		t.Errorf("expected fixed to be fs-typo, got %#v, %v", clone, err)
+	}
+	// deleting one clone mustn't lose the others
+	if _, err := registry.LookupClone("tlf-1", "other"); err != nil {
+		t.Errorf("expected other to be untouched: %s", err)
+	}
+}
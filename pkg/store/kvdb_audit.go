@@ -0,0 +1,120 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+	"github.com/portworx/kvdb"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// static AuditStore check
+var _ AuditStore = &KVAuditStore{}
+
+const (
+	AuditEventsPrefix = "audit/events/"
+	AuditSequenceKey  = "audit/sequence"
+
+	// DefaultAuditLogCapacity is how many events are kept before the oldest
+	// are overwritten
+	DefaultAuditLogCapacity = 10000
+
+	// attempts at claiming the next slot before giving up
+	sequenceRetries = 10
+)
+
+// KVAuditStore keeps audit events in a fixed number of slots, as a ring
+// buffer, so the log can't grow without bound.
+type KVAuditStore struct {
+	client   kvdb.Kvdb
+	capacity uint64
+}
+
+func NewKVAuditStore(client kvdb.Kvdb, capacity uint64) *KVAuditStore {
+	if capacity == 0 {
+		capacity = DefaultAuditLogCapacity
+	}
+	return &KVAuditStore{
+		client:   client,
+		capacity: capacity,
+	}
+}
+
+func (s *KVAuditStore) AppendAuditEvent(e *types.AuditEvent) error {
+	seq, err := nextSequence(s.client, AuditSequenceKey)
+	if err != nil {
+		return err
+	}
+	bts, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.Put(AuditEventsPrefix+fmt.Sprintf("%d", seq%s.capacity), bts, 0)
+	return err
+}
+
+// nextSequence claims a sequence number from key with a compare-and-set, so
+// that servers appending to the same ring buffer at the same time don't
+// overwrite each other's entries.
+func nextSequence(client kvdb.Kvdb, key string) (uint64, error) {
+	for i := 0; i < sequenceRetries; i++ {
+		kvp, err := client.Get(key)
+		if err == kvdb.ErrNotFound {
+			_, err = client.Create(key, []byte("1"), 0)
+			if err == nil {
+				return 0, nil
+			}
+			if err == kvdb.ErrExist {
+				continue
+			}
+			return 0, err
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		seq, err := strconv.ParseUint(string(kvp.Value), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse sequence %s '%s': %s", key, string(kvp.Value), err)
+		}
+		kvp.Value = []byte(strconv.FormatUint(seq+1, 10))
+		_, err = client.CompareAndSet(kvp, kvdb.KVModifiedIndex, nil)
+		if err == nil {
+			return seq, nil
+		}
+		if err != kvdb.ErrModified {
+			return 0, err
+		}
+	}
+	return 0, fmt.Errorf("failed to claim a slot from %s after %d attempts", key, sequenceRetries)
+}
+
+// ListAuditEvents returns every event still in the buffer, oldest first.
+func (s *KVAuditStore) ListAuditEvents() ([]types.AuditEvent, error) {
+	pairs, err := s.client.Enumerate(AuditEventsPrefix)
+	if err != nil {
+		return nil, err
+	}
+	events := []types.AuditEvent{}
+	for _, kvp := range pairs {
+		var e types.AuditEvent
+		err = json.Unmarshal(kvp.Value, &e)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"key":   kvp.Key,
+				"value": string(kvp.Value),
+			}).Error("failed to unmarshal value into types.AuditEvent")
+			continue
+		}
+		events = append(events, e)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+	return events, nil
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+)
+
+func TestAuditRingBuffer(t *testing.T) {
+	client, err := getKVDBClient(&KVDBConfig{
+		Type: KVTypeMem,
+	})
+	if err != nil {
+		t.Fatalf("failed to init kv store: %s", err)
+	}
+
+	audit := NewKVAuditStore(client, 3)
+
+	base := time.Now()
+	for i := 0; i < 5; i++ {
+		err = audit.AppendAuditEvent(&types.AuditEvent{
+			Timestamp: base.Add(time.Duration(i) * time.Second),
+			Operation: fmt.Sprintf("op%d", i),
+		})
+		if err != nil {
+			t.Fatalf("failed to append event %d: %s", i, err)
+		}
+	}
+
+	events, err := audit.ListAuditEvents()
+	if err != nil {
+		t.Fatalf("failed to list events: %s", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected the 3 most recent events, got %d", len(events))
+	}
+	for i, e := range events {
+		expected := fmt.Sprintf("op%d", i+2)
+		if e.Operation != expected {
+			t.Errorf("expected event %d to be %s, got %s", i, expected, e.Operation)
+		}
+	}
+}
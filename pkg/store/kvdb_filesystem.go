@@ -742,3 +742,483 @@ func (s *KVDBFilesystemStore) ListTransfers() ([]*types.TransferPollResult, erro
 
 	return result, nil
 }
+
+// Soft deleted (recycle bin)
+
+func (s *KVDBFilesystemStore) SetSoftDeleted(f *types.FilesystemSoftDeletion, opts *SetOptions) error {
+	if f.FilesystemID == "" {
+		log.WithFields(log.Fields{
+			"error":  ErrIDNotSet,
+			"object": f,
+		}).Error("[SetSoftDeleted] called without FilesystemID")
+		return ErrIDNotSet
+	}
+
+	bts, err := s.encode(f)
+	if err != nil {
+		return err
+	}
+
+	if opts.Force {
+		_, err = s.client.Put(FilesystemSoftDeletedPrefix+f.FilesystemID, bts, 0)
+		return err
+	}
+
+	_, err = s.client.Create(FilesystemSoftDeletedPrefix+f.FilesystemID, bts, 0)
+	return err
+}
+
+func (s *KVDBFilesystemStore) GetSoftDeleted(id string) (*types.FilesystemSoftDeletion, error) {
+	node, err := s.client.Get(FilesystemSoftDeletedPrefix + id)
+	if err != nil {
+		return nil, err
+	}
+	var f types.FilesystemSoftDeletion
+	err = s.decode(node.Value, &f)
+
+	f.Meta = getMeta(node)
+
+	return &f, err
+}
+
+func (s *KVDBFilesystemStore) DeleteSoftDeleted(id string) error {
+	if id == "" {
+		return ErrIDNotSet
+	}
+	_, err := s.client.Delete(FilesystemSoftDeletedPrefix + id)
+	return err
+}
+
+func (s *KVDBFilesystemStore) ListSoftDeleted() ([]*types.FilesystemSoftDeletion, error) {
+	pairs, err := s.client.Enumerate(FilesystemSoftDeletedPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var result []*types.FilesystemSoftDeletion
+
+	for _, kvp := range pairs {
+		var val types.FilesystemSoftDeletion
+
+		err = json.Unmarshal(kvp.Value, &val)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"key":   kvp.Key,
+				"value": string(kvp.Value),
+			}).Error("failed to unmarshal value")
+			continue
+		}
+
+		val.Meta = getMeta(kvp)
+
+		result = append(result, &val)
+	}
+
+	return result, nil
+}
+
+// ACLs (volume sharing)
+
+func (s *KVDBFilesystemStore) SetACL(acl *types.FilesystemACL, opts *SetOptions) error {
+	if acl.FilesystemID == "" {
+		log.WithFields(log.Fields{
+			"error":  ErrIDNotSet,
+			"object": acl,
+		}).Error("[SetACL] called without FilesystemID")
+		return ErrIDNotSet
+	}
+
+	bts, err := s.encode(acl)
+	if err != nil {
+		return err
+	}
+
+	if opts.Force {
+		_, err = s.client.Put(FilesystemACLPrefix+acl.FilesystemID, bts, 0)
+		return err
+	}
+
+	_, err = s.client.Create(FilesystemACLPrefix+acl.FilesystemID, bts, 0)
+	return err
+}
+
+func (s *KVDBFilesystemStore) GetACL(id string) (*types.FilesystemACL, error) {
+	node, err := s.client.Get(FilesystemACLPrefix + id)
+	if err != nil {
+		return nil, err
+	}
+	var acl types.FilesystemACL
+	err = s.decode(node.Value, &acl)
+
+	acl.Meta = getMeta(node)
+
+	return &acl, err
+}
+
+func (s *KVDBFilesystemStore) DeleteACL(id string) error {
+	if id == "" {
+		return ErrIDNotSet
+	}
+	_, err := s.client.Delete(FilesystemACLPrefix + id)
+	return err
+}
+
+// Snapshot schedules
+
+func (s *KVDBFilesystemStore) SetSnapshotSchedule(ss *types.SnapshotSchedule, opts *SetOptions) error {
+	if ss.FilesystemID == "" {
+		log.WithFields(log.Fields{
+			"error":  ErrIDNotSet,
+			"object": ss,
+		}).Error("[SetSnapshotSchedule] called without FilesystemID")
+		return ErrIDNotSet
+	}
+
+	bts, err := s.encode(ss)
+	if err != nil {
+		return err
+	}
+
+	if opts.Force {
+		_, err = s.client.Put(FilesystemSnapshotSchedulesPrefix+ss.FilesystemID, bts, 0)
+		return err
+	}
+
+	_, err = s.client.Create(FilesystemSnapshotSchedulesPrefix+ss.FilesystemID, bts, 0)
+	return err
+}
+
+func (s *KVDBFilesystemStore) GetSnapshotSchedule(id string) (*types.SnapshotSchedule, error) {
+	node, err := s.client.Get(FilesystemSnapshotSchedulesPrefix + id)
+	if err != nil {
+		return nil, err
+	}
+	var ss types.SnapshotSchedule
+	err = s.decode(node.Value, &ss)
+
+	ss.Meta = getMeta(node)
+
+	return &ss, err
+}
+
+func (s *KVDBFilesystemStore) DeleteSnapshotSchedule(id string) error {
+	if id == "" {
+		return ErrIDNotSet
+	}
+	_, err := s.client.Delete(FilesystemSnapshotSchedulesPrefix + id)
+	return err
+}
+
+func (s *KVDBFilesystemStore) ListSnapshotSchedules() ([]*types.SnapshotSchedule, error) {
+	pairs, err := s.client.Enumerate(FilesystemSnapshotSchedulesPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var result []*types.SnapshotSchedule
+
+	for _, kvp := range pairs {
+		var val types.SnapshotSchedule
+
+		err = json.Unmarshal(kvp.Value, &val)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"key":   kvp.Key,
+				"value": string(kvp.Value),
+			}).Error("failed to unmarshal value")
+			continue
+		}
+
+		val.Meta = getMeta(kvp)
+
+		result = append(result, &val)
+	}
+
+	return result, nil
+}
+
+// Retention policies
+
+func (s *KVDBFilesystemStore) SetRetentionPolicy(rp *types.FilesystemRetentionPolicy, opts *SetOptions) error {
+	if rp.FilesystemID == "" {
+		log.WithFields(log.Fields{
+			"error":  ErrIDNotSet,
+			"object": rp,
+		}).Error("[SetRetentionPolicy] called without FilesystemID")
+		return ErrIDNotSet
+	}
+
+	bts, err := s.encode(rp)
+	if err != nil {
+		return err
+	}
+
+	if opts.Force {
+		_, err = s.client.Put(FilesystemRetentionPoliciesPrefix+rp.FilesystemID, bts, 0)
+		return err
+	}
+
+	_, err = s.client.Create(FilesystemRetentionPoliciesPrefix+rp.FilesystemID, bts, 0)
+	return err
+}
+
+func (s *KVDBFilesystemStore) GetRetentionPolicy(id string) (*types.FilesystemRetentionPolicy, error) {
+	node, err := s.client.Get(FilesystemRetentionPoliciesPrefix + id)
+	if err != nil {
+		return nil, err
+	}
+	var rp types.FilesystemRetentionPolicy
+	err = s.decode(node.Value, &rp)
+
+	rp.Meta = getMeta(node)
+
+	return &rp, err
+}
+
+func (s *KVDBFilesystemStore) DeleteRetentionPolicy(id string) error {
+	if id == "" {
+		return ErrIDNotSet
+	}
+	_, err := s.client.Delete(FilesystemRetentionPoliciesPrefix + id)
+	return err
+}
+
+func (s *KVDBFilesystemStore) ListRetentionPolicies() ([]*types.FilesystemRetentionPolicy, error) {
+	pairs, err := s.client.Enumerate(FilesystemRetentionPoliciesPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var result []*types.FilesystemRetentionPolicy
+
+	for _, kvp := range pairs {
+		var val types.FilesystemRetentionPolicy
+
+		err = json.Unmarshal(kvp.Value, &val)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"key":   kvp.Key,
+				"value": string(kvp.Value),
+			}).Error("failed to unmarshal value")
+			continue
+		}
+
+		val.Meta = getMeta(kvp)
+
+		result = append(result, &val)
+	}
+
+	return result, nil
+}
+
+// Commit tags
+
+func (s *KVDBFilesystemStore) SetTags(ft *types.FilesystemTags, opts *SetOptions) error {
+	if ft.FilesystemID == "" {
+		log.WithFields(log.Fields{
+			"error":  ErrIDNotSet,
+			"object": ft,
+		}).Error("[SetTags] called without FilesystemID")
+		return ErrIDNotSet
+	}
+
+	bts, err := s.encode(ft)
+	if err != nil {
+		return err
+	}
+
+	if opts.Force {
+		_, err = s.client.Put(FilesystemTagsPrefix+ft.FilesystemID, bts, 0)
+		return err
+	}
+
+	_, err = s.client.Create(FilesystemTagsPrefix+ft.FilesystemID, bts, 0)
+	return err
+}
+
+func (s *KVDBFilesystemStore) GetTags(id string) (*types.FilesystemTags, error) {
+	node, err := s.client.Get(FilesystemTagsPrefix + id)
+	if err != nil {
+		return nil, err
+	}
+	var ft types.FilesystemTags
+	err = s.decode(node.Value, &ft)
+
+	ft.Meta = getMeta(node)
+
+	return &ft, err
+}
+
+func (s *KVDBFilesystemStore) DeleteTags(id string) error {
+	if id == "" {
+		return ErrIDNotSet
+	}
+	_, err := s.client.Delete(FilesystemTagsPrefix + id)
+	return err
+}
+
+// Changed commit metadata
+
+func (s *KVDBFilesystemStore) SetCommitMetadata(fcm *types.FilesystemCommitMetadata, opts *SetOptions) error {
+	if fcm.FilesystemID == "" {
+		log.WithFields(log.Fields{
+			"error":  ErrIDNotSet,
+			"object": fcm,
+		}).Error("[SetCommitMetadata] called without FilesystemID")
+		return ErrIDNotSet
+	}
+
+	bts, err := s.encode(fcm)
+	if err != nil {
+		return err
+	}
+
+	if opts.Force {
+		_, err = s.client.Put(FilesystemCommitMetadataPrefix+fcm.FilesystemID, bts, 0)
+		return err
+	}
+
+	_, err = s.client.Create(FilesystemCommitMetadataPrefix+fcm.FilesystemID, bts, 0)
+	return err
+}
+
+func (s *KVDBFilesystemStore) GetCommitMetadata(id string) (*types.FilesystemCommitMetadata, error) {
+	node, err := s.client.Get(FilesystemCommitMetadataPrefix + id)
+	if err != nil {
+		return nil, err
+	}
+	var fcm types.FilesystemCommitMetadata
+	err = s.decode(node.Value, &fcm)
+
+	fcm.Meta = getMeta(node)
+
+	return &fcm, err
+}
+
+func (s *KVDBFilesystemStore) DeleteCommitMetadata(id string) error {
+	if id == "" {
+		return ErrIDNotSet
+	}
+	_, err := s.client.Delete(FilesystemCommitMetadataPrefix + id)
+	return err
+}
+
+// Default branches
+
+func (s *KVDBFilesystemStore) SetDefaultBranch(db *types.FilesystemDefaultBranch, opts *SetOptions) error {
+	if db.FilesystemID == "" {
+		log.WithFields(log.Fields{
+			"error":  ErrIDNotSet,
+			"object": db,
+		}).Error("[SetDefaultBranch] called without FilesystemID")
+		return ErrIDNotSet
+	}
+
+	bts, err := s.encode(db)
+	if err != nil {
+		return err
+	}
+
+	if opts.Force {
+		_, err = s.client.Put(FilesystemDefaultBranchPrefix+db.FilesystemID, bts, 0)
+		return err
+	}
+
+	_, err = s.client.Create(FilesystemDefaultBranchPrefix+db.FilesystemID, bts, 0)
+	return err
+}
+
+func (s *KVDBFilesystemStore) GetDefaultBranch(id string) (*types.FilesystemDefaultBranch, error) {
+	node, err := s.client.Get(FilesystemDefaultBranchPrefix + id)
+	if err != nil {
+		return nil, err
+	}
+	var db types.FilesystemDefaultBranch
+	err = s.decode(node.Value, &db)
+
+	db.Meta = getMeta(node)
+
+	return &db, err
+}
+
+func (s *KVDBFilesystemStore) DeleteDefaultBranch(id string) error {
+	if id == "" {
+		return ErrIDNotSet
+	}
+	_, err := s.client.Delete(FilesystemDefaultBranchPrefix + id)
+	return err
+}
+
+func (s *KVDBFilesystemStore) ListDefaultBranches() ([]*types.FilesystemDefaultBranch, error) {
+	pairs, err := s.client.Enumerate(FilesystemDefaultBranchPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var result []*types.FilesystemDefaultBranch
+
+	for _, kvp := range pairs {
+		var val types.FilesystemDefaultBranch
+
+		err = json.Unmarshal(kvp.Value, &val)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"key":   kvp.Key,
+				"value": string(kvp.Value),
+			}).Error("failed to unmarshal value")
+			continue
+		}
+
+		val.Meta = getMeta(kvp)
+
+		result = append(result, &val)
+	}
+
+	return result, nil
+}
+
+// Quotas
+
+func (s *KVDBFilesystemStore) SetQuota(q *types.FilesystemQuota, opts *SetOptions) error {
+	if q.FilesystemID == "" {
+		log.WithFields(log.Fields{
+			"error":  ErrIDNotSet,
+			"object": q,
+		}).Error("[SetQuota] called without FilesystemID")
+		return ErrIDNotSet
+	}
+
+	bts, err := s.encode(q)
+	if err != nil {
+		return err
+	}
+
+	if opts.Force {
+		_, err = s.client.Put(FilesystemQuotasPrefix+q.FilesystemID, bts, 0)
+		return err
+	}
+
+	_, err = s.client.Create(FilesystemQuotasPrefix+q.FilesystemID, bts, 0)
+	return err
+}
+
+func (s *KVDBFilesystemStore) GetQuota(id string) (*types.FilesystemQuota, error) {
+	node, err := s.client.Get(FilesystemQuotasPrefix + id)
+	if err != nil {
+		return nil, err
+	}
+	var q types.FilesystemQuota
+	err = s.decode(node.Value, &q)
+
+	q.Meta = getMeta(node)
+
+	return &q, err
+}
+
+func (s *KVDBFilesystemStore) DeleteQuota(id string) error {
+	if id == "" {
+		return ErrIDNotSet
+	}
+	_, err := s.client.Delete(FilesystemQuotasPrefix + id)
+	return err
+}
@@ -271,3 +271,360 @@ func TestWatchTransfers(t *testing.T) {
 		}
 	}
 }
+
+func TestSoftDeletedRoundTrip(t *testing.T) {
+	client, err := getKVDBClient(&KVDBConfig{
+		Type: KVTypeMem,
+	})
+	if err != nil {
+		t.Fatalf("failed to init kv store: %s", err)
+	}
+
+	kvdb := NewKVDBFilesystemStore(client)
+
+	deletedAt := time.Now()
+	sd := &types.FilesystemSoftDeletion{
+		FilesystemID: "fs-1",
+		Name:         types.VolumeName{Namespace: "admin", Name: "apples"},
+		Username:     "admin",
+		DeletedAt:    deletedAt,
+		ExpiresAt:    deletedAt.Add(time.Hour),
+	}
+
+	err = kvdb.SetSoftDeleted(sd, &SetOptions{})
+	if err != nil {
+		t.Fatalf("failed to set soft deleted: %s", err)
+	}
+
+	err = kvdb.SetSoftDeleted(sd, &SetOptions{})
+	if !IsKeyAlreadyExist(err) {
+		t.Errorf("expected key to already exist, got: %v", err)
+	}
+
+	got, err := kvdb.GetSoftDeleted("fs-1")
+	if err != nil {
+		t.Fatalf("failed to get soft deleted: %s", err)
+	}
+	if got.Name != sd.Name || !got.ExpiresAt.Equal(sd.ExpiresAt) {
+		t.Errorf("unexpected soft deletion record: %#v", got)
+	}
+
+	list, err := kvdb.ListSoftDeleted()
+	if err != nil {
+		t.Fatalf("failed to list soft deleted: %s", err)
+	}
+	if len(list) != 1 {
+		t.Errorf("expected 1 soft deleted volume, got %d", len(list))
+	}
+
+	err = kvdb.DeleteSoftDeleted("fs-1")
+	if err != nil {
+		t.Fatalf("failed to delete soft deleted: %s", err)
+	}
+
+	_, err = kvdb.GetSoftDeleted("fs-1")
+	if !IsKeyNotFound(err) {
+		t.Errorf("expected key not found, got: %v", err)
+	}
+}
+
+func TestACLRoundTrip(t *testing.T) {
+	client, err := getKVDBClient(&KVDBConfig{
+		Type: KVTypeMem,
+	})
+	if err != nil {
+		t.Fatalf("failed to init kv store: %s", err)
+	}
+
+	kvdb := NewKVDBFilesystemStore(client)
+
+	acl := &types.FilesystemACL{
+		FilesystemID: "fs-1",
+		Entries: []types.ACLEntry{
+			{User: "bob", Permission: string(types.PermRead)},
+		},
+	}
+
+	err = kvdb.SetACL(acl, &SetOptions{})
+	if err != nil {
+		t.Fatalf("failed to set acl: %s", err)
+	}
+
+	acl.Entries = append(acl.Entries, types.ACLEntry{User: "alice", Permission: string(types.PermWrite)})
+	err = kvdb.SetACL(acl, &SetOptions{Force: true})
+	if err != nil {
+		t.Fatalf("failed to update acl: %s", err)
+	}
+
+	got, err := kvdb.GetACL("fs-1")
+	if err != nil {
+		t.Fatalf("failed to get acl: %s", err)
+	}
+	if len(got.Entries) != 2 || got.Entries[1].User != "alice" || got.Entries[1].Permission != "write" {
+		t.Errorf("unexpected acl: %#v", got)
+	}
+
+	err = kvdb.DeleteACL("fs-1")
+	if err != nil {
+		t.Fatalf("failed to delete acl: %s", err)
+	}
+
+	_, err = kvdb.GetACL("fs-1")
+	if !IsKeyNotFound(err) {
+		t.Errorf("expected key not found, got: %v", err)
+	}
+}
+
+func TestSnapshotScheduleRoundTrip(t *testing.T) {
+	client, err := getKVDBClient(&KVDBConfig{
+		Type: KVTypeMem,
+	})
+	if err != nil {
+		t.Fatalf("failed to init kv store: %s", err)
+	}
+
+	kvdb := NewKVDBFilesystemStore(client)
+
+	ss := &types.SnapshotSchedule{
+		FilesystemID: "fs-1",
+		Name:         types.VolumeName{Namespace: "admin", Name: "apples"},
+		CronExpr:     "@hourly",
+		RetainCount:  24,
+		LastRun:      time.Now(),
+	}
+
+	err = kvdb.SetSnapshotSchedule(ss, &SetOptions{Force: true})
+	if err != nil {
+		t.Fatalf("failed to set snapshot schedule: %s", err)
+	}
+
+	got, err := kvdb.GetSnapshotSchedule("fs-1")
+	if err != nil {
+		t.Fatalf("failed to get snapshot schedule: %s", err)
+	}
+	if got.CronExpr != "@hourly" || got.RetainCount != 24 || !got.LastRun.Equal(ss.LastRun) {
+		t.Errorf("unexpected snapshot schedule: %#v", got)
+	}
+
+	list, err := kvdb.ListSnapshotSchedules()
+	if err != nil {
+		t.Fatalf("failed to list snapshot schedules: %s", err)
+	}
+	if len(list) != 1 {
+		t.Errorf("expected 1 snapshot schedule, got %d", len(list))
+	}
+
+	err = kvdb.DeleteSnapshotSchedule("fs-1")
+	if err != nil {
+		t.Fatalf("failed to delete snapshot schedule: %s", err)
+	}
+
+	_, err = kvdb.GetSnapshotSchedule("fs-1")
+	if !IsKeyNotFound(err) {
+		t.Errorf("expected key not found, got: %v", err)
+	}
+}
+
+func TestRetentionPolicyRoundTrip(t *testing.T) {
+	client, err := getKVDBClient(&KVDBConfig{
+		Type: KVTypeMem,
+	})
+	if err != nil {
+		t.Fatalf("failed to init kv store: %s", err)
+	}
+
+	kvdb := NewKVDBFilesystemStore(client)
+
+	rp := &types.FilesystemRetentionPolicy{
+		FilesystemID: "fs-1",
+		Name:         types.VolumeName{Namespace: "admin", Name: "apples"},
+		Policy:       types.RetentionPolicy{MaxCount: 100, MaxAgeDays: 7, KeepTagged: true},
+	}
+
+	err = kvdb.SetRetentionPolicy(rp, &SetOptions{Force: true})
+	if err != nil {
+		t.Fatalf("failed to set retention policy: %s", err)
+	}
+
+	got, err := kvdb.GetRetentionPolicy("fs-1")
+	if err != nil {
+		t.Fatalf("failed to get retention policy: %s", err)
+	}
+	if got.Policy != rp.Policy || got.Name != rp.Name {
+		t.Errorf("unexpected retention policy: %#v", got)
+	}
+
+	list, err := kvdb.ListRetentionPolicies()
+	if err != nil {
+		t.Fatalf("failed to list retention policies: %s", err)
+	}
+	if len(list) != 1 {
+		t.Errorf("expected 1 retention policy, got %d", len(list))
+	}
+
+	err = kvdb.DeleteRetentionPolicy("fs-1")
+	if err != nil {
+		t.Fatalf("failed to delete retention policy: %s", err)
+	}
+
+	_, err = kvdb.GetRetentionPolicy("fs-1")
+	if !IsKeyNotFound(err) {
+		t.Errorf("expected key not found, got: %v", err)
+	}
+}
+
+func TestTagsRoundTrip(t *testing.T) {
+	client, err := getKVDBClient(&KVDBConfig{
+		Type: KVTypeMem,
+	})
+	if err != nil {
+		t.Fatalf("failed to init kv store: %s", err)
+	}
+
+	kvdb := NewKVDBFilesystemStore(client)
+
+	ft := &types.FilesystemTags{
+		FilesystemID: "fs-1",
+		Tags:         map[string]string{"release-v1.2": "commit-1"},
+	}
+
+	err = kvdb.SetTags(ft, &SetOptions{Force: true})
+	if err != nil {
+		t.Fatalf("failed to set tags: %s", err)
+	}
+
+	got, err := kvdb.GetTags("fs-1")
+	if err != nil {
+		t.Fatalf("failed to get tags: %s", err)
+	}
+	if got.Tags["release-v1.2"] != "commit-1" {
+		t.Errorf("unexpected tags: %#v", got)
+	}
+
+	err = kvdb.DeleteTags("fs-1")
+	if err != nil {
+		t.Fatalf("failed to delete tags: %s", err)
+	}
+
+	_, err = kvdb.GetTags("fs-1")
+	if !IsKeyNotFound(err) {
+		t.Errorf("expected key not found, got: %v", err)
+	}
+}
+
+func TestDefaultBranchRoundTrip(t *testing.T) {
+	client, err := getKVDBClient(&KVDBConfig{
+		Type: KVTypeMem,
+	})
+	if err != nil {
+		t.Fatalf("failed to init kv store: %s", err)
+	}
+
+	kvdb := NewKVDBFilesystemStore(client)
+
+	err = kvdb.SetDefaultBranch(&types.FilesystemDefaultBranch{FilesystemID: "fs-1", Branch: "main"}, &SetOptions{Force: true})
+	if err != nil {
+		t.Fatalf("failed to set default branch: %s", err)
+	}
+
+	got, err := kvdb.GetDefaultBranch("fs-1")
+	if err != nil {
+		t.Fatalf("failed to get default branch: %s", err)
+	}
+	if got.Branch != "main" {
+		t.Errorf("unexpected default branch: %#v", got)
+	}
+
+	list, err := kvdb.ListDefaultBranches()
+	if err != nil {
+		t.Fatalf("failed to list default branches: %s", err)
+	}
+	if len(list) != 1 || list[0].FilesystemID != "fs-1" || list[0].Branch != "main" {
+		t.Errorf("unexpected default branches: %#v", list)
+	}
+
+	err = kvdb.DeleteDefaultBranch("fs-1")
+	if err != nil {
+		t.Fatalf("failed to delete default branch: %s", err)
+	}
+
+	_, err = kvdb.GetDefaultBranch("fs-1")
+	if !IsKeyNotFound(err) {
+		t.Errorf("expected key not found, got: %v", err)
+	}
+}
+
+func TestQuotaRoundTrip(t *testing.T) {
+	client, err := getKVDBClient(&KVDBConfig{
+		Type: KVTypeMem,
+	})
+	if err != nil {
+		t.Fatalf("failed to init kv store: %s", err)
+	}
+
+	kvdb := NewKVDBFilesystemStore(client)
+
+	err = kvdb.SetQuota(&types.FilesystemQuota{FilesystemID: "fs-1", MaxBytes: 1 << 30}, &SetOptions{Force: true})
+	if err != nil {
+		t.Fatalf("failed to set quota: %s", err)
+	}
+
+	got, err := kvdb.GetQuota("fs-1")
+	if err != nil {
+		t.Fatalf("failed to get quota: %s", err)
+	}
+	if got.MaxBytes != 1<<30 {
+		t.Errorf("unexpected quota: %#v", got)
+	}
+
+	err = kvdb.DeleteQuota("fs-1")
+	if err != nil {
+		t.Fatalf("failed to delete quota: %s", err)
+	}
+
+	_, err = kvdb.GetQuota("fs-1")
+	if !IsKeyNotFound(err) {
+		t.Errorf("expected key not found, got: %v", err)
+	}
+}
+
+func TestCommitMetadataRoundTrip(t *testing.T) {
+	client, err := getKVDBClient(&KVDBConfig{
+		Type: KVTypeMem,
+	})
+	if err != nil {
+		t.Fatalf("failed to init kv store: %s", err)
+	}
+
+	kvdb := NewKVDBFilesystemStore(client)
+
+	fcm := &types.FilesystemCommitMetadata{
+		FilesystemID: "fs-1",
+		Commits: map[string]map[string]string{
+			"commit-1": {"message": "first", "ci-build": "42"},
+		},
+	}
+
+	err = kvdb.SetCommitMetadata(fcm, &SetOptions{Force: true})
+	if err != nil {
+		t.Fatalf("failed to set commit metadata: %s", err)
+	}
+
+	got, err := kvdb.GetCommitMetadata("fs-1")
+	if err != nil {
+		t.Fatalf("failed to get commit metadata: %s", err)
+	}
+	if got.Commits["commit-1"]["ci-build"] != "42" {
+		t.Errorf("unexpected commit metadata: %#v", got)
+	}
+
+	err = kvdb.DeleteCommitMetadata("fs-1")
+	if err != nil {
+		t.Fatalf("failed to delete commit metadata: %s", err)
+	}
+
+	_, err = kvdb.GetCommitMetadata("fs-1")
+	if !IsKeyNotFound(err) {
+		t.Errorf("expected key not found, got: %v", err)
+	}
+}
@@ -65,6 +65,43 @@ func (s *KVDBFilesystemStore) ImportClones(clones []*types.Clone, opts *ImportOp
 	return nil
 }
 
+// RenameClone moves a clone to a new name. kvdb has no transactions, so the
+// new name is claimed with a create, which fails if it's taken, and the old
+// one is then deleted only if it hasn't changed in the meantime; if that
+// fails the new name is released again, leaving the clone as it was.
+func (s *KVDBFilesystemStore) RenameClone(topLevelFilesystemID, oldName, newName string) (*types.Clone, error) {
+	oldKey := RegistryClonesPrefix + topLevelFilesystemID + "/" + oldName
+	kvp, err := s.client.Get(oldKey)
+	if err != nil {
+		return nil, err
+	}
+	var c types.Clone
+	err = s.decode(kvp.Value, &c)
+	if err != nil {
+		return nil, err
+	}
+	c.Name = newName
+	c.TopLevelFilesystemId = topLevelFilesystemID
+
+	err = s.SetClone(&c, &SetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.client.CompareAndDelete(kvp, kvdb.KVModifiedIndex)
+	if err != nil {
+		deleteErr := s.DeleteClone(topLevelFilesystemID, newName)
+		if deleteErr != nil {
+			log.WithFields(log.Fields{
+				"error":         deleteErr,
+				"clone":         newName,
+				"filesystem_id": c.FilesystemId,
+			}).Error("[RenameClone] failed to release new name after failing to delete the old one")
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
 func (s *KVDBFilesystemStore) DeleteClone(filesystemID, cloneName string) error {
 	_, err := s.client.Delete(RegistryClonesPrefix + filesystemID + "/" + cloneName)
 	return err
@@ -343,3 +380,77 @@ func (s *KVDBFilesystemStore) ImportFilesystems(fs []*types.RegistryFilesystem,
 	}
 	return nil
 }
+
+// Namespaces
+
+func (s *KVDBFilesystemStore) SetNamespace(ns *types.RegistryNamespace, opts *SetOptions) error {
+	if ns.Name == "" {
+		log.WithFields(log.Fields{
+			"error":  ErrIDNotSet,
+			"object": ns,
+		}).Error("[SetNamespace] called without Name")
+		return ErrIDNotSet
+	}
+
+	bts, err := s.encode(ns)
+	if err != nil {
+		return err
+	}
+
+	if opts.Force {
+		_, err = s.client.Put(RegistryNamespacesPrefix+ns.Name, bts, 0)
+		return err
+	}
+
+	_, err = s.client.Create(RegistryNamespacesPrefix+ns.Name, bts, 0)
+	return err
+}
+
+func (s *KVDBFilesystemStore) GetNamespace(name string) (*types.RegistryNamespace, error) {
+	node, err := s.client.Get(RegistryNamespacesPrefix + name)
+	if err != nil {
+		return nil, err
+	}
+	var ns types.RegistryNamespace
+	err = s.decode(node.Value, &ns)
+
+	ns.Meta = getMeta(node)
+
+	return &ns, err
+}
+
+func (s *KVDBFilesystemStore) DeleteNamespace(name string) error {
+	if name == "" {
+		return ErrIDNotSet
+	}
+	_, err := s.client.Delete(RegistryNamespacesPrefix + name)
+	return err
+}
+
+func (s *KVDBFilesystemStore) ListNamespaces() ([]*types.RegistryNamespace, error) {
+	pairs, err := s.client.Enumerate(RegistryNamespacesPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var result []*types.RegistryNamespace
+
+	for _, kvp := range pairs {
+		var val types.RegistryNamespace
+
+		err = json.Unmarshal(kvp.Value, &val)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"key":   kvp.Key,
+				"value": string(kvp.Value),
+			}).Error("failed to unmarshal value")
+			continue
+		}
+
+		val.Meta = getMeta(kvp)
+
+		result = append(result, &val)
+	}
+
+	return result, nil
+}
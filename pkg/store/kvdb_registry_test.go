@@ -0,0 +1,108 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+)
+
+func TestNamespaceRoundTrip(t *testing.T) {
+	client, err := getKVDBClient(&KVDBConfig{
+		Type: KVTypeMem,
+	})
+	if err != nil {
+		t.Fatalf("failed to init kv store: %s", err)
+	}
+
+	kvdb := NewKVDBFilesystemStore(client)
+
+	ns := &types.RegistryNamespace{Name: "bob", Owner: "bob"}
+	err = kvdb.SetNamespace(ns, &SetOptions{})
+	if err != nil {
+		t.Fatalf("failed to set namespace: %s", err)
+	}
+
+	err = kvdb.SetNamespace(ns, &SetOptions{})
+	if !IsKeyAlreadyExist(err) {
+		t.Errorf("expected key to already exist, got: %v", err)
+	}
+
+	ns.MaxBytes = 1024
+	err = kvdb.SetNamespace(ns, &SetOptions{Force: true})
+	if err != nil {
+		t.Fatalf("failed to update namespace: %s", err)
+	}
+
+	got, err := kvdb.GetNamespace("bob")
+	if err != nil {
+		t.Fatalf("failed to get namespace: %s", err)
+	}
+	if got.Owner != "bob" || got.MaxBytes != 1024 {
+		t.Errorf("unexpected namespace: %#v", got)
+	}
+
+	list, err := kvdb.ListNamespaces()
+	if err != nil {
+		t.Fatalf("failed to list namespaces: %s", err)
+	}
+	if len(list) != 1 {
+		t.Errorf("expected 1 namespace, got %d", len(list))
+	}
+
+	err = kvdb.DeleteNamespace("bob")
+	if err != nil {
+		t.Fatalf("failed to delete namespace: %s", err)
+	}
+
+	_, err = kvdb.GetNamespace("bob")
+	if !IsKeyNotFound(err) {
+		t.Errorf("expected key not found, got: %v", err)
+	}
+}
+
+func TestRenameClone(t *testing.T) {
+	client, err := getKVDBClient(&KVDBConfig{
+		Type: KVTypeMem,
+	})
+	if err != nil {
+		t.Fatalf("failed to init kv store: %s", err)
+	}
+
+	kvdb := NewKVDBFilesystemStore(client)
+
+	for _, name := range []string{"typo", "taken"} {
+		err = kvdb.SetClone(&types.Clone{
+			TopLevelFilesystemId: "tlf-1",
+			FilesystemId:         "fs-" + name,
+			Name:                 name,
+		}, &SetOptions{})
+		if err != nil {
+			t.Fatalf("failed to set clone: %s", err)
+		}
+	}
+
+	_, err = kvdb.RenameClone("tlf-1", "typo", "taken")
+	if !IsKeyAlreadyExist(err) {
+		t.Errorf("expected renaming onto an existing clone to fail, got: %v", err)
+	}
+
+	renamed, err := kvdb.RenameClone("tlf-1", "typo", "fixed")
+	if err != nil {
+		t.Fatalf("failed to rename clone: %s", err)
+	}
+	if renamed.Name != "fixed" || renamed.FilesystemId != "fs-typo" {
+		t.Errorf("unexpected renamed clone: %#v", renamed)
+	}
+
+	clones, err := kvdb.ListClones()
+	if err != nil {
+		t.Fatalf("failed to list clones: %s", err)
+	}
+	names := map[string]string{}
+	for _, c := range clones {
+		names[c.Name] = c.FilesystemId
+	}
+	if len(names) != 2 || names["fixed"] != "fs-typo" || names["taken"] != "fs-taken" {
+		t.Errorf("unexpected clones after rename: %v", names)
+	}
+}
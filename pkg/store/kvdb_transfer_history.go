@@ -0,0 +1,86 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+	"github.com/portworx/kvdb"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// static TransferHistoryStore check
+var _ TransferHistoryStore = &KVTransferHistoryStore{}
+
+const (
+	TransferHistoryPrefix      = "transfers/history/"
+	TransferHistorySequenceKey = "transfers/historySequence"
+
+	// DefaultTransferHistoryCapacity is how many finished transfers are kept
+	// before the oldest are overwritten, which is also the most that can be
+	// kept
+	DefaultTransferHistoryCapacity = 1000
+	MaxTransferHistoryCapacity     = 1000
+)
+
+// KVTransferHistoryStore keeps finished and failed transfers in a fixed
+// number of slots, as a ring buffer, like KVAuditStore.
+type KVTransferHistoryStore struct {
+	client   kvdb.Kvdb
+	capacity uint64
+}
+
+func NewKVTransferHistoryStore(client kvdb.Kvdb, capacity uint64) *KVTransferHistoryStore {
+	if capacity == 0 {
+		capacity = DefaultTransferHistoryCapacity
+	}
+	if capacity > MaxTransferHistoryCapacity {
+		capacity = MaxTransferHistoryCapacity
+	}
+	return &KVTransferHistoryStore{
+		client:   client,
+		capacity: capacity,
+	}
+}
+
+func (s *KVTransferHistoryStore) AppendTransferRecord(r *types.TransferRecord) error {
+	seq, err := nextSequence(s.client, TransferHistorySequenceKey)
+	if err != nil {
+		return err
+	}
+	bts, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.Put(TransferHistoryPrefix+fmt.Sprintf("%d", seq%s.capacity), bts, 0)
+	return err
+}
+
+// ListTransferRecords returns every record still in the buffer, oldest
+// first by when the transfer started.
+func (s *KVTransferHistoryStore) ListTransferRecords() ([]types.TransferRecord, error) {
+	pairs, err := s.client.Enumerate(TransferHistoryPrefix)
+	if err != nil {
+		return nil, err
+	}
+	records := []types.TransferRecord{}
+	for _, kvp := range pairs {
+		var r types.TransferRecord
+		err = json.Unmarshal(kvp.Value, &r)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"key":   kvp.Key,
+				"value": string(kvp.Value),
+			}).Error("failed to unmarshal value into types.TransferRecord")
+			continue
+		}
+		records = append(records, r)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].StartedAt.Before(records[j].StartedAt)
+	})
+	return records, nil
+}
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+)
+
+func TestTransferHistoryRingBuffer(t *testing.T) {
+	client, err := getKVDBClient(&KVDBConfig{
+		Type: KVTypeMem,
+	})
+	if err != nil {
+		t.Fatalf("failed to init kv store: %s", err)
+	}
+
+	history := NewKVTransferHistoryStore(client, 3)
+
+	base := time.Now()
+	for i := 0; i < 5; i++ {
+		err = history.AppendTransferRecord(&types.TransferRecord{
+			TransferID: fmt.Sprintf("transfer%d", i),
+			StartedAt:  base.Add(time.Duration(i) * time.Second),
+		})
+		if err != nil {
+			t.Fatalf("failed to append record %d: %s", i, err)
+		}
+	}
+
+	records, err := history.ListTransferRecords()
+	if err != nil {
+		t.Fatalf("failed to list records: %s", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected the 3 most recent records, got %d", len(records))
+	}
+	for i, r := range records {
+		expected := fmt.Sprintf("transfer%d", i+2)
+		if r.TransferID != expected {
+			t.Errorf("expected record %d to be %s, got %s", i, expected, r.TransferID)
+		}
+	}
+}
+
+func TestTransferHistoryCapacityLimit(t *testing.T) {
+	history := NewKVTransferHistoryStore(nil, MaxTransferHistoryCapacity+1)
+	if history.capacity != MaxTransferHistoryCapacity {
+		t.Errorf("expected the capacity to be capped at %d, got %d", MaxTransferHistoryCapacity, history.capacity)
+	}
+}
@@ -18,6 +18,8 @@ type KVStoreWithIndex interface {
 	AddToIndex(prefix, name, id string) error
 
 	Set(prefix, id string, val []byte) (*kvdb.KVPair, error)
+	// CompareAndSet only sets the value if it hasn't changed since prev was read
+	CompareAndSet(prefix, id string, val []byte, prev *kvdb.KVPair) (*kvdb.KVPair, error)
 	Get(prefix, ref string) (*kvdb.KVPair, error)
 	Delete(prefix, id string) error
 }
@@ -82,6 +84,15 @@ func (s *KVDBStoreWithIndex) Set(prefix, id string, val []byte) (*kvdb.KVPair, e
 	return s.client.Put(s.namespace+"/"+prefix+"/"+id, val, 0)
 }
 
+func (s *KVDBStoreWithIndex) CompareAndSet(prefix, id string, val []byte, prev *kvdb.KVPair) (*kvdb.KVPair, error) {
+	kvp := &kvdb.KVPair{
+		Key:           s.namespace + "/" + prefix + "/" + id,
+		Value:         val,
+		ModifiedIndex: prev.ModifiedIndex,
+	}
+	return s.client.CompareAndSet(kvp, kvdb.KVModifiedIndex, nil)
+}
+
 func (s *KVDBStoreWithIndex) Get(prefix, ref string) (*kvdb.KVPair, error) {
 	if validator.IsUUID(ref) {
 		return s.get(prefix, ref)
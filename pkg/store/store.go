@@ -23,6 +23,48 @@ type FilesystemStore interface {
 	WatchDeleted(idx uint64, cb WatchDeletedCB) error
 	ListDeleted() ([]*types.FilesystemDeletionAudit, error)
 
+	// /filesystems/softDeleted/<id>
+	SetSoftDeleted(sd *types.FilesystemSoftDeletion, opts *SetOptions) error
+	GetSoftDeleted(id string) (*types.FilesystemSoftDeletion, error)
+	DeleteSoftDeleted(id string) error
+	ListSoftDeleted() ([]*types.FilesystemSoftDeletion, error)
+
+	// /filesystems/acl/<id>
+	SetACL(acl *types.FilesystemACL, opts *SetOptions) error
+	GetACL(id string) (*types.FilesystemACL, error)
+	DeleteACL(id string) error
+
+	// /filesystems/snapshotSchedules/<id>
+	SetSnapshotSchedule(ss *types.SnapshotSchedule, opts *SetOptions) error
+	GetSnapshotSchedule(id string) (*types.SnapshotSchedule, error)
+	DeleteSnapshotSchedule(id string) error
+	ListSnapshotSchedules() ([]*types.SnapshotSchedule, error)
+
+	// /filesystems/retentionPolicies/<id>
+	SetRetentionPolicy(rp *types.FilesystemRetentionPolicy, opts *SetOptions) error
+	GetRetentionPolicy(id string) (*types.FilesystemRetentionPolicy, error)
+	DeleteRetentionPolicy(id string) error
+	ListRetentionPolicies() ([]*types.FilesystemRetentionPolicy, error)
+
+	// /filesystems/tags/<id>
+	SetTags(ft *types.FilesystemTags, opts *SetOptions) error
+	GetTags(id string) (*types.FilesystemTags, error)
+	DeleteTags(id string) error
+
+	SetCommitMetadata(fcm *types.FilesystemCommitMetadata, opts *SetOptions) error
+	GetCommitMetadata(id string) (*types.FilesystemCommitMetadata, error)
+	DeleteCommitMetadata(id string) error
+
+	// /filesystems/defaultBranch/<id>
+	SetDefaultBranch(db *types.FilesystemDefaultBranch, opts *SetOptions) error
+	GetDefaultBranch(id string) (*types.FilesystemDefaultBranch, error)
+	DeleteDefaultBranch(id string) error
+	ListDefaultBranches() ([]*types.FilesystemDefaultBranch, error)
+
+	SetQuota(q *types.FilesystemQuota, opts *SetOptions) error
+	GetQuota(id string) (*types.FilesystemQuota, error)
+	DeleteQuota(id string) error
+
 	// /filesystems/cleanupPending/<id>
 	SetCleanupPending(audit *types.FilesystemDeletionAudit, opts *SetOptions) error
 	DeleteCleanupPending(id string) error
@@ -65,6 +107,7 @@ type (
 type RegistryStore interface {
 	SetClone(c *types.Clone, opts *SetOptions) error
 	DeleteClone(filesystemID, cloneName string) error
+	RenameClone(topLevelFilesystemID, oldName, newName string) (*types.Clone, error)
 	WatchClones(idx uint64, cb WatchRegistryClonesCB) error
 	ListClones() ([]*types.Clone, error)
 
@@ -76,6 +119,11 @@ type RegistryStore interface {
 	WatchFilesystems(idx uint64, cb WatchRegistryFilesystemsCB) error
 	ListFilesystems() ([]*types.RegistryFilesystem, error)
 
+	SetNamespace(ns *types.RegistryNamespace, opts *SetOptions) error
+	GetNamespace(name string) (*types.RegistryNamespace, error)
+	DeleteNamespace(name string) error
+	ListNamespaces() ([]*types.RegistryNamespace, error)
+
 	// Misc
 	ImportClones(clones []*types.Clone, opts *ImportOptions) error
 	ImportFilesystems(fs []*types.RegistryFilesystem, opts *ImportOptions) error
@@ -106,6 +154,16 @@ type (
 	WatchServerSnapshotsClonesCB func(server *types.ServerSnapshots) error
 )
 
+type AuditStore interface {
+	AppendAuditEvent(e *types.AuditEvent) error
+	ListAuditEvents() ([]types.AuditEvent, error)
+}
+
+type TransferHistoryStore interface {
+	AppendTransferRecord(r *types.TransferRecord) error
+	ListTransferRecords() ([]types.TransferRecord, error)
+}
+
 type ImportOptions struct {
 	DeleteExisting bool
 }
@@ -1,18 +1,27 @@
 package store
 
 const (
-	FilesystemMastersPrefix        = "filesystems/masters/"
-	FilesystemDeletedPrefix        = "filesystems/deleted/"
-	FilesystemCleanupPendingPrefix = "filesystems/cleanupPending/"
-	FilesystemLivePrefix           = "filesystems/live/"
-	FilesystemContainersPrefix     = "filesystems/containers/"
-	FilesystemDirtyPrefix          = "filesystems/dirty/"
-	FilesystemTransfersPrefix      = "filesystems/transfers/"
+	FilesystemMastersPrefix           = "filesystems/masters/"
+	FilesystemDeletedPrefix           = "filesystems/deleted/"
+	FilesystemCleanupPendingPrefix    = "filesystems/cleanupPending/"
+	FilesystemLivePrefix              = "filesystems/live/"
+	FilesystemContainersPrefix        = "filesystems/containers/"
+	FilesystemDirtyPrefix             = "filesystems/dirty/"
+	FilesystemTransfersPrefix         = "filesystems/transfers/"
+	FilesystemSoftDeletedPrefix       = "filesystems/softDeleted/"
+	FilesystemACLPrefix               = "filesystems/acl/"
+	FilesystemSnapshotSchedulesPrefix = "filesystems/snapshotSchedules/"
+	FilesystemRetentionPoliciesPrefix = "filesystems/retentionPolicies/"
+	FilesystemTagsPrefix              = "filesystems/tags/"
+	FilesystemDefaultBranchPrefix     = "filesystems/defaultBranch/"
+	FilesystemQuotasPrefix            = "filesystems/quotas/"
+	FilesystemCommitMetadataPrefix    = "filesystems/commitMetadata/"
 )
 
 const (
 	RegistryClonesPrefix      = "registry/clones/"
 	RegistryFilesystemsPrefix = "registry/filesystems/"
+	RegistryNamespacesPrefix  = "registry/namespaces/"
 )
 
 type KVType string
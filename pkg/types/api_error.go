@@ -0,0 +1,34 @@
+package types
+
+import "fmt"
+
+// Codes for APIError
+const (
+	ErrCodeVolumeNotFound   = "VOLUME_NOT_FOUND"
+	ErrCodePermissionDenied = "PERMISSION_DENIED"
+	ErrCodeConflict         = "CONFLICT"
+	ErrCodeDefaultBranch    = "DEFAULT_BRANCH"
+	ErrCodeWouldDeleteAll   = "WOULD_DELETE_ALL"
+	ErrCodeOlderCommit      = "OLDER_COMMIT"
+	ErrCodeVolumeInUse      = "VOLUME_IN_USE"
+)
+
+// APIError is an error from the dotmesh API that says what kind of error it
+// is, so that callers can tell e.g. a volume not existing from the server
+// being unreachable without looking at the message. Servers send Code along
+// with the message in the data of JSON-RPC errors.
+type APIError struct {
+	Code    string
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+func NewAPIError(code, format string, args ...interface{}) *APIError {
+	return &APIError{
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
@@ -0,0 +1,83 @@
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+// AuditEvent - a record of a user changing something through the API
+type AuditEvent struct {
+	Timestamp time.Time
+	User      string
+	// Namespace and VolumeName are empty for operations that aren't about a
+	// volume, e.g. changing a password
+	Namespace  string
+	VolumeName string
+	// Operation is the RPC method, e.g. "DotmeshRPC.Commit"
+	Operation  string
+	RemoteAddr string
+	Success    bool
+	// Details - e.g. the branch, or the error if the operation failed
+	Details map[string]string
+}
+
+// AuditFilter - filters for GetAuditLog, an event has to match every field
+// that's set
+type AuditFilter struct {
+	User       string
+	Namespace  string
+	VolumeName string
+	Operation  string
+	After      time.Time
+	Before     time.Time
+	// Limit - maximum number of events to return, the most recent ones are
+	// kept. 0 means no limit
+	Limit int
+}
+
+func (f AuditFilter) Validate() error {
+	if f.Limit < 0 {
+		return fmt.Errorf("Limit must not be negative, got %d", f.Limit)
+	}
+	if !f.After.IsZero() && !f.Before.IsZero() && !f.After.Before(f.Before) {
+		return fmt.Errorf("After (%s) must be earlier than Before (%s)", f.After, f.Before)
+	}
+	return nil
+}
+
+func (f AuditFilter) Matches(e AuditEvent) bool {
+	if f.User != "" && e.User != f.User {
+		return false
+	}
+	if f.Namespace != "" && e.Namespace != f.Namespace {
+		return false
+	}
+	if f.VolumeName != "" && e.VolumeName != f.VolumeName {
+		return false
+	}
+	if f.Operation != "" && e.Operation != f.Operation {
+		return false
+	}
+	if !f.After.IsZero() && !e.Timestamp.After(f.After) {
+		return false
+	}
+	if !f.Before.IsZero() && !e.Timestamp.Before(f.Before) {
+		return false
+	}
+	return true
+}
+
+// Filter returns the events matching f, oldest first. events must already be
+// oldest first.
+func (f AuditFilter) Filter(events []AuditEvent) []AuditEvent {
+	result := []AuditEvent{}
+	for _, e := range events {
+		if f.Matches(e) {
+			result = append(result, e)
+		}
+	}
+	if f.Limit > 0 && len(result) > f.Limit {
+		result = result[len(result)-f.Limit:]
+	}
+	return result
+}
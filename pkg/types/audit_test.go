@@ -0,0 +1,45 @@
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAuditFilter(t *testing.T) {
+	base := time.Now()
+	events := []AuditEvent{
+		{Timestamp: base, User: "alice", Namespace: "alice", VolumeName: "a", Operation: "DotmeshRPC.Commit"},
+		{Timestamp: base.Add(time.Minute), User: "bob", Namespace: "alice", VolumeName: "a", Operation: "DotmeshRPC.Branch"},
+		{Timestamp: base.Add(2 * time.Minute), User: "alice", Namespace: "alice", VolumeName: "b", Operation: "DotmeshRPC.Commit"},
+	}
+
+	cases := []struct {
+		name     string
+		filter   AuditFilter
+		expected int
+	}{
+		{"everything", AuditFilter{}, 3},
+		{"user", AuditFilter{User: "alice"}, 2},
+		{"volume", AuditFilter{Namespace: "alice", VolumeName: "a"}, 2},
+		{"operation", AuditFilter{Operation: "DotmeshRPC.Branch"}, 1},
+		{"after", AuditFilter{After: base}, 2},
+		{"before", AuditFilter{Before: base.Add(time.Minute)}, 1},
+		{"limit", AuditFilter{Limit: 1}, 1},
+	}
+	for _, c := range cases {
+		got := c.filter.Filter(events)
+		if len(got) != c.expected {
+			t.Errorf("%s: expected %d events, got %d", c.name, c.expected, len(got))
+		}
+	}
+
+	// the limit keeps the most recent
+	got := AuditFilter{Limit: 1}.Filter(events)
+	if len(got) == 1 && got[0].VolumeName != "b" {
+		t.Errorf("expected the limit to keep the latest event, got %+v", got[0])
+	}
+
+	if err := (AuditFilter{Limit: -1}).Validate(); err == nil {
+		t.Errorf("expected a negative limit to be rejected")
+	}
+}
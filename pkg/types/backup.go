@@ -1,6 +1,10 @@
 package types
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
 
 type BackupV1 struct {
 	Version             string                `json:"version"`
@@ -14,3 +18,99 @@ type BackupV1 struct {
 const BackupVersion string = "v1"
 
 var BackupSupportedVersions = []string{"v1"}
+
+// RestoreStreamCapability - the key in the result of DotmeshRPC.Capabilities
+// that's true if backups can be restored by streaming their records to the
+// server's /restore endpoint
+const RestoreStreamCapability = "restore.stream"
+
+// BackupRecord - a line of a backup file: Key is one of BackupV1's JSON field
+// names, and Value is that field's value or, for the lists, one item of it.
+type BackupRecord struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Add sets the field of b that record is for, or appends to it for the lists.
+func (b *BackupV1) Add(record BackupRecord) error {
+	var err error
+	switch record.Key {
+	case "version":
+		err = json.Unmarshal(record.Value, &b.Version)
+	case "created":
+		err = json.Unmarshal(record.Value, &b.Created)
+	case "users":
+		var user *User
+		err = json.Unmarshal(record.Value, &user)
+		b.Users = append(b.Users, user)
+	case "filesystem_masters":
+		var master *FilesystemMaster
+		err = json.Unmarshal(record.Value, &master)
+		b.FilesystemMasters = append(b.FilesystemMasters, master)
+	case "registry_filesystems":
+		var filesystem *RegistryFilesystem
+		err = json.Unmarshal(record.Value, &filesystem)
+		b.RegistryFilesystems = append(b.RegistryFilesystems, filesystem)
+	case "registry_clones":
+		var clone *Clone
+		err = json.Unmarshal(record.Value, &clone)
+		b.RegistryClones = append(b.RegistryClones, clone)
+	default:
+		return fmt.Errorf("unknown backup record key '%s'", record.Key)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid backup record for '%s': %s", record.Key, err)
+	}
+	return nil
+}
+
+// EachRecord calls fn with each of b's fields as a BackupRecord, in the order
+// they're written to a backup file, and with each list item a record of its
+// own, stopping at fn's first error.
+func (b *BackupV1) EachRecord(fn func(BackupRecord) error) error {
+	emit := func(key string, value interface{}) error {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		return fn(BackupRecord{Key: key, Value: encoded})
+	}
+	err := emit("version", b.Version)
+	if err != nil {
+		return err
+	}
+	err = emit("created", b.Created)
+	if err != nil {
+		return err
+	}
+	for _, user := range b.Users {
+		err = emit("users", user)
+		if err != nil {
+			return err
+		}
+	}
+	for _, master := range b.FilesystemMasters {
+		err = emit("filesystem_masters", master)
+		if err != nil {
+			return err
+		}
+	}
+	for _, filesystem := range b.RegistryFilesystems {
+		err = emit("registry_filesystems", filesystem)
+		if err != nil {
+			return err
+		}
+	}
+	for _, clone := range b.RegistryClones {
+		err = emit("registry_clones", clone)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecordCount is how many records EachRecord calls its fn with.
+func (b *BackupV1) RecordCount() int {
+	return 2 + len(b.Users) + len(b.FilesystemMasters) + len(b.RegistryFilesystems) + len(b.RegistryClones)
+}
@@ -0,0 +1,31 @@
+package types
+
+import "time"
+
+// Types of ClusterEvent
+const (
+	ClusterEventVolumeCreated    = "VolumeCreated"
+	ClusterEventVolumeDeleted    = "VolumeDeleted"
+	ClusterEventCommitAdded      = "CommitAdded"
+	ClusterEventTransferStarted  = "TransferStarted"
+	ClusterEventTransferFinished = "TransferFinished"
+	ClusterEventTransferFailed   = "TransferFailed"
+)
+
+// ClusterEvent - something that's happened to a volume on the cluster, as
+// streamed by the server's /events endpoint
+type ClusterEvent struct {
+	Type string
+	Time time.Time
+	// Volume and Branch - the volume, and the branch of it (empty for
+	// master), that the event is about
+	Volume VolumeName
+	Branch string `json:",omitempty"`
+	// CommitID - the commit added, for CommitAdded
+	CommitID string `json:",omitempty"`
+	// TransferID - the transfer, for TransferStarted, TransferFinished and
+	// TransferFailed
+	TransferID string `json:",omitempty"`
+	// Message - what went wrong, for TransferFailed
+	Message string `json:",omitempty"`
+}
@@ -0,0 +1,67 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Commit metadata keys that record how a commit was made, which can't be
+// changed afterwards
+var reservedCommitMetadataKeys = map[string]bool{
+	"timestamp": true,
+	"author":    true,
+}
+
+// UpdateCommitMetadataRequest - changes to an existing commit's metadata:
+// the keys in Metadata are set, overwriting any values they already have,
+// and then the keys in DeleteKeys are removed.
+type UpdateCommitMetadataRequest struct {
+	Namespace  string
+	Name       string
+	Branch     string
+	CommitId   string
+	Metadata   map[string]string
+	DeleteKeys []string
+}
+
+func (r UpdateCommitMetadataRequest) Validate() error {
+	if r.CommitId == "" {
+		return fmt.Errorf("Please specify the commit whose metadata to change")
+	}
+	if len(r.Metadata) == 0 && len(r.DeleteKeys) == 0 {
+		return fmt.Errorf("Please specify some metadata to set or delete")
+	}
+	keys := append([]string{}, r.DeleteKeys...)
+	for key := range r.Metadata {
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		if key == "" {
+			return fmt.Errorf("Metadata field names can't be empty")
+		}
+		// As for new commits, because zfs
+		firstCharacter := key[:1]
+		if firstCharacter == strings.ToUpper(firstCharacter) {
+			return fmt.Errorf("Metadata field names must start with lowercase characters: %s", key)
+		}
+		if reservedCommitMetadataKeys[key] {
+			return fmt.Errorf("The %s metadata field is set when a commit is made, and can't be changed", key)
+		}
+	}
+	return nil
+}
+
+// Apply returns a copy of existing with the request's changes made.
+func (r UpdateCommitMetadataRequest) Apply(existing map[string]string) map[string]string {
+	result := make(map[string]string, len(existing)+len(r.Metadata))
+	for key, value := range existing {
+		result[key] = value
+	}
+	for key, value := range r.Metadata {
+		result[key] = value
+	}
+	for _, key := range r.DeleteKeys {
+		delete(result, key)
+	}
+	return result
+}
@@ -0,0 +1,46 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUpdateCommitMetadataApply(t *testing.T) {
+	existing := map[string]string{"message": "nightly", "env": "staging", "owner": "alice"}
+	req := UpdateCommitMetadataRequest{
+		CommitId:   "1",
+		Metadata:   map[string]string{"env": "prod", "ticket": "OPS-12"},
+		DeleteKeys: []string{"owner", "missing"},
+	}
+	if err := req.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := req.Apply(existing)
+	expected := map[string]string{"message": "nightly", "env": "prod", "ticket": "OPS-12"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if existing["env"] != "staging" || existing["owner"] != "alice" {
+		t.Errorf("expected the existing metadata to be left alone, got %v", existing)
+	}
+}
+
+func TestUpdateCommitMetadataValidate(t *testing.T) {
+	cases := []struct {
+		name string
+		req  UpdateCommitMetadataRequest
+	}{
+		{"no commit", UpdateCommitMetadataRequest{Metadata: map[string]string{"env": "prod"}}},
+		{"no changes", UpdateCommitMetadataRequest{CommitId: "1"}},
+		{"uppercase key", UpdateCommitMetadataRequest{CommitId: "1", Metadata: map[string]string{"Env": "prod"}}},
+		{"empty key", UpdateCommitMetadataRequest{CommitId: "1", DeleteKeys: []string{""}}},
+		{"reserved key", UpdateCommitMetadataRequest{CommitId: "1", Metadata: map[string]string{"timestamp": "0"}}},
+		{"deleting reserved key", UpdateCommitMetadataRequest{CommitId: "1", DeleteKeys: []string{"author"}}},
+	}
+	for _, c := range cases {
+		if err := c.req.Validate(); err == nil {
+			t.Errorf("%s: expected an error", c.name)
+		}
+	}
+}
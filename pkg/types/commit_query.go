@@ -0,0 +1,108 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CommitQuery - filters for SearchCommits, a commit has to match every field
+// that's set
+type CommitQuery struct {
+	// case insensitive substring of the commit message
+	MessageContains string
+	// MetadataKey on its own matches commits that have the key, with
+	// MetadataValue they have to have that value for it too
+	MetadataKey   string
+	MetadataValue string
+	After         time.Time
+	Before        time.Time
+	// Limit - maximum number of commits to return, 0 means no limit
+	Limit int
+}
+
+type SearchCommitsRequest struct {
+	Namespace string
+	Name      string
+	Branch    string
+	Query     CommitQuery
+}
+
+// IsEmpty is true if the query has no filters, and so would match every
+// commit
+func (q CommitQuery) IsEmpty() bool {
+	return q.MessageContains == "" && q.MetadataKey == "" && q.MetadataValue == "" &&
+		q.After.IsZero() && q.Before.IsZero()
+}
+
+func (q CommitQuery) Validate() error {
+	if q.MetadataValue != "" && q.MetadataKey == "" {
+		return fmt.Errorf("MetadataValue needs a MetadataKey")
+	}
+	if q.Limit < 0 {
+		return fmt.Errorf("Limit must not be negative, got %d", q.Limit)
+	}
+	if !q.After.IsZero() && !q.Before.IsZero() && !q.After.Before(q.Before) {
+		return fmt.Errorf("After (%s) must be earlier than Before (%s)", q.After, q.Before)
+	}
+	return nil
+}
+
+// Matches checks s against everything but the time range, which Filter deals
+// with.
+func (q CommitQuery) Matches(s Snapshot) bool {
+	if q.MessageContains != "" &&
+		!strings.Contains(strings.ToLower(s.Metadata["message"]), strings.ToLower(q.MessageContains)) {
+		return false
+	}
+	if q.MetadataKey != "" {
+		value, ok := s.Metadata[q.MetadataKey]
+		if !ok || (q.MetadataValue != "" && value != q.MetadataValue) {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter returns the snapshots matching q, oldest first. snapshots must be in
+// the order they were taken, as they are for a branch, so that the time range
+// can be found by binary search rather than by checking every commit.
+func (q CommitQuery) Filter(snapshots []Snapshot) []Snapshot {
+	start := 0
+	if !q.After.IsZero() {
+		after := q.After.UnixNano()
+		start = sort.Search(len(snapshots), func(i int) bool {
+			return snapshotTimestamp(snapshots[i]) > after
+		})
+	}
+	end := len(snapshots)
+	if !q.Before.IsZero() {
+		before := q.Before.UnixNano()
+		end = start + sort.Search(len(snapshots)-start, func(i int) bool {
+			return snapshotTimestamp(snapshots[start+i]) >= before
+		})
+	}
+
+	result := []Snapshot{}
+	for _, s := range snapshots[start:end] {
+		if q.Limit > 0 && len(result) >= q.Limit {
+			break
+		}
+		if q.Matches(s) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// snapshotTimestamp - nanoseconds since the epoch, as recorded when the
+// snapshot was taken
+func snapshotTimestamp(s Snapshot) int64 {
+	t, err := strconv.ParseInt(s.Metadata["timestamp"], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return t
+}
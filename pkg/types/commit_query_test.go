@@ -0,0 +1,74 @@
+package types
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func testCommits(base time.Time) []Snapshot {
+	commit := func(id string, offset time.Duration, meta map[string]string) Snapshot {
+		meta["timestamp"] = strconv.FormatInt(base.Add(offset).UnixNano(), 10)
+		return Snapshot{Id: id, Metadata: meta}
+	}
+	return []Snapshot{
+		commit("1", 0, map[string]string{"message": "Initial import"}),
+		commit("2", time.Hour, map[string]string{"message": "Nightly backup", "env": "prod"}),
+		commit("3", 2*time.Hour, map[string]string{"message": "nightly BACKUP", "env": "staging"}),
+		commit("4", 3*time.Hour, map[string]string{"message": "fix schema"}),
+	}
+}
+
+func ids(snapshots []Snapshot) []string {
+	result := []string{}
+	for _, s := range snapshots {
+		result = append(result, s.Id)
+	}
+	return result
+}
+
+func TestCommitQueryFilter(t *testing.T) {
+	base := time.Now()
+	commits := testCommits(base)
+
+	cases := []struct {
+		name     string
+		query    CommitQuery
+		expected []string
+	}{
+		{"message", CommitQuery{MessageContains: "backup"}, []string{"2", "3"}},
+		{"metadata key", CommitQuery{MetadataKey: "env"}, []string{"2", "3"}},
+		{"metadata value", CommitQuery{MetadataKey: "env", MetadataValue: "prod"}, []string{"2"}},
+		{"after", CommitQuery{After: base.Add(time.Hour)}, []string{"3", "4"}},
+		{"before", CommitQuery{Before: base.Add(time.Hour)}, []string{"1"}},
+		{"range", CommitQuery{After: base, Before: base.Add(3 * time.Hour)}, []string{"2", "3"}},
+		{"limit", CommitQuery{MessageContains: "i", Limit: 2}, []string{"1", "2"}},
+		{"no match", CommitQuery{MessageContains: "nope"}, []string{}},
+	}
+	for _, c := range cases {
+		got := ids(c.query.Filter(commits))
+		if len(got) != len(c.expected) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.expected[i] {
+				t.Errorf("%s: expected %v, got %v", c.name, c.expected, got)
+				break
+			}
+		}
+	}
+}
+
+func TestCommitQueryValidate(t *testing.T) {
+	if !(CommitQuery{Limit: 10}).IsEmpty() {
+		t.Errorf("expected a query with only a limit to be empty")
+	}
+	if err := (CommitQuery{MetadataValue: "prod"}).Validate(); err == nil {
+		t.Errorf("expected an error for a metadata value without a key")
+	}
+	now := time.Now()
+	if err := (CommitQuery{After: now, Before: now.Add(-time.Hour)}).Validate(); err == nil {
+		t.Errorf("expected an error for an empty time range")
+	}
+}
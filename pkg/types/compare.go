@@ -0,0 +1,69 @@
+package types
+
+import (
+	"strconv"
+	"time"
+)
+
+// CompareVolumesRequest - compare the commits on LeftBranch of Left with
+// those on RightBranch of Right
+type CompareVolumesRequest struct {
+	Left        VolumeName
+	LeftBranch  string
+	Right       VolumeName
+	RightBranch string
+}
+
+// VolumeComparison - how far two branches, of the same volume or of a
+// volume and one forked from it, have diverged
+type VolumeComparison struct {
+	// CommonAncestorCommitID - the latest commit both branches have, empty
+	// if they have none in common
+	CommonAncestorCommitID string
+	// LeftAheadBy and RightAheadBy - how many commits each branch has after
+	// the common ancestor
+	LeftAheadBy  int
+	RightAheadBy int
+	// DivergencePoint - when the common ancestor was committed, zero if
+	// there isn't one
+	DivergencePoint time.Time
+	// LeftUniqueCommits and RightUniqueCommits - the commits each branch has
+	// after the common ancestor, oldest first
+	LeftUniqueCommits  []Snapshot
+	RightUniqueCommits []Snapshot
+}
+
+// CompareCommitHistories compares two branches' commits, each oldest first.
+// Commits keep their ids when a volume is forked or branched, so the common
+// ancestor is the latest commit of left that's also in right.
+func CompareCommitHistories(left, right []Snapshot) VolumeComparison {
+	rightIndex := make(map[string]int, len(right))
+	for i, snapshot := range right {
+		rightIndex[snapshot.Id] = i
+	}
+
+	leftAfter, rightAfter := 0, 0
+	var ancestor *Snapshot
+	for i := len(left) - 1; i >= 0; i-- {
+		if j, ok := rightIndex[left[i].Id]; ok {
+			ancestor = &left[i]
+			leftAfter, rightAfter = i+1, j+1
+			break
+		}
+	}
+
+	comparison := VolumeComparison{
+		LeftUniqueCommits:  append([]Snapshot{}, left[leftAfter:]...),
+		RightUniqueCommits: append([]Snapshot{}, right[rightAfter:]...),
+	}
+	comparison.LeftAheadBy = len(comparison.LeftUniqueCommits)
+	comparison.RightAheadBy = len(comparison.RightUniqueCommits)
+	if ancestor != nil {
+		comparison.CommonAncestorCommitID = ancestor.Id
+		nanos, err := strconv.ParseInt(ancestor.Metadata["timestamp"], 10, 64)
+		if err == nil {
+			comparison.DivergencePoint = time.Unix(0, nanos)
+		}
+	}
+	return comparison
+}
@@ -0,0 +1,58 @@
+package types
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func commits(ids ...string) []Snapshot {
+	snapshots := []Snapshot{}
+	for i, id := range ids {
+		snapshots = append(snapshots, Snapshot{Id: id, Metadata: map[string]string{"timestamp": fmt.Sprint(int64(i+1) * 1e9)}})
+	}
+	return snapshots
+}
+
+func commitIds(snapshots []Snapshot) string {
+	ids := ""
+	for _, s := range snapshots {
+		ids += s.Id
+	}
+	return ids
+}
+
+func TestCompareCommitHistories(t *testing.T) {
+	cases := []struct {
+		name              string
+		left, right       []Snapshot
+		ancestor          string
+		leftIds, rightIds string
+	}{
+		{"diverged", commits("a", "b", "c", "d"), commits("a", "b", "x"), "b", "cd", "x"},
+		{"left behind", commits("a", "b"), commits("a", "b", "c"), "b", "", "c"},
+		{"identical", commits("a", "b"), commits("a", "b"), "b", "", ""},
+		{"unrelated", commits("a", "b"), commits("x"), "", "ab", "x"},
+		{"empty", nil, commits("x"), "", "", "x"},
+	}
+	for _, c := range cases {
+		got := CompareCommitHistories(c.left, c.right)
+		if got.CommonAncestorCommitID != c.ancestor {
+			t.Errorf("%s: expected common ancestor %q, got %q", c.name, c.ancestor, got.CommonAncestorCommitID)
+		}
+		if commitIds(got.LeftUniqueCommits) != c.leftIds || got.LeftAheadBy != len(c.leftIds) {
+			t.Errorf("%s: expected left to be ahead by %q, got %d %q", c.name, c.leftIds, got.LeftAheadBy, commitIds(got.LeftUniqueCommits))
+		}
+		if commitIds(got.RightUniqueCommits) != c.rightIds || got.RightAheadBy != len(c.rightIds) {
+			t.Errorf("%s: expected right to be ahead by %q, got %d %q", c.name, c.rightIds, got.RightAheadBy, commitIds(got.RightUniqueCommits))
+		}
+	}
+
+	got := CompareCommitHistories(commits("a", "b", "c"), commits("a", "b"))
+	if !got.DivergencePoint.Equal(time.Unix(2, 0)) {
+		t.Errorf("expected the divergence point to be b's timestamp, got %s", got.DivergencePoint)
+	}
+	if got := CompareCommitHistories(commits("a"), commits("x")); !got.DivergencePoint.IsZero() {
+		t.Errorf("expected no divergence point without a common ancestor, got %s", got.DivergencePoint)
+	}
+}
@@ -27,6 +27,12 @@ type FilesystemDirty struct {
 	NodeID       string `json:"node_id"`
 	DirtyBytes   int64  `json:"dirty_bytes"`
 	SizeBytes    int64  `json:"size_bytes"`
+	// LogicalBytes and CompressedBytes - space used by the filesystem and its
+	// snapshots, before and after compression
+	LogicalBytes    int64 `json:"logical_bytes"`
+	CompressedBytes int64 `json:"compressed_bytes"`
+	// QuotaBytes - the filesystem's ZFS quota, 0 if it has none
+	QuotaBytes int64 `json:"quota_bytes,omitempty"`
 }
 
 type FilesystemMaster struct {
@@ -52,6 +58,110 @@ type FilesystemDeletionAudit struct {
 	Clone                string     `json:"clone"`
 }
 
+// FilesystemSoftDeletion - recorded when a volume is moved to the recycle bin.
+// The datasets are kept around until ExpiresAt, after which the volume is
+// purged for real.
+type FilesystemSoftDeletion struct {
+	// Meta is populated by the KV store implementer
+	Meta *KVMeta `json:"-"`
+
+	FilesystemID string     `json:"filesystem_id"`
+	Name         VolumeName `json:"name"`
+	Username     string     `json:"username"`
+	DeletedAt    time.Time  `json:"deleted_at"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+}
+
+// FilesystemACL - the users, other than the owner and collaborators, that a
+// volume has been shared with.
+type FilesystemACL struct {
+	// Meta is populated by the KV store implementer
+	Meta *KVMeta `json:"-"`
+
+	FilesystemID string     `json:"filesystem_id"`
+	Entries      []ACLEntry `json:"entries"`
+}
+
+// SnapshotSchedule - periodic automatic commits to a branch, optionally
+// keeping only the newest RetainCount of them.
+type SnapshotSchedule struct {
+	// Meta is populated by the KV store implementer
+	Meta *KVMeta `json:"-"`
+
+	// FilesystemID - of the branch being committed to
+	FilesystemID string     `json:"filesystem_id"`
+	Name         VolumeName `json:"name"`
+	Branch       string     `json:"branch"`
+	// Username - who set up the schedule, and so is the commits' author
+	Username string `json:"username"`
+	// CronExpr - standard five field cron expression, or a descriptor such
+	// as "@hourly"
+	CronExpr string `json:"cron_expr"`
+	// RetainCount - 0 keeps every commit
+	RetainCount int `json:"retain_count"`
+	// LastRun - when the schedule last committed, or when it was set up
+	LastRun time.Time `json:"last_run"`
+}
+
+// FilesystemRetentionPolicy - the RetentionPolicy of a branch, enforced
+// every so often by its master node.
+type FilesystemRetentionPolicy struct {
+	// Meta is populated by the KV store implementer
+	Meta *KVMeta `json:"-"`
+
+	// FilesystemID - of the branch
+	FilesystemID string          `json:"filesystem_id"`
+	Name         VolumeName      `json:"name"`
+	Branch       string          `json:"branch"`
+	Policy       RetentionPolicy `json:"policy"`
+}
+
+// FilesystemTags - human readable names for commits on a branch.
+type FilesystemTags struct {
+	// Meta is populated by the KV store implementer
+	Meta *KVMeta `json:"-"`
+
+	// FilesystemID - of the branch the tagged commits are on
+	FilesystemID string `json:"filesystem_id"`
+	// Tags - commit id by tag
+	Tags map[string]string `json:"tags"`
+}
+
+// FilesystemCommitMetadata - the metadata of a branch's commits that has been
+// changed since they were made, which is used instead of what they were made
+// with.
+type FilesystemCommitMetadata struct {
+	// Meta is populated by the KV store implementer
+	Meta *KVMeta `json:"-"`
+
+	// FilesystemID - of the branch the commits are on
+	FilesystemID string `json:"filesystem_id"`
+	// Commits - metadata by commit id
+	Commits map[string]map[string]string `json:"commits"`
+}
+
+// FilesystemDefaultBranch - the branch of a volume that's used when no other
+// has been chosen, if it isn't master.
+type FilesystemDefaultBranch struct {
+	// Meta is populated by the KV store implementer
+	Meta *KVMeta `json:"-"`
+
+	// FilesystemID - of the volume's master branch
+	FilesystemID string `json:"filesystem_id"`
+	Branch       string `json:"branch"`
+}
+
+// FilesystemQuota - the most space a volume's branches can use between them,
+// in bytes; 0 if there's no limit.
+type FilesystemQuota struct {
+	// Meta is populated by the KV store implementer
+	Meta *KVMeta `json:"-"`
+
+	// FilesystemID - of the volume's master branch
+	FilesystemID string `json:"filesystem_id"`
+	MaxBytes     int64  `json:"max_bytes"`
+}
+
 type FilesystemLive struct {
 	// Meta is populated by the KV store implementer
 	Meta *KVMeta `json:"-"`
@@ -4,4 +4,46 @@ type RPCForkRequest struct {
 	MasterBranchID string
 	ForkNamespace  string
 	ForkName       string
+	SourceCommitId string
+}
+
+// CloneVolumeRequest - copy the latest commit of Branch of Source, and the
+// commits before it, to a new volume Dest
+type CloneVolumeRequest struct {
+	Source VolumeName
+	Dest   VolumeName
+	Branch string
+	// EstimateOnly - just work out how big the copy would be
+	EstimateOnly bool
+}
+
+// CrossNamespaceCopyRequest - clone Source, as CloneVolumeRequest does, to a
+// volume of the same name in DestNamespace
+type CrossNamespaceCopyRequest struct {
+	Source        VolumeName
+	DestNamespace string
+	// Overwrite - delete any volume of that name already in DestNamespace,
+	// rather than refusing to copy
+	Overwrite bool
+}
+
+type CloneVolumeResult struct {
+	// FilesystemId of the new volume, empty if EstimateOnly was set
+	FilesystemId string
+	// EstimatedBytes - the size of the ZFS stream the copy is made from
+	EstimatedBytes int64
+}
+
+// ForkLineage - where a volume was forked from, and what's been forked
+// from it
+type ForkLineage struct {
+	// Parent is nil if the volume wasn't forked, or its parent has been
+	// deleted or can't be seen by the user
+	Parent *VolumeName
+	// Children - volumes forked from any branch of this one
+	Children []VolumeName
+	// ForkCommitID - the parent's commit the volume was forked from
+	ForkCommitID string
+	// ForkDepth - how many forks away from an original volume this one is
+	ForkDepth int
 }
@@ -128,7 +128,7 @@ type TransferPollResult struct {
 
 	Index              int    // i.e. transfer 1/4 (Index=1)
 	Total              int    //                   (Total=4)
-	Status             string // one of "starting", "running", "finished", "error"
+	Status             string // one of "queued", "paused", "starting", "running", "finished", "error"
 	NanosecondsElapsed int64
 	Size               int64 // size of current segment in bytes
 	Sent               int64 // number of bytes of current segment sent so far
@@ -149,3 +149,37 @@ func (t TransferPollResult) String() string {
 	}
 	return toString
 }
+
+// Transfer webhook events: a transfer's webhooks are sent its poll result as
+// it progresses, when it completes, and if it fails
+const (
+	TransferWebhookProgress = "progress"
+	TransferWebhookComplete = "complete"
+	TransferWebhookError    = "error"
+)
+
+// TransferWebhookRequest - asks for a transfer's poll results to be POSTed
+// to URL for each of Events, or for all of them if Events is empty
+type TransferWebhookRequest struct {
+	TransferId string
+	URL        string
+	Events     []string
+}
+
+// QueuedTransfer statuses
+const (
+	TransferQueued  = "queued"
+	TransferPaused  = "paused"
+	TransferRunning = "running"
+)
+
+// QueuedTransfer - a transfer waiting for (or holding) one of the node's
+// transfer slots. Higher priorities start first; StartedAt is nil until the
+// transfer is running.
+type QueuedTransfer struct {
+	TransferID string
+	Status     string
+	Priority   int
+	EnqueuedAt time.Time
+	StartedAt  *time.Time
+}
@@ -4,6 +4,12 @@ const DefaultEtcdURL = "https://dotmesh-etcd:42379"
 const DefaultEtcdClientPort = "42379"
 
 const EnvEtcdEndpoint = "DOTMESH_ETCD_ENDPOINT"
+
+// Client certificate files for an https:// etcd endpoint, overriding the
+// ones in DOTMESH_PKI_PATH
+const EnvEtcdTLSCertFile = "DOTMESH_ETCD_TLS_CERT_FILE"
+const EnvEtcdTLSKeyFile = "DOTMESH_ETCD_TLS_KEY_FILE"
+const EnvEtcdTLSCAFile = "DOTMESH_ETCD_TLS_CA_FILE"
 const EnvStorageBackend = "DOTMESH_STORAGE"
 const EnvDotmeshBoltdbPath = "DOTMESH_BOLTDB_PATH"
 
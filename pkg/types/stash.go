@@ -0,0 +1,51 @@
+package types
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// StashEntry - a branch holding commits that were moved out of the way when
+// a transfer, with StashDivergence, found its branch had diverged
+type StashEntry struct {
+	BranchName string
+	// OriginalBranch is the branch the commits were on, "master" for the
+	// master branch
+	OriginalBranch string
+	StashedAt      time.Time
+	// CommitCount - how many commits were stashed
+	CommitCount int
+}
+
+const stashTimeFormat = "20060102T150405Z"
+
+// Stash branches used to be called {branch}-DIVERGED-{RFC3339 time, with
+// dashes for colons}, and may still be about
+var stashBranchPattern = regexp.MustCompile(`^stash-(\d{8}T\d{6}Z)(?:-\d+)?$`)
+var legacyStashBranchPattern = regexp.MustCompile(`-DIVERGED-(\d{4}-\d\d-\d\dT\d\d-\d\d-\d\dZ)$`)
+
+// StashBranchName names the branch for commits stashed at t. If the name's
+// taken, according to exists, it has -2, -3 and so on added until it isn't.
+func StashBranchName(t time.Time, exists func(string) bool) string {
+	base := "stash-" + t.UTC().Format(stashTimeFormat)
+	name := base
+	for i := 2; exists(name); i++ {
+		name = base + "-" + strconv.Itoa(i)
+	}
+	return name
+}
+
+// ParseStashBranchName returns when the commits on a stash branch were
+// stashed, and false if name isn't a stash branch's.
+func ParseStashBranchName(name string) (time.Time, bool) {
+	if match := stashBranchPattern.FindStringSubmatch(name); match != nil {
+		t, err := time.Parse(stashTimeFormat, match[1])
+		return t, err == nil
+	}
+	if match := legacyStashBranchPattern.FindStringSubmatch(name); match != nil {
+		t, err := time.Parse("2006-01-02T15-04-05Z", match[1])
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,34 @@
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStashBranchName(t *testing.T) {
+	at := time.Date(2026, 10, 14, 9, 30, 5, 0, time.UTC)
+	taken := map[string]bool{}
+	exists := func(name string) bool { return taken[name] }
+
+	first := StashBranchName(at, exists)
+	if first != "stash-20261014T093005Z" {
+		t.Errorf("unexpected stash branch name %s", first)
+	}
+	taken[first] = true
+	second := StashBranchName(at, exists)
+	if second != "stash-20261014T093005Z-2" {
+		t.Errorf("expected a taken name to get a suffix, got %s", second)
+	}
+
+	for _, name := range []string{first, second, "master-DIVERGED-2026-10-14T09-30-05Z"} {
+		stashedAt, ok := ParseStashBranchName(name)
+		if !ok || !stashedAt.Equal(at) {
+			t.Errorf("expected %s to parse as a stash from %s, got %s, %t", name, at, stashedAt, ok)
+		}
+	}
+	for _, name := range []string{"master", "stash", "stash-yesterday", "my-stash-20261014T093005Z"} {
+		if _, ok := ParseStashBranchName(name); ok {
+			t.Errorf("expected %s not to be a stash branch", name)
+		}
+	}
+}
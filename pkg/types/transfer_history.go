@@ -0,0 +1,72 @@
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+// TransferRecord - a transfer that has finished or failed, as kept in the
+// transfer history
+type TransferRecord struct {
+	TransferPollResult
+
+	TransferID  string
+	StartedAt   time.Time
+	CompletedAt *time.Time
+}
+
+// TransferFilter - filters for ListTransfers, a record has to match every
+// field that's set
+type TransferFilter struct {
+	// LocalVolume - "namespace/name", or just the name for the admin
+	// namespace
+	LocalVolume string
+	// Direction - "push" or "pull"
+	Direction string
+	// After - only transfers started after this
+	After time.Time
+	// Limit - maximum number of records to return, the most recent ones are
+	// kept. 0 means no limit
+	Limit int
+}
+
+func (f TransferFilter) Validate() error {
+	if f.Limit < 0 {
+		return fmt.Errorf("Limit must not be negative, got %d", f.Limit)
+	}
+	if f.Direction != "" && f.Direction != "push" && f.Direction != "pull" {
+		return fmt.Errorf("Direction must be push or pull, got %q", f.Direction)
+	}
+	return nil
+}
+
+func (f TransferFilter) Matches(r TransferRecord) bool {
+	if f.LocalVolume != "" {
+		local := VolumeName{Namespace: r.LocalNamespace, Name: r.LocalName}
+		if f.LocalVolume != local.String() && f.LocalVolume != local.StringWithoutAdmin() {
+			return false
+		}
+	}
+	if f.Direction != "" && r.Direction != f.Direction {
+		return false
+	}
+	if !f.After.IsZero() && !r.StartedAt.After(f.After) {
+		return false
+	}
+	return true
+}
+
+// Filter returns the records matching f, oldest first. records must already
+// be oldest first.
+func (f TransferFilter) Filter(records []TransferRecord) []TransferRecord {
+	result := []TransferRecord{}
+	for _, r := range records {
+		if f.Matches(r) {
+			result = append(result, r)
+		}
+	}
+	if f.Limit > 0 && len(result) > f.Limit {
+		result = result[len(result)-f.Limit:]
+	}
+	return result
+}
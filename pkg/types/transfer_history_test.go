@@ -0,0 +1,42 @@
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTransferFilter(t *testing.T) {
+	base := time.Now()
+	records := []TransferRecord{
+		{TransferPollResult: TransferPollResult{LocalNamespace: "admin", LocalName: "a", Direction: "push"}, StartedAt: base},
+		{TransferPollResult: TransferPollResult{LocalNamespace: "alice", LocalName: "a", Direction: "pull"}, StartedAt: base.Add(time.Minute)},
+		{TransferPollResult: TransferPollResult{LocalNamespace: "admin", LocalName: "a", Direction: "pull"}, StartedAt: base.Add(2 * time.Minute)},
+	}
+
+	cases := []struct {
+		name     string
+		filter   TransferFilter
+		expected int
+	}{
+		{"everything", TransferFilter{}, 3},
+		{"admin volume", TransferFilter{LocalVolume: "a"}, 2},
+		{"admin volume in full", TransferFilter{LocalVolume: "admin/a"}, 2},
+		{"namespaced volume", TransferFilter{LocalVolume: "alice/a"}, 1},
+		{"direction", TransferFilter{Direction: "pull"}, 2},
+		{"after", TransferFilter{After: base}, 2},
+		{"limit", TransferFilter{Limit: 1}, 1},
+	}
+	for _, c := range cases {
+		got := c.filter.Filter(records)
+		if len(got) != c.expected {
+			t.Errorf("%s: expected %d records, got %d", c.name, c.expected, len(got))
+		}
+	}
+
+	if err := (TransferFilter{Direction: "sideways"}).Validate(); err == nil {
+		t.Errorf("expected an unknown direction to be rejected")
+	}
+	if err := (TransferFilter{Limit: -1}).Validate(); err == nil {
+		t.Errorf("expected a negative limit to be rejected")
+	}
+}
@@ -3,6 +3,7 @@ package types
 import (
 	"fmt"
 	"reflect"
+	"time"
 )
 
 type CommitArgs struct {
@@ -69,6 +70,30 @@ type DockerContainer struct {
 	Id   string
 }
 
+// PingResult - the outcome of pinging one remote
+type PingResult struct {
+	Latency time.Duration
+	// ServerVersion is empty for servers too old to say
+	ServerVersion string
+	// Error is why the remote couldn't be pinged, if it couldn't
+	Error string
+}
+
+// RemoteInfo - a configured remote, as listed by the client; it never
+// includes the remote's credentials
+type RemoteInfo struct {
+	Name string
+	// Type is "dotmesh", "s3" or "sftp"
+	Type string
+	// Hostname is the S3 endpoint for S3 remotes, which is empty for AWS
+	Hostname  string
+	User      string
+	HasAPIKey bool
+	// DefaultNamespace is the namespace dots on the remote are assumed to
+	// be in when one isn't given
+	DefaultNamespace string
+}
+
 type VersionInfo struct {
 	InstalledVersion    string `json:"installed_version"`
 	CurrentVersion      string `json:"current_version"`
@@ -79,6 +104,19 @@ type VersionInfo struct {
 	Outdated            bool   `json:"outdated"`
 }
 
+// CompatibilityResult - whether a client can expect to work with the server
+// it's talking to
+type CompatibilityResult struct {
+	// Compatible is true if the major and minor versions match, or if either
+	// version isn't a semver one, so can't be compared
+	Compatible    bool
+	ClientVersion string
+	ServerVersion string
+	// Warning explains why the versions may not be compatible, if they may
+	// not be
+	Warning string
+}
+
 type SafeConfig struct {
 }
 
@@ -91,6 +129,9 @@ type Snapshot struct {
 	// exported for json serialization
 	Id       string
 	Metadata map[string]string
+	// Tags - names given to the commit with TagCommit, filled in when
+	// listing commits
+	Tags []string `json:",omitempty"`
 	// private (do not serialize)
 	// Filesystem *Filesystem
 }
@@ -104,6 +145,9 @@ func (s *Snapshot) DeepCopy() *Snapshot {
 		meta[k] = v
 	}
 	c.Metadata = meta
+	if s.Tags != nil {
+		c.Tags = append([]string{}, s.Tags...)
+	}
 
 	return c
 }
@@ -138,6 +182,9 @@ type S3TransferRequest struct {
 	LocalName       string
 	LocalBranchName string
 	RemoteName      string
+	// TargetCommit, for pushes, is the commit whose files are pushed, in
+	// place of the latest one
+	TargetCommit string
 }
 
 func (transferRequest S3TransferRequest) String() string {
@@ -154,6 +201,33 @@ func (transferRequest S3TransferRequest) String() string {
 	return toString
 }
 
+type SFTPTransferRequest struct {
+	Hostname        string
+	Port            int
+	Username        string
+	PrivateKey      string // PEM encoded contents of the identity file, protected value in toString
+	HostKey         string // the server's public key, in authorized_keys format
+	RemotePath      string
+	Direction       string
+	LocalNamespace  string
+	LocalName       string
+	LocalBranchName string
+}
+
+func (transferRequest SFTPTransferRequest) String() string {
+	v := reflect.ValueOf(transferRequest)
+	toString := ""
+	for i := 0; i < v.NumField(); i++ {
+		fieldName := v.Type().Field(i).Name
+		if fieldName == "PrivateKey" {
+			toString = toString + fmt.Sprintf(" %v=%v,", fieldName, "****")
+		} else {
+			toString = toString + fmt.Sprintf(" %v=%v,", fieldName, v.Field(i).Interface())
+		}
+	}
+	return toString
+}
+
 type TransferRequest struct {
 	Peer             string // hostname
 	User             string
@@ -167,8 +241,63 @@ type TransferRequest struct {
 	RemoteName       string
 	RemoteBranchName string
 	// TODO could also include SourceSnapshot here
-	TargetCommit    string // optional, "" means "latest"
+	TargetCommit    string // optional, "" means "latest"; commits after it aren't sent
 	StashDivergence bool
+	// Force, when pushing to a branch that's diverged, discards the
+	// receiving end's commits since the latest common one, like git push
+	// --force. StashDivergence takes precedence.
+	Force  bool
+	DryRun bool // only estimate the transfer, see EstimateTransfer
+	// Priority orders transfers waiting for a slot on a busy server, higher
+	// first
+	Priority int
+	// Compression - how the zfs send streams are compressed on their way
+	// between the clusters, one of the Compression* constants. They're sent
+	// uncompressed if the peer can't compress them, see
+	// CompressionCapability.
+	Compression string
+}
+
+// Compressions of the zfs send streams of a TransferRequest
+const (
+	CompressionNone = ""
+	CompressionGzip = "gzip"
+	CompressionLZ4  = "lz4"
+)
+
+// CompressionHeader - the HTTP header naming the compression of a zfs send
+// stream, on the request for it (GET, for pulls) or the request carrying it
+// (POST, for pushes), and on the response to a GET
+const CompressionHeader = "X-Dotmesh-Compression"
+
+// ValidCompression - whether compression is one of the Compression*
+// constants
+func ValidCompression(compression string) bool {
+	switch compression {
+	case CompressionNone, CompressionGzip, CompressionLZ4:
+		return true
+	}
+	return false
+}
+
+// CompressionCapability - the key in the result of DotmeshRPC.Capabilities
+// that's true if the server can send and receive zfs send streams with
+// compression
+func CompressionCapability(compression string) string {
+	return "compression." + compression
+}
+
+// TransferEstimate - what a TransferRequest would move if it were started
+type TransferEstimate struct {
+	CommitCount int
+	// EstimatedBytes is the size of the zfs send streams, from zfs send -nP
+	EstimatedBytes int64
+	// BytesIsUpperBound is set when the size couldn't be predicted from zfs
+	// (e.g. the sending side is on another node or cluster), in which case
+	// EstimatedBytes is the full size of the sending filesystem.
+	BytesIsUpperBound bool
+	// DryRunDuration is how long the server took to work out the estimate
+	DryRunDuration time.Duration
 }
 
 func (transferRequest TransferRequest) String() string {
@@ -215,6 +344,19 @@ type RegistryFilesystem struct {
 	CollaboratorIds      []string
 }
 
+// RegistryNamespace - recorded for namespaces that have been created
+// explicitly, or given a quota. Other namespaces only exist implicitly, by
+// virtue of having volumes in them.
+type RegistryNamespace struct {
+	// Meta is populated by the KV store implementer
+	Meta *KVMeta `json:"-"`
+
+	Name  string `json:"name"`
+	Owner string `json:"owner"`
+	// MaxBytes - storage quota for the namespace, 0 means unlimited
+	MaxBytes int64 `json:"max_bytes"`
+}
+
 const EtcdPrefix = "dotmesh.io/"
 
 const RootFS = "dmfs"
@@ -8,14 +8,19 @@ func TestSnapshotCopy(t *testing.T) {
 		Metadata: map[string]string{
 			"foo": "bar",
 		},
+		Tags: []string{"release"},
 	}
 
 	copied := s.DeepCopy()
 
 	s.Id = "555"
 	s.Metadata["foo"] = "foobar"
+	s.Tags[0] = "changed"
 
 	if copied.Metadata["foo"] != "bar" {
 		t.Errorf("snapshot deepcopy failed")
 	}
+	if copied.Tags[0] != "release" {
+		t.Errorf("snapshot deepcopy shared tags")
+	}
 }
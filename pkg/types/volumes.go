@@ -1,6 +1,9 @@
 package types
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type DotmeshVolume struct {
 	Id                   string
@@ -16,6 +19,23 @@ type DotmeshVolume struct {
 	ForkParentSnapshotId string
 }
 
+// DotmeshVolumeWithStats - a volume with how much space it uses, before and
+// after compression, including its commits
+type DotmeshVolumeWithStats struct {
+	DotmeshVolume
+	LogicalBytes    int64
+	CompressedBytes int64
+	CommitCount     int
+}
+
+// DeletedVolume - a volume sitting in the recycle bin, which can still be
+// restored up until ExpiresAt
+type DeletedVolume struct {
+	DotmeshVolume
+	DeletedAt time.Time
+	ExpiresAt time.Time
+}
+
 type VolumeName struct {
 	Namespace string
 	Name      string
@@ -39,21 +59,251 @@ func (v VolumeName) StringWithoutAdmin() string {
 	}
 }
 
+type SoftDeleteRequest struct {
+	Name VolumeName
+	// how long to keep the volume around in the recycle bin before it's
+	// purged for good
+	RetentionPeriod time.Duration
+}
+
+// Permission - what a user who a volume has been shared with may do to it
+type Permission string
+
+const (
+	PermRead  Permission = "read"
+	PermWrite Permission = "write"
+)
+
+// ACLEntry - one user's access to a volume; write access implies read
+type ACLEntry struct {
+	User       string
+	Permission string
+}
+
+type ShareVolumeRequest struct {
+	Name       VolumeName
+	User       string
+	Permission Permission
+}
+
+type RevokeVolumeShareRequest struct {
+	Name VolumeName
+	User string
+}
+
+// TagCommitRequest - tag a commit on a branch. UntagCommit and ResolveTag
+// leave CommitId empty.
+type TagCommitRequest struct {
+	Namespace string
+	Name      string
+	Branch    string
+	CommitId  string
+	Tag       string
+}
+
+// SquashRequest - replace the commits of a branch from FromCommitId to
+// ToCommitId, inclusive, with one commit of ToCommitId's data
+type SquashRequest struct {
+	Namespace    string
+	Name         string
+	Branch       string
+	FromCommitId string
+	ToCommitId   string
+	// Message - of the commit they're squashed into
+	Message string
+}
+
+type SetDefaultBranchRequest struct {
+	Name VolumeName
+	// Branch - "" or "master" for the master branch
+	Branch string
+}
+
+type RenameBranchRequest struct {
+	Name      VolumeName
+	OldBranch string
+	NewBranch string
+}
+
+type DeleteBranchRequest struct {
+	Name   VolumeName
+	Branch string
+}
+
+// BranchInfo - a branch of a volume, with its latest commit
+type BranchInfo struct {
+	Name              string
+	HeadCommitID      string // "" if the branch has no commits
+	HeadCommitMessage string
+	HeadCommitAt      time.Time
+	CommitCount       int
+	IsDefault         bool
+}
+
+type CopyBranchRequest struct {
+	Name         VolumeName
+	SourceBranch string
+	DestBranch   string
+}
+
+// ContainerMount - a volume a container has mounted, and where
+type ContainerMount struct {
+	VolumeName VolumeName
+	Branch     string
+	MountPath  string
+	ReadOnly   bool
+}
+
+// Namespace - summary of a namespace and the volumes in it
+type Namespace struct {
+	Name        string
+	VolumeCount int
+	TotalBytes  int64
+	Owner       string
+	// MaxBytes - storage quota for the namespace, 0 means unlimited
+	MaxBytes int64
+}
+
+type DeleteNamespaceRequest struct {
+	Namespace string
+	// delete the volumes in the namespace too, rather than refusing to
+	// delete a namespace that isn't empty
+	Force bool
+}
+
+type SetNamespaceQuotaRequest struct {
+	Namespace string
+	MaxBytes  int64
+}
+
+type SetVolumeQuotaRequest struct {
+	Name     VolumeName
+	MaxBytes int64
+}
+
+// QuotaUsage - a volume's quota, if it has one (QuotaBytes is 0 if not), and
+// the space its branches use between them and have left under it. From ZFS,
+// the same for one dataset ("quota", "used" and "available").
+type QuotaUsage struct {
+	QuotaBytes     int64
+	UsedBytes      int64
+	AvailableBytes int64
+}
+
+type SetSnapshotScheduleRequest struct {
+	Name        VolumeName
+	Branch      string
+	CronExpr    string
+	RetainCount int
+}
+
+type SnapshotScheduleRequest struct {
+	Name   VolumeName
+	Branch string
+}
+
+// RetentionPolicy - which commits of a branch the server keeps, the rest
+// being pruned, oldest first. 0 for MaxCount or MaxAgeDays is no limit.
+type RetentionPolicy struct {
+	// MaxCount - keep at most this many commits, the newest
+	MaxCount int
+	// MaxAgeDays - keep commits at most this many days old
+	MaxAgeDays int
+	// KeepTagged - never prune commits with a tag
+	KeepTagged bool
+}
+
+type SetRetentionPolicyRequest struct {
+	Name   VolumeName
+	Branch string
+	// Policy - with neither MaxCount nor MaxAgeDays, the branch's policy is
+	// removed
+	Policy RetentionPolicy
+}
+
+// Volume health statuses
+const (
+	VolumeHealthy   = "healthy"
+	VolumeDegraded  = "degraded"
+	VolumeUnhealthy = "unhealthy"
+)
+
+// VolumeHealth - the state of a volume's ZFS dataset and the pool it lives in,
+// as seen by the volume's current master node
+type VolumeHealth struct {
+	// Status is one of VolumeHealthy, VolumeDegraded or VolumeUnhealthy
+	Status    string
+	Errors    []string
+	CheckedAt time.Time
+	// PoolStatus - the pool's health according to zpool, e.g. ONLINE
+	PoolStatus string
+}
+
+// PoolStatus - the health of the ZFS pool on a node, from zpool list and
+// zpool status. The error counts are totals across the pool's devices.
+type PoolStatus struct {
+	NodeName string
+	PoolName string
+	// State - the pool's health according to zpool, e.g. ONLINE
+	State          string
+	Capacity       int64
+	Used           int64
+	Free           int64
+	ReadErrors     int64
+	WriteErrors    int64
+	ChecksumErrors int64
+	// DegradedVdevs - the pool's devices that aren't ONLINE
+	DegradedVdevs []string
+	// Error - why the node's pool status couldn't be got, from
+	// GetAllPoolStatuses; the other fields bar NodeName are empty if it's set
+	Error string `json:",omitempty"`
+}
+
+// ReplicationStatus - how far each of a branch's replicas is behind the copy
+// on its master node
+type ReplicationStatus struct {
+	MasterNode string
+	Replicas   []ReplicaStatus
+}
+
+type ReplicaStatus struct {
+	Node string
+	// CommitsBehind - how many of the master's commits this node is missing
+	CommitsBehind int
+	// BytesBehind - an estimate of the size of the ZFS stream that would
+	// bring this node up to date
+	BytesBehind int64
+	// LastSyncAt - when the newest of the master's commits that this node
+	// has was made, zero if it has none of them
+	LastSyncAt time.Time
+	// Healthy is false if this node is missing a commit that has been on
+	// the master for longer than replication normally takes
+	Healthy bool
+}
+
 type ProcureArgs struct {
 	Namespace string
 	Name      string
 	Subdot    string
 }
 
+// ProcureNotReadyPrefix starts the message of Procure errors that mean the
+// volume can't be procured yet, but may well be if asked again shortly, e.g.
+// because the node it's on took too long to hand it over.
+const ProcureNotReadyPrefix = "not ready: "
+
 type RollbackRequest struct {
 	Namespace  string
 	Name       string
 	Branch     string
 	SnapshotId string
+	DryRun     bool
 }
 
 type ForkRequest struct {
 	MasterBranchId string
 	ForkNamespace  string
 	ForkName       string
+	// SourceCommitId - optional commit to fork from, empty means the latest
+	SourceCommitId string
 }
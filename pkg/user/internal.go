@@ -162,20 +162,41 @@ func (m *InternalManager) UpdatePassword(username string, password string) (*Use
 
 }
 
+// ResetAPIKey swaps the user's API key for a new one. The swap is a
+// compare-and-set, so it fails rather than overwriting a concurrent change to
+// the user. Requests are authenticated against the stored key every time, so
+// the old key stops working as soon as this returns.
 func (m *InternalManager) ResetAPIKey(username string) (*User, error) {
 	u, err := m.Get(&Query{Ref: username})
 	if err != nil {
 		return nil, err
 	}
 
-	apiKey, err := crypto.GenerateAPIKey()
+	kvp, err := m.kv.Get(UsersPrefix, u.Id)
+	if err != nil {
+		return nil, err
+	}
+	var current User
+	err = json.Unmarshal(kvp.Value, &current)
 	if err != nil {
 		return nil, err
 	}
 
-	u.ApiKey = apiKey
+	apiKey, err := crypto.GenerateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	current.ApiKey = apiKey
 
-	return m.Update(u)
+	bts, err := json.Marshal(&current)
+	if err != nil {
+		return nil, err
+	}
+	_, err = m.kv.CompareAndSet(UsersPrefix, current.Id, bts, kvp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update API key for user %s, it may have been changed concurrently: %s", current.Name, err)
+	}
+	return &current, nil
 }
 
 func (m *InternalManager) Authenticate(username, password string) (*User, AuthenticationType, error) {
@@ -37,6 +37,8 @@ func (at AuthenticationType) String() string {
 		return "password"
 	case AuthenticationTypeAPIKey:
 		return "apikey"
+	case AuthenticationTypeOIDC:
+		return "oidc"
 	}
 	return "unknown"
 }
@@ -49,6 +51,8 @@ func AuthenticationTypeFromString(at string) (AuthenticationType, error) {
 		return AuthenticationTypePassword, nil
 	case "apikey":
 		return AuthenticationTypeAPIKey, nil
+	case "oidc":
+		return AuthenticationTypeOIDC, nil
 	default:
 		return AuthenticationTypeNone, fmt.Errorf("Unknown authentication type %q", at)
 	}
@@ -58,7 +62,8 @@ const (
 	AuthenticationTypeNone AuthenticationType = iota
 	AuthenticationTypePassword
 	AuthenticationTypeAPIKey
-	// AuthenticationTypeOAuth
+	// AuthenticationTypeOIDC - a bearer ID token from the server's OIDC provider
+	AuthenticationTypeOIDC
 )
 
 type UserManager interface {
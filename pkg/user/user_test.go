@@ -237,3 +237,40 @@ func TestAuthenticateUserByAPIKey(t *testing.T) {
 		t.Errorf("unexpected authentication type: %s", at)
 	}
 }
+
+func TestResetAPIKey(t *testing.T) {
+	client, err := store.NewKVDBClient(&store.KVDBConfig{
+		Type: store.KVTypeMem,
+	})
+	if err != nil {
+		t.Fatalf("failed to init kv store: %s", err)
+	}
+	kvClient := store.NewKVDBStoreWithIndex(client, UsersPrefix)
+
+	um := NewInternal(kvClient)
+
+	stored, err := um.New("hermione", "hermione@wizzard.works", "verysecret")
+	if err != nil {
+		t.Fatalf("failed to create new user: %s", err)
+	}
+
+	updated, err := um.ResetAPIKey(stored.Name)
+	if err != nil {
+		t.Fatalf("failed to reset API key: %s", err)
+	}
+	if updated.ApiKey == "" || updated.ApiKey == stored.ApiKey {
+		t.Errorf("expected a new API key, got '%s'", updated.ApiKey)
+	}
+
+	_, _, err = um.Authenticate(stored.Name, stored.ApiKey)
+	if err == nil {
+		t.Errorf("old API key still works")
+	}
+	_, authType, err := um.Authenticate(stored.Name, updated.ApiKey)
+	if err != nil {
+		t.Fatalf("new API key doesn't work: %s", err)
+	}
+	if authType != AuthenticationTypeAPIKey {
+		t.Errorf("unexpected authentication type: %v", authType)
+	}
+}
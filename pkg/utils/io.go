@@ -4,6 +4,7 @@ import (
 	"compress/gzip"
 	"fmt"
 	"github.com/dotmesh-io/dotmesh/pkg/types"
+	"github.com/pierrec/lz4"
 	log "github.com/sirupsen/logrus"
 	"io"
 	"net/http"
@@ -53,6 +54,11 @@ func GetLogfile(logfile string) *os.File {
 //
 // if the writer implements http.Flusher, Flush() is called after each write.
 
+// compressMode is "compress" or "decompress" for the gzip streams, without
+// any actual compression, that replication normally uses, "none" to copy the
+// bytes as they are, or one of the modes CompressMode and DecompressMode
+// return for a types.TransferRequest's Compression.
+
 // TODO: pipe would be better named Copy
 func Pipe(
 	r io.Reader, rDesc string, w io.Writer, wDesc string,
@@ -131,6 +137,19 @@ func Pipe(
 			return
 		}
 		writer = w
+	} else if compressMode == "compress-gzip" {
+		writer, err = gzip.NewWriterLevel(w, gzip.BestSpeed)
+		if err != nil {
+			handleErr(fmt.Sprintf("Unable to create gzip writer: %s", err), r, w, r, w)
+			return
+		}
+		reader = r
+	} else if compressMode == "compress-lz4" {
+		writer = lz4.NewWriter(w)
+		reader = r
+	} else if compressMode == "decompress-lz4" {
+		reader = lz4.NewReader(r)
+		writer = w
 	} else if compressMode == "none" {
 		// no compression
 		reader = r
@@ -139,7 +158,8 @@ func Pipe(
 		handleErr(
 			fmt.Sprintf(
 				"Unsupported compression mode %s, choose one of 'compress', "+
-					"'decompress' or 'none'",
+					"'decompress', 'compress-gzip', 'compress-lz4', "+
+					"'decompress-lz4' or 'none'",
 				compressMode,
 			), r, w, r, w,
 		)
@@ -178,6 +198,10 @@ func Pipe(
 				// directly to an http.Flusher any more)
 				f.Flush()
 			}
+			if f, ok := writer.(*lz4.Writer); ok {
+				// likewise
+				f.Flush()
+			}
 			totalBytes += int64(nr)
 			rateLimit(func() {
 				// rate limit to once per second to avoid hammering notifyFunc
@@ -208,3 +232,24 @@ func Pipe(
 		}
 	}
 }
+
+// CompressMode is the compressMode for Pipe to send a zfs send stream with
+// compression, one of the types.Compression* constants.
+func CompressMode(compression string) string {
+	switch compression {
+	case types.CompressionGzip:
+		return "compress-gzip"
+	case types.CompressionLZ4:
+		return "compress-lz4"
+	}
+	return "compress"
+}
+
+// DecompressMode is the compressMode for Pipe to receive a zfs send stream
+// sent with CompressMode(compression). Any level of gzip reads the same.
+func DecompressMode(compression string) string {
+	if compression == types.CompressionLZ4 {
+		return "decompress-lz4"
+	}
+	return "decompress"
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dotmesh-io/dotmesh/pkg/types"
+)
+
+// pipe runs Pipe from r to a buffer in compressMode, and returns the buffer.
+func pipe(r *bytes.Reader, compressMode string) *bytes.Buffer {
+	var w bytes.Buffer
+	finished := make(chan bool, 1)
+	Pipe(
+		r, "reader", &w, "writer",
+		finished, make(chan *types.Event),
+		func(*types.Event, chan *types.Event) {},
+		func(int64, int64) {},
+		compressMode,
+	)
+	<-finished
+	return &w
+}
+
+func TestPipeCompressionRoundTrip(t *testing.T) {
+	// a few buffers' worth, repetitive enough for anything to compress
+	sent := bytes.Repeat([]byte("zfs send stream "), 4*types.BufLength/16+3)
+
+	for _, compression := range []string{types.CompressionNone, types.CompressionGzip, types.CompressionLZ4} {
+		compressed := pipe(bytes.NewReader(sent), CompressMode(compression))
+		if compression != types.CompressionNone && compressed.Len() >= len(sent)/2 {
+			t.Errorf("%q: expected the stream to be compressed, got %d bytes from %d", compression, compressed.Len(), len(sent))
+		}
+		received := pipe(bytes.NewReader(compressed.Bytes()), DecompressMode(compression))
+		if !bytes.Equal(received.Bytes(), sent) {
+			t.Errorf("%q: expected %d bytes back as sent, got %d different ones", compression, len(sent), received.Len())
+		}
+	}
+}
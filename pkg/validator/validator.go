@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"regexp"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -20,8 +21,21 @@ const (
 	BranchPattern          string = `^[a-zA-Z0-9_\-]{1,64}$`
 	SubDotPattern          string = `^[a-zA-Z0-9_\-]{1,64}$`
 	SnapshotPattern        string = `^[a-zA-Z0-9_\-]{1,64}$`
+	TagPattern             string = `^[a-zA-Z0-9_][a-zA-Z0-9_.\-]{0,63}$`
+
+	// New volumes' names are held to more than VolumeNamePattern, which
+	// volumes that already exist have to pass
+	NewVolumeNamePattern string = `^[a-z0-9_\-]{1,50}$`
 )
 
+// reservedVolumeNames can't be used as the names of new volumes, as they'd
+// be mistaken for a branch or namespace.
+var reservedVolumeNames = map[string]bool{
+	"master":  true,
+	"admin":   true,
+	"default": true,
+}
+
 var (
 	rxUUID        = regexp.MustCompile(UUID)
 	rxUUIDPattern = regexp.MustCompile(UUIDPattern)
@@ -31,6 +45,9 @@ var (
 	rxBranch      = regexp.MustCompile(BranchPattern)
 	rxSubdot      = regexp.MustCompile(SubDotPattern)
 	rxSnapshot    = regexp.MustCompile(SnapshotPattern)
+	rxTag         = regexp.MustCompile(TagPattern)
+	rxNewName     = regexp.MustCompile(NewVolumeNamePattern)
+	rxDigits      = regexp.MustCompile(`^[0-9]+$`)
 )
 
 // errors
@@ -39,11 +56,17 @@ var (
 	ErrEmptyNamespace       = errors.New("namespace cannot be empty")
 	ErrEmptySubdot          = errors.New("subdot cannot be empty")
 	ErrEmptySnapshot        = errors.New("snapshot cannot be empty")
+	ErrEmptyTag             = errors.New("tag cannot be empty")
 	ErrInvalidVolumeName    = fmt.Errorf("invalid dot name, should match pattern: %s", VolumeNamePattern)
 	ErrInvalidNamespaceName = fmt.Errorf("invalid namespace name, should match pattern: %s", VolumeNamespacePattern)
 	ErrInvalidBranchName    = fmt.Errorf("invalid branch name, should match pattern: %s", BranchPattern)
 	ErrInvalidSubdotName    = fmt.Errorf("invalid subdot name, should match pattern: %s", SubDotPattern)
 	ErrInvalidSnapshotName  = fmt.Errorf("invalid snapshot name, should match pattern: %s", SnapshotPattern)
+	ErrInvalidTagName       = fmt.Errorf("invalid tag name, should match pattern: %s", TagPattern)
+	ErrAmbiguousTagName     = errors.New("invalid tag name, it would be mistaken for a commit id or HEAD")
+	ErrInvalidNewVolumeName = errors.New("invalid dot name, new dots' names can only contain lower case letters, digits, underscores and hyphens, and be at most 50 characters long")
+	ErrDigitsVolumeName     = errors.New("invalid dot name, it can't be all digits")
+	ErrReservedVolumeName   = errors.New("invalid dot name, it's reserved")
 )
 
 // IsUUID check if the string is a UUID (version 3, 4 or 5).
@@ -90,6 +113,40 @@ func IsValidVolumeName(str string) error {
 	return nil
 }
 
+// IsValidNewVolume checks the namespace and name of a volume that's about to
+// be created, see IsValidNewVolumeName.
+func IsValidNewVolume(namespace, name string) error {
+	err := IsValidVolumeNamespace(namespace)
+	if err != nil {
+		return err
+	}
+
+	return IsValidNewVolumeName(name)
+}
+
+// IsValidNewVolumeName checks the name of a volume that's about to be
+// created, which has to match NewVolumeNamePattern, not be all digits and not
+// be reserved.
+func IsValidNewVolumeName(str string) error {
+	if str == "" {
+		return ErrEmptyName
+	}
+
+	if !rxNewName.MatchString(str) {
+		return ErrInvalidNewVolumeName
+	}
+
+	if rxDigits.MatchString(str) {
+		return ErrDigitsVolumeName
+	}
+
+	if reservedVolumeNames[str] {
+		return ErrReservedVolumeName
+	}
+
+	return nil
+}
+
 func IsValidVolumeNamespace(str string) error {
 	if str == "" {
 		return ErrEmptyNamespace
@@ -134,6 +191,24 @@ func IsValidSnapshotName(str string) error {
 	return nil
 }
 
+// IsValidTagName checks a commit tag, which mustn't look like a commit id or a
+// HEAD^ reference as it can be used in their place.
+func IsValidTagName(str string) error {
+	if str == "" {
+		return ErrEmptyTag
+	}
+
+	if !rxTag.MatchString(str) {
+		return ErrInvalidTagName
+	}
+
+	if IsUUID(str) || strings.HasPrefix(str, "HEAD") {
+		return ErrAmbiguousTagName
+	}
+
+	return nil
+}
+
 // ReplaceUUID replace UUID in string
 func ReplaceUUID(str, replace string) string {
 	return rxUUIDPattern.ReplaceAllString(str, replace)
@@ -161,3 +161,110 @@ func TestIsValidSubdotName(t *testing.T) {
 		})
 	}
 }
+
+func TestIsValidTagName(t *testing.T) {
+	type args struct {
+		str string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr error
+	}{
+		{
+			name:    "empty",
+			args:    args{str: ""},
+			wantErr: ErrEmptyTag,
+		},
+		{
+			name:    "version numbers are valid",
+			args:    args{str: "release-v1.2"},
+			wantErr: nil,
+		},
+		{
+			name:    "leading dot shouldn't be valid",
+			args:    args{str: ".hidden"},
+			wantErr: ErrInvalidTagName,
+		},
+		{
+			name:    "funny characters shouldn't be valid",
+			args:    args{str: "before migration"},
+			wantErr: ErrInvalidTagName,
+		},
+		{
+			name:    "commit ids shouldn't be valid",
+			args:    args{str: "8c9c1b7d-2b4e-4c6f-9a3e-1f2d3c4b5a69"},
+			wantErr: ErrAmbiguousTagName,
+		},
+		{
+			name:    "HEAD shouldn't be valid",
+			args:    args{str: "HEAD"},
+			wantErr: ErrAmbiguousTagName,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if gotErrs := IsValidTagName(tt.args.str); !reflect.DeepEqual(gotErrs, tt.wantErr) {
+				t.Errorf("IsValidTagName() = %v, want %v", gotErrs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsValidNewVolumeName(t *testing.T) {
+	type args struct {
+		str string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr error
+	}{
+		{
+			name:    "empty",
+			args:    args{str: ""},
+			wantErr: ErrEmptyName,
+		},
+		{
+			name:    "lower case, digits, underscores and hyphens are valid",
+			args:    args{str: "my-volume_2"},
+			wantErr: nil,
+		},
+		{
+			name:    "upper case shouldn't be valid",
+			args:    args{str: "Apples"},
+			wantErr: ErrInvalidNewVolumeName,
+		},
+		{
+			name:    "dots shouldn't be valid",
+			args:    args{str: "app.les"},
+			wantErr: ErrInvalidNewVolumeName,
+		},
+		{
+			name:    "too long",
+			args:    args{str: "000000000011111111112222222222333333333344444444445"},
+			wantErr: ErrInvalidNewVolumeName,
+		},
+		{
+			name:    "all digits shouldn't be valid",
+			args:    args{str: "1234"},
+			wantErr: ErrDigitsVolumeName,
+		},
+		{
+			name:    "reserved words shouldn't be valid",
+			args:    args{str: "master"},
+			wantErr: ErrReservedVolumeName,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if gotErrs := IsValidNewVolumeName(tt.args.str); !reflect.DeepEqual(gotErrs, tt.wantErr) {
+				t.Errorf("IsValidNewVolumeName() = %v, want %v", gotErrs, tt.wantErr)
+			}
+		})
+	}
+
+	if err := IsValidNewVolume("al ice", "apples"); err != ErrInvalidNamespaceName {
+		t.Errorf("IsValidNewVolume() = %v, want %v", err, ErrInvalidNamespaceName)
+	}
+}
@@ -40,6 +40,14 @@ type ZFS interface {
 	//    it'll be double-counted. Which is fine, probably, ZFS being smart is an
 	//    implementation detail.
 	GetDirtyDelta(filesystemId, latestSnap string) (dirtyBytes int64, usedBytes int64, err error)
+	// Return the space used by the filesystem and its snapshots, before and
+	// after compression ("logicalused" and "used"), and its "quota", 0 if it
+	// has none.
+	GetSpaceUsage(filesystemId string) (logicalBytes int64, compressedBytes int64, quotaBytes int64, err error)
+	// Set the filesystem's "quota" property, which caps the space it and its
+	// snapshots can use; 0 removes the quota.
+	SetQuota(filesystemId string, quotaBytes int64) error
+	GetQuotaUsage(filesystemId string) (*types.QuotaUsage, error)
 	Snapshot(filesystemId, snapshotId string, meta []string) ([]byte, error)
 	List(filesystemId, snapshotId string) ([]byte, error)
 	FQ(filesystemId string) string
@@ -48,6 +56,11 @@ type ZFS interface {
 	PredictSize(fromFilesystemId, fromSnapshotId, toFilesystemId, toSnapshotId string) (int64, error)
 	Clone(filesystemId, originSnapshotId, newCloneFilesystemId string) ([]byte, error)
 	Rollback(filesystemId, snapshotId string) ([]byte, error)
+	DestroySnapshot(filesystemId, snapshotId string) ([]byte, error)
+	RenameSnapshot(filesystemId, snapshotId, newSnapshotId string) ([]byte, error)
+	// Set meta as the snapshot's user properties, as Snapshot does with its
+	// meta when making one
+	SetSnapshotMetadata(filesystemId, snapshotId string, meta map[string]string) error
 	Create(filesystemId string) ([]byte, error)
 	Recv(pipeReader *io.PipeReader, toFilesystemId string, errBuffer *bytes.Buffer) error
 	ApplyPrelude(prelude types.Prelude, fs string) error
@@ -59,6 +72,10 @@ type ZFS interface {
 	// LastModified returns last modified temp snapshot, must be called after Diff
 	LastModified(filesystemID string) (*types.LastModified, error)
 	DestroyTmpSnapIfExists(filesystemId string) error
+	// CheckHealth reports on the pool, and on the dataset for filesystemId
+	CheckHealth(filesystemId string) (*types.VolumeHealth, error)
+	// PoolStatus reports on the pool; the NodeName is left for the caller
+	PoolStatus() (*types.PoolStatus, error)
 }
 
 var _ ZFS = &zfs{}
@@ -153,6 +170,41 @@ func (z *zfs) Rollback(filesystemId, snapshotId string) ([]byte, error) {
 	return z.runOnFilesystem(filesystemId, snapshotId, []string{"rollback", "-Rfr"})
 }
 
+func (z *zfs) DestroySnapshot(filesystemId, snapshotId string) ([]byte, error) {
+	return z.runOnFilesystem(filesystemId, snapshotId, []string{"destroy"})
+}
+
+func (z *zfs) RenameSnapshot(filesystemId, snapshotId, newSnapshotId string) ([]byte, error) {
+	fullName := z.fullZFSFilesystemPath(filesystemId, snapshotId)
+	newFullName := z.fullZFSFilesystemPath(filesystemId, newSnapshotId)
+	LogZFSCommand(filesystemId, fmt.Sprintf("%s rename %s %s", z.zfsPath, fullName, newFullName))
+	output, err := exec.Command(z.zfsPath, "rename", fullName, newFullName).CombinedOutput()
+	if err != nil {
+		log.Printf("[RenameSnapshot] %v while trying to rename snapshot %s to %s", err, fullName, newFullName)
+	}
+	return output, err
+}
+
+func (z *zfs) SetSnapshotMetadata(filesystemId, snapshotId string, meta map[string]string) error {
+	metadataEncoded, err := utils.EncodeMetadata(meta)
+	if err != nil {
+		return err
+	}
+	fullName := z.fullZFSFilesystemPath(filesystemId, snapshotId)
+	for _, k := range metadataEncoded {
+		// eh, would be better to refactor encodeMetadata
+		if k == "-o" {
+			continue
+		}
+		args := []string{"set", k, fullName}
+		out, err := exec.Command(z.zfsPath, args...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s -> %v: %s", args, err, out)
+		}
+	}
+	return nil
+}
+
 func (z *zfs) SetCanmount(filesystemId, snapshotId string) ([]byte, error) {
 	return z.runOnFilesystem(filesystemId, snapshotId, []string{"set", "canmount=noauto"})
 }
@@ -416,6 +468,78 @@ func (z *zfs) DeleteFilesystemInZFS(fs string) error {
 	return err
 }
 
+func (z *zfs) GetSpaceUsage(filesystemId string) (int64, int64, int64, error) {
+	o, err := exec.Command(
+		z.zfsPath, "get", "-pH", "-o", "value", "logicalused,used,quota", FQ(z.poolName, filesystemId),
+	).CombinedOutput()
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf(
+			"'zfs get -pH -o value logicalused,used,quota %s' errored with: %s %s",
+			FQ(z.poolName, filesystemId), err, o,
+		)
+	}
+	values := strings.Fields(string(o))
+	if len(values) != 3 {
+		return 0, 0, 0, fmt.Errorf("Unexpected output from zfs get logicalused,used,quota: %q", o)
+	}
+	logical, err := strconv.ParseInt(values[0], 10, 64)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	compressed, err := strconv.ParseInt(values[1], 10, 64)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	quota, err := strconv.ParseInt(values[2], 10, 64)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return logical, compressed, quota, nil
+}
+
+func (z *zfs) SetQuota(filesystemId string, quotaBytes int64) error {
+	quota := "none"
+	if quotaBytes > 0 {
+		quota = strconv.FormatInt(quotaBytes, 10)
+	}
+	output, err := z.runOnFilesystem(filesystemId, "", []string{"set", "quota=" + quota})
+	if err != nil {
+		return fmt.Errorf("%s when setting quota of %s: %s", err, filesystemId, string(output))
+	}
+	return nil
+}
+
+func (z *zfs) GetQuotaUsage(filesystemId string) (*types.QuotaUsage, error) {
+	o, err := exec.Command(
+		z.zfsPath, "get", "-pH", "-o", "value", "quota,used,available", FQ(z.poolName, filesystemId),
+	).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf(
+			"'zfs get -pH -o value quota,used,available %s' errored with: %s %s",
+			FQ(z.poolName, filesystemId), err, o,
+		)
+	}
+	return parseQuotaUsage(string(o))
+}
+
+// parseQuotaUsage parses the output of 'zfs get -pH -o value
+// quota,used,available', in which a filesystem without a quota has one of 0.
+func parseQuotaUsage(commandOutput string) (*types.QuotaUsage, error) {
+	values := strings.Fields(commandOutput)
+	if len(values) != 3 {
+		return nil, fmt.Errorf("Unexpected output from zfs get quota,used,available: %q", commandOutput)
+	}
+	usage := &types.QuotaUsage{}
+	for i, n := range []*int64{&usage.QuotaBytes, &usage.UsedBytes, &usage.AvailableBytes} {
+		var err error
+		*n, err = strconv.ParseInt(values[i], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Unexpected output from zfs get quota,used,available: %q", commandOutput)
+		}
+	}
+	return usage, nil
+}
+
 func (z *zfs) GetDirtyDelta(filesystemId, latestSnap string) (int64, int64, error) {
 	// Use "referenced" as the size of the filesystem, use
 	// "written@<snapshotname>" for bytes written since that snapshot. See
@@ -618,25 +742,10 @@ func (z *zfs) Recv(pipeReader *io.PipeReader, toFilesystemId string, errBuffer *
 func (z *zfs) ApplyPrelude(prelude types.Prelude, fs string) error {
 	// iterate over it setting zfs user properties accordingly.
 	for _, j := range prelude.SnapshotProperties {
-		metadataEncoded, err := utils.EncodeMetadata(j.Metadata)
+		err := z.SetSnapshotMetadata(fs, j.Id, j.Metadata)
 		if err != nil {
-			return err
-		}
-		for _, k := range metadataEncoded {
-			// eh, would be better to refactor encodeMetadata
-			if k != "-o" {
-				args := []string{"set"}
-				args = append(args, k)
-				args = append(args, z.FQ(fs)+"@"+j.Id)
-				out, err := exec.Command(z.zfsPath, args...).CombinedOutput()
-				if err != nil {
-					log.Errorf(
-						"[applyPrelude] Error applying prelude: %s, %s, %s", args, err, out,
-					)
-					return fmt.Errorf("Error applying prelude: %s -> %v: %s", args, err, out)
-				}
-				// log.Debugf("[applyPrelude] Applied snapshot props for: %s", j.Id)
-			}
+			log.Errorf("[applyPrelude] Error applying prelude: %s", err)
+			return fmt.Errorf("Error applying prelude: %v", err)
 		}
 	}
 	return nil
@@ -829,6 +938,172 @@ func (z *zfs) LastModified(filesystemID string) (*types.LastModified, error) {
 	}, nil
 }
 
+func (z *zfs) CheckHealth(filesystemId string) (*types.VolumeHealth, error) {
+	health := &types.VolumeHealth{
+		Status:    types.VolumeHealthy,
+		Errors:    []string{},
+		CheckedAt: time.Now(),
+	}
+
+	output, err := exec.Command(z.zpoolPath, "list", "-H", "-o", "health", z.poolName).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("%s when running zpool list: %s", err, string(output))
+	}
+	health.PoolStatus = strings.TrimSpace(string(output))
+
+	output, err = exec.Command(z.zpoolPath, "status", z.poolName).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("%s when running zpool status: %s", err, string(output))
+	}
+	health.Errors = append(health.Errors, parseZpoolStatusErrors(string(output))...)
+
+	switch health.PoolStatus {
+	case "ONLINE":
+	case "DEGRADED":
+		health.Status = types.VolumeDegraded
+	default:
+		health.Status = types.VolumeUnhealthy
+	}
+
+	output, err = exec.Command(z.zfsPath, "list", "-H", "-o", "name", z.FQ(filesystemId)).CombinedOutput()
+	if err != nil {
+		health.Status = types.VolumeUnhealthy
+		health.Errors = append(health.Errors, fmt.Sprintf(
+			"dataset %s: %s", z.FQ(filesystemId), strings.TrimSpace(string(output)),
+		))
+	}
+
+	if len(health.Errors) > 0 && health.Status == types.VolumeHealthy {
+		health.Status = types.VolumeDegraded
+	}
+	return health, nil
+}
+
+// parseZpoolStatusErrors picks the problems out of 'zpool status' output: the
+// "errors:" line unless there are none, and any device that isn't ONLINE.
+func parseZpoolStatusErrors(commandOutput string) []string {
+	errs := []string{}
+	inConfig := false
+	for _, line := range strings.Split(commandOutput, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "config:"):
+			inConfig = true
+		case strings.HasPrefix(trimmed, "errors:"):
+			inConfig = false
+			if !strings.Contains(trimmed, "No known data errors") {
+				errs = append(errs, trimmed)
+			}
+		case inConfig:
+			fields := strings.Fields(trimmed)
+			// NAME STATE READ WRITE CKSUM
+			if len(fields) >= 2 && fields[0] != "NAME" &&
+				fields[1] != "ONLINE" && fields[1] != "AVAIL" && fields[1] != "INUSE" {
+				errs = append(errs, fmt.Sprintf("%s is %s", fields[0], fields[1]))
+			}
+		}
+	}
+	return errs
+}
+
+func (z *zfs) PoolStatus() (*types.PoolStatus, error) {
+	listOutput, err := exec.Command(z.zpoolPath, "list", "-H", "-p", "-o", "name,health,size,allocated,free", z.poolName).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("%s when running zpool list: %s", err, string(listOutput))
+	}
+	status, err := parseZpoolList(string(listOutput))
+	if err != nil {
+		return nil, err
+	}
+
+	statusOutput, err := exec.Command(z.zpoolPath, "status", "-p", z.poolName).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("%s when running zpool status: %s", err, string(statusOutput))
+	}
+	err = parseZpoolStatusDevices(string(statusOutput), status)
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// parseZpoolList parses the output of 'zpool list -H -p -o
+// name,health,size,allocated,free'.
+func parseZpoolList(commandOutput string) (*types.PoolStatus, error) {
+	fields := strings.Split(strings.TrimSpace(commandOutput), "\t")
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("unexpected zpool list output: %s", commandOutput)
+	}
+	status := &types.PoolStatus{
+		PoolName:      fields[0],
+		State:         fields[1],
+		DegradedVdevs: []string{},
+	}
+	for i, n := range []*int64{&status.Capacity, &status.Used, &status.Free} {
+		var err error
+		*n, err = strconv.ParseInt(fields[i+2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected zpool list output: %s", commandOutput)
+		}
+	}
+	return status, nil
+}
+
+// parseZpoolStatusDevices adds up the error counts of the devices in 'zpool
+// status -p' output, and lists the ones that aren't ONLINE, in status. Only
+// leaf devices' counts are added up: zpool shows a mirror's or raidz's
+// errors, and the pool's, on their rows as well as their devices', so
+// counting every row would count them more than once.
+func parseZpoolStatusDevices(commandOutput string, status *types.PoolStatus) error {
+	type configRow struct {
+		indent int
+		fields []string
+	}
+	rows := []configRow{}
+	inConfig := false
+	for _, line := range strings.Split(commandOutput, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "config:"):
+			inConfig = true
+		case strings.HasPrefix(trimmed, "errors:"):
+			inConfig = false
+		case inConfig && trimmed != "":
+			rows = append(rows, configRow{
+				indent: len(line) - len(strings.TrimLeft(line, " \t")),
+				fields: strings.Fields(trimmed),
+			})
+		}
+	}
+
+	for i, row := range rows {
+		fields := row.fields
+		// NAME STATE READ WRITE CKSUM, skipping the headings of the logs,
+		// cache and spares sections, and spares, which have no counts
+		if len(fields) < 5 || fields[0] == "NAME" {
+			continue
+		}
+		counts := make([]int64, 3)
+		for i := range counts {
+			n, err := strconv.ParseInt(fields[i+2], 10, 64)
+			if err != nil {
+				return fmt.Errorf("unexpected zpool status line: %s", strings.Join(fields, " "))
+			}
+			counts[i] = n
+		}
+		if fields[0] != status.PoolName && fields[1] != "ONLINE" {
+			status.DegradedVdevs = append(status.DegradedVdevs, fields[0])
+		}
+		leaf := i == len(rows)-1 || rows[i+1].indent <= row.indent
+		if leaf {
+			status.ReadErrors += counts[0]
+			status.WriteErrors += counts[1]
+			status.ChecksumErrors += counts[2]
+		}
+	}
+	return nil
+}
+
 func parseSnapshotCreationTime(commandOutput string) (*time.Time, error) {
 
 	lines := strings.Split(string(commandOutput), "\n")
@@ -279,3 +279,142 @@ func TestZFSDiffFileModified(t *testing.T) {
 	expectChangesFromDiff(t, z, fsName, types.ZFSFileDiff{Change: types.FileChangeModified, Filename: "myfile.txt"})
 	checkDirtyDelta(t, z, fsName, "myfirstsnapshot", true, true)
 }
+
+func TestParseZpoolStatusErrors(t *testing.T) {
+	healthy := `  pool: pool
+ state: ONLINE
+  scan: none requested
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	pool        ONLINE       0     0     0
+	  /var/lib/dotmesh/dotmesh_data  ONLINE       0     0     0
+
+errors: No known data errors
+`
+	if errs := parseZpoolStatusErrors(healthy); len(errs) != 0 {
+		t.Errorf("expected no errors, got: %v", errs)
+	}
+
+	degraded := `  pool: pool
+ state: DEGRADED
+status: One or more devices could not be used because the label is missing or
+	invalid.
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	pool        DEGRADED     0     0     0
+	  mirror-0  DEGRADED     0     0     0
+	    sda     ONLINE       0     0     0
+	    sdb     UNAVAIL      0     0     0  corrupted data
+
+errors: 2 data errors, use '-v' for a list
+`
+	errs := parseZpoolStatusErrors(degraded)
+	expected := []string{
+		"pool is DEGRADED",
+		"mirror-0 is DEGRADED",
+		"sdb is UNAVAIL",
+		"errors: 2 data errors, use '-v' for a list",
+	}
+	if !reflect.DeepEqual(errs, expected) {
+		t.Errorf("expected %v, got: %v", expected, errs)
+	}
+}
+
+func TestParsePoolStatus(t *testing.T) {
+	status, err := parseZpoolList("pool\tDEGRADED\t10737418240\t1073741824\t9663676416\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = parseZpoolStatusDevices(`  pool: pool
+ state: DEGRADED
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	pool        DEGRADED     0     0     0
+	  mirror-0  DEGRADED     0     0     0
+	    sda     ONLINE       3     0     1
+	    sdb     UNAVAIL      0     2     0  corrupted data
+	spares
+	  sdc       AVAIL
+
+errors: 2 data errors, use '-v' for a list
+`, status)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &types.PoolStatus{
+		PoolName:       "pool",
+		State:          "DEGRADED",
+		Capacity:       10737418240,
+		Used:           1073741824,
+		Free:           9663676416,
+		ReadErrors:     3,
+		WriteErrors:    2,
+		ChecksumErrors: 1,
+		DegradedVdevs:  []string{"mirror-0", "sdb"},
+	}
+	if !reflect.DeepEqual(status, expected) {
+		t.Errorf("expected %+v, got: %+v", expected, status)
+	}
+
+	if _, err := parseZpoolList("pool\tONLINE\n"); err == nil {
+		t.Error("expected truncated zpool list output to be rejected")
+	}
+}
+
+func TestParsePoolStatusCountsLeafDevices(t *testing.T) {
+	// zpool shows the errors of a raidz's and a mirror's devices on their
+	// rows, and the pool's, too
+	status := &types.PoolStatus{PoolName: "pool", DegradedVdevs: []string{}}
+	err := parseZpoolStatusDevices(`  pool: pool
+ state: DEGRADED
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	pool        DEGRADED     7     2     4
+	  raidz1-0  DEGRADED     5     0     4
+	    sda     ONLINE       2     0     1
+	    sdb     FAULTED      3     0     3  too many errors
+	    sdc     ONLINE       0     0     0
+	  mirror-1  ONLINE       2     2     0
+	    sdd     ONLINE       2     0     0
+	    sde     ONLINE       0     2     0
+	logs
+	  sdf       ONLINE       0     0     0
+
+errors: No known data errors
+`, status)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &types.PoolStatus{
+		PoolName:       "pool",
+		ReadErrors:     7,
+		WriteErrors:    2,
+		ChecksumErrors: 4,
+		DegradedVdevs:  []string{"raidz1-0", "sdb"},
+	}
+	if !reflect.DeepEqual(status, expected) {
+		t.Errorf("expected %+v, got: %+v", expected, status)
+	}
+}
+
+func TestParseQuotaUsage(t *testing.T) {
+	usage, err := parseQuotaUsage("1073741824\n25088\n1073716736\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &types.QuotaUsage{QuotaBytes: 1073741824, UsedBytes: 25088, AvailableBytes: 1073716736}
+	if !reflect.DeepEqual(usage, expected) {
+		t.Errorf("expected %+v, got: %+v", expected, usage)
+	}
+
+	if _, err := parseQuotaUsage("0\n25088\n"); err == nil {
+		t.Error("expected truncated zfs get output to be rejected")
+	}
+}
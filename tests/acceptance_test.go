@@ -997,7 +997,7 @@ func TestSingleNode(t *testing.T) {
 		if !strings.Contains(resp, "again") {
 			t.Error("unable to find commit message in log output")
 		}
-		citools.RunOnNode(t, node1, "dm reset --hard HEAD^")
+		citools.RunOnNode(t, node1, "dm reset -f --hard HEAD^")
 		resp = citools.OutputFromRunOnNode(t, node1, "dm log")
 		if strings.Contains(resp, "again") {
 			t.Error("found 'again' in dm log when i shouldn't have")
@@ -1061,7 +1061,7 @@ func TestSingleNode(t *testing.T) {
 			t.Errorf("unexpected status code: %d, response body: %s, filesystem: %s", status, responseBody, fsname)
 		}
 
-		citools.RunOnNode(t, node1, "dm reset --hard HEAD^")
+		citools.RunOnNode(t, node1, "dm reset -f --hard HEAD^")
 		resp = citools.OutputFromRunOnNode(t, node1, "dm log")
 		if strings.Contains(resp, "again") {
 			t.Error("found 'again' in dm log when i shouldn't have")
@@ -2135,7 +2135,7 @@ func TestTwoNodesSameCluster(t *testing.T) {
 					}
 
 					// Log and continue on things that might get better
-					if !strings.Contains(dotStatus, "DIVERGED") || strings.Contains(dotStatus, "is missing") {
+					if !strings.Contains(dotStatus, "stash-") || strings.Contains(dotStatus, "is missing") {
 						fmt.Printf("Absence of Divergence branch or incomplete resolution on node: %s\n%s\n", node, dotStatus)
 						problemsFound = true
 					}
@@ -2145,7 +2145,7 @@ func TestTwoNodesSameCluster(t *testing.T) {
 						problemsFound = true
 					}
 
-					dmBranch := citools.OutputFromRunOnNode(t, node, "dm branch | grep DIVERGED")
+					dmBranch := citools.OutputFromRunOnNode(t, node, "dm branch | grep stash-")
 					citools.RunOnNode(
 						t, node,
 						fmt.Sprintf("dm checkout %s", strings.TrimSpace(strings.Replace(dmBranch, "*", "", -1))),
@@ -2153,7 +2153,7 @@ func TestTwoNodesSameCluster(t *testing.T) {
 
 					dmLog = citools.OutputFromRunOnNode(t, node, "dm log")
 					if !strings.Contains(dmLog, "node2 commit") {
-						fmt.Printf("Absence of non-master diverged commits on branch *DIVERGED on node: %s\n%s", node, dmLog)
+						fmt.Printf("Absence of non-master diverged commits on branch stash-* on node: %s\n%s", node, dmLog)
 						problemsFound = true
 					}
 
@@ -2454,7 +2454,7 @@ func TestTwoSingleNodeClusters(t *testing.T) {
 		citools.RunOnNode(t, node2, "dm push --stash-on-divergence cluster_0")
 
 		output := citools.OutputFromRunOnNode(t, node1, "dm branch")
-		if !strings.Contains(output, "master-DIVERGED-") {
+		if !strings.Contains(output, "stash-") {
 			t.Error("Stashed push did not create divergent branch")
 		}
 	})
@@ -2495,7 +2495,7 @@ func TestTwoSingleNodeClusters(t *testing.T) {
 		citools.RunOnNode(t, node2, "dm push --stash-on-divergence cluster_0")
 
 		output := citools.OutputFromRunOnNode(t, node1, "dm branch")
-		if !strings.Contains(output, "master-DIVERGED-") {
+		if !strings.Contains(output, "stash-") {
 			t.Error("Stashed push did not create divergent branch")
 		}
 	})
@@ -2538,7 +2538,7 @@ func TestTwoSingleNodeClusters(t *testing.T) {
 
 		// test resetting a commit made on a pushed volume
 		citools.RunOnNode(t, node2, "dm commit -m 'node2 commit'")
-		citools.RunOnNode(t, node1, "dm reset --hard HEAD^")
+		citools.RunOnNode(t, node1, "dm reset -f --hard HEAD^")
 		resp = citools.OutputFromRunOnNode(t, node1, "dm log")
 		if strings.Contains(resp, "node1 commit") {
 			t.Error("found 'node1 commit' in dm log when i shouldn't have")
@@ -2631,7 +2631,7 @@ func TestTwoSingleNodeClusters(t *testing.T) {
 		citools.RunOnNode(t, node1, "dm commit -m 'hello2'")
 		citools.RunOnNode(t, node2, "dm clone --stash-on-divergence cluster_0 "+fsname)
 		output := citools.OutputFromRunOnNode(t, node2, "dm branch")
-		if !strings.Contains(output, "master-DIVERGED-") {
+		if !strings.Contains(output, "stash-") {
 			t.Error("Stashed clone did not create divergent branch")
 		}
 	})